@@ -0,0 +1,822 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/razvandimescu/peekm/diff"
+	"github.com/razvandimescu/peekm/lint"
+	"github.com/razvandimescu/peekm/render"
+	"github.com/razvandimescu/peekm/search"
+	"github.com/razvandimescu/peekm/tree"
+	"github.com/yuin/goldmark"
+)
+
+// sourceLinePattern matches the source line attributes of preview HTML
+var sourceLinePattern = regexp.MustCompile(render.SourceLineAttribute + `="(\d+)"`)
+
+// maxRenderBodySize caps /api/render and /api/preview request bodies (10 MB)
+const maxRenderBodySize = 10 << 20
+
+// apiFileResponse is returned by /api/file
+type apiFileResponse struct {
+	Path      string           `json:"path"`                // Relative to the browse directory
+	Name      string           `json:"name"`                // Base file name
+	Raw       string           `json:"raw"`                 // Markdown source
+	HTML      string           `json:"html"`                // Rendered HTML fragment
+	Size      int64            `json:"size"`                // Bytes
+	ModTime   time.Time        `json:"mtime"`               // Last modification time
+	Session   *SessionMetadata `json:"session,omitempty"`   // Claude Code session info, if tracked
+	Permalink string           `json:"permalink,omitempty"` // /p/ URL that survives renames (--stable-links)
+}
+
+// apiExportFragmentResponse is returned by /api/export-fragment
+type apiExportFragmentResponse struct {
+	Path     string `json:"path"`     // Relative to the browse directory
+	HTML     string `json:"html"`     // Rendered body with inline styles, no page chrome
+	Markdown string `json:"markdown"` // Source, the plain-text flavor of a copy
+}
+
+// apiResyncResponse is returned by /api/resync
+type apiResyncResponse struct {
+	BrowsePath  string   `json:"browse_path"`
+	Files       []string `json:"files"`         // Whitelisted markdown files, relative and sorted
+	Dirs        []string `json:"dirs"`          // Directories created via /mkdir, relative
+	LastEventID string   `json:"last_event_id"` // Latest live-update event the lists reflect
+}
+
+// apiSessionResponse is returned by /api/session
+type apiSessionResponse struct {
+	Session    string         `json:"session"`
+	Active     bool           `json:"active"`                // Working since its last Stop event
+	Events     []sessionEvent `json:"events"`                // Oldest first
+	NextCursor string         `json:"next_cursor,omitempty"` // With ?limit= or ?cursor=, absent on the last page
+}
+
+// apiSessionDiffResponse is returned by /api/session-diff
+type apiSessionDiffResponse struct {
+	Path    string      `json:"path"`    // Relative to the browse directory
+	Session string      `json:"session"` // Session whose changes are shown
+	Since   time.Time   `json:"since"`   // When the pre-modification snapshot was taken
+	Added   int         `json:"added"`
+	Removed int         `json:"removed"`
+	Lines   []diff.Line `json:"lines"`
+}
+
+// apiLintResponse is returned by /api/lint
+type apiLintResponse struct {
+	Path        string            `json:"path"`        // Relative to the browse directory
+	Diagnostics []lint.Diagnostic `json:"diagnostics"` // Ordered by line and column
+}
+
+// apiResolveAnchorResponse is returned by /api/resolve-anchor
+type apiResolveAnchorResponse struct {
+	Path    string        `json:"path"`    // Relative to the browse directory
+	Query   string        `json:"query"`   // Anchor or heading text as asked
+	ID      string        `json:"id"`      // Best matching anchor, empty if none
+	URL     string        `json:"url"`     // /view/ link to the best match
+	Exact   bool          `json:"exact"`   // The query was the anchor itself
+	Matches []anchorMatch `json:"matches"` // Candidates, best first
+}
+
+// apiFindResponse is returned by /api/find
+type apiFindResponse struct {
+	Path    string         `json:"path"`    // Relative to the browse directory
+	Query   string         `json:"query"`   // Searched text, case-insensitive
+	Matches []render.Match `json:"matches"` // In document order
+}
+
+// apiSymbolsResponse is returned by /api/symbols
+type apiSymbolsResponse struct {
+	Path    string          `json:"path"`    // Relative to the browse directory
+	Symbols []render.Symbol `json:"symbols"` // In document order
+}
+
+// apiTreePage is the /api/tree response for ?limit= and ?cursor=
+type apiTreePage struct {
+	Tree       *tree.Node `json:"tree"`
+	NextCursor string     `json:"next_cursor,omitempty"` // Absent on the last page
+}
+
+// apiSearchResponse is returned by /api/search
+type apiSearchResponse struct {
+	Query      string            `json:"query"`
+	Indexing   bool              `json:"indexing"`              // The index is still catching up; results may be incomplete
+	Results    []apiSearchResult `json:"results"`               // Best first
+	NextCursor string            `json:"next_cursor,omitempty"` // Set when the page is full: ?cursor= for the results after it
+}
+
+// apiSearchResult is a file matching a full-text search, with its first hit
+type apiSearchResult struct {
+	Path    string  `json:"path"` // Relative to the browse directory
+	URL     string  `json:"url"`  // /view/ link, to the hit's section when it has one
+	Score   float64 `json:"score"`
+	Line    int     `json:"line,omitempty"`    // 1-based source line of the hit
+	Snippet string  `json:"snippet,omitempty"` // Text around the hit
+
+	// Every match, for pattern searches (?regex, ?word, ?case)
+	Matches []search.LineMatch `json:"matches,omitempty"`
+}
+
+// anchorMatch is a heading that a fuzzy anchor query may mean
+type anchorMatch struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Level int    `json:"level"`
+	Score int    `json:"score"` // 100 for the exact anchor, lower for looser matches
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write JSON response: %v", err)
+	}
+}
+
+// renderMarkdown converts markdown to an HTML fragment with the shared renderer settings
+func renderMarkdown(source []byte) (string, error) {
+	return render.ToHTML(newMarkdownRenderer(), source)
+}
+
+// serveAPITree returns the whitelisted file tree as nested JSON, optionally
+// limited to files modified by AI sessions (?session=, ?since=). With
+// ?limit= or ?cursor=, it returns the tree of one page of files by path
+// instead, wrapped with the next page's cursor.
+func serveAPITree(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTreeFilter(r)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid tree filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid page: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	root, next := buildFileTreePage(filter, page)
+	if root == nil {
+		root = &tree.Node{Name: ".", IsDir: true}
+	}
+	if page.limit == 0 {
+		writeJSON(w, http.StatusOK, root)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiTreePage{Tree: root, NextCursor: next})
+}
+
+// serveAPIResync returns the complete file list, for clients that missed
+// live-update events to rebuild their state from
+func serveAPIResync(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, resyncState())
+}
+
+// resyncState returns the file list and the last live-update event it reflects
+func resyncState() apiResyncResponse {
+	// Read the event ID first: events after it may already be in the lists, never the reverse
+	resp := apiResyncResponse{LastEventID: globalEventBuffer.lastID(), Files: []string{}, Dirs: []string{}}
+
+	fileMutex.RLock()
+	resp.BrowsePath = browseDir
+	files := markdownFiles.list()
+	dirs := slices.Clone(createdDirs)
+	fileMutex.RUnlock()
+
+	for _, file := range files {
+		resp.Files = append(resp.Files, filepath.ToSlash(getRelativePath(file)))
+	}
+	for _, dir := range dirs {
+		resp.Dirs = append(resp.Dirs, filepath.ToSlash(getRelativePath(dir)))
+	}
+	return resp
+}
+
+// serveAPIFile returns raw markdown, rendered HTML, and metadata for ?path=
+func serveAPIFile(w http.ResponseWriter, r *http.Request) {
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	info, err := os.Stat(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	rendered, err := renderFile(validated, content)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to render markdown", http.StatusInternalServerError)
+		return
+	}
+
+	resp := apiFileResponse{
+		Path:    filepath.ToSlash(relPath),
+		Name:    filepath.Base(validated),
+		Raw:     string(content),
+		HTML:    rendered,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if globalSessionStore != nil {
+		if metadata, found := globalSessionStore.get(validated); found {
+			resp.Session = metadata
+		}
+	}
+	if *stableLinks {
+		fileMutex.RLock()
+		resp.Permalink = permalinkURL(browseDir, validated)
+		fileMutex.RUnlock()
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serveAPIExportFragment returns a file rendered for pasting into email,
+// wikis and word processors: the body only, styles and syntax highlighting
+// inlined, no heading permalinks
+func serveAPIExportFragment(w http.ResponseWriter, r *http.Request) {
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	opts := markdownOptions()
+	opts.NoPermalinks, opts.InlineHighlighting = true, true
+	rendered, err := render.ToHTML(render.New(opts), expandSource(validated, content))
+	if err == nil {
+		rendered, err = render.InlineStyles(string(runRenderHook("post-render", *postRender, validated, []byte(rendered))))
+	}
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to render markdown", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiExportFragmentResponse{
+		Path:     filepath.ToSlash(relPath),
+		HTML:     rendered,
+		Markdown: string(content),
+	})
+}
+
+// handleAPIRender renders arbitrary markdown posted as {"markdown": "..."}
+func handleAPIRender(w http.ResponseWriter, r *http.Request) {
+	var req apiMarkdownRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxRenderBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rendered, err := renderMarkdown([]byte(req.Markdown))
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to render markdown", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiHTMLResponse{HTML: rendered})
+}
+
+// apiMarkdownRequest is the /api/render and /api/preview request body
+type apiMarkdownRequest struct {
+	Markdown string `json:"markdown"`
+}
+
+// apiHTMLResponse is returned by /api/render and /api/preview
+type apiHTMLResponse struct {
+	HTML string `json:"html"`
+}
+
+// handleAPIPreview renders unsaved editor content posted as {"markdown": "..."}
+// the way it will look once saved (tables of contents refreshed), for the
+// editor's live preview. Block elements carry data-source-line attributes so
+// the editor can sync scrolling and jump to the line of a clicked block.
+func handleAPIPreview(w http.ResponseWriter, r *http.Request) {
+	var req apiMarkdownRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxRenderBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	source, refreshed := updateTOC(req.Markdown, 0)
+	opts := markdownOptions()
+	opts.SourceLines = true
+	rendered, err := render.ToHTML(render.New(opts), []byte(source))
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to render markdown", http.StatusInternalServerError)
+		return
+	}
+	if refreshed {
+		rendered = remapSourceLines(rendered, req.Markdown, source)
+	}
+
+	writeJSON(w, http.StatusOK, apiHTMLResponse{HTML: rendered})
+}
+
+// remapSourceLines rewrites source line attributes rendered from refreshed
+// (the editor content with its TOC block regenerated) to lines of original.
+// Lines before and after the regenerated block shift; lines inside it map to
+// the block's first line.
+func remapSourceLines(rendered, original, refreshed string) string {
+	a, b := strings.Split(original, "\n"), strings.Split(refreshed, "\n")
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	return sourceLinePattern.ReplaceAllStringFunc(rendered, func(attr string) string {
+		line, _ := strconv.Atoi(sourceLinePattern.FindStringSubmatch(attr)[1])
+		switch {
+		case line <= prefix:
+		case line > len(b)-suffix:
+			line -= len(b) - len(a)
+		default:
+			line = prefix + 1
+		}
+		return fmt.Sprintf(`%s="%d"`, render.SourceLineAttribute, line)
+	})
+}
+
+// serveAPISession returns the typed hook events recorded for ?id=<session>,
+// paginated with ?limit= and ?cursor=
+func serveAPISession(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("id")
+	if sessionID == "" {
+		writeError(w, errCodeBadRequest, "Missing session id", http.StatusBadRequest)
+		return
+	}
+	if globalSessionStore == nil {
+		writeError(w, errCodeNotFound, "AI session tracking is disabled", http.StatusNotFound)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid page: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events := globalSessionStore.sessionEvents(sessionID)
+	if len(events) == 0 {
+		writeError(w, errCodeNotFound, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	// Paged by time, so events dropped from the front don't shift the pages
+	events, next := paginate(events, page, func(e sessionEvent, key string) bool {
+		at, _ := parseTimeKey(key)
+		return !e.Timestamp.After(at)
+	}, func(e sessionEvent) string { return timeKey(e.Timestamp, "") })
+	writeJSON(w, http.StatusOK, apiSessionResponse{
+		Session:    sessionID,
+		Active:     globalSessionStore.isActive(sessionID),
+		Events:     events,
+		NextCursor: next,
+	})
+}
+
+// serveAPISessionDiff returns the line diff between a file's pre-modification
+// snapshot and its current content for ?path=
+func serveAPISessionDiff(w http.ResponseWriter, r *http.Request) {
+	if globalSessionStore == nil {
+		writeError(w, errCodeNotFound, "AI session tracking is disabled", http.StatusNotFound)
+		return
+	}
+
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	snap, found := globalSessionStore.getSnapshot(validated)
+	if !found {
+		writeError(w, errCodeNotFound, "No AI changes recorded for this file", http.StatusNotFound)
+		return
+	}
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	lines := diff.Lines(snap.Content, string(content))
+	added, removed := diff.Stats(lines)
+	writeJSON(w, http.StatusOK, apiSessionDiffResponse{
+		Path:    filepath.ToSlash(relPath),
+		Session: snap.SessionID,
+		Since:   snap.Timestamp,
+		Added:   added,
+		Removed: removed,
+		Lines:   lines,
+	})
+}
+
+// serveAPILint returns lint diagnostics for a markdown file (optional
+// max_line_length overrides the line-length limit)
+func serveAPILint(w http.ResponseWriter, r *http.Request) {
+	opts := lint.Options{}
+	if value := r.URL.Query().Get("max_line_length"); value != "" {
+		maxLineLength, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, errCodeBadRequest, "Invalid max_line_length", http.StatusBadRequest)
+			return
+		}
+		opts.MaxLineLength = maxLineLength
+	}
+
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiLintResponse{
+		Path:        filepath.ToSlash(relPath),
+		Diagnostics: lint.Check(content, opts),
+	})
+}
+
+// serveAPIResolveAnchor maps an anchor or heading text (?q=) to the exact
+// heading anchor of a markdown file, for tools that generate deep links
+func serveAPIResolveAnchor(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "#")
+	if query == "" {
+		writeError(w, errCodeBadRequest, "Missing anchor", http.StatusBadRequest)
+		return
+	}
+
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	resp := apiResolveAnchorResponse{
+		Path:    filepath.ToSlash(relPath),
+		Query:   query,
+		Matches: matchAnchors(render.Headings(newMarkdownRenderer(), expandSource(validated, content)), query),
+	}
+	if len(resp.Matches) > 0 {
+		best := resp.Matches[0]
+		resp.ID, resp.Exact = best.ID, best.Score == 100
+		resp.URL = viewURL(relPath) + "#" + best.ID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// matchAnchors scores the headings against an anchor or heading text query:
+// the exact anchor, then the same text, anchor prefixes and substrings, then
+// the share of query words in the anchor. Non-matching headings are dropped.
+func matchAnchors(headings []render.Heading, query string) []anchorMatch {
+	slug := render.HeadingSlug(query)
+	words := strings.FieldsFunc(slug, func(r rune) bool { return r == '-' })
+
+	matches := []anchorMatch{}
+	for _, h := range headings {
+		if h.ID == "" {
+			continue
+		}
+		if score := anchorScore(h, query, slug, words); score > 0 {
+			matches = append(matches, anchorMatch{ID: h.ID, Text: h.Text, Level: h.Level, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+// anchorScore rates how well a heading matches a query (see matchAnchors)
+func anchorScore(h render.Heading, query, slug string, words []string) int {
+	switch {
+	case h.ID == query:
+		return 100
+	case h.ID == slug || strings.EqualFold(strings.TrimSpace(h.Text), query):
+		return 90
+	case slug != "" && strings.HasPrefix(h.ID, slug):
+		return 80
+	case slug != "" && strings.Contains(h.ID, slug):
+		return 70
+	case len(words) == 0:
+		return 0
+	}
+	idWords := strings.Split(h.ID, "-")
+	found := 0
+	for _, word := range words {
+		if slices.Contains(idWords, word) || (len(word) >= 3 && strings.Contains(h.ID, word)) {
+			found++
+		}
+	}
+	return 60 * found / len(words)
+}
+
+// serveAPIFind searches the text of a markdown file for ?q= and returns each
+// match's source position and where it lands in the rendered page: the
+// section heading anchor, the block and the match's index in the section.
+// Positions refer to the source as rendered (after includes and --pre-render).
+func serveAPIFind(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		writeError(w, errCodeBadRequest, "Missing search query", http.StatusBadRequest)
+		return
+	}
+
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	// Search the text as typed, not with typographic quotes and dashes
+	opts := markdownOptions()
+	opts.NoTypographer = true
+	writeJSON(w, http.StatusOK, apiFindResponse{
+		Path:    filepath.ToSlash(relPath),
+		Query:   query,
+		Matches: render.Find(render.New(opts), expandSource(validated, content), query),
+	})
+}
+
+// serveAPISymbols returns the outline of a markdown file: headings with their
+// sections, link reference and footnote definitions, and fenced code blocks
+// with their language. Ranges count like a language server's (0-based lines,
+// UTF-16 characters) in the file as saved, so editors can use them as they are.
+func serveAPISymbols(w http.ResponseWriter, r *http.Request) {
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiSymbolsResponse{
+		Path:    filepath.ToSlash(relPath),
+		Symbols: render.Symbols(newMarkdownRenderer(), content),
+	})
+}
+
+// Result counts for /api/search: ?limit= defaults to defaultSearchLimit and is
+// capped at maxSearchLimit. Pattern searches list up to maxFileMatches matches
+// per file.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxFileMatches     = 100
+)
+
+// searchRequest is a parsed /api/search query
+type searchRequest struct {
+	query   string
+	limit   int
+	after   string                // Decoded ?cursor=: the searchKey of the previous page's last result
+	dir     string                // Absolute directory to search in, "" for all
+	options search.PatternOptions // Pattern search options
+	pattern bool                  // Match line by line instead of ranking by terms
+}
+
+// parseSearchRequest reads ?q=, ?limit=, ?cursor=, ?dir= and the pattern
+// options ?regex=1, ?word=1 and ?case=1
+func parseSearchRequest(r *http.Request) (searchRequest, error) {
+	q := r.URL.Query()
+	req := searchRequest{
+		query: q.Get("q"),
+		limit: defaultSearchLimit,
+		options: search.PatternOptions{
+			Regex:         q.Get("regex") == "1",
+			Word:          q.Get("word") == "1",
+			CaseSensitive: q.Get("case") == "1",
+		},
+	}
+	req.pattern = req.options.Regex || req.options.Word || req.options.CaseSensitive
+	if strings.TrimSpace(req.query) == "" {
+		return req, errors.New("missing search query")
+	}
+	if value := q.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return req, errors.New("invalid limit")
+		}
+		req.limit = min(n, maxSearchLimit)
+	}
+	if value := q.Get("cursor"); value != "" {
+		after, err := decodeCursor(value)
+		if err != nil {
+			return req, err
+		}
+		req.after = after
+	}
+	dir, err := resolveSearchDir(q.Get("dir"))
+	req.dir = dir
+	return req, err
+}
+
+// resolveSearchDir turns a directory relative to the browse directory into
+// the absolute path searches are limited to ("" for the whole tree)
+func resolveSearchDir(dir string) (string, error) {
+	dir = filepath.Clean(strings.TrimPrefix(dir, "/"))
+	if dir == "." {
+		return "", nil
+	}
+	if dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return "", errors.New("directory outside the browsed directory")
+	}
+	return resolveFilePath(dir), nil
+}
+
+// inSearchDir reports whether path is inside dir ("" for everywhere)
+func inSearchDir(path, dir string) bool {
+	return dir == "" || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// serveAPISearch searches the contents of every markdown file. Plain queries
+// are ranked by the full-text index; pattern queries are matched line by line
+// like grep, using the index to skip files when it can.
+func serveAPISearch(w http.ResponseWriter, r *http.Request) {
+	req, err := parseSearchRequest(r)
+	if err != nil {
+		writeError(w, errCodeBadRequest, fmt.Sprintf("Invalid search: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	index, building := textIndex.current()
+	var results []apiSearchResult
+	if req.pattern || index == nil {
+		pattern, err := search.Compile(req.query, req.options)
+		if err != nil {
+			writeError(w, errCodeBadRequest, fmt.Sprintf("Invalid regex: %v", err), http.StatusBadRequest)
+			return
+		}
+		results = patternSearch(req, pattern, grepCandidates(req, index, building))
+	} else {
+		results = rankedSearch(req, index)
+	}
+	resp := apiSearchResponse{Query: req.query, Indexing: building, Results: results}
+	if len(results) == req.limit {
+		last := results[len(results)-1]
+		resp.NextCursor = encodeCursor(searchKey(last.Score, filepath.FromSlash(last.Path)))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// searchKey is the sort key of a search result: results are ordered by
+// score, best first, and then by path
+func searchKey(score float64, relPath string) string {
+	return strconv.FormatFloat(score, 'g', -1, 64) + "\x00" + relPath
+}
+
+// searchedBefore reports whether a result sorts at or before the searchKey
+// after, that is was on an earlier page ("" for none)
+func searchedBefore(score float64, relPath, after string) bool {
+	if after == "" {
+		return false
+	}
+	value, path, _ := strings.Cut(after, "\x00")
+	afterScore, _ := strconv.ParseFloat(value, 64)
+	return score > afterScore || (score == afterScore && relPath <= path)
+}
+
+// rankedSearch returns the files the index ranks best for the query's terms,
+// each with its first hit
+func rankedSearch(req searchRequest, index *search.Index) []apiSearchResult {
+	opts := markdownOptions()
+	opts.NoTypographer = true
+	md := render.New(opts)
+	results := []apiSearchResult{}
+	for _, hit := range index.Search(req.query, 0) {
+		if len(results) == req.limit {
+			break
+		}
+		if !inSearchDir(hit.Path, req.dir) || !isWhitelistedFile(hit.Path) {
+			continue // Out of scope, or left over from a file removed while the index catches up
+		}
+		relPath := getRelativePath(hit.Path)
+		if searchedBefore(hit.Score, relPath, req.after) {
+			continue
+		}
+		result := apiSearchResult{Path: filepath.ToSlash(relPath), URL: viewURL(relPath), Score: hit.Score}
+		if match, found := firstSearchHit(md, hit.Path, req.query); found {
+			result.Line, result.Snippet = match.Line, match.Context
+			if match.Anchor != "" {
+				result.URL += "#" + match.Anchor
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// grepCandidates returns the files a pattern search reads, in result order.
+// Whole-word literal queries only need the files the index finds for their
+// terms (ranked); other queries read every file, by path.
+func grepCandidates(req searchRequest, index *search.Index, building bool) []search.Result {
+	if index != nil && !building && req.options.Word && !req.options.Regex && len(search.Terms(req.query)) > 0 {
+		return index.Search(req.query, 0)
+	}
+	files := whitelistedFiles()
+	candidates := make([]search.Result, len(files))
+	for i, file := range files {
+		candidates[i] = search.Result{Path: file}
+	}
+	return candidates
+}
+
+// patternSearch returns the candidates with matches of pattern, each with
+// every match (up to maxFileMatches)
+func patternSearch(req searchRequest, pattern *search.Pattern, candidates []search.Result) []apiSearchResult {
+	results := []apiSearchResult{}
+	for _, candidate := range candidates {
+		if len(results) == req.limit {
+			break
+		}
+		if !inSearchDir(candidate.Path, req.dir) || !isWhitelistedFile(candidate.Path) {
+			continue
+		}
+		relPath := getRelativePath(candidate.Path)
+		if searchedBefore(candidate.Score, relPath, req.after) {
+			continue
+		}
+		content, err := os.ReadFile(candidate.Path)
+		if err != nil {
+			continue
+		}
+		matches := pattern.Find(content, maxFileMatches)
+		if len(matches) == 0 {
+			continue
+		}
+		results = append(results, apiSearchResult{
+			Path:    filepath.ToSlash(relPath),
+			URL:     viewURL(relPath),
+			Score:   candidate.Score,
+			Line:    matches[0].Line,
+			Snippet: matches[0].Snippet,
+			Matches: matches,
+		})
+	}
+	return results
+}
+
+// firstSearchHit finds where a file matches query: the whole query if it
+// appears as typed, otherwise its first term that appears
+func firstSearchHit(md goldmark.Markdown, path, query string) (render.Match, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return render.Match{}, false
+	}
+	for _, q := range append([]string{query}, search.Terms(query)...) {
+		if matches := render.Find(md, content, q); len(matches) > 0 {
+			return matches[0], true
+		}
+	}
+	return render.Match{}, false
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/razvandimescu/peekm/render"
+	"github.com/razvandimescu/peekm/search"
+)
+
+// TestHandleAPIRender tests rendering arbitrary markdown through the JSON API
+func TestHandleAPIRender(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/render", strings.NewReader(`{"markdown": "# Title\n\n**bold**"}`))
+	rec := httptest.NewRecorder()
+	handleAPIRender(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if !strings.Contains(resp["html"], `<h1 id="title">Title</h1>`) || !strings.Contains(resp["html"], "<strong>bold</strong>") {
+		t.Errorf("unexpected html: %s", resp["html"])
+	}
+}
+
+// TestHandleAPIPreview tests rendering unsaved content as it will look once saved
+func TestHandleAPIPreview(t *testing.T) {
+	body := `{"markdown": "# Doc\n\n<!-- toc -->\n<!-- /toc -->\n\n## Setup\n"}`
+	req := httptest.NewRequest("POST", "/api/preview", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handleAPIPreview(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var resp apiHTMLResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	// Source lines refer to the posted text, not the one with the TOC filled in
+	if !strings.Contains(resp.HTML, `<h2 id="setup" data-source-line="6">Setup</h2>`) || !strings.Contains(resp.HTML, `<a href="#setup">Setup</a>`) {
+		t.Errorf("preview missing heading or refreshed TOC: %s", resp.HTML)
+	}
+}
+
+// TestMatchAnchors tests fuzzy heading resolution for /api/resolve-anchor
+func TestMatchAnchors(t *testing.T) {
+	headings := []render.Heading{
+		{Level: 1, Text: "Install Guide", ID: "install-guide"},
+		{Level: 2, Text: "Setup", ID: "setup"},
+		{Level: 2, Text: "Setup", ID: "setup-1"},
+		{Level: 2, Text: "Configuring the Server", ID: "configuring-the-server"},
+	}
+	tests := []struct {
+		query string
+		want  string // Best match, "" for none
+		score int
+	}{
+		{"setup-1", "setup-1", 100},
+		{"Install Guide", "install-guide", 90},
+		{"setup", "setup", 100},
+		{"install", "install-guide", 80},
+		{"the-server", "configuring-the-server", 70},
+		{"server configuring", "configuring-the-server", 60},
+		{"configure server", "configuring-the-server", 30},
+		{"deployment", "", 0},
+	}
+	for _, tt := range tests {
+		matches := matchAnchors(headings, tt.query)
+		var got string
+		var score int
+		if len(matches) > 0 {
+			got, score = matches[0].ID, matches[0].Score
+		}
+		if got != tt.want || score != tt.score {
+			t.Errorf("matchAnchors(%q) best = %q (%d), want %q (%d)", tt.query, got, score, tt.want, tt.score)
+		}
+	}
+}
+
+// TestServeAPIResolveAnchor tests the resolve-anchor response for a served file
+func TestServeAPIResolveAnchor(t *testing.T) {
+	serveTestFiles(t, "anchor", map[string]string{"guide.md": "# Guide\n\n## Getting Started\n"})
+
+	rec := httptest.NewRecorder()
+	serveAPIResolveAnchor(rec, httptest.NewRequest("GET", "/api/resolve-anchor?path=guide.md&q=getting+started", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiResolveAnchorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.ID != "getting-started" || resp.Exact || resp.URL != "/view/guide.md#getting-started" {
+		t.Errorf("response = %+v, want a non-exact match on getting-started", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	serveAPIResolveAnchor(rec, httptest.NewRequest("GET", "/api/resolve-anchor?path=guide.md", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("missing q: status = %d, want 400", rec.Code)
+	}
+}
+
+// TestServeAPIExportFragment tests the pasteable rendering of a served file
+func TestServeAPIExportFragment(t *testing.T) {
+	source := "# Memo\n\n```go\nx := 1\n```\n"
+	serveTestFiles(t, "export", map[string]string{"memo.md": source})
+
+	rec := httptest.NewRecorder()
+	serveAPIExportFragment(rec, httptest.NewRequest("GET", "/api/export-fragment?path=memo.md", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiExportFragmentResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.Path != "memo.md" || resp.Markdown != source {
+		t.Errorf("path %q, markdown %q", resp.Path, resp.Markdown)
+	}
+	if !strings.HasPrefix(resp.HTML, `<div style=`) || !strings.Contains(resp.HTML, `<h1 id="memo" style="font-size: 2em;`) ||
+		strings.Contains(resp.HTML, "class=") || strings.Contains(resp.HTML, "<html") {
+		t.Errorf("html = %s, want a styled fragment without classes, permalinks or page chrome", resp.HTML)
+	}
+
+	rec = httptest.NewRecorder()
+	serveAPIExportFragment(rec, httptest.NewRequest("GET", "/api/export-fragment?path=other.md", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unlisted file: status = %d, want 403", rec.Code)
+	}
+}
+
+// TestServeAPIFind tests the find response for a served file
+func TestServeAPIFind(t *testing.T) {
+	serveTestFiles(t, "find", map[string]string{"notes.md": "# Notes\n\nIt's a \"draft\".\n\n## Later\n\nAnother draft.\n"})
+
+	rec := httptest.NewRecorder()
+	serveAPIFind(rec, httptest.NewRequest("GET", `/api/find?path=notes.md&q=%22Draft%22`, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiFindResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	// Typed quotes match even though the page renders curly ones
+	if len(resp.Matches) != 1 || resp.Matches[0].Line != 3 || resp.Matches[0].Anchor != "notes" {
+		t.Errorf("matches = %+v, want one on line 3 in #notes", resp.Matches)
+	}
+
+	rec = httptest.NewRecorder()
+	serveAPIFind(rec, httptest.NewRequest("GET", "/api/find?path=notes.md&q=", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("missing q: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestServeAPISymbols(t *testing.T) {
+	serveTestFiles(t, "symbols", map[string]string{"notes.md": "# Notes\n\n```sh\nmake\n```\n\n[home]: https://example.com\n"})
+
+	rec := httptest.NewRecorder()
+	serveAPISymbols(rec, httptest.NewRequest("GET", "/api/symbols?path=notes.md", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiSymbolsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	var kinds []string
+	for _, s := range resp.Symbols {
+		kinds = append(kinds, s.Kind+" "+s.Name)
+	}
+	if want := []string{"heading Notes", "code sh", "link_definition home"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("symbols = %q, want %q", kinds, want)
+	}
+	if !strings.Contains(rec.Body.String(), `"selection_range":{"start":{"line":2,"character":0},"end":{"line":2,"character":5}}`) {
+		t.Errorf("code fence range missing from %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	serveAPISymbols(rec, httptest.NewRequest("GET", "/api/symbols?path=other.md", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unserved file: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestServeAPISearch(t *testing.T) {
+	dir := t.TempDir()
+	cache, guide := filepath.Join(dir, "cache.md"), filepath.Join(dir, "guide.md")
+	files := map[string]string{
+		cache: "# Cache\n\nIntro.\n\n## Eviction\n\nThe cache evicts old pages.\n",
+		guide: "# Guide\n\nRead the docs.\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevDir, prevFiles, prevIndex := browseDir, markdownFiles, textIndex
+	defer func() { browseDir, markdownFiles, textIndex = prevDir, prevFiles, prevIndex }()
+	browseDir, markdownFiles = dir, newFileSet([]string{cache, guide})
+	textIndex = &fullTextIndex{index: search.New()}
+	reconcileSearchIndex(textIndex.index, markdownFiles.list())
+
+	rec := httptest.NewRecorder()
+	serveAPISearch(rec, httptest.NewRequest("GET", "/api/search?q=evicts+pag", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiSearchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	want := apiSearchResult{Path: "cache.md", URL: "/view/cache.md#eviction", Line: 7, Snippet: "The cache evicts old pages."}
+	if len(resp.Results) != 1 {
+		t.Fatalf("results = %+v, want one", resp.Results)
+	}
+	if got := resp.Results[0]; got.Path != want.Path || got.URL != want.URL || got.Line != want.Line || got.Snippet != want.Snippet {
+		t.Errorf("result = %+v, want %+v", got, want)
+	}
+
+	for _, query := range []string{"q=", "q=docs&limit=0"} {
+		rec = httptest.NewRecorder()
+		serveAPISearch(rec, httptest.NewRequest("GET", "/api/search?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestServeAPISearchPatterns(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "api"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	readme, auth := filepath.Join(dir, "README.md"), filepath.Join(dir, "api", "auth.md")
+	files := map[string]string{
+		readme: "# Tokens\n\nSee TODO-12 and todo-3.\n",
+		auth:   "# Auth\n\nTokens expire. TODO-7: refresh tokens.\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prevDir, prevFiles, prevIndex := browseDir, markdownFiles, textIndex
+	defer func() { browseDir, markdownFiles, textIndex = prevDir, prevFiles, prevIndex }()
+	browseDir, markdownFiles = dir, newFileSet([]string{readme, auth})
+	textIndex = &fullTextIndex{index: search.New()}
+	reconcileSearchIndex(textIndex.index, markdownFiles.list())
+
+	tests := []struct {
+		query string
+		want  map[string][]int // Path -> matched lines
+	}{
+		{`q=TODO-\d%2B&regex=1&case=1`, map[string][]int{"README.md": {3}, "api/auth.md": {3}}},
+		{`q=TODO-\d%2B&regex=1&case=1&dir=api`, map[string][]int{"api/auth.md": {3}}},
+		{`q=todo&word=1`, map[string][]int{"README.md": {3, 3}, "api/auth.md": {3}}},
+		{`q=Tokens&case=1`, map[string][]int{"README.md": {1}, "api/auth.md": {3}}},
+		{`q=tokens&dir=api`, map[string][]int{"api/auth.md": {3}}}, // Ranked: first hit only
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		serveAPISearch(rec, httptest.NewRequest("GET", "/api/search?"+tt.query, nil))
+		var resp apiSearchResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: status %d, invalid JSON: %s", tt.query, rec.Code, rec.Body.String())
+		}
+		got := make(map[string][]int)
+		for _, result := range resp.Results {
+			got[result.Path] = []int{result.Line}
+			if len(result.Matches) > 0 {
+				got[result.Path] = nil
+				for _, m := range result.Matches {
+					got[result.Path] = append(got[result.Path], m.Line)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: matched lines = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"q=(&regex=1", "q=x&dir=../etc"} {
+		rec := httptest.NewRecorder()
+		serveAPISearch(rec, httptest.NewRequest("GET", "/api/search?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+// TestServeAPIResync tests the full-state file list for reconnecting clients
+func TestServeAPIResync(t *testing.T) {
+	dir := t.TempDir()
+	prevDir, prevFiles, prevDirs, prevEvents := browseDir, markdownFiles, createdDirs, globalEventBuffer
+	defer func() {
+		browseDir, markdownFiles, createdDirs, globalEventBuffer = prevDir, prevFiles, prevDirs, prevEvents
+	}()
+	browseDir = dir
+	markdownFiles = newFileSet([]string{filepath.Join(dir, "notes", "b.md"), filepath.Join(dir, "a.md")})
+	createdDirs = []string{filepath.Join(dir, "drafts")}
+	globalEventBuffer = newEventBuffer(5)
+	globalEventBuffer.add(`{"type":"file_added","path":"a.md"}`)
+
+	rec := httptest.NewRecorder()
+	serveAPIResync(rec, httptest.NewRequest("GET", "/api/resync", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiResyncResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	want := apiResyncResponse{BrowsePath: dir, Files: []string{"a.md", "notes/b.md"}, Dirs: []string{"drafts"}, LastEventID: "1"}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("response = %+v, want %+v", resp, want)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/razvandimescu/peekm/render"
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// benchEventsPerRun is how many events "peekm bench" fans out per run
+const benchEventsPerRun = 100
+
+// benchResult is one step timed by "peekm bench"
+type benchResult struct {
+	Name   string        `json:"name"`
+	Detail string        `json:"detail"` // What one run covers
+	Runs   int           `json:"runs"`
+	Min    time.Duration `json:"min_ns"`
+	Median time.Duration `json:"median_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+// measure runs fn runs times and reports its fastest, median and slowest run
+func measure(name, detail string, runs int, fn func()) benchResult {
+	durations := make([]time.Duration, runs)
+	for i := range durations {
+		start := time.Now()
+		fn()
+		durations[i] = time.Since(start)
+	}
+	slices.Sort(durations)
+	return benchResult{Name: name, Detail: detail, Runs: runs, Min: durations[0], Median: durations[runs/2], Max: durations[runs-1]}
+}
+
+// clearWordCountCache forgets the word counts, so the next tree reads every file
+func clearWordCountCache() {
+	wordCountCache.mu.Lock()
+	defer wordCountCache.mu.Unlock()
+	clear(wordCountCache.counts)
+}
+
+// benchClients are SSE clients connected by "peekm bench" and the benchmarks
+type benchClients []*sseClient
+
+// connectBenchClients registers n SSE clients without connections; drain
+// takes the events the server queued for them
+func connectBenchClients(n int) benchClients {
+	connected := make(benchClients, n)
+	for i := range connected {
+		r, _ := http.NewRequest(http.MethodGet, "/events", nil)
+		r.RemoteAddr = "bench"
+		connected[i], _ = registerClient(r)
+	}
+	return connected
+}
+
+// drain empties the clients' event queues, as their connections would
+func (bc benchClients) drain() {
+	for _, c := range bc {
+		for len(c.ch) > 0 {
+			<-c.ch
+		}
+	}
+}
+
+// disconnect unregisters the clients
+func (bc benchClients) disconnect() {
+	for _, c := range bc {
+		unregisterClient(c)
+	}
+}
+
+// benchTree times peekm's hot paths on the markdown files under rootDir:
+// discovery, the sidebar tree, rendering every file and the SSE fanout to
+// sseClients connections
+func benchTree(rootDir string, runs, sseClients int) []benchResult {
+	var files []string
+	results := []benchResult{measure("collect", "discover the markdown files", runs, func() {
+		files = collectMarkdownFiles(rootDir)
+	})}
+
+	fileMutex.Lock()
+	browseDir, markdownFiles = rootDir, newFileSet(files)
+	fileMutex.Unlock()
+	treeDetail := fmt.Sprintf("%d files", len(files))
+	results = append(results,
+		measure("tree (word counts uncached)", treeDetail, runs, func() {
+			clearWordCountCache()
+			tree.RenderHTML(buildFileTree())
+		}),
+		measure("tree (word counts cached)", treeDetail, runs, func() {
+			tree.RenderHTML(buildFileTree())
+		}),
+	)
+
+	var sources [][]byte
+	size := 0
+	for _, file := range files {
+		if source, err := os.ReadFile(file); err == nil {
+			sources = append(sources, source)
+			size += len(source)
+		}
+	}
+	renderDetail := fmt.Sprintf("%d files, %s", len(sources), formatBytes(size))
+	shared := newMarkdownRenderer()
+	results = append(results,
+		measure("render (renderer per file)", renderDetail, runs, func() {
+			for _, source := range sources {
+				renderMarkdown(source)
+			}
+		}),
+		measure("render (shared renderer)", renderDetail, runs, func() {
+			for _, source := range sources {
+				render.ToHTML(shared, source)
+			}
+		}),
+	)
+
+	bench := connectBenchClients(sseClients)
+	defer bench.disconnect()
+	results = append(results, measure("sse fanout", fmt.Sprintf("%d events to %d clients", benchEventsPerRun, sseClients), runs, func() {
+		for range benchEventsPerRun {
+			notifyClientsWithMessage("reload")
+			bench.drain()
+		}
+	}))
+	return results
+}
+
+// printBenchResults writes results as an aligned table
+func printBenchResults(w io.Writer, results []benchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tMIN\tMEDIAN\tMAX\tRUN")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%s\n", r.Name, r.Min.Round(time.Microsecond), r.Median.Round(time.Microsecond), r.Max.Round(time.Microsecond), r.Detail)
+	}
+	tw.Flush()
+}
+
+// runBench reports how long peekm's hot paths take on a real tree, as a
+// baseline for performance work (hidden from the usage text)
+func runBench(args []string) {
+	benchFlags := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := benchFlags.Int("runs", 5, "Times to run each step")
+	sseClients := benchFlags.Int("clients", 100, "SSE clients the fanout step notifies")
+	asJSON := benchFlags.Bool("json", false, "Print the timings as JSON (durations in nanoseconds)")
+	benchFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: peekm bench [directory] [--runs N] [--clients N] [--json]")
+		fmt.Fprintln(os.Stderr, "\nTimes file discovery, the sidebar tree, rendering and the live-update fanout on a directory.")
+		benchFlags.PrintDefaults()
+	}
+	dirs := parseInterspersed(benchFlags, args)
+	if len(dirs) > 1 || *runs < 1 || *sseClients < 0 {
+		benchFlags.Usage()
+		os.Exit(1)
+	}
+	dir := "."
+	if len(dirs) == 1 {
+		dir = dirs[0]
+	}
+	if _, err := os.Stat(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	log.SetOutput(io.Discard) // Discovery logs its exclusions on every run
+	results := benchTree(listRootDir(dir), *runs, *sseClients)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	printBenchResults(os.Stdout, results)
+}
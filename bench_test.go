@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/razvandimescu/peekm/render"
+)
+
+// benchDocument is a page of typical documentation: headings, prose, a
+// list, a table and a code block
+const benchDocument = `# Section %d
+
+peekm renders **markdown** with [links](https://example.com), ` + "`code`" + ` and
+footnotes[^1], so this paragraph stands for the prose of a real document.
+
+- First item
+- Second item with a [[Wiki Link]]
+
+| Option | Default | Description |
+|--------|---------|-------------|
+| -port  | 6419    | Port        |
+
+` + "```go\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n```" + `
+
+[^1]: A footnote.
+`
+
+// writeBenchTree writes files markdown documents, ten to a directory, and
+// serves them as the browsed directory until the benchmark ends
+func writeBenchTree(b *testing.B, files int) []string {
+	b.Helper()
+	dir := b.TempDir()
+	paths := make([]string, files)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("dir%02d", i/10), fmt.Sprintf("doc%03d.md", i))
+		os.MkdirAll(filepath.Dir(paths[i]), 0755)
+		content := strings.Repeat(fmt.Sprintf(benchDocument, i), 5)
+		if err := os.WriteFile(paths[i], []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	prevDir, prevFiles := browseDir, markdownFiles
+	b.Cleanup(func() { browseDir, markdownFiles = prevDir, prevFiles })
+	browseDir, markdownFiles = dir, newFileSet(paths)
+	return paths
+}
+
+func BenchmarkCollectMarkdownFiles(b *testing.B) {
+	writeBenchTree(b, 500)
+	b.ResetTimer()
+	for range b.N {
+		collectMarkdownFiles(browseDir)
+	}
+}
+
+func BenchmarkGenerateTreeHTML(b *testing.B) {
+	writeBenchTree(b, 500)
+	r := httptest.NewRequest("GET", "/tree-html", nil)
+	b.Run("uncached-word-counts", func(b *testing.B) {
+		for range b.N {
+			clearWordCountCache()
+			generateTreeHTML(r)
+		}
+	})
+	b.Run("cached-word-counts", func(b *testing.B) {
+		generateTreeHTML(r)
+		b.ResetTimer()
+		for range b.N {
+			generateTreeHTML(r)
+		}
+	})
+}
+
+func BenchmarkRenderMarkdown(b *testing.B) {
+	source := []byte(strings.Repeat(fmt.Sprintf(benchDocument, 1), 20))
+	b.Run("renderer-per-call", func(b *testing.B) {
+		b.SetBytes(int64(len(source)))
+		for range b.N {
+			renderMarkdown(source)
+		}
+	})
+	b.Run("shared-renderer", func(b *testing.B) {
+		md := newMarkdownRenderer()
+		b.SetBytes(int64(len(source)))
+		b.ResetTimer()
+		for range b.N {
+			render.ToHTML(md, source)
+		}
+	})
+}
+
+func BenchmarkNotifyClients(b *testing.B) {
+	prevClients, prevEvents := clients, globalEventBuffer
+	b.Cleanup(func() { clients, globalEventBuffer = prevClients, prevEvents })
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("%d-clients", n), func(b *testing.B) {
+			clients, globalEventBuffer = make(map[uint64]*sseClient), newEventBuffer(50)
+			bench := connectBenchClients(n)
+			defer bench.disconnect()
+			b.ResetTimer()
+			for range b.N {
+				notifyClientsWithMessage("reload")
+				bench.drain()
+			}
+		})
+	}
+}
+
+func TestBenchTree(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.md"), []byte("# A\n\nSome text.\n"), 0644)
+	prevDir, prevFiles, prevClients := browseDir, markdownFiles, clients
+	t.Cleanup(func() { browseDir, markdownFiles, clients = prevDir, prevFiles, prevClients })
+	clients = make(map[uint64]*sseClient)
+
+	results := benchTree(dir, 3, 2)
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+		if r.Runs != 3 || r.Min > r.Median || r.Median > r.Max {
+			t.Errorf("%s: %+v", r.Name, r)
+		}
+	}
+	want := "collect, tree (word counts uncached), tree (word counts cached), render (renderer per file), render (shared renderer), sse fanout"
+	if got := strings.Join(names, ", "); got != want {
+		t.Errorf("steps = %s, want %s", got, want)
+	}
+	if len(clients) != 0 {
+		t.Errorf("%d bench clients left connected", len(clients))
+	}
+}
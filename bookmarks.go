@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/razvandimescu/peekm/i18n"
+	"github.com/razvandimescu/peekm/render"
+)
+
+const (
+	maxBookmarks        = 200
+	maxBookmarkLabelLen = 200
+)
+
+// bookmark is a heading (or the top of a file) kept for quick returns, as
+// stored in bookmarks.json
+type bookmark struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"`   // Absolute
+	Anchor  string    `json:"anchor"` // Heading ID ("" for the top of the file)
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+}
+
+// apiBookmark is one /api/bookmarks entry
+type apiBookmark struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"` // Relative to the browse directory
+	Anchor  string    `json:"anchor"`
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+}
+
+// apiBookmarksResponse is the GET /api/bookmarks response
+type apiBookmarksResponse struct {
+	Bookmarks []apiBookmark `json:"bookmarks"`
+}
+
+// apiBookmarkRequest adds (POST) or relabels (PUT) a bookmark
+type apiBookmarkRequest struct {
+	ID     string `json:"id"`     // PUT: bookmark to relabel
+	Path   string `json:"path"`   // POST: relative to the browse directory
+	Anchor string `json:"anchor"` // POST: heading ID, with or without its #
+	Label  string `json:"label"`  // Defaults to the heading's text (or the file name) on POST
+}
+
+// bookmarksChangedMessage tells browsers to refresh the sidebar's bookmarks
+type bookmarksChangedMessage struct {
+	Type string `json:"type"` // "bookmarks_changed"
+}
+
+var (
+	errTooManyBookmarks = errors.New("too many bookmarks")
+	errBookmarkNotFound = errors.New("bookmark not found")
+)
+
+// bookmarksMutex serializes updates of bookmarks.json within this process
+var bookmarksMutex sync.Mutex
+
+// bookmarksPath returns where bookmarks are kept: bookmarks.json in peekm's
+// config directory ("" if there is none)
+func bookmarksPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "peekm", "bookmarks.json")
+}
+
+// loadBookmarks reads every bookmark, oldest first
+func loadBookmarks() []bookmark {
+	path := bookmarksPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: Cannot read %s: %v", path, err)
+		}
+		return nil
+	}
+	var bookmarks []bookmark
+	if err := json.Unmarshal(data, &bookmarks); err != nil {
+		log.Printf("Warning: Invalid %s (ignored): %v", path, err)
+		return nil
+	}
+	return bookmarks
+}
+
+// saveBookmarks writes bookmarks.json
+func saveBookmarks(bookmarks []bookmark) error {
+	path := bookmarksPath()
+	if path == "" {
+		return errors.New("no config directory")
+	}
+	data, err := json.MarshalIndent(bookmarks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return atomicWriteFile(path, string(data)+"\n")
+}
+
+// updateBookmarks applies change to the stored bookmarks and saves the result
+func updateBookmarks(change func([]bookmark) ([]bookmark, error)) error {
+	bookmarksMutex.Lock()
+	defer bookmarksMutex.Unlock()
+	bookmarks, err := change(loadBookmarks())
+	if err != nil {
+		return err
+	}
+	return saveBookmarks(bookmarks)
+}
+
+// renameBookmarks moves the bookmarks on a renamed file to its new path
+func renameBookmarks(oldPath, newPath string) {
+	bookmarksMutex.Lock()
+	defer bookmarksMutex.Unlock()
+	bookmarks := loadBookmarks()
+	moved := false
+	for i := range bookmarks {
+		if bookmarks[i].Path == oldPath {
+			bookmarks[i].Path = newPath
+			moved = true
+		}
+	}
+	if !moved {
+		return
+	}
+	if err := saveBookmarks(bookmarks); err != nil {
+		log.Printf("Warning: Cannot move bookmarks of %s: %v", oldPath, err)
+	}
+}
+
+// servedBookmarks returns the bookmarks on files served now, oldest first
+func servedBookmarks() []apiBookmark {
+	bookmarksMutex.Lock()
+	bookmarks := loadBookmarks()
+	bookmarksMutex.Unlock()
+
+	served := []apiBookmark{}
+	for _, b := range bookmarks {
+		if isWhitelistedFile(b.Path) {
+			served = append(served, b.api())
+		}
+	}
+	return served
+}
+
+// api returns b as listed by /api/bookmarks
+func (b bookmark) api() apiBookmark {
+	return apiBookmark{
+		ID:      b.ID,
+		Path:    filepath.ToSlash(getRelativePath(b.Path)),
+		Anchor:  b.Anchor,
+		Label:   b.Label,
+		Created: b.Created,
+	}
+}
+
+// bookmarksHTML renders the sidebar's bookmarks section ("" without any)
+// in the UI language of messages
+func bookmarksHTML(messages *i18n.Catalog) string {
+	bookmarks := servedBookmarks()
+	if len(bookmarks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	title := template.HTMLEscapeString(messages.T("Bookmarks"))
+	fmt.Fprintf(&sb, `<div class="tree-bookmarks" role="group" aria-label="%[1]s"><div class="tree-bookmarks-title">🔖 %[1]s</div>`, title)
+	actions := fmt.Sprintf(`<button class="tree-bookmark-action" onclick="renameBookmark(this)" aria-label="%s" title="%s">✎</button>`+
+		`<button class="tree-bookmark-action" onclick="deleteBookmark(this)" aria-label="%s" title="%s">×</button></div>`,
+		template.HTMLEscapeString(messages.T("Rename bookmark")), template.HTMLEscapeString(messages.T("Rename")),
+		template.HTMLEscapeString(messages.T("Delete bookmark")), template.HTMLEscapeString(messages.T("Delete")))
+	for _, b := range bookmarks {
+		target := b.Path
+		if b.Anchor != "" {
+			target += "#" + b.Anchor
+		}
+		href := "/view/" + template.URLQueryEscaper(b.Path)
+		if b.Anchor != "" {
+			href += "#" + url.PathEscape(b.Anchor)
+		}
+		fmt.Fprintf(&sb, `<div class="tree-bookmark" data-id="%s"><a href="%s" title="%s">%s</a>`, template.HTMLEscapeString(b.ID),
+			template.HTMLEscapeString(href), template.HTMLEscapeString(target), template.HTMLEscapeString(b.Label))
+		sb.WriteString(actions)
+	}
+	sb.WriteString(`</div>`)
+	return sb.String()
+}
+
+// withBookmarks puts the bookmarks section above a rendered (non-empty) tree
+func withBookmarks(treeHTML string, messages *i18n.Catalog) string {
+	if treeHTML == "" {
+		return ""
+	}
+	return bookmarksHTML(messages) + treeHTML
+}
+
+// defaultBookmarkLabel is the text of the heading an anchor points at, or
+// the file name for the top of the file (or a heading not found)
+func defaultBookmarkLabel(absPath, anchor string) string {
+	if anchor != "" {
+		if content, err := os.ReadFile(absPath); err == nil {
+			for _, h := range render.Headings(newMarkdownRenderer(), content) {
+				if h.ID == anchor {
+					return h.Text
+				}
+			}
+		}
+	}
+	return filepath.Base(absPath)
+}
+
+// validateBookmarkLabel trims a label and checks its length
+func validateBookmarkLabel(label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if len(label) > maxBookmarkLabelLen {
+		return "", fmt.Errorf("label longer than %d bytes", maxBookmarkLabelLen)
+	}
+	return label, nil
+}
+
+// notifyBookmarksChanged tells browsers to refresh the sidebar's bookmarks
+func notifyBookmarksChanged() {
+	msgBytes, err := json.Marshal(bookmarksChangedMessage{Type: "bookmarks_changed"})
+	if err != nil {
+		log.Printf("Error marshaling bookmarks_changed message: %v", err)
+		return
+	}
+	notifyClientsWithMessage(string(msgBytes))
+}
+
+// handleAPIBookmarks lists (GET), adds (POST), relabels (PUT) or deletes
+// (DELETE ?id=) bookmarks on headings of served files
+func handleAPIBookmarks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, apiBookmarksResponse{Bookmarks: servedBookmarks()})
+	case http.MethodPost, http.MethodPut:
+		var req apiBookmarkRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		label, err := validateBookmarkLabel(req.Label)
+		if err != nil {
+			writeError(w, errCodeBadRequest, "Invalid bookmark: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Label = label
+		if r.Method == http.MethodPost {
+			addBookmark(w, req)
+		} else {
+			relabelBookmark(w, req)
+		}
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		err := updateBookmarks(func(bookmarks []bookmark) ([]bookmark, error) {
+			n := len(bookmarks)
+			bookmarks = slices.DeleteFunc(bookmarks, func(b bookmark) bool { return b.ID == id })
+			if len(bookmarks) == n {
+				return nil, errBookmarkNotFound
+			}
+			return bookmarks, nil
+		})
+		if err != nil {
+			writeBookmarkError(w, err)
+			return
+		}
+		notifyBookmarksChanged()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// addBookmark stores a new bookmark and responds with it
+func addBookmark(w http.ResponseWriter, req apiBookmarkRequest) {
+	absPath, ok := resolveWhitelistedPath(w, req.Path)
+	if !ok {
+		return
+	}
+	id, err := newRecordID()
+	if err != nil {
+		writeError(w, errCodeInternal, "Cannot create bookmark", http.StatusInternalServerError)
+		return
+	}
+	b := bookmark{
+		ID:      id,
+		Path:    absPath,
+		Anchor:  strings.TrimPrefix(req.Anchor, "#"),
+		Label:   req.Label,
+		Created: time.Now().UTC(),
+	}
+	if b.Label == "" {
+		b.Label = defaultBookmarkLabel(absPath, b.Anchor)
+	}
+	err = updateBookmarks(func(bookmarks []bookmark) ([]bookmark, error) {
+		if len(bookmarks) >= maxBookmarks {
+			return nil, errTooManyBookmarks
+		}
+		return append(bookmarks, b), nil
+	})
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	notifyBookmarksChanged()
+	writeJSON(w, http.StatusCreated, b.api())
+}
+
+// relabelBookmark replaces the label of the bookmark req.ID and responds
+// with the bookmark
+func relabelBookmark(w http.ResponseWriter, req apiBookmarkRequest) {
+	if req.Label == "" {
+		writeError(w, errCodeBadRequest, "Invalid bookmark: empty label", http.StatusBadRequest)
+		return
+	}
+	var updated bookmark
+	err := updateBookmarks(func(bookmarks []bookmark) ([]bookmark, error) {
+		i := slices.IndexFunc(bookmarks, func(b bookmark) bool { return b.ID == req.ID })
+		if i < 0 {
+			return nil, errBookmarkNotFound
+		}
+		bookmarks[i].Label = req.Label
+		updated = bookmarks[i]
+		return bookmarks, nil
+	})
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+	notifyBookmarksChanged()
+	writeJSON(w, http.StatusOK, updated.api())
+}
+
+// writeBookmarkError responds to a failed bookmark update
+func writeBookmarkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errBookmarkNotFound):
+		writeError(w, errCodeNotFound, "Bookmark not found", http.StatusNotFound)
+	case errors.Is(err, errTooManyBookmarks):
+		writeError(w, errCodeTooLarge, fmt.Sprintf("Too many bookmarks (at most %d)", maxBookmarks), http.StatusRequestEntityTooLarge)
+	default:
+		writeError(w, errCodeInternal, fmt.Sprintf("Failed to save bookmarks: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleAPIBookmarks(t *testing.T) {
+	serveTestFiles(t, "bookmarks", map[string]string{"docs/spec.md": "# Spec\n\n## API Error Codes\n\n404 means missing.\n"})
+
+	// Labels default to the heading's text, or the file name for the top
+	for _, body := range []string{
+		`{"path": "docs/spec.md", "anchor": "#api-error-codes"}`,
+		`{"path": "docs/spec.md", "anchor": "", "label": " Spec top "}`,
+		`{"path": "docs/spec.md"}`,
+	} {
+		rec := httptest.NewRecorder()
+		handleAPIBookmarks(rec, httptest.NewRequest(http.MethodPost, "/api/bookmarks", strings.NewReader(body)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("POST %s = %d %s", body, rec.Code, rec.Body.String())
+		}
+	}
+	rec := httptest.NewRecorder()
+	handleAPIBookmarks(rec, httptest.NewRequest(http.MethodGet, "/api/bookmarks", nil))
+	var resp apiBookmarksResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/bookmarks = %d %s", rec.Code, rec.Body.String())
+	}
+	got := resp.Bookmarks
+	if len(got) != 3 {
+		t.Fatalf("bookmarks = %+v, want 3", got)
+	}
+	if got[0].Path != "docs/spec.md" || got[0].Anchor != "api-error-codes" || got[0].Label != "API Error Codes" {
+		t.Errorf("heading bookmark = %+v", got[0])
+	}
+	if got[1].Label != "Spec top" || got[2].Label != "spec.md" {
+		t.Errorf("labels = %q, %q, want Spec top and spec.md", got[1].Label, got[2].Label)
+	}
+}
+
+func TestHandleAPIBookmarksEdit(t *testing.T) {
+	serveTestFiles(t, "bookmarks", map[string]string{"docs/spec.md": "# Spec\n"})
+	for range 2 {
+		handleAPIBookmarks(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/bookmarks", strings.NewReader(`{"path": "docs/spec.md"}`)))
+	}
+	got := loadBookmarks()
+	if len(got) != 2 {
+		t.Fatalf("bookmarks = %+v, want 2", got)
+	}
+
+	rec := httptest.NewRecorder()
+	handleAPIBookmarks(rec, httptest.NewRequest(http.MethodPut, "/api/bookmarks", strings.NewReader(`{"id": "`+got[0].ID+`", "label": "Errors"}`)))
+	if rec.Code != http.StatusOK || loadBookmarks()[0].Label != "Errors" {
+		t.Errorf("PUT = %d %s", rec.Code, rec.Body.String())
+	}
+
+	target := "/api/bookmarks?id=" + got[1].ID
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		handleAPIBookmarks(rec, httptest.NewRequest(http.MethodDelete, target, nil))
+		if rec.Code != want {
+			t.Fatalf("DELETE = %d %s, want %d", rec.Code, rec.Body.String(), want)
+		}
+	}
+	if got := loadBookmarks(); len(got) != 1 {
+		t.Errorf("bookmarks after DELETE = %+v, want 1", got)
+	}
+}
+
+func TestHandleAPIBookmarksInvalid(t *testing.T) {
+	serveTestFiles(t, "bookmarks", map[string]string{"docs/spec.md": "# Spec\n"})
+	tests := []struct {
+		method, body string
+		want         int
+	}{
+		{http.MethodPost, `{"path": "other.md", "anchor": "intro"}`, http.StatusForbidden},
+		{http.MethodPost, `{"path": "docs/spec.md", "label": "` + strings.Repeat("x", maxBookmarkLabelLen+1) + `"}`, http.StatusBadRequest},
+		{http.MethodPost, `{"path": `, http.StatusBadRequest},
+		{http.MethodPut, `{"id": "missing", "label": "Renamed"}`, http.StatusNotFound},
+		{http.MethodPut, `{"id": "missing", "label": " "}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handleAPIBookmarks(rec, httptest.NewRequest(tt.method, "/api/bookmarks", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %.60s: status = %d, want %d", tt.method, tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestBookmarksHTML(t *testing.T) {
+	serveTestFiles(t, "bookmarks", map[string]string{"docs/spec.md": "# Spec\n\n## API Error Codes\n"})
+	if got := withBookmarks("<div>tree</div>", nil); got != "<div>tree</div>" {
+		t.Errorf("tree without bookmarks = %q", got)
+	}
+	handleAPIBookmarks(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/bookmarks",
+		strings.NewReader(`{"path": "docs/spec.md", "anchor": "api-error-codes", "label": "Codes <b>"}`)))
+
+	html := withBookmarks("<div>tree</div>", nil)
+	for _, want := range []string{`class="tree-bookmarks"`, `href="/view/docs%2Fspec.md#api-error-codes"`, "Codes &lt;b&gt;", "<div>tree</div>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("tree HTML missing %q:\n%s", want, html)
+		}
+	}
+	if got := withBookmarks("", nil); got != "" {
+		t.Errorf("empty tree with bookmarks = %q, want none", got)
+	}
+
+	// Bookmarks on files not served (another browse directory) stay hidden
+	markdownFiles = newFileSet(nil)
+	if strings.Contains(withBookmarks("<div>tree</div>", nil), "tree-bookmarks") {
+		t.Error("bookmark on a file not served is listed")
+	}
+	rec := httptest.NewRecorder()
+	handleAPIBookmarks(rec, httptest.NewRequest(http.MethodGet, "/api/bookmarks", nil))
+	if strings.Contains(rec.Body.String(), "spec.md") {
+		t.Errorf("GET lists bookmarks on files not served: %s", rec.Body.String())
+	}
+}
+
+func TestRenameBookmarks(t *testing.T) {
+	dir := serveTestFiles(t, "bookmarks", map[string]string{"docs/spec.md": "# Spec\n\n## API Error Codes\n"})
+	path := filepath.Join(dir, "docs", "spec.md")
+	handleAPIBookmarks(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/bookmarks",
+		strings.NewReader(`{"path": "docs/spec.md", "anchor": "api-error-codes"}`)))
+
+	newPath := filepath.Join(dir, "docs", "api.md")
+	renameBookmarks(path, newPath)
+	bookmarks := loadBookmarks()
+	if len(bookmarks) != 1 || bookmarks[0].Path != newPath || bookmarks[0].Anchor != "api-error-codes" {
+		t.Errorf("bookmarks after rename = %+v", bookmarks)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/razvandimescu/peekm/safepath"
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// Bounds of the search for markdown below a directory listed by /api/dirs
+const (
+	maxDirsDepth   = 3    // Directory levels searched below each listed directory
+	maxDirsEntries = 2000 // Directory entries read per listed directory
+)
+
+// breadcrumb is one component of a path in the breadcrumb trail
+type breadcrumb struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`               // Absolute path
+	Navigate bool   `json:"navigate,omitempty"` // A directory /navigate accepts (under $HOME)
+}
+
+// breadcrumbTrail is the path of the current file and browseDir, split into
+// components for breadcrumb navigation
+type breadcrumbTrail struct {
+	Dir    []breadcrumb `json:"dir"`              // browseDir, from ~ (or the filesystem root) down
+	File   []breadcrumb `json:"file"`             // The file's directories below browseDir, then the file
+	Parent string       `json:"parent,omitempty"` // browseDir's parent, the "navigate up" target ("" at $HOME)
+}
+
+// dirEntry is a directory listed by /api/dirs
+type dirEntry struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Current bool   `json:"current,omitempty"` // The requested directory itself
+}
+
+// apiDirsResponse is the /api/dirs response: the directories next to and
+// below path that hold markdown files
+type apiDirsResponse struct {
+	Path     string     `json:"path"`
+	Parent   string     `json:"parent,omitempty"` // "" when /navigate would refuse it
+	Siblings []dirEntry `json:"siblings"`         // Directories in parent holding markdown, path included
+	Dirs     []dirEntry `json:"dirs"`             // Subdirectories of path holding markdown
+}
+
+// newBreadcrumbTrail splits browseDir and file (absolute; "" for no file)
+// into breadcrumbs
+func newBreadcrumbTrail(browseDir, file string) breadcrumbTrail {
+	trail := breadcrumbTrail{
+		Dir:    pathCrumbs(browseDir),
+		File:   []breadcrumb{},
+		Parent: parentDir(browseDir),
+	}
+	if file == "" {
+		return trail
+	}
+
+	rel, err := filepath.Rel(browseDir, file)
+	if err != nil || !filepath.IsLocal(rel) {
+		// Whitelisted files from elsewhere (AI plans) get their full path
+		trail.File = pathCrumbs(file)
+		return trail
+	}
+	dir := browseDir
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, name := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, name)
+		trail.File = append(trail.File, breadcrumb{Name: name, Path: dir, Navigate: navigableDir(dir)})
+	}
+	trail.File = append(trail.File, breadcrumb{Name: parts[len(parts)-1], Path: file})
+	return trail
+}
+
+// pathCrumbs splits an absolute path into breadcrumbs, starting at ~ for
+// paths under $HOME
+func pathCrumbs(path string) []breadcrumb {
+	start := filepath.VolumeName(path) + string(filepath.Separator)
+	name := start
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(homeDir, path); err == nil && (rel == "." || filepath.IsLocal(rel)) {
+			start, name = homeDir, "~"
+		}
+	}
+
+	crumbs := []breadcrumb{{Name: name, Path: start, Navigate: navigableDir(start)}}
+	rel, err := filepath.Rel(start, path)
+	if err != nil || rel == "." {
+		return crumbs
+	}
+	dir := start
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		crumbs = append(crumbs, breadcrumb{Name: part, Path: dir, Navigate: navigableDir(dir)})
+	}
+	return crumbs
+}
+
+// navigableDir reports whether /navigate accepts dir: a directory that
+// passes the $HOME check
+func navigableDir(dir string) bool {
+	validated, err := safepath.Resolve(dir)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(validated)
+	return err == nil && info.IsDir()
+}
+
+// parentDir returns the parent of dir when /navigate accepts it, else ""
+func parentDir(dir string) string {
+	parent := filepath.Dir(dir)
+	if parent == dir || !navigableDir(parent) {
+		return ""
+	}
+	return parent
+}
+
+// serveAPIDirs lists the directories around ?path= (default: the browsed
+// directory) that hold markdown, for breadcrumb navigation
+func serveAPIDirs(w http.ResponseWriter, r *http.Request) {
+	fileMutex.RLock()
+	currentBrowseDir := browseDir
+	fileMutex.RUnlock()
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = currentBrowseDir
+	}
+	validated, err := safepath.Resolve(path)
+	if err != nil {
+		writeError(w, pathErrorCode(err), "Invalid path", http.StatusForbidden)
+		return
+	}
+	if info, err := os.Stat(validated); err != nil || !info.IsDir() {
+		writeError(w, errCodeBadRequest, "Path must be a directory", http.StatusBadRequest)
+		return
+	}
+
+	// The browsed directory's patterns (already cached) apply everywhere
+	customPatterns := getIgnorePatterns(currentBrowseDir)
+	resp := apiDirsResponse{
+		Path:     validated,
+		Parent:   parentDir(validated),
+		Siblings: []dirEntry{},
+		Dirs:     markdownDirs(validated, "", customPatterns),
+	}
+	if resp.Parent != "" {
+		resp.Siblings = markdownDirs(resp.Parent, validated, customPatterns)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// markdownDirs lists the subdirectories of dir that peekm would not exclude
+// and that hold markdown files, marking current
+func markdownDirs(dir, current string, customPatterns []string) []dirEntry {
+	dirs := []dirEntry{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return dirs
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || tree.IsExcludedDir(entry.Name(), customPatterns) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if path == current || hasMarkdown(path, maxDirsDepth, customPatterns) {
+			dirs = append(dirs, dirEntry{Name: entry.Name(), Path: path, Current: path == current})
+		}
+	}
+	return dirs
+}
+
+// hasMarkdown reports whether a markdown file is at most depth levels below
+// dir
+func hasMarkdown(dir string, depth int, customPatterns []string) bool {
+	count, _ := countMarkdown(dir, depth, 1, customPatterns)
+	return count > 0
+}
+
+// countMarkdown counts the markdown files at most depth levels below dir,
+// stopping at limit files or after maxDirsEntries directory entries
+// (symlinks are not followed). complete is false when it stopped early or
+// left deeper directories out.
+func countMarkdown(dir string, depth, limit int, customPatterns []string) (count int, complete bool) {
+	budget := maxDirsEntries
+	complete = true
+	var search func(dir string, depth int) bool // false once a bound is hit
+	search = func(dir string, depth int) bool {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return true
+		}
+		var subdirs []string
+		for _, entry := range entries {
+			if budget--; budget < 0 {
+				return false
+			}
+			name := entry.Name()
+			if entry.Type().IsRegular() && isMarkdownPath(filepath.Join(dir, name)) && !tree.IsExcludedFile(name, customPatterns) {
+				if count++; count >= limit {
+					return false
+				}
+			}
+			if entry.IsDir() && !tree.IsExcludedDir(name, customPatterns) {
+				subdirs = append(subdirs, filepath.Join(dir, name))
+			}
+		}
+		if depth == 0 {
+			complete = complete && len(subdirs) == 0
+			return true
+		}
+		for _, subdir := range subdirs {
+			if !search(subdir, depth-1) {
+				return false
+			}
+		}
+		return true
+	}
+	if !search(dir, depth) {
+		complete = false
+	}
+	return count, complete
+}
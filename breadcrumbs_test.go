@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newBreadcrumbsTestDir creates a directory tree under $HOME:
+// docs (browsed) and notes hold markdown, the others do not count
+func newBreadcrumbsTestDir(t *testing.T) string {
+	t.Helper()
+	return serveTestFiles(t, "breadcrumbs", map[string]string{
+		"docs/README.md":             "",
+		"docs/guide/setup.md":        "",
+		"docs/assets/logo.png":       "",
+		"notes/2026/10/today.md":     "",
+		"empty/notes.txt":            "",
+		"node_modules/pkg/README.md": "",
+		"deep/a/b/c/d/too-deep.md":   "",
+	})
+}
+
+func TestNewBreadcrumbTrail(t *testing.T) {
+	root := newBreadcrumbsTestDir(t)
+	homeDir, _ := os.UserHomeDir()
+	docs := filepath.Join(root, "docs")
+
+	trail := newBreadcrumbTrail(docs, filepath.Join(docs, "guide", "setup.md"))
+	wantDir := []breadcrumb{
+		{Name: "~", Path: homeDir, Navigate: true},
+		{Name: filepath.Base(root), Path: root, Navigate: true},
+		{Name: "docs", Path: docs, Navigate: true},
+	}
+	if !reflect.DeepEqual(trail.Dir, wantDir) {
+		t.Errorf("Dir = %+v, want %+v", trail.Dir, wantDir)
+	}
+	wantFile := []breadcrumb{
+		{Name: "guide", Path: filepath.Join(docs, "guide"), Navigate: true},
+		{Name: "setup.md", Path: filepath.Join(docs, "guide", "setup.md")},
+	}
+	if !reflect.DeepEqual(trail.File, wantFile) {
+		t.Errorf("File = %+v, want %+v", trail.File, wantFile)
+	}
+	if trail.Parent != root {
+		t.Errorf("Parent = %q, want %q", trail.Parent, root)
+	}
+
+	// $HOME itself cannot be left, and paths outside it cannot be browsed
+	if home := newBreadcrumbTrail(homeDir, ""); home.Parent != "" || len(home.Dir) != 1 || len(home.File) != 0 {
+		t.Errorf("trail of $HOME = %+v, want just ~ without a parent", home)
+	}
+	outside := pathCrumbs(filepath.Join(string(filepath.Separator), "nonexistent-peekm", "x.md"))
+	if len(outside) != 3 || outside[0].Name != string(filepath.Separator) || outside[1].Navigate {
+		t.Errorf("pathCrumbs outside $HOME = %+v", outside)
+	}
+}
+
+func TestServeAPIDirs(t *testing.T) {
+	root := newBreadcrumbsTestDir(t)
+	docs := filepath.Join(root, "docs")
+
+	browseDir = docs
+	defer func() {
+		globalIgnoreCache.mu.Lock()
+		globalIgnoreCache.rootDir = ""
+		globalIgnoreCache.mu.Unlock()
+	}()
+
+	get := func(path string) (int, apiDirsResponse) {
+		rec := httptest.NewRecorder()
+		serveAPIDirs(rec, httptest.NewRequest("GET", "/api/dirs?path="+url.QueryEscape(path), nil))
+		var resp apiDirsResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	code, resp := get("")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	want := apiDirsResponse{
+		Path:   docs,
+		Parent: root,
+		Siblings: []dirEntry{
+			{Name: "docs", Path: docs, Current: true},
+			{Name: "notes", Path: filepath.Join(root, "notes")},
+		},
+		Dirs: []dirEntry{{Name: "guide", Path: filepath.Join(docs, "guide")}},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("/api/dirs = %+v, want %+v", resp, want)
+	}
+
+	if code, resp := get(filepath.Join(root, "notes", "2026")); code != http.StatusOK || len(resp.Dirs) != 1 || resp.Dirs[0].Name != "10" {
+		t.Errorf("/api/dirs for notes/2026 = %d %+v, want the 10 subdirectory", code, resp)
+	}
+	if code, _ := get(filepath.Join(docs, "README.md")); code != http.StatusBadRequest {
+		t.Errorf("file path: status = %d, want 400", code)
+	}
+	if code, _ := get(filepath.Join(root, "..", "..", "..", "etc")); code != http.StatusForbidden {
+		t.Errorf("path outside $HOME: status = %d, want 403", code)
+	}
+}
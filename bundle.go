@@ -0,0 +1,152 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/razvandimescu/peekm/render"
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// formatMarkdownBundle is the /download format that zips the raw markdown
+// with the files it references
+const formatMarkdownBundle = "md-bundle"
+
+// maxBundleAssetsSize bounds the referenced files added to one bundle
+const maxBundleAssetsSize = 100 << 20
+
+// bundleFile is one file in a markdown bundle
+type bundleFile struct {
+	name string // Path in the zip, slash-separated
+	path string // File to read (symlinks resolved)
+}
+
+// bundleAssets returns the existing non-markdown files that the markdown at
+// filePath references by relative path (images, attachments, media), limited
+// to files inside root, as absolute paths before and after resolving symlinks
+func bundleAssets(filePath string, content []byte, root string) (refs, resolved []string) {
+	var total int64
+	seen := make(map[string]bool)
+	for _, dest := range render.Destinations(newMarkdownRenderer(), content) {
+		relRef, ok := relativeReference(dest)
+		if !ok {
+			continue
+		}
+		ref := filepath.Join(filepath.Dir(filePath), filepath.FromSlash(relRef))
+		if seen[ref] || isMarkdownPath(ref) {
+			continue
+		}
+		seen[ref] = true
+
+		validated, err := safepath.Resolve(ref)
+		if err != nil || !isWithinDir(root, validated) {
+			continue
+		}
+		info, err := os.Stat(validated)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if total += info.Size(); total > maxBundleAssetsSize {
+			log.Printf("Warning: Bundle of %s left out %s and later files (over %d MB)", filePath, relRef, maxBundleAssetsSize>>20)
+			break
+		}
+		refs, resolved = append(refs, ref), append(resolved, validated)
+	}
+	return refs, resolved
+}
+
+// relativeReference returns the file path of a link or image destination
+// that points at a local file relative to the document: no scheme, host or
+// leading slash, with the query and fragment dropped and escapes decoded
+func relativeReference(dest string) (string, bool) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// isWithinDir reports whether path is dir or lies below it
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// markdownBundleFiles lists the markdown file at filePath and its assets
+// under their paths relative to the deepest directory containing them all,
+// so the links between them keep working once unzipped
+func markdownBundleFiles(filePath string, refs, resolved []string) []bundleFile {
+	base := filepath.Dir(filePath)
+	for _, ref := range refs {
+		for !isWithinDir(base, ref) {
+			base = filepath.Dir(base)
+		}
+	}
+
+	name := func(path string) string {
+		rel, _ := filepath.Rel(base, path)
+		return filepath.ToSlash(rel)
+	}
+	files := []bundleFile{{name: name(filePath), path: filePath}}
+	for i, ref := range refs {
+		files = append(files, bundleFile{name: name(ref), path: resolved[i]})
+	}
+	return files
+}
+
+// writeMarkdownBundle sends the markdown at filePath, unrendered, zipped with
+// every file it references by relative path inside the browsed directory (or
+// inside its own directory, for files outside it)
+func writeMarkdownBundle(w http.ResponseWriter, filePath string, content []byte) {
+	fileMutex.RLock()
+	root := browseDir
+	fileMutex.RUnlock()
+	if !isWithinDir(root, filePath) {
+		root = filepath.Dir(filePath)
+	}
+
+	refs, resolved := bundleAssets(filePath, content, root)
+	files := markdownBundleFiles(filePath, refs, resolved)
+
+	filename := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)) + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		if err := addBundleFile(zw, f); err != nil {
+			log.Printf("Failed to write bundle of %s: %v", filePath, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Failed to write bundle of %s: %v", filePath, err)
+	}
+}
+
+// addBundleFile copies one file into the zip, keeping its modification time
+func addBundleFile(zw *zip.Writer, f bundleFile) error {
+	src, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: info.ModTime()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownBundle(t *testing.T) {
+	files := map[string]string{
+		"docs/guide/a.md": "# A\n\n![Logo](../img/logo.png) [spec](files/my%20spec.pdf#page=2) [other](other.md)\n\n" +
+			"[web](https://example.com/x.png) ![missing](missing.png) ![outside](../../outside.png) <img src=\"files/diagram.svg\">\n",
+		"docs/guide/files/my spec.pdf":      "%PDF",
+		"docs/guide/files/diagram.svg":      "<svg/>",
+		"docs/guide/files/unreferenced.png": "png",
+		"docs/guide/other.md":               "# Other\n",
+		"docs/img/logo.png":                 "png",
+		"outside.png":                       "png",
+	}
+	root := serveTestFiles(t, "bundle", files)
+	doc := filepath.Join(root, "docs", "guide", "a.md")
+	browseDir, markdownFiles = filepath.Join(root, "docs"), newFileSet([]string{doc})
+
+	download := func(target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleDownload(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := download("/download?format=md-bundle", `{"path": "guide/a.md"}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("status %d, Content-Type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="a.zip"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"guide/a.md", "img/logo.png", "guide/files/my spec.pdf", "guide/files/diagram.svg"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("bundle files = %q, want %q", names, want)
+	}
+
+	if rec := download("/download", `{"path": "guide/a.md", "format": "md-bundle"}`); rec.Header().Get("Content-Type") != "application/zip" {
+		t.Errorf("format in the body: Content-Type %q", rec.Header().Get("Content-Type"))
+	}
+	if rec := download("/download?format=pdf", `{"path": "guide/a.md"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d, want 400", rec.Code)
+	}
+}
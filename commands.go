@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/razvandimescu/peekm/include"
+	"github.com/razvandimescu/peekm/lint"
+	"github.com/razvandimescu/peekm/render"
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// standaloneTmpl wraps rendered markdown in a self-contained page with the embedded CSS
+var standaloneTmpl = template.Must(template.New("standalone").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>{{.CSS}}</style>
+<style>{{.Theme}}</style>
+<style>.markdown-body { box-sizing: border-box; max-width: 980px; margin: 0 auto; padding: 45px; }</style>
+</head>
+<body>
+<article class="markdown-body">
+{{.Content}}
+</article>
+</body>
+</html>
+`))
+
+// parseInterspersed parses flags that may appear before or after positional arguments
+// (e.g. "peekm render file.md --standalone") and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// runRender writes the rendered HTML for a markdown file ("-" for stdin) to stdout
+func runRender(args []string) {
+	renderFlags := flag.NewFlagSet("render", flag.ExitOnError)
+	standalone := renderFlags.Bool("standalone", false, "Wrap the output in a full HTML page with the embedded CSS")
+	exportTemplate := renderFlags.String("template", "", "Export template for --standalone (<name>.html in .peekm/export or the config dir's peekm/export; default.html when unset)")
+	withDiagrams := renderFlags.Bool("diagrams", false, "Render mermaid, PlantUML and dot blocks to SVG (mmdc, plantuml, dot or --kroki-url)")
+	renderKroki := renderFlags.String("kroki-url", "", "Kroki server for diagrams without a local tool (default: $PEEKM_KROKI_URL)")
+	renderFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: peekm render <file.md|-> [--standalone [--template name]] [--diagrams]")
+		fmt.Fprintln(os.Stderr, "\nRenders markdown to HTML on stdout without starting a server.")
+		renderFlags.PrintDefaults()
+	}
+	files := parseInterspersed(renderFlags, args)
+	if len(files) != 1 {
+		renderFlags.Usage()
+		os.Exit(1)
+	}
+
+	if *renderKroki == "" {
+		*renderKroki = os.Getenv("PEEKM_KROKI_URL")
+	}
+	opts := render.Options{Diagrams: newDiagramRenderer(*withDiagrams, *renderKroki).Render}
+	if *exportTemplate != "" {
+		*standalone = true
+	}
+	if err := renderToWriter(os.Stdout, files[0], *standalone, *exportTemplate, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// renderToWriter renders a markdown file ("-" for stdin) as an HTML fragment
+// or a standalone page, through the export template called exportTemplate
+// (see loadExportTemplate)
+func renderToWriter(w io.Writer, path string, standalone bool, exportTemplate string, opts render.Options) error {
+	var source []byte
+	var err error
+	if path == "-" {
+		source, err = io.ReadAll(os.Stdin)
+	} else {
+		source, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	source = include.Expand(path, source, os.ReadFile)
+	rendered, err := render.ToHTML(render.New(opts), source)
+	if err != nil {
+		return fmt.Errorf("render markdown: %w", err)
+	}
+
+	if !standalone {
+		_, err = io.WriteString(w, rendered)
+		return err
+	}
+
+	page := newExportPage(path, path, source, rendered)
+	if page.Title == "" {
+		page.Title = "peekm"
+	}
+	out, err := executeExportPage(exportTemplate, standaloneTmpl, page)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// listedFile is one markdown file reported by "peekm list"
+type listedFile struct {
+	Path    string    `json:"path"` // Relative to the listed directory
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// exclusionInfo describes the directory exclusions applied during discovery
+type exclusionInfo struct {
+	Hidden     string   `json:"hidden"`                // Hidden directory rule
+	Hardcoded  []string `json:"hardcoded"`             // Always-skipped directory names
+	Custom     []string `json:"custom"`                // Patterns from .peekmignore
+	IgnoreFile string   `json:"ignore_file,omitempty"` // .peekmignore path, if present
+	Global     []string `json:"global"`                // Patterns from the global ignore file
+	GlobalFile string   `json:"global_file,omitempty"` // Global ignore file path, if present
+}
+
+// listResult is the "peekm list --json" output
+type listResult struct {
+	Root       string        `json:"root"`
+	Files      []listedFile  `json:"files"`
+	Exclusions exclusionInfo `json:"exclusions"`
+}
+
+// listRootDir makes dir absolute and falls back to the parent directory for files
+func listRootDir(dir string) string {
+	if absPath, err := filepath.Abs(dir); err == nil {
+		dir = absPath
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// listExclusions reports the hardcoded, .peekmignore and global exclusions for rootDir
+func listExclusions(rootDir string) exclusionInfo {
+	info := exclusionInfo{
+		Hidden:    ".* (hidden directories, except .claude)",
+		Hardcoded: tree.HardcodedExclusions,
+		Custom:    tree.ParseIgnoreFile(rootDir),
+		Global:    globalIgnorePatterns(),
+	}
+	if info.Custom == nil {
+		info.Custom = []string{}
+	}
+	if len(info.Custom) > 0 {
+		info.IgnoreFile = filepath.Join(rootDir, tree.IgnoreFileName)
+	}
+	if info.Global == nil {
+		info.Global = []string{}
+	}
+	if len(info.Global) > 0 {
+		info.GlobalFile = globalIgnorePath()
+	}
+	return info
+}
+
+// printExclusions writes the human-readable exclusion list (also used by --show-ignored)
+func printExclusions(w io.Writer, rootDir string, info exclusionInfo) {
+	fmt.Fprintln(w, "Hardcoded exclusions:")
+	fmt.Fprintf(w, "  %s\n", info.Hidden)
+	for _, dir := range info.Hardcoded {
+		fmt.Fprintf(w, "  %s\n", dir)
+	}
+
+	if len(info.Custom) > 0 {
+		fmt.Fprintf(w, "\nCustom exclusions (.peekmignore in %s):\n", rootDir)
+		for _, p := range info.Custom {
+			fmt.Fprintf(w, "  %s\n", p)
+		}
+	} else {
+		fmt.Fprintf(w, "\nNo .peekmignore file found in %s\n", rootDir)
+	}
+
+	if len(info.Global) > 0 {
+		fmt.Fprintf(w, "\nGlobal exclusions (%s):\n", info.GlobalFile)
+		for _, p := range info.Global {
+			fmt.Fprintf(w, "  %s\n", p)
+		}
+	}
+}
+
+// listMarkdownFiles runs peekm's discovery rules on rootDir
+func listMarkdownFiles(rootDir string) listResult {
+	result := listResult{
+		Root:       rootDir,
+		Files:      []listedFile{},
+		Exclusions: listExclusions(rootDir),
+	}
+	for _, path := range collectMarkdownFiles(rootDir) {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		relPath, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			relPath = path
+		}
+		result.Files = append(result.Files, listedFile{
+			Path:    filepath.ToSlash(relPath),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	return result
+}
+
+// runList prints the markdown files peekm would show for a directory
+func runList(args []string) {
+	listFlags := flag.NewFlagSet("list", flag.ExitOnError)
+	asJSON := listFlags.Bool("json", false, "Print files and exclusions as JSON")
+	showExcluded := listFlags.Bool("ignored", false, "Also print the directory exclusions (always included in --json)")
+	listFlags.BoolVar(respectGit, "respect-gitignore", false, "Also skip what .gitignore files exclude, as the server does with the same flag")
+	listFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: peekm list [directory] [--json] [--ignored] [--respect-gitignore]")
+		fmt.Fprintln(os.Stderr, "\nLists markdown files using peekm's discovery and exclusion rules.")
+		listFlags.PrintDefaults()
+	}
+	dirs := parseInterspersed(listFlags, args)
+	if len(dirs) > 1 {
+		listFlags.Usage()
+		os.Exit(1)
+	}
+
+	dir := "."
+	if len(dirs) == 1 {
+		dir = dirs[0]
+	}
+	if _, err := os.Stat(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	result := listMarkdownFiles(listRootDir(dir))
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, f := range result.Files {
+		fmt.Printf("%s\t%d\t%s\n", f.Path, f.Size, f.ModTime.Format(time.RFC3339))
+	}
+	if *showExcluded {
+		fmt.Println()
+		printExclusions(os.Stdout, result.Root, result.Exclusions)
+	}
+}
+
+// lintedFile is one file's diagnostics in "peekm lint --json" output
+type lintedFile struct {
+	Path        string            `json:"path"`
+	Diagnostics []lint.Diagnostic `json:"diagnostics"`
+}
+
+// lintFiles lints markdown files and directories (expanded with peekm's discovery rules)
+func lintFiles(paths []string, opts lint.Options) ([]lintedFile, error) {
+	var results []lintedFile
+	for _, path := range paths {
+		files, err := lintTargets(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			source, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, lintedFile{Path: file, Diagnostics: lint.Check(source, opts)})
+		}
+	}
+	return results, nil
+}
+
+// lintTargets expands a lint argument to files, keeping paths relative to it for directories
+func lintTargets(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	rootDir := listRootDir(path)
+	var files []string
+	for _, file := range collectMarkdownFiles(rootDir) {
+		if relPath, err := filepath.Rel(rootDir, file); err == nil {
+			file = filepath.Join(path, relPath)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// printLintResults writes diagnostics as "path:line:column: rule message" lines
+// and returns how many there were
+func printLintResults(w io.Writer, results []lintedFile) int {
+	count := 0
+	for _, result := range results {
+		for _, d := range result.Diagnostics {
+			fmt.Fprintf(w, "%s:%d:%d: %s %s\n", result.Path, d.Line, d.Column, d.Rule, d.Message)
+			count++
+		}
+	}
+	return count
+}
+
+// runLint checks markdown files and exits with 1 if any rule is violated (2 on errors)
+func runLint(args []string) {
+	lintFlags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := lintFlags.Bool("json", false, "Print diagnostics as JSON")
+	maxLineLength := lintFlags.Int("max-line-length", lint.DefaultMaxLineLength, "Longest allowed line (negative disables the check)")
+	lintFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: peekm lint [file.md|directory...] [--json] [--max-line-length N]")
+		fmt.Fprintln(os.Stderr, "\nChecks heading increments, duplicate headings, long lines and bare URLs.")
+		fmt.Fprintln(os.Stderr, "Exits with 1 when problems are found and 2 on errors.")
+		lintFlags.PrintDefaults()
+	}
+	paths := parseInterspersed(lintFlags, args)
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	results, err := lintFiles(paths, lint.Options{MaxLineLength: *maxLineLength})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	count := 0
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if results == nil {
+			results = []lintedFile{}
+		}
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		for _, result := range results {
+			count += len(result.Diagnostics)
+		}
+	} else {
+		count = printLintResults(os.Stdout, results)
+	}
+	if count > 0 {
+		os.Exit(1)
+	}
+}
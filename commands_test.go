@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/razvandimescu/peekm/lint"
+	"github.com/razvandimescu/peekm/render"
+)
+
+// TestRenderToWriter tests fragment and standalone output of the render subcommand
+func TestRenderToWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(path, []byte("# Notes\n\n**bold**"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var fragment bytes.Buffer
+	if err := renderToWriter(&fragment, path, false, "", render.Options{}); err != nil {
+		t.Fatalf("renderToWriter() error: %v", err)
+	}
+	if strings.Contains(fragment.String(), "<html") || !strings.Contains(fragment.String(), "<strong>bold</strong>") {
+		t.Errorf("unexpected fragment: %s", fragment.String())
+	}
+
+	var page bytes.Buffer
+	if err := renderToWriter(&page, path, true, "", render.Options{}); err != nil {
+		t.Fatalf("renderToWriter() error: %v", err)
+	}
+	for _, want := range []string{"<!DOCTYPE html>", "<title>notes</title>", `<article class="markdown-body">`, `<h1 id="notes">Notes</h1>`} {
+		if !strings.Contains(page.String(), want) {
+			t.Errorf("standalone output missing %q", want)
+		}
+	}
+
+	if err := renderToWriter(&page, filepath.Join(t.TempDir(), "missing.md"), false, "", render.Options{}); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+// TestParseInterspersed tests that flags may follow positional arguments
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	standalone := fs.Bool("standalone", false, "")
+
+	got := parseInterspersed(fs, []string{"file.md", "--standalone"})
+	if !reflect.DeepEqual(got, []string{"file.md"}) || !*standalone {
+		t.Errorf("got %v, standalone=%v", got, *standalone)
+	}
+}
+
+// TestListMarkdownFiles tests that list applies the same discovery rules as the browser
+func TestListMarkdownFiles(t *testing.T) {
+	testDir := serveTestFiles(t, "list", map[string]string{
+		"a.md":              "# x",
+		"sub/b.md":          "# x",
+		"node_modules/c.md": "# x",
+		"skipme/d.md":       "# x",
+		".peekmignore":      "skipme\n",
+	})
+
+	result := listMarkdownFiles(testDir)
+
+	var got []string
+	for _, f := range result.Files {
+		got = append(got, f.Path)
+	}
+	if !reflect.DeepEqual(got, []string{"a.md", "sub/b.md"}) {
+		t.Errorf("files = %v, want [a.md sub/b.md]", got)
+	}
+	if !reflect.DeepEqual(result.Exclusions.Custom, []string{"skipme"}) {
+		t.Errorf("custom exclusions = %v, want [skipme]", result.Exclusions.Custom)
+	}
+}
+
+// TestGlobalIgnoreFile tests that the user's ignore file applies on top of .peekmignore
+func TestGlobalIgnoreFile(t *testing.T) {
+	testDir := serveTestFiles(t, "global-ignore", map[string]string{
+		"config/peekm/ignore":    "# personal junk\nscratch\ntmp-*\nskipme\n",
+		"project/a.md":           "# x",
+		"project/scratch/b.md":   "# x",
+		"project/tmp-notes/c.md": "# x",
+		"project/skipme/d.md":    "# x",
+		"project/kept/e.md":      "# x",
+		"project/.peekmignore":   "skipme\n",
+	})
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(testDir, "config"))
+	rootDir := filepath.Join(testDir, "project")
+
+	globalIgnoreCache.mu.Lock()
+	globalIgnoreCache.rootDir = ""
+	globalIgnoreCache.mu.Unlock()
+	defer func() {
+		globalIgnoreCache.mu.Lock()
+		globalIgnoreCache.rootDir = ""
+		globalIgnoreCache.mu.Unlock()
+	}()
+
+	result := listMarkdownFiles(rootDir)
+
+	var got []string
+	for _, f := range result.Files {
+		got = append(got, f.Path)
+	}
+	if !reflect.DeepEqual(got, []string{"a.md", "kept/e.md"}) {
+		t.Errorf("files = %v, want [a.md kept/e.md]", got)
+	}
+	if !reflect.DeepEqual(result.Exclusions.Global, []string{"scratch", "tmp-*", "skipme"}) {
+		t.Errorf("global exclusions = %v", result.Exclusions.Global)
+	}
+	if !reflect.DeepEqual(getIgnorePatterns(rootDir), []string{"scratch", "tmp-*", "skipme"}) {
+		t.Errorf("merged patterns = %v", getIgnorePatterns(rootDir))
+	}
+}
+
+// TestLintFiles tests that lint expands directories and reports paths relative to the argument
+func TestLintFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"clean.md":             "# Clean\n",
+		"docs/bad.md":          "# Bad\n\n### Skipped\n",
+		"node_modules/skip.md": "# Skip\n\n### Skipped\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := lintFiles([]string{dir}, lint.Options{})
+	if err != nil {
+		t.Fatalf("lintFiles() error: %v", err)
+	}
+	var out bytes.Buffer
+	if count := printLintResults(&out, results); count != 1 || len(results) != 2 {
+		t.Errorf("got %d diagnostics in %d files, want 1 in 2", count, len(results))
+	}
+	want := filepath.Join(dir, "docs", "bad.md") + ":3:1: " + lint.RuleHeadingIncrement
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("output = %q, want prefix %q", out.String(), want)
+	}
+
+	if _, err := lintFiles([]string{filepath.Join(dir, "missing.md")}, lint.Options{}); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
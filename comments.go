@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/razvandimescu/peekm/render"
+)
+
+// Limits that keep comment files small
+const (
+	maxCommentsPerFile = 500
+	maxCommentLen      = 10000 // Characters
+	maxCommentBodySize = 64 << 10
+)
+
+// comment is a reviewer's note on a markdown file, anchored to a heading or
+// a source line, as kept in the file's comments JSON
+type comment struct {
+	ID      string     `json:"id"`
+	Heading string     `json:"heading,omitempty"` // Heading ID the comment is about
+	Line    int        `json:"line,omitempty"`    // 1-based source line it is about (without a heading)
+	Text    string     `json:"text"`
+	Author  string     `json:"author,omitempty"`
+	Created time.Time  `json:"created"`
+	Updated *time.Time `json:"updated,omitempty"`
+}
+
+// commentFile is what a file's comments are stored as
+type commentFile struct {
+	Path     string    `json:"path"` // Absolute path of the commented file
+	Comments []comment `json:"comments"`
+}
+
+// apiComment is a comment in /api/comments responses
+type apiComment struct {
+	comment
+	Section string `json:"section,omitempty"` // Heading ID of the section a line comment falls in, for placing it
+}
+
+// apiCommentsResponse is returned by GET /api/comments
+type apiCommentsResponse struct {
+	Path     string       `json:"path"` // Relative to the browse directory
+	Comments []apiComment `json:"comments"`
+}
+
+// apiCommentRequest adds (POST) or edits (PUT, by ID) a comment
+type apiCommentRequest struct {
+	Path    string `json:"path"` // Relative to the browse directory
+	ID      string `json:"id"`   // PUT only
+	Heading string `json:"heading"`
+	Line    int    `json:"line"`
+	Text    string `json:"text"`
+	Author  string `json:"author"`
+}
+
+// commentsChangedMessage tells browsers to reload a file's comments
+type commentsChangedMessage struct {
+	Type string `json:"type"` // "comments_changed"
+	Path string `json:"path"` // Relative to the browse directory
+}
+
+// commentsMutex serializes comment file updates within this process
+var commentsMutex sync.Mutex
+
+// commentsPath returns where the comments on the file at absPath are kept:
+// comments/<hash of the path>.json in peekm's config directory ("" if there is none)
+func commentsPath(absPath string) string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(configDir, "peekm", "comments", hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadComments reads the comments on the file at absPath, oldest first
+func loadComments(absPath string) []comment {
+	path := commentsPath(absPath)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: Cannot read %s: %v", path, err)
+		}
+		return nil
+	}
+	var stored commentFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		log.Printf("Warning: Invalid %s (ignored): %v", path, err)
+		return nil
+	}
+	if stored.Path != absPath {
+		return nil // Hash collision
+	}
+	return stored.Comments
+}
+
+// saveComments replaces the comments on the file at absPath, removing the
+// comments file when none are left
+func saveComments(absPath string, comments []comment) error {
+	path := commentsPath(absPath)
+	if path == "" {
+		return errors.New("no config directory")
+	}
+	if len(comments) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(commentFile{Path: absPath, Comments: comments}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return atomicWriteFile(path, string(data)+"\n")
+}
+
+// updateComments applies change to the comments on the file at absPath and
+// saves them; change returns an error to leave them as they were
+func updateComments(absPath string, change func([]comment) ([]comment, error)) error {
+	commentsMutex.Lock()
+	defer commentsMutex.Unlock()
+
+	comments, err := change(loadComments(absPath))
+	if err != nil {
+		return err
+	}
+	return saveComments(absPath, comments)
+}
+
+// renameComments moves the comments on oldPath to newPath
+func renameComments(oldPath, newPath string) {
+	commentsMutex.Lock()
+	defer commentsMutex.Unlock()
+
+	comments := loadComments(oldPath)
+	if len(comments) == 0 {
+		return
+	}
+	err := saveComments(newPath, append(loadComments(newPath), comments...))
+	if err == nil {
+		err = saveComments(oldPath, nil)
+	}
+	if err != nil {
+		log.Printf("Warning: Cannot move comments of %s: %v", oldPath, err)
+	}
+}
+
+// newRecordID returns a random ID for a new comment or bookmark
+func newRecordID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// sectionAt returns the ID of the last of headings starting at or before a
+// source line ("" above the first)
+func sectionAt(headings []render.Heading, line int) string {
+	section := ""
+	for _, h := range headings {
+		if h.Line > line {
+			break
+		}
+		section = h.ID
+	}
+	return section
+}
+
+// commentSections returns the heading ID of the section each line comment
+// falls in, from the headings of the file's source
+func commentSections(headings []render.Heading, comments []comment) []apiComment {
+	result := make([]apiComment, len(comments))
+	for i, c := range comments {
+		result[i] = apiComment{comment: c}
+		if c.Heading == "" {
+			result[i].Section = sectionAt(headings, c.Line)
+		}
+	}
+	return result
+}
+
+// validateComment checks a new or edited comment, trimming its text and author
+func validateComment(req *apiCommentRequest) error {
+	req.Text = strings.TrimSpace(req.Text)
+	req.Author = strings.TrimSpace(req.Author)
+	switch {
+	case req.Text == "":
+		return errors.New("empty comment")
+	case utf8.RuneCountInString(req.Text) > maxCommentLen:
+		return fmt.Errorf("comment longer than %d characters", maxCommentLen)
+	case utf8.RuneCountInString(req.Author) > maxPresenceNameLen:
+		return fmt.Errorf("author longer than %d characters", maxPresenceNameLen)
+	case req.Line < 0:
+		return errors.New("invalid line")
+	}
+	return nil
+}
+
+// notifyCommentsChanged tells browsers the comments on absPath changed
+func notifyCommentsChanged(absPath string) {
+	msgBytes, err := json.Marshal(commentsChangedMessage{Type: "comments_changed", Path: filepath.ToSlash(getRelativePath(absPath))})
+	if err != nil {
+		log.Printf("Error marshaling comments_changed message: %v", err)
+		return
+	}
+	notifyClientsWithMessage(string(msgBytes))
+}
+
+// handleAPIComments lists (GET ?path=), adds (POST), edits (PUT) or deletes
+// (DELETE ?path=&id=) comments on a served markdown file. Comments are kept
+// outside the file, so reviewing never edits it.
+func handleAPIComments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		serveComments(w, r)
+	case http.MethodPost, http.MethodPut:
+		var req apiCommentRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCommentBodySize)).Decode(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		absPath, ok := resolveWhitelistedPath(w, req.Path)
+		if !ok {
+			return
+		}
+		if err := validateComment(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid comment: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			addComment(w, absPath, req)
+		} else {
+			editComment(w, absPath, req)
+		}
+	case http.MethodDelete:
+		absPath, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+		if !ok {
+			return
+		}
+		deleteComment(w, absPath, r.URL.Query().Get("id"))
+	}
+}
+
+// serveComments lists the comments on the file in ?path=, oldest first
+func serveComments(w http.ResponseWriter, r *http.Request) {
+	absPath, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	commentsMutex.Lock()
+	comments := loadComments(absPath)
+	commentsMutex.Unlock()
+
+	resp := apiCommentsResponse{Path: filepath.ToSlash(getRelativePath(absPath)), Comments: []apiComment{}}
+	if len(comments) > 0 {
+		content, err := os.ReadFile(absPath)
+		if err != nil {
+			writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		resp.Comments = commentSections(render.Headings(newMarkdownRenderer(), content), comments)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// addComment stores a new comment on absPath and responds with it
+func addComment(w http.ResponseWriter, absPath string, req apiCommentRequest) {
+	if req.Heading == "" && req.Line == 0 {
+		writeError(w, errCodeBadRequest, "Invalid comment: anchor it to a heading or a line", http.StatusBadRequest)
+		return
+	}
+	id, err := newRecordID()
+	if err != nil {
+		writeError(w, errCodeInternal, "Cannot create comment", http.StatusInternalServerError)
+		return
+	}
+	c := comment{ID: id, Heading: req.Heading, Text: req.Text, Author: req.Author, Created: time.Now().UTC()}
+	if req.Heading == "" {
+		c.Line = req.Line
+	}
+
+	err = updateComments(absPath, func(comments []comment) ([]comment, error) {
+		if len(comments) >= maxCommentsPerFile {
+			return nil, errTooManyComments
+		}
+		return append(comments, c), nil
+	})
+	if errors.Is(err, errTooManyComments) {
+		writeError(w, errCodeTooLarge, fmt.Sprintf("Too many comments on this file (at most %d)", maxCommentsPerFile), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save comment on %s: %v", absPath, err)
+		writeError(w, errCodeInternal, "Failed to save comment", http.StatusInternalServerError)
+		return
+	}
+	notifyCommentsChanged(absPath)
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// errTooManyComments refuses comments beyond maxCommentsPerFile
+var errTooManyComments = errors.New("too many comments")
+
+// errCommentNotFound is returned for edits and deletions of unknown comments
+var errCommentNotFound = errors.New("comment not found")
+
+// editComment replaces the text of a comment on absPath and responds with it
+func editComment(w http.ResponseWriter, absPath string, req apiCommentRequest) {
+	var edited comment
+	err := updateComments(absPath, func(comments []comment) ([]comment, error) {
+		i := slices.IndexFunc(comments, func(c comment) bool { return c.ID == req.ID })
+		if i < 0 {
+			return nil, errCommentNotFound
+		}
+		now := time.Now().UTC()
+		comments[i].Text, comments[i].Updated = req.Text, &now
+		edited = comments[i]
+		return comments, nil
+	})
+	if !writeCommentError(w, absPath, err) {
+		return
+	}
+	notifyCommentsChanged(absPath)
+	writeJSON(w, http.StatusOK, edited)
+}
+
+// deleteComment removes a comment from absPath
+func deleteComment(w http.ResponseWriter, absPath, id string) {
+	err := updateComments(absPath, func(comments []comment) ([]comment, error) {
+		i := slices.IndexFunc(comments, func(c comment) bool { return c.ID == id })
+		if i < 0 {
+			return nil, errCommentNotFound
+		}
+		return slices.Delete(comments, i, i+1), nil
+	})
+	if !writeCommentError(w, absPath, err) {
+		return
+	}
+	notifyCommentsChanged(absPath)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeCommentError responds to a failed comment update, reporting whether
+// there was no error
+func writeCommentError(w http.ResponseWriter, absPath string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errCommentNotFound):
+		writeError(w, errCodeNotFound, "Comment not found", http.StatusNotFound)
+	default:
+		log.Printf("Failed to save comments on %s: %v", absPath, err)
+		writeError(w, errCodeInternal, "Failed to save comment", http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleAPICommentsAnchors(t *testing.T) {
+	serveTestFiles(t, "comments", map[string]string{"docs/plan.md": "Intro\n\n# Plan\n\nFirst step.\n\n## Risks\n\nNone yet.\n"})
+
+	for _, body := range []string{
+		`{"path": "docs/plan.md", "heading": "risks", "text": " Missing rollback ", "author": "Ana"}`,
+		`{"path": "docs/plan.md", "line": 5, "text": "Which step?"}`,
+		`{"path": "docs/plan.md", "line": 1, "text": "Needs a title"}`,
+	} {
+		rec := httptest.NewRecorder()
+		handleAPIComments(rec, httptest.NewRequest(http.MethodPost, "/api/comments", strings.NewReader(body)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("POST %s = %d %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Line comments are placed in the section they fall in
+	rec := httptest.NewRecorder()
+	handleAPIComments(rec, httptest.NewRequest(http.MethodGet, "/api/comments?path=docs/plan.md", nil))
+	var resp apiCommentsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/comments = %d %s", rec.Code, rec.Body.String())
+	}
+	got := resp.Comments
+	if resp.Path != "docs/plan.md" || len(got) != 3 {
+		t.Fatalf("comments on %q = %+v, want 3 on docs/plan.md", resp.Path, got)
+	}
+	if got[0].Heading != "risks" || got[0].Text != "Missing rollback" || got[0].Author != "Ana" || got[0].Section != "" {
+		t.Errorf("heading comment = %+v", got[0])
+	}
+	if got[1].Line != 5 || got[1].Section != "plan" {
+		t.Errorf("line comment = %+v, want section plan", got[1])
+	}
+	if got[2].Section != "" {
+		t.Errorf("comment above the first heading = %+v, want no section", got[2])
+	}
+}
+
+func TestHandleAPICommentsEdit(t *testing.T) {
+	dir := serveTestFiles(t, "comments", map[string]string{"docs/plan.md": "# Plan\n"})
+	path := filepath.Join(dir, "docs", "plan.md")
+
+	rec := httptest.NewRecorder()
+	handleAPIComments(rec, httptest.NewRequest(http.MethodPost, "/api/comments", strings.NewReader(`{"path": "docs/plan.md", "heading": "plan", "text": "Draft"}`)))
+	var created comment
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.ID == "" {
+		t.Fatalf("POST /api/comments = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handleAPIComments(rec, httptest.NewRequest(http.MethodPut, "/api/comments", strings.NewReader(`{"path": "docs/plan.md", "id": "`+created.ID+`", "text": "Reviewed"}`)))
+	if got := loadComments(path); rec.Code != http.StatusOK || len(got) != 1 || got[0].Text != "Reviewed" || got[0].Updated == nil {
+		t.Fatalf("after PUT (status %d): %+v", rec.Code, got)
+	}
+
+	target := "/api/comments?path=docs/plan.md&id=" + created.ID
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		handleAPIComments(rec, httptest.NewRequest(http.MethodDelete, target, nil))
+		if rec.Code != want {
+			t.Fatalf("DELETE = %d %s, want %d", rec.Code, rec.Body.String(), want)
+		}
+	}
+	if _, err := os.Stat(commentsPath(path)); !os.IsNotExist(err) {
+		t.Errorf("comments file left after deleting the last comment: %v", err)
+	}
+}
+
+func TestHandleAPICommentsInvalid(t *testing.T) {
+	serveTestFiles(t, "comments", map[string]string{"docs/plan.md": "# Plan\n"})
+	tests := []struct {
+		method, body string
+		want         int
+	}{
+		{http.MethodPost, `{"path": "docs/plan.md", "text": "Unanchored"}`, http.StatusBadRequest},
+		{http.MethodPost, `{"path": "docs/plan.md", "heading": "plan", "text": "  "}`, http.StatusBadRequest},
+		{http.MethodPost, `{"path": "docs/plan.md", "line": -1, "text": "Before the file"}`, http.StatusBadRequest},
+		{http.MethodPost, `{"path": "docs/plan.md", "heading": "plan", "text": "` + strings.Repeat("x", maxCommentLen+1) + `"}`, http.StatusBadRequest},
+		{http.MethodPost, `{"path": "other.md", "heading": "plan", "text": "Not served"}`, http.StatusForbidden},
+		{http.MethodPut, `{"path": "docs/plan.md", "id": "missing", "text": "Edit"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handleAPIComments(rec, httptest.NewRequest(tt.method, "/api/comments", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %.60s: status = %d, want %d", tt.method, tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestRenameComments(t *testing.T) {
+	dir := serveTestFiles(t, "comments", map[string]string{"docs/plan.md": "# Plan\n"})
+	path := filepath.Join(dir, "docs", "plan.md")
+	handleAPIComments(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/comments", strings.NewReader(`{"path": "docs/plan.md", "heading": "plan", "text": "Keep me"}`)))
+
+	newPath := filepath.Join(dir, "docs", "roadmap.md")
+	renameComments(path, newPath)
+	if got := loadComments(path); len(got) != 0 {
+		t.Errorf("comments left on the old path: %+v", got)
+	}
+	if got := loadComments(newPath); len(got) != 1 || got[0].Text != "Keep me" {
+		t.Errorf("comments on the new path = %+v", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/razvandimescu/peekm/diff"
+)
+
+// compareDiffContext is the number of unchanged lines kept around each change
+const compareDiffContext = 3
+
+// compareTmpl renders /compare (two files side by side plus their source diff)
+var compareTmpl *template.Template
+
+// comparePane is one side of a comparison
+type comparePane struct {
+	Path    string // Relative to the browse directory
+	Title   string
+	Content template.HTML
+}
+
+// compareDiffRow is one row of the source diff; Gap rows stand for skipped
+// unchanged lines
+type compareDiffRow struct {
+	Op      string // "equal", "insert" or "delete"
+	Text    string
+	OldLine int // 0 when the line is not in the left file
+	NewLine int // 0 when the line is not in the right file
+	Gap     bool
+}
+
+// compareTemplateData is used for rendering the compare view
+type compareTemplateData struct {
+	baseTemplateData
+	Left    comparePane
+	Right   comparePane
+	Rows    []compareDiffRow
+	Added   int
+	Removed int
+}
+
+// handleCompare renders /compare?left=A.md&right=B.md: both files rendered in a
+// synchronized split view and a line diff of their markdown source
+func handleCompare(w http.ResponseWriter, r *http.Request) {
+	left, leftSource, ok := loadComparePane(w, r.URL.Query().Get("left"))
+	if !ok {
+		return
+	}
+	right, rightSource, ok := loadComparePane(w, r.URL.Query().Get("right"))
+	if !ok {
+		return
+	}
+
+	lines := diff.Lines(leftSource, rightSource)
+	added, removed := diff.Stats(lines)
+	data := compareTemplateData{
+		baseTemplateData: newBaseTemplateData(r),
+		Left:             left,
+		Right:            right,
+		Rows:             compareDiffRows(lines, compareDiffContext),
+		Added:            added,
+		Removed:          removed,
+	}
+
+	var buf bytes.Buffer
+	if err := compareTmpl.Execute(&buf, data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		writeError(w, errCodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// loadComparePane validates, reads and renders one side of a comparison,
+// writing the error response on failure
+func loadComparePane(w http.ResponseWriter, rawPath string) (comparePane, string, bool) {
+	validated, ok := resolveWhitelistedPath(w, rawPath)
+	if !ok {
+		return comparePane{}, "", false
+	}
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return comparePane{}, "", false
+	}
+	html, err := renderFile(validated, content)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to render markdown", http.StatusInternalServerError)
+		return comparePane{}, "", false
+	}
+	return comparePane{
+		Path:    filepath.ToSlash(getRelativePath(validated)),
+		Title:   filepath.Base(validated),
+		Content: template.HTML(html),
+	}, string(content), true
+}
+
+// compareDiffRows numbers diff lines and collapses unchanged runs further than
+// context lines from a change into a single gap row
+func compareDiffRows(lines []diff.Line, context int) []compareDiffRow {
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.Op == diff.Equal {
+			continue
+		}
+		for j := max(0, i-context); j <= min(len(lines)-1, i+context); j++ {
+			keep[j] = true
+		}
+	}
+
+	var rows []compareDiffRow
+	oldLine, newLine := 0, 0
+	skipped := false
+	for i, l := range lines {
+		row := compareDiffRow{Op: l.Op.String(), Text: l.Text}
+		if l.Op != diff.Insert {
+			oldLine++
+			row.OldLine = oldLine
+		}
+		if l.Op != diff.Delete {
+			newLine++
+			row.NewLine = newLine
+		}
+		if !keep[i] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			rows = append(rows, compareDiffRow{Gap: true})
+			skipped = false
+		}
+		rows = append(rows, row)
+	}
+	if skipped {
+		rows = append(rows, compareDiffRow{Gap: true})
+	}
+	return rows
+}
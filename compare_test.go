@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/razvandimescu/peekm/diff"
+)
+
+// TestCompareDiffRows tests line numbering and collapsing of unchanged runs
+func TestCompareDiffRows(t *testing.T) {
+	lines := diff.Lines("a\nb\nc\nd\ne\nf\n", "a\nb\nc\nd\nE\nf\n")
+	got := compareDiffRows(lines, 1)
+	want := []compareDiffRow{
+		{Gap: true},
+		{Op: "equal", Text: "d", OldLine: 4, NewLine: 4},
+		{Op: "delete", Text: "e", OldLine: 5},
+		{Op: "insert", Text: "E", NewLine: 5},
+		{Op: "equal", Text: "f", OldLine: 6, NewLine: 6},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareDiffRows() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+// TestHandleCompare tests the compare view and its path validation
+func TestHandleCompare(t *testing.T) {
+	serveTestFiles(t, "compare", map[string]string{
+		"original.md": "# Plan\n\nShip on Friday.\n",
+		"rewrite.md":  "# Plan\n\nShip on Monday.\n",
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "two files",
+			url:      "/compare?left=original.md&right=rewrite.md",
+			wantCode: http.StatusOK,
+			wantBody: []string{"<p>Ship on Friday.</p>", "<p>Ship on Monday.</p>", "+1 −1", "- Ship on Friday.", "+ Ship on Monday."},
+		},
+		{
+			name:     "same file",
+			url:      "/compare?left=original.md&right=original.md",
+			wantCode: http.StatusOK,
+			wantBody: []string{"+0 −0", "The files have the same source"},
+		},
+		{name: "missing right", url: "/compare?left=original.md", wantCode: http.StatusBadRequest},
+		{name: "unknown file", url: "/compare?left=original.md&right=other.md", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleCompare(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body missing %q", want)
+				}
+			}
+		})
+	}
+}
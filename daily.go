@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultDailyTemplate is the template used for daily notes when it exists
+const defaultDailyTemplate = "daily"
+
+// dailyNotePath expands the --daily-path pattern for a day (e.g. notes/2024-05-12.md)
+func dailyNotePath(now time.Time) (string, error) {
+	relPath := filepath.Clean(expandTemplate(*dailyPath, templateVars("", now, nil)))
+	if !strings.HasSuffix(strings.ToLower(relPath), ".md") || !filepath.IsLocal(relPath) {
+		return "", fmt.Errorf("daily note path %q must name a .md file inside the browse directory", relPath)
+	}
+	return relPath, nil
+}
+
+// dailyNoteContent instantiates the daily template, or returns nil for the
+// default title heading when no such template exists
+func dailyNoteContent(relPath string) (*string, error) {
+	if *dailyTmpl == "" {
+		return nil, nil
+	}
+	body, err := instantiateTemplate(*dailyTmpl, relPath, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		if *dailyTmpl != defaultDailyTemplate {
+			log.Printf("Warning: Daily note template %q not found, using a plain heading", *dailyTmpl)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &body, nil
+}
+
+// ensureDailyNote creates the note for a day unless it already exists.
+// Returns the note's path relative to browseDir and whether it was created.
+func ensureDailyNote(now time.Time) (string, bool, error) {
+	relPath, err := dailyNotePath(now)
+	if err != nil {
+		return "", false, err
+	}
+	absPath := resolveFilePath(relPath)
+	if fileExists(absPath) {
+		addToWhitelist(absPath)
+		return relPath, false, nil
+	}
+
+	content, err := dailyNoteContent(relPath)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := createMarkdownFile(relPath, content); err != nil {
+		if os.IsExist(err) {
+			return relPath, false, nil // Created concurrently
+		}
+		return "", false, err
+	}
+	return relPath, true, nil
+}
+
+// openDailyNote creates today's note for "peekm today" and returns it as the
+// target file to open, relative to browseDir
+func openDailyNote() string {
+	relPath, created, err := ensureDailyNote(time.Now())
+	if err != nil {
+		log.Fatalf("Cannot open daily note: %v", err)
+	}
+	if created {
+		fmt.Printf("Created daily note %s\n", relPath)
+	}
+	return relPath
+}
+
+// handleToday opens today's daily note. GET redirects to the note if it
+// exists and otherwise offers to create it, so that a link can't create files.
+// POST creates it if needed and returns {"path": ..., "created": ...}, or
+// redirects to it from a plain form.
+func handleToday(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		serveToday(w, r)
+		return
+	}
+
+	relPath, created, err := ensureDailyNote(time.Now())
+	if err != nil {
+		statusCode, code := createErrorStatus(err)
+		writeError(w, code, fmt.Sprintf("Cannot open daily note: %v", err), statusCode)
+		return
+	}
+
+	if created {
+		log.Printf("Created daily note: %s", resolveFilePath(relPath))
+		sendFileEvent("file_added", filepath.ToSlash(relPath), "")
+	}
+
+	if isNoScriptRequest(r) {
+		http.Redirect(w, r, viewURL(relPath), http.StatusSeeOther)
+		return
+	}
+	statusCode := http.StatusOK
+	if created {
+		statusCode = http.StatusCreated
+	}
+	writeJSON(w, statusCode, struct {
+		Path    string `json:"path"`
+		Created bool   `json:"created"`
+	}{filepath.ToSlash(relPath), created})
+}
+
+// serveToday redirects to today's note, or answers 404 with a button that
+// POSTs to /today on page loads
+func serveToday(w http.ResponseWriter, r *http.Request) {
+	relPath, err := dailyNotePath(time.Now())
+	if err != nil {
+		writeError(w, errCodeInternal, fmt.Sprintf("Cannot open daily note: %v", err), http.StatusInternalServerError)
+		return
+	}
+	absPath := resolveFilePath(relPath)
+	if fileExists(absPath) {
+		addToWhitelist(absPath)
+		http.Redirect(w, r, viewURL(relPath), http.StatusSeeOther)
+		return
+	}
+
+	message := fmt.Sprintf("Today's note %s does not exist yet", filepath.ToSlash(relPath))
+	if wantsErrorPage(r) {
+		w.Header().Set(errorCodeHeader, errCodeNotFound)
+		writeErrorPage(w, r, apiError{Status: http.StatusNotFound, Code: errCodeNotFound, Message: message}, "/today")
+		return
+	}
+	writeError(w, errCodeNotFound, message, http.StatusNotFound)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDailyNotePath tests expansion and validation of the --daily-path pattern
+func TestDailyNotePath(t *testing.T) {
+	prevPath := *dailyPath
+	defer func() { *dailyPath = prevPath }()
+
+	day := time.Date(2024, 5, 12, 8, 0, 0, 0, time.Local)
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr bool
+	}{
+		{"notes/{{date}}.md", filepath.Join("notes", "2024-05-12.md"), false},
+		{"journal/{{year}}/{{date}}.md", filepath.Join("journal", "2024", "2024-05-12.md"), false},
+		{"../{{date}}.md", "", true},
+		{"notes/{{date}}.txt", "", true},
+	}
+	for _, tt := range tests {
+		*dailyPath = tt.pattern
+		got, err := dailyNotePath(day)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("dailyNotePath(%q) = %q, %v; want %q, error %t", tt.pattern, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// setupTodayTest browses an empty directory with serveTestFiles, with daily
+// notes in notes/ from the daily template tmpl
+func setupTodayTest(t *testing.T, tmpl string) string {
+	t.Helper()
+	dir := serveTestFiles(t, "today", nil)
+	prevPath, prevTmpl := *dailyPath, *dailyTmpl
+	t.Cleanup(func() { *dailyPath, *dailyTmpl = prevPath, prevTmpl })
+	*dailyPath, *dailyTmpl = "notes/{{date}}.md", tmpl
+	return dir
+}
+
+// TestHandleToday tests that POST /today creates the note once from the template and GET redirects to it
+func TestHandleToday(t *testing.T) {
+	dir := setupTodayTest(t, defaultDailyTemplate)
+	templates := filepath.Join(dir, ".peekm", "templates")
+	if err := os.MkdirAll(templates, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templates, "daily.md"), []byte("# Journal {{date}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Now().Format("2006-01-02")
+	for i, want := range []int{http.StatusCreated, http.StatusOK} {
+		rec := httptest.NewRecorder()
+		handleToday(rec, httptest.NewRequest("POST", "/today", nil))
+		if rec.Code != want {
+			t.Errorf("request %d: status = %d, want %d (%s)", i, rec.Code, want, rec.Body.String())
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "notes", date+".md"))
+	if err != nil || string(content) != "# Journal "+date+"\n" {
+		t.Errorf("note content = %q, %v; want expanded template", content, err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleToday(rec, httptest.NewRequest("GET", "/today", nil))
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusSeeOther || loc != "/view/notes/"+date+".md" {
+		t.Errorf("GET /today = %d %q, want redirect to the note", rec.Code, loc)
+	}
+
+	// The Today button's form post goes to the note
+	req := httptest.NewRequest("POST", "/today", strings.NewReader("noscript=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	handleToday(rec, req)
+	if loc := rec.Header().Get("Location"); rec.Code != http.StatusSeeOther || loc != "/view/notes/"+date+".md" {
+		t.Errorf("form POST /today = %d %q, want redirect to the note", rec.Code, loc)
+	}
+}
+
+// TestHandleTodayGet tests that GET /today never creates the note: page loads
+// get a button that POSTs instead
+func TestHandleTodayGet(t *testing.T) {
+	dir := setupTodayTest(t, "")
+	for _, accept := range []string{"", "text/html"} {
+		req := httptest.NewRequest("GET", "/today", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		handleToday(rec, req)
+		if rec.Code != http.StatusNotFound || rec.Header().Get(errorCodeHeader) != errCodeNotFound {
+			t.Errorf("GET /today (Accept %q) = %d %s, want 404", accept, rec.Code, rec.Body.String())
+		}
+		if accept != "" && !strings.Contains(rec.Body.String(), `<form method="post" action="/today">`) {
+			t.Errorf("GET /today page = %s, want a create form", rec.Body.String())
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("GET /today created %v", entries)
+	}
+}
+
+// TestOpenDailyNote tests that "peekm today" opens the note in its subdirectory
+func TestOpenDailyNote(t *testing.T) {
+	dir := setupTodayTest(t, "")
+	date := time.Now().Format("2006-01-02")
+	target := openDailyNote()
+	if target != filepath.Join("notes", date+".md") || !isWhitelistedFile(filepath.Join(dir, target)) {
+		t.Fatalf("openDailyNote() = %q, want the whitelisted note relative to the browsed directory", target)
+	}
+	if _, fullURL := startupURLs(target); !strings.HasSuffix(fullURL, "/view/notes/"+date+".md") {
+		t.Errorf("startupURLs(%q) = %q, want the note's view URL", target, fullURL)
+	}
+}
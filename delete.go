@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Values of --delete
+const (
+	deleteTrash     = "trash"     // Move files to the OS trash
+	deletePermanent = "permanent" // Remove files for good
+	deleteDisabled  = "disabled"  // Refuse every deletion
+)
+
+// deleteTokenTTL is how long a client has to confirm a deletion
+const deleteTokenTTL = 2 * time.Minute
+
+// deleteConfirmation is the 409 response to a deletion that must be
+// confirmed: sending confirm_token back with the same path performs it
+type deleteConfirmation struct {
+	Path         string `json:"path"`
+	Reason       string `json:"reason"`
+	ConfirmToken string `json:"confirm_token"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds
+}
+
+// pendingDelete is a deletion waiting for its confirmation token
+type pendingDelete struct {
+	path    string
+	expires time.Time
+}
+
+// deleteTokens holds the confirmation tokens issued for risky deletions;
+// each is bound to one file and can be used once
+type deleteTokens struct {
+	mu      sync.Mutex
+	pending map[string]pendingDelete
+}
+
+var confirmTokens = &deleteTokens{pending: make(map[string]pendingDelete)}
+
+// issue returns a new token confirming the deletion of filePath
+func (d *deleteTokens) issue(filePath string) (string, error) {
+	token, err := newAccessToken()
+	if err != nil {
+		return "", err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for t, p := range d.pending {
+		if now.After(p.expires) {
+			delete(d.pending, t)
+		}
+	}
+	d.pending[token] = pendingDelete{path: filePath, expires: now.Add(deleteTokenTTL)}
+	return token, nil
+}
+
+// redeem consumes token and reports whether it confirms deleting filePath
+func (d *deleteTokens) redeem(token, filePath string) bool {
+	if token == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.pending[token]
+	delete(d.pending, token)
+	return ok && p.path == filePath && time.Now().Before(p.expires)
+}
+
+// setupDeleteMode applies --no-trash (short for --delete=permanent) and
+// checks the --delete value
+func setupDeleteMode() {
+	if *noTrash {
+		*deleteMode = deletePermanent
+	}
+	switch *deleteMode {
+	case deleteTrash, deletePermanent, deleteDisabled:
+	default:
+		log.Fatalf("Invalid --delete value %q (use trash, permanent or disabled)", *deleteMode)
+	}
+}
+
+// deleteRisk returns why deleting filePath needs a confirmation token: it is
+// outside the browsed directory or at least --confirm-delete-kb in size.
+// Empty means it can be deleted straight away.
+func deleteRisk(filePath string) string {
+	fileMutex.RLock()
+	dir := browseDir
+	fileMutex.RUnlock()
+
+	if rel, err := filepath.Rel(dir, filePath); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Sprintf("%s is outside %s", filePath, dir)
+	}
+	if info, err := os.Stat(filePath); err == nil && info.Size() >= int64(*confirmKB)*1024 {
+		return fmt.Sprintf("%s is %d KB", filepath.Base(filePath), info.Size()/1024)
+	}
+	return ""
+}
+
+// checkDeleteConfirmation reports whether filePath may be deleted. A risky
+// deletion without a valid token is answered with 409 and a fresh token.
+func checkDeleteConfirmation(w http.ResponseWriter, filePath, token string) bool {
+	reason := deleteRisk(filePath)
+	if reason == "" || confirmTokens.redeem(token, filePath) {
+		return true
+	}
+	newToken, err := confirmTokens.issue(filePath)
+	if err != nil {
+		writeError(w, errCodeInternal, "Cannot issue confirmation token", http.StatusInternalServerError)
+		return false
+	}
+	writeJSON(w, http.StatusConflict, deleteConfirmation{
+		Path:         filePath,
+		Reason:       reason,
+		ConfirmToken: newToken,
+		ExpiresIn:    int(deleteTokenTTL / time.Second),
+	})
+	return false
+}
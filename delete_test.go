@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// postDelete sends a /delete request and returns the response
+func postDelete(t *testing.T, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"path": path, "confirm_token": token})
+	rec := httptest.NewRecorder()
+	handleDelete(rec, httptest.NewRequest("POST", "/delete", strings.NewReader(string(body))))
+	return rec
+}
+
+func TestHandleDeleteConfirmation(t *testing.T) {
+	dir := serveTestFiles(t, "delete", map[string]string{
+		"docs/small.md": strings.Repeat("x", 10),
+		"docs/large.md": strings.Repeat("x", 2048),
+		"plan.md":       strings.Repeat("x", 10),
+	})
+	docs := filepath.Join(dir, "docs")
+	small := filepath.Join(docs, "small.md")
+	large := filepath.Join(docs, "large.md")
+	outside := filepath.Join(dir, "plan.md")
+
+	prevNoWatch, prevMode, prevKB := *noWatch, *deleteMode, *confirmKB
+	browseDir, *noWatch, *deleteMode, *confirmKB = docs, true, deletePermanent, 1
+	defer func() { *noWatch, *deleteMode, *confirmKB = prevNoWatch, prevMode, prevKB }()
+
+	if rec := postDelete(t, small, ""); rec.Code != http.StatusOK {
+		t.Fatalf("small file: status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(small); !os.IsNotExist(err) {
+		t.Error("small file was not deleted")
+	}
+
+	for _, path := range []string{large, outside} {
+		checkConfirmedDelete(t, path)
+	}
+}
+
+// checkConfirmedDelete deletes path through the confirmation token flow
+func checkConfirmedDelete(t *testing.T, path string) {
+	t.Helper()
+	rec := postDelete(t, path, "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("%s: status = %d, want 409 (%s)", path, rec.Code, rec.Body.String())
+	}
+	var resp deleteConfirmation
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ConfirmToken == "" || resp.Reason == "" || resp.Path != path {
+		t.Fatalf("%s: confirmation = %+v", path, resp)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("%s deleted before confirmation: %v", path, err)
+	}
+
+	if rec := postDelete(t, path, "bogus"); rec.Code != http.StatusConflict {
+		t.Errorf("%s: unknown token: status = %d, want 409", path, rec.Code)
+	}
+	if rec := postDelete(t, path, resp.ConfirmToken); rec.Code != http.StatusOK {
+		t.Fatalf("%s: confirmed: status = %d (%s)", path, rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s was not deleted after confirmation", path)
+	}
+}
+
+func TestDeleteTokens(t *testing.T) {
+	tokens := &deleteTokens{pending: make(map[string]pendingDelete)}
+	token, err := tokens.issue("/docs/a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.redeem(token, "/docs/b.md") {
+		t.Error("token confirmed a different file")
+	}
+	if tokens.redeem(token, "/docs/a.md") {
+		t.Error("token was usable after a failed redemption")
+	}
+
+	token, _ = tokens.issue("/docs/a.md")
+	if !tokens.redeem(token, "/docs/a.md") {
+		t.Error("token did not confirm its file")
+	}
+	if tokens.redeem(token, "/docs/a.md") {
+		t.Error("token was usable twice")
+	}
+	if tokens.redeem("", "/docs/a.md") {
+		t.Error("empty token confirmed a deletion")
+	}
+}
+
+func TestHandleDeleteDisabled(t *testing.T) {
+	prevMode := *deleteMode
+	*deleteMode = deleteDisabled
+	defer func() { *deleteMode = prevMode }()
+
+	if rec := postDelete(t, "docs/a.md", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diagramTimeout bounds one diagram render (mmdc starts a headless browser)
+const diagramTimeout = 30 * time.Second
+
+// maxFailedDiagrams bounds the failures remembered, which every edit to a
+// broken diagram adds to; past it they are forgotten and may be retried
+const maxFailedDiagrams = 256
+
+// diagramTool describes how one fenced block language is rendered to SVG
+type diagramTool struct {
+	command string // Local binary, used when it is on $PATH
+	kroki   string // Kroki diagram type, used otherwise when a Kroki URL is set
+	run     func(ctx context.Context, bin string, source []byte) ([]byte, error)
+}
+
+// diagramTools maps fenced block languages to their renderers
+var diagramTools = map[string]diagramTool{
+	"mermaid":  {command: "mmdc", kroki: "mermaid", run: runMermaid},
+	"plantuml": {command: "plantuml", kroki: "plantuml", run: runPlantUML},
+	"puml":     {command: "plantuml", kroki: "plantuml", run: runPlantUML},
+	"dot":      {command: "dot", kroki: "graphviz", run: runGraphviz},
+	"graphviz": {command: "dot", kroki: "graphviz", run: runGraphviz},
+}
+
+// errNoDiagramTool means neither a local tool nor a Kroki server is available
+var errNoDiagramTool = errors.New("no local tool or Kroki URL")
+
+// diagramRenderer renders diagrams server side and caches the SVGs on disk by
+// content hash, so each diagram only runs through a tool once. Nothing is
+// rendered (no tool is spawned) without --diagrams.
+type diagramRenderer struct {
+	enabled  bool // --diagrams
+	krokiURL string
+	cacheDir string // Empty disables the disk cache
+	lookPath func(file string) (string, error)
+
+	mu     sync.Mutex
+	failed map[string]bool // Hashes that failed this run, not retried (up to maxFailedDiagrams)
+}
+
+// sharedDiagramRenderer is the renderer used by the server
+var sharedDiagramRenderer = sync.OnceValue(func() *diagramRenderer {
+	return newDiagramRenderer(*diagrams, krokiURLValue())
+})
+
+// newDiagramRenderer creates a renderer caching under the user cache directory.
+// Unless enabled, it renders nothing.
+func newDiagramRenderer(enabled bool, krokiURL string) *diagramRenderer {
+	d := &diagramRenderer{
+		enabled:  enabled,
+		krokiURL: strings.TrimRight(krokiURL, "/"),
+		lookPath: exec.LookPath,
+		failed:   make(map[string]bool),
+	}
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		d.cacheDir = filepath.Join(cacheDir, "peekm", "diagrams")
+	}
+	return d
+}
+
+// krokiURLValue returns the Kroki server from --kroki-url or $PEEKM_KROKI_URL
+func krokiURLValue() string {
+	if *krokiURL != "" {
+		return *krokiURL
+	}
+	return os.Getenv("PEEKM_KROKI_URL")
+}
+
+// diagramHash is the cache key of a diagram: its language and source
+func diagramHash(lang string, source []byte) string {
+	h := sha256.New()
+	h.Write([]byte(lang))
+	h.Write([]byte{0})
+	h.Write(source)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Render implements render.DiagramRenderer. Unknown languages and failed
+// renders return false so the block stays as highlighted source.
+func (d *diagramRenderer) Render(lang string, source []byte) ([]byte, bool) {
+	tool, found := diagramTools[lang]
+	if !found || !d.enabled {
+		return nil, false
+	}
+	hash := diagramHash(lang, source)
+	if svg, ok := d.cached(hash); ok {
+		return svg, true
+	}
+
+	d.mu.Lock()
+	failed := d.failed[hash]
+	d.mu.Unlock()
+	if failed {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagramTimeout)
+	defer cancel()
+	svg, err := d.generate(ctx, tool, source)
+	if err != nil {
+		log.Printf("Warning: Cannot render %s diagram: %v", lang, err)
+		d.mu.Lock()
+		if len(d.failed) >= maxFailedDiagrams {
+			clear(d.failed)
+		}
+		d.failed[hash] = true
+		d.mu.Unlock()
+		return nil, false
+	}
+	d.store(hash, svg)
+	return svg, true
+}
+
+// generate renders a diagram with the local tool, falling back to Kroki
+func (d *diagramRenderer) generate(ctx context.Context, tool diagramTool, source []byte) ([]byte, error) {
+	var svg []byte
+	var err error
+	if bin, lookErr := d.lookPath(tool.command); lookErr == nil {
+		svg, err = tool.run(ctx, bin, source)
+	} else if d.krokiURL != "" {
+		svg, err = fetchKroki(ctx, d.krokiURL, tool.kroki, source)
+	} else {
+		return nil, fmt.Errorf("%s not found and %w", tool.command, errNoDiagramTool)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return trimToSVG(svg)
+}
+
+// cached returns a diagram's SVG from the disk cache
+func (d *diagramRenderer) cached(hash string) ([]byte, bool) {
+	if d.cacheDir == "" {
+		return nil, false
+	}
+	svg, err := os.ReadFile(filepath.Join(d.cacheDir, hash+".svg"))
+	return svg, err == nil
+}
+
+// store writes a diagram's SVG to the disk cache; failures are only logged
+func (d *diagramRenderer) store(hash string, svg []byte) {
+	if d.cacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(d.cacheDir, 0700); err != nil {
+		log.Printf("Warning: Cannot create diagram cache: %v", err)
+		return
+	}
+	// Write to a temp file and rename so concurrent renders never see half a file
+	tmp, err := os.CreateTemp(d.cacheDir, hash+".*.tmp")
+	if err != nil {
+		log.Printf("Warning: Cannot cache diagram: %v", err)
+		return
+	}
+	_, writeErr := tmp.Write(svg)
+	closeErr := tmp.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		log.Printf("Warning: Cannot cache diagram: %v", err)
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.cacheDir, hash+".svg")); err != nil {
+		log.Printf("Warning: Cannot cache diagram: %v", err)
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+// trimToSVG drops anything before the <svg> element (XML prolog, doctype)
+func trimToSVG(output []byte) ([]byte, error) {
+	i := bytes.Index(output, []byte("<svg"))
+	if i < 0 {
+		return nil, errors.New("output is not SVG")
+	}
+	return bytes.TrimSpace(output[i:]), nil
+}
+
+// runMermaid renders mermaid with mermaid-cli, which only reads and writes files
+func runMermaid(ctx context.Context, bin string, source []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "peekm-mermaid-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "diagram.mmd")
+	output := filepath.Join(dir, "diagram.svg")
+	if err := os.WriteFile(input, source, 0600); err != nil {
+		return nil, err
+	}
+	if _, err := runDiagramCommand(ctx, nil, bin, "-i", input, "-o", output); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(output)
+}
+
+// runPlantUML renders PlantUML through stdin and stdout
+func runPlantUML(ctx context.Context, bin string, source []byte) ([]byte, error) {
+	return runDiagramCommand(ctx, source, bin, "-tsvg", "-pipe")
+}
+
+// runGraphviz renders DOT with Graphviz through stdin and stdout
+func runGraphviz(ctx context.Context, bin string, source []byte) ([]byte, error) {
+	return runDiagramCommand(ctx, source, bin, "-Tsvg")
+}
+
+// runDiagramCommand runs a diagram tool and returns its stdout, with stderr in the error
+func runDiagramCommand(ctx context.Context, stdin []byte, bin string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, bin, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", filepath.Base(bin), err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", filepath.Base(bin), err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// fetchKroki renders a diagram with a Kroki server (POST {base}/{type}/svg)
+func fetchKroki(ctx context.Context, base, diagramType string, source []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/"+diagramType+"/svg", bytes.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kroki: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
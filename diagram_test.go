@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDiagramRendererCache tests rendering, the disk cache and failure handling
+func TestDiagramRendererCache(t *testing.T) {
+	runs := 0
+	diagramTools["test-diagram"] = diagramTool{command: "test-tool", run: func(ctx context.Context, bin string, source []byte) ([]byte, error) {
+		runs++
+		if strings.HasPrefix(string(source), "bad") {
+			return nil, errors.New("syntax error")
+		}
+		return []byte(`<?xml version="1.0"?>` + "\n<svg>" + string(source) + "</svg>\n"), nil
+	}}
+	defer delete(diagramTools, "test-diagram")
+
+	cacheDir := t.TempDir()
+	newRenderer := func() *diagramRenderer {
+		d := newDiagramRenderer(true, "")
+		d.cacheDir = cacheDir
+		d.lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+		return d
+	}
+
+	d := newRenderer()
+	svg, ok := d.Render("test-diagram", []byte("a"))
+	if !ok || string(svg) != "<svg>a</svg>" {
+		t.Fatalf("Render() = %q, %v, want <svg>a</svg>", svg, ok)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, diagramHash("test-diagram", []byte("a"))+".svg")); err != nil {
+		t.Errorf("diagram not cached: %v", err)
+	}
+
+	// A new renderer (e.g. after a restart) reads the cache instead of running the tool
+	if svg, ok := newRenderer().Render("test-diagram", []byte("a")); !ok || string(svg) != "<svg>a</svg>" || runs != 1 {
+		t.Errorf("cached Render() = %q, %v after %d runs, want 1 run", svg, ok, runs)
+	}
+
+	// Failures fall back to source and are not retried
+	for i := 0; i < 2; i++ {
+		if _, ok := d.Render("test-diagram", []byte("bad")); ok {
+			t.Error("Render() of a broken diagram succeeded")
+		}
+	}
+	if runs != 2 {
+		t.Errorf("tool ran %d times, want 2", runs)
+	}
+
+	if _, ok := d.Render("go", []byte("x := 1")); ok {
+		t.Error("Render() accepted a non-diagram language")
+	}
+
+	// Remembered failures are bounded
+	for i := 0; i < maxFailedDiagrams+10; i++ {
+		d.Render("test-diagram", []byte(fmt.Sprintf("bad %d", i)))
+	}
+	if len(d.failed) > maxFailedDiagrams {
+		t.Errorf("%d failures remembered, want at most %d", len(d.failed), maxFailedDiagrams)
+	}
+}
+
+// TestDiagramRendererKroki tests the Kroki fallback when no local tool is installed
+func TestDiagramRendererKroki(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Path != "/mermaid/svg" || string(body) != "graph TD" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte("<svg>kroki</svg>"))
+	}))
+	defer server.Close()
+
+	missing := func(string) (string, error) { return "", errors.New("not found") }
+
+	d := newDiagramRenderer(true, server.URL+"/")
+	d.cacheDir = ""
+	d.lookPath = missing
+	if svg, ok := d.Render("mermaid", []byte("graph TD")); !ok || string(svg) != "<svg>kroki</svg>" {
+		t.Errorf("Render() = %q, %v, want Kroki's SVG", svg, ok)
+	}
+
+	offline := newDiagramRenderer(true, "")
+	offline.cacheDir = ""
+	offline.lookPath = missing
+	if _, ok := offline.Render("mermaid", []byte("graph TD")); ok {
+		t.Error("Render() succeeded without a tool or Kroki URL")
+	}
+}
+
+// TestDiagramRendererDefaults tests that nothing is rendered, and no tool
+// looked up, without --diagrams
+func TestDiagramRendererDefaults(t *testing.T) {
+	var ran []string
+	d := newDiagramRenderer(false, "http://kroki.invalid")
+	d.cacheDir = ""
+	d.lookPath = func(file string) (string, error) {
+		ran = append(ran, file)
+		return filepath.Join(t.TempDir(), file), nil
+	}
+
+	for _, lang := range []string{"dot", "graphviz", "mermaid", "plantuml"} {
+		if _, ok := d.Render(lang, []byte("digraph { a -> b }")); ok {
+			t.Errorf("Render(%s) succeeded without --diagrams", lang)
+		}
+	}
+	if len(ran) != 0 {
+		t.Errorf("looked up %q, want no tools", ran)
+	}
+}
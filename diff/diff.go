@@ -0,0 +1,181 @@
+// Package diff computes line-based differences between two texts using Myers'
+// algorithm. peekm uses it to show what an AI session changed in a file.
+package diff
+
+import "strings"
+
+// maxEditDistance bounds the Myers search; beyond it the changed region is
+// reported as a full replacement to keep memory use predictable
+const maxEditDistance = 1000
+
+// Op is the kind of change a Line represents
+type Op int
+
+const (
+	Equal  Op = iota // Line present in both texts
+	Insert           // Line only in the new text
+	Delete           // Line only in the old text
+)
+
+// String returns "equal", "insert" or "delete"
+func (op Op) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	default:
+		return "equal"
+	}
+}
+
+// MarshalText encodes an Op as its name in JSON
+func (op Op) MarshalText() ([]byte, error) {
+	return []byte(op.String()), nil
+}
+
+// Line is one line of a diff, without its trailing newline
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the line diff turning oldText into newText
+func Lines(oldText, newText string) []Line {
+	a, b := splitLines(oldText), splitLines(newText)
+
+	// Trim the common prefix and suffix so the search only covers the changed region
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(a)+len(b)-prefix-suffix)
+	for _, text := range a[:prefix] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+	lines = append(lines, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+	return lines
+}
+
+// Stats counts the inserted and deleted lines of a diff
+func Stats(lines []Line) (added, removed int) {
+	for _, l := range lines {
+		switch l.Op {
+		case Insert:
+			added++
+		case Delete:
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// splitLines splits text on newlines, ignoring a final trailing newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// myers computes the shortest edit script between a and b
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(a, b)
+	}
+
+	limit := n + m
+	if limit > maxEditDistance {
+		limit = maxEditDistance
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k; trace[d] keeps the
+	// window k in [-d-1, d+1] as it was before step d, for backtracking
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return replace(a, b)
+}
+
+// backtrack walks the saved Myers trace from the end to recover the edit script
+func backtrack(a, b []string, trace [][]int) []Line {
+	x, y := len(a), len(b)
+	var reversed []Line
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		window := trace[d]
+		at := func(k int) int { return window[k+d+1] }
+
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Line{Op: Equal, Text: a[x-1]})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			reversed = append(reversed, Line{Op: Insert, Text: b[y-1]})
+		} else {
+			reversed = append(reversed, Line{Op: Delete, Text: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+
+	lines := make([]Line, len(reversed))
+	for i, l := range reversed {
+		lines[len(reversed)-1-i] = l
+	}
+	return lines
+}
+
+// replace reports every line of a as deleted and every line of b as inserted
+func replace(a, b []string) []Line {
+	lines := make([]Line, 0, len(a)+len(b))
+	for _, text := range a {
+		lines = append(lines, Line{Op: Delete, Text: text})
+	}
+	for _, text := range b {
+		lines = append(lines, Line{Op: Insert, Text: text})
+	}
+	return lines
+}
@@ -0,0 +1,88 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// format renders a diff as "+line", "-line" and " line" entries
+func format(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		switch l.Op {
+		case Insert:
+			b.WriteString("+")
+		case Delete:
+			b.WriteString("-")
+		default:
+			b.WriteString(" ")
+		}
+		b.WriteString(l.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", " a\n b\n"},
+		{"empty to text", "", "a\nb", "+a\n+b\n"},
+		{"text to empty", "a\n", "", "-a\n"},
+		{"insert middle", "a\nc\n", "a\nb\nc\n", " a\n+b\n c\n"},
+		{"delete middle", "a\nb\nc\n", "a\nc\n", " a\n-b\n c\n"},
+		{"replace line", "# Title\nold\nend\n", "# Title\nnew\nend\n", " # Title\n-old\n+new\n end\n"},
+		{"interleaved", "a\nb\nc\nd\n", "b\nx\nd\ny\n", "-a\n b\n-c\n+x\n d\n+y\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.old, tt.new)
+			if format(got) != tt.want {
+				t.Errorf("Lines() =\n%s\nwant\n%s", format(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesReconstructs(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 300; i++ {
+		oldLines = append(oldLines, fmt.Sprintf("line %d", i%7))
+		newLines = append(newLines, fmt.Sprintf("line %d", i%5))
+	}
+	oldText, newText := strings.Join(oldLines, "\n"), strings.Join(newLines, "\n")
+
+	var gotOld, gotNew []string
+	for _, l := range Lines(oldText, newText) {
+		if l.Op != Insert {
+			gotOld = append(gotOld, l.Text)
+		}
+		if l.Op != Delete {
+			gotNew = append(gotNew, l.Text)
+		}
+	}
+	if strings.Join(gotOld, "\n") != oldText || strings.Join(gotNew, "\n") != newText {
+		t.Error("diff does not reconstruct both inputs")
+	}
+}
+
+func TestStatsAndJSON(t *testing.T) {
+	lines := Lines("a\nb\n", "a\nc\nd\n")
+	if added, removed := Stats(lines); added != 2 || removed != 1 {
+		t.Errorf("Stats() = +%d -%d, want +2 -1", added, removed)
+	}
+
+	data, err := json.Marshal(lines[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"op":"delete","text":"b"}` {
+		t.Errorf("json = %s", data)
+	}
+}
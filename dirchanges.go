@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+)
+
+// handleDirectoryRemoved removes the markdown files of a deleted directory
+// still whitelisted (the watcher may report only the directory) and notifies
+// clients
+func handleDirectoryRemoved(dir string) {
+	files := whitelistedUnder(dir)
+	if len(files) == 0 {
+		return
+	}
+	log.Printf("Deleted directory: %s (%d markdown file(s))", dir, len(files))
+	for _, file := range files {
+		handleMarkdownRemoved(file, "Deleted")
+		textIndex.remove(file)
+	}
+	refreshFileWatches()
+}
+
+// handleDirectoryRenamed treats the markdown files of a directory renamed
+// away as renamed away one by one: files of the directory it became (walked
+// by walkNewDirectory) claim them as renames, the rest are removed
+func handleDirectoryRenamed(dir string, removed func(path string)) {
+	files := whitelistedUnder(dir)
+	if len(files) == 0 {
+		return
+	}
+	log.Printf("Renamed directory: %s (%d markdown file(s))", dir, len(files))
+	for _, file := range files {
+		renames.renamedAway(file, func(path string) {
+			removed(path)
+			refreshFileWatches()
+		})
+	}
+}
+
+// walkNewDirectory calls created for every file in a directory created in or
+// moved into the browsed tree, whose files arrive without events of their own
+func walkNewDirectory(dir string, skipDir func(path string) bool, created func(path string)) {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable: skip it
+		}
+		if d.IsDir() {
+			if path != dir && skipDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		created(path)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Cannot walk new directory %s: %v", dir, err)
+	}
+}
+
+// whitelistedUnder returns the whitelisted files inside dir, at any depth
+func whitelistedUnder(dir string) []string {
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+	return markdownFiles.under(dir)
+}
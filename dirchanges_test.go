@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// useDirChangeGlobals points the whitelist and SSE clients at dir for a test
+func useDirChangeGlobals(t *testing.T, dir string, files []string) *sseClient {
+	prevDir, prevFiles, prevTabs := browseDir, markdownFiles, globalTabStore
+	prevClients, prevEvents, prevNoWatch := clients, globalEventBuffer, *noWatch
+	t.Cleanup(func() {
+		browseDir, markdownFiles, globalTabStore = prevDir, prevFiles, prevTabs
+		clients, globalEventBuffer, *noWatch = prevClients, prevEvents, prevNoWatch
+	})
+	browseDir, markdownFiles, globalTabStore, *noWatch = dir, newFileSet(files), newTabStore(), true
+	clients, globalEventBuffer = make(map[uint64]*sseClient), newEventBuffer(50)
+	client, _ := registerClient(httptest.NewRequest("GET", "/events", nil))
+	return client
+}
+
+// receivedEvents returns the types and paths of the events client got
+func receivedEvents(client *sseClient) []string {
+	var events []string
+	for len(client.ch) > 0 {
+		msg := <-client.ch
+		var fields struct{ Type, Path string }
+		json.Unmarshal([]byte(msg[strings.Index(msg, "data: ")+len("data: "):]), &fields)
+		events = append(events, fields.Type+" "+filepath.ToSlash(fields.Path))
+	}
+	slices.Sort(events)
+	return events
+}
+
+func TestDirectoryRemoved(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "docs", "a.md"), filepath.Join(dir, "docs", "api", "b.md"), filepath.Join(dir, "docs2.md")}
+	client := useDirChangeGlobals(t, dir, files)
+
+	browseDirHandlers(dir).Removed(filepath.Join(dir, "docs"))
+
+	if got := markdownFiles.list(); !reflect.DeepEqual(got, files[2:]) {
+		t.Errorf("whitelist = %q, want only %q", got, files[2])
+	}
+	if got, want := receivedEvents(client), []string{"file_removed docs/a.md", "file_removed docs/api/b.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestDirectoryMoved(t *testing.T) {
+	dir := t.TempDir()
+	oldFiles := []string{filepath.Join(dir, "drafts", "a.md"), filepath.Join(dir, "drafts", "sub", "b.md")}
+	client := useDirChangeGlobals(t, dir, oldFiles)
+	for _, name := range []string{"a.md", filepath.Join("sub", "b.md"), "notes.txt"} {
+		path := filepath.Join(dir, "archive", name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("# "+name+"\n"), 0644)
+	}
+
+	// mv drafts archive: the watcher reports the directories only
+	handlers := browseDirHandlers(dir)
+	handlers.Renamed(filepath.Join(dir, "drafts"))
+	handlers.Created(filepath.Join(dir, "archive"))
+
+	want := []string{filepath.Join(dir, "archive", "a.md"), filepath.Join(dir, "archive", "sub", "b.md")}
+	if got := markdownFiles.list(); !reflect.DeepEqual(got, want) {
+		t.Errorf("whitelist = %q, want %q", got, want)
+	}
+	if got, want := receivedEvents(client), []string{"file_renamed archive/a.md", "file_renamed archive/sub/b.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/razvandimescu/peekm/safepath"
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// Bounds of the markdown counts /api/browse-dirs reports for each directory
+const (
+	browseDirsDepth = 8    // Directory levels counted below each child
+	browseDirsLimit = 1000 // Counts stop here
+)
+
+// browseDirEntry is a child directory listed by /api/browse-dirs
+type browseDirEntry struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Markdown int    `json:"markdown"`          // Markdown files in its subtree (0: /navigate would refuse it)
+	Partial  bool   `json:"partial,omitempty"` // Counting stopped at a bound: Markdown is a lower bound
+}
+
+// apiBrowseDirsResponse is the /api/browse-dirs response
+type apiBrowseDirsResponse struct {
+	Path   string           `json:"path"`
+	Parent string           `json:"parent,omitempty"` // "" at $HOME
+	Dirs   []browseDirEntry `json:"dirs"`
+}
+
+// serveAPIBrowseDirs lists the child directories of ?path= (default: the
+// browsed directory) with their markdown counts, for the directory picker
+func serveAPIBrowseDirs(w http.ResponseWriter, r *http.Request) {
+	fileMutex.RLock()
+	currentBrowseDir := browseDir
+	fileMutex.RUnlock()
+
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		path = currentBrowseDir
+	}
+	validated, err := safepath.Resolve(path)
+	if err != nil {
+		writeError(w, pathErrorCode(err), "Invalid path", http.StatusForbidden)
+		return
+	}
+	entries, err := os.ReadDir(validated)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Path must be a readable directory", http.StatusBadRequest)
+		return
+	}
+
+	// The browsed directory's patterns (already cached) apply everywhere
+	customPatterns := getIgnorePatterns(currentBrowseDir)
+	resp := apiBrowseDirsResponse{
+		Path:   validated,
+		Parent: parentDir(validated),
+		Dirs:   []browseDirEntry{},
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || tree.IsExcludedDir(entry.Name(), customPatterns) {
+			continue
+		}
+		child := filepath.Join(validated, entry.Name())
+		count, complete := countMarkdown(child, browseDirsDepth, browseDirsLimit, customPatterns)
+		resp.Dirs = append(resp.Dirs, browseDirEntry{Name: entry.Name(), Path: child, Markdown: count, Partial: !complete})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
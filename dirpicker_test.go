@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestServeAPIBrowseDirs(t *testing.T) {
+	root := newBreadcrumbsTestDir(t)
+	homeDir, _ := os.UserHomeDir()
+
+	prevDir := browseDir
+	browseDir = filepath.Join(root, "docs")
+	defer func() {
+		browseDir = prevDir
+		globalIgnoreCache.mu.Lock()
+		globalIgnoreCache.rootDir = ""
+		globalIgnoreCache.mu.Unlock()
+	}()
+
+	rec := httptest.NewRecorder()
+	serveAPIBrowseDirs(rec, httptest.NewRequest("GET", "/api/browse-dirs?path="+url.QueryEscape(root), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%s)", rec.Code, rec.Body.String())
+	}
+	var resp apiBrowseDirsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := apiBrowseDirsResponse{
+		Path:   root,
+		Parent: homeDir,
+		Dirs: []browseDirEntry{
+			{Name: "deep", Path: filepath.Join(root, "deep"), Markdown: 1},
+			{Name: "docs", Path: filepath.Join(root, "docs"), Markdown: 2},
+			{Name: "empty", Path: filepath.Join(root, "empty")},
+			{Name: "notes", Path: filepath.Join(root, "notes"), Markdown: 1},
+		},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("/api/browse-dirs = %+v, want %+v", resp, want)
+	}
+
+	for _, tt := range []struct {
+		path string
+		want int
+	}{
+		{filepath.Join(root, "docs", "README.md"), http.StatusBadRequest},
+		{filepath.Join(root, "missing"), http.StatusForbidden},
+		{string(filepath.Separator), http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		serveAPIBrowseDirs(rec, httptest.NewRequest("GET", "/api/browse-dirs?path="+url.QueryEscape(tt.path), nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestCountMarkdownBounds(t *testing.T) {
+	root := newBreadcrumbsTestDir(t)
+
+	tests := []struct {
+		dir          string
+		depth, limit int
+		wantCount    int
+		wantComplete bool
+	}{
+		{"docs", 8, 100, 2, true},
+		{"docs", 8, 1, 1, false},   // Stopped at the limit
+		{"docs", 0, 100, 1, false}, // guide/ left out
+		{"empty", 8, 100, 0, true},
+		{"node_modules", 8, 100, 1, true}, // Exclusions apply below, not to the directory counted
+	}
+	for _, tt := range tests {
+		count, complete := countMarkdown(filepath.Join(root, tt.dir), tt.depth, tt.limit, nil)
+		if count != tt.wantCount || complete != tt.wantComplete {
+			t.Errorf("countMarkdown(%s, %d, %d) = %d, %v; want %d, %v", tt.dir, tt.depth, tt.limit, count, complete, tt.wantCount, tt.wantComplete)
+		}
+	}
+}
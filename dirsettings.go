@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// errReadOnly is returned for changes to a subtree a .peekm.toml marks
+// read-only
+var errReadOnly = errors.New("read-only")
+
+// globalSettingsCache holds the .peekm.toml settings and .gitignore rules
+// found by the walk of the browsed directory (read again when peekm
+// navigates elsewhere)
+var globalSettingsCache struct {
+	settings  tree.DirSettings
+	gitignore *tree.Gitignore // nil without --respect-gitignore
+	mu        sync.RWMutex
+}
+
+// cacheDirSettings replaces the cached .peekm.toml settings and .gitignore rules
+func cacheDirSettings(settings tree.DirSettings, gitignore *tree.Gitignore) {
+	globalSettingsCache.mu.Lock()
+	defer globalSettingsCache.mu.Unlock()
+	globalSettingsCache.settings = settings
+	globalSettingsCache.gitignore = gitignore
+}
+
+// isGitignored reports whether --respect-gitignore hides path (a directory
+// when isDir)
+func isGitignored(path string, isDir bool) bool {
+	globalSettingsCache.mu.RLock()
+	defer globalSettingsCache.mu.RUnlock()
+	return globalSettingsCache.gitignore.Ignored(path, isDir)
+}
+
+// settingsFor returns the .peekm.toml settings that apply to path
+func settingsFor(path string) tree.Settings {
+	globalSettingsCache.mu.RLock()
+	defer globalSettingsCache.mu.RUnlock()
+	return globalSettingsCache.settings.For(path)
+}
+
+// checkWritable returns an error wrapping errReadOnly when path is in a
+// subtree marked readonly
+func checkWritable(path string) error {
+	if s := settingsFor(path); s.ReadOnly {
+		return fmt.Errorf("%s is %w (readonly = true in %s)", filepath.Base(path), errReadOnly, s.File)
+	}
+	return nil
+}
+
+// configuredDefaultFile returns the file the .peekm.toml of dir names as its
+// default, if it is one peekm serves
+func configuredDefaultFile(dir string) string {
+	s := settingsFor(dir)
+	if s.Default != "" && filepath.Dir(s.File) == dir && isWhitelistedFile(s.Default) {
+		return s.Default
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/razvandimescu/peekm/tree"
+)
+
+func TestReadOnlySubtree(t *testing.T) {
+	dir := serveTestFiles(t, "dirsettings", map[string]string{
+		"locked/spec.md": "# Doc\n",
+		"open.md":        "# Doc\n",
+	})
+	locked := filepath.Join(dir, "locked")
+	lockedFile := filepath.Join(locked, "spec.md")
+
+	prevNoWatch := *noWatch
+	*noWatch = true
+	cacheDirSettings(tree.DirSettings{
+		locked: {File: filepath.Join(locked, tree.SettingsFileName), ReadOnly: true, Extensions: []string{".md", ".mdx"}},
+	}, nil)
+	defer func() {
+		*noWatch = prevNoWatch
+		cacheDirSettings(nil, nil)
+	}()
+
+	save := func(relPath string) int {
+		form := url.Values{"file": {relPath}, "content": {"# Changed\n"}}
+		req := httptest.NewRequest("POST", "/save", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handleSave(rec, req)
+		return rec.Code
+	}
+	if code := save("open.md"); code != http.StatusOK {
+		t.Errorf("save outside the read-only subtree: status = %d, want 200", code)
+	}
+	if code := save("locked/spec.md"); code != http.StatusForbidden {
+		t.Errorf("save in the read-only subtree: status = %d, want 403", code)
+	}
+	if data, _ := os.ReadFile(lockedFile); string(data) != "# Doc\n" {
+		t.Errorf("read-only file was changed: %q", data)
+	}
+
+	if _, err := createMarkdownFile("locked/new.md", nil); err == nil {
+		t.Error("created a file in the read-only subtree")
+	}
+	if _, err := createDirectory("locked/sub"); err == nil {
+		t.Error("created a directory in the read-only subtree")
+	}
+	if _, err := createMarkdownFile("new.md", nil); err != nil {
+		t.Errorf("creating a file outside the read-only subtree: %v", err)
+	}
+
+	if !isMarkdownPath(filepath.Join(locked, "page.mdx")) || isMarkdownPath(filepath.Join(dir, "page.mdx")) {
+		t.Error("extensions do not follow the subtree's .peekm.toml")
+	}
+}
+
+func TestConfiguredDefaultFile(t *testing.T) {
+	dir := t.TempDir()
+	overview := filepath.Join(dir, "OVERVIEW.md")
+
+	prevFiles := markdownFiles
+	markdownFiles = newFileSet([]string{filepath.Join(dir, "README.md"), overview})
+	defer func() {
+		markdownFiles = prevFiles
+		cacheDirSettings(nil, nil)
+	}()
+
+	cacheDirSettings(tree.DirSettings{dir: {File: filepath.Join(dir, tree.SettingsFileName), Default: overview}}, nil)
+	if got := configuredDefaultFile(dir); got != overview {
+		t.Errorf("configuredDefaultFile() = %q, want %q", got, overview)
+	}
+	if got := configuredDefaultFile(filepath.Join(dir, "sub")); got != "" {
+		t.Errorf("a subdirectory used its parent's default: %q", got)
+	}
+
+	cacheDirSettings(tree.DirSettings{dir: {File: filepath.Join(dir, tree.SettingsFileName), Default: filepath.Join(dir, "missing.md")}}, nil)
+	if got := configuredDefaultFile(dir); got != "" {
+		t.Errorf("configuredDefaultFile() = %q for a file peekm does not serve", got)
+	}
+}
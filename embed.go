@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// embedFrameAncestors lets local pages (dashboards on any localhost port) frame
+// the embed view
+const embedFrameAncestors = "frame-ancestors 'self' http://localhost:* http://127.0.0.1:* http://[::1]:*"
+
+// embedTmpl renders /view/FILE?embed=1 without the sidebar, toolbar or navigation
+var embedTmpl *template.Template
+
+// embedTemplateData is used for rendering the embed view
+type embedTemplateData struct {
+	baseTemplateData
+	Title   string
+	Content template.HTML
+	Path    string // Absolute path, matched against file_modified events
+	RelPath string // Path relative to the browse directory
+}
+
+// isEmbedRequest reports whether a view asks for the chrome-free embed variant
+func isEmbedRequest(r *http.Request) bool {
+	return r.URL.Query().Get("embed") == "1"
+}
+
+// renderEmbed writes the embed view with frame headers that allow localhost parents
+func renderEmbed(w http.ResponseWriter, data embedTemplateData) {
+	var buf bytes.Buffer
+	if err := embedTmpl.Execute(&buf, data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		writeError(w, errCodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", embedFrameAncestors)
+	buf.WriteTo(w)
+}
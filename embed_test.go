@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestServeFileEmbed tests that ?embed=1 renders the document without chrome
+func TestServeFileEmbed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.md")
+	if err := os.WriteFile(path, []byte("# Status\n\nAll good.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prevDir, prevFiles, prevNoWatch := browseDir, markdownFiles, *noWatch
+	browseDir, markdownFiles, *noWatch = dir, newFileSet([]string{path}), true
+	defer func() { browseDir, markdownFiles, *noWatch = prevDir, prevFiles, prevNoWatch }()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantCSP    bool
+		wantChrome bool
+	}{
+		{name: "embed", url: "/view/notes.md?embed=1", wantCSP: true, wantChrome: false},
+		{name: "full page", url: "/view/notes.md", wantCSP: false, wantChrome: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, `<h1 id="status">Status</h1>`) {
+				t.Errorf("body missing rendered heading:\n%s", body)
+			}
+			if got := strings.Contains(body, "<aside"); got != tt.wantChrome {
+				t.Errorf("sidebar present = %v, want %v", got, tt.wantChrome)
+			}
+			csp := rec.Header().Get("Content-Security-Policy")
+			if (csp == embedFrameAncestors) != tt.wantCSP {
+				t.Errorf("Content-Security-Policy = %q", csp)
+			}
+		})
+	}
+}
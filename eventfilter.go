@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// eventFilter limits the events an SSE client receives
+// (?file=<path>, ?dir=<path> and/or ?session=<id> on /events). Events about
+// no file or session, such as connection_status, always pass.
+type eventFilter struct {
+	File    string // Only events about this file, relative with forward slashes
+	Dir     string // Only events about files under this directory, likewise
+	Session string // Only events of this AI session
+}
+
+// eventScope is what an event is about, for matching against filters
+type eventScope struct {
+	Path    string // Relative with forward slashes, "" if none
+	OldPath string // Previous path of a renamed file, likewise
+	Session string
+}
+
+// parseEventFilter reads the filter of an /events request
+func parseEventFilter(r *http.Request) eventFilter {
+	q := r.URL.Query()
+	return eventFilter{
+		File:    cleanEventPath(q.Get("file")),
+		Dir:     cleanEventPath(q.Get("dir")),
+		Session: q.Get("session"),
+	}
+}
+
+// cleanEventPath normalizes a filter path to the form of event paths
+func cleanEventPath(p string) string {
+	if p == "" {
+		return ""
+	}
+	p = path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "/"))
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// active reports whether the filter drops any events
+func (f eventFilter) active() bool {
+	return f.File != "" || f.Dir != "" || f.Session != ""
+}
+
+// String returns the filter as a query string, "" if inactive
+func (f eventFilter) String() string {
+	q := url.Values{}
+	for key, value := range map[string]string{"file": f.File, "dir": f.Dir, "session": f.Session} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	return q.Encode()
+}
+
+// matches reports whether an event about scope passes the filter
+func (f eventFilter) matches(scope eventScope) bool {
+	if scope.Path == "" && scope.Session == "" {
+		return true
+	}
+	if !f.matchesPath(scope.Path) && (scope.OldPath == "" || !f.matchesPath(scope.OldPath)) {
+		return false
+	}
+	return f.Session == "" || scope.Session == f.Session
+}
+
+// matchesPath reports whether p passes the file and directory filters
+func (f eventFilter) matchesPath(p string) bool {
+	if f.File != "" && p != f.File {
+		return false
+	}
+	return f.Dir == "" || strings.HasPrefix(p, f.Dir+"/")
+}
+
+// eventScopeOf returns what an SSE message is about. Plain-text messages
+// such as "reload" are about nothing in particular.
+func eventScopeOf(message string) eventScope {
+	var fields struct {
+		Path    string `json:"path"`
+		OldPath string `json:"old_path"`
+		Session string `json:"session"`
+	}
+	if err := json.Unmarshal([]byte(message), &fields); err != nil {
+		return eventScope{}
+	}
+	return eventScope{Path: scopePath(fields.Path), OldPath: scopePath(fields.OldPath), Session: fields.Session}
+}
+
+// scopePath returns an event path relative with forward slashes
+func scopePath(p string) string {
+	if filepath.IsAbs(p) {
+		p = getRelativePath(p)
+	}
+	return cleanEventPath(p)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// TestEventFilter tests which events scoped SSE subscriptions receive
+func TestEventFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		event string
+		want  bool
+	}{
+		{"", `{"type":"file_added","path":"docs/a.md"}`, true},
+		{"file=docs/a.md", `{"type":"file_modified","path":"docs/a.md"}`, true},
+		{"file=/docs/./a.md", `{"type":"file_modified","path":"docs/a.md"}`, true},
+		{"file=docs/a.md", `{"type":"file_added","path":"docs/b.md"}`, false},
+		{"dir=docs", `{"type":"file_added","path":"docs/api/b.md"}`, true},
+		{"dir=docs/", `{"type":"file_added","path":"docsite/b.md"}`, false},
+		{"session=s1", `{"type":"file_added","path":"a.md","session":"s1"}`, true},
+		{"session=s1", `{"type":"file_added","path":"a.md"}`, false},
+		{"session=s1", `{"type":"session_finished","session":"s2"}`, false},
+		{"dir=docs&session=s1", `{"type":"session_started","session":"s1"}`, false}, // Not about a file under docs
+		{"file=docs/a.md", `{"type":"file_renamed","path":"docs/c.md","old_path":"docs/a.md"}`, true},
+		{"file=docs/a.md", `{"type":"connection_status","count":2}`, true},
+		{"file=docs/a.md", "reload", true},
+	}
+	for _, tt := range tests {
+		filter := parseEventFilter(httptest.NewRequest("GET", "/events?"+tt.query, nil))
+		if got := filter.matches(eventScopeOf(tt.event)); got != tt.want {
+			t.Errorf("?%s matches %s = %v, want %v", tt.query, tt.event, got, tt.want)
+		}
+	}
+}
+
+// TestScopedNotify tests that events reach only the clients subscribed to them
+func TestScopedNotify(t *testing.T) {
+	dir := t.TempDir()
+	prevDir, prevClients, prevEvents := browseDir, clients, globalEventBuffer
+	defer func() { browseDir, clients, globalEventBuffer = prevDir, prevClients, prevEvents }()
+	browseDir, clients, globalEventBuffer = dir, make(map[uint64]*sseClient), newEventBuffer(50)
+
+	all, _ := registerClient(httptest.NewRequest("GET", "/events", nil))
+	scoped, _ := registerClient(httptest.NewRequest("GET", "/events?file=notes/a.md", nil))
+
+	// Watcher events carry absolute paths
+	notifyFileModified(filepath.Join(dir, "notes", "a.md"))
+	sendFileEvent("file_added", filepath.Join("notes", "b.md"), "")
+
+	if len(all.ch) != 2 {
+		t.Errorf("unfiltered client got %d events, want 2", len(all.ch))
+	}
+	if len(scoped.ch) != 1 {
+		t.Fatalf("scoped client got %d events, want 1", len(scoped.ch))
+	}
+	if got, want := <-scoped.ch, `id: 1`+"\n"+`data: {"type":"file_modified","path":"`+filepath.Join(dir, "notes", "a.md")+`","view":"notes/a.md"}`; got != want {
+		t.Errorf("scoped client got %q, want %q", got, want)
+	}
+
+	// Replay skips the events outside the filter too (event 2 is notes/b.md)
+	rec := httptest.NewRecorder()
+	if err := replayMissedEvents(rec, httptest.NewRequest("GET", "/events?file=notes/a.md&last_event_id=1", nil), scoped); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("replay sent %q, want nothing", rec.Body.String())
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxEventLogLine is the longest --event-log line read back; longer ones are skipped
+const maxEventLogLine = 1 << 20
+
+// eventLogRecord is one line of the --event-log file
+type eventLogRecord struct {
+	ID   string `json:"id"`
+	Data string `json:"data"`
+}
+
+// setupEventBuffer sizes the SSE replay buffer and opens --event-log
+func setupEventBuffer() {
+	globalEventBuffer = newEventBuffer(*replaySize)
+	if *eventLog == "" {
+		return
+	}
+	if err := globalEventBuffer.openLog(*eventLog); err != nil {
+		log.Printf("Warning: Cannot use event log %s: %v", *eventLog, err)
+	}
+}
+
+// openLog loads the events saved at path, so replay and event IDs continue
+// across restarts, and appends new events to it. The file is first rewritten
+// with only the events that fit in the buffer, so it does not grow forever.
+func (eb *eventBuffer) openLog(path string) error {
+	events, err := readEventLog(path)
+	if err != nil {
+		return err
+	}
+
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	events = append(events, eb.events...)
+	if len(events) > eb.maxSize {
+		events = events[len(events)-eb.maxSize:]
+	}
+	eb.events = events
+	for _, evt := range events {
+		if n, err := strconv.ParseUint(evt.id, 10, 64); err == nil && n > eb.counter {
+			eb.counter = n
+		}
+	}
+
+	var content strings.Builder
+	for _, evt := range events {
+		line, _ := json.Marshal(eventLogRecord{ID: evt.id, Data: evt.data})
+		content.Write(append(line, '\n'))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := atomicWriteFile(path, content.String()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	eb.logFile = f
+	log.Printf("Event log %s: %d event(s) restored", path, len(events))
+	return nil
+}
+
+// readEventLog returns the events saved at path, oldest first. A missing file
+// has none, and unreadable lines (such as one cut short by a crash) are skipped.
+func readEventLog(path string) ([]eventRecord, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []eventRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxEventLogLine)
+	for scanner.Scan() {
+		var rec eventLogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.ID == "" {
+			continue
+		}
+		events = append(events, eventRecord{id: rec.ID, data: rec.Data})
+	}
+	return events, scanner.Err()
+}
+
+// appendToLog writes evt to the event log, if one is open. The caller holds
+// eb.mu. After a write error the log is closed rather than failing every event.
+func (eb *eventBuffer) appendToLog(evt eventRecord) {
+	if eb.logFile == nil {
+		return
+	}
+	line, _ := json.Marshal(eventLogRecord{ID: evt.id, Data: evt.data})
+	if _, err := eb.logFile.Write(append(line, '\n')); err != nil {
+		log.Printf("Warning: Cannot write event log, no longer saving events: %v", err)
+		eb.logFile.Close()
+		eb.logFile = nil
+	}
+}
+
+// closeLog closes the event log, if one is open
+func (eb *eventBuffer) closeLog() {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.logFile != nil {
+		eb.logFile.Close()
+		eb.logFile = nil
+	}
+}
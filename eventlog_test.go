@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func eventIDs(events []eventRecord) []string {
+	var ids []string
+	for _, evt := range events {
+		ids = append(ids, evt.id)
+	}
+	return ids
+}
+
+func TestEventBufferGetAfter(t *testing.T) {
+	eb := newEventBuffer(3)
+	for _, data := range []string{"a", "b", "c", "d"} {
+		eb.add(data)
+	}
+	tests := []struct {
+		lastID    string
+		wantIDs   []string
+		wantFound bool
+	}{
+		{"2", []string{"3", "4"}, true},
+		{"4", nil, true},
+		{"1", nil, false}, // Dropped from the buffer
+		{"9", nil, false}, // From another server run
+		{"", nil, false},  // The first events were dropped
+	}
+	for _, tt := range tests {
+		events, found := eb.getAfter(tt.lastID)
+		if got := eventIDs(events); !reflect.DeepEqual(got, tt.wantIDs) || found != tt.wantFound {
+			t.Errorf("getAfter(%q) = %q, %v; want %q, %v", tt.lastID, got, found, tt.wantIDs, tt.wantFound)
+		}
+	}
+	if got := eb.lastID(); got != "4" {
+		t.Errorf("lastID() = %q, want \"4\"", got)
+	}
+	if events, found := newEventBuffer(2).getAfter(""); len(events) != 0 || !found {
+		t.Errorf("getAfter(\"\") of an empty buffer = %q, %v; want none, true", eventIDs(events), found)
+	}
+	if got := newEventBuffer(0).add("x"); got != "1" {
+		t.Errorf("zero-size buffer add() = %q, want \"1\"", got)
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "events.jsonl")
+
+	eb := newEventBuffer(3)
+	if err := eb.openLog(path); err != nil {
+		t.Fatalf("openLog() new file: %v", err)
+	}
+	for _, data := range []string{`{"type":"file_added","path":"a.md"}`, "b", "c", "d"} {
+		eb.add(data)
+	}
+	eb.closeLog()
+
+	// Append a line cut short by a crash
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"5","da`)
+	f.Close()
+
+	restored := newEventBuffer(2)
+	if err := restored.openLog(path); err != nil {
+		t.Fatalf("openLog() existing file: %v", err)
+	}
+	defer restored.closeLog()
+	if got := eventIDs(restored.events); !reflect.DeepEqual(got, []string{"3", "4"}) {
+		t.Errorf("restored events = %q, want the last 2", got)
+	}
+	if id := restored.add("e"); id != "5" {
+		t.Errorf("add() after restore = %q, want IDs to continue at 5", id)
+	}
+
+	events, err := readEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventIDs(events); !reflect.DeepEqual(got, []string{"3", "4", "5"}) {
+		t.Errorf("log holds %q, want it compacted to the buffer plus new events", got)
+	}
+}
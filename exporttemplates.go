@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/razvandimescu/peekm/frontmatter"
+)
+
+// defaultExportTemplate is the export template used when none is named
+const defaultExportTemplate = "default"
+
+// downloadTmpl is /download's built-in page: the rendered file with the light
+// GitHub stylesheet inlined
+var downloadTmpl = template.Must(template.New("download").Parse(`<!DOCTYPE html>
+<html lang="en" data-color-mode="light" data-light-theme="light">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.FileName}}</title>
+    <style>
+{{.CSS}}
+    </style>
+</head>
+<body class="markdown-body">
+    <div class="container" style="max-width: 980px; margin: 0 auto; padding: 45px;">
+{{.Content}}
+    </div>
+</body>
+</html>`))
+
+// exportPage is what export templates are executed with
+type exportPage struct {
+	Title    string         // Front matter title, or the file name without extension
+	FileName string         // Base name of the file ("" for stdin)
+	Path     string         // Relative to the browsed directory, slash-separated
+	Content  template.HTML  // The rendered markdown
+	CSS      template.CSS   // peekm's GitHub markdown stylesheet
+	Theme    template.CSS   // peekm's theme overrides (dark mode, callouts, diagrams)
+	Meta     map[string]any // Front matter (empty without one)
+	Date     string         // Day of the export, 2006-01-02
+	Author   string         // $PEEKM_AUTHOR or the current user's name
+}
+
+// newExportPage describes a rendered markdown file to export templates
+func newExportPage(path, relPath string, source []byte, rendered string) exportPage {
+	page := exportPage{
+		Path:    filepath.ToSlash(relPath),
+		Content: template.HTML(rendered),
+		CSS:     template.CSS(githubCSS),
+		Theme:   template.CSS(themeOverrides),
+		Meta:    map[string]any{},
+		Date:    time.Now().Format("2006-01-02"),
+		Author:  templateAuthor(),
+	}
+	if path != "" && path != "-" {
+		page.FileName = filepath.Base(path)
+		page.Title = strings.TrimSuffix(page.FileName, filepath.Ext(page.FileName))
+	}
+	if yamlText, _, found := frontmatter.Split(string(source)); found {
+		if meta, err := frontmatter.Parse(yamlText); err == nil && meta != nil {
+			page.Meta = meta
+		}
+	}
+	if title, ok := page.Meta["title"].(string); ok && title != "" {
+		page.Title = title
+	}
+	return page
+}
+
+// exportTemplateDirs returns the directories holding export templates,
+// project templates (.peekm/export in the browsed directory, or the current
+// one for peekm render) first so they override the user's (export in peekm's
+// config directory)
+func exportTemplateDirs() []string {
+	dirs := []string{filepath.Join(resolveFilePath("."), ".peekm", "export")}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(configDir, "peekm", "export"))
+	}
+	return dirs
+}
+
+// loadExportTemplate parses the export template called name (<name>.html in
+// an export template directory). An empty name means default.html, and
+// returns nil without an error when there is none, for the built-in page.
+func loadExportTemplate(name string) (*template.Template, error) {
+	optional := name == ""
+	if optional {
+		name = defaultExportTemplate
+	}
+	name = strings.TrimSuffix(name, ".html")
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid export template name %q: %w", name, os.ErrInvalid)
+	}
+
+	for _, dir := range exportTemplateDirs() {
+		path := filepath.Join(dir, name+".html")
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(name).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("export template %s: %w", path, err)
+		}
+		return tmpl, nil
+	}
+	if optional {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("export template %q not found: %w", name, os.ErrNotExist)
+}
+
+// executeExportPage executes the export template called name (see
+// loadExportTemplate) for page, or builtin when no template applies
+func executeExportPage(name string, builtin *template.Template, page exportPage) ([]byte, error) {
+	tmpl, err := loadExportTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil {
+		tmpl = builtin
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, page); err != nil {
+		return nil, fmt.Errorf("export template %s: %w", tmpl.Name(), err)
+	}
+	return buf.Bytes(), nil
+}
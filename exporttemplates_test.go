@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeExportTemplate writes <name>.html into an export template directory
+func writeExportTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".html"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadExportTemplate(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	project := t.TempDir()
+	prevDir := browseDir
+	browseDir = project
+	defer func() { browseDir = prevDir }()
+
+	if tmpl, err := loadExportTemplate(""); tmpl != nil || err != nil {
+		t.Errorf("no default.html: got %v, %v; want the built-in page", tmpl, err)
+	}
+	if _, err := loadExportTemplate("memo"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing template: error %v, want not found", err)
+	}
+	for _, name := range []string{"../memo", ".hidden"} {
+		if _, err := loadExportTemplate(name); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("%q: error %v, want invalid", name, err)
+		}
+	}
+
+	userDir := filepath.Join(configDir, "peekm", "export")
+	writeExportTemplate(t, userDir, "default", "user default")
+	writeExportTemplate(t, userDir, "memo", "user memo")
+	writeExportTemplate(t, filepath.Join(project, ".peekm", "export"), "memo", "project memo")
+	writeExportTemplate(t, userDir, "broken", "{{.Nope")
+
+	for name, want := range map[string]string{"": "user default", "memo": "project memo", "memo.html": "project memo"} {
+		out, err := executeExportPage(name, downloadTmpl, exportPage{})
+		if err != nil || string(out) != want {
+			t.Errorf("executeExportPage(%q) = %q, %v; want %q", name, out, err, want)
+		}
+	}
+	if _, err := loadExportTemplate("broken"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func TestDownloadWithExportTemplate(t *testing.T) {
+	dir := serveTestFiles(t, "export-template", map[string]string{
+		"q3.md": "---\ntitle: Q3 Report\nclient: Acme\n---\n# Results\n",
+	})
+	path := filepath.Join(dir, "q3.md")
+	t.Setenv("PEEKM_AUTHOR", "Ada")
+	writeExportTemplate(t, filepath.Join(dir, ".peekm", "export"), "cover",
+		`<section class="cover"><h1>{{.Title}}</h1><p>{{.Meta.client}} · {{.Author}} · {{.Path}}</p></section>{{.Content}}<style>{{.CSS}}</style>`)
+
+	download := func(target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleDownload(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := download("/download", `{"path": "q3.md", "template": "cover"}`)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), `<section class="cover"><h1>Q3 Report</h1><p>Acme · Ada · q3.md</p></section>`) ||
+		!strings.Contains(rec.Body.String(), `<h1 id="results">Results</h1>`) || !strings.Contains(rec.Body.String(), ".markdown-body") {
+		t.Errorf("with the cover template: status %d, body %.300s", rec.Code, rec.Body.String())
+	}
+
+	// Without a template, the built-in light page
+	rec = download("/download", `{"path": "q3.md"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<title>q3.md</title>`) || !strings.Contains(rec.Body.String(), `data-color-mode="light"`) {
+		t.Errorf("built-in page: status %d, body %.300s", rec.Code, rec.Body.String())
+	}
+
+	if rec := download("/download?template=missing", `{"path": "q3.md"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("missing template: status %d, want 404", rec.Code)
+	}
+
+	// peekm render --standalone --template uses the same templates
+	var out bytes.Buffer
+	if err := renderToWriter(&out, path, true, "cover", markdownOptions()); err != nil || !strings.Contains(out.String(), "<h1>Q3 Report</h1>") {
+		t.Errorf("renderToWriter with a template = %.200s, %v", out.String(), err)
+	}
+}
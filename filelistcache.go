@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// fileListCacheVersion changes when the saved file lists can't be read by
+// this version anymore
+const fileListCacheVersion = 1
+
+// cachedFile is one markdown file of a saved file list
+type cachedFile struct {
+	Path    string    `json:"path"` // Relative to the directory, slash-separated
+	ModTime time.Time `json:"mtime"`
+}
+
+// fileListCache is the file list of a directory as last scanned, kept so
+// reopening it shows its tree before the walk is done
+type fileListCache struct {
+	Version int          `json:"version"`
+	Root    string       `json:"root"`
+	Files   []cachedFile `json:"files"`
+}
+
+// fileListCachePath returns where the file list of root is kept, one file per
+// directory under peekm's config directory ("" if there is none)
+func fileListCachePath(root string) string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(configDir, "peekm", "filelists", hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadFileListCache reads the saved file list of root as absolute paths with
+// their modification times then. Entries are not checked against the disk:
+// files gone since are skipped by the tree and dropped by the next scan.
+func loadFileListCache(root string) map[string]time.Time {
+	path := fileListCachePath(root)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: Cannot read %s: %v", path, err)
+		}
+		return nil
+	}
+	var cache fileListCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		log.Printf("Warning: Invalid %s (ignored): %v", path, err)
+		return nil
+	}
+	if cache.Version != fileListCacheVersion || cache.Root != root {
+		return nil
+	}
+	files := make(map[string]time.Time, len(cache.Files))
+	for _, f := range cache.Files {
+		rel := filepath.FromSlash(f.Path)
+		if filepath.IsLocal(rel) {
+			files[filepath.Join(root, rel)] = f.ModTime
+		}
+	}
+	return files
+}
+
+// fileModTimes returns the modification times of the files that still exist
+func fileModTimes(files []string) map[string]time.Time {
+	mtimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			mtimes[file] = info.ModTime()
+		}
+	}
+	return mtimes
+}
+
+// saveFileListCache keeps the file list of root with the files' modification
+// times
+func saveFileListCache(root string, files map[string]time.Time) {
+	path := fileListCachePath(root)
+	if path == "" {
+		return
+	}
+	cache := fileListCache{Version: fileListCacheVersion, Root: root, Files: make([]cachedFile, 0, len(files))}
+	for file, mtime := range files {
+		if rel, err := filepath.Rel(root, file); err == nil && filepath.IsLocal(rel) {
+			cache.Files = append(cache.Files, cachedFile{Path: filepath.ToSlash(rel), ModTime: mtime.UTC()})
+		}
+	}
+	slices.SortFunc(cache.Files, func(a, b cachedFile) int { return strings.Compare(a.Path, b.Path) })
+
+	data, err := json.Marshal(cache)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		err = atomicWriteFile(path, string(data)+"\n")
+	}
+	if err != nil {
+		log.Printf("Warning: Cannot save the file list of %s: %v", root, err)
+	}
+}
+
+// diffCachedFiles compares the cached file list with the one scanned now:
+// how many files are new or modified since, and the cached files gone
+func diffCachedFiles(cached, scanned map[string]time.Time) (added, modified int, gone []string) {
+	for file, mtime := range scanned {
+		if was, ok := cached[file]; !ok {
+			added++
+		} else if !was.Equal(mtime) {
+			modified++
+		}
+	}
+	for file := range cached {
+		if _, ok := scanned[file]; !ok {
+			gone = append(gone, file)
+		}
+	}
+	return added, modified, gone
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileListCache(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root := t.TempDir()
+	mtime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := map[string]time.Time{
+		filepath.Join(root, "a.md"):         mtime,
+		filepath.Join(root, "docs", "b.md"): mtime.Add(time.Hour),
+		filepath.Join(t.TempDir(), "c.md"):  mtime, // Outside root: not kept
+	}
+
+	if cached := loadFileListCache(root); cached != nil {
+		t.Fatalf("file list before any scan = %v", cached)
+	}
+	saveFileListCache(root, files)
+	want := map[string]time.Time{filepath.Join(root, "a.md"): mtime, filepath.Join(root, "docs", "b.md"): mtime.Add(time.Hour)}
+	if got := loadFileListCache(root); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %v, want %v", got, want)
+	}
+	if got := loadFileListCache(filepath.Join(root, "docs")); got != nil {
+		t.Errorf("file list of another directory = %v, want none", got)
+	}
+
+	os.WriteFile(fileListCachePath(root), []byte(`{"version": 0, "root": "`+filepath.ToSlash(root)+`", "files": [{"path": "a.md"}]}`), 0644)
+	if got := loadFileListCache(root); got != nil {
+		t.Errorf("file list of another version = %v, want none", got)
+	}
+}
+
+func TestDiffCachedFiles(t *testing.T) {
+	now := time.Now()
+	cached := map[string]time.Time{"/d/same.md": now, "/d/edited.md": now, "/d/gone.md": now}
+	scanned := map[string]time.Time{"/d/same.md": now, "/d/edited.md": now.Add(time.Second), "/d/new.md": now}
+
+	added, modified, gone := diffCachedFiles(cached, scanned)
+	if added != 1 || modified != 1 || !reflect.DeepEqual(gone, []string{"/d/gone.md"}) {
+		t.Errorf("diffCachedFiles() = %d added, %d modified, %q gone; want 1, 1, [/d/gone.md]", added, modified, gone)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// fileSet is a set of absolute file paths kept in sorted order: membership
+// checks are map lookups, and listings (the sidebar tree, default file
+// selection) see the files in a stable order. It is not safe for concurrent
+// use; markdownFiles is guarded by fileMutex.
+type fileSet struct {
+	members map[string]struct{}
+	sorted  []string
+}
+
+// newFileSet returns a set holding paths (duplicates are dropped)
+func newFileSet(paths []string) *fileSet {
+	s := &fileSet{members: make(map[string]struct{}, len(paths))}
+	for _, path := range paths {
+		if _, found := s.members[path]; !found {
+			s.members[path] = struct{}{}
+			s.sorted = append(s.sorted, path)
+		}
+	}
+	sort.Strings(s.sorted)
+	return s
+}
+
+// contains reports whether path is in the set
+func (s *fileSet) contains(path string) bool {
+	_, found := s.members[path]
+	return found
+}
+
+// add inserts path, returning false if it was already present
+func (s *fileSet) add(path string) bool {
+	if s.contains(path) {
+		return false
+	}
+	s.members[path] = struct{}{}
+	i, _ := slices.BinarySearch(s.sorted, path)
+	s.sorted = slices.Insert(s.sorted, i, path)
+	return true
+}
+
+// addAll inserts paths, sorting once rather than per path, and returns how
+// many were new
+func (s *fileSet) addAll(paths []string) int {
+	added := 0
+	for _, path := range paths {
+		if !s.contains(path) {
+			s.members[path] = struct{}{}
+			s.sorted = append(s.sorted, path)
+			added++
+		}
+	}
+	if added > 0 {
+		sort.Strings(s.sorted)
+	}
+	return added
+}
+
+// remove deletes path, returning false if it was not present
+func (s *fileSet) remove(path string) bool {
+	if !s.contains(path) {
+		return false
+	}
+	delete(s.members, path)
+	if i, found := slices.BinarySearch(s.sorted, path); found {
+		s.sorted = slices.Delete(s.sorted, i, i+1)
+	}
+	return true
+}
+
+// under returns the paths inside dir, at any depth, sorted
+func (s *fileSet) under(dir string) []string {
+	prefix := dir + string(filepath.Separator)
+	i, _ := slices.BinarySearch(s.sorted, prefix)
+	j := i
+	for j < len(s.sorted) && strings.HasPrefix(s.sorted[j], prefix) {
+		j++
+	}
+	return slices.Clone(s.sorted[i:j])
+}
+
+// len returns the number of paths in the set
+func (s *fileSet) len() int {
+	return len(s.sorted)
+}
+
+// list returns a sorted copy of the paths
+func (s *fileSet) list() []string {
+	return slices.Clone(s.sorted)
+}
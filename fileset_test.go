@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFileSet(t *testing.T) {
+	s := newFileSet([]string{"/d/b.md", "/d/a.md", "/d/b.md"})
+	if s.len() != 2 || !reflect.DeepEqual(s.list(), []string{"/d/a.md", "/d/b.md"}) {
+		t.Fatalf("newFileSet() = %q, want sorted without duplicates", s.list())
+	}
+
+	if !s.add("/d/aa.md") || s.add("/d/aa.md") {
+		t.Error("add() should report only new paths")
+	}
+	if !s.remove("/d/a.md") || s.remove("/d/a.md") {
+		t.Error("remove() should report only present paths")
+	}
+	if want := []string{"/d/aa.md", "/d/b.md"}; !reflect.DeepEqual(s.list(), want) {
+		t.Errorf("list() = %q, want %q", s.list(), want)
+	}
+	if !s.contains("/d/b.md") || s.contains("/d/a.md") {
+		t.Error("contains() does not follow add and remove")
+	}
+
+	if added := s.addAll([]string{"/d/c.md", "/d/b.md", "/d/0.md"}); added != 2 {
+		t.Errorf("addAll() = %d, want 2 new paths", added)
+	}
+	if want := []string{"/d/0.md", "/d/aa.md", "/d/b.md", "/d/c.md"}; !reflect.DeepEqual(s.list(), want) {
+		t.Errorf("list() after addAll = %q, want %q", s.list(), want)
+	}
+
+	// list() is a copy
+	s.list()[0] = "/changed"
+	if s.list()[0] != "/d/0.md" {
+		t.Error("list() exposes the set's storage")
+	}
+}
+
+func TestFileSetUnder(t *testing.T) {
+	s := newFileSet([]string{"/d/a.md", "/d/api/b.md", "/d/api/v2/c.md", "/d/api.md", "/d/apis/d.md", "/e/f.md"})
+	if got, want := s.under("/d/api"), []string{"/d/api/b.md", "/d/api/v2/c.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("under(/d/api) = %q, want %q", got, want)
+	}
+	if got := s.under("/d/none"); len(got) != 0 {
+		t.Errorf("under(/d/none) = %q, want none", got)
+	}
+}
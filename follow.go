@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// followMode navigates connected browsers to files as AI sessions write them
+// (enabled with --follow, toggled at runtime via /api/follow)
+var followMode atomic.Bool
+
+// followMessage is the SSE event that asks browsers to open a file
+type followMessage struct {
+	Type    string `json:"type"` // "navigate"
+	Path    string `json:"path"` // Relative to the browse directory
+	Session string `json:"session,omitempty"`
+}
+
+// followStatusMessage is broadcast when follow mode is toggled
+type followStatusMessage struct {
+	Type    string `json:"type"` // "follow_status"
+	Enabled bool   `json:"enabled"`
+}
+
+// followFile sends a navigate event for a hook-attributed markdown file when follow mode is on
+func followFile(filePath, sessionID string) {
+	if !followMode.Load() || !isMarkdownPath(filePath) || !isWhitelistedFile(filePath) {
+		return
+	}
+
+	// Files outside the browse directory (e.g. cached plans) have no /view/ URL
+	relPath := getRelativePath(filePath)
+	if filepath.IsAbs(relPath) || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return
+	}
+
+	msgBytes, err := json.Marshal(followMessage{
+		Type:    "navigate",
+		Path:    filepath.ToSlash(relPath),
+		Session: sessionID,
+	})
+	if err != nil {
+		log.Printf("Error marshaling navigate message: %v", err)
+		return
+	}
+	notifyClientsWithMessage(string(msgBytes))
+}
+
+// apiFollowState is the /api/follow payload
+type apiFollowState struct {
+	Enabled bool `json:"enabled"`
+}
+
+// handleAPIFollow reports (GET) or sets (POST {"enabled": bool}) follow mode
+func handleAPIFollow(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req apiFollowState
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if followMode.Swap(req.Enabled) != req.Enabled {
+			log.Printf("Follow mode set to %t", req.Enabled)
+			if msgBytes, err := json.Marshal(followStatusMessage{Type: "follow_status", Enabled: req.Enabled}); err == nil {
+				notifyClientsWithMessage(string(msgBytes))
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, apiFollowState{Enabled: followMode.Load()})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleAPIFollow(t *testing.T) {
+	defer followMode.Store(false)
+
+	tests := []struct {
+		method string
+		body   string
+		want   int
+		on     bool
+	}{
+		{"GET", "", http.StatusOK, false},
+		{"POST", `{"enabled": true}`, http.StatusOK, true},
+		{"GET", "", http.StatusOK, true},
+		{"POST", `not json`, http.StatusBadRequest, true},
+		{"POST", `{"enabled": false}`, http.StatusOK, false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/follow", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		handleAPIFollow(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %q: status = %d, want %d", tt.method, tt.body, rec.Code, tt.want)
+		}
+		if followMode.Load() != tt.on {
+			t.Errorf("%s %q: follow = %t, want %t", tt.method, tt.body, followMode.Load(), tt.on)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/razvandimescu/peekm/frontmatter"
+)
+
+// apiFrontMatterResponse is returned by /api/frontmatter
+type apiFrontMatterResponse struct {
+	Path    string         `json:"path"`    // Relative to the browse directory
+	Present bool           `json:"present"` // File starts with a --- front matter block
+	Data    map[string]any `json:"data"`    // Parsed YAML mapping
+	Raw     string         `json:"raw"`     // YAML between the --- lines
+}
+
+// apiFrontMatterRequest is the PUT /api/frontmatter request body
+type apiFrontMatterRequest struct {
+	Data map[string]any `json:"data"` // Replaces the front matter; empty removes it
+}
+
+// handleAPIFrontMatter returns a file's front matter (GET) or replaces it with
+// {"data": {...}} (PUT), leaving the body byte-identical. An empty data object
+// removes the front matter block.
+func handleAPIFrontMatter(w http.ResponseWriter, r *http.Request) {
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	yamlText, body, found := frontmatter.Split(string(content))
+
+	if r.Method == http.MethodPut {
+		var ok bool
+		if yamlText, ok = writeFrontMatter(w, r, validated, yamlText, body); !ok {
+			return
+		}
+		found = yamlText != ""
+	}
+
+	data, err := frontmatter.Parse(yamlText)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid front matter: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiFrontMatterResponse{
+		Path:    filepath.ToSlash(relPath),
+		Present: found,
+		Data:    data,
+		Raw:     yamlText,
+	})
+}
+
+// writeFrontMatter applies a PUT request to a file and returns the new YAML.
+// It writes the error response and returns false on failure.
+func writeFrontMatter(w http.ResponseWriter, r *http.Request, path, yamlText, body string) (string, bool) {
+	var req apiFrontMatterRequest
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber() // Keep integers integers in the YAML
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+	if err := checkWritable(path); err != nil {
+		writeError(w, errCodeReadOnly, err.Error(), http.StatusForbidden)
+		return "", false
+	}
+
+	updated, err := frontmatter.Update(yamlText, req.Data)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Cannot update front matter: "+err.Error(), http.StatusUnprocessableEntity)
+		return "", false
+	}
+	if updated == yamlText {
+		return updated, true
+	}
+	if err := atomicWriteFile(path, frontmatter.Join(updated, body)); err != nil {
+		writeError(w, errCodeInternal, fmt.Sprintf("Failed to save: %v", err), http.StatusInternalServerError)
+		return "", false
+	}
+	log.Printf("Updated front matter: %s", path)
+	return updated, true
+}
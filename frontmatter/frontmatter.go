@@ -0,0 +1,229 @@
+// Package frontmatter reads and rewrites the YAML front matter of markdown
+// files. Rewrites keep the order, comments and formatting of unchanged keys,
+// and never touch the document body.
+package frontmatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// timestampTag is the resolved tag of unquoted YAML dates and times
+const timestampTag = "!!timestamp"
+
+// ErrNotMapping is returned when the front matter is not a YAML mapping
+var ErrNotMapping = errors.New("front matter is not a YAML mapping")
+
+// Split separates leading front matter from the body. yamlText excludes the
+// --- delimiters; body is everything after the closing line, unmodified.
+func Split(content string) (yamlText, body string, found bool) {
+	first, rest, ok := strings.Cut(content, "\n")
+	if !ok || strings.TrimRight(first, " \t\r") != "---" {
+		return "", content, false
+	}
+	for offset := 0; offset < len(rest); {
+		line, _, _ := strings.Cut(rest[offset:], "\n")
+		end := offset + len(line)
+		if end < len(rest) {
+			end++ // Include the newline
+		}
+		if delim := strings.TrimRight(line, " \t\r"); delim == "---" || delim == "..." {
+			return rest[:offset], rest[end:], true
+		}
+		offset = end
+	}
+	return "", content, false
+}
+
+// Join puts front matter back in front of a body; empty front matter is omitted
+func Join(yamlText, body string) string {
+	if yamlText == "" {
+		return body
+	}
+	if !strings.HasSuffix(yamlText, "\n") {
+		yamlText += "\n"
+	}
+	return "---\n" + yamlText + "---\n" + body
+}
+
+// Parse decodes front matter into a JSON-compatible map (empty for blank
+// front matter). Dates are returned as written, e.g. "2024-05-12".
+func Parse(yamlText string) (map[string]any, error) {
+	data := map[string]any{}
+	_, mapping, err := parseDocument(yamlText)
+	if err != nil || mapping == nil {
+		return data, err
+	}
+	if err := decode(mapping, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Update rewrites front matter so its keys match data. Keys missing from data
+// are removed, new keys are appended in sorted order, and keys whose value
+// did not change keep their original YAML. Returns "" when data is empty.
+func Update(yamlText string, data map[string]any) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+
+	doc, mapping, err := parseDocument(yamlText)
+	if err != nil {
+		return "", err
+	}
+	if mapping == nil {
+		mapping = &yaml.Node{Kind: yaml.MappingNode}
+		doc.Content = []*yaml.Node{mapping}
+	}
+
+	var content []*yaml.Node
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		newValue, keep := data[key.Value]
+		if !keep {
+			continue
+		}
+		seen[key.Value] = true
+		node, err := valueNode(newValue, value)
+		if err != nil {
+			return "", err
+		}
+		content = append(content, key, node)
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		node, err := valueNode(data[key], nil)
+		if err != nil {
+			return "", err
+		}
+		content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, node)
+	}
+	mapping.Content = content
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// parseDocument parses front matter and returns the document and its
+// top-level mapping (nil when blank)
+func parseDocument(yamlText string) (*yaml.Node, *yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	if err := yaml.Unmarshal([]byte(yamlText), doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return doc, nil, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, ErrNotMapping
+	}
+	return doc, doc.Content[0], nil
+}
+
+// decode decodes node into v with timestamps kept as their source text
+func decode(node *yaml.Node, v any) error {
+	copied := copyNode(node)
+	return copied.Decode(v)
+}
+
+// copyNode deep-copies a node, retagging timestamps as strings
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	if copied.Kind == yaml.ScalarNode && copied.ShortTag() == timestampTag {
+		copied.Tag = "!!str"
+	}
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child)
+	}
+	return &copied
+}
+
+// valueNode returns old if it already holds value, otherwise a new node for value
+func valueNode(value any, old *yaml.Node) (*yaml.Node, error) {
+	if old != nil {
+		var current any
+		if err := decode(old, &current); err == nil && sameJSON(current, value) {
+			return old, nil
+		}
+		// Keep an edited date a date rather than a quoted string
+		if str, ok := value.(string); ok && old.Kind == yaml.ScalarNode && old.ShortTag() == timestampTag && isDate(str) {
+			node := *old
+			node.Value = str
+			return &node, nil
+		}
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(fromJSON(value)); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// fromJSON converts json.Number values (from a decoder using UseNumber) to
+// ints or floats so they are written as YAML numbers rather than strings
+func fromJSON(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]any:
+		converted := make(map[string]any, len(v))
+		for key, item := range v {
+			converted[key] = fromJSON(item)
+		}
+		return converted
+	case []any:
+		converted := make([]any, len(v))
+		for i, item := range v {
+			converted[i] = fromJSON(item)
+		}
+		return converted
+	}
+	return value
+}
+
+// sameJSON reports whether a and b have the same JSON encoding
+func sameJSON(a, b any) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// isDate reports whether s is a YAML date or RFC 3339 timestamp
+func isDate(s string) bool {
+	for _, layout := range []string{"2006-01-02", time.RFC3339Nano} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
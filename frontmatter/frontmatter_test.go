@@ -0,0 +1,83 @@
+package frontmatter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSplitJoin(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		yaml    string
+		body    string
+		found   bool
+	}{
+		{"front matter", "---\ntitle: A\n---\n# A\n", "title: A\n", "# A\n", true},
+		{"dots close", "---\ntitle: A\n...\nbody", "title: A\n", "body", true},
+		{"empty", "---\n---\nbody\n", "", "body\n", true},
+		{"crlf body untouched", "---\r\ntitle: A\r\n---\r\nbody\r\n", "title: A\r\n", "body\r\n", true},
+		{"no front matter", "# A\n---\n", "", "# A\n---\n", false},
+		{"unterminated", "---\ntitle: A\n", "", "---\ntitle: A\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yamlText, body, found := Split(tt.content)
+			if yamlText != tt.yaml || body != tt.body || found != tt.found {
+				t.Errorf("Split() = %q, %q, %t; want %q, %q, %t", yamlText, body, found, tt.yaml, tt.body, tt.found)
+			}
+		})
+	}
+
+	if got := Join("title: A", "body"); got != "---\ntitle: A\n---\nbody" {
+		t.Errorf("Join() = %q", got)
+	}
+	if got := Join("", "body"); got != "body" {
+		t.Errorf("Join() with empty front matter = %q", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	data, err := Parse("title: Notes\ntags: [a, b]\ndraft: true\ncount: 3\ndate: 2024-05-12\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"title": "Notes", "tags": []any{"a", "b"}, "draft": true, "count": 3, "date": "2024-05-12"}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("Parse() = %#v, want %#v", data, want)
+	}
+
+	if _, err := Parse("- a\n- b\n"); err != ErrNotMapping {
+		t.Errorf("Parse(list) error = %v, want ErrNotMapping", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	original := "# Post metadata\ntitle: Old   # keep this comment\ntags:\n    - a\n    - b\nremoved: yes\n"
+	got, err := Update(original, map[string]any{
+		"title":  "Old",
+		"tags":   []any{"a", "b"},
+		"author": "Ada",
+		"count":  json.Number("2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Post metadata\ntitle: Old # keep this comment\ntags:\n  - a\n  - b\nauthor: Ada\ncount: 2\n"
+	if got != want {
+		t.Errorf("Update() =\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = Update("date: 2024-05-12 # published\nupdated: 2024-05-12\n", map[string]any{"date": "2024-05-13", "updated": "soon"})
+	if want := "date: 2024-05-13 # published\nupdated: soon\n"; err != nil || got != want {
+		t.Errorf("Update(dates) = %q, %v; want %q", got, err, want)
+	}
+
+	if got, err := Update("title: A\n", nil); err != nil || got != "" {
+		t.Errorf("Update(empty) = %q, %v; want empty", got, err)
+	}
+	if got, err := Update("", map[string]any{"title": "New"}); err != nil || got != "title: New\n" {
+		t.Errorf("Update(new) = %q, %v", got, err)
+	}
+}
@@ -5,8 +5,12 @@ go 1.23.8
 require (
 	github.com/alecthomas/chroma/v2 v2.2.0
 	github.com/fsnotify/fsnotify v1.9.0
+	github.com/golangci/misspell v0.8.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/yuin/goldmark v1.7.13
 	github.com/yuin/goldmark-highlighting/v2 v2.0.0-20230729083705-37449abec8cc
+	golang.org/x/net v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
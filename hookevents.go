@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Claude Code hook event names (hook_event_name in the hook payload)
+const (
+	hookPreToolUse   = "PreToolUse"
+	hookPostToolUse  = "PostToolUse"
+	hookStop         = "Stop"
+	hookSubagentStop = "SubagentStop"
+)
+
+// maxSessionEvents caps the events kept per session
+const maxSessionEvents = 200
+
+// hookRequest is the payload posted to /hook/{source}
+type hookRequest struct {
+	Source         string `json:"-"`               // From the URL, never the payload
+	HookEventName  string `json:"hook_event_name"` // Empty for older hook scripts (PostToolUse)
+	SessionID      string `json:"session_id"`
+	ToolName       string `json:"tool_name"`
+	FilePath       string `json:"file_path"`
+	Content        string `json:"content"`
+	PermissionMode string `json:"permission_mode"`
+	ToolUseID      string `json:"tool_use_id"`
+	CWD            string `json:"cwd"`
+	TranscriptPath string `json:"transcript_path"`
+}
+
+// sessionEvent is a typed Claude Code hook event recorded for a session
+type sessionEvent struct {
+	Type      string    `json:"type"` // Hook event name (PreToolUse, PostToolUse, Stop, SubagentStop)
+	Source    string    `json:"source"`
+	ToolName  string    `json:"tool_name,omitempty"`
+	FilePath  string    `json:"file_path,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// sessionEventMessage is used for SSE notifications about session activity
+type sessionEventMessage struct {
+	Type    string `json:"type"` // "session_started", "session_tool_use", "session_finished", "subagent_finished"
+	Source  string `json:"source"`
+	Session string `json:"session"`
+	Tool    string `json:"tool,omitempty"`
+	Path    string `json:"path,omitempty"`
+}
+
+// recordEvent appends an event for a session and tracks whether the session is
+// working. Returns true when the event starts a new active period.
+func (ss *sessionStore) recordEvent(sessionID string, evt sessionEvent) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, known := ss.events[sessionID]; !known && len(ss.events) >= maxTrackedSessions {
+		ss.evictOldestSessionLocked()
+	}
+	events := append(ss.events[sessionID], evt)
+	if len(events) > maxSessionEvents {
+		events = events[len(events)-maxSessionEvents:]
+	}
+	ss.events[sessionID] = events
+
+	switch evt.Type {
+	case hookStop:
+		delete(ss.active, sessionID)
+		return false
+	case hookSubagentStop:
+		return false
+	}
+	started := !ss.active[sessionID]
+	ss.active[sessionID] = true
+	return started
+}
+
+// sessionEvents returns a copy of the events recorded for a session
+func (ss *sessionStore) sessionEvents(sessionID string) []sessionEvent {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return append([]sessionEvent(nil), ss.events[sessionID]...)
+}
+
+// isActive reports whether a session has started work and not yet stopped
+func (ss *sessionStore) isActive(sessionID string) bool {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.active[sessionID]
+}
+
+// recordHookEvent stores a hook event and announces newly active sessions
+func recordHookEvent(req hookRequest) {
+	evt := sessionEvent{
+		Type:      req.HookEventName,
+		Source:    req.Source,
+		ToolName:  req.ToolName,
+		FilePath:  req.FilePath,
+		Timestamp: time.Now(),
+	}
+	if globalSessionStore.recordEvent(req.SessionID, evt) {
+		log.Printf("AI session %s (%s) started", shortSessionID(req.SessionID), req.Source)
+		sendSessionEvent("session_started", req)
+	}
+}
+
+// handlePreToolUse snapshots the file a session is about to modify and announces the edit
+func handlePreToolUse(req hookRequest) {
+	globalSessionStore.snapshot(req.FilePath, req.SessionID)
+	recordHookEvent(req)
+	sendSessionEvent("session_tool_use", req)
+}
+
+// handleSessionStop records the end of a session turn (Stop) or of a subagent (SubagentStop)
+func handleSessionStop(req hookRequest) {
+	recordHookEvent(req)
+
+	msgType := "session_finished"
+	if req.HookEventName == hookSubagentStop {
+		msgType = "subagent_finished"
+	}
+	log.Printf("AI session %s: %s", shortSessionID(req.SessionID), req.HookEventName)
+	sendSessionEvent(msgType, req)
+	if req.HookEventName == hookStop {
+		notifySessionFinished(req)
+	}
+}
+
+// sendSessionEvent broadcasts a session activity message to clients
+func sendSessionEvent(msgType string, req hookRequest) {
+	msg := sessionEventMessage{
+		Type:    msgType,
+		Source:  req.Source,
+		Session: req.SessionID,
+		Tool:    req.ToolName,
+	}
+	if req.FilePath != "" {
+		msg.Path = getRelativePath(req.FilePath)
+	}
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling %s message: %v", msgType, err)
+		return
+	}
+	notifyClientsWithMessage(string(msgBytes))
+}
+
+// shortSessionID truncates a session ID for logging (first 8 chars)
+func shortSessionID(sessionID string) string {
+	if len(sessionID) > 8 {
+		return sessionID[:8]
+	}
+	return sessionID
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionStoreRecordEvent(t *testing.T) {
+	ss := newSessionStore()
+
+	if !ss.recordEvent("s1", sessionEvent{Type: hookPreToolUse, ToolName: "Write"}) {
+		t.Error("first PreToolUse should start the session")
+	}
+	if ss.recordEvent("s1", sessionEvent{Type: hookPostToolUse, ToolName: "Write"}) {
+		t.Error("PostToolUse in an active session should not start it again")
+	}
+	if ss.recordEvent("s1", sessionEvent{Type: hookSubagentStop}) || !ss.isActive("s1") {
+		t.Error("SubagentStop should leave the session active")
+	}
+	if ss.recordEvent("s1", sessionEvent{Type: hookStop}) || ss.isActive("s1") {
+		t.Error("Stop should end the active period")
+	}
+	if !ss.recordEvent("s1", sessionEvent{Type: hookPreToolUse}) {
+		t.Error("PreToolUse after Stop should start a new active period")
+	}
+
+	if got := len(ss.sessionEvents("s1")); got != 5 {
+		t.Errorf("recorded %d events, want 5", got)
+	}
+	for i := 0; i < maxSessionEvents+10; i++ {
+		ss.recordEvent("s2", sessionEvent{Type: hookPostToolUse})
+	}
+	if got := len(ss.sessionEvents("s2")); got != maxSessionEvents {
+		t.Errorf("recorded %d events, want cap of %d", got, maxSessionEvents)
+	}
+}
+
+func TestHandleClaudeHookValidation(t *testing.T) {
+	prev := globalSessionStore
+	globalSessionStore = newSessionStore()
+	defer func() { globalSessionStore = prev }()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"pre tool use without file", `{"hook_event_name":"PreToolUse","session_id":"s1"}`, http.StatusBadRequest},
+		{"legacy payload without session", `{"file_path":"/tmp/a.md"}`, http.StatusBadRequest},
+		{"stop without session", `{"hook_event_name":"Stop"}`, http.StatusBadRequest},
+		{"unknown event", `{"hook_event_name":"Notification","session_id":"s1"}`, http.StatusBadRequest},
+		{"stop", `{"hook_event_name":"Stop","session_id":"s1"}`, http.StatusOK},
+		{"subagent stop", `{"hook_event_name":"SubagentStop","session_id":"s1"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hook/file-modified", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handleClaudeHook(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
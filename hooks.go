@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// peekmHookScriptName is the hook script written next to the Claude Code settings file
+const peekmHookScriptName = "peekm-hook.sh"
+
+// toolHookMatchers are the Claude Code tools whose file edits peekm tracks
+var toolHookMatchers = []string{"Write", "Edit", "NotebookEdit"}
+
+// toolHookEvents are Claude Code hook events registered once per tool matcher
+var toolHookEvents = []string{hookPreToolUse, hookPostToolUse}
+
+// hookEventsWithoutMatcher are Claude Code hook events registered once, without a tool matcher
+var hookEventsWithoutMatcher = []string{hookStop, hookSubagentStop}
+
+// runSetup handles the "peekm setup" subcommand
+func runSetup(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: peekm setup claude-code [--remove] [--port PORT]")
+		fmt.Println("\nConfigures Claude Code to send file modification events to peekm.")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "claude-code":
+		setupClaudeCode(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown setup target: %s\n", args[0])
+		fmt.Println("Available: claude-code")
+		os.Exit(1)
+	}
+}
+
+// runHooks handles "peekm hooks install|uninstall [--project] [--port PORT]"
+func runHooks(args []string) {
+	usage := func() {
+		fmt.Println("Usage: peekm hooks <install|uninstall> [--project] [--port PORT]")
+		fmt.Println("\nWrites or removes the Claude Code hooks (PreToolUse, PostToolUse, Stop, SubagentStop) that report to peekm.")
+		fmt.Println("By default ~/.claude/settings.json is used; --project uses ./.claude/settings.json.")
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(1)
+	}
+
+	hookFlags := flag.NewFlagSet("hooks "+args[0], flag.ExitOnError)
+	project := hookFlags.Bool("project", false, "Use the project's .claude/settings.json instead of the user settings")
+	hookPort := hookFlags.Int("port", 6419, "Port peekm runs on")
+	hookFlags.Parse(args[1:])
+
+	claudeDir, err := claudeSettingsDir(*project)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "install":
+		installClaudeCodeHooks(claudeDir, *hookPort)
+	case "uninstall":
+		removeClaudeCodeSetup(filepath.Join(claudeDir, "settings.json"), filepath.Join(claudeDir, peekmHookScriptName))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown hooks command: %s\n", args[0])
+		usage()
+		os.Exit(1)
+	}
+}
+
+// claudeSettingsDir returns ~/.claude, or ./.claude for project-level settings
+func claudeSettingsDir(project bool) (string, error) {
+	if project {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine working directory: %w", err)
+		}
+		return filepath.Join(cwd, ".claude"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".claude"), nil
+}
+
+func setupClaudeCode(args []string) {
+	setupFlags := flag.NewFlagSet("setup claude-code", flag.ExitOnError)
+	remove := setupFlags.Bool("remove", false, "Remove peekm hooks from Claude Code")
+	hookPort := setupFlags.Int("port", 6419, "Port peekm runs on")
+	setupFlags.Parse(args)
+
+	claudeDir, err := claudeSettingsDir(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *remove {
+		removeClaudeCodeSetup(filepath.Join(claudeDir, "settings.json"), filepath.Join(claudeDir, peekmHookScriptName))
+		return
+	}
+
+	installClaudeCodeHooks(claudeDir, *hookPort)
+}
+
+// peekmHookScript returns the hook script that forwards Claude Code events to peekm
+func peekmHookScript(port int) string {
+	return fmt.Sprintf(`#!/bin/bash
+json=$(cat)
+session_id=$(echo "$json" | jq -r '.session_id // empty')
+event=$(echo "$json" | jq -r '.hook_event_name // empty')
+tool_name=$(echo "$json" | jq -r '.tool_name // empty')
+file_path=$(echo "$json" | jq -r '.tool_input.file_path // .tool_input.notebook_path // empty')
+
+# post PAYLOAD TIMEOUT sends an event to peekm, signed when $PEEKM_HOOK_SECRET is set
+post() {
+    signature=()
+    if [ -n "$PEEKM_HOOK_SECRET" ]; then
+        hmac=$(printf '%%s' "$1" | openssl dgst -sha256 -hmac "$PEEKM_HOOK_SECRET" | sed 's/^.* //')
+        signature=(-H "X-Peekm-Signature: sha256=$hmac")
+    fi
+    curl -s -X POST -H 'Content-Type: application/json' "${signature[@]}" \
+        -d "$1" --max-time "$2" http://localhost:%d/hook/claude-code >/dev/null 2>&1
+}
+
+# Session lifecycle events (no file involved)
+if [ "$event" = "Stop" ] || [ "$event" = "SubagentStop" ]; then
+    if [ -n "$session_id" ]; then
+        post "$(echo "$json" | jq -c '{session_id, hook_event_name, cwd, transcript_path}')" 0.1
+    fi
+    exit 0
+fi
+
+if [ -n "$session_id" ] && [ -n "$tool_name" ] && [ -n "$file_path" ]; then
+    # For Claude plan files, forward content for devcontainer support
+    if echo "$file_path" | grep -q '\.claude/plans/.*\.md$'; then
+        post "$(echo "$json" | jq -c '{hook_event_name, session_id, tool_name, file_path: .tool_input.file_path, content: .tool_input.content}')" 0.5
+    else
+        post "{\"hook_event_name\":\"$event\",\"session_id\":\"$session_id\",\"tool_name\":\"$tool_name\",\"file_path\":\"$file_path\"}" 0.1
+    fi
+fi
+`, port)
+}
+
+// installClaudeCodeHooks writes the hook script into claudeDir and merges the
+// tool and session lifecycle entries into claudeDir/settings.json (idempotent)
+func installClaudeCodeHooks(claudeDir string, port int) {
+	settingsPath := filepath.Join(claudeDir, "settings.json")
+	hookScriptPath := filepath.Join(claudeDir, peekmHookScriptName)
+
+	fmt.Println("\n  AI Session Tracking Setup")
+	fmt.Println("  " + strings.Repeat("\u2500", 25))
+
+	// Step 1: Create hook script
+	fmt.Printf("\n  Step 1: Hook script\n")
+
+	if err := os.MkdirAll(claudeDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "    Error creating %s: %v\n", claudeDir, err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(hookScriptPath, []byte(peekmHookScript(port)), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "    Error writing hook script: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("    Created %s\n", hookScriptPath)
+
+	// Step 2: Merge hooks into settings.json
+	fmt.Printf("\n  Step 2: Claude Code settings\n")
+
+	// Read existing settings or start fresh
+	var settings map[string]interface{}
+	data, err := os.ReadFile(settingsPath)
+	if err == nil {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			fmt.Fprintf(os.Stderr, "    Error parsing %s: %v\n", settingsPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("    Found %s\n", settingsPath)
+	} else {
+		settings = make(map[string]interface{})
+		fmt.Printf("    Creating %s\n", settingsPath)
+	}
+
+	added := addPeekmHooks(settings, hookScriptPath)
+
+	// Write settings back
+	out, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "    Error serializing settings: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(settingsPath, append(out, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "    Error writing %s: %v\n", settingsPath, err)
+		os.Exit(1)
+	}
+
+	if len(added) > 0 {
+		fmt.Printf("    Added %d hook(s) (%s)\n", len(added), strings.Join(added, ", "))
+	} else {
+		fmt.Printf("    Hooks already configured (no changes)\n")
+	}
+
+	// Step 3: Check the instance the hooks point at
+	fmt.Printf("\n  Step 3: peekm instance\n")
+	if peekmRunning(port) {
+		fmt.Printf("    peekm is running on port %d\n", port)
+	} else {
+		fmt.Printf("    peekm is not running on port %d yet (start it with: peekm -port %d .)\n", port, port)
+	}
+
+	fmt.Println("\n  Setup complete. Restart Claude Code to activate.")
+	fmt.Println("  To verify: modify a file with Claude Code and check peekm")
+	fmt.Println("  for the AI session badge.")
+	fmt.Println()
+}
+
+// addPeekmHooks merges peekm's hook entries into Claude Code settings and returns
+// the names of the entries it added (e.g. "PostToolUse:Write", "Stop")
+func addPeekmHooks(settings map[string]interface{}, hookScriptPath string) []string {
+	hookEntry := map[string]interface{}{
+		"type":    "command",
+		"command": hookScriptPath,
+		"timeout": 0.15,
+	}
+
+	hooks, _ := settings["hooks"].(map[string]interface{})
+	if hooks == nil {
+		hooks = make(map[string]interface{})
+	}
+
+	var added []string
+
+	// Add hooks for each matcher (idempotent — skip if peekm hook already exists)
+	for _, event := range toolHookEvents {
+		entries, _ := hooks[event].([]interface{})
+		if entries == nil {
+			entries = []interface{}{}
+		}
+		for _, matcher := range toolHookMatchers {
+			if hasPeekmHook(entries, matcher, hookScriptPath) {
+				continue
+			}
+			entries = append(entries, map[string]interface{}{
+				"matcher": matcher,
+				"hooks":   []interface{}{hookEntry},
+			})
+			added = append(added, event+":"+matcher)
+		}
+		hooks[event] = entries
+	}
+
+	// Session lifecycle events take no matcher
+	for _, event := range hookEventsWithoutMatcher {
+		entries, _ := hooks[event].([]interface{})
+		if hasPeekmHook(entries, "", hookScriptPath) {
+			continue
+		}
+		hooks[event] = append(entries, map[string]interface{}{
+			"hooks": []interface{}{hookEntry},
+		})
+		added = append(added, event)
+	}
+
+	settings["hooks"] = hooks
+	return added
+}
+
+// peekmRunning reports whether a peekm instance answers on localhost:port
+func peekmRunning(port int) bool {
+	client := &http.Client{Timeout: 500 * time.Millisecond}
+	resp, err := client.Get(fmt.Sprintf("http://localhost:%d/api/connect-info", port))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// hasPeekmHook checks if a hook entry for this matcher ("" for none) already has a peekm hook
+func hasPeekmHook(entries []interface{}, matcher, scriptPath string) bool {
+	for _, entry := range entries {
+		e, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if entryMatcher, _ := e["matcher"].(string); entryMatcher != matcher {
+			continue
+		}
+		hooks, ok := e["hooks"].([]interface{})
+		if !ok {
+			continue
+		}
+		if containsPeekmHook(hooks, scriptPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterPeekmHooks returns hook entries that don't reference the peekm hook script.
+func filterPeekmHooks(entries []interface{}, hookScriptPath string) (filtered []interface{}, removed int) {
+	for _, entry := range entries {
+		e, ok := entry.(map[string]interface{})
+		if !ok {
+			filtered = append(filtered, entry)
+			continue
+		}
+		entryHooks, ok := e["hooks"].([]interface{})
+		if !ok {
+			filtered = append(filtered, entry)
+			continue
+		}
+		if containsPeekmHook(entryHooks, hookScriptPath) {
+			removed++
+		} else {
+			filtered = append(filtered, entry)
+		}
+	}
+	return
+}
+
+func containsPeekmHook(hooks []interface{}, hookScriptPath string) bool {
+	for _, h := range hooks {
+		hook, ok := h.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cmd, ok := hook["command"].(string); ok && cmd == hookScriptPath {
+			return true
+		}
+	}
+	return false
+}
+
+// removePeekmHooks strips peekm entries from every hook event, dropping events
+// left empty. Returns the number of entries removed.
+func removePeekmHooks(hooks map[string]interface{}, hookScriptPath string) int {
+	total := 0
+	for event, value := range hooks {
+		entries, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		filtered, removed := filterPeekmHooks(entries, hookScriptPath)
+		if removed == 0 {
+			continue
+		}
+		total += removed
+		if len(filtered) == 0 {
+			delete(hooks, event)
+		} else {
+			hooks[event] = filtered
+		}
+	}
+	return total
+}
+
+// removeClaudeCodeSetup removes peekm hooks from Claude Code settings
+func removeClaudeCodeSetup(settingsPath, hookScriptPath string) {
+	fmt.Println("\n  Removing AI Session Tracking")
+	fmt.Println("  " + strings.Repeat("\u2500", 30))
+
+	// Remove hook script
+	if err := os.Remove(hookScriptPath); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "    Warning: %v\n", err)
+	} else if err == nil {
+		fmt.Printf("    Removed %s\n", hookScriptPath)
+	}
+
+	// Remove hooks from settings.json
+	data, err := os.ReadFile(settingsPath)
+	if err != nil {
+		fmt.Println("    No settings file found")
+		fmt.Print("\n  Done.\n\n")
+		return
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		fmt.Fprintf(os.Stderr, "    Error parsing settings: %v\n", err)
+		os.Exit(1)
+	}
+
+	hooks, _ := settings["hooks"].(map[string]interface{})
+	if hooks == nil {
+		fmt.Println("    No hooks found in settings")
+		fmt.Print("\n  Done.\n\n")
+		return
+	}
+
+	// Filter out entries whose hooks reference the peekm script
+	if removed := removePeekmHooks(hooks, hookScriptPath); removed > 0 {
+		out, _ := json.MarshalIndent(settings, "", "  ")
+		os.WriteFile(settingsPath, append(out, '\n'), 0644)
+		fmt.Printf("    Removed %d hook(s) from settings.json\n", removed)
+	} else {
+		fmt.Println("    No peekm hooks found in settings")
+	}
+
+	fmt.Print("\n  Done.\n\n")
+}
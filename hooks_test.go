@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestAddAndRemovePeekmHooks tests idempotent install and clean uninstall of hook entries
+func TestAddAndRemovePeekmHooks(t *testing.T) {
+	const script = "/home/u/.claude/peekm-hook.sh"
+
+	var settings map[string]interface{}
+	existing := `{"model": "opus", "hooks": {"PostToolUse": [{"matcher": "Bash", "hooks": [{"type": "command", "command": "other.sh"}]}]}}`
+	if err := json.Unmarshal([]byte(existing), &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	added := addPeekmHooks(settings, script)
+	if len(added) != 8 {
+		t.Fatalf("added = %v, want 3 matchers for PreToolUse and PostToolUse plus Stop and SubagentStop", added)
+	}
+	if again := addPeekmHooks(settings, script); len(again) != 0 {
+		t.Errorf("second install added %v, want nothing", again)
+	}
+
+	hooks := settings["hooks"].(map[string]interface{})
+	if n := len(hooks["PostToolUse"].([]interface{})); n != 4 {
+		t.Errorf("PostToolUse entries = %d, want 4", n)
+	}
+
+	if removed := removePeekmHooks(hooks, script); removed != 8 {
+		t.Errorf("removed = %d, want 8", removed)
+	}
+	if _, ok := hooks["Stop"]; ok {
+		t.Error("empty Stop event should be dropped")
+	}
+	if n := len(hooks["PostToolUse"].([]interface{})); n != 1 {
+		t.Errorf("PostToolUse entries after uninstall = %d, want 1 (user's own hook)", n)
+	}
+	if settings["model"] != "opus" {
+		t.Error("unrelated settings must be preserved")
+	}
+}
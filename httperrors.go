@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// errorCodeHeader carries the stable code of an error response, also on HEAD
+// requests and to clients reading the body as text
+const errorCodeHeader = "X-Peekm-Error"
+
+// Stable error codes. Handlers name the specific ones with writeError; other
+// errors get the code of their status.
+const (
+	errCodePathOutsideRoot = "path_outside_root" // The path leaves $HOME or the browsed directory
+	errCodeNotWhitelisted  = "not_whitelisted"   // Not a markdown file peekm serves
+	errCodeReadOnly        = "readonly"          // In a subtree a .peekm.toml marks readonly
+	errCodeConflict        = "conflict"
+	errCodeBadRequest      = "bad_request"
+	errCodeUnauthorized    = "unauthorized"
+	errCodeForbidden       = "forbidden"
+	errCodeNotFound        = "not_found"
+	errCodeNotAllowed      = "method_not_allowed"
+	errCodeTooLarge        = "too_large"
+	errCodeTooManyRequests = "too_many_requests"
+	errCodeInternal        = "internal"
+)
+
+// statusErrorCodes are the codes of errors whose handler named none
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:                   errCodeBadRequest,
+	http.StatusUnauthorized:                 errCodeUnauthorized,
+	http.StatusForbidden:                    errCodeForbidden,
+	http.StatusNotFound:                     errCodeNotFound,
+	http.StatusGone:                         errCodeNotFound,
+	http.StatusMethodNotAllowed:             errCodeNotAllowed,
+	http.StatusConflict:                     errCodeConflict,
+	http.StatusRequestEntityTooLarge:        errCodeTooLarge,
+	http.StatusRequestedRangeNotSatisfiable: errCodeBadRequest,
+	http.StatusUnprocessableEntity:          errCodeBadRequest,
+	http.StatusTooManyRequests:              errCodeTooManyRequests,
+}
+
+// apiError is the error of a failed request: a stable code for clients to
+// act on and a message for people
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiErrorResponse is the JSON body of an error response
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+// errorTmpl renders the error page of full page loads
+var errorTmpl *template.Template
+
+// errorTemplateData is the data of the error page
+type errorTemplateData struct {
+	baseTemplateData
+	apiError
+	StatusText string
+	CreateURL  string // Where the page's Create button posts, if what is missing can be created
+}
+
+// writeError answers with an error that has a specific code; withErrors
+// formats it like any other
+func writeError(w http.ResponseWriter, code, message string, status int) {
+	w.Header().Set(errorCodeHeader, code)
+	http.Error(w, message, status)
+}
+
+// pathErrorCode returns the code of a path safepath.Resolve rejected: outside
+// $HOME, or else not one peekm serves (e.g. missing)
+func pathErrorCode(err error) string {
+	if errors.Is(err, safepath.ErrOutsideHome) {
+		return errCodePathOutsideRoot
+	}
+	return errCodeNotWhitelisted
+}
+
+// createErrorStatus returns the status and code of a failure to create a
+// file or directory
+func createErrorStatus(err error) (int, string) {
+	switch {
+	case os.IsExist(err):
+		return http.StatusConflict, errCodeConflict
+	case errors.Is(err, errReadOnly):
+		return http.StatusForbidden, errCodeReadOnly
+	case errors.Is(err, safepath.ErrOutsideHome):
+		return http.StatusForbidden, errCodePathOutsideRoot
+	}
+	return http.StatusInternalServerError, errCodeInternal
+}
+
+// resolveErrorStatus returns the status and code of a path from the request
+// that safepath.Resolve rejected
+func resolveErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, safepath.ErrOutsideHome):
+		return http.StatusForbidden, errCodePathOutsideRoot
+	case errors.Is(err, safepath.ErrNoHomeDir):
+		return http.StatusInternalServerError, errCodeInternal
+	}
+	return http.StatusBadRequest, errCodeBadRequest
+}
+
+// errorCodeFor returns the code of an error response with status, unless
+// the handler named one
+func errorCodeFor(h http.Header, status int) string {
+	if code := h.Get(errorCodeHeader); code != "" {
+		return code
+	}
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return errCodeInternal
+	}
+	return errCodeBadRequest
+}
+
+// errorWriter holds back the plain-text body of an http.Error response for
+// withErrors to format
+type errorWriter struct {
+	http.ResponseWriter
+	err         *apiError // Set once an error response started
+	message     bytes.Buffer
+	wroteHeader bool
+}
+
+func (w *errorWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	// http.Error's signature: a plain-text body that is not to be sniffed
+	if code >= http.StatusBadRequest && h.Get("X-Content-Type-Options") == "nosniff" && strings.HasPrefix(h.Get("Content-Type"), "text/plain") {
+		w.err = &apiError{Status: code, Code: errorCodeFor(h, code)}
+		h.Set(errorCodeHeader, w.err.Code)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.err != nil {
+		return w.message.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps live-update streams flowing through the wrapper
+func (w *errorWriter) Flush() {
+	if w.err == nil {
+		_ = http.NewResponseController(w.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController the connection's own writer
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withErrors sends error responses as JSON ({"error": {"status", "code",
+// "message"}}), or as an error page to browsers loading a whole page
+func withErrors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ew := &errorWriter{ResponseWriter: w}
+		next(ew, r)
+		if ew.err == nil {
+			return
+		}
+		ew.err.Message = strings.TrimSpace(ew.message.String())
+		w.Header().Del("Content-Length")
+		if wantsErrorPage(r) {
+			writeErrorPage(w, r, *ew.err, "")
+			return
+		}
+		writeJSON(w, ew.err.Status, apiErrorResponse{Error: *ew.err})
+	}
+}
+
+// wantsErrorPage reports whether a request is a browser loading a page, as
+// opposed to the API, the page's fetches or tools
+func wantsErrorPage(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) && !isPartialRequest(r) &&
+		!strings.HasPrefix(r.URL.Path, "/api/") && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// writeErrorPage renders the error page, or the plain message if that fails.
+// A createURL adds a button that creates what is missing.
+func writeErrorPage(w http.ResponseWriter, r *http.Request, e apiError, createURL string) {
+	data := errorTemplateData{baseTemplateData: newBaseTemplateData(r), apiError: e, StatusText: http.StatusText(e.Status), CreateURL: createURL}
+	var buf bytes.Buffer
+	if err := errorTmpl.Execute(&buf, data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(e.Status)
+		w.Write([]byte(e.Message + "\n"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(e.Status)
+	buf.WriteTo(w)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+func TestWithErrors(t *testing.T) {
+	handler := withErrors(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/view/secret.md", "/api/file":
+			writeError(w, errCodeNotWhitelisted, "File not found or access denied", http.StatusForbidden)
+		case "/save":
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		case "/delete":
+			writeJSON(w, http.StatusConflict, map[string]string{"reason": "Large file"}) // Already JSON
+		default:
+			w.Write([]byte("ok"))
+		}
+	})
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		accept      string
+		wantCode    int
+		wantType    string
+		wantBody    string
+		wantErrCode string // X-Peekm-Error
+	}{
+		{"named code", "GET", "/api/file", "", http.StatusForbidden, "application/json", `{"error":{"status":403,"code":"not_whitelisted","message":"File not found or access denied"}}`, "not_whitelisted"},
+		{"code of the status", "POST", "/save", "", http.StatusMethodNotAllowed, "application/json", `"code":"method_not_allowed"`, "method_not_allowed"},
+		{"page load", "GET", "/view/secret.md", "text/html,*/*", http.StatusForbidden, "text/html", `data-code="not_whitelisted"`, "not_whitelisted"},
+		{"api from a browser", "GET", "/api/file", "text/html", http.StatusForbidden, "application/json", `"message":"File not found or access denied"`, "not_whitelisted"},
+		{"json error", "POST", "/delete", "", http.StatusConflict, "application/json", `{"reason":"Large file"}`, ""},
+		{"success", "GET", "/view/a.md", "text/html", http.StatusOK, "", "ok", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.wantCode || !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.wantType) {
+				t.Errorf("status = %d, Content-Type %q; want %d, %q", rec.Code, rec.Header().Get("Content-Type"), tt.wantCode, tt.wantType)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want %s in it", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get(errorCodeHeader); got != tt.wantErrCode {
+				t.Errorf("%s = %q, want %q", errorCodeHeader, got, tt.wantErrCode)
+			}
+		})
+	}
+}
+
+func TestRoutesErrors(t *testing.T) {
+	serveTestFiles(t, "errors", nil)
+	handler := routes()
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/raw/missing.md", errCodeNotWhitelisted},
+		{"/api/symbols?path=" + strings.Repeat("../", 20) + "etc/passwd", errCodePathOutsideRoot},
+		{"/api/symbols", errCodeBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		var resp apiErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error.Code != tt.want || resp.Error.Status != rec.Code {
+			t.Errorf("%s = %d %s, want code %s", tt.target, rec.Code, rec.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestCreateErrorStatus(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{os.ErrExist, http.StatusConflict, errCodeConflict},
+		{fmt.Errorf("notes/a.md is %w (readonly = true in .peekm.toml)", errReadOnly), http.StatusForbidden, errCodeReadOnly},
+		{safepath.ErrOutsideHome, http.StatusForbidden, errCodePathOutsideRoot},
+		{errors.New("access denied by the disk"), http.StatusInternalServerError, errCodeInternal}, // Matched by error, not text
+		{errors.New("disk full"), http.StatusInternalServerError, errCodeInternal},
+	}
+	for _, tt := range tests {
+		if status, code := createErrorStatus(tt.err); status != tt.wantStatus || code != tt.wantCode {
+			t.Errorf("createErrorStatus(%v) = %d, %s; want %d, %s", tt.err, status, code, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
+
+func TestResolveErrorStatus(t *testing.T) {
+	_, notExist := safepath.Resolve(filepath.Join(t.TempDir(), "missing"))
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{safepath.ErrOutsideHome, http.StatusForbidden, errCodePathOutsideRoot},
+		{fmt.Errorf("%w: $HOME is not defined", safepath.ErrNoHomeDir), http.StatusInternalServerError, errCodeInternal},
+		{notExist, http.StatusBadRequest, errCodeBadRequest},
+	}
+	for _, tt := range tests {
+		if status, code := resolveErrorStatus(tt.err); status != tt.wantStatus || code != tt.wantCode {
+			t.Errorf("resolveErrorStatus(%v) = %d, %s; want %d, %s", tt.err, status, code, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
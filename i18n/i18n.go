@@ -0,0 +1,151 @@
+// Package i18n translates peekm's user interface. A catalog maps each
+// English UI string to its translation in one language; strings a catalog
+// does not translate stay in English.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Catalog holds the UI strings of one language
+type Catalog struct {
+	lang     string
+	messages map[string]string // English string -> translation
+}
+
+// Parse reads a translation file for lang (a BCP 47 tag such as "de" or
+// "pt-BR"): a JSON object mapping English UI strings to their translation.
+// Empty translations are skipped, so a copy of the English file can be
+// translated a string at a time.
+func Parse(lang string, data []byte) (*Catalog, error) {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	for msg, translation := range messages {
+		if translation == "" {
+			delete(messages, msg)
+		}
+	}
+	return &Catalog{lang: lang, messages: messages}, nil
+}
+
+// Lang returns the catalog's language ("en" for a nil Catalog)
+func (c *Catalog) Lang() string {
+	if c == nil {
+		return "en"
+	}
+	return c.lang
+}
+
+// T translates msg, then formats it with args (fmt verbs) when there are
+// any. A nil Catalog, or one without msg, keeps it in English.
+func (c *Catalog) T(msg string, args ...any) string {
+	if c != nil {
+		if translation, ok := c.messages[msg]; ok {
+			msg = translation
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Messages returns a copy of the catalog's translations, for pages to
+// translate the strings their scripts show (nil for a nil Catalog)
+func (c *Catalog) Messages() map[string]string {
+	if c == nil {
+		return nil
+	}
+	return maps.Clone(c.messages)
+}
+
+// Set is the catalogs available, by language
+type Set struct {
+	catalogs map[string]*Catalog // By lowercased tag
+}
+
+// NewSet collects catalogs; a later catalog for a language replaces an
+// earlier one
+func NewSet(catalogs ...*Catalog) *Set {
+	s := &Set{catalogs: map[string]*Catalog{}}
+	for _, c := range catalogs {
+		s.catalogs[strings.ToLower(c.lang)] = c
+	}
+	return s
+}
+
+// Languages returns the tags of the available catalogs, sorted
+func (s *Set) Languages() []string {
+	var langs []string
+	for _, c := range s.catalogs {
+		langs = append(langs, c.lang)
+	}
+	slices.Sort(langs)
+	return langs
+}
+
+// Get returns the catalog for lang, or for its base language ("pt" for
+// "pt-BR") when there is none; nil if neither is available
+func (s *Set) Get(lang string) *Catalog {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if c, ok := s.catalogs[lang]; ok {
+		return c
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	return s.catalogs[base]
+}
+
+// Negotiate returns the catalog of the most preferred available language
+// in an Accept-Language header, nil if none is available
+func (s *Set) Negotiate(acceptLanguage string) *Catalog {
+	for _, lang := range preferredLanguages(acceptLanguage) {
+		if c := s.Get(lang); c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// preferredLanguages returns the languages of an Accept-Language header,
+// most preferred first, leaving out the wildcard and refused (q=0) ones
+func preferredLanguages(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(part, ";")
+		lang = strings.TrimSpace(lang)
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if lang != "" && lang != "*" && q > 0 {
+			langs = append(langs, weighted{lang, q})
+		}
+	}
+	slices.SortStableFunc(langs, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	preferred := make([]string, len(langs))
+	for i, l := range langs {
+		preferred[i] = l.lang
+	}
+	return preferred
+}
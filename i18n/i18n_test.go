@@ -0,0 +1,71 @@
+package i18n
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCatalogT(t *testing.T) {
+	de, err := Parse("de", []byte(`{"Edit": "Bearbeiten", "Current: %s": "Aktuell: %s", "Delete": ""}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		catalog *Catalog
+		msg     string
+		args    []any
+		want    string
+	}{
+		{de, "Edit", nil, "Bearbeiten"},
+		{de, "Current: %s", []any{"~/docs"}, "Aktuell: ~/docs"},
+		{de, "Delete", nil, "Delete"}, // Left empty: untranslated
+		{de, "Reveal", nil, "Reveal"},
+		{nil, "Current: %s", []any{"~/docs"}, "Current: ~/docs"},
+		{nil, "100% done", nil, "100% done"}, // Not formatted without args
+	}
+	for _, tt := range tests {
+		if got := tt.catalog.T(tt.msg, tt.args...); got != tt.want {
+			t.Errorf("%s.T(%q) = %q, want %q", tt.catalog.Lang(), tt.msg, got, tt.want)
+		}
+	}
+
+	if got := de.Messages(); !reflect.DeepEqual(got, map[string]string{"Edit": "Bearbeiten", "Current: %s": "Aktuell: %s"}) {
+		t.Errorf("Messages() = %v", got)
+	}
+	if (*Catalog)(nil).Messages() != nil {
+		t.Error("Messages() of a nil Catalog: want nil")
+	}
+
+	if _, err := Parse("de", []byte(`{"Edit": 1}`)); err == nil {
+		t.Error("Parse() of a non-string translation: want an error")
+	}
+}
+
+func TestSetNegotiate(t *testing.T) {
+	en, _ := Parse("en", []byte(`{}`))
+	de, _ := Parse("de", []byte(`{}`))
+	ptBR, _ := Parse("pt-BR", []byte(`{}`))
+	set := NewSet(en, de, ptBR)
+	if got := set.Languages(); !reflect.DeepEqual(got, []string{"de", "en", "pt-BR"}) {
+		t.Errorf("Languages() = %v", got)
+	}
+
+	tests := []struct {
+		header string
+		want   *Catalog
+	}{
+		{"de-DE,de;q=0.9,en;q=0.8", de},
+		{"fr, en-US;q=0.7, de;q=0.8", de},
+		{"fr;q=1, en-GB;q=0.9", en},
+		{"pt-br", ptBR},
+		{"de;q=0, en;q=0.5", en},
+		{"*", nil},
+		{"fr", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := set.Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %s, want %s", tt.header, got.Lang(), tt.want.Lang())
+		}
+	}
+}
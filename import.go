@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxImportSize caps /import request bodies (32 MB)
+const maxImportSize = 32 << 20
+
+// importableExtensions are the file types accepted by /import
+var importableExtensions = map[string]bool{
+	".md": true, ".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true,
+}
+
+// importResult is returned by /import
+type importResult struct {
+	Imported []string         `json:"imported"` // Paths relative to the browse directory
+	Skipped  []importSkipInfo `json:"skipped"`
+}
+
+// importSkipInfo explains why an uploaded file was not imported
+type importSkipInfo struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// handleImport saves files dropped onto the browser (multipart "files", optional
+// destination "dir") into browseDir without overwriting existing files
+func handleImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		if isBodyTooLarge(err) {
+			writeError(w, errCodeTooLarge, "Upload too large (at most 32 MB)", http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeError(w, errCodeBadRequest, "Invalid upload (multipart form up to 32 MB expected)", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	destDir := filepath.Clean(strings.TrimPrefix(strings.TrimSpace(r.FormValue("dir")), "/"))
+	if !filepath.IsLocal(destDir) && destDir != "." {
+		writeError(w, errCodePathOutsideRoot, "Destination must be inside the browse directory", http.StatusForbidden)
+		return
+	}
+
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 {
+		writeError(w, errCodeBadRequest, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+
+	result := importResult{Imported: []string{}, Skipped: []importSkipInfo{}}
+	for _, header := range files {
+		relPath, err := importFile(destDir, header)
+		if err != nil {
+			result.Skipped = append(result.Skipped, importSkipInfo{Name: header.Filename, Error: err.Error()})
+			continue
+		}
+		result.Imported = append(result.Imported, relPath)
+	}
+
+	status := http.StatusCreated
+	if len(result.Imported) == 0 {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, result)
+}
+
+// importFile validates and atomically writes one uploaded file, returning its relative path
+func importFile(destDir string, header *multipart.FileHeader) (string, error) {
+	name := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(header.Filename, `\`, "/")))
+	if name == "/" || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid file name")
+	}
+	if !importableExtensions[strings.ToLower(filepath.Ext(name))] {
+		return "", fmt.Errorf("unsupported file type (markdown and images only)")
+	}
+
+	relPath := filepath.Join(destDir, name)
+	absPath := resolveFilePath(relPath)
+	if err := makeParentDirs(absPath); err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(absPath); err == nil {
+		return "", fmt.Errorf("file already exists")
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	content, err := io.ReadAll(src)
+	if err != nil {
+		return "", err
+	}
+	if err := atomicWriteFile(absPath, string(content)); err != nil {
+		return "", err
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	log.Printf("Imported file: %s", absPath)
+	if isMarkdownPath(absPath) && addToWhitelist(absPath) {
+		sendFileEvent("file_added", relPath, "")
+	}
+	return relPath, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandleImport(t *testing.T) {
+	dir := serveTestFiles(t, "import", map[string]string{"existing.md": "# Old\n"})
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("dir", "notes")
+	for name, content := range map[string]string{
+		"new.md":            "# New\n",
+		"diagram.png":       "png",
+		"../escape.md":      "# Escape\n",
+		"script.sh":         "echo hi",
+		"../existing.md":    "# Overwrite\n",
+		"/abs/elsewhere.md": "# Abs\n",
+	} {
+		fw, _ := mw.CreateFormFile("files", name)
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handleImport(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201 (%s)", rec.Code, rec.Body.String())
+	}
+	var result importResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	// Client-side directories are stripped, so ../escape.md lands in notes/
+	if len(result.Imported) != 5 || len(result.Skipped) != 1 || result.Skipped[0].Name != "script.sh" {
+		t.Errorf("result = %+v, want 5 imported and script.sh skipped", result)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "existing.md")); string(got) != "# Old\n" {
+		t.Errorf("existing.md was overwritten: %q", got)
+	}
+	if !isWhitelistedFile(filepath.Join(dir, "notes", "new.md")) || isWhitelistedFile(filepath.Join(dir, "notes", "diagram.png")) {
+		t.Error("only imported markdown files should be whitelisted")
+	}
+
+	// Destinations outside the browse directory are rejected
+	body.Reset()
+	mw = multipart.NewWriter(&body)
+	mw.WriteField("dir", "../outside")
+	fw, _ := mw.CreateFormFile("files", "a.md")
+	fw.Write([]byte("# A\n"))
+	mw.Close()
+	req = httptest.NewRequest("POST", "/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec = httptest.NewRecorder()
+	handleImport(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("escape status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,106 @@
+// Package include expands <!-- include: path --> directives, so a document
+// composed from fragments renders as one. Directives inside fenced code blocks
+// are left alone, and included files lose their front matter.
+package include
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/razvandimescu/peekm/frontmatter"
+)
+
+// MaxDepth is how deeply includes may nest
+const MaxDepth = 8
+
+var (
+	// ErrCycle is reported for a file that (indirectly) includes itself
+	ErrCycle = errors.New("include cycle")
+	// ErrTooDeep is reported for includes nested more than MaxDepth levels
+	ErrTooDeep = errors.New("includes nested too deeply")
+)
+
+// directive matches a line holding only an include comment
+var directive = regexp.MustCompile(`^ {0,3}<!--\s*include:\s*(.*?)\s*-->\s*$`)
+
+// ReadFunc reads an included file. It decides which files may be included.
+type ReadFunc func(path string) ([]byte, error)
+
+// Expand replaces the include directives in source, the content of the file at
+// path, with the files they name. Paths are relative to the including file. An
+// include that cannot be expanded is replaced by a visible error line.
+func Expand(path string, source []byte, read ReadFunc) []byte {
+	if !bytes.Contains(source, []byte("include:")) {
+		return source
+	}
+	return expand(path, source, read, []string{filepath.Clean(path)})
+}
+
+// expand expands the directives of one file; chain holds the files being
+// included, outermost first
+func expand(path string, source []byte, read ReadFunc, chain []string) []byte {
+	var out bytes.Buffer
+	var fence []byte
+	for _, line := range bytes.SplitAfter(source, []byte("\n")) {
+		if marker := fenceMarker(line); marker != nil {
+			if fence == nil {
+				fence = marker
+			} else if bytes.HasPrefix(marker, fence) {
+				fence = nil
+			}
+		}
+		m := directive.FindSubmatch(line)
+		if fence != nil || m == nil || len(m[1]) == 0 {
+			out.Write(line)
+			continue
+		}
+
+		target := string(m[1])
+		included, err := includeFile(filepath.Join(filepath.Dir(path), filepath.FromSlash(target)), read, chain)
+		if err != nil {
+			fmt.Fprintf(&out, "*Cannot include `%s`: %v*\n", target, err)
+			continue
+		}
+		out.Write(included)
+		if len(included) > 0 && included[len(included)-1] != '\n' {
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
+
+// includeFile reads and expands one included file
+func includeFile(path string, read ReadFunc, chain []string) ([]byte, error) {
+	if slices.Contains(chain, path) {
+		return nil, ErrCycle
+	}
+	if len(chain) > MaxDepth {
+		return nil, ErrTooDeep
+	}
+	data, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	_, body, _ := frontmatter.Split(string(data))
+	return expand(path, []byte(body), read, append(slices.Clone(chain), path)), nil
+}
+
+// fenceMarker returns the ``` or ~~~ run opening a line, or nil
+func fenceMarker(line []byte) []byte {
+	trimmed := bytes.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return nil
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	if n < 3 {
+		return nil
+	}
+	return trimmed[:n]
+}
@@ -0,0 +1,81 @@
+package include
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExpand tests nested includes, fences, front matter and failures
+func TestExpand(t *testing.T) {
+	files := map[string]string{
+		"/spec/intro.md":        "---\ntitle: Intro\n---\n## Intro\n\n<!-- include: parts/scope.md -->\n",
+		"/spec/parts/scope.md":  "Scope text.",
+		"/spec/loop.md":         "Loop\n<!-- include: loop.md -->\n",
+		"/spec/chain/0.md":      "<!-- include: 1.md -->\n",
+		"/spec/shared/legal.md": "Legal.\n",
+	}
+	for i := 1; i <= MaxDepth+1; i++ {
+		files[fmt.Sprintf("/spec/chain/%d.md", i)] = fmt.Sprintf("level %d\n<!-- include: %d.md -->\n", i, i+1)
+	}
+	read := func(path string) ([]byte, error) {
+		if content, ok := files[filepath.ToSlash(path)]; ok {
+			return []byte(content), nil
+		}
+		return nil, fs.ErrNotExist
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{
+			name:   "nested include without front matter",
+			source: "# Spec\n<!-- include: intro.md -->\nEnd\n",
+			want:   "# Spec\n## Intro\n\nScope text.\nEnd\n",
+		},
+		{
+			name:   "relative path with spaces around it",
+			source: "   <!--   include:   shared/legal.md   -->\n",
+			want:   "Legal.\n",
+		},
+		{
+			name:   "directive in a code fence is kept",
+			source: "````md\n```\n<!-- include: intro.md -->\n```\n````\n",
+			want:   "````md\n```\n<!-- include: intro.md -->\n```\n````\n",
+		},
+		{
+			name:   "inline comment is not a directive",
+			source: "Text <!-- include: intro.md --> more\n",
+			want:   "Text <!-- include: intro.md --> more\n",
+		},
+		{
+			name:   "missing file",
+			source: "<!-- include: gone.md -->\n",
+			want:   "*Cannot include `gone.md`: " + fs.ErrNotExist.Error() + "*\n",
+		},
+		{
+			name:   "cycle",
+			source: "<!-- include: loop.md -->\n",
+			want:   "Loop\n*Cannot include `loop.md`: " + ErrCycle.Error() + "*\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Expand("/spec/main.md", []byte(tt.source), read)); got != tt.want {
+				t.Errorf("Expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	got := string(Expand("/spec/chain/0.md", []byte(files["/spec/chain/0.md"]), read))
+	if !strings.Contains(got, fmt.Sprintf("level %d\n", MaxDepth)) || strings.Contains(got, fmt.Sprintf("level %d\n", MaxDepth+1)) {
+		t.Errorf("Expand() should stop after %d levels:\n%s", MaxDepth, got)
+	}
+	if !strings.Contains(got, ErrTooDeep.Error()) {
+		t.Errorf("Expand() should report %v:\n%s", ErrTooDeep, got)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const accessTokenCookie = "peekm_token"
+
+var (
+	// LAN access (only set when bound to a non-loopback address)
+	accessToken string // Required from non-loopback clients
+	lanURL      string // Serving URL reachable from other devices (without token)
+)
+
+// connectInfoResponse is returned by /api/connect-info
+type connectInfoResponse struct {
+	URL           string `json:"url"`               // Local URL (always reachable on this machine)
+	LANURL        string `json:"lan_url,omitempty"` // LAN URL with the access token embedded
+	TokenRequired bool   `json:"token_required"`    // Whether non-loopback clients need the token
+	Port          int    `json:"port"`              // Port peekm is serving on
+	Host          string `json:"host"`              // Address peekm is bound to
+}
+
+// isLoopbackHost reports whether a bind address only accepts local connections
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// lanAddress returns the address other devices should use to reach the bind host.
+// Wildcard binds (0.0.0.0, ::, "") resolve to the first non-loopback IPv4 address.
+func lanAddress(host string) (string, error) {
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return host, nil
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", fmt.Errorf("list interface addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		return ipNet.IP.String(), nil
+	}
+	return "", fmt.Errorf("no non-loopback IPv4 address found")
+}
+
+// newAccessToken generates a random token for LAN clients
+func newAccessToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// setupLANAccess prepares token auth and the LAN URL when bound to a non-loopback host
+func setupLANAccess(host string, port int) error {
+	if isLoopbackHost(host) {
+		return nil
+	}
+
+	token, err := newAccessToken()
+	if err != nil {
+		return fmt.Errorf("generate access token: %w", err)
+	}
+	addr, err := lanAddress(host)
+	if err != nil {
+		return err
+	}
+
+	accessToken = token
+	lanURL = fmt.Sprintf("http://%s", net.JoinHostPort(addr, strconv.Itoa(port)))
+	return nil
+}
+
+// lanURLWithToken returns the LAN URL with the access token embedded
+func lanURLWithToken() string {
+	if lanURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/?token=%s", lanURL, accessToken)
+}
+
+// printLANQRCode prints the tokenized LAN URL and a terminal QR code for it
+func printLANQRCode() {
+	target := lanURLWithToken()
+	if target == "" {
+		return
+	}
+
+	fmt.Printf("LAN access at %s\n", target)
+	qr, err := qrcode.New(target, qrcode.Low)
+	if err != nil {
+		log.Printf("Warning: Cannot generate QR code: %v", err)
+		return
+	}
+	fmt.Println(qr.ToSmallString(false))
+}
+
+// isLoopbackRequest reports whether a request originates from this machine
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// withAccessToken requires the access token from non-loopback clients.
+// The token is accepted from ?token= (then remembered in a cookie), the cookie,
+// or the X-Peekm-Token header. Loopback clients (browser, hook script) are exempt.
+func withAccessToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if accessToken == "" || isLoopbackRequest(r) {
+			next(w, r)
+			return
+		}
+
+		if token := r.URL.Query().Get("token"); tokenMatches(token) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     accessTokenCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+			next(w, r)
+			return
+		}
+		if cookie, err := r.Cookie(accessTokenCookie); err == nil && tokenMatches(cookie.Value) {
+			next(w, r)
+			return
+		}
+		if tokenMatches(r.Header.Get("X-Peekm-Token")) {
+			next(w, r)
+			return
+		}
+
+		writeError(w, errCodeUnauthorized, "Unauthorized: missing or invalid access token", http.StatusUnauthorized)
+	}
+}
+
+// tokenMatches compares a candidate against the access token in constant time
+func tokenMatches(candidate string) bool {
+	return candidate != "" && subtle.ConstantTimeCompare([]byte(candidate), []byte(accessToken)) == 1
+}
+
+// serveConnectInfo reports how to reach this instance (used by phones and companion tools)
+func serveConnectInfo(w http.ResponseWriter, r *http.Request) {
+	resp := connectInfoResponse{
+		URL:           fmt.Sprintf("http://localhost:%d", *port),
+		LANURL:        lanURLWithToken(),
+		TokenRequired: accessToken != "",
+		Port:          *port,
+		Host:          *host,
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestWithAccessToken tests that LAN clients need the token while loopback clients don't
+func TestWithAccessToken(t *testing.T) {
+	accessToken = "secret"
+	defer func() { accessToken = "" }()
+
+	handler := withAccessToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		target     string
+		cookie     string
+		header     string
+		wantStatus int
+	}{
+		{name: "loopback without token", remoteAddr: "127.0.0.1:5000", target: "/", wantStatus: http.StatusOK},
+		{name: "lan without token", remoteAddr: "192.168.1.20:5000", target: "/", wantStatus: http.StatusUnauthorized},
+		{name: "lan with wrong token", remoteAddr: "192.168.1.20:5000", target: "/?token=nope", wantStatus: http.StatusUnauthorized},
+		{name: "lan with query token", remoteAddr: "192.168.1.20:5000", target: "/?token=secret", wantStatus: http.StatusOK},
+		{name: "lan with cookie", remoteAddr: "192.168.1.20:5000", target: "/", cookie: "secret", wantStatus: http.StatusOK},
+		{name: "lan with header", remoteAddr: "192.168.1.20:5000", target: "/", header: "secret", wantStatus: http.StatusOK},
+		{name: "lan share api without token", remoteAddr: "192.168.1.20:5000", target: "/api/share", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Peekm-Token", tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
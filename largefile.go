@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/razvandimescu/peekm/i18n"
+)
+
+// apiFileChunkResponse is returned by /api/file-chunk
+type apiFileChunkResponse struct {
+	Path string `json:"path"` // Relative to the browse directory
+	HTML string `json:"html"` // Rendered chunk, ending with the next "Load more" link unless Done
+	From int    `json:"from"` // Byte offset the chunk starts at
+	Next int    `json:"next"` // Byte offset of the next chunk
+	Size int    `json:"size"` // File size in bytes
+	Done bool   `json:"done"` // The chunk reaches the end of the file
+}
+
+// renderLimit returns the --max-render-kb threshold in bytes, 0 for no limit
+func renderLimit() int {
+	return max(0, *maxRenderKB) << 10
+}
+
+// renderFileChunk renders the part of a large file starting at byte from (up
+// to renderLimit bytes, cut at a block boundary), framed by a notice on the
+// first chunk and a "Load more" link when more follows, both in the UI
+// language of messages. It returns the HTML and where the next chunk starts.
+func renderFileChunk(absPath, relPath string, content []byte, from int, messages *i18n.Catalog) (string, int, error) {
+	from = lineStartAt(content, from)
+	next := chunkEnd(content, from, renderLimit())
+
+	// Close a code block the boundary cuts, and reopen it in the next chunk
+	source := content[from:next]
+	if open := openFence(content[:from]); open != "" {
+		source = append([]byte(open+"\n"), source...)
+	}
+	if open := strings.TrimLeft(openFence(source), " "); open != "" {
+		source = append(append(bytes.Clone(source), '\n'), open[:fenceLength(open)]...)
+	}
+	rendered, err := renderFile(absPath, source)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var b strings.Builder
+	rawURL := "/raw/" + (&url.URL{Path: filepath.ToSlash(relPath)}).EscapedPath()
+	if from == 0 && next < len(content) {
+		fmt.Fprintf(&b, "<div class=\"markdown-alert markdown-alert-warning large-file-notice\">\n<p class=\"markdown-alert-title\">%s</p>\n<p>%s <a href=\"%s\">%s</a></p>\n</div>\n",
+			html.EscapeString(messages.T("Large file")),
+			html.EscapeString(messages.T("This file is %s, above the %s render limit, so it is rendered in parts.", formatBytes(len(content)), formatBytes(renderLimit()))),
+			html.EscapeString(rawURL), html.EscapeString(messages.T("View raw")))
+	}
+	b.WriteString(rendered)
+	if next < len(content) {
+		fmt.Fprintf(&b, "<p class=\"load-more\"><a href=\"%s?from=%d\" data-path=\"%s\" data-from=\"%d\">%s</a></p>\n",
+			html.EscapeString(viewURL(relPath)), next, html.EscapeString(filepath.ToSlash(relPath)), next,
+			html.EscapeString(messages.T("Load more (%s left)", formatBytes(len(content)-next))))
+	}
+	return b.String(), next, nil
+}
+
+// lineStartAt moves offset forward to the start of a line
+func lineStartAt(content []byte, offset int) int {
+	offset = min(max(0, offset), len(content))
+	if offset == 0 || content[offset-1] == '\n' {
+		return offset
+	}
+	if i := bytes.IndexByte(content[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(content)
+}
+
+// chunkEnd returns where a chunk of at most limit bytes starting at from
+// should end: after the last blank line outside code blocks, else after the
+// last line break, else at a character boundary
+func chunkEnd(content []byte, from, limit int) int {
+	if limit <= 0 || len(content)-from <= limit {
+		return len(content)
+	}
+	end := from + limit
+	fence := openFence(content[:from])
+	blank, newline := -1, -1
+	for pos := from; pos < end; {
+		i := bytes.IndexByte(content[pos:end], '\n')
+		if i < 0 {
+			break
+		}
+		line := content[pos : pos+i]
+		fence = nextFence(fence, line)
+		if fence == "" && len(bytes.TrimSpace(line)) == 0 {
+			blank = pos + i + 1
+		}
+		newline = pos + i + 1
+		pos = newline
+	}
+	switch {
+	case blank > from:
+		return blank
+	case newline > from:
+		return newline
+	}
+	for end > from && !utf8.RuneStart(content[end]) {
+		end--
+	}
+	return end
+}
+
+// openFence returns the opening line of the code fence still open at the end
+// of source, "" if none
+func openFence(source []byte) string {
+	fence := ""
+	for _, line := range bytes.Split(source, []byte("\n")) {
+		fence = nextFence(fence, line)
+	}
+	return fence
+}
+
+// nextFence returns the open fence after line, given the fence open before it
+func nextFence(fence string, line []byte) string {
+	text := strings.TrimRight(string(line), " \t\r")
+	marker := strings.TrimLeft(text, " ")
+	n := fenceLength(marker)
+	if n == 0 || len(text)-len(marker) > 3 {
+		return fence
+	}
+	if fence == "" {
+		if marker[0] == '`' && strings.Contains(marker[n:], "`") {
+			return "" // Inline code such as ```x```, not a fence
+		}
+		return text
+	}
+	open := strings.TrimLeft(fence, " ")
+	if marker[0] == open[0] && n >= fenceLength(open) && n == len(marker) {
+		return ""
+	}
+	return fence
+}
+
+// fenceLength returns the length of the ``` or ~~~ run starting line, 0 if
+// it does not start with one
+func fenceLength(line string) int {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return 0
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	if n < 3 {
+		return 0
+	}
+	return n
+}
+
+// formatBytes returns a byte count as KB or MB
+func formatBytes(n int) string {
+	if n >= 1<<20 {
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " MB"
+	}
+	return strconv.Itoa((n+1<<10-1)>>10) + " KB"
+}
+
+// serveAPIFileChunk renders the next part of a file too large to render at
+// once (?path=, ?from= byte offset)
+func serveAPIFileChunk(w http.ResponseWriter, r *http.Request) {
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from < 0 {
+		writeError(w, errCodeBadRequest, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	rendered, next, err := renderFileChunk(validated, relPath, content, from, messagesFor(r))
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to render markdown", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiFileChunkResponse{
+		Path: filepath.ToSlash(relPath),
+		HTML: rendered,
+		From: lineStartAt(content, from),
+		Next: next,
+		Size: len(content),
+		Done: next >= len(content),
+	})
+}
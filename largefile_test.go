@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChunkEnd(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		from    int
+		limit   int
+		want    int
+	}{
+		{"fits", "one\n\ntwo\n", 0, 100, 9},
+		{"no limit", "one\n\ntwo\n", 0, 0, 9},
+		{"after the last blank line", "one\n\ntwo\n\nthree four\n", 0, 14, 10},
+		{"blank lines in code blocks don't count", "a\n\n```\nb\n\nc\n```\nd\n", 0, 12, 3},
+		{"a fence open before from", "```\na\n\nb\n```\n\nc\n", 6, 9, 14},
+		{"else after the last line break", "one two\nthree four five\n", 0, 12, 8},
+		{"else at a character boundary", "ééééé", 0, 5, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkEnd([]byte(tt.content), tt.from, tt.limit); got != tt.want {
+				t.Errorf("chunkEnd() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenFence(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"text\n```go\ncode\n", "```go"},
+		{"```go\ncode\n```\n", ""},
+		{"~~~~\n```\nstill code\n", "~~~~"},
+		{"````\n```\n", "````"},
+		{"```inline``` code\n", ""},
+		{"    ```\nindented code\n", ""},
+	}
+	for _, tt := range tests {
+		if got := openFence([]byte(tt.source)); got != tt.want {
+			t.Errorf("openFence(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestRenderFileChunk(t *testing.T) {
+	prevLimit := *maxRenderKB
+	defer func() { *maxRenderKB = prevLimit }()
+	*maxRenderKB = 1
+
+	// A code block straddling the 1 KB boundary
+	content := []byte("# Big\n\n" + strings.Repeat("Filler text.\n\n", 70) + "```\n" + strings.Repeat("code line\n", 40) + "```\n\nThe end.\n")
+	first, next, err := renderFileChunk("/docs/big.md", "big.md", content, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(first, "large-file-notice") || !strings.Contains(first, `href="/view/big.md?from=`) || strings.Contains(first, "The end.") {
+		t.Errorf("first chunk = %q, want the notice, a Load more link and not the end", first)
+	}
+	if next <= 0 || next >= len(content) || content[next-1] != '\n' {
+		t.Fatalf("next = %d, want a line start inside the file", next)
+	}
+
+	var rest strings.Builder
+	for from := next; from < len(content); {
+		chunk, n, err := renderFileChunk("/docs/big.md", "big.md", content, from, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(chunk, "large-file-notice") || strings.Contains(chunk, "<p>code line") {
+			t.Errorf("chunk at %d = %q: notice repeated or code rendered as text", from, chunk)
+		}
+		rest.WriteString(chunk)
+		from = n
+	}
+	if !strings.Contains(rest.String(), "<p>The end.</p>") || strings.Contains(rest.String(), "Load more (0") {
+		t.Errorf("last chunks = %q", rest.String())
+	}
+}
+
+func TestServeAPIFileChunk(t *testing.T) {
+	serveTestFiles(t, "chunk", map[string]string{"big.md": strings.Repeat("Line of text.\n\n", 200)})
+	prevLimit := *maxRenderKB
+	defer func() { *maxRenderKB = prevLimit }()
+	*maxRenderKB = 1
+
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, httptest.NewRequest("GET", "/view/big.md", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "Large file") || !strings.Contains(body, `data-from="1020"`) {
+		t.Errorf("serveFile of a large file: status %d, missing the notice or Load more link", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	serveAPIFileChunk(rec, httptest.NewRequest("GET", "/api/file-chunk?path=big.md&from=2000", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"from":2009`) {
+		t.Errorf("file-chunk = %d %s, want the chunk from the next line start (2009)", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	serveAPIFileChunk(rec, httptest.NewRequest("GET", "/api/file-chunk?path=big.md&from=x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid from: status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,208 @@
+// Package lint checks markdown against a small set of markdownlint-style rules
+// (heading increments, duplicate headings, long lines and bare URLs). It is
+// line based and skips front matter and fenced or indented code.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/razvandimescu/peekm/mdtext"
+)
+
+// Rule identifiers, using markdownlint's numbers and names
+const (
+	RuleHeadingIncrement = "MD001/heading-increment"
+	RuleLineLength       = "MD013/line-length"
+	RuleDuplicateHeading = "MD024/no-duplicate-heading"
+	RuleBareURL          = "MD034/no-bare-urls"
+)
+
+// DefaultMaxLineLength is the line-length limit when Options.MaxLineLength is 0
+const DefaultMaxLineLength = 80
+
+var (
+	atxHeadingPattern    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*))?$`)
+	setextPattern        = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fencePattern         = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	blockStartPattern    = regexp.MustCompile(`^ {0,3}([-+*][ \t]|[>|<]|\d+[.)][ \t])`)
+	referenceDefPattern  = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:`)
+	bareURLPattern       = regexp.MustCompile("https?://[^\\s<>()\\[\\]\"'`]+")
+	bareURLPrecededBy    = `<([="'` // Autolinks, link targets and HTML attributes
+	bareURLTrailingPunct = ".,;:!?" // Sentence punctuation after a URL
+)
+
+// Options configures Check
+type Options struct {
+	// MaxLineLength is the longest allowed line (0 for DefaultMaxLineLength,
+	// negative to disable the rule)
+	MaxLineLength int
+}
+
+// Diagnostic is one rule violation
+type Diagnostic struct {
+	Line    int    `json:"line"`   // 1-based
+	Column  int    `json:"column"` // 1-based, in characters
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// checker holds the state carried between lines
+type checker struct {
+	maxLineLength int
+	fence         string         // Opening fence while inside a fenced code block
+	prevLevel     int            // Level of the previous heading
+	headings      map[string]int // Heading text to the line it first appeared on
+	paragraph     bool           // Previous line continues a paragraph (setext candidate)
+	prevLine      int
+	prevText      string
+	diags         []Diagnostic
+}
+
+// Check lints markdown source and returns its diagnostics ordered by position
+func Check(source []byte, opts Options) []Diagnostic {
+	c := checker{
+		maxLineLength: opts.MaxLineLength,
+		headings:      make(map[string]int),
+		diags:         []Diagnostic{},
+	}
+	if c.maxLineLength == 0 {
+		c.maxLineLength = DefaultMaxLineLength
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(source), "\r\n", "\n"), "\n")
+	for i := frontMatterEnd(lines); i < len(lines); i++ {
+		c.checkLine(i+1, lines[i])
+	}
+
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		if c.diags[i].Line != c.diags[j].Line {
+			return c.diags[i].Line < c.diags[j].Line
+		}
+		return c.diags[i].Column < c.diags[j].Column
+	})
+	return c.diags
+}
+
+// frontMatterEnd returns the index of the first line after YAML front matter (0 if none)
+func frontMatterEnd(lines []string) int {
+	if len(lines) == 0 || strings.TrimRight(lines[0], " \t") != "---" {
+		return 0
+	}
+	for i := 1; i < len(lines); i++ {
+		if end := strings.TrimRight(lines[i], " \t"); end == "---" || end == "..." {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// checkLine applies the rules to one line
+func (c *checker) checkLine(num int, text string) {
+	if c.fence != "" {
+		if closesFence(text, c.fence) {
+			c.fence = ""
+		}
+		return
+	}
+	if m := fencePattern.FindStringSubmatch(text); m != nil {
+		c.fence = m[1]
+		c.paragraph = false
+		return
+	}
+	if !c.paragraph && (strings.HasPrefix(text, "    ") || strings.HasPrefix(text, "\t")) {
+		return // Indented code block
+	}
+
+	if m := setextPattern.FindStringSubmatch(text); m != nil && c.paragraph {
+		level := 1
+		if m[1][0] == '-' {
+			level = 2
+		}
+		c.heading(c.prevLine, level, strings.TrimSpace(c.prevText))
+		c.paragraph = false
+		return
+	}
+
+	c.lineLength(num, text)
+	if m := atxHeadingPattern.FindStringSubmatch(text); m != nil {
+		c.heading(num, len(m[1]), atxHeadingText(m[2]))
+		c.paragraph = false
+		return
+	}
+	c.bareURLs(num, text)
+
+	c.paragraph = strings.TrimSpace(text) != "" && !blockStartPattern.MatchString(text)
+	c.prevLine, c.prevText = num, text
+}
+
+// closesFence reports whether text closes a code block opened with fence
+func closesFence(text, fence string) bool {
+	trimmed := strings.TrimLeft(text, " ")
+	return len(text)-len(trimmed) <= 3 &&
+		strings.HasPrefix(trimmed, fence) &&
+		strings.Trim(trimmed, fence[:1]+" \t") == ""
+}
+
+// atxHeadingText strips the optional closing #s from an ATX heading
+func atxHeadingText(text string) string {
+	text = strings.TrimSpace(text)
+	if stripped := strings.TrimRight(text, "#"); stripped == "" || strings.HasSuffix(stripped, " ") || strings.HasSuffix(stripped, "\t") {
+		text = strings.TrimSpace(stripped)
+	}
+	return text
+}
+
+// heading checks heading increments and duplicates
+func (c *checker) heading(num, level int, text string) {
+	if c.prevLevel > 0 && level > c.prevLevel+1 {
+		c.report(num, 1, RuleHeadingIncrement, fmt.Sprintf("Heading levels should only increment by one level at a time (expected h%d, got h%d)", c.prevLevel+1, level))
+	}
+	c.prevLevel = level
+
+	if first, found := c.headings[text]; found {
+		c.report(num, 1, RuleDuplicateHeading, fmt.Sprintf("Duplicate heading %q (first on line %d)", text, first))
+		return
+	}
+	c.headings[text] = num
+}
+
+// lineLength flags lines over the limit, except tables and lines where only a
+// single long word (such as a URL) crosses it
+func (c *checker) lineLength(num int, text string) {
+	if c.maxLineLength < 0 || utf8.RuneCountInString(text) <= c.maxLineLength {
+		return
+	}
+	if strings.HasPrefix(strings.TrimSpace(text), "|") {
+		return
+	}
+	runes := []rune(text)
+	if !strings.ContainsAny(string(runes[c.maxLineLength:]), " \t") {
+		return
+	}
+	c.report(num, c.maxLineLength+1, RuleLineLength, fmt.Sprintf("Line length %d exceeds %d characters", len(runes), c.maxLineLength))
+}
+
+// bareURLs flags URLs that are not autolinks (<https://...>) or link targets
+func (c *checker) bareURLs(num int, text string) {
+	if referenceDefPattern.MatchString(text) {
+		return
+	}
+	masked := mdtext.MaskCodeSpans(text)
+	for _, loc := range bareURLPattern.FindAllStringIndex(masked, -1) {
+		if loc[0] > 0 && strings.IndexByte(bareURLPrecededBy, masked[loc[0]-1]) >= 0 {
+			continue
+		}
+		url := strings.TrimRight(masked[loc[0]:loc[1]], bareURLTrailingPunct)
+		column := utf8.RuneCountInString(text[:loc[0]]) + 1
+		c.report(num, column, RuleBareURL, fmt.Sprintf("Bare URL %s (wrap it in <> or use a link)", url))
+	}
+}
+
+// report records a diagnostic
+func (c *checker) report(num, column int, rule, message string) {
+	c.diags = append(c.diags, Diagnostic{Line: num, Column: column, Rule: rule, Message: message})
+}
@@ -0,0 +1,93 @@
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// rules returns "line:column rule" for each diagnostic
+func rules(diags []Diagnostic) []string {
+	var got []string
+	for _, d := range diags {
+		got = append(got, fmt.Sprintf("%d:%d %s", d.Line, d.Column, d.Rule))
+	}
+	return got
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		opts   Options
+		want   []string
+	}{
+		{
+			name:   "clean document",
+			source: "# Title\n\n## Section\n\nText with <https://example.com>.\n",
+			want:   nil,
+		},
+		{
+			name:   "heading increment",
+			source: "# Title\n\n### Skipped\n\n## Back\n\n### Fine\n",
+			want:   []string{"3:1 " + RuleHeadingIncrement},
+		},
+		{
+			name:   "duplicate headings including setext",
+			source: "# Title\n\nTitle\n=====\n\n## Notes ##\n\n## Notes\n",
+			want:   []string{"3:1 " + RuleDuplicateHeading, "8:1 " + RuleDuplicateHeading},
+		},
+		{
+			name:   "long lines",
+			source: "one two three four five\nshort\n<https://example.com/a-very-long-single-word>\n| a | table row that is long |\n",
+			opts:   Options{MaxLineLength: 10},
+			want:   []string{"1:11 " + RuleLineLength},
+		},
+		{
+			name:   "line length disabled",
+			source: "one two three four five\n",
+			opts:   Options{MaxLineLength: -1},
+			want:   nil,
+		},
+		{
+			name:   "bare urls",
+			source: "See https://a.com, [b](https://b.com), <https://c.com>, `https://d.com` and é https://e.com.\n\n[ref]: https://f.com\n",
+			want:   []string{"1:5 " + RuleBareURL, "1:79 " + RuleBareURL},
+		},
+		{
+			name:   "code blocks and front matter are skipped",
+			source: "---\ntitle: https://a.com\n---\n# Title\n\n```md\n### https://b.com\n```\n\n    https://c.com\n",
+			want:   nil,
+		},
+		{
+			name:   "hashtags and lists are not headings",
+			source: "#tag\n\n- item\n---\n",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules(Check([]byte(tt.source), tt.opts))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMessages(t *testing.T) {
+	diags := Check([]byte("# A\n\n### B\n\n# A\n"), Options{})
+	want := []string{
+		"Heading levels should only increment by one level at a time (expected h2, got h3)",
+		`Duplicate heading "A" (first on line 1)`,
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d", len(diags), len(want))
+	}
+	for i, d := range diags {
+		if d.Message != want[i] {
+			t.Errorf("message %d = %q, want %q", i, d.Message, want[i])
+		}
+	}
+}
@@ -1,35 +1,39 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"container/list"
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
-	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
-	"github.com/fsnotify/fsnotify"
+	"github.com/razvandimescu/peekm/i18n"
+	"github.com/razvandimescu/peekm/render"
+	"github.com/razvandimescu/peekm/safepath"
+	"github.com/razvandimescu/peekm/tree"
+	"github.com/razvandimescu/peekm/watch"
 	"github.com/yuin/goldmark"
-	highlighting "github.com/yuin/goldmark-highlighting/v2"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
 )
 
 //go:embed theme/*
@@ -41,44 +45,71 @@ var (
 	commit  = "none"
 	date    = "unknown"
 
-	// Hardcoded directory exclusions (common build artifacts and dependencies)
-	hardcodedExclusions = []string{
-		"node_modules", // Node.js dependencies
-		"vendor",       // Go dependencies
-		"dist",         // Build output
-		"venv",         // Python virtual environment
-		"env",          // Python virtual environment (alternative name)
-		"virtualenv",   // Python virtual environment (alternative name)
-	}
-
-	// Map version for O(1) lookup performance
-	hardcodedExclusionsMap = map[string]bool{
-		"node_modules": true,
-		"vendor":       true,
-		"dist":         true,
-		"venv":         true,
-		"env":          true,
-		"virtualenv":   true,
-	}
-
 	// Flags
 	port        = flag.Int("port", 6419, "Port to serve on")
+	host        = flag.String("host", "localhost", "Address to bind (e.g. 0.0.0.0 for LAN access with a token)")
 	openBrowser = flag.Bool("browser", true, "Open browser automatically")
+	browserCmd  = flag.String("browser-cmd", "", "Command used to open the browser, e.g. \"firefox --private-window\" (default: $BROWSER or the system opener)")
 	showVersion = flag.Bool("version", false, "Show version information")
 	showIgnored = flag.Bool("show-ignored", false, "Show all excluded directories and exit")
 	disableHook = flag.Bool("no-ai-tracking", false, "Disable AI session tracking endpoint")
+	useMDNS     = flag.Bool("mdns", false, "Advertise on the local network via mDNS as _peekm._tcp (requires --host)")
+	wikiMode    = flag.Bool("wiki", false, "Enable wiki mode ([[Page]] links, create missing pages on click)")
+	vaultMode   = flag.Bool("vault", false, "Obsidian vault mode: wiki mode plus ![[embeds]], > [!note] callouts and #tags")
+	noWatch     = flag.Bool("no-watch", false, "Disable file watching (no live reload or new-file detection)")
+	noTrash     = flag.Bool("no-trash", false, "Delete files permanently instead of moving them to the trash (same as --delete=permanent)")
+	deleteMode  = flag.String("delete", deleteTrash, "What deleting a file does: trash, permanent or disabled")
+	confirmKB   = flag.Int("confirm-delete-kb", 100, "Deleting files of this size or larger (or outside the browsed directory) needs a second confirmation")
+	once        = flag.Bool("once", false, "Exit after the first page load (implies --no-watch and --no-index)")
+	noIndex     = flag.Bool("no-index", false, "Disable the full-text search index")
+	respectGit  = flag.Bool("respect-gitignore", false, "Also skip the files and directories .gitignore files exclude (including nested ones)")
+	maxRenderKB = flag.Int("max-render-kb", 2048, "Render larger files in parts of this size, loaded on demand (0 renders files whole)")
+	replaySize  = flag.Int("event-buffer", 50, "Number of recent live-update events replayed to reconnecting browsers")
+	eventLog    = flag.String("event-log", "", "Append live-update events to this file and reload them on restart, so browsers reconnecting across restarts miss nothing")
+	notify      = flag.Bool("notify", false, "Show desktop notifications when AI sessions create files or finish")
+	follow      = flag.Bool("follow", false, "Open files in the browser as AI sessions create or modify them")
+	hookSecret  = flag.String("hook-secret", "", "Require hook requests signed with this HMAC-SHA256 secret (default: $PEEKM_HOOK_SECRET)")
+	anchor      = flag.String("anchor", "", "Heading anchor to open in the target file (or use FILE.md#anchor)")
+	today       = flag.Bool("today", false, "Open today's daily note, creating it if needed (same as \"peekm today\")")
+	dailyPath   = flag.String("daily-path", "notes/{{date}}.md", "Path pattern for daily notes, relative to the browsed directory")
+	dailyTmpl   = flag.String("daily-template", defaultDailyTemplate, "Template for new daily notes (plain heading if it does not exist)")
+	diagrams    = flag.Bool("diagrams", false, "Render mermaid, PlantUML and dot blocks to SVG on the server (mmdc, plantuml, dot or --kroki-url)")
+	krokiURL    = flag.String("kroki-url", "", "Kroki server for diagrams without a local tool, e.g. https://kroki.io (default: $PEEKM_KROKI_URL)")
+	preRender   = flag.String("pre-render", "", "Command that rewrites each file's markdown before rendering (stdin to stdout; $PEEKM_FILE is the file)")
+	stableLinks = flag.Bool("stable-links", false, "Show a /p/ permalink for each file that keeps working when it is renamed or moved")
+	postRender  = flag.String("post-render", "", "Command that rewrites each file's rendered HTML (stdin to stdout; $PEEKM_FILE is the file)")
+	rateLimit   = flag.Int("rate-limit", 20, "Requests per second each client IP may make to endpoints that write files or switch directories (/save, /import, /navigate, /api/replace, /api/comments, hooks, ...), in bursts of up to twice that (0 disables)")
+	logRequests = flag.Bool("log-requests", false, "Log each HTTP request with its status and duration")
+	readTimeout = flag.Duration("read-timeout", 15*time.Second, "Time allowed to read a request, headers and body (0 for no limit)")
+	idleTimeout = flag.Duration("idle-timeout", 60*time.Second, "How long an idle keep-alive connection stays open (0 uses --read-timeout)")
+	keepalive   = flag.Duration("keepalive", 10*time.Second, "Interval of the keepalive comments sent on idle live-update connections (at least 1s)")
+	uiLang      = flag.String("lang", "", "UI language, e.g. de (default: the browser's Accept-Language, English when no translation matches)")
+
+	// AI session data limits
+	sessionRetention = flag.Duration("session-retention", 0, "Forget AI session data (badges, diffs, hook events) not updated for this long, e.g. 72h (0 keeps it while peekm runs)")
+	sessionMaxFiles  = flag.Int("session-max-files", 2000, "Files to keep AI session badges and diff snapshots for; the least recently modified are forgotten first (0 for no limit)")
+
+	// Markdown rendering switches
+	typographer     = flag.Bool("typographer", true, "Render typographic quotes, dashes and ellipses")
+	headingIDs      = flag.Bool("heading-ids", true, "Add id anchors to headings (the TOC and #anchor links need them)")
+	permalinks      = flag.Bool("permalinks", true, "Show a permalink next to headings on hover")
+	hardWraps       = flag.Bool("hard-wraps", false, "Render every newline inside a paragraph as a line break")
+	unsafeHTML      = flag.Bool("unsafe-html", true, "Pass raw HTML in markdown through (false omits it)")
+	linkify         = flag.String("linkify", "", "Comma-separated URL schemes autolinked in plain text, e.g. \"https,mailto\", or \"none\" (default: http, https and ftp)")
+	eastAsianBreaks = flag.Bool("east-asian-line-breaks", false, "Typeset Chinese and Japanese: drop line breaks next to East Asian characters instead of rendering spaces")
+	criticMarkup    = flag.Bool("criticmarkup", true, "Render CriticMarkup ({++add++}, {--delete--}, {~~old~>new~~}, {==mark==}, {>>comment<<}) as tracked changes")
 
 	// State (global for single-user CLI simplicity; protected by mutexes)
-	clients      = make(map[chan string]bool)
+	clients      = make(map[uint64]*sseClient) // Open /events connections by ID
 	clientsMutex sync.RWMutex
 
 	// Browser mode (always active)
-	markdownFiles []string
-	currentFile   string
+	markdownFiles = newFileSet(nil) // Whitelist of the markdown files peekm serves
+	createdDirs   []string          // Directories created via /mkdir, shown in the tree even when empty
 	fileMutex     sync.RWMutex
 	browseDir     string
-	fileWatcher   watcherManager
-	dirWatcher    watcherManager
+	fileWatcher   watch.Manager
+	dirWatcher    watch.Manager
 
 	// Ignore pattern cache (reduces file I/O on navigation)
 	globalIgnoreCache struct {
@@ -96,20 +127,17 @@ var (
 	fileBrowserTmpl        *template.Template
 	fileBrowserPartialTmpl *template.Template
 
-	// SSE event replay buffer (50 events = ~2 min of AI file creation)
+	// Closed after the first full page load when --once is set
+	firstPageServed     = make(chan struct{})
+	firstPageServedOnce sync.Once
+
+	// SSE event replay buffer, resized by --event-buffer (50 events = ~2 min of AI file creation)
 	globalEventBuffer = newEventBuffer(50)
 
 	// Claude Code session tracking (5s TTL for hook-to-fsnotify correlation)
 	globalSessionStore *sessionStore
 )
 
-// watcherManager manages file watching with proper cleanup
-type watcherManager struct {
-	mu      sync.Mutex
-	current *fsnotify.Watcher
-	cancel  context.CancelFunc
-}
-
 // baseTemplateData contains common fields for all templates
 type baseTemplateData struct {
 	GitHubCSS      template.CSS
@@ -117,6 +145,19 @@ type baseTemplateData struct {
 	ThemeManagerJS template.JS
 	EditorJS       template.JS
 	NavigationJS   template.JS
+	Lang           string // Language of the UI strings
+	messages       *i18n.Catalog
+}
+
+// T translates a UI string for the page, {{.T "Edit"}} in templates (see
+// i18n.Catalog.T)
+func (d baseTemplateData) T(msg string, args ...any) string {
+	return d.messages.T(msg, args...)
+}
+
+// Messages returns the page's translations, for t() in its scripts
+func (d baseTemplateData) Messages() map[string]string {
+	return d.messages.Messages()
 }
 
 // browserTemplateData is used for rendering the file browser and file views
@@ -127,8 +168,20 @@ type browserTemplateData struct {
 	TreeHTML       template.HTML
 	ShowBackButton bool
 	Content        template.HTML
+	RenderHash     string // Identifies a whole render that live updates can patch
+	LateRenderHash string // RenderHash of a streamed document, sent after it (see streamTemplate)
 	BrowsePath     string
 	SessionData    *SessionMetadata // Claude Code session info for this file
+	EditPath       string           // Relative path used by the no-JavaScript edit link and form
+	EditMode       bool             // Render a plain save form instead of the document (?edit=1)
+	RawContent     string           // Markdown source for the edit form
+	DeleteMode     string           // --delete: the delete button is hidden when "disabled"
+	ReadOnly       bool             // In a subtree a .peekm.toml marks readonly: no edit or delete buttons
+	MissingAnchor  string           // Requested ?anchor= that matches no heading
+	Anchors        []string         // Available heading anchors (listed when MissingAnchor is set)
+	Breadcrumbs    breadcrumbTrail  // Path components of BrowsePath and the file, with navigate-up targets
+	Scanning       bool             // The startup scan is still looking for markdown files
+	Permalink      string           // The file's /p/ URL (--stable-links)
 }
 
 // fileEventMessage is used for SSE notifications about file changes
@@ -138,6 +191,14 @@ type fileEventMessage struct {
 	Session string `json:"session,omitempty"` // Optional Claude Code session ID
 }
 
+// fileModifiedMessage is used for SSE notifications that a watched file changed
+type fileModifiedMessage struct {
+	Type  string       `json:"type"` // "file_modified"
+	Path  string       `json:"path"` // Absolute
+	View  string       `json:"view"` // Relative with forward slashes, as in /view/ URLs
+	Patch *renderPatch `json:"patch,omitempty"`
+}
+
 // connectionStatusMessage is used for SSE notifications about connection status
 type connectionStatusMessage struct {
 	Type  string `json:"type"`  // "connection_status"
@@ -156,10 +217,13 @@ type eventBuffer struct {
 	events  []eventRecord
 	counter uint64
 	maxSize int
+	logFile *os.File      // Events are appended here when --event-log is set
+	added   chan struct{} // Closed by the next add (see next)
 }
 
-// newEventBuffer creates an eventBuffer with specified capacity
+// newEventBuffer creates an eventBuffer with specified capacity (at least 1)
 func newEventBuffer(maxSize int) *eventBuffer {
+	maxSize = max(1, maxSize)
 	return &eventBuffer{
 		events:  make([]eventRecord, 0, maxSize),
 		maxSize: maxSize,
@@ -184,32 +248,58 @@ func (eb *eventBuffer) add(data string) string {
 		eb.events = eb.events[1:]
 	}
 	eb.events = append(eb.events, evt)
+	eb.appendToLog(evt)
+	if eb.added != nil {
+		close(eb.added)
+		eb.added = nil
+	}
 
 	return id
 }
 
-// getAfter returns all events after the specified ID
-func (eb *eventBuffer) getAfter(lastID string) []eventRecord {
+// next returns a channel closed when the next event is added
+func (eb *eventBuffer) next() <-chan struct{} {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.added == nil {
+		eb.added = make(chan struct{})
+	}
+	return eb.added
+}
+
+// getAfter returns all events after the specified ID, or all events when
+// lastID is "" (before the first one). found is false when the ID is no
+// longer (or was never) in the buffer, so events may be missing.
+func (eb *eventBuffer) getAfter(lastID string) (result []eventRecord, found bool) {
 	eb.mu.RLock()
 	defer eb.mu.RUnlock()
 
-	var result []eventRecord
-	foundLast := false
-
+	found = lastID == "" && eb.counter == uint64(len(eb.events)) // Nothing dropped yet
 	for _, evt := range eb.events {
-		if foundLast {
+		if found {
 			result = append(result, evt)
 		}
 		if evt.id == lastID {
-			foundLast = true
+			found = true
 		}
 	}
 
-	return result
+	return result, found
+}
+
+// lastID returns the ID of the latest event, "" if there is none
+func (eb *eventBuffer) lastID() string {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+	if len(eb.events) == 0 {
+		return ""
+	}
+	return eb.events[len(eb.events)-1].id
 }
 
 // SessionMetadata contains complete Claude Code session information
 type SessionMetadata struct {
+	Source         string    `json:"source,omitempty"` // Agent that reported the change (e.g. "claude-code", "cursor")
 	SessionID      string    `json:"session_id"`
 	ToolName       string    `json:"tool_name"`
 	PermissionMode string    `json:"permission_mode,omitempty"`
@@ -219,24 +309,43 @@ type SessionMetadata struct {
 	Timestamp      time.Time `json:"timestamp"`
 }
 
-// sessionStore maintains persistent mapping of file paths to session metadata
+// sessionStore maintains the mapping of file paths to session metadata, plus
+// the typed hook events received for each session. It is bounded by
+// --session-max-files and maxTrackedSessions, and --session-retention (see
+// sessionretention.go).
 type sessionStore struct {
 	mu       sync.RWMutex
 	mappings map[string]*SessionMetadata
+	events   map[string][]sessionEvent // Keyed by session ID, oldest first
+	active   map[string]bool           // Sessions between their first tool event and Stop
+
+	snapshots map[string]*fileSnapshot // Pre-modification content, keyed by file path
+
+	files     *list.List               // *trackedFile with a mapping or snapshot, most recently modified first
+	fileElems map[string]*list.Element // files' elements by path
+	pruned    sessionPruneCounts
 }
 
-// newSessionStore creates a session store (session data persists indefinitely)
+// newSessionStore creates a session store
 func newSessionStore() *sessionStore {
 	return &sessionStore{
 		mappings: make(map[string]*SessionMetadata),
+		events:   make(map[string][]sessionEvent),
+		active:   make(map[string]bool),
+
+		snapshots: make(map[string]*fileSnapshot),
+
+		files:     list.New(),
+		fileElems: make(map[string]*list.Element),
 	}
 }
 
-// register stores session metadata for a file path (persists indefinitely)
+// register stores session metadata for a file path
 func (ss *sessionStore) register(filePath string, metadata *SessionMetadata) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 	ss.mappings[filePath] = metadata
+	ss.touchFileLocked(filePath)
 }
 
 // get retrieves session metadata for a file path
@@ -248,198 +357,63 @@ func (ss *sessionStore) get(filePath string) (*SessionMetadata, bool) {
 }
 
 // newBaseTemplateData creates a baseTemplateData with embedded resources
-func newBaseTemplateData() baseTemplateData {
+func newBaseTemplateData(r *http.Request) baseTemplateData {
+	messages := messagesFor(r)
 	return baseTemplateData{
 		GitHubCSS:      template.CSS(githubCSS),
 		ThemeOverrides: template.CSS(themeOverrides),
 		ThemeManagerJS: template.JS(themeManagerJS),
 		EditorJS:       template.JS(editorJS),
 		NavigationJS:   template.JS(navigationJS),
+		Lang:           messages.Lang(),
+		messages:       messages,
 	}
 }
 
-func (m *watcherManager) watch(filePath string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Stop existing watcher
-	if m.cancel != nil {
-		m.cancel()
-	}
-	if m.current != nil {
-		m.current.Close()
-	}
-
-	// Start new watcher
-	ctx, cancel := context.WithCancel(context.Background())
-	m.cancel = cancel
-
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
-	}
-	m.current = watcher
-
-	if err := watcher.Add(filePath); err != nil {
-		if closeErr := watcher.Close(); closeErr != nil {
-			log.Printf("Failed to close watcher after add error: %v", closeErr)
-		}
-		cancel()
-		return err
-	}
-
-	go watchFileWithContext(ctx, watcher, filePath)
-	return nil
+// newMarkdownRenderer creates a configured goldmark renderer
+func newMarkdownRenderer() goldmark.Markdown {
+	return render.New(markdownOptions())
 }
 
-func (m *watcherManager) watchDirectory(rootDir string) error {
-	m.mu.Lock()
-
-	// Stop existing watcher (under lock)
-	if m.cancel != nil {
-		m.cancel()
+// markdownOptions returns the renderer options for the current flags
+func markdownOptions() render.Options {
+	opts := render.Options{
+		NoTypographer:       !*typographer,
+		NoHeadingIDs:        !*headingIDs,
+		NoPermalinks:        !*permalinks,
+		HardWraps:           *hardWraps,
+		EscapeHTML:          !*unsafeHTML,
+		LinkifySchemes:      linkifySchemes(*linkify),
+		EastAsianLineBreaks: *eastAsianBreaks,
+		CriticMarkup:        *criticMarkup,
 	}
-	if m.current != nil {
-		m.current.Close()
+	if *wikiMode {
+		opts.WikiLinks = resolveWikiTarget
+		opts.PageURL = viewURL
 	}
-
-	// Start new watcher
-	ctx, cancel := context.WithCancel(context.Background())
-	m.cancel = cancel
-
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		m.mu.Unlock()
-		return err
+	if *vaultMode {
+		opts.Embeds = vaultEmbedResolver(nil)
+		opts.Callouts = true
+		opts.Tags = true
 	}
-	m.current = watcher
-
-	// Add root directory
-	if err := watcher.Add(rootDir); err != nil {
-		if closeErr := watcher.Close(); closeErr != nil {
-			log.Printf("Failed to close watcher after add error: %v", closeErr)
-		}
-		cancel()
-		m.current = nil
-		m.cancel = nil
-		m.mu.Unlock()
-		return err
+	if *diagrams {
+		opts.Diagrams = sharedDiagramRenderer().Render
 	}
-
-	// Unlock before slow directory walk
-	m.mu.Unlock()
-
-	// Collect directories to watch (without lock to avoid blocking on large trees)
-	dirsToWatch, err := m.collectDirectories(rootDir)
-	if err != nil {
-		m.mu.Lock()
-		// Clean up if we still own this watcher
-		if m.current == watcher {
-			if closeErr := watcher.Close(); closeErr != nil {
-				log.Printf("Failed to close watcher after directory walk error: %v", closeErr)
-			}
-			cancel()
-			m.current = nil
-			m.cancel = nil
-		}
-		m.mu.Unlock()
-		return fmt.Errorf("directory walk failed: %w", err)
-	}
-
-	// Re-acquire lock to finish setup
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Check if watcher was replaced during walk
-	if m.current != watcher {
-		// Another call won the race, abandon this setup
-		if closeErr := watcher.Close(); closeErr != nil {
-			log.Printf("Failed to close abandoned watcher: %v", closeErr)
-		}
-		cancel()
-		return fmt.Errorf("watcher setup cancelled (replaced during walk)")
-	}
-
-	// Add directories (holding lock)
-	for _, dir := range dirsToWatch {
-		if err := watcher.Add(dir); err != nil {
-			log.Printf("Warning: Cannot watch directory %s: %v", dir, err)
-		}
-	}
-
-	go watchDirectoryWithContext(ctx, watcher)
-	return nil
+	return opts
 }
 
-// collectDirectories walks the directory tree and returns paths to watch
-func (m *watcherManager) collectDirectories(rootDir string) ([]string, error) {
-	var dirsToWatch []string
-	homeDir, _ := os.UserHomeDir()
-
-	customPatterns := getIgnorePatterns(rootDir)
-
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Security: Skip symlinks outside $HOME
-		resolvedInfo, _, resolveErr := validateSymlinkSecurity(path, info, homeDir)
-		if resolveErr != nil {
-			return nil
-		}
-		if resolvedInfo != nil {
-			info = resolvedInfo
-		}
-
-		if info.IsDir() && path != rootDir {
-			if isExcludedDir(info.Name(), customPatterns) {
-				return filepath.SkipDir
-			}
-			dirsToWatch = append(dirsToWatch, path)
-		}
-
+// linkifySchemes parses --linkify: nil for goldmark's default, empty for "none"
+func linkifySchemes(value string) []string {
+	if strings.TrimSpace(value) == "" {
 		return nil
-	})
-
-	if err != nil {
-		return nil, err
 	}
-
-	return dirsToWatch, nil
-}
-
-func (m *watcherManager) close() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if m.cancel != nil {
-		m.cancel()
-	}
-	if m.current != nil {
-		m.current.Close()
+	schemes := []string{}
+	for _, scheme := range strings.Split(value, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" && scheme != "none" {
+			schemes = append(schemes, scheme)
+		}
 	}
-}
-
-// newMarkdownRenderer creates a configured goldmark renderer
-func newMarkdownRenderer() goldmark.Markdown {
-	return goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			extension.Typographer,
-			highlighting.NewHighlighting(
-				highlighting.WithFormatOptions(
-					chromahtml.WithClasses(true),
-				),
-			),
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			html.WithUnsafe(),
-		),
-	)
+	return schemes
 }
 
 // withRecovery wraps an HTTP handler with panic recovery
@@ -448,7 +422,7 @@ func withRecovery(next http.HandlerFunc) http.HandlerFunc {
 		defer func() {
 			if err := recover(); err != nil {
 				log.Printf("PANIC: %v\n%s", err, debug.Stack())
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				writeError(w, errCodeInternal, "Internal server error", http.StatusInternalServerError)
 			}
 		}()
 		next(w, r)
@@ -459,133 +433,158 @@ func withRecovery(next http.HandlerFunc) http.HandlerFunc {
 func withCSRFCheck(next http.HandlerFunc) http.HandlerFunc {
 	allowedLocal := fmt.Sprintf("http://localhost:%d", *port)
 	allowedLoopback := fmt.Sprintf("http://127.0.0.1:%d", *port)
+	allowedLAN := lanURL // Empty unless bound to a LAN address
 	return func(w http.ResponseWriter, r *http.Request) {
-		if origin := r.Header.Get("Origin"); origin != "" && origin != allowedLocal && origin != allowedLoopback {
+		if origin := r.Header.Get("Origin"); origin != "" && origin != allowedLocal && origin != allowedLoopback && (allowedLAN == "" || origin != allowedLAN) {
 			log.Printf("CSRF: rejected cross-origin POST from %s", origin)
-			http.Error(w, "Forbidden: cross-origin request", http.StatusForbidden)
+			writeError(w, errCodeForbidden, "Forbidden: cross-origin request", http.StatusForbidden)
 			return
 		}
 		next(w, r)
 	}
 }
 
-// registerRoutes registers all HTTP routes
-func registerRoutes() {
-	http.HandleFunc("/", withRecovery(serveBrowser))
-	http.HandleFunc("/view/", withRecovery(serveFile))
-	http.HandleFunc("/navigate", withRecovery(withCSRFCheck(handleNavigate)))
-	http.HandleFunc("/delete", withRecovery(withCSRFCheck(handleDelete)))
-	http.HandleFunc("/raw/", withRecovery(serveRaw))
-	http.HandleFunc("/save", withRecovery(withCSRFCheck(handleSave)))
-	http.HandleFunc("/download", withRecovery(withCSRFCheck(handleDownload)))
-	http.HandleFunc("/events", withRecovery(serveSSE))
-	http.HandleFunc("/tree-html", withRecovery(serveTreeHTML))
-
-	// AI session tracking endpoint (always on unless --no-ai-tracking)
+// routes returns the router serving all HTTP routes. Share links carry their
+// own signature; everything else needs the access token from LAN clients.
+func routes() *router {
+	base := newRouter().with(withErrors, withRecovery, withRequestLog)
+	base.with(withCompression, withETag).handle(shareRoute+"{path...}", methodsGet, serveShared)
+
+	app := base.with(withAccessToken)
+	pages := app.with(withCompression, withETag)      // Pages and JSON
+	forms := app.with(withCSRFCheck)                  // Browser requests that change state
+	limited := app.with(withRateLimit, withCSRFCheck) // ...and write files
+
+	pages.handle("/", methodsGet, serveBrowser)
+	pages.handle("/view/{path...}", methodsGet, serveFile)
+	pages.handle("/p/{id...}", methodsGet, servePermalink)
+	limited.handle("/navigate", methodsPost, handleNavigate)
+	forms.handle("/navigate/back", methodsPost, handleNavigateBack)
+	forms.handle("/navigate/forward", methodsPost, handleNavigateForward)
+	limited.handle("/delete", methodsPost, handleDelete)
+	forms.handle("/reveal", methodsPost, handleReveal)
+	app.handle("/raw/{path...}", methodsGet, serveRaw) // Byte ranges of the file as it is
+	pages.handle("/compare", methodsGet, handleCompare)
+	pages.handle(reviewRoute+"{path...}", methodsGet, serveReview)
+	limited.handle("/save", methodsPost, handleSave)
+	limited.handle("/create", methodsPost, handleCreate)
+	limited.handle("/import", methodsPost, handleImport)
+	limited.handle("/mkdir", methodsPost, handleMkdir)
+	limited.handle("/insert-toc", methodsPost, handleInsertTOC)
+	limited.handle("/today", methodsGetPost, handleToday)
+	forms.handle("/download", methodsPost, handleDownload)
+	app.handle("/events", methodsStream, serveSSE)
+	pages.handle("/tree-html", methodsGet, serveTreeHTML)
+	pages.handle("/api/connect-info", methodsGet, serveConnectInfo)
+	pages.handle("/api/clients", methodsGet, serveAPIClients)
+	pages.handle("/api/tree", methodsGet, serveAPITree)
+	pages.handle("/api/dirs", methodsGet, serveAPIDirs)
+	pages.handle("/api/browse-dirs", methodsGet, serveAPIBrowseDirs)
+	pages.handle("/api/recent-dirs", methodsGet, serveAPIRecentDirs)
+	pages.handle("/api/file", methodsGet, serveAPIFile)
+	pages.handle("/api/export-fragment", methodsGet, serveAPIExportFragment)
+	forms.handle("/api/share", methodsPost, handleAPIShare)
+	limited.handle("/api/comments", methodsGetPostPutDelete, handleAPIComments)
+	limited.handle("/api/position", methodsGetPost, handleAPIPosition)
+	limited.handle("/api/bookmarks", methodsGetPostPutDelete, handleAPIBookmarks)
+	forms.handle("/api/render", methodsPost, handleAPIRender)
+	forms.handle("/api/preview", methodsPost, handleAPIPreview)
+	pages.handle("/api/session", methodsGet, serveAPISession)
+	pages.handle("/api/session-diff", methodsGet, serveAPISessionDiff)
+	pages.handle("/api/session-stats", methodsGet, serveAPISessionStats)
+	limited.handle("/api/review", methodsPost, handleAPIReview)
+	forms.handle("/api/follow", methodsGetPost, handleAPIFollow)
+	pages.handle("/api/templates", methodsGet, serveAPITemplates)
+	pages.handle("/api/lint", methodsGet, serveAPILint)
+	pages.handle("/api/resolve-anchor", methodsGet, serveAPIResolveAnchor)
+	pages.handle("/api/find", methodsGet, serveAPIFind)
+	pages.handle("/api/symbols", methodsGet, serveAPISymbols)
+	pages.handle("/api/file-chunk", methodsGet, serveAPIFileChunk)
+	pages.handle("/api/search", methodsGet, serveAPISearch)
+	pages.handle("/api/resync", methodsGet, serveAPIResync)
+	limited.handle("/api/replace", methodsPost, handleAPIReplace)
+	limited.handle("/api/replace/undo", methodsPost, handleAPIReplaceUndo)
+	limited.handle("/api/spellcheck", methodsGetPost, handleAPISpellcheck)
+	limited.handle("/api/frontmatter", methodsGetPut, handleAPIFrontMatter)
+	forms.handle("/api/tabs", methodsGetPostDelete, handleAPITabs)
+	forms.handle("/api/presence", methodsGetPost, handleAPIPresence)
+	forms.handle("/api/presence/scroll", methodsPost, handleAPIPresenceScroll)
+	forms.handle("/api/tree-state", methodsGetPut, handleAPITreeState)
+	pages.handle("/api/version", methodsGet, serveAPIVersion)
+	apiSchema = buildAPISchema(apiOperations)
+	pages.handle("/api/schema", methodsGet, serveAPISchema)
+	forms.handle("/rpc", methodsPost, handleRPC)
+
+	// AI session tracking endpoints (always on unless --no-ai-tracking)
 	if !*disableHook {
-		http.HandleFunc("/hook/file-modified", withRecovery(handleClaudeHook))
+		hooks := app.with(withRateLimit)
+		hooks.handle("/hook/file-modified", methodsPost, handleClaudeHook) // Hook scripts installed before /hook/{source}
+		hooks.handle("/hook/{source}", methodsPost, handleHook)
 	}
+	return base
 }
 
-// validateSymlinkSecurity checks if a symlink is safe to follow
-// Returns the resolved FileInfo and whether to skip (for directories)
-func validateSymlinkSecurity(path string, info os.FileInfo, homeDir string) (os.FileInfo, bool, error) {
-	if info.Mode()&os.ModeSymlink == 0 {
-		return info, false, nil // Not a symlink, OK to proceed
-	}
-
-	resolved, err := filepath.EvalSymlinks(path)
-	if err != nil {
-		log.Printf("Warning: Skipping unresolvable symlink: %s", path)
-		return nil, false, err
-	}
-
-	// Check if resolved path is within $HOME
-	if homeDir != "" && !strings.HasPrefix(resolved, homeDir) {
-		log.Printf("Security: Skipping symlink outside home directory: %s -> %s", path, resolved)
-		return nil, false, fmt.Errorf("symlink outside home")
-	}
+// isPartialRequest detects if the request is an AJAX/fetch request for partial content
+func isPartialRequest(r *http.Request) bool {
+	return r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+}
 
-	// Update info to reflect the resolved target
-	resolvedInfo, err := os.Stat(resolved)
-	if err != nil {
-		log.Printf("Warning: Cannot stat symlink target: %s", resolved)
-		return nil, false, err
-	}
+// isNoScriptRequest detects a plain HTML form submission from the no-JavaScript fallback UI
+func isNoScriptRequest(r *http.Request) bool {
+	return r.FormValue("noscript") != ""
+}
 
-	return resolvedInfo, false, nil
+// viewURL builds an escaped /view/ URL for a path relative to browseDir
+func viewURL(relPath string) string {
+	return (&url.URL{Path: "/view/" + filepath.ToSlash(relPath)}).String()
 }
 
-// validateAndResolvePath validates and resolves a path with security checks
-// Returns the validated absolute path or an error if validation fails
-// isPartialRequest detects if the request is an AJAX/fetch request for partial content
-func isPartialRequest(r *http.Request) bool {
-	return r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+// checkAnchor returns ("", nil) if source has a heading with the given anchor,
+// otherwise the missing anchor and all available ones
+func checkAnchor(md goldmark.Markdown, source []byte, want string) (string, []string) {
+	want = strings.TrimPrefix(want, "#")
+	var anchors []string
+	for _, h := range render.Headings(md, source) {
+		if h.ID == want {
+			return "", nil
+		}
+		if h.ID != "" {
+			anchors = append(anchors, h.ID)
+		}
+	}
+	return want, anchors
 }
 
 // renderTemplate selects full/partial template, executes to buffer, and writes the response.
 // Returns true on success, false if an error was written to w.
 func renderTemplate(w http.ResponseWriter, r *http.Request, data any) bool {
-	tmpl := fileBrowserTmpl
-	if isPartialRequest(r) {
-		tmpl = fileBrowserPartialTmpl
-	}
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
+	if err := browserTemplate(w, r).Execute(&buf, data); err != nil {
 		log.Printf("Template execution error: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, errCodeInternal, "Internal server error", http.StatusInternalServerError)
 		return false
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	buf.WriteTo(w)
+	pageServed(r)
 	return true
 }
 
-func validateAndResolvePath(targetPath string) (string, error) {
-	// Expand ~ to home directory
-	if strings.HasPrefix(targetPath, "~/") {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("cannot determine home directory: %w", err)
-		}
-		targetPath = filepath.Join(homeDir, targetPath[2:])
-	} else if targetPath == "~" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("cannot determine home directory: %w", err)
-		}
-		targetPath = homeDir
-	}
-
-	// Clean the path to prevent traversal
-	targetPath = filepath.Clean(targetPath)
-
-	// Make absolute if relative
-	if !filepath.IsAbs(targetPath) {
-		absPath, err := filepath.Abs(targetPath)
-		if err != nil {
-			return "", fmt.Errorf("invalid path: %w", err)
-		}
-		targetPath = absPath
-	}
-
-	// Resolve symlinks
-	resolvedPath, err := filepath.EvalSymlinks(targetPath)
-	if err != nil {
-		return "", fmt.Errorf("path does not exist: %w", err)
+// browserTemplate selects the full, partial or mobile file browser template
+func browserTemplate(w http.ResponseWriter, r *http.Request) *template.Template {
+	if isPartialRequest(r) {
+		return fileBrowserPartialTmpl
+	} else if useMobileLayout(w, r) {
+		return fileBrowserMobileTmpl
 	}
-	targetPath = resolvedPath
+	return fileBrowserTmpl
+}
 
-	// Security: Restrict to $HOME directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("cannot determine home directory: %w", err)
+// pageServed lets --once exit once the first full page was written
+func pageServed(r *http.Request) {
+	if *once && !isPartialRequest(r) && !isHeadRequest(r) {
+		firstPageServedOnce.Do(func() { close(firstPageServed) })
 	}
-	if !strings.HasPrefix(targetPath, homeDir) {
-		return "", fmt.Errorf("access denied: path must be within home directory")
-	}
-
-	return targetPath, nil
 }
 
 // resolveFilePath converts a relative file path to absolute using browseDir
@@ -612,383 +611,120 @@ func resolveFilePath(relativePath string) string {
 func isWhitelistedFile(path string) bool {
 	fileMutex.RLock()
 	defer fileMutex.RUnlock()
-	for _, f := range markdownFiles {
-		if f == path {
-			return true
-		}
-	}
-	return false
-}
-
-func init() {
-	// Load CSS files
-	cssData, err := themeFS.ReadFile("theme/github-markdown.css")
-	if err != nil {
-		log.Fatalf("Failed to load GitHub CSS: %v", err)
-	}
-	githubCSS = string(cssData)
-
-	overridesData, err := themeFS.ReadFile("theme/theme-overrides.css")
-	if err != nil {
-		log.Fatalf("Failed to load theme overrides CSS: %v", err)
-	}
-	themeOverrides = string(overridesData)
-
-	// Load JavaScript files
-	themeManagerData, err := themeFS.ReadFile("theme/theme-manager.js")
-	if err != nil {
-		log.Fatalf("Failed to load theme manager JS: %v", err)
-	}
-	themeManagerJS = string(themeManagerData)
-
-	editorData, err := themeFS.ReadFile("theme/editor.js")
-	if err != nil {
-		log.Fatalf("Failed to load editor JS: %v", err)
-	}
-	editorJS = string(editorData)
-
-	navigationData, err := themeFS.ReadFile("theme/navigation.js")
-	if err != nil {
-		log.Fatalf("Failed to load navigation JS: %v", err)
-	}
-	navigationJS = string(navigationData)
-
-	// Load HTML templates with custom functions
-	funcMap := template.FuncMap{
-		"formatISO": func(t time.Time) string {
-			return t.Format(time.RFC3339)
-		},
-	}
-
-	// Load shared session info panel template
-	sessionInfoPanelHTML, err := themeFS.ReadFile("theme/session-info-panel.html")
-	if err != nil {
-		log.Fatalf("Failed to load session-info-panel template: %v", err)
-	}
-
-	fileBrowserHTML, err := themeFS.ReadFile("theme/file-browser.html")
-	if err != nil {
-		log.Fatalf("Failed to load file-browser template: %v", err)
-	}
-	fileBrowserTmpl = template.Must(template.New("file-browser").Funcs(funcMap).Parse(string(fileBrowserHTML)))
-	fileBrowserTmpl = template.Must(fileBrowserTmpl.Parse(string(sessionInfoPanelHTML)))
-
-	fileBrowserPartialHTML, err := themeFS.ReadFile("theme/file-browser-partial.html")
-	if err != nil {
-		log.Fatalf("Failed to load file-browser-partial template: %v", err)
-	}
-	fileBrowserPartialTmpl = template.Must(template.New("file-browser-partial").Funcs(funcMap).Parse(string(fileBrowserPartialHTML)))
-	fileBrowserPartialTmpl = template.Must(fileBrowserPartialTmpl.Parse(string(sessionInfoPanelHTML)))
-}
-
-// runSetup handles the "peekm setup" subcommand
-func runSetup(args []string) {
-	if len(args) == 0 {
-		fmt.Println("Usage: peekm setup claude-code [--remove] [--port PORT]")
-		fmt.Println("\nConfigures Claude Code to send file modification events to peekm.")
-		os.Exit(1)
-	}
-
-	switch args[0] {
-	case "claude-code":
-		setupClaudeCode(args[1:])
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown setup target: %s\n", args[0])
-		fmt.Println("Available: claude-code")
-		os.Exit(1)
-	}
+	return markdownFiles.contains(path)
 }
 
-func setupClaudeCode(args []string) {
-	setupFlags := flag.NewFlagSet("setup claude-code", flag.ExitOnError)
-	remove := setupFlags.Bool("remove", false, "Remove peekm hooks from Claude Code")
-	hookPort := setupFlags.Int("port", 6419, "Port peekm runs on")
-	setupFlags.Parse(args)
-
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: cannot determine home directory: %v\n", err)
-		os.Exit(1)
-	}
-
-	claudeDir := filepath.Join(homeDir, ".claude")
-	settingsPath := filepath.Join(claudeDir, "settings.json")
-	hookScriptPath := filepath.Join(claudeDir, "peekm-hook.sh")
-
-	if *remove {
-		removeClaudeCodeSetup(settingsPath, hookScriptPath)
-		return
-	}
-
-	fmt.Println("\n  AI Session Tracking Setup")
-	fmt.Println("  " + strings.Repeat("\u2500", 25))
-
-	// Step 1: Create hook script
-	fmt.Printf("\n  Step 1: Hook script\n")
-
-	hookScript := fmt.Sprintf(`#!/bin/bash
-json=$(cat)
-session_id=$(echo "$json" | jq -r '.session_id // empty')
-tool_name=$(echo "$json" | jq -r '.tool_name // empty')
-file_path=$(echo "$json" | jq -r '.tool_input.file_path // .tool_input.notebook_path // empty')
-
-if [ -n "$session_id" ] && [ -n "$tool_name" ] && [ -n "$file_path" ]; then
-    # For Claude plan files, forward content for devcontainer support
-    if echo "$file_path" | grep -q '\.claude/plans/.*\.md$'; then
-        payload=$(echo "$json" | jq -c '{session_id, tool_name, file_path: .tool_input.file_path, content: .tool_input.content}')
-        curl -s -X POST -H 'Content-Type: application/json' \
-            -d "$payload" \
-            --max-time 0.5 http://localhost:%d/hook/file-modified >/dev/null 2>&1
-    else
-        curl -s -X POST -H 'Content-Type: application/json' \
-            -d "{\"session_id\":\"$session_id\",\"tool_name\":\"$tool_name\",\"file_path\":\"$file_path\"}" \
-            --max-time 0.1 http://localhost:%d/hook/file-modified >/dev/null 2>&1
-    fi
-fi
-`, *hookPort, *hookPort)
-
-	if err := os.MkdirAll(claudeDir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "    Error creating %s: %v\n", claudeDir, err)
-		os.Exit(1)
-	}
-
-	if err := os.WriteFile(hookScriptPath, []byte(hookScript), 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "    Error writing hook script: %v\n", err)
-		os.Exit(1)
+// whitelistedPath validates a file path from a request (relative to the
+// browse directory), returning the error to answer with if it is not a served file
+func whitelistedPath(rawPath string) (string, *apiError) {
+	relPath := filepath.Clean(strings.TrimPrefix(rawPath, "/"))
+	if relPath == "." {
+		return "", &apiError{Status: http.StatusBadRequest, Code: errCodeBadRequest, Message: "Missing file path"}
 	}
-	fmt.Printf("    Created %s\n", hookScriptPath)
-
-	// Step 2: Merge hooks into settings.json
-	fmt.Printf("\n  Step 2: Claude Code settings\n")
-
-	hookEntry := map[string]interface{}{
-		"type":    "command",
-		"command": hookScriptPath,
-		"timeout": 0.15,
-	}
-
-	matchers := []string{"Write", "Edit", "NotebookEdit"}
-
-	// Read existing settings or start fresh
-	var settings map[string]interface{}
-	data, err := os.ReadFile(settingsPath)
-	if err == nil {
-		if err := json.Unmarshal(data, &settings); err != nil {
-			fmt.Fprintf(os.Stderr, "    Error parsing %s: %v\n", settingsPath, err)
-			os.Exit(1)
-		}
-		fmt.Printf("    Found %s\n", settingsPath)
-	} else {
-		settings = make(map[string]interface{})
-		fmt.Printf("    Creating %s\n", settingsPath)
-	}
-
-	// Ensure hooks.PostToolUse exists
-	hooks, _ := settings["hooks"].(map[string]interface{})
-	if hooks == nil {
-		hooks = make(map[string]interface{})
-		settings["hooks"] = hooks
-	}
-
-	postToolUse, _ := hooks["PostToolUse"].([]interface{})
-	if postToolUse == nil {
-		postToolUse = []interface{}{}
-	}
-
-	// Add hooks for each matcher (idempotent — skip if peekm hook already exists)
-	added := 0
-	for _, matcher := range matchers {
-		if hasPeekmHook(postToolUse, matcher, hookScriptPath) {
-			continue
-		}
-
-		entry := map[string]interface{}{
-			"matcher": matcher,
-			"hooks":   []interface{}{hookEntry},
-		}
-		postToolUse = append(postToolUse, entry)
-		added++
-	}
-
-	hooks["PostToolUse"] = postToolUse
-	settings["hooks"] = hooks
-
-	// Write settings back
-	out, err := json.MarshalIndent(settings, "", "  ")
+	validated, err := safepath.Resolve(resolveFilePath(relPath))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "    Error serializing settings: %v\n", err)
-		os.Exit(1)
-	}
-
-	if err := os.WriteFile(settingsPath, append(out, '\n'), 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "    Error writing %s: %v\n", settingsPath, err)
-		os.Exit(1)
+		return "", &apiError{Status: http.StatusForbidden, Code: pathErrorCode(err), Message: "Invalid path"}
 	}
-
-	if added > 0 {
-		fmt.Printf("    Added %d PostToolUse hook(s) (%s)\n", added, strings.Join(matchers[:added], ", "))
-	} else {
-		fmt.Printf("    Hooks already configured (no changes)\n")
+	if !isWhitelistedFile(validated) {
+		return "", &apiError{Status: http.StatusForbidden, Code: errCodeNotWhitelisted, Message: "File not found or access denied"}
 	}
-
-	fmt.Println("\n  Setup complete. Restart Claude Code to activate.")
-	fmt.Println("  To verify: modify a file with Claude Code and check peekm")
-	fmt.Println("  for the AI session badge.")
-	fmt.Println()
+	return validated, nil
 }
 
-// hasPeekmHook checks if a PostToolUse entry for this matcher already has a peekm hook
-func hasPeekmHook(entries []interface{}, matcher, scriptPath string) bool {
-	for _, entry := range entries {
-		e, ok := entry.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		if e["matcher"] != matcher {
-			continue
-		}
-		hooks, ok := e["hooks"].([]interface{})
-		if !ok {
-			continue
-		}
-		for _, h := range hooks {
-			hook, ok := h.(map[string]interface{})
-			if !ok {
-				continue
-			}
-			if cmd, ok := hook["command"].(string); ok && cmd == scriptPath {
-				return true
-			}
-		}
+// resolveWhitelistedPath validates a file path from a request (relative to the
+// browse directory), writing the error response on failure
+func resolveWhitelistedPath(w http.ResponseWriter, rawPath string) (string, bool) {
+	validated, e := whitelistedPath(rawPath)
+	if e != nil {
+		writeError(w, e.Code, e.Message, e.Status)
+		return "", false
 	}
-	return false
+	return validated, true
 }
 
-// removeClaudeCodeSetup removes peekm hooks from Claude Code settings
-// filterPeekmHooks returns PostToolUse entries that don't reference the peekm hook script.
-func filterPeekmHooks(entries []interface{}, hookScriptPath string) (filtered []interface{}, removed int) {
-	for _, entry := range entries {
-		e, ok := entry.(map[string]interface{})
-		if !ok {
-			filtered = append(filtered, entry)
-			continue
-		}
-		entryHooks, ok := e["hooks"].([]interface{})
-		if !ok {
-			filtered = append(filtered, entry)
-			continue
-		}
-		if containsPeekmHook(entryHooks, hookScriptPath) {
-			removed++
-		} else {
-			filtered = append(filtered, entry)
-		}
-	}
-	return
+// whitelistedFiles returns the whitelisted markdown files, sorted (thread-safe)
+func whitelistedFiles() []string {
+	fileMutex.RLock()
+	defer fileMutex.RUnlock()
+	return markdownFiles.list()
 }
 
-func containsPeekmHook(hooks []interface{}, hookScriptPath string) bool {
-	for _, h := range hooks {
-		hook, ok := h.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		if cmd, ok := hook["command"].(string); ok && cmd == hookScriptPath {
-			return true
-		}
+func init() {
+	if err := loadTheme(nil); err != nil {
+		log.Fatalf("Failed to load theme: %v", err)
 	}
-	return false
 }
 
-func removeClaudeCodeSetup(settingsPath, hookScriptPath string) {
-	fmt.Println("\n  Removing AI Session Tracking")
-	fmt.Println("  " + strings.Repeat("\u2500", 30))
-
-	// Remove hook script
-	if err := os.Remove(hookScriptPath); err != nil && !os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "    Warning: %v\n", err)
-	} else if err == nil {
-		fmt.Printf("    Removed %s\n", hookScriptPath)
-	}
-
-	// Remove hooks from settings.json
-	data, err := os.ReadFile(settingsPath)
-	if err != nil {
-		fmt.Println("    No settings file found")
-		fmt.Print("\n  Done.\n\n")
-		return
-	}
-
-	var settings map[string]interface{}
-	if err := json.Unmarshal(data, &settings); err != nil {
-		fmt.Fprintf(os.Stderr, "    Error parsing settings: %v\n", err)
-		os.Exit(1)
-	}
-
-	hooks, _ := settings["hooks"].(map[string]interface{})
-	if hooks == nil {
-		fmt.Println("    No hooks found in settings")
-		fmt.Print("\n  Done.\n\n")
-		return
-	}
-
-	postToolUse, _ := hooks["PostToolUse"].([]interface{})
-	if postToolUse == nil {
-		fmt.Println("    No PostToolUse hooks found")
-		fmt.Print("\n  Done.\n\n")
-		return
+// runSubcommand dispatches "peekm <subcommand> ..." and reports whether one ran
+func runSubcommand(args []string) bool {
+	if len(args) == 0 {
+		return false
 	}
-
-	// Filter out entries whose hooks reference the peekm script
-	filtered, removed := filterPeekmHooks(postToolUse, hookScriptPath)
-
-	if removed > 0 {
-		hooks["PostToolUse"] = filtered
-		out, _ := json.MarshalIndent(settings, "", "  ")
-		os.WriteFile(settingsPath, append(out, '\n'), 0644)
-		fmt.Printf("    Removed %d hook(s) from settings.json\n", removed)
-	} else {
-		fmt.Println("    No peekm hooks found in settings")
+	switch args[0] {
+	case "setup":
+		runSetup(args[1:])
+	case "hooks":
+		runHooks(args[1:])
+	case "render":
+		runRender(args[1:])
+	case "list":
+		runList(args[1:])
+	case "lint":
+		runLint(args[1:])
+	case "recent":
+		runRecent(args[1:])
+	case "bench":
+		runBench(args[1:])
+	case "today":
+		// "peekm today [options] [dir]" is the server with --today, so drop the
+		// subcommand and let main parse the rest as usual
+		*today = true
+		os.Args = append(os.Args[:1], args[1:]...)
+		return false
+	default:
+		return false
 	}
-
-	fmt.Print("\n  Done.\n\n")
+	return true
 }
 
 func runShowIgnored() {
-	fmt.Println("Hardcoded exclusions:")
-	fmt.Println("  .* (hidden directories, except .claude)")
-	for _, dir := range hardcodedExclusions {
-		fmt.Printf("  %s\n", dir)
-	}
-
 	checkDir := "."
 	if flag.NArg() > 0 {
 		checkDir = flag.Arg(0)
 	}
-	if absPath, err := filepath.Abs(checkDir); err == nil {
-		checkDir = absPath
-	}
-	if info, err := os.Stat(checkDir); err == nil && !info.IsDir() {
-		checkDir = filepath.Dir(checkDir)
-	}
+	rootDir := listRootDir(checkDir)
+	printExclusions(os.Stdout, rootDir, listExclusions(rootDir))
+}
 
-	if patterns := getIgnorePatterns(checkDir); len(patterns) > 0 {
-		fmt.Printf("\nCustom exclusions (.peekmignore in %s):\n", checkDir)
-		for _, p := range patterns {
-			fmt.Printf("  %s\n", p)
-		}
-	} else {
-		fmt.Printf("\nNo .peekmignore file found in %s\n", checkDir)
+// newServer returns the HTTP server for addr, with the --read-timeout and
+// --idle-timeout limits
+func newServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:        addr,
+		Handler:     routes(),
+		ReadTimeout: *readTimeout,
+		// WriteTimeout intentionally omitted for SSE streaming endpoints
+		// SSE connections are long-lived and should not have write timeouts
+		IdleTimeout: *idleTimeout,
 	}
 }
 
-// resolveTarget determines browseDir from CLI args and returns a target file (if any).
+// resolveTarget determines browseDir from CLI args and returns a target file
+// (if any), relative to browseDir.
 func resolveTarget() string {
 	targetPath := "."
 	if flag.NArg() > 0 {
 		targetPath = flag.Arg(0)
 	}
 
+	// README.md#installation opens a specific heading
+	if base, fragment, found := strings.Cut(targetPath, "#"); found && !fileExists(targetPath) {
+		targetPath = base
+		if *anchor == "" {
+			*anchor = fragment
+		}
+	}
+
 	absPath, err := filepath.Abs(targetPath)
 	if err != nil {
 		log.Fatalf("Error getting absolute path: %v", err)
@@ -1004,6 +740,9 @@ func resolveTarget() string {
 
 	if info.IsDir() {
 		browseDir = absPath
+		if *today {
+			return openDailyNote()
+		}
 		return ""
 	}
 	browseDir = filepath.Dir(absPath)
@@ -1012,12 +751,15 @@ func resolveTarget() string {
 
 func main() {
 	// Handle subcommands before flag.Parse()
-	if len(os.Args) >= 2 && os.Args[1] == "setup" {
-		runSetup(os.Args[2:])
+	if runSubcommand(os.Args[1:]) {
 		return
 	}
 
 	flag.Parse()
+	applyImpliedFlags()
+	setupDeleteMode()
+	setupRateLimit()
+	setupEventBuffer()
 
 	if *showVersion {
 		fmt.Printf("peekm %s (commit: %s, built: %s)\n", version, commit, date)
@@ -1032,50 +774,33 @@ func main() {
 	// Initialize AI session tracking (always on unless --no-ai-tracking)
 	if !*disableHook {
 		globalSessionStore = newSessionStore()
+		startSessionPruning()
 	}
 
 	targetFile := resolveTarget()
+	applyThemeOverrides()
+	checkUILang()
 
-	// Collect markdown files
-	markdownFiles = collectMarkdownFiles(browseDir)
-	if len(markdownFiles) == 0 {
-		fmt.Printf("No markdown files found in: %s\n", browseDir)
-		fmt.Println("\nUsage: peekm [options] <markdown-file|directory>")
-		fmt.Println("\nOptions:")
-		flag.PrintDefaults()
-		os.Exit(1)
-	}
+	// Collect markdown files in the background, then watch and index them
+	scanFailed := startStartupScan(browseDir, targetFile)
+	globalNavHistory.visit(browseDir)
 
-	// Watch for new markdown files
-	if err := dirWatcher.watchDirectory(browseDir); err != nil {
-		log.Printf("Warning: Cannot watch directory for changes: %v", err)
+	// LAN access: token auth and QR code (no-op for loopback binds)
+	if err := setupLANAccess(*host, *port); err != nil {
+		log.Fatalf("Cannot enable LAN access: %v", err)
 	}
 
-	// Register all routes
-	registerRoutes()
+	stopMDNS := startMDNSIfEnabled()
 
-	addr := fmt.Sprintf("localhost:%d", *port)
-	url := fmt.Sprintf("http://%s", addr)
+	addr := net.JoinHostPort(*host, strconv.Itoa(*port))
+	url, fullURL := startupURLs(targetFile)
 
-	// Build URL with auto-navigation if specific file requested
-	fullURL := url
 	if targetFile != "" {
-		// Get relative path for URL
-		for _, mdFile := range markdownFiles {
-			if filepath.Base(mdFile) == targetFile {
-				relPath, err := filepath.Rel(browseDir, mdFile)
-				if err == nil {
-					fullURL = fmt.Sprintf("%s/view/%s", url, relPath)
-				}
-				break
-			}
-		}
 		fmt.Printf("peekm at %s\n", url)
-		fmt.Printf("Opening %s - found %d markdown file(s)\n", targetFile, len(markdownFiles))
 	} else {
 		fmt.Printf("peekm file browser at %s\n", url)
-		fmt.Printf("Browsing %s - found %d markdown file(s)\n", browseDir, len(markdownFiles))
 	}
+	printLANQRCode()
 	fmt.Println("Press Ctrl+C to quit")
 
 	if *openBrowser {
@@ -1086,28 +811,35 @@ func main() {
 	}
 
 	// Setup graceful shutdown
-	server := &http.Server{
-		Addr:        addr,
-		ReadTimeout: 15 * time.Second,
-		// WriteTimeout intentionally omitted for SSE streaming endpoints
-		// SSE connections are long-lived and should not have write timeouts
-		IdleTimeout: 60 * time.Second,
-	}
+	server := newServer(addr)
 
 	// Handle shutdown signals
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
+	exitCode := 0 // Read once shutdownDone is closed
 	go func() {
-		<-sigint
-
-		log.Println("\nShutting down gracefully...")
+		defer close(shutdownDone)
+		select {
+		case <-sigint:
+			log.Println("\nShutting down gracefully...")
+		case <-firstPageServed:
+			log.Println("Page served, exiting (--once)")
+		case <-scanFailed:
+			exitCode = 1
+		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		// Close watchers
-		fileWatcher.close()
-		dirWatcher.close()
+		// Close watchers and save search index changes
+		fileWatcher.Close()
+		dirWatcher.Close()
+		textIndex.flush()
+		globalEventBuffer.closeLog()
+
+		// Withdraw the mDNS announcement
+		stopMDNS()
 
 		// Shutdown HTTP server
 		if err := server.Shutdown(ctx); err != nil {
@@ -1118,6 +850,53 @@ func main() {
 	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	<-shutdownDone // Let in-flight responses finish
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// applyImpliedFlags turns on the flags that other flags imply
+func applyImpliedFlags() {
+	if *once {
+		*noWatch = true
+		*noIndex = true
+	}
+	if *vaultMode {
+		*wikiMode = true
+	}
+	followMode.Store(*follow)
+}
+
+// startupURLs returns the server URL to print and the URL to open in the browser,
+// auto-navigating to targetFile when one was requested
+func startupURLs(targetFile string) (string, string) {
+	baseURL := fmt.Sprintf("http://localhost:%d", *port)
+	if ip := net.ParseIP(*host); lanURL != "" && (ip == nil || !ip.IsUnspecified()) {
+		baseURL = lanURL // Bound to a specific LAN address, localhost won't answer
+	}
+
+	// Build URL with auto-navigation if specific file requested
+	fullURL := baseURL
+	if targetFile != "" && isWhitelistedFile(filepath.Join(browseDir, targetFile)) {
+		fullURL = baseURL + viewURL(targetFile)
+	}
+
+	// Ask the server to check the heading; the fragment scrolls to it
+	query := url.Values{}
+	if baseURL == lanURL {
+		query.Set("token", accessToken)
+	}
+	if targetFile != "" && *anchor != "" {
+		query.Set("anchor", *anchor)
+	}
+	if len(query) > 0 {
+		fullURL += "?" + query.Encode()
+	}
+	if targetFile != "" && *anchor != "" {
+		fullURL += "#" + url.PathEscape(*anchor)
+	}
+	return baseURL, fullURL
 }
 
 // getRelativePath converts absolute file path to relative path (thread-safe)
@@ -1134,17 +913,19 @@ func getRelativePath(absPath string) string {
 	return relPath
 }
 
-// removeFromWhitelist removes a file from the markdown files list (thread-safe)
-func removeFromWhitelist(filePath string) {
+// addToWhitelist adds a file to the markdown files set unless already present (thread-safe).
+// Returns false if the file was already whitelisted.
+func addToWhitelist(filePath string) bool {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
+	return markdownFiles.add(filePath)
+}
 
-	for i, f := range markdownFiles {
-		if f == filePath {
-			markdownFiles = append(markdownFiles[:i], markdownFiles[i+1:]...)
-			break
-		}
-	}
+// removeFromWhitelist removes a file from the markdown files set (thread-safe)
+func removeFromWhitelist(filePath string) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+	markdownFiles.remove(filePath)
 }
 
 // sendFileEvent sends a file event notification to clients
@@ -1162,67 +943,20 @@ func sendFileEvent(eventType, relPath, sessionID string) {
 	}
 }
 
-func watchFileWithContext(ctx context.Context, watcher *fsnotify.Watcher, filePath string) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
-			}
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				log.Println("File modified, sending reload notification...")
-
-				// Send file_modified event with path so client can auto-refresh if viewing this file
-				msgBytes, err := json.Marshal(map[string]string{
-					"type": "file_modified",
-					"path": filePath,
-				})
-				if err != nil {
-					log.Printf("Error marshaling file modified message: %v", err)
-					notifyClients() // Fallback to plain reload
-				} else {
-					notifyClientsWithMessage(string(msgBytes))
-				}
-			}
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Printf("Watcher error: %v", err)
-		}
-	}
-}
-
-// handleDirCreated adds a newly created directory to the watcher if it's within $HOME.
-func handleDirCreated(watcher *fsnotify.Watcher, dirPath string) {
-	homeDir, _ := os.UserHomeDir()
-	if homeDir == "" {
-		return
-	}
-	resolved, err := filepath.EvalSymlinks(dirPath)
-	if err != nil || !strings.HasPrefix(resolved, homeDir) {
-		return
-	}
-	if err := watcher.Add(dirPath); err != nil {
-		log.Printf("Warning: Cannot watch new directory %s: %v", dirPath, err)
-	} else {
-		log.Printf("Now watching new directory: %s", dirPath)
-	}
-}
-
 // handleMarkdownCreated adds a new markdown file to the whitelist and notifies clients.
 func handleMarkdownCreated(filePath string) {
+	if !addToWhitelist(filePath) {
+		return // Already whitelisted (and announced) by /create or /import, or rewritten in place
+	}
 	log.Printf("New markdown file created: %s", filePath)
 
-	fileMutex.Lock()
-	markdownFiles = append(markdownFiles, filePath)
-	fileMutex.Unlock()
-
 	go func() {
 		sessionID := awaitSessionID(filePath)
 		sendFileEvent("file_added", getRelativePath(filePath), sessionID)
+		if sessionID != "" {
+			followFile(filePath, sessionID)
+			notifyAgentFileCreated(filePath, sessionID)
+		}
 	}()
 }
 
@@ -1257,87 +991,178 @@ func handleMarkdownRemoved(filePath string, reason string) {
 	sendFileEvent("file_removed", getRelativePath(filePath), "")
 }
 
-func watchDirectoryWithContext(ctx context.Context, watcher *fsnotify.Watcher) {
-	for {
-		select {
-		case <-ctx.Done():
+// isMarkdownPath reports whether a path names a markdown file (.md, or the
+// extensions a .peekm.toml sets for its directory)
+func isMarkdownPath(path string) bool {
+	return settingsFor(filepath.Dir(path)).IsMarkdown(filepath.Base(path))
+}
+
+// watchBrowseDir (re)starts the directory watcher for rootDir unless --no-watch is set
+func watchBrowseDir(rootDir string) error {
+	if *noWatch {
+		return nil
+	}
+	return dirWatcher.WatchDirectory(rootDir, browseDirHandlers(rootDir))
+}
+
+// browseDirHandlers routes directory watcher events for rootDir to the whitelist and SSE clients
+func browseDirHandlers(rootDir string) watch.DirHandlers {
+	customPatterns := getIgnorePatterns(rootDir)
+	// Markdown files the ignore patterns leave in, as in collectMarkdownFiles
+	isIncluded := func(path string) bool {
+		name := filepath.Base(path)
+		return isMarkdownPath(path) && !tree.IsExcludedFile(name, customPatterns) && !settingsFor(filepath.Dir(path)).Excludes(name) &&
+			!isGitignored(path, false)
+	}
+	skipDir := func(path string) bool {
+		name := filepath.Base(path)
+		return tree.IsExcludedDir(name, customPatterns) || settingsFor(filepath.Dir(path)).Excludes(name) || isGitignored(path, true)
+	}
+	fileCreated := func(path string) {
+		if !isIncluded(path) {
+			return
+		}
+		if oldPath, renamed := renames.claim(path); renamed {
+			handleMarkdownRenamed(oldPath, path)
 			return
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
+		}
+		handleMarkdownCreated(path)
+		textIndex.update(path)
+	}
+	renamedAway := func(path string) {
+		handleMarkdownRemoved(path, "Renamed")
+		textIndex.remove(path)
+	}
+	return watch.DirHandlers{
+		SkipDir: skipDir,
+		Created: func(path string) {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				walkNewDirectory(path, skipDir, fileCreated)
+			} else {
+				fileCreated(path)
 			}
-
-			if event.Op&fsnotify.Create == fsnotify.Create {
-				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
-					handleDirCreated(watcher, event.Name)
-				}
-				if strings.HasSuffix(strings.ToLower(event.Name), ".md") {
-					handleMarkdownCreated(event.Name)
-				}
+		},
+		Removed: func(path string) {
+			if isIncluded(path) {
+				handleMarkdownRemoved(path, "Deleted")
+				textIndex.remove(path)
+			} else {
+				handleDirectoryRemoved(path)
 			}
-
-			if event.Op&fsnotify.Remove == fsnotify.Remove {
-				if strings.HasSuffix(strings.ToLower(event.Name), ".md") {
-					handleMarkdownRemoved(event.Name, "Deleted")
-				}
+		},
+		Renamed: func(path string) {
+			// Removed unless the creation of its new path follows shortly
+			if isIncluded(path) {
+				renames.renamedAway(path, renamedAway)
+			} else {
+				handleDirectoryRenamed(path, renamedAway)
 			}
+		},
+		Written: textIndex.update,
+	}
+}
 
-			if event.Op&fsnotify.Rename == fsnotify.Rename {
-				if strings.HasSuffix(strings.ToLower(event.Name), ".md") {
-					handleMarkdownRemoved(event.Name, "Renamed")
-				}
-			}
+// notifyFileModified tells clients the watched file changed so they can auto-refresh
+func notifyFileModified(filePath string) {
+	log.Println("File modified, sending reload notification...")
 
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Printf("Directory watcher error: %v", err)
-		}
+	// Send file_modified event with path so client can auto-refresh if viewing
+	// this file, patching in just the changed blocks when it can
+	msgBytes, err := json.Marshal(fileModifiedMessage{
+		Type:  "file_modified",
+		Path:  filePath,
+		View:  filepath.ToSlash(getRelativePath(filePath)),
+		Patch: renderPatchFor(filePath),
+	})
+	if err != nil {
+		log.Printf("Error marshaling file modified message: %v", err)
+		notifyClients() // Fallback to plain reload
+	} else {
+		notifyClientsWithMessage(string(msgBytes))
 	}
 }
 
 func serveRaw(w http.ResponseWriter, r *http.Request) {
-	filePath := strings.TrimPrefix(r.URL.Path, "/raw")
-	filePath = strings.TrimPrefix(filePath, "/")
-
-	// Clean the path
-	filePath = filepath.Clean(filePath)
+	filePath := filepath.Clean(r.PathValue("path"))
 
 	// Resolve to absolute path using browseDir
 	absFilePath := resolveFilePath(filePath)
 
-	validated, err := validateAndResolvePath(absFilePath)
+	validated, err := safepath.Resolve(absFilePath)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusForbidden)
+		writeError(w, pathErrorCode(err), "Invalid path", http.StatusForbidden)
 		return
 	}
 
 	if !isWhitelistedFile(validated) {
-		http.Error(w, "File not found or access denied", http.StatusForbidden)
+		writeError(w, errCodeNotWhitelisted, "File not found or access denied", http.StatusForbidden)
 		return
 	}
 
-	content, err := os.ReadFile(validated)
+	// Stream the file rather than reading it whole; large files are served here
+	f, err := os.Open(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
 	if err != nil {
-		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	if _, err := w.Write(content); err != nil {
-		log.Printf("Failed to write raw file response: %v", err)
+	w.Header().Set("Cache-Control", "no-cache")
+	if value := r.URL.Query().Get("lines"); value != "" {
+		serveRawLines(w, r, f, info, value)
+		return
 	}
+	// Byte Range and conditional requests are answered by ServeContent
+	w.Header().Set("ETag", rawETag(info, lineRange{}))
+	http.ServeContent(w, r, "", info.ModTime(), f)
 }
 
-func handleSave(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// serveRawLines serves the ?lines= slice of a file, to which Range requests
+// then apply. X-Peekm-Lines reports the lines sent, shorter than asked at the
+// end of the file.
+func serveRawLines(w http.ResponseWriter, r *http.Request, f *os.File, info os.FileInfo, value string) {
+	lines, err := parseLineRange(value)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid line range (use lines=100-200, 100- or 100)", http.StatusBadRequest)
+		return
+	}
+	start, end, found, err := lineOffsets(f, lines)
+	if errors.Is(err, errLinesNotSatisfiable) {
+		writeError(w, errCodeBadRequest, "Line range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("X-Peekm-Lines", found.String())
+	w.Header().Set("ETag", rawETag(info, lines))
+	http.ServeContent(w, r, "", info.ModTime(), io.NewSectionReader(f, start, end-start))
+}
 
+// rawETag identifies a /raw response by the file's mtime and size, and the
+// ?lines= range asked for, so If-None-Match and If-Range work across edits
+func rawETag(info os.FileInfo, lines lineRange) string {
+	if lines == (lineRange{}) {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+	}
+	return fmt.Sprintf(`"%x-%x-%s"`, info.ModTime().UnixNano(), info.Size(), lines)
+}
+
+func handleSave(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSaveBodySize)
 	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		if isBodyTooLarge(err) {
+			writeError(w, errCodeTooLarge, "Content too large to save (at most 10 MB, URL-encoded)", http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeError(w, errCodeBadRequest, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
 
@@ -1350,23 +1175,39 @@ func handleSave(w http.ResponseWriter, r *http.Request) {
 	// Resolve to absolute path using browseDir
 	absFilePath := resolveFilePath(filePath)
 
-	validated, err := validateAndResolvePath(absFilePath)
+	validated, err := safepath.Resolve(absFilePath)
 	if err != nil {
-		statusCode := http.StatusForbidden
-		if strings.Contains(err.Error(), "does not exist") {
-			statusCode = http.StatusNotFound
+		statusCode, code := http.StatusForbidden, errCodePathOutsideRoot
+		if errors.Is(err, os.ErrNotExist) {
+			statusCode, code = http.StatusNotFound, errCodeNotFound
 		}
-		http.Error(w, fmt.Sprintf("Cannot save file: %v", err), statusCode)
+		writeError(w, code, fmt.Sprintf("Cannot save file: %v", err), statusCode)
 		return
 	}
 
 	if !isWhitelistedFile(validated) {
-		http.Error(w, "File not found or access denied", http.StatusForbidden)
+		writeError(w, errCodeNotWhitelisted, "File not found or access denied", http.StatusForbidden)
+		return
+	}
+	if err := checkWritable(validated); err != nil {
+		writeError(w, errCodeReadOnly, fmt.Sprintf("Cannot save file: %v", err), http.StatusForbidden)
 		return
 	}
 
+	// Keep a table of contents between <!-- toc --> markers in sync with the headings
+	if updated, found := updateTOC(content, 0); found {
+		content = updated
+	}
+
 	if err := atomicWriteFile(validated, content); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to save: %v", err), http.StatusInternalServerError)
+		writeError(w, errCodeInternal, fmt.Sprintf("Failed to save: %v", err), http.StatusInternalServerError)
+		return
+	}
+	textIndex.update(validated)
+
+	// Plain form posts (no JavaScript) go back to the rendered document
+	if isNoScriptRequest(r) {
+		http.Redirect(w, r, viewURL(filePath), http.StatusSeeOther)
 		return
 	}
 
@@ -1400,80 +1241,98 @@ func atomicWriteFile(path, content string) error {
 	return nil
 }
 
-func handleDownload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// downloadRequest is the /download request body
+type downloadRequest struct {
+	Path     string `json:"path"`     // Relative to the browsed directory; ?path= also works
+	Format   string `json:"format"`   // "html" (default) or "md-bundle"; ?format= also works
+	Template string `json:"template"` // Export template for html; ?template= also works
+}
 
-	// Accept file path from request body (avoids global state race between tabs)
-	var req struct {
-		Path string `json:"path"`
+// parseDownloadRequest reads the /download request. The file is always named
+// by the request, in the body or as ?path=, never taken from server state, so
+// tabs showing different files (or the tree, for files not open) export the
+// file they asked for.
+func parseDownloadRequest(r *http.Request) (downloadRequest, error) {
+	var req downloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return req, errors.New("invalid JSON")
+	}
+	if req.Path == "" {
+		req.Path = r.URL.Query().Get("path")
+	}
+	if strings.TrimSpace(req.Path) == "" {
+		return req, errors.New("missing file path")
+	}
+	if req.Format == "" {
+		req.Format = r.URL.Query().Get("format")
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Path) == "" {
-		http.Error(w, "Missing file path", http.StatusBadRequest)
+	if req.Template == "" {
+		req.Template = r.URL.Query().Get("template")
+	}
+	if req.Format != "" && req.Format != "html" && req.Format != formatMarkdownBundle {
+		return req, errors.New("unknown format (use html or md-bundle)")
+	}
+	return req, nil
+}
+
+func handleDownload(w http.ResponseWriter, r *http.Request) {
+	req, err := parseDownloadRequest(r)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid download request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	absFilePath := resolveFilePath(filepath.Clean(strings.TrimPrefix(strings.TrimSpace(req.Path), "/")))
 
-	filePath, err := validateAndResolvePath(absFilePath)
+	filePath, err := safepath.Resolve(absFilePath)
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusForbidden)
+		writeError(w, pathErrorCode(err), "Invalid path", http.StatusForbidden)
 		return
 	}
 
 	if !isWhitelistedFile(filePath) {
-		http.Error(w, "File not found or access denied", http.StatusForbidden)
+		writeError(w, errCodeNotWhitelisted, "File not found or access denied", http.StatusForbidden)
 		return
 	}
 
 	// Read and render markdown
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	if req.Format == formatMarkdownBundle {
+		writeMarkdownBundle(w, filePath, content)
 		return
 	}
 
-	md := newMarkdownRenderer()
-	var buf bytes.Buffer
-	if err := md.Convert(content, &buf); err != nil {
-		http.Error(w, "Failed to render markdown", http.StatusInternalServerError)
+	rendered, err := renderFile(filePath, content)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to render markdown", http.StatusInternalServerError)
 		return
 	}
 
-	// Build self-contained HTML with inlined CSS (light theme only)
-	htmlTemplate := `<!DOCTYPE html>
-<html lang="en" data-color-mode="light" data-light-theme="light">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>%s</title>
-    <style>
-%s
-    </style>
-</head>
-<body class="markdown-body">
-    <div class="container" style="max-width: 980px; margin: 0 auto; padding: 45px;">
-%s
-    </div>
-</body>
-</html>`
-
-	// Use light theme CSS only (from github-markdown.css)
-	html := fmt.Sprintf(htmlTemplate,
-		template.HTMLEscapeString(filepath.Base(filePath)),
-		githubCSS,
-		buf.String(),
-	)
+	// Self-contained HTML: the export template named in the request, the
+	// user's default.html, or the built-in light-theme page
+	page, err := executeExportPage(req.Template, downloadTmpl, newExportPage(filePath, getRelativePath(filePath), content, rendered))
+	if err != nil {
+		status, code := http.StatusInternalServerError, errCodeInternal
+		if errors.Is(err, os.ErrNotExist) {
+			status, code = http.StatusNotFound, errCodeNotFound
+		} else if errors.Is(err, os.ErrInvalid) {
+			status, code = http.StatusBadRequest, errCodeBadRequest
+		}
+		writeError(w, code, "Cannot apply export template: "+err.Error(), status)
+		return
+	}
 
 	// Set headers for download
 	filename := strings.TrimSuffix(filepath.Base(filePath), ".md") + ".html"
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(html)))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(page)))
 
-	if _, err := w.Write([]byte(html)); err != nil {
+	if _, err := w.Write(page); err != nil {
 		log.Printf("Failed to write download response: %v", err)
 	}
 }
@@ -1484,8 +1343,22 @@ func serveTreeHTML(w http.ResponseWriter, r *http.Request) {
 	currentBrowseDir := browseDir
 	fileMutex.RUnlock()
 
-	// Generate tree HTML
-	treeHTML := generateTreeHTML()
+	filter, err := parseTreeFilter(r)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid tree filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Generate tree HTML; a filtered tree keeps the default expansion
+	var expanded map[string]bool
+	if !filter.active() {
+		expanded = expandedTreeDirs(r)
+	}
+	messages := messagesFor(r)
+	treeHTML := tree.RenderHTMLExpanded(buildFilteredFileTree(filter), expanded, messages)
+	if !filter.active() {
+		treeHTML = withBookmarks(treeHTML, messages)
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -1504,74 +1377,87 @@ func serveSSE(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
 
 	// Verify flusher support early
-	flusher, ok := w.(http.Flusher)
-	if !ok {
+	if _, ok := w.(http.Flusher); !ok {
 		log.Printf("SSE error: ResponseWriter doesn't support flushing")
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		writeError(w, errCodeInternal, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
 
-	clientChan := make(chan string, 10) // Buffer 10 events to handle bursts
+	// Watch this client's open tabs while it is connected
+	defer trackTabClient(w, r)()
 
-	clientsMutex.Lock()
-	clients[clientChan] = true
-	clientCount := len(clients)
-	clientsMutex.Unlock()
+	client, clientCount := registerClient(r)
 
 	// Broadcast connection status to all clients
 	broadcastConnectionStatus(clientCount)
 
 	defer func() {
-		clientsMutex.Lock()
-		delete(clients, clientChan)
-		clientCount := len(clients)
-		clientsMutex.Unlock()
-		close(clientChan)
-
 		// Broadcast updated connection status to remaining clients
-		broadcastConnectionStatus(clientCount)
+		broadcastConnectionStatus(unregisterClient(client))
 	}()
 
 	// Send initial comment to establish connection
-	fmt.Fprintf(w, ": connected\n\n")
-	flusher.Flush()
-
-	// Replay missed events if client reconnected with Last-Event-ID
-	lastEventID := r.Header.Get("Last-Event-ID")
-	if lastEventID != "" {
-		log.Printf("Client reconnected with Last-Event-ID: %s", lastEventID)
-		missedEvents := globalEventBuffer.getAfter(lastEventID)
-		if len(missedEvents) > 0 {
-			log.Printf("Replaying %d missed events", len(missedEvents))
-			for _, evt := range missedEvents {
-				fmt.Fprintf(w, "id: %s\ndata: %s\n\n", evt.id, evt.data)
-			}
-			flusher.Flush()
-		} else {
-			log.Printf("No missed events found after ID %s", lastEventID)
-		}
+	if err := client.send(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := replayMissedEvents(w, r, client); err != nil {
+		return
 	}
 
-	// Keep connection alive (10s interval < 15s WriteTimeout to prevent disconnections)
-	ticker := time.NewTicker(10 * time.Second)
+	// Keep the connection alive through proxies that drop idle ones
+	ticker := time.NewTicker(keepaliveInterval())
 	defer ticker.Stop()
 
 	for {
+		var err error
 		select {
-		case message := <-clientChan:
+		case message := <-client.ch:
 			// Message already formatted with "id: X\ndata: Y" from notifyClientsWithMessage
-			if _, err := fmt.Fprintf(w, "%s\n\n", message); err != nil {
-				return
-			}
-			flusher.Flush()
+			err = client.send(w, message+"\n\n")
 		case <-ticker.C:
-			if _, err := fmt.Fprintf(w, ": keepalive\n\n"); err != nil {
-				return
-			}
-			flusher.Flush()
+			err = client.send(w, ": keepalive\n\n")
+		case <-client.kick:
+			return
 		case <-r.Context().Done():
 			return
 		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// replayMissedEvents sends the events a reconnecting client missed, given
+// the Last-Event-ID header (or ?last_event_id=, for clients that open a new
+// EventSource to reconnect)
+func replayMissedEvents(w http.ResponseWriter, r *http.Request, client *sseClient) error {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID == "" {
+		return nil
+	}
+
+	log.Printf("Client reconnected with Last-Event-ID: %s", lastEventID)
+	missedEvents, found := globalEventBuffer.getAfter(lastEventID)
+	switch {
+	case !found:
+		// Too far behind to replay: have the client fetch /api/resync
+		log.Printf("Event %s is no longer buffered, asking client to resync", lastEventID)
+		return client.send(w, "data: {\"type\":\"resync\"}\n\n")
+	case len(missedEvents) > 0:
+		log.Printf("Replaying %d missed events", len(missedEvents))
+		var replay strings.Builder
+		for _, evt := range missedEvents {
+			if client.filter.matches(eventScopeOf(evt.data)) {
+				fmt.Fprintf(&replay, "id: %s\ndata: %s\n\n", evt.id, evt.data)
+			}
+		}
+		return client.send(w, replay.String())
+	default:
+		log.Printf("No missed events found after ID %s", lastEventID)
+		return nil
 	}
 }
 
@@ -1582,6 +1468,7 @@ func notifyClients() {
 func notifyClientsWithMessage(message string) {
 	// Assign event ID and add to buffer for replay
 	id := globalEventBuffer.add(message)
+	scope := eventScopeOf(message) // Before locking: may take fileMutex
 
 	clientsMutex.RLock()
 	defer clientsMutex.RUnlock()
@@ -1589,10 +1476,12 @@ func notifyClientsWithMessage(message string) {
 	// Send with SSE event ID for replay support
 	formattedMsg := fmt.Sprintf("id: %s\ndata: %s", id, message)
 
-	for clientChan := range clients {
-		select {
-		case clientChan <- formattedMsg:
-		default:
+	for _, client := range clients {
+		if !client.filter.matches(scope) {
+			continue
+		}
+		if client.queue(formattedMsg) {
+			dropStaleClient(client)
 		}
 	}
 }
@@ -1619,28 +1508,35 @@ func serveBrowser(w http.ResponseWriter, r *http.Request) {
 	// Get state snapshot (thread-safe)
 	fileMutex.RLock()
 	currentBrowseDir := browseDir
-	currentMarkdownFiles := make([]string, len(markdownFiles))
-	copy(currentMarkdownFiles, markdownFiles)
+	currentMarkdownFiles := markdownFiles.list()
 	fileMutex.RUnlock()
 
 	// Generate tree HTML for sidebar
-	treeHTML := generateTreeHTML()
+	treeHTML := generateTreeHTML(r)
 
 	// Smart file selection for unified layout
-	defaultFile := selectDefaultFile(currentMarkdownFiles)
+	defaultFile := configuredDefaultFile(currentBrowseDir)
+	if defaultFile == "" {
+		defaultFile = selectDefaultFile(currentMarkdownFiles)
+	}
 
 	var content template.HTML
-	var showBackButton bool
-	var title, subtitle string
+	var markdownContent []byte
+	var showBackButton, stream bool
+	var title, subtitle, editPath string
 
 	if defaultFile != "" {
-		// Render markdown content for the selected file
-		markdownContent, err := os.ReadFile(defaultFile)
+		// Render markdown content for the selected file (large ones as the page streams)
+		var err error
+		markdownContent, err = os.ReadFile(defaultFile)
 		if err == nil {
-			md := newMarkdownRenderer()
-			var buf bytes.Buffer
-			if err := md.Convert(markdownContent, &buf); err == nil {
-				content = template.HTML(buf.String())
+			stream = streamsRender(r, markdownContent)
+			rendered := string(streamedContent) // Replaced by streamTemplate
+			if !stream {
+				rendered, err = renderFile(defaultFile, markdownContent)
+			}
+			if err == nil {
+				content = template.HTML(rendered)
 				showBackButton = true
 				title = filepath.Base(defaultFile)
 
@@ -1650,6 +1546,7 @@ func serveBrowser(w http.ResponseWriter, r *http.Request) {
 					relPath = rel
 				}
 				subtitle = fmt.Sprintf("%s - %d file(s)", relPath, len(currentMarkdownFiles))
+				editPath = filepath.ToSlash(relPath)
 			} else {
 				log.Printf("Error rendering markdown: %v", err)
 			}
@@ -1665,49 +1562,32 @@ func serveBrowser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := browserTemplateData{
-		baseTemplateData: newBaseTemplateData(),
+		baseTemplateData: newBaseTemplateData(r),
 		Title:            title,
 		Subtitle:         subtitle,
 		TreeHTML:         template.HTML(treeHTML),
 		Content:          content,
 		ShowBackButton:   showBackButton,
 		BrowsePath:       currentBrowseDir,
+		EditPath:         editPath,
+		DeleteMode:       *deleteMode,
+		ReadOnly:         defaultFile != "" && checkWritable(defaultFile) != nil,
+		Breadcrumbs:      newBreadcrumbTrail(currentBrowseDir, defaultFile),
+		Scanning:         startupScanRunning.Load(),
 	}
 
-	renderTemplate(w, r, data)
-}
-
-// handleClaudeHook receives file modification events from Claude Code hooks
-func handleClaudeHook(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req struct {
-		SessionID      string `json:"session_id"`
-		ToolName       string `json:"tool_name"`
-		FilePath       string `json:"file_path"`
-		Content        string `json:"content"`
-		PermissionMode string `json:"permission_mode"`
-		ToolUseID      string `json:"tool_use_id"`
-		CWD            string `json:"cwd"`
-		TranscriptPath string `json:"transcript_path"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Validate required fields
-	if req.SessionID == "" || req.FilePath == "" {
-		http.Error(w, "Missing required fields: session_id and file_path", http.StatusBadRequest)
+	if stream {
+		streamTemplate(w, r, data, func(w io.Writer) string { return streamRender(w, defaultFile, markdownContent) })
 		return
 	}
+	renderTemplate(w, r, data)
+}
 
+// handlePostToolUse records which session modified a file (the original file-modified hook)
+func handlePostToolUse(req hookRequest) {
 	// Create session metadata
 	metadata := &SessionMetadata{
+		Source:         req.Source,
 		SessionID:      req.SessionID,
 		ToolName:       req.ToolName,
 		PermissionMode: req.PermissionMode,
@@ -1719,6 +1599,7 @@ func handleClaudeHook(w http.ResponseWriter, r *http.Request) {
 
 	// Register session mapping for file
 	globalSessionStore.register(req.FilePath, metadata)
+	recordHookEvent(req)
 
 	// Cache plan content from devcontainer/remote environments
 	if req.Content != "" && strings.HasSuffix(req.FilePath, ".md") &&
@@ -1744,10 +1625,7 @@ func handleClaudeHook(w http.ResponseWriter, r *http.Request) {
 			(strings.HasPrefix(req.FilePath, plansDir+sep) ||
 				strings.HasPrefix(req.FilePath, cacheDir+sep))
 		if isPlan {
-			if !isWhitelistedFile(req.FilePath) {
-				fileMutex.Lock()
-				markdownFiles = append(markdownFiles, req.FilePath)
-				fileMutex.Unlock()
+			if addToWhitelist(req.FilePath) {
 				log.Printf("Whitelisted Claude plan: %s", req.FilePath)
 			}
 			// Broadcast file_modified so the toast fires (no fsnotify outside watched dir)
@@ -1755,48 +1633,31 @@ func handleClaudeHook(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Truncate session ID for logging (first 8 chars)
-	shortSession := req.SessionID
-	if len(shortSession) > 8 {
-		shortSession = shortSession[:8]
-	}
-
-	log.Printf("AI session %s tracked for: %s (mode: %s)", shortSession, req.FilePath, req.PermissionMode)
-
-	w.WriteHeader(http.StatusOK)
+	log.Printf("AI session %s tracked for: %s (mode: %s)", shortSessionID(req.SessionID), req.FilePath, req.PermissionMode)
+	followFile(req.FilePath, req.SessionID)
 }
 
 func handleNavigate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	r.Body = http.MaxBytesReader(w, r.Body, maxNavigateBodySize)
+	targetPath, err := decodeNavigatePath(r)
+	if isBodyTooLarge(err) {
+		writeError(w, errCodeTooLarge, "Request body too large", http.StatusRequestEntityTooLarge)
 		return
 	}
-
-	var req struct {
-		Path string `json:"path"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-
-	targetPath := strings.TrimSpace(req.Path)
 	if targetPath == "" {
-		http.Error(w, "Path cannot be empty", http.StatusBadRequest)
+		writeError(w, errCodeBadRequest, "Path cannot be empty", http.StatusBadRequest)
 		return
 	}
 
 	// Validate and resolve path with security checks
-	validatedPath, err := validateAndResolvePath(targetPath)
+	validatedPath, err := safepath.Resolve(targetPath)
 	if err != nil {
-		statusCode := http.StatusBadRequest
-		if strings.Contains(err.Error(), "access denied") {
-			statusCode = http.StatusForbidden
-		} else if strings.Contains(err.Error(), "cannot determine home directory") {
-			statusCode = http.StatusInternalServerError
-		}
-		http.Error(w, err.Error(), statusCode)
+		statusCode, code := resolveErrorStatus(err)
+		writeError(w, code, err.Error(), statusCode)
 		return
 	}
 	targetPath = validatedPath
@@ -1804,133 +1665,205 @@ func handleNavigate(w http.ResponseWriter, r *http.Request) {
 	// Check if path exists and is a directory
 	info, err := os.Stat(targetPath)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Cannot access path: %v", err), http.StatusBadRequest)
+		writeError(w, errCodeBadRequest, fmt.Sprintf("Cannot access path: %v", err), http.StatusBadRequest)
 		return
 	}
 	if !info.IsDir() {
-		http.Error(w, "Path must be a directory", http.StatusBadRequest)
+		writeError(w, errCodeBadRequest, "Path must be a directory", http.StatusBadRequest)
+		return
+	}
+
+	if err := switchBrowseDir(targetPath); err != nil {
+		writeError(w, errCodeBadRequest, "No markdown files found in directory", http.StatusBadRequest)
+		return
+	}
+	globalNavHistory.visit(targetPath)
+
+	if isNoScriptRequest(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
+	w.WriteHeader(http.StatusOK)
+}
+
+// errNoMarkdown is returned for directories without markdown files to browse
+var errNoMarkdown = errors.New("no markdown files found in directory")
+
+// switchBrowseDir makes targetPath (validated) the browsed directory: its
+// whitelist, settings, watcher and search index
+func switchBrowseDir(targetPath string) error {
 	// Collect markdown files in new directory
-	newMarkdownFiles := collectMarkdownFiles(targetPath)
+	newMarkdownFiles, settings, gitignore := collectMarkdownFilesWithSettings(targetPath)
 	if len(newMarkdownFiles) == 0 {
-		http.Error(w, "No markdown files found in directory", http.StatusBadRequest)
-		return
+		return errNoMarkdown
 	}
 
 	// Update state thread-safely
 	fileMutex.Lock()
 	browseDir = targetPath
-	markdownFiles = newMarkdownFiles
+	markdownFiles = newFileSet(newMarkdownFiles)
 	fileMutex.Unlock()
+	cacheDirSettings(settings, gitignore)
 
 	// Restart directory watcher for new directory
-	if err := dirWatcher.watchDirectory(targetPath); err != nil {
+	if err := watchBrowseDir(targetPath); err != nil {
 		log.Printf("Warning: Cannot watch new directory for changes: %v", err)
 	}
+	startSearchIndex(targetPath, newMarkdownFiles)
+	rememberRecentDir(targetPath, len(newMarkdownFiles))
+	go func() { saveFileListCache(targetPath, fileModTimes(newMarkdownFiles)) }()
 
 	log.Printf("Navigated to: %s (%d markdown files)", targetPath, len(newMarkdownFiles))
+	return nil
+}
 
-	w.WriteHeader(http.StatusOK)
+// decodeNavigatePath reads the target path from a JSON body or, for the
+// no-JavaScript fallback, from a urlencoded form
+func decodeNavigatePath(r *http.Request) (string, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(r.FormValue("path")), nil
+	}
+
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(req.Path), nil
 }
 
-// moveToTrash attempts to move a file to the OS trash/recycle bin.
-// Falls back to permanent deletion (os.Remove) if trash commands fail.
-// Supports macOS (osascript), Linux (gio trash), and Windows (PowerShell).
-func moveToTrash(filePath string) error {
+// revealInFileManager opens the OS file manager with filePath selected.
+// Supports macOS (open -R), Windows (explorer /select) and Linux (xdg-open of
+// the parent directory, since there is no portable way to select a file).
+func revealInFileManager(filePath string) error {
 	var cmd *exec.Cmd
 
 	switch runtime.GOOS {
 	case "darwin": // macOS
-		// Escape backslashes and double quotes to prevent AppleScript injection
-		escaped := strings.ReplaceAll(filePath, `\`, `\\`)
-		escaped = strings.ReplaceAll(escaped, `"`, `\"`)
-		script := fmt.Sprintf(`tell application "Finder" to delete POSIX file "%s"`, escaped)
-		cmd = exec.Command("osascript", "-e", script)
+		// open receives filePath as a separate argument, safe from injection
+		cmd = exec.Command("open", "-R", filePath)
 
 	case "linux":
-		// gio trash passes filePath as an argument, safe from injection
-		cmd = exec.Command("gio", "trash", filePath)
+		cmd = exec.Command("xdg-open", filepath.Dir(filePath))
 
 	case "windows":
-		// Escape single quotes for PowerShell single-quoted string
-		escaped := strings.ReplaceAll(filePath, `'`, `''`)
-		script := fmt.Sprintf(`Add-Type -AssemblyName Microsoft.VisualBasic; [Microsoft.VisualBasic.FileIO.FileSystem]::DeleteFile('%s', 'OnlyErrorDialogs', 'SendToRecycleBin')`, escaped)
-		cmd = exec.Command("powershell", "-Command", script)
+		// explorer accepts the path after "/select," as its own argument; Windows
+		// paths cannot contain double quotes, so Go's quoting is enough
+		cmd = exec.Command("explorer", "/select,", filePath)
 
 	default:
-		// Unsupported OS, fall back to permanent deletion
-		log.Printf("Warning: Trash not supported on %s, permanently deleting file: %s", runtime.GOOS, filePath)
-		return os.Remove(filePath)
+		return fmt.Errorf("revealing files is not supported on %s", runtime.GOOS)
 	}
 
-	// Attempt to move to trash
-	if err := cmd.Run(); err != nil {
-		log.Printf("Warning: Failed to move to trash (attempting permanent deletion): %v", err)
-		// Fallback to permanent deletion
-		return os.Remove(filePath)
+	// Don't wait for the file manager; explorer also exits non-zero on success
+	if err := cmd.Start(); err != nil {
+		return err
 	}
+	go cmd.Wait()
 
-	log.Printf("Moved to trash: %s", filePath)
+	log.Printf("Revealed in file manager: %s", filePath)
 	return nil
 }
 
+// handleReveal shows a whitelisted file in the OS file manager
+func handleReveal(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"path"` // Absolute, or relative to the browse directory
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	targetPath := strings.TrimSpace(req.Path)
+	if targetPath == "" {
+		writeError(w, errCodeBadRequest, "Path cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsAbs(targetPath) {
+		targetPath = resolveFilePath(targetPath)
+	}
+
+	validatedPath, err := safepath.Resolve(targetPath)
+	if err != nil {
+		writeError(w, pathErrorCode(err), "Invalid path", http.StatusForbidden)
+		return
+	}
+	if !isWhitelistedFile(validatedPath) {
+		writeError(w, errCodeNotWhitelisted, "File not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	if err := revealInFileManager(validatedPath); err != nil {
+		writeError(w, errCodeInternal, fmt.Sprintf("Failed to reveal file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func handleDelete(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if *deleteMode == deleteDisabled {
+		writeError(w, errCodeForbidden, "Deleting files is disabled (--delete=disabled)", http.StatusForbidden)
 		return
 	}
 
 	var req struct {
-		Path string `json:"path"`
+		Path         string `json:"path"`
+		ConfirmToken string `json:"confirm_token"` // From a 409 response, for deletions that need confirming
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	targetPath := strings.TrimSpace(req.Path)
 	if targetPath == "" {
-		http.Error(w, "Path cannot be empty", http.StatusBadRequest)
+		writeError(w, errCodeBadRequest, "Path cannot be empty", http.StatusBadRequest)
 		return
 	}
 
 	// Validate and resolve path with security checks
-	validatedPath, err := validateAndResolvePath(targetPath)
+	validatedPath, err := safepath.Resolve(targetPath)
 	if err != nil {
-		statusCode := http.StatusBadRequest
-		if strings.Contains(err.Error(), "access denied") {
-			statusCode = http.StatusForbidden
-		} else if strings.Contains(err.Error(), "cannot determine home directory") {
-			statusCode = http.StatusInternalServerError
-		}
-		http.Error(w, err.Error(), statusCode)
+		statusCode, code := resolveErrorStatus(err)
+		writeError(w, code, err.Error(), statusCode)
 		return
 	}
 	targetPath = validatedPath
 
 	if !isWhitelistedFile(targetPath) {
-		http.Error(w, "File not found or access denied", http.StatusForbidden)
+		writeError(w, errCodeNotWhitelisted, "File not found or access denied", http.StatusForbidden)
+		return
+	}
+	if err := checkWritable(targetPath); err != nil {
+		writeError(w, errCodeReadOnly, fmt.Sprintf("Cannot delete file: %v", err), http.StatusForbidden)
 		return
 	}
 
-	// Move file to trash (with fallback to permanent deletion)
-	if err := moveToTrash(targetPath); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to delete file: %v", err), http.StatusInternalServerError)
+	// Large files and files outside the browsed directory need a second request
+	if !checkDeleteConfirmation(w, targetPath, req.ConfirmToken) {
 		return
 	}
 
-	// Remove from markdownFiles list and recollect files
-	fileMutex.Lock()
-	currentBrowseDir := browseDir
-	markdownFiles = collectMarkdownFiles(currentBrowseDir)
-	// Clear currentFile if it was the deleted file
-	if currentFile == targetPath {
-		currentFile = ""
+	// Move file to trash (or delete it with --delete=permanent)
+	if err := moveToTrash(targetPath); err != nil {
+		writeError(w, errCodeInternal, fmt.Sprintf("Failed to delete file: %v", err), http.StatusInternalServerError)
+		return
 	}
-	fileMutex.Unlock()
+
+	// Remove from the whitelist (the directory watcher may beat us to it)
+	removeFromWhitelist(targetPath)
+	textIndex.remove(targetPath)
+
+	// Close the deleted file's tabs and stop watching it
+	globalTabStore.removeEverywhere(targetPath)
+	refreshFileWatches()
 
 	log.Printf("Deleted file: %s", targetPath)
 
@@ -1938,11 +1871,7 @@ func handleDelete(w http.ResponseWriter, r *http.Request) {
 }
 
 func serveFile(w http.ResponseWriter, r *http.Request) {
-	filePath := strings.TrimPrefix(r.URL.Path, "/view/")
-	filePath = strings.TrimPrefix(filePath, "/")
-
-	// Clean the path
-	filePath = filepath.Clean(filePath)
+	filePath := filepath.Clean(r.PathValue("path"))
 
 	// Resolve to absolute path using browseDir
 	absFilePath := resolveFilePath(filePath)
@@ -1959,22 +1888,38 @@ func serveFile(w http.ResponseWriter, r *http.Request) {
 	// Render the markdown file
 	content, err := os.ReadFile(absFilePath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, errCodeInternal, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	md := newMarkdownRenderer()
+	// Large documents render into the response after the page head
+	stream := streamsRender(r, content)
+	var rendered, renderedHash string
+	if !stream {
+		rendered, renderedHash, err = renderForView(r, absFilePath, filePath, content)
+		if err != nil {
+			writeError(w, errCodeInternal, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
-	var buf bytes.Buffer
-	if err := md.Convert(content, &buf); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// ?embed=1: just the rendered document, for framing in other local pages
+	if isEmbedRequest(r) {
+		openTab(w, r, absFilePath)
+		renderEmbed(w, embedTemplateData{
+			baseTemplateData: newBaseTemplateData(r),
+			Title:            filepath.Base(absFilePath),
+			Content:          template.HTML(rendered),
+			Path:             absFilePath,
+			RelPath:          filepath.ToSlash(filePath),
+		})
 		return
 	}
 
 	// Generate tree HTML only for full page loads (not SPA navigation)
 	var treeHTML string
 	if !isPartialRequest(r) {
-		treeHTML = generateTreeHTML()
+		treeHTML = generateTreeHTML(r)
 	}
 
 	// Fetch session metadata for this file (if available)
@@ -1986,103 +1931,56 @@ func serveFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := browserTemplateData{
-		baseTemplateData: newBaseTemplateData(),
+		baseTemplateData: newBaseTemplateData(r),
 		Title:            filepath.Base(absFilePath),
 		Subtitle:         absFilePath,
 		TreeHTML:         template.HTML(treeHTML),
-		Content:          template.HTML(buf.String()),
+		Content:          template.HTML(rendered),
+		RenderHash:       renderedHash,
 		ShowBackButton:   true,
 		BrowsePath:       currentBrowseDir,
 		SessionData:      sessionData,
+		EditPath:         filepath.ToSlash(filePath),
+		DeleteMode:       *deleteMode,
+		ReadOnly:         checkWritable(absFilePath) != nil,
+		Breadcrumbs:      newBreadcrumbTrail(currentBrowseDir, absFilePath),
 	}
-
-	// Set current file for watching
-	fileMutex.Lock()
-	oldFile := currentFile
-	currentFile = absFilePath
-	fileMutex.Unlock()
-
-	// Start watching the new file if it changed
-	if oldFile != absFilePath {
-		if err := fileWatcher.watch(absFilePath); err != nil {
-			log.Printf("Error watching file: %v", err)
-		}
+	if *stableLinks {
+		data.Permalink = permalinkURL(currentBrowseDir, absFilePath)
 	}
 
-	renderTemplate(w, r, data)
-}
-
-// parseIgnoreFile reads and parses .peekmignore file
-func parseIgnoreFile(rootDir string) []string {
-	ignoreFilePath := filepath.Join(rootDir, ".peekmignore")
-
-	// CRITICAL: Validate path through existing security chain
-	validatedPath, err := validateAndResolvePath(ignoreFilePath)
-	if err != nil {
-		return nil // Outside $HOME or path validation failed
+	// peekm FILE.md#anchor: list the real anchors when the heading doesn't exist
+	if want := r.URL.Query().Get("anchor"); want != "" {
+		data.MissingAnchor, data.Anchors = checkAnchor(newMarkdownRenderer(), expandSource(absFilePath, content), want)
 	}
 
-	file, err := os.Open(validatedPath)
-	if err != nil {
-		return nil // File doesn't exist or can't be read - silent fallback
+	// No-JavaScript editing: render the source in a plain form instead
+	if r.URL.Query().Get("edit") == "1" && !data.ReadOnly {
+		data.EditMode = true
+		data.RawContent = string(content)
 	}
-	defer file.Close()
-
-	const maxWarnings = 3
-	const maxPatternLength = 256
-
-	var customPatterns []string
-	var invalidCount int
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
 
-		// Reject patterns that are too long (prevent pathological cases)
-		if len(line) > maxPatternLength {
-			invalidCount++
-			if invalidCount <= maxWarnings {
-				log.Printf("Warning: .peekmignore pattern too long (max %d chars, ignored): %s", maxPatternLength, line[:50]+"...")
-			}
-			continue
-		}
-
-		// Reject patterns with path separators (ambiguous intent)
-		if strings.Contains(line, "/") || strings.Contains(line, "\\") {
-			invalidCount++
-			if invalidCount <= maxWarnings {
-				log.Printf("Warning: .peekmignore pattern contains path separator (ignored): %s", line)
-			}
-			continue
-		}
-
-		// Validate pattern syntax with arbitrary test filename
-		if _, err := filepath.Match(line, "test"); err != nil {
-			invalidCount++
-			if invalidCount <= maxWarnings {
-				log.Printf("Warning: Invalid .peekmignore pattern '%s': %v", line, err)
-			}
-			continue
-		}
-
-		customPatterns = append(customPatterns, line)
+	openTab(w, r, absFilePath)
+	if stream {
+		streamTemplate(w, r, data, func(w io.Writer) string { return streamRender(w, absFilePath, content) })
+		return
 	}
+	renderTemplate(w, r, data)
+}
 
-	// Summarize suppressed warnings
-	if invalidCount > maxWarnings {
-		log.Printf("Warning: Suppressed %d additional invalid .peekmignore patterns", invalidCount-maxWarnings)
+// renderForView renders a file for /view/. Files above --max-render-kb render
+// in parts (?from= is where a part starts); whole renders are kept so live
+// updates can send just what changed, and come with their hash.
+func renderForView(r *http.Request, absFilePath, filePath string, content []byte) (rendered, hash string, err error) {
+	if from := r.URL.Query().Get("from"); (renderLimit() > 0 && len(content) > renderLimit()) || from != "" {
+		offset, _ := strconv.Atoi(from)
+		rendered, _, err = renderFileChunk(absFilePath, filePath, content, offset, messagesFor(r))
+		return rendered, "", err
 	}
-
-	if err := scanner.Err(); err != nil {
-		log.Printf("Warning: Error reading .peekmignore: %v", err)
-		return nil
+	if rendered, err = renderFile(absFilePath, content); err != nil {
+		return "", "", err
 	}
-
-	return customPatterns
+	return rendered, rememberRender(absFilePath, rendered).hash, nil
 }
 
 // getIgnorePatterns returns custom ignore patterns with caching
@@ -2097,8 +1995,8 @@ func getIgnorePatterns(rootDir string) []string {
 	}
 	globalIgnoreCache.mu.RUnlock()
 
-	// Cache miss - parse file
-	patterns := parseIgnoreFile(rootDir)
+	// Cache miss - parse the global ignore file and the project's .peekmignore
+	patterns := mergeIgnorePatterns(globalIgnorePatterns(), tree.ParseIgnoreFile(rootDir))
 
 	// Update cache (write lock)
 	globalIgnoreCache.mu.Lock()
@@ -2109,26 +2007,35 @@ func getIgnorePatterns(rootDir string) []string {
 	return patterns
 }
 
-// matchesIgnorePattern checks if directory name matches any pattern
-func matchesIgnorePattern(dirName string, patterns []string) bool {
-	for _, pattern := range patterns {
-		// Simple wildcard matching using filepath.Match
-		matched, err := filepath.Match(pattern, dirName)
-		if err != nil {
-			log.Printf("Warning: Invalid pattern '%s': %v", pattern, err)
-			continue
-		}
-		if matched {
-			return true
-		}
+// globalIgnorePath returns the user's ignore file, whose patterns apply to
+// every directory peekm browses (~/.config/peekm/ignore on Linux)
+func globalIgnorePath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
 	}
-	return false
+	return filepath.Join(configDir, "peekm", "ignore")
 }
 
-// isHardcodedExclusion checks if directory name is in hardcoded exclusions
-// Uses map for O(1) lookup performance
-func isHardcodedExclusion(dirName string) bool {
-	return hardcodedExclusionsMap[dirName]
+// globalIgnorePatterns returns the patterns of the global ignore file, if any
+func globalIgnorePatterns() []string {
+	if path := globalIgnorePath(); path != "" {
+		return tree.ParseIgnoreFileAt(path)
+	}
+	return nil
+}
+
+// mergeIgnorePatterns combines pattern lists, dropping duplicates
+func mergeIgnorePatterns(lists ...[]string) []string {
+	var merged []string
+	for _, list := range lists {
+		for _, pattern := range list {
+			if !slices.Contains(merged, pattern) {
+				merged = append(merged, pattern)
+			}
+		}
+	}
+	return merged
 }
 
 // FileInfo holds file metadata for smart selection
@@ -2185,311 +2092,169 @@ func selectDefaultFile(files []string) string {
 	return mostRecent.Path
 }
 
+// collectMarkdownFiles returns the markdown files under rootDir, honoring
+// .peekmignore and the .peekm.toml files in the tree
 func collectMarkdownFiles(rootDir string) []string {
-	customPatterns := getIgnorePatterns(rootDir)
-	if len(customPatterns) > 0 {
-		log.Printf("[peekm] Using .peekmignore (%d custom exclusions)", len(customPatterns))
-	}
-
-	homeDir, _ := os.UserHomeDir()
-
-	visited := make(map[string]bool)
-	var files []string
-	collectMarkdownFilesWalk(rootDir, rootDir, homeDir, customPatterns, visited, &files)
-
-	sort.Strings(files)
+	files, _, _ := collectMarkdownFilesWithSettings(rootDir)
 	return files
 }
 
-// isExcludedDir returns true if the directory name should be skipped
-func isExcludedDir(name string, customPatterns []string) bool {
-	if strings.HasPrefix(name, ".") && name != ".claude" {
-		return true
-	}
-	if isHardcodedExclusion(name) {
-		return true
-	}
-	if len(customPatterns) > 0 && matchesIgnorePattern(name, customPatterns) {
-		return true
-	}
-	return false
+// collectMarkdownFilesWithSettings is collectMarkdownFiles that also returns
+// the .peekm.toml settings and, with --respect-gitignore, the .gitignore
+// rules found on the way
+func collectMarkdownFilesWithSettings(rootDir string) ([]string, tree.DirSettings, *tree.Gitignore) {
+	return collectMarkdownFilesEach(rootDir, nil)
 }
 
-// remapPath translates a resolved filesystem path back to its symlink-based equivalent
-func remapPath(resolved, walkDir, path string) string {
-	if walkDir == resolved {
-		return path
-	}
-	relPath, err := filepath.Rel(resolved, path)
-	if err != nil {
-		return path
+// collectMarkdownFilesEach is collectMarkdownFilesWithSettings that calls
+// found (unless nil) with each file as the walk comes across it
+func collectMarkdownFilesEach(rootDir string, found func(path string)) ([]string, tree.DirSettings, *tree.Gitignore) {
+	customPatterns := getIgnorePatterns(rootDir)
+	if len(customPatterns) > 0 {
+		log.Printf("[peekm] Using %d custom exclusion(s) (.peekmignore and %s)", len(customPatterns), globalIgnorePath())
 	}
-	return filepath.Join(walkDir, relPath)
-}
 
-func collectMarkdownFilesWalk(walkDir, rootDir, homeDir string, customPatterns []string, visited map[string]bool, files *[]string) {
-	// Resolve symlinks to get the real path for walking and cycle detection
-	resolved, err := filepath.EvalSymlinks(walkDir)
-	if err != nil {
-		return
+	var gitignore *tree.Gitignore
+	if *respectGit {
+		gitignore = tree.NewGitignore(rootDir)
 	}
-	if visited[resolved] {
-		return
+	files, settings := tree.CollectEach(rootDir, customPatterns, gitignore, found)
+	if len(settings) > 0 {
+		log.Printf("[peekm] Using %d %s file(s)", len(settings), tree.SettingsFileName)
 	}
-	visited[resolved] = true
-
-	// Walk the resolved path (filepath.Walk won't descend into symlink roots)
-	// Remap resolved paths back to the original symlink prefix for tree display
-	filepath.Walk(resolved, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-
-		// Security: Skip symlinks that point outside $HOME
-		resolvedInfo, shouldSkip, resolveErr := validateSymlinkSecurity(path, info, homeDir)
-		if shouldSkip {
-			return filepath.SkipDir
-		}
-		if resolveErr != nil {
-			return nil
-		}
-
-		isSymlink := info.Mode()&os.ModeSymlink != 0
-		if resolvedInfo != nil {
-			info = resolvedInfo
-		}
+	return files, settings, gitignore
+}
 
-		if info.IsDir() {
-			if path != resolved && isExcludedDir(info.Name(), customPatterns) {
-				return filepath.SkipDir
-			}
-			if isSymlink && path != resolved {
-				collectMarkdownFilesWalk(remapPath(resolved, walkDir, path), rootDir, homeDir, customPatterns, visited, files)
-				return nil
-			}
-		}
+// generateTreeHTML renders the sidebar tree with the directories the
+// requesting browser left expanded, below the bookmarks
+func generateTreeHTML(r *http.Request) string {
+	messages := messagesFor(r)
+	return withBookmarks(tree.RenderHTMLExpanded(buildFileTree(), expandedTreeDirs(r), messages), messages)
+}
 
-		if !info.IsDir() && strings.HasSuffix(strings.ToLower(info.Name()), ".md") {
-			*files = append(*files, remapPath(resolved, walkDir, path))
-		}
+// buildFileTree builds the cleaned, sorted tree of whitelisted files relative to browseDir.
+// Returns nil when there are no markdown files.
+func buildFileTree() *tree.Node {
+	return buildFilteredFileTree(treeFilter{})
+}
 
-		return nil
-	})
+// buildFilteredFileTree builds the file tree from the files matching filter,
+// ordered by the site navigation when the browsed directory declares one
+func buildFilteredFileTree(filter treeFilter) *tree.Node {
+	root, _ := buildFileTreePage(filter, pageRequest{})
+	return root
 }
 
-func generateTreeHTML() string {
+// buildFileTreePage builds the tree of one page of the files matching filter,
+// by path, and returns the cursor of the next page. Directories kept while
+// empty come with the first page.
+func buildFileTreePage(filter treeFilter, page pageRequest) (*tree.Node, string) {
 	// Get state snapshot (thread-safe)
 	fileMutex.RLock()
 	currentBrowseDir := browseDir
-	currentMarkdownFiles := make([]string, len(markdownFiles))
-	copy(currentMarkdownFiles, markdownFiles)
+	currentMarkdownFiles := markdownFiles.list()
+	currentDirs := append([]string(nil), createdDirs...)
 	fileMutex.RUnlock()
 
-	if len(currentMarkdownFiles) == 0 {
-		return ""
+	if filter.active() || page.after != "" {
+		currentDirs = nil // Only the matching files' directories
 	}
-
-	// Make browse directory absolute for proper relative path calculation
-	absDir, err := filepath.Abs(currentBrowseDir)
-	if err != nil {
-		absDir = currentBrowseDir
+	relPath := func(path string) string {
+		rel, _ := filepath.Rel(currentBrowseDir, path)
+		return rel
 	}
+	files, next := paginate(filter.apply(currentBrowseDir, currentMarkdownFiles), page,
+		func(path, key string) bool { return relPath(path) <= key }, relPath)
+	root := tree.BuildWithDirs(currentBrowseDir, files, currentDirs)
+	// mkdocs.yml or Docusaurus sidebars: follow the site's navigation order
+	tree.LoadNav(currentBrowseDir).Apply(root)
+	annotateFileTree(root, currentBrowseDir)
+	return root, next
+}
 
-	root := &fileNode{name: ".", isDir: true}
-	dirNodes := make(map[string]*fileNode)
-	dirNodes["."] = root
-
-	// Build directory structure
-	for _, path := range currentMarkdownFiles {
-		// Make file path absolute first
-		absPath := path
-		if !filepath.IsAbs(path) {
-			absPath, _ = filepath.Abs(path)
-		}
-
-		// Make path relative to browse directory
-		relPath, err := filepath.Rel(absDir, absPath)
-		if err != nil {
-			relPath = filepath.Base(path)
-		}
-
-		parts := strings.Split(filepath.Dir(relPath), string(filepath.Separator))
-
-		currentPath := "."
-		for _, part := range parts {
-			if part == "." {
-				continue
-			}
-
-			parentPath := currentPath
-			if currentPath == "." {
-				currentPath = part
-			} else {
-				currentPath = filepath.Join(currentPath, part)
-			}
-
-			if _, exists := dirNodes[currentPath]; !exists {
-				node := &fileNode{
-					name:  part,
-					path:  currentPath, // Use relative path for directories too
-					isDir: true,
-				}
-				dirNodes[currentPath] = node
-				if parent, ok := dirNodes[parentPath]; ok {
-					parent.children = append(parent.children, node)
-				}
-			}
-		}
-
-		// Add file
-		info, err := os.Stat(path)
-		if err != nil {
-			// Skip files that no longer exist (e.g., after navigation to different directory)
-			continue
-		}
-		fileNode := &fileNode{
-			name: filepath.Base(relPath),
-			path: relPath, // Use relative path for the link (security & clean URLs)
-			size: info.Size(),
-		}
-
-		dir := filepath.Dir(relPath)
-		if parent, ok := dirNodes[dir]; ok {
-			parent.children = append(parent.children, fileNode)
-		}
+func openURL(url string) {
+	cmd, args := browserCommand(url)
+	if cmd == "" {
+		log.Printf("Warning: Empty browser command, open %s manually", url)
+		return
 	}
 
-	// Clean and sort tree
-	cleanEmptyDirs(root)
-	sortTree(root)
-
-	// Generate HTML
-	var buf bytes.Buffer
-	generateTreeHTMLRecursive(root, "", true, true, 0, false, &buf)
-	return buf.String()
+	exec := exec.Command(cmd, args...)
+	if err := exec.Start(); err != nil {
+		log.Printf("Failed to open URL %s: %v", url, err)
+	}
 }
 
-func generateTreeHTMLRecursive(node *fileNode, prefix string, isLast bool, isRoot bool, depth int, parentCollapsed bool, buf *bytes.Buffer) {
-	if !isRoot {
-		// Start tree item container
-		buf.WriteString(`<div class="tree-item">`)
-
-		if node.isDir {
-			// Collapse directories at depth >= 1 by default
-			collapsed := depth >= 1
-
-			// Directory node with chevron and name
-			buf.WriteString(fmt.Sprintf(`<div class="tree-node"><span class="tree-directory" onclick="toggleDir(this)" data-path="%s">`,
-				template.HTMLEscapeString(node.path)))
-
-			// Chevron icon
-			if collapsed {
-				buf.WriteString(`<span class="expand-icon">▶</span>`)
-			} else {
-				buf.WriteString(`<span class="expand-icon">▼</span>`)
-			}
-
-			buf.WriteString(fmt.Sprintf(`<span class="dir-name">%s</span></span></div>`, template.HTMLEscapeString(node.name)))
-
-			// Children container (collapsed by default at depth >= 1)
-			if len(node.children) > 0 {
-				if collapsed {
-					buf.WriteString(`<div class="tree-children" style="display: none;">`)
-				} else {
-					buf.WriteString(`<div class="tree-children">`)
-				}
-
-				// Render children recursively
-				for _, child := range node.children {
-					generateTreeHTMLRecursive(child, "", false, false, depth+1, false, buf)
-				}
-
-				buf.WriteString(`</div>`) // Close tree-children
+// browserCommand picks the opener: --browser-cmd, then $BROWSER, then the platform default.
+// A %s in the command is replaced by the URL; otherwise the URL is appended.
+func browserCommand(url string) (string, []string) {
+	custom := *browserCmd
+	if custom == "" {
+		// $BROWSER may list several commands separated by ':'; use the first
+		custom, _, _ = strings.Cut(os.Getenv("BROWSER"), string(os.PathListSeparator))
+	}
+	if strings.TrimSpace(custom) != "" {
+		fields := splitCommandLine(custom)
+		if len(fields) == 0 {
+			return "", nil
+		}
+		substituted := false
+		for i, f := range fields {
+			if strings.Contains(f, "%s") {
+				fields[i] = strings.ReplaceAll(f, "%s", url)
+				substituted = true
 			}
-		} else {
-			// File node (leaf)
-			buf.WriteString(`<div class="tree-node"><span class="tree-file">`)
-			buf.WriteString(fmt.Sprintf(`<a href="/view/%s">%s</a>`, template.URLQueryEscaper(node.path), template.HTMLEscapeString(node.name)))
-			buf.WriteString(`</span></div>`)
 		}
-
-		buf.WriteString(`</div>`) // Close tree-item
-	} else {
-		// Root node - just render children
-		for _, child := range node.children {
-			generateTreeHTMLRecursive(child, "", false, false, depth, false, buf)
+		if !substituted {
+			fields = append(fields, url)
 		}
+		return fields[0], fields[1:]
 	}
-}
-
-func openURL(url string) {
-	var cmd string
-	var args []string
 
 	switch {
 	case fileExists("/usr/bin/open"): // macOS
-		cmd = "open"
-		args = []string{url}
+		return "open", []string{url}
 	case fileExists("/usr/bin/xdg-open"): // Linux
-		cmd = "xdg-open"
-		args = []string{url}
+		return "xdg-open", []string{url}
 	default: // Windows
-		cmd = "cmd"
-		args = []string{"/c", "start", url}
+		return "cmd", []string{"/c", "start", url}
+	}
+}
+
+// splitCommandLine splits a command string on whitespace, honoring single and double quotes
+func splitCommandLine(s string) []string {
+	var fields []string
+	var current strings.Builder
+	var quote rune
+	inField := false
+
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
 	}
-
-	exec := exec.Command(cmd, args...)
-	if err := exec.Start(); err != nil {
-		log.Printf("Failed to open URL %s: %v", url, err)
+	if inField {
+		fields = append(fields, current.String())
 	}
+	return fields
 }
 
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
-
-type fileNode struct {
-	name     string
-	path     string
-	size     int64
-	isDir    bool
-	children []*fileNode
-}
-
-func cleanEmptyDirs(node *fileNode) bool {
-	if !node.isDir {
-		return true // Keep files
-	}
-
-	// Recursively clean children
-	kept := make([]*fileNode, 0)
-	for _, child := range node.children {
-		if cleanEmptyDirs(child) {
-			kept = append(kept, child)
-		}
-	}
-	node.children = kept
-
-	// Keep directory if it has children or is root
-	return len(node.children) > 0 || node.name == "."
-}
-
-func sortTree(node *fileNode) {
-	if !node.isDir {
-		return
-	}
-
-	// Sort children: directories first, then files, alphabetically within each group
-	sort.Slice(node.children, func(i, j int) bool {
-		if node.children[i].isDir != node.children[j].isDir {
-			return node.children[i].isDir
-		}
-		return node.children[i].name < node.children[j].name
-	})
-
-	// Recursively sort children
-	for _, child := range node.children {
-		sortTree(child)
-	}
-}
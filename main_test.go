@@ -0,0 +1,255 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDecodeNavigatePath tests that navigate accepts both JSON and plain form bodies
+func TestDecodeNavigatePath(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "json body",
+			contentType: "application/json",
+			body:        `{"path": " ~/docs "}`,
+			want:        "~/docs",
+		},
+		{
+			name:        "form body (no JavaScript)",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "path=%7E%2Fdocs&noscript=1",
+			want:        "~/docs",
+		},
+		{
+			name:        "invalid json",
+			contentType: "application/json",
+			body:        `{"path":`,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/navigate", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			got, err := decodeNavigatePath(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeNavigatePath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeNavigatePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseDownloadRequest tests that downloads name their file in the body or the query
+func TestParseDownloadRequest(t *testing.T) {
+	tests := []struct {
+		target, body string
+		want         downloadRequest
+		wantErr      bool
+	}{
+		{"/download", `{"path": "a.md"}`, downloadRequest{Path: "a.md"}, false},
+		{"/download?path=b.md&format=md-bundle", "", downloadRequest{Path: "b.md", Format: "md-bundle"}, false},
+		{"/download?path=b.md", `{"path": "a.md", "template": "memo"}`, downloadRequest{Path: "a.md", Template: "memo"}, false},
+		{"/download", "", downloadRequest{}, true},
+		{"/download?path=a.md", `{"path":`, downloadRequest{}, true},
+		{"/download?path=a.md&format=pdf", "", downloadRequest{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDownloadRequest(httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body)))
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("parseDownloadRequest(%s, %s) = %+v, %v; want %+v (error %v)", tt.target, tt.body, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestCheckAnchor tests heading validation for peekm FILE.md#anchor
+func TestCheckAnchor(t *testing.T) {
+	md := newMarkdownRenderer()
+	source := []byte("# Title\n\n## Installation\n")
+
+	if missing, anchors := checkAnchor(md, source, "installation"); missing != "" || anchors != nil {
+		t.Errorf("checkAnchor(installation) = %q, %v; want match", missing, anchors)
+	}
+
+	missing, anchors := checkAnchor(md, source, "#usage")
+	if missing != "usage" || strings.Join(anchors, ",") != "title,installation" {
+		t.Errorf("checkAnchor(#usage) = %q, %v", missing, anchors)
+	}
+}
+
+// TestBrowserCommand tests --browser-cmd parsing, quoting and %s substitution
+func TestBrowserCommand(t *testing.T) {
+	defer func(old string) { *browserCmd = old }(*browserCmd)
+
+	tests := []struct {
+		name     string
+		cmd      string
+		wantCmd  string
+		wantArgs []string
+	}{
+		{
+			name:     "url appended",
+			cmd:      "firefox --private-window",
+			wantCmd:  "firefox",
+			wantArgs: []string{"--private-window", "http://localhost:6419"},
+		},
+		{
+			name:     "placeholder and quotes",
+			cmd:      `"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome" --app=%s`,
+			wantCmd:  "/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+			wantArgs: []string{"--app=http://localhost:6419"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*browserCmd = tt.cmd
+			gotCmd, gotArgs := browserCommand("http://localhost:6419")
+			if gotCmd != tt.wantCmd || strings.Join(gotArgs, "|") != strings.Join(tt.wantArgs, "|") {
+				t.Errorf("browserCommand() = %q %q, want %q %q", gotCmd, gotArgs, tt.wantCmd, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestLinkifySchemes tests --linkify parsing
+func TestLinkifySchemes(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{"none", []string{}},
+		{" HTTPS, mailto ,", []string{"https", "mailto"}},
+	}
+	for _, tt := range tests {
+		got := linkifySchemes(tt.value)
+		if !reflect.DeepEqual(got, tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("linkifySchemes(%q) = %#v, want %#v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNewServerTimeouts(t *testing.T) {
+	prevRead, prevIdle := *readTimeout, *idleTimeout
+	t.Cleanup(func() { *readTimeout, *idleTimeout = prevRead, prevIdle })
+	*readTimeout, *idleTimeout = 2*time.Minute, 0
+
+	server := newServer("localhost:0")
+	if server.ReadTimeout != 2*time.Minute || server.IdleTimeout != 0 || server.WriteTimeout != 0 {
+		t.Errorf("timeouts: read %v, idle %v, write %v", server.ReadTimeout, server.IdleTimeout, server.WriteTimeout)
+	}
+}
+
+// TestBrowseDirHandlersIgnoredFiles tests that files matching ignore patterns
+// never reach the whitelist or SSE clients
+func TestBrowseDirHandlersIgnoredFiles(t *testing.T) {
+	dir := t.TempDir()
+	prevDir, prevFiles, prevClients, prevEvents, prevSessions := browseDir, markdownFiles, clients, globalEventBuffer, globalSessionStore
+	defer func() {
+		browseDir, markdownFiles, clients, globalEventBuffer, globalSessionStore = prevDir, prevFiles, prevClients, prevEvents, prevSessions
+		globalIgnoreCache.mu.Lock()
+		globalIgnoreCache.rootDir = ""
+		globalIgnoreCache.mu.Unlock()
+	}()
+	browseDir, markdownFiles, globalSessionStore = dir, newFileSet(nil), nil
+	clients, globalEventBuffer = make(map[uint64]*sseClient), newEventBuffer(50)
+	globalIgnoreCache.mu.Lock()
+	globalIgnoreCache.rootDir, globalIgnoreCache.patterns = dir, []string{"*.generated.md"}
+	globalIgnoreCache.mu.Unlock()
+	client, _ := registerClient(httptest.NewRequest("GET", "/events", nil))
+
+	handlers := browseDirHandlers(dir)
+	ignored, kept := filepath.Join(dir, "api.generated.md"), filepath.Join(dir, "guide.md")
+
+	handlers.Created(ignored)
+	handlers.Removed(ignored)
+	handlers.Created(kept)
+	if isWhitelistedFile(ignored) || !isWhitelistedFile(kept) {
+		t.Errorf("whitelist = %v, want only guide.md", whitelistedFiles())
+	}
+
+	// The new file is announced (once its session lookup ends); the ignored one never is
+	select {
+	case msg := <-client.ch:
+		if !strings.Contains(msg, `"path":"guide.md"`) {
+			t.Errorf("event = %q, want guide.md added", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("new file never announced")
+	}
+	if len(client.ch) != 0 {
+		t.Errorf("%d extra events", len(client.ch))
+	}
+}
+
+func TestBrowseDirHandlersGitignore(t *testing.T) {
+	dir := serveTestFiles(t, "gitignore", map[string]string{".gitignore": "build/\n*.draft.md\n"})
+
+	prevSessions, prevRespect := globalSessionStore, *respectGit
+	defer func() {
+		globalSessionStore, *respectGit = prevSessions, prevRespect
+		cacheDirSettings(nil, nil)
+	}()
+	*respectGit = true
+	files, settings, gitignore := collectMarkdownFilesWithSettings(dir)
+	markdownFiles, globalSessionStore = newFileSet(files), nil
+	cacheDirSettings(settings, gitignore)
+
+	handlers := browseDirHandlers(dir)
+	if !handlers.SkipDir(filepath.Join(dir, "build")) || handlers.SkipDir(filepath.Join(dir, "docs")) {
+		t.Error("SkipDir should skip build/ only")
+	}
+	ignored := filepath.Join(dir, "intro.draft.md")
+	handlers.Created(ignored)
+	if isWhitelistedFile(ignored) {
+		t.Error("a gitignored file was added to the whitelist")
+	}
+}
+
+// serveTestFiles browses a new directory under $HOME (safepath allows no
+// other) holding files, by slash-separated path relative to it, and serves
+// them; per-user state goes to a temporary config directory. name tells the
+// test directories apart.
+func serveTestFiles(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	dir, err := os.MkdirTemp(homeDir, ".peekm-"+name+"-test-*")
+	if err != nil {
+		t.Skip("cannot create temp dir under $HOME")
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	var paths []string
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	prevDir, prevFiles := browseDir, markdownFiles
+	t.Cleanup(func() { browseDir, markdownFiles = prevDir, prevFiles })
+	browseDir, markdownFiles = dir, newFileSet(paths)
+	return dir
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	mdnsServiceType = "_peekm._tcp.local."
+	mdnsServicesAll = "_services._dns-sd._udp.local." // DNS-SD service type enumeration
+	mdnsTTL         = 120
+	mdnsCacheFlush  = dnsmessage.Class(0x8000) // Unique-record bit (RFC 6762 section 10.2)
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsAnnouncer answers mDNS queries for this peekm instance as _peekm._tcp
+type mdnsAnnouncer struct {
+	instance dnsmessage.Name // e.g. peekm-laptop._peekm._tcp.local.
+	service  dnsmessage.Name
+	host     dnsmessage.Name // e.g. laptop.local.
+	ip       [4]byte
+	port     uint16
+	txt      []string
+	conn     *net.UDPConn
+}
+
+// startMDNSIfEnabled starts the announcer when --mdns is set and returns its stop
+// function (a no-op when disabled or when the announcement failed)
+func startMDNSIfEnabled() func() {
+	if !*useMDNS {
+		return func() {}
+	}
+	stop, err := startMDNS(*host, *port)
+	if err != nil {
+		log.Printf("Warning: mDNS announcement disabled: %v", err)
+		return func() {}
+	}
+	return stop
+}
+
+// startMDNS advertises the server on the local network and returns a stop function
+// that sends a goodbye packet. Only non-loopback binds are announced.
+func startMDNS(bindHost string, port int) (func(), error) {
+	if lanURL == "" {
+		return nil, fmt.Errorf("mDNS requires a LAN bind address (use --host 0.0.0.0)")
+	}
+
+	addr, err := lanAddress(bindHost)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(addr).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("mDNS requires an IPv4 address, got %s", addr)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "peekm"
+	}
+	hostname, _, _ = strings.Cut(hostname, ".")
+
+	a := &mdnsAnnouncer{
+		port: uint16(port),
+		txt: []string{
+			"path=/",
+			"version=" + version,
+			fmt.Sprintf("token=%t", accessToken != ""),
+		},
+	}
+	copy(a.ip[:], ip)
+	if a.service, err = dnsmessage.NewName(mdnsServiceType); err != nil {
+		return nil, err
+	}
+	if a.instance, err = dnsmessage.NewName("peekm-" + hostname + "." + mdnsServiceType); err != nil {
+		return nil, err
+	}
+	if a.host, err = dnsmessage.NewName(hostname + ".local."); err != nil {
+		return nil, err
+	}
+
+	a.conn, err = net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return nil, fmt.Errorf("listen for mDNS: %w", err)
+	}
+
+	// Unsolicited announcements (RFC 6762 section 8.3: at least two, one second apart)
+	go func() {
+		for i := 0; i < 2; i++ {
+			a.send(mdnsTTL)
+			time.Sleep(time.Second)
+		}
+	}()
+	go a.serve()
+
+	log.Printf("Advertising %s on %s:%d via mDNS", a.instance, addr, port)
+	return a.stop, nil
+}
+
+// serve answers queries for our service, instance, or host name until the connection closes
+func (a *mdnsAnnouncer) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			return // Connection closed on shutdown
+		}
+		if a.wantsAnswer(buf[:n]) {
+			a.send(mdnsTTL)
+		}
+	}
+}
+
+// wantsAnswer reports whether a packet is a query that asks about this instance
+func (a *mdnsAnnouncer) wantsAnswer(packet []byte) bool {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil || header.Response {
+		return false
+	}
+
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return false
+	}
+	for _, q := range questions {
+		name := strings.ToLower(q.Name.String())
+		switch name {
+		case strings.ToLower(a.service.String()), strings.ToLower(a.instance.String()),
+			strings.ToLower(a.host.String()), mdnsServicesAll:
+			return true
+		}
+	}
+	return false
+}
+
+// send multicasts the full record set (PTR, SRV, TXT, A); ttl 0 is a goodbye
+func (a *mdnsAnnouncer) send(ttl uint32) {
+	packet, err := a.response(ttl)
+	if err != nil {
+		log.Printf("mDNS: cannot build response: %v", err)
+		return
+	}
+	if _, err := a.conn.WriteToUDP(packet, mdnsGroup); err != nil {
+		log.Printf("mDNS: cannot send response: %v", err)
+	}
+}
+
+// response builds an authoritative answer for this instance
+func (a *mdnsAnnouncer) response(ttl uint32) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	shared := func(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET, TTL: ttl}
+	}
+	unique := func(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET | mdnsCacheFlush, TTL: ttl}
+	}
+
+	servicesAll := dnsmessage.MustNewName(mdnsServicesAll)
+	if err := b.PTRResource(shared(servicesAll, dnsmessage.TypePTR), dnsmessage.PTRResource{PTR: a.service}); err != nil {
+		return nil, err
+	}
+	if err := b.PTRResource(shared(a.service, dnsmessage.TypePTR), dnsmessage.PTRResource{PTR: a.instance}); err != nil {
+		return nil, err
+	}
+	if err := b.SRVResource(unique(a.instance, dnsmessage.TypeSRV), dnsmessage.SRVResource{Target: a.host, Port: a.port}); err != nil {
+		return nil, err
+	}
+	if err := b.TXTResource(unique(a.instance, dnsmessage.TypeTXT), dnsmessage.TXTResource{TXT: a.txt}); err != nil {
+		return nil, err
+	}
+	if err := b.AResource(unique(a.host, dnsmessage.TypeA), dnsmessage.AResource{A: a.ip}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// stop sends a goodbye packet so peers drop the record immediately, then closes the socket
+func (a *mdnsAnnouncer) stop() {
+	a.send(0)
+	a.conn.Close()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// TestMDNSAnnouncer tests query matching and that responses carry the full record set
+func TestMDNSAnnouncer(t *testing.T) {
+	a := &mdnsAnnouncer{
+		service:  dnsmessage.MustNewName(mdnsServiceType),
+		instance: dnsmessage.MustNewName("peekm-test." + mdnsServiceType),
+		host:     dnsmessage.MustNewName("test.local."),
+		ip:       [4]byte{192, 168, 1, 20},
+		port:     6419,
+		txt:      []string{"path=/"},
+	}
+
+	query := func(name string) []byte {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+		b.StartQuestions()
+		b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET})
+		packet, err := b.Finish()
+		if err != nil {
+			t.Fatalf("build query: %v", err)
+		}
+		return packet
+	}
+
+	if !a.wantsAnswer(query(mdnsServiceType)) {
+		t.Error("expected an answer for the service type query")
+	}
+	if a.wantsAnswer(query("_http._tcp.local.")) {
+		t.Error("expected no answer for an unrelated service")
+	}
+
+	packet, err := a.response(mdnsTTL)
+	if err != nil {
+		t.Fatalf("response() error: %v", err)
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(packet); err != nil {
+		t.Fatalf("unpack response: %v", err)
+	}
+
+	types := make(map[dnsmessage.Type]bool)
+	for _, rr := range msg.Answers {
+		types[rr.Header.Type] = true
+		if srv, ok := rr.Body.(*dnsmessage.SRVResource); ok && srv.Port != 6419 {
+			t.Errorf("SRV port = %d, want 6419", srv.Port)
+		}
+	}
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypePTR, dnsmessage.TypeSRV, dnsmessage.TypeTXT, dnsmessage.TypeA} {
+		if !types[typ] {
+			t.Errorf("response is missing a %v record", typ)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// Package mdtext has helpers for line-based checks that scan markdown source
+// as text, such as the linter and the spell checker.
+package mdtext
+
+import "strings"
+
+// MaskCodeSpans replaces inline code spans with spaces, keeping byte offsets
+func MaskCodeSpans(text string) string {
+	b := []byte(text)
+	for i := 0; i < len(b); i++ {
+		if b[i] != '`' {
+			continue
+		}
+		j := i
+		for j < len(b) && b[j] == '`' {
+			j++
+		}
+		end := strings.Index(text[j:], text[i:j])
+		if end < 0 {
+			i = j - 1
+			continue
+		}
+		end += j + (j - i)
+		for k := i; k < end; k++ {
+			b[k] = ' '
+		}
+		i = end - 1
+	}
+	return string(b)
+}
@@ -0,0 +1,19 @@
+package mdtext
+
+import "testing"
+
+func TestMaskCodeSpans(t *testing.T) {
+	tests := map[string]string{
+		"no code":             "no code",
+		"a `b` c":             "a     c",
+		"a ``b ` c`` d":       "a           d",
+		"open ` only":         "open ` only",
+		"`x` and ``y``":       "    and      ",
+		"é `ü` https://x.org": "é      https://x.org", // Byte offsets, not characters
+	}
+	for text, want := range tests {
+		if got := MaskCodeSpans(text); got != want {
+			t.Errorf("MaskCodeSpans(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
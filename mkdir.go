@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// mkdirResponse is returned by /mkdir
+type mkdirResponse struct {
+	Path   string `json:"path"`   // New directory, relative to the browse directory
+	Parent string `json:"parent"` // Parent directory ("." for the root)
+	HTML   string `json:"html"`   // Updated children of the parent, as rendered in the sidebar
+}
+
+// handleMkdir creates a directory inside browseDir, starts watching it and
+// returns the parent's updated sidebar subtree
+func handleMkdir(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	relPath := filepath.Clean(strings.TrimPrefix(strings.TrimSpace(req.Path), "/"))
+	if relPath == "." {
+		writeError(w, errCodeBadRequest, "Missing directory path", http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsLocal(relPath) {
+		writeError(w, errCodePathOutsideRoot, "Path must be inside the browse directory", http.StatusForbidden)
+		return
+	}
+	for _, part := range strings.Split(relPath, string(filepath.Separator)) {
+		if tree.IsExcludedDir(part, getIgnorePatterns(resolveFilePath("."))) {
+			writeError(w, errCodeBadRequest, fmt.Sprintf("Directory %q is excluded from the file tree", part), http.StatusBadRequest)
+			return
+		}
+	}
+
+	absPath, err := createDirectory(relPath)
+	if err != nil {
+		statusCode, code := createErrorStatus(err)
+		writeError(w, code, fmt.Sprintf("Cannot create directory: %v", err), statusCode)
+		return
+	}
+
+	log.Printf("Created directory: %s", absPath)
+
+	parent := filepath.Dir(relPath)
+	writeJSON(w, http.StatusCreated, mkdirResponse{
+		Path:   filepath.ToSlash(relPath),
+		Parent: filepath.ToSlash(parent),
+		HTML:   tree.RenderSubtreeHTML(buildFileTree(), parent, messagesFor(r)),
+	})
+}
+
+// createDirectory makes a new directory (and missing parents), keeps it in the
+// tree while empty and adds it to the directory watcher
+func createDirectory(relPath string) (string, error) {
+	absPath := resolveFilePath(relPath)
+	if err := makeParentDirs(absPath); err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(absPath, 0755); err != nil {
+		return "", err
+	}
+
+	fileMutex.Lock()
+	createdDirs = append(createdDirs, absPath)
+	fileMutex.Unlock()
+
+	// Watch it right away so files written into it show up without waiting for
+	// the parent's create event
+	if !*noWatch {
+		if err := dirWatcher.AddDirectory(absPath); err != nil {
+			log.Printf("Warning: Cannot watch new directory %s: %v", absPath, err)
+		}
+	}
+	return absPath, nil
+}
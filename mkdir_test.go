@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleMkdir(t *testing.T) {
+	dir := serveTestFiles(t, "mkdir", nil)
+	prevDirs, prevNoWatch := createdDirs, *noWatch
+	createdDirs, *noWatch = nil, true
+	defer func() { createdDirs, *noWatch = prevDirs, prevNoWatch }()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"guides/setup", http.StatusCreated},
+		{"guides/setup", http.StatusConflict},
+		{"../outside", http.StatusForbidden},
+		{"docs/node_modules", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/mkdir", strings.NewReader(`{"path": "`+tt.path+`"}`))
+		rec := httptest.NewRecorder()
+		handleMkdir(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("mkdir %q: status = %d, want %d (%s)", tt.path, rec.Code, tt.want, rec.Body.String())
+		}
+		if tt.want != http.StatusCreated || rec.Code != tt.want {
+			continue
+		}
+
+		var resp mkdirResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Parent != "guides" || !strings.Contains(resp.HTML, `data-path="`+filepath.Join("guides", "setup")+`"`) {
+			t.Errorf("response = %+v, want guides subtree containing setup", resp)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, "guides", "setup")); err != nil || !info.IsDir() {
+		t.Error("directory was not created")
+	}
+}
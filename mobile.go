@@ -0,0 +1,44 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+)
+
+// layoutCookie remembers an explicit ?layout=mobile or ?layout=desktop choice
+const layoutCookie = "peekm_layout"
+
+// Layout names accepted by ?layout=
+const (
+	layoutMobile  = "mobile"
+	layoutDesktop = "desktop"
+)
+
+// mobileUserAgentPattern matches phone and tablet browsers
+var mobileUserAgentPattern = regexp.MustCompile(`(?i)mobile|android|iphone|ipad|ipod|blackberry|opera mini|iemobile`)
+
+// fileBrowserMobileTmpl is the file browser with the mobile layout blocks
+// (tree drawer, larger touch targets) filled in
+var fileBrowserMobileTmpl *template.Template
+
+// useMobileLayout reports whether a full page should use the mobile layout.
+// ?layout=mobile|desktop overrides detection and is remembered in a cookie;
+// otherwise the User-Agent decides.
+func useMobileLayout(w http.ResponseWriter, r *http.Request) bool {
+	if layout := r.URL.Query().Get("layout"); layout == layoutMobile || layout == layoutDesktop {
+		http.SetCookie(w, &http.Cookie{
+			Name:     layoutCookie,
+			Value:    layout,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return layout == layoutMobile
+	}
+	if c, err := r.Cookie(layoutCookie); err == nil && (c.Value == layoutMobile || c.Value == layoutDesktop) {
+		return c.Value == layoutMobile
+	}
+	return mobileUserAgentPattern.MatchString(r.UserAgent())
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	iPhoneUserAgent  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	desktopUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+// TestUseMobileLayout tests User-Agent detection and the ?layout= override cookie
+func TestUseMobileLayout(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		userAgent  string
+		cookie     string
+		want       bool
+		wantCookie string
+	}{
+		{name: "phone", url: "/", userAgent: iPhoneUserAgent, want: true},
+		{name: "desktop", url: "/", userAgent: desktopUserAgent, want: false},
+		{name: "android", url: "/", userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8)", want: true},
+		{name: "desktop override on phone", url: "/?layout=desktop", userAgent: iPhoneUserAgent, want: false, wantCookie: "desktop"},
+		{name: "mobile override on desktop", url: "/?layout=mobile", userAgent: desktopUserAgent, want: true, wantCookie: "mobile"},
+		{name: "remembered choice", url: "/", userAgent: iPhoneUserAgent, cookie: "desktop", want: false},
+		{name: "unknown layout ignored", url: "/?layout=tv", userAgent: desktopUserAgent, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: layoutCookie, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			if got := useMobileLayout(rec, r); got != tt.want {
+				t.Errorf("useMobileLayout() = %v, want %v", got, tt.want)
+			}
+			var gotCookie string
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == layoutCookie {
+					gotCookie = c.Value
+				}
+			}
+			if gotCookie != tt.wantCookie {
+				t.Errorf("layout cookie = %q, want %q", gotCookie, tt.wantCookie)
+			}
+		})
+	}
+}
+
+// TestServeFileMobileLayout tests that phones get the mobile template for full pages only
+func TestServeFileMobileLayout(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.md")
+	if err := os.WriteFile(path, []byte("# Notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prevDir, prevFiles, prevNoWatch := browseDir, markdownFiles, *noWatch
+	browseDir, markdownFiles, *noWatch = dir, newFileSet([]string{path}), true
+	defer func() { browseDir, markdownFiles, *noWatch = prevDir, prevFiles, prevNoWatch }()
+
+	tests := []struct {
+		name       string
+		userAgent  string
+		partial    bool
+		wantMobile bool
+	}{
+		{name: "phone", userAgent: iPhoneUserAgent, wantMobile: true},
+		{name: "desktop", userAgent: desktopUserAgent, wantMobile: false},
+		{name: "phone SPA navigation", userAgent: iPhoneUserAgent, partial: true, wantMobile: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/view/notes.md", nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+			if tt.partial {
+				r.Header.Set("X-Requested-With", "XMLHttpRequest")
+			}
+			rec := httptest.NewRecorder()
+			routes().ServeHTTP(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if got := strings.Contains(rec.Body.String(), `<body class="markdown-body mobile-layout">`); got != tt.wantMobile {
+				t.Errorf("mobile layout = %v, want %v", got, tt.wantMobile)
+			}
+		})
+	}
+}
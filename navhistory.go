@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// maxNavHistory bounds how many browsed directories are remembered
+const maxNavHistory = 50
+
+// navHistory is the list of directories this instance has browsed, like a
+// browser's history: /navigate adds to it (dropping what lies ahead), and
+// /navigate/back and /navigate/forward move through it
+type navHistory struct {
+	mu   sync.Mutex
+	dirs []string
+	pos  int // Index of the current directory in dirs
+}
+
+// globalNavHistory holds the directories browsed since startup
+var globalNavHistory navHistory
+
+// apiNavHistoryResponse is the /navigate/back and /navigate/forward response
+type apiNavHistoryResponse struct {
+	Path    string `json:"path"`    // Directory now browsed
+	Back    bool   `json:"back"`    // An earlier directory remains
+	Forward bool   `json:"forward"` // A later directory remains
+}
+
+// visit records dir as the current directory, dropping the forward history
+func (h *navHistory) visit(dir string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.dirs) > 0 && h.dirs[h.pos] == dir {
+		return
+	}
+	if len(h.dirs) > 0 {
+		h.dirs = h.dirs[:h.pos+1]
+	}
+	h.dirs = append(h.dirs, dir)
+	if len(h.dirs) > maxNavHistory {
+		h.dirs = h.dirs[len(h.dirs)-maxNavHistory:]
+	}
+	h.pos = len(h.dirs) - 1
+}
+
+// peek returns the directory delta steps from the current one
+func (h *navHistory) peek(delta int) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := h.pos + delta
+	if len(h.dirs) == 0 || i < 0 || i >= len(h.dirs) {
+		return "", false
+	}
+	return h.dirs[i], true
+}
+
+// move makes dir, delta steps from the current directory, the current one.
+// It does nothing if the history changed since peek returned dir.
+func (h *navHistory) move(delta int, dir string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := h.pos + delta; i >= 0 && i < len(h.dirs) && h.dirs[i] == dir {
+		h.pos = i
+	}
+}
+
+// drop removes an unusable directory, delta steps from the current one
+func (h *navHistory) drop(delta int, dir string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := h.pos + delta
+	if i < 0 || i >= len(h.dirs) || h.dirs[i] != dir {
+		return
+	}
+	h.dirs = append(h.dirs[:i], h.dirs[i+1:]...)
+	if i < h.pos {
+		h.pos--
+	}
+}
+
+// state reports the current directory and whether there are directories
+// before and after it
+func (h *navHistory) state() apiNavHistoryResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.dirs) == 0 {
+		return apiNavHistoryResponse{}
+	}
+	return apiNavHistoryResponse{Path: h.dirs[h.pos], Back: h.pos > 0, Forward: h.pos < len(h.dirs)-1}
+}
+
+// handleNavigateBack browses the directory before the current one again
+func handleNavigateBack(w http.ResponseWriter, r *http.Request) {
+	stepNavigation(w, r, -1)
+}
+
+// handleNavigateForward browses the directory after the current one again
+func handleNavigateForward(w http.ResponseWriter, r *http.Request) {
+	stepNavigation(w, r, 1)
+}
+
+// stepNavigation switches to the directory delta steps away in the history,
+// collecting its files and restarting its watcher as /navigate does. A
+// directory that was deleted or emptied since is dropped from the history.
+func stepNavigation(w http.ResponseWriter, r *http.Request, delta int) {
+	dir, ok := globalNavHistory.peek(delta)
+	if !ok {
+		writeError(w, errCodeConflict, "No directory to go to in the navigation history", http.StatusConflict)
+		return
+	}
+	validated, err := safepath.Resolve(dir)
+	if err == nil {
+		if info, statErr := os.Stat(validated); statErr != nil || !info.IsDir() {
+			err = errors.New("not a directory")
+		}
+	}
+	if err == nil {
+		err = switchBrowseDir(validated)
+	}
+	if err != nil {
+		globalNavHistory.drop(delta, dir)
+		writeError(w, errCodeNotFound, "Cannot browse "+dir+" again: "+err.Error(), http.StatusGone)
+		return
+	}
+	globalNavHistory.move(delta, dir)
+
+	if isNoScriptRequest(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusOK, globalNavHistory.state())
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestNavHistory(t *testing.T) {
+	var h navHistory
+	if _, ok := h.peek(-1); ok {
+		t.Error("empty history has a previous directory")
+	}
+
+	h.visit("/a")
+	h.visit("/b")
+	h.visit("/b") // Reloading the current directory adds nothing
+	h.visit("/c")
+	if got := h.state(); got != (apiNavHistoryResponse{Path: "/c", Back: true}) {
+		t.Errorf("state = %+v", got)
+	}
+
+	dir, ok := h.peek(-1)
+	h.move(-1, dir)
+	dir, _ = h.peek(-1)
+	h.move(-1, dir)
+	if got := h.state(); got != (apiNavHistoryResponse{Path: "/a", Forward: true}) {
+		t.Errorf("after two steps back: state = %+v (peek %q, %v)", got, dir, ok)
+	}
+
+	// Visiting from the middle drops the directories ahead
+	h.visit("/d")
+	if !reflect.DeepEqual(h.dirs, []string{"/a", "/d"}) || h.pos != 1 {
+		t.Errorf("dirs = %v at %d, want [/a /d] at 1", h.dirs, h.pos)
+	}
+
+	// A stale move (the history changed since peek) is ignored
+	h.move(-1, "/b")
+	if h.pos != 1 {
+		t.Errorf("stale move changed the position to %d", h.pos)
+	}
+
+	h.drop(-1, "/a")
+	if got := h.state(); got != (apiNavHistoryResponse{Path: "/d"}) {
+		t.Errorf("after drop: state = %+v", got)
+	}
+
+	for i := 0; i < maxNavHistory+10; i++ {
+		h.visit("/dir" + strconv.Itoa(i))
+	}
+	if len(h.dirs) != maxNavHistory || h.dirs[h.pos] != "/dir"+strconv.Itoa(maxNavHistory+9) {
+		t.Errorf("history of %d entries at %q, want %d ending with the last visit", len(h.dirs), h.dirs[h.pos], maxNavHistory)
+	}
+}
+
+// newNavHistoryTestDirs creates two directories with a README.md under $HOME
+func newNavHistoryTestDirs(t *testing.T) (string, string) {
+	t.Helper()
+	root := serveTestFiles(t, "navhistory", map[string]string{
+		"first/README.md":  "# first",
+		"second/README.md": "# second",
+	})
+	return filepath.Join(root, "first"), filepath.Join(root, "second")
+}
+
+func TestStepNavigation(t *testing.T) {
+	first, second := newNavHistoryTestDirs(t)
+
+	prevNoWatch, prevNoIndex := *noWatch, *noIndex
+	prevHistory := globalNavHistory.dirs
+	defer func() {
+		*noWatch, *noIndex = prevNoWatch, prevNoIndex
+		globalNavHistory.dirs, globalNavHistory.pos = prevHistory, len(prevHistory)-1
+		cacheDirSettings(nil, nil)
+	}()
+	*noWatch, *noIndex = true, true
+	browseDir, markdownFiles = second, newFileSet([]string{filepath.Join(second, "README.md")})
+	globalNavHistory.dirs, globalNavHistory.pos = []string{first, second}, 1
+
+	step := func(handler http.HandlerFunc, path string) int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("POST", path, nil))
+		return rec.Code
+	}
+
+	if code := step(handleNavigateBack, "/navigate/back"); code != http.StatusOK || browseDir != first {
+		t.Fatalf("back: status %d, browsing %s; want 200, %s", code, browseDir, first)
+	}
+	if !isWhitelistedFile(filepath.Join(first, "README.md")) || isWhitelistedFile(filepath.Join(second, "README.md")) {
+		t.Errorf("whitelist = %v, want the first directory's files", whitelistedFiles())
+	}
+	if code := step(handleNavigateBack, "/navigate/back"); code != http.StatusConflict {
+		t.Errorf("back at the start: status %d, want 409", code)
+	}
+
+	// A directory deleted since is dropped from the history
+	if err := os.RemoveAll(second); err != nil {
+		t.Fatal(err)
+	}
+	if code := step(handleNavigateForward, "/navigate/forward"); code != http.StatusGone || browseDir != first {
+		t.Errorf("forward to a deleted directory: status %d, browsing %s; want 410, %s", code, browseDir, first)
+	}
+	if got := globalNavHistory.state(); got != (apiNavHistoryResponse{Path: first}) {
+		t.Errorf("history after the failed step = %+v", got)
+	}
+	if code := step(handleNavigateForward, "/navigate/forward"); code != http.StatusConflict {
+		t.Errorf("forward at the end: status %d, want 409", code)
+	}
+}
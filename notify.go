@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// notifyAgentFileCreated shows a desktop notification for a file created by an AI session (--notify)
+func notifyAgentFileCreated(filePath, sessionID string) {
+	if !*notify {
+		return
+	}
+	desktopNotification("peekm: new file", fmt.Sprintf("%s (session %s)", getRelativePath(filePath), shortSessionID(sessionID)))
+}
+
+// notifySessionFinished shows a desktop notification when an AI session stops (--notify)
+func notifySessionFinished(req hookRequest) {
+	if !*notify {
+		return
+	}
+	message := fmt.Sprintf("Session %s finished", shortSessionID(req.SessionID))
+	if n := len(globalSessionStore.touchedFiles(req.SessionID, time.Time{})); n > 0 {
+		message += fmt.Sprintf(" (%d file(s) modified)", n)
+	}
+	desktopNotification("peekm: "+req.Source, message)
+}
+
+// desktopNotification shows a native notification without blocking; failures are only logged
+func desktopNotification(title, message string) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin": // macOS
+		// Escape backslashes and double quotes to prevent AppleScript injection
+		escape := func(s string) string {
+			s = strings.ReplaceAll(s, `\`, `\\`)
+			return strings.ReplaceAll(s, `"`, `\"`)
+		}
+		script := fmt.Sprintf(`display notification "%s" with title "%s"`, escape(message), escape(title))
+		cmd = exec.Command("osascript", "-e", script)
+
+	case "linux":
+		// notify-send takes title and message as arguments, safe from injection
+		cmd = exec.Command("notify-send", "--app-name=peekm", title, message)
+
+	case "windows":
+		// Escape single quotes for PowerShell single-quoted strings
+		escape := func(s string) string { return strings.ReplaceAll(s, `'`, `''`) }
+		script := fmt.Sprintf(`[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode('%s')) | Out-Null
+$text.Item(1).AppendChild($xml.CreateTextNode('%s')) | Out-Null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('peekm').Show([Windows.UI.Notifications.ToastNotification]::new($xml))`, escape(title), escape(message))
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+
+	default:
+		log.Printf("Warning: Desktop notifications not supported on %s", runtime.GOOS)
+		return
+	}
+
+	go func() {
+		if err := cmd.Run(); err != nil {
+			log.Printf("Warning: Failed to show desktop notification: %v", err)
+		}
+	}()
+}
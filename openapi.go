@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// apiParam is a query parameter of a JSON API operation
+type apiParam struct {
+	Name        string
+	Description string
+	Required    bool
+	Type        string // JSON Schema type, "string" when empty
+}
+
+// apiOperation is one method of a JSON API route, as /api/schema describes it
+type apiOperation struct {
+	Method   string
+	Path     string
+	Summary  string
+	Params   []apiParam
+	Request  any // Zero value of the JSON request body, nil for none
+	Response any // Zero value of the JSON response, nil for an empty one
+	Status   int // Success status, 200 when zero
+}
+
+// apiOneOf is a response that is one of several types
+type apiOneOf []any
+
+// Query parameters shared by several operations
+var (
+	filePathParam = apiParam{Name: "path", Description: "Markdown file relative to the browsed directory", Required: true}
+	limitParam    = apiParam{Name: "limit", Description: "Items per page (see next_cursor)", Type: "integer"}
+	cursorParam   = apiParam{Name: "cursor", Description: "next_cursor of the previous page"}
+)
+
+// apiOperations lists the JSON API for /api/schema. Request and response
+// schemas are generated from the Go types the handlers use, so only the
+// routes, parameters and types are kept here.
+var apiOperations = []apiOperation{
+	{Method: http.MethodGet, Path: "/api/tree", Summary: "Nested file tree; with limit or cursor, one page of it as {tree, next_cursor}", Params: []apiParam{
+		{Name: "session", Description: "Only files modified by this AI session"},
+		{Name: "since", Description: "Only files modified since a duration ago (2h) or an RFC 3339 time"},
+		{Name: "filter", Description: "Only files whose relative paths match every word, as a substring or fuzzily"},
+		limitParam, cursorParam,
+	}, Response: apiOneOf{&tree.Node{}, apiTreePage{}}},
+	{Method: http.MethodGet, Path: "/api/dirs", Summary: "Directories holding markdown next to and below a directory", Params: []apiParam{
+		{Name: "path", Description: "Directory, the browsed one by default"},
+	}, Response: apiDirsResponse{}},
+	{Method: http.MethodGet, Path: "/api/browse-dirs", Summary: "Child directories of a directory with their markdown counts", Params: []apiParam{
+		{Name: "path", Description: "Directory, the browsed one by default"},
+	}, Response: apiBrowseDirsResponse{}},
+	{Method: http.MethodGet, Path: "/api/recent-dirs", Summary: "Recently browsed directories, most recent first", Params: []apiParam{limitParam, cursorParam}, Response: apiRecentDirsResponse{}},
+	{Method: http.MethodGet, Path: "/api/file", Summary: "Raw markdown, rendered HTML and metadata of a file", Params: []apiParam{filePathParam}, Response: apiFileResponse{}},
+	{Method: http.MethodGet, Path: "/api/export-fragment", Summary: "A file rendered with inline styles for pasting elsewhere", Params: []apiParam{filePathParam}, Response: apiExportFragmentResponse{}},
+	{Method: http.MethodPost, Path: "/api/render", Summary: "Render markdown to HTML", Request: apiMarkdownRequest{}, Response: apiHTMLResponse{}},
+	{Method: http.MethodPost, Path: "/api/preview", Summary: "Render unsaved markdown as it will look once saved", Request: apiMarkdownRequest{}, Response: apiHTMLResponse{}},
+	{Method: http.MethodGet, Path: "/api/connect-info", Summary: "Local and LAN URLs", Response: connectInfoResponse{}},
+	{Method: http.MethodGet, Path: "/api/clients", Summary: "Open live-update connections, oldest first", Response: apiClientsResponse{}},
+	{Method: http.MethodPost, Path: "/api/share", Summary: "Mint a read-only link to one rendered document", Request: apiShareRequest{}, Response: apiShareResponse{}},
+	{Method: http.MethodGet, Path: "/api/comments", Summary: "Review comments on a file, oldest first", Params: []apiParam{filePathParam}, Response: apiCommentsResponse{}},
+	{Method: http.MethodPost, Path: "/api/comments", Summary: "Add a comment", Request: apiCommentRequest{}, Response: apiComment{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/api/comments", Summary: "Replace the text of a comment", Request: apiCommentRequest{}, Response: apiComment{}},
+	{Method: http.MethodDelete, Path: "/api/comments", Summary: "Delete a comment", Params: []apiParam{filePathParam, {Name: "id", Description: "Comment ID", Required: true}}, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/position", Summary: "Where a file was last read (404 if nothing is saved)", Params: []apiParam{filePathParam}, Response: apiPosition{}},
+	{Method: http.MethodPost, Path: "/api/position", Summary: "Save where a file was read", Request: apiPositionRequest{}, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/bookmarks", Summary: "Bookmarks on served files, oldest first", Response: apiBookmarksResponse{}},
+	{Method: http.MethodPost, Path: "/api/bookmarks", Summary: "Add a bookmark", Request: apiBookmarkRequest{}, Response: apiBookmark{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/api/bookmarks", Summary: "Rename a bookmark", Request: apiBookmarkRequest{}, Response: apiBookmark{}},
+	{Method: http.MethodDelete, Path: "/api/bookmarks", Summary: "Delete a bookmark", Params: []apiParam{{Name: "id", Description: "Bookmark ID", Required: true}}, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/session", Summary: "Hook events recorded for an AI session, oldest first", Params: []apiParam{
+		{Name: "id", Description: "Session ID", Required: true}, limitParam, cursorParam,
+	}, Response: apiSessionResponse{}},
+	{Method: http.MethodGet, Path: "/api/session-diff", Summary: "Line diff of what the last AI session changed in a file", Params: []apiParam{filePathParam}, Response: apiSessionDiffResponse{}},
+	{Method: http.MethodGet, Path: "/api/session-stats", Summary: "Size of the AI session store and what its limits forgot", Response: sessionStoreStats{}},
+	{Method: http.MethodPost, Path: "/api/review", Summary: "Accept or revert a hunk of an AI session's changes", Request: apiReviewRequest{}, Response: apiReviewResponse{}},
+	{Method: http.MethodGet, Path: "/api/follow", Summary: "Whether follow mode is on", Response: apiFollowState{}},
+	{Method: http.MethodPost, Path: "/api/follow", Summary: "Turn follow mode on or off", Request: apiFollowState{}, Response: apiFollowState{}},
+	{Method: http.MethodGet, Path: "/api/templates", Summary: "Available new-file templates", Response: []pageTemplate{}},
+	{Method: http.MethodGet, Path: "/api/lint", Summary: "Lint diagnostics of a file", Params: []apiParam{
+		filePathParam, {Name: "max_line_length", Description: "Longest line allowed (default 80)", Type: "integer"},
+	}, Response: apiLintResponse{}},
+	{Method: http.MethodGet, Path: "/api/resolve-anchor", Summary: "Map an anchor or heading text to the exact heading anchor", Params: []apiParam{
+		filePathParam, {Name: "q", Description: "Anchor or heading text", Required: true},
+	}, Response: apiResolveAnchorResponse{}},
+	{Method: http.MethodGet, Path: "/api/find", Summary: "Case-insensitive matches in a document's text", Params: []apiParam{
+		filePathParam, {Name: "q", Description: "Text to find", Required: true},
+	}, Response: apiFindResponse{}},
+	{Method: http.MethodGet, Path: "/api/symbols", Summary: "Headings, link and footnote definitions and code fences of a file, with language server ranges", Params: []apiParam{filePathParam}, Response: apiSymbolsResponse{}},
+	{Method: http.MethodGet, Path: "/api/file-chunk", Summary: "The next rendered part of a file above -max-render-kb", Params: []apiParam{
+		filePathParam, {Name: "from", Description: "Byte offset to render from", Required: true, Type: "integer"},
+	}, Response: apiFileChunkResponse{}},
+	{Method: http.MethodGet, Path: "/api/search", Summary: "Files whose contents match, best first", Params: []apiParam{
+		{Name: "q", Description: "Search terms, or a pattern with regex, word or case", Required: true},
+		{Name: "limit", Description: "Results per page (default 20, at most 100)", Type: "integer"}, cursorParam,
+		{Name: "dir", Description: "Directory to search in, relative to the browsed one"},
+		{Name: "regex", Description: "1 to match an RE2 regular expression line by line"},
+		{Name: "word", Description: "1 to match whole words line by line"},
+		{Name: "case", Description: "1 to match case-sensitively line by line"},
+	}, Response: apiSearchResponse{}},
+	{Method: http.MethodGet, Path: "/api/resync", Summary: "The complete file list and the last live-update event it reflects", Response: apiResyncResponse{}},
+	{Method: http.MethodPost, Path: "/api/replace", Summary: "Preview or apply a search and replace across files", Request: replaceRequest{}, Response: replaceResponse{}},
+	{Method: http.MethodPost, Path: "/api/replace/undo", Summary: "Restore the files of an applied replacement", Request: replaceUndoRequest{}, Response: replaceUndoResponse{}},
+	{Method: http.MethodGet, Path: "/api/spellcheck", Summary: "Misspelled words of a file", Params: []apiParam{filePathParam}, Response: apiSpellcheckResponse{}},
+	{Method: http.MethodPost, Path: "/api/spellcheck", Summary: "Add a word to the project dictionary", Request: apiDictionaryWord{}, Response: apiDictionaryWord{}},
+	{Method: http.MethodGet, Path: "/api/frontmatter", Summary: "YAML front matter of a file", Params: []apiParam{filePathParam}, Response: apiFrontMatterResponse{}},
+	{Method: http.MethodPut, Path: "/api/frontmatter", Summary: "Replace the front matter of a file, leaving its body as is", Params: []apiParam{filePathParam}, Request: apiFrontMatterRequest{}, Response: apiFrontMatterResponse{}},
+	{Method: http.MethodGet, Path: "/api/presence", Summary: "Connected browsers and the file each shows", Response: apiPresenceResponse{}},
+	{Method: http.MethodPost, Path: "/api/presence", Summary: "Set this browser's name, presenting or scroll sync", Request: apiPresenceRequest{}, Response: apiPresenceResponse{}},
+	{Method: http.MethodPost, Path: "/api/presence/scroll", Summary: "Pass a presenter's scroll position on to followers", Request: presenterScroll{}, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/api/tabs", Summary: "Files open in this browser and the active one", Response: apiTabsResponse{}},
+	{Method: http.MethodPost, Path: "/api/tabs", Summary: "Open a file as the active tab", Request: apiTabRequest{}, Response: apiTabsResponse{}},
+	{Method: http.MethodDelete, Path: "/api/tabs", Summary: "Close a tab", Params: []apiParam{filePathParam}, Response: apiTabsResponse{}},
+	{Method: http.MethodGet, Path: "/api/tree-state", Summary: "Sidebar directories this browser left expanded", Response: apiTreeState{}},
+	{Method: http.MethodPut, Path: "/api/tree-state", Summary: "Replace the expanded sidebar directories", Request: apiTreeState{}, Response: apiTreeState{}},
+	{Method: http.MethodGet, Path: "/api/version", Summary: "peekm's version and the /rpc protocol and methods it supports", Response: apiVersionResponse{}},
+	{Method: http.MethodGet, Path: "/api/schema", Summary: "This OpenAPI document", Response: map[string]any{}},
+}
+
+// jsonShapes maps types with a custom MarshalJSON to the type they marshal as
+var jsonShapes = map[reflect.Type]reflect.Type{
+	reflect.TypeFor[tree.Node](): reflect.TypeFor[tree.NodeJSON](),
+}
+
+// apiSchema is the OpenAPI document served at /api/schema, built by
+// registerRoutes
+var apiSchema map[string]any
+
+// serveAPISchema returns the OpenAPI document of the JSON API
+func serveAPISchema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, apiSchema)
+}
+
+// buildAPISchema generates the OpenAPI 3.0 document of operations, with a
+// component schema for each named Go type they send or receive
+func buildAPISchema(operations []apiOperation) map[string]any {
+	b := &schemaBuilder{components: map[string]any{}}
+	paths := map[string]any{}
+	for _, op := range operations {
+		item, _ := paths[op.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = b.operation(op)
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "peekm",
+			"version":     version,
+			"description": "JSON API of a running peekm. Errors are JSON objects with a stable error code. Clients on another device need the access token (the ?token= of the LAN URL) in X-Peekm-Token.",
+		},
+		"servers": []any{map[string]any{"url": fmt.Sprintf("http://localhost:%d", *port)}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": b.components,
+			"securitySchemes": map[string]any{
+				"accessToken": map[string]any{"type": "apiKey", "in": "header", "name": "X-Peekm-Token"},
+			},
+		},
+		"security": []any{map[string]any{}, map[string]any{"accessToken": []string{}}},
+	}
+}
+
+// schemaBuilder turns Go types into JSON schemas, collecting named structs as
+// components
+type schemaBuilder struct {
+	components map[string]any
+}
+
+// operation describes one apiOperation
+func (b *schemaBuilder) operation(op apiOperation) map[string]any {
+	out := map[string]any{"operationId": operationID(op.Method, op.Path), "summary": op.Summary}
+	if len(op.Params) > 0 {
+		params := make([]any, 0, len(op.Params))
+		for _, p := range op.Params {
+			typ := p.Type
+			if typ == "" {
+				typ = "string"
+			}
+			params = append(params, map[string]any{
+				"name": p.Name, "in": "query", "description": p.Description, "required": p.Required,
+				"schema": map[string]any{"type": typ},
+			})
+		}
+		out["parameters"] = params
+	}
+	if op.Request != nil {
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(op.Request))}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if op.Response != nil {
+		success["content"] = map[string]any{"application/json": map[string]any{"schema": b.valueSchema(op.Response)}}
+	}
+	out["responses"] = map[string]any{
+		strconv.Itoa(status): success,
+		"default": map[string]any{
+			"description": "Error",
+			"content":     map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(apiErrorResponse{}))}},
+		},
+	}
+	return out
+}
+
+// operationID names an operation after its method and path, e.g.
+// getRecentDirs for GET /api/recent-dirs
+func operationID(method, route string) string {
+	id := strings.ToLower(method)
+	capitalize := true
+	for _, r := range strings.TrimPrefix(route, "/api/") {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			capitalize = true
+			continue
+		}
+		if capitalize {
+			r, capitalize = unicode.ToUpper(r), false
+		}
+		id += string(r)
+	}
+	return id
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	mainPkgPath       = reflect.TypeFor[apiOperation]().PkgPath() // "main", or the module path in tests
+)
+
+// valueSchema returns the schema of a response value
+func (b *schemaBuilder) valueSchema(v any) map[string]any {
+	alternatives, ok := v.(apiOneOf)
+	if !ok {
+		return b.schema(reflect.TypeOf(v))
+	}
+	schemas := make([]any, 0, len(alternatives))
+	for _, alternative := range alternatives {
+		schemas = append(schemas, b.schema(reflect.TypeOf(alternative)))
+	}
+	return map[string]any{"oneOf": schemas}
+}
+
+// schema returns the JSON schema of values of t as encoding/json writes them
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case jsonShapes[t] != nil:
+		return b.component(t)
+	case t.Kind() != reflect.Pointer && (t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(b.schema(t.Elem()))
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return b.component(t)
+	}
+	return scalarSchema(t.Kind())
+}
+
+// scalarSchema returns the JSON schema of a number, string or bool kind
+func scalarSchema(kind reflect.Kind) map[string]any {
+	switch kind {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	}
+	return map[string]any{} // Any JSON value
+}
+
+// nullable marks a schema as also allowing null
+func nullable(schema map[string]any) map[string]any {
+	if _, ok := schema["$ref"]; ok {
+		return map[string]any{"allOf": []any{schema}, "nullable": true}
+	}
+	schema["nullable"] = true
+	return schema
+}
+
+// component returns a reference to the component schema of the named struct
+// t, adding it on first use
+func (b *schemaBuilder) component(t reflect.Type) map[string]any {
+	name := t.Name()
+	if pkg := t.PkgPath(); pkg != mainPkgPath {
+		name = path.Base(pkg) + "." + name
+	}
+	ref := map[string]any{"$ref": "#/components/schemas/" + name}
+	if _, ok := b.components[name]; ok {
+		return ref
+	}
+	b.components[name] = nil // Placeholder for types that contain themselves
+	if shape := jsonShapes[t]; shape != nil {
+		t = shape
+	}
+	b.components[name] = b.object(t)
+	return ref
+}
+
+// object returns the schema of the struct t: its exported fields under their
+// JSON names, with the fields of embedded structs inlined
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	b.addFields(t, properties, &required)
+	out := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// addFields adds the JSON fields of the struct t to properties, and those
+// always sent to required
+func (b *schemaBuilder) addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+		if !strings.Contains(options, "omitempty") && !strings.Contains(options, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
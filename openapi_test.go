@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeAPISchema(t *testing.T) {
+	prev := apiSchema
+	t.Cleanup(func() { apiSchema = prev })
+	apiSchema = buildAPISchema(apiOperations)
+
+	w := httptest.NewRecorder()
+	serveAPISchema(w, httptest.NewRequest(http.MethodGet, "/api/schema", nil))
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("openapi = %q", doc.OpenAPI)
+	}
+	for _, op := range apiOperations {
+		if doc.Paths[op.Path][strings.ToLower(op.Method)] == nil {
+			t.Errorf("%s %s missing from the document", op.Method, op.Path)
+		}
+	}
+
+	// Every reference resolves to a component
+	for _, ref := range strings.Split(w.Body.String(), `"$ref":"#/components/schemas/`)[1:] {
+		name, _, _ := strings.Cut(ref, `"`)
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("unresolved reference to %s", name)
+		}
+	}
+
+	node := doc.Components.Schemas["tree.Node"]
+	if node.Properties["mtime"]["format"] != "date-time" || node.Properties["children"]["type"] != "array" {
+		t.Errorf("tree.Node properties = %v", node.Properties)
+	}
+	if comment := doc.Components.Schemas["apiComment"]; comment.Properties["text"] == nil || comment.Properties["section"] == nil {
+		t.Errorf("apiComment misses the fields of its embedded comment: %v", comment.Properties)
+	}
+	if page := doc.Components.Schemas["apiRecentDirsResponse"]; strings.Join(page.Required, ",") != "dirs" {
+		t.Errorf("apiRecentDirsResponse required = %q, want only dirs (next_cursor is omitted on the last page)", page.Required)
+	}
+
+	params, _ := json.Marshal(doc.Paths["/api/recent-dirs"]["get"]["parameters"])
+	if !strings.Contains(string(params), `"name":"cursor"`) || !strings.Contains(string(params), `"name":"limit"`) {
+		t.Errorf("/api/recent-dirs parameters = %s", params)
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodGet, "/api/recent-dirs", "getRecentDirs"},
+		{http.MethodPost, "/api/replace/undo", "postReplaceUndo"},
+		{http.MethodDelete, "/api/tabs", "deleteTabs"},
+	}
+	for _, tt := range tests {
+		if got := operationID(tt.method, tt.path); got != tt.want {
+			t.Errorf("operationID(%s, %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
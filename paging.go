@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of the paginated listings (/api/tree, /api/recent-dirs and
+// /api/session events): ?limit= is capped at maxPageSize, and ?cursor=
+// without ?limit= gets defaultPageSize items. Without either, a listing is
+// sent whole.
+const (
+	defaultPageSize = 500
+	maxPageSize     = 5000
+)
+
+// pageRequest is the ?limit= and ?cursor= of a paginated listing
+type pageRequest struct {
+	limit int    // Items per page, 0 for the whole listing
+	after string // Sort key of the last item of the previous page, "" for the first page
+}
+
+// parsePageRequest reads ?limit= and ?cursor=
+func parsePageRequest(r *http.Request) (pageRequest, error) {
+	q := r.URL.Query()
+	var page pageRequest
+	if value := q.Get("cursor"); value != "" {
+		after, err := decodeCursor(value)
+		if err != nil {
+			return page, err
+		}
+		page.after, page.limit = after, defaultPageSize
+	}
+	if value := q.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return page, errors.New("invalid limit")
+		}
+		page.limit = min(n, maxPageSize)
+	}
+	return page, nil
+}
+
+// encodeCursor turns the sort key of a page's last item into the opaque
+// next_cursor clients send back as ?cursor=
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeCursor returns the sort key in a ?cursor=
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", errors.New("invalid cursor")
+	}
+	return string(key), nil
+}
+
+// paginate returns the page of items following page.after and the cursor of
+// the next page ("" after the last one). items are in their listing's stable
+// order, in which atOrBefore reports whether an item sorts at or before a
+// sort key, and keyOf returns an item's sort key. Keys rather than offsets
+// keep pages from skipping or repeating items when others come and go.
+func paginate[T any](items []T, page pageRequest, atOrBefore func(item T, key string) bool, keyOf func(item T) string) ([]T, string) {
+	if page.limit == 0 {
+		return items, ""
+	}
+	start := 0
+	if page.after != "" {
+		start = sort.Search(len(items), func(i int) bool { return !atOrBefore(items[i], page.after) })
+	}
+	end := min(start+page.limit, len(items))
+	if end == len(items) {
+		return items[start:end], ""
+	}
+	return items[start:end], encodeCursor(keyOf(items[end-1]))
+}
+
+// timeKey is the sort key of an item ordered by t and then by name
+func timeKey(t time.Time, name string) string {
+	return t.UTC().Format(time.RFC3339Nano) + "\x00" + name
+}
+
+// parseTimeKey splits a timeKey; invalid times read as the zero time
+func parseTimeKey(key string) (time.Time, string) {
+	value, name, _ := strings.Cut(key, "\x00")
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t, name
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/razvandimescu/peekm/search"
+)
+
+func TestPaginate(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	atOrBefore := func(item, key string) bool { return item <= key }
+	keyOf := func(item string) string { return item }
+
+	tests := []struct {
+		name     string
+		page     pageRequest
+		want     []string
+		wantNext string
+	}{
+		{"whole listing", pageRequest{}, items, ""},
+		{"first page", pageRequest{limit: 2}, []string{"a", "b"}, "b"},
+		{"after a cursor", pageRequest{limit: 2, after: "b"}, []string{"c", "d"}, "d"},
+		{"cursor item gone", pageRequest{limit: 2, after: "bb"}, []string{"c", "d"}, "d"},
+		{"last page", pageRequest{limit: 2, after: "d"}, []string{"e"}, ""},
+		{"past the end", pageRequest{limit: 2, after: "z"}, []string{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next := paginate(items, tt.page, atOrBefore, keyOf)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("page = %q, want %q", got, tt.want)
+			}
+			if tt.wantNext == "" && next != "" || tt.wantNext != "" && next != encodeCursor(tt.wantNext) {
+				t.Errorf("next cursor = %q, want the cursor of %q", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestParsePageRequest(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    pageRequest
+		wantErr bool
+	}{
+		{"", pageRequest{}, false},
+		{"limit=10", pageRequest{limit: 10}, false},
+		{"limit=1000000", pageRequest{limit: maxPageSize}, false},
+		{"cursor=" + encodeCursor("docs/a.md"), pageRequest{limit: defaultPageSize, after: "docs/a.md"}, false},
+		{"limit=0", pageRequest{}, true},
+		{"cursor=%21%21", pageRequest{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePageRequest(httptest.NewRequest("GET", "/api/tree?"+tt.query, nil))
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("parsePageRequest(%q) = %+v, %v; want %+v (error %v)", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// treeFilePaths returns the paths of the files in a JSON tree
+func treeFilePaths(node struct {
+	Path     string
+	IsDir    bool `json:"is_dir"`
+	Children json.RawMessage
+}) []string {
+	if !node.IsDir {
+		return []string{node.Path}
+	}
+	var children []struct {
+		Path     string
+		IsDir    bool `json:"is_dir"`
+		Children json.RawMessage
+	}
+	json.Unmarshal(node.Children, &children)
+	var paths []string
+	for _, child := range children {
+		paths = append(paths, treeFilePaths(child)...)
+	}
+	return paths
+}
+
+func TestServeAPITreePages(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.md", "b/c.md", "b/d.md", "b/e/f.md", "g.md"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("# "+name+"\n"), 0644)
+		files = append(files, path)
+	}
+	prevDir, prevFiles := browseDir, markdownFiles
+	t.Cleanup(func() { browseDir, markdownFiles = prevDir, prevFiles })
+	browseDir, markdownFiles = dir, newFileSet(files)
+
+	var got []string
+	for query, pages := "limit=2", 0; ; pages++ {
+		if pages == 5 {
+			t.Fatal("pages never end")
+		}
+		rec := httptest.NewRecorder()
+		serveAPITree(rec, httptest.NewRequest("GET", "/api/tree?"+query, nil))
+		var page struct {
+			Tree struct {
+				Path     string
+				IsDir    bool `json:"is_dir"`
+				Children json.RawMessage
+			}
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("%s: status %d, invalid JSON: %s", query, rec.Code, rec.Body.String())
+		}
+		paths := treeFilePaths(page.Tree)
+		if len(paths) > 2 {
+			t.Errorf("%s: %d files, want at most 2", query, len(paths))
+		}
+		got = append(got, paths...)
+		if page.NextCursor == "" {
+			break
+		}
+		query = "limit=2&cursor=" + url.QueryEscape(page.NextCursor)
+	}
+	slices.Sort(got) // Each page's tree lists directories first
+	if want := []string{"a.md", "b/c.md", "b/d.md", "b/e/f.md", "g.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files over all pages = %q, want %q", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	serveAPITree(rec, httptest.NewRequest("GET", "/api/tree?cursor=%21", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid cursor: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestServeAPISearchPages(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.md", "b.md", "c.md"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("# Notes\n\nRelease notes.\n"), 0644)
+		files = append(files, path)
+	}
+	prevDir, prevFiles, prevIndex := browseDir, markdownFiles, textIndex
+	t.Cleanup(func() { browseDir, markdownFiles, textIndex = prevDir, prevFiles, prevIndex })
+	browseDir, markdownFiles = dir, newFileSet(files)
+	textIndex = &fullTextIndex{index: search.New()}
+	reconcileSearchIndex(textIndex.index, markdownFiles.list())
+
+	for _, query := range []string{"q=release", "q=release&word=1"} {
+		var got []string
+		for cursor, pages := "", 0; pages < 4; pages++ {
+			rec := httptest.NewRecorder()
+			serveAPISearch(rec, httptest.NewRequest("GET", "/api/search?limit=2&"+query+cursor, nil))
+			var resp apiSearchResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s: status %d, invalid JSON: %s", query, rec.Code, rec.Body.String())
+			}
+			for _, result := range resp.Results {
+				got = append(got, result.Path)
+			}
+			if resp.NextCursor == "" {
+				break
+			}
+			cursor = "&cursor=" + url.QueryEscape(resp.NextCursor)
+		}
+		if want := []string{"a.md", "b.md", "c.md"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: results over all pages = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestServeAPISessionPages(t *testing.T) {
+	prev := globalSessionStore
+	t.Cleanup(func() { globalSessionStore = prev })
+	globalSessionStore = newSessionStore()
+	start := time.Now()
+	for i, tool := range []string{"Read", "Edit", "Write"} {
+		globalSessionStore.recordEvent("s1", sessionEvent{Type: hookPreToolUse, ToolName: tool, Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	rec := httptest.NewRecorder()
+	serveAPISession(rec, httptest.NewRequest("GET", "/api/session?id=s1&limit=2", nil))
+	var first apiSessionResponse
+	json.Unmarshal(rec.Body.Bytes(), &first)
+	if len(first.Events) != 2 || first.Events[0].ToolName != "Read" || first.NextCursor == "" {
+		t.Fatalf("first page = %+v, want the 2 oldest events and a cursor", first)
+	}
+
+	globalSessionStore.recordEvent("s1", sessionEvent{Type: hookPreToolUse, ToolName: "Bash", Timestamp: start.Add(3 * time.Second)})
+	rec = httptest.NewRecorder()
+	serveAPISession(rec, httptest.NewRequest("GET", "/api/session?id=s1&limit=2&cursor="+url.QueryEscape(first.NextCursor), nil))
+	var second apiSessionResponse
+	json.Unmarshal(rec.Body.Bytes(), &second)
+	var tools []string
+	for _, e := range second.Events {
+		tools = append(tools, e.ToolName)
+	}
+	if strings.Join(tools, ",") != "Write,Bash" || second.NextCursor != "" {
+		t.Errorf("second page = %q (next %q), want Write,Bash and no cursor", tools, second.NextCursor)
+	}
+}
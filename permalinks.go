@@ -0,0 +1,194 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/razvandimescu/peekm/render"
+)
+
+// permalinkHashLen is the length of the hex hash ending every permalink ID
+const permalinkHashLen = 8
+
+// maxPermalinkAliases bounds how many renamed permalinks are remembered
+const maxPermalinkAliases = 1000
+
+// permalinkAlias keeps a permalink working after its file was renamed, as
+// kept in permalinks.json
+type permalinkAlias struct {
+	Root    string    `json:"root"`    // Browsed directory the hash is relative to
+	Hash    string    `json:"hash"`    // Hash of the path the file had
+	Path    string    `json:"path"`    // Where the file is now (absolute)
+	Renamed time.Time `json:"renamed"` // When the alias was last updated
+}
+
+// permalinksMutex serializes updates of permalinks.json within this process
+var permalinksMutex sync.Mutex
+
+// permalinkHash hashes a path relative to the browsed directory. Slashes are
+// used on every platform so permalinks survive a move to another OS.
+func permalinkHash(relPath string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(relPath)))
+	return hex.EncodeToString(sum[:])[:permalinkHashLen]
+}
+
+// permalinkID returns the permalink of the file at path: a readable slug of
+// its name, which is only decoration, then the hash of its path relative to
+// root, which is what resolves. It is "" for files outside root.
+func permalinkID(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !isWithinDir(root, path) {
+		return ""
+	}
+	hash := permalinkHash(rel)
+	name := filepath.Base(path)
+	if slug := strings.Trim(render.HeadingSlug(strings.TrimSuffix(name, filepath.Ext(name))), "-_"); slug != "" {
+		return slug + "-" + hash
+	}
+	return hash
+}
+
+// parsePermalinkID returns the hash a permalink ID ends with
+func parsePermalinkID(id string) (string, bool) {
+	hash := id[strings.LastIndex(id, "-")+1:]
+	if len(hash) != permalinkHashLen {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return strings.ToLower(hash), true
+}
+
+// permalinkURL returns the /p/ URL of the file at path, or "" if it has none
+func permalinkURL(root, path string) string {
+	id := permalinkID(root, path)
+	if id == "" {
+		return ""
+	}
+	return (&url.URL{Path: "/p/" + id}).String()
+}
+
+// permalinksPath returns where renamed permalinks are kept: permalinks.json
+// in peekm's config directory ("" if there is none)
+func permalinksPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "peekm", "permalinks.json")
+}
+
+// loadPermalinkAliases reads the renamed permalinks, most recent first
+func loadPermalinkAliases() []permalinkAlias {
+	path := permalinksPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: Cannot read %s: %v", path, err)
+		}
+		return nil
+	}
+	var aliases []permalinkAlias
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		log.Printf("Warning: Invalid %s (ignored): %v", path, err)
+		return nil
+	}
+	return aliases
+}
+
+// recordPermalinkRename keeps the permalink of oldPath, and those of earlier
+// paths that led to it, pointing at newPath, keeping the newest
+// maxPermalinkAliases
+func recordPermalinkRename(root, oldPath, newPath string) {
+	path := permalinksPath()
+	oldRel, err := filepath.Rel(root, oldPath)
+	if path == "" || err != nil || !isWithinDir(root, oldPath) {
+		return
+	}
+	permalinksMutex.Lock()
+	defer permalinksMutex.Unlock()
+
+	now := time.Now().UTC()
+	hash := permalinkHash(oldRel)
+	aliases := slices.DeleteFunc(loadPermalinkAliases(), func(a permalinkAlias) bool {
+		return a.Root == root && a.Hash == hash
+	})
+	for i := range aliases {
+		if aliases[i].Root == root && aliases[i].Path == oldPath {
+			aliases[i].Path, aliases[i].Renamed = newPath, now
+		}
+	}
+	aliases = slices.Insert(aliases, 0, permalinkAlias{Root: root, Hash: hash, Path: newPath, Renamed: now})
+	if len(aliases) > maxPermalinkAliases {
+		aliases = aliases[:maxPermalinkAliases]
+	}
+
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		err = atomicWriteFile(path, string(data)+"\n")
+	}
+	if err != nil {
+		log.Printf("Warning: Cannot save renamed permalinks: %v", err)
+	}
+}
+
+// resolvePermalink returns the file among files whose permalink under root
+// has hash: the one at that path now, else the one a file renamed from it
+// became
+func resolvePermalink(root, hash string, files []string) (string, bool) {
+	for _, f := range files {
+		if rel, err := filepath.Rel(root, f); err == nil && isWithinDir(root, f) && permalinkHash(rel) == hash {
+			return f, true
+		}
+	}
+	for _, a := range loadPermalinkAliases() {
+		if a.Root == root && a.Hash == hash && slices.Contains(files, a.Path) {
+			return a.Path, true
+		}
+	}
+	return "", false
+}
+
+// servePermalink redirects /p/{id} to the current /view/ URL of the file it
+// names, following renames
+func servePermalink(w http.ResponseWriter, r *http.Request) {
+	if !*stableLinks {
+		writeError(w, errCodeNotFound, "Permalinks are disabled (start peekm with --stable-links)", http.StatusNotFound)
+		return
+	}
+	hash, ok := parsePermalinkID(r.PathValue("id"))
+	if !ok {
+		writeError(w, errCodeBadRequest, "Invalid permalink", http.StatusBadRequest)
+		return
+	}
+
+	fileMutex.RLock()
+	root := browseDir
+	fileMutex.RUnlock()
+
+	path, found := resolvePermalink(root, hash, whitelistedFiles())
+	if !found {
+		writeError(w, errCodeNotFound, "No file has this permalink", http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, viewURL(getRelativePath(path)), http.StatusFound)
+}
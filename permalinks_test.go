@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestPermalinkID(t *testing.T) {
+	root := filepath.FromSlash("/docs")
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/docs/Design Notes.md", "design-notes-" + permalinkHash("Design Notes.md")},
+		{"/docs/plans/v2.md", "v2-" + permalinkHash("plans/v2.md")},
+		{"/docs/plans/!!.md", permalinkHash("plans/!!.md")},
+		{"/elsewhere/a.md", ""},
+	}
+	for _, tt := range tests {
+		got := permalinkID(root, filepath.FromSlash(tt.path))
+		if got != tt.want {
+			t.Errorf("permalinkID(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+		if got == "" {
+			continue
+		}
+		if hash, ok := parsePermalinkID(got); !ok || hash != got[len(got)-permalinkHashLen:] {
+			t.Errorf("parsePermalinkID(%q) = %q, %v", got, hash, ok)
+		}
+	}
+
+	for _, id := range []string{"", "notes", "notes-123", "notes-zzzzzzzz"} {
+		if hash, ok := parsePermalinkID(id); ok {
+			t.Errorf("parsePermalinkID(%q) = %q, want invalid", id, hash)
+		}
+	}
+}
+
+func TestServePermalink(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root := t.TempDir()
+	original := filepath.Join(root, "draft.md")
+	moved := filepath.Join(root, "archive", "final.md")
+	other := filepath.Join(root, "other.md")
+
+	prevDir, prevFiles, prevStable := browseDir, markdownFiles, *stableLinks
+	defer func() { browseDir, markdownFiles, *stableLinks = prevDir, prevFiles, prevStable }()
+	browseDir, markdownFiles, *stableLinks = root, newFileSet([]string{original, other}), true
+
+	get := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/p/"+id, nil))
+		return w
+	}
+	id := permalinkID(root, original)
+
+	if w := get(id); w.Code != http.StatusFound || w.Header().Get("Location") != "/view/draft.md" {
+		t.Fatalf("before the rename: %d to %q, want 302 to /view/draft.md", w.Code, w.Header().Get("Location"))
+	}
+
+	// Renamed twice: the first permalink follows both
+	intermediate := filepath.Join(root, "final.md")
+	markdownFiles = newFileSet([]string{intermediate, other})
+	recordPermalinkRename(root, original, intermediate)
+	markdownFiles = newFileSet([]string{moved, other})
+	recordPermalinkRename(root, intermediate, moved)
+
+	for _, link := range []string{id, permalinkID(root, intermediate), permalinkID(root, moved)} {
+		if w := get(link); w.Code != http.StatusFound || w.Header().Get("Location") != "/view/archive/final.md" {
+			t.Errorf("%s after the renames: %d to %q, want 302 to /view/archive/final.md", link, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// The renamed file's permalink ignores the slug
+	if w := get("anything-" + id[len(id)-permalinkHashLen:]); w.Code != http.StatusFound {
+		t.Errorf("permalink with another slug: %d, want 302", w.Code)
+	}
+
+	// Aliases of files no longer served don't resolve
+	markdownFiles = newFileSet([]string{other})
+	if w := get(id); w.Code != http.StatusNotFound {
+		t.Errorf("permalink of a removed file: %d, want 404", w.Code)
+	}
+	if w := get("bad"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid permalink: %d, want 400", w.Code)
+	}
+
+	*stableLinks = false
+	if w := get(permalinkID(root, other)); w.Code != http.StatusNotFound {
+		t.Errorf("permalink without --stable-links: %d, want 404", w.Code)
+	}
+}
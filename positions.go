@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxReadingPositions bounds how many documents' positions are remembered
+const maxReadingPositions = 500
+
+// readingPosition is where a document was last read, as kept in
+// positions.json. Like scroll sync, it is measured from a heading so it
+// survives other window sizes and edits above it.
+type readingPosition struct {
+	Path     string    `json:"path"`     // Absolute
+	Heading  string    `json:"heading"`  // ID of the last heading above the viewport ("" for the top of the document)
+	Offset   float64   `json:"offset"`   // How far into that heading's section, 0 to 1
+	Progress float64   `json:"progress"` // How far into the whole document, 0 to 1
+	Updated  time.Time `json:"updated"`
+}
+
+// apiPositionRequest saves where a document was read
+type apiPositionRequest struct {
+	Path     string  `json:"path"` // Relative to the browse directory
+	Heading  string  `json:"heading"`
+	Offset   float64 `json:"offset"`
+	Progress float64 `json:"progress"`
+}
+
+// apiPosition is the /api/position response
+type apiPosition struct {
+	Path     string    `json:"path"` // Relative to the browse directory
+	Heading  string    `json:"heading"`
+	Offset   float64   `json:"offset"`
+	Progress float64   `json:"progress"`
+	Updated  time.Time `json:"updated"`
+}
+
+// positionsMutex serializes updates of positions.json within this process
+var positionsMutex sync.Mutex
+
+// positionsPath returns where reading positions are kept: positions.json in
+// peekm's config directory ("" if there is none)
+func positionsPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "peekm", "positions.json")
+}
+
+// loadReadingPositions reads the remembered positions, most recent first
+func loadReadingPositions() []readingPosition {
+	path := positionsPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: Cannot read %s: %v", path, err)
+		}
+		return nil
+	}
+	var positions []readingPosition
+	if err := json.Unmarshal(data, &positions); err != nil {
+		log.Printf("Warning: Invalid %s (ignored): %v", path, err)
+		return nil
+	}
+	return positions
+}
+
+// saveReadingPositions writes positions.json, keeping the newest
+// maxReadingPositions
+func saveReadingPositions(positions []readingPosition) {
+	path := positionsPath()
+	if path == "" {
+		return
+	}
+	if len(positions) > maxReadingPositions {
+		positions = positions[:maxReadingPositions]
+	}
+	data, err := json.MarshalIndent(positions, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		err = atomicWriteFile(path, string(data)+"\n")
+	}
+	if err != nil {
+		log.Printf("Warning: Cannot save reading positions: %v", err)
+	}
+}
+
+// readingPositionOf returns the remembered position in absPath
+func readingPositionOf(absPath string) (readingPosition, bool) {
+	positionsMutex.Lock()
+	defer positionsMutex.Unlock()
+	for _, p := range loadReadingPositions() {
+		if p.Path == absPath {
+			return p, true
+		}
+	}
+	return readingPosition{}, false
+}
+
+// rememberReadingPosition moves pos to the top of the remembered positions.
+// The top of a document needs no restoring, so it is forgotten instead.
+func rememberReadingPosition(pos readingPosition) {
+	positionsMutex.Lock()
+	defer positionsMutex.Unlock()
+	positions := loadReadingPositions()
+	n := len(positions)
+	positions = slices.DeleteFunc(positions, func(p readingPosition) bool { return p.Path == pos.Path })
+	if pos.Heading != "" || pos.Offset > 0 {
+		positions = slices.Insert(positions, 0, pos)
+	} else if len(positions) == n {
+		return // Nothing to forget
+	}
+	saveReadingPositions(positions)
+}
+
+// renameReadingPosition moves the remembered position of a renamed file
+func renameReadingPosition(oldPath, newPath string) {
+	positionsMutex.Lock()
+	defer positionsMutex.Unlock()
+	positions := loadReadingPositions()
+	if !slices.ContainsFunc(positions, func(p readingPosition) bool { return p.Path == oldPath }) {
+		return
+	}
+	positions = slices.DeleteFunc(positions, func(p readingPosition) bool { return p.Path == newPath })
+	for i := range positions {
+		if positions[i].Path == oldPath {
+			positions[i].Path = newPath
+		}
+	}
+	saveReadingPositions(positions)
+}
+
+// clampFraction limits f to 0..1 (NaN becomes 0)
+func clampFraction(f float64) float64 {
+	if !(f > 0) {
+		return 0
+	}
+	return min(f, 1)
+}
+
+// handleAPIPosition returns (GET ?path=) or saves (POST) where a document
+// was last read, so reopening it resumes there
+func handleAPIPosition(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		absPath, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+		if !ok {
+			return
+		}
+		pos, found := readingPositionOf(absPath)
+		if !found {
+			writeError(w, errCodeNotFound, "No saved position", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, apiPosition{
+			Path:     filepath.ToSlash(getRelativePath(absPath)),
+			Heading:  pos.Heading,
+			Offset:   pos.Offset,
+			Progress: pos.Progress,
+			Updated:  pos.Updated,
+		})
+	case http.MethodPost:
+		var req apiPositionRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		absPath, ok := resolveWhitelistedPath(w, req.Path)
+		if !ok {
+			return
+		}
+		rememberReadingPosition(readingPosition{
+			Path:     absPath,
+			Heading:  req.Heading,
+			Offset:   clampFraction(req.Offset),
+			Progress: clampFraction(req.Progress),
+			Updated:  time.Now().UTC(),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleAPIPosition(t *testing.T) {
+	dir := serveTestFiles(t, "positions", map[string]string{"docs/spec.md": "# Spec\n\n## Design\n\nLong.\n"})
+	path := filepath.Join(dir, "docs", "spec.md")
+
+	rec := httptest.NewRecorder()
+	handleAPIPosition(rec, httptest.NewRequest(http.MethodPost, "/api/position", strings.NewReader(`{"path": "docs/spec.md", "heading": "design", "offset": 1.5, "progress": 0.6}`)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handleAPIPosition(rec, httptest.NewRequest(http.MethodGet, "/api/position?path=docs/spec.md", nil))
+	var got apiPosition
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET = %d %s", rec.Code, rec.Body.String())
+	}
+	if got.Path != "docs/spec.md" || got.Heading != "design" || got.Offset != 1 || got.Progress != 0.6 || got.Updated.IsZero() {
+		t.Errorf("position = %+v, want design at offset 1 (clamped)", got)
+	}
+
+	// Scrolling back to the top forgets the position
+	handleAPIPosition(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/position", strings.NewReader(`{"path": "docs/spec.md", "heading": "", "offset": 0}`)))
+	if _, found := readingPositionOf(path); found {
+		t.Error("position kept after returning to the top")
+	}
+
+	tests := []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodGet, "/api/position?path=docs/spec.md", "", http.StatusNotFound},
+		{http.MethodPost, "/api/position", `{"path": "other.md", "heading": "design"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/position", `{"path": `, http.StatusBadRequest},
+		{http.MethodGet, "/api/position?path=other.md", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handleAPIPosition(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s %s: status = %d, want %d", tt.method, tt.target, tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestRenameReadingPosition(t *testing.T) {
+	dir := serveTestFiles(t, "positions", map[string]string{"docs/spec.md": "# Spec\n\n## Design\n"})
+	path := filepath.Join(dir, "docs", "spec.md")
+	handleAPIPosition(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/position", strings.NewReader(`{"path": "docs/spec.md", "heading": "design", "offset": 0.25}`)))
+
+	newPath := filepath.Join(dir, "docs", "design.md")
+	renameReadingPosition(path, newPath)
+	if _, found := readingPositionOf(path); found {
+		t.Error("position left on the old path")
+	}
+	if pos, found := readingPositionOf(newPath); !found || pos.Heading != "design" || pos.Offset != 0.25 {
+		t.Errorf("position on the new path = %+v, %v", pos, found)
+	}
+}
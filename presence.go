@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxPresenceNameLen bounds the display names browsers pick
+const maxPresenceNameLen = 40
+
+// presenceViewer is one connected browser in presence events
+type presenceViewer struct {
+	ID         string `json:"id"`             // Stable per browser; not its cookie
+	Name       string `json:"name"`           // Chosen name, or the browser and OS
+	Path       string `json:"path,omitempty"` // File it shows, relative to the browse directory
+	Presenting bool   `json:"presenting"`     // Followers are taken wherever it navigates
+	ScrollSync bool   `json:"scroll_sync"`    // Presenting with followers' viewports tracking its scrolling
+}
+
+// presenceMessage is the SSE event listing who views what, sent whenever that changes
+type presenceMessage struct {
+	Type    string           `json:"type"` // "presence"
+	Viewers []presenceViewer `json:"viewers"`
+}
+
+// apiPresenceResponse is returned by /api/presence
+type apiPresenceResponse struct {
+	Self    string           `json:"self"` // ID of the calling browser
+	Viewers []presenceViewer `json:"viewers"`
+}
+
+// apiPresenceRequest updates the calling browser's presence; omitted fields stay
+type apiPresenceRequest struct {
+	Name       *string `json:"name"`
+	Presenting *bool   `json:"presenting"`
+	ScrollSync *bool   `json:"scroll_sync"`
+}
+
+// presenterScroll is where a presenter scrolled to, as /api/presence/scroll
+// takes it and the presenter_scroll SSE event passes it on. Positions are
+// relative to headings so they carry over between window sizes.
+type presenterScroll struct {
+	Type    string  `json:"type,omitempty"` // "presenter_scroll" (events only)
+	ID      string  `json:"id,omitempty"`   // Presenter's viewer ID (events only)
+	Path    string  `json:"path"`           // File scrolled, relative to the browse directory
+	Heading string  `json:"heading"`        // ID of the last heading above the top of the viewport ("" before the first)
+	Offset  float64 `json:"offset"`         // How far the top is from that heading to the next one, 0 to 1
+}
+
+// lastPresence is the latest presence event sent, so unchanged ones (such as
+// a file reloading in place) are not sent again
+var lastPresence struct {
+	mu      sync.Mutex
+	message string
+}
+
+// presenceID derives a browser's public ID from its client cookie, which
+// other browsers must not learn
+func presenceID(clientID string) string {
+	sum := sha256.Sum256([]byte("presence\n" + clientID))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// browserLabel names a browser after its user agent, e.g. "Firefox on Linux"
+func browserLabel(userAgent string) string {
+	browser := "Browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, platform := range []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iPhone"}, {"iPad", "iPad"}, {"Windows", "Windows"}, {"Mac OS", "macOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, platform.token) {
+			return browser + " on " + platform.name
+		}
+	}
+	return browser
+}
+
+// setPresence applies the fields of update that are set to a client
+func (ts *tabStore) setPresence(clientID string, update apiPresenceRequest) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	c := ts.clientLocked(clientID)
+	if update.Name != nil {
+		c.name = *update.Name
+	}
+	if update.Presenting != nil {
+		c.presenting = *update.Presenting
+	}
+	if update.ScrollSync != nil {
+		c.scrollSync = *update.ScrollSync
+	}
+}
+
+// syncsScroll reports whether a client presents with scroll sync on
+func (ts *tabStore) syncsScroll(clientID string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	c, found := ts.clients[clientID]
+	return found && c.presenting && c.scrollSync
+}
+
+// presence lists the connected clients, ordered by ID, with the absolute path
+// of the file each is viewing
+func (ts *tabStore) presence() []presenceViewer {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var viewers []presenceViewer
+	for id, c := range ts.clients {
+		if c.connections == 0 {
+			continue
+		}
+		name := c.name
+		if name == "" {
+			name = browserLabel(c.userAgent)
+		}
+		viewers = append(viewers, presenceViewer{
+			ID:         presenceID(id),
+			Name:       name,
+			Path:       c.active,
+			Presenting: c.presenting,
+			ScrollSync: c.presenting && c.scrollSync,
+		})
+	}
+	slices.SortFunc(viewers, func(a, b presenceViewer) int { return strings.Compare(a.ID, b.ID) })
+	return viewers
+}
+
+// currentPresence lists the connected browsers with the file each is viewing
+func currentPresence() []presenceViewer {
+	viewers := globalTabStore.presence()
+	for i := range viewers {
+		absPath := viewers[i].Path
+		viewers[i].Path = ""
+		if absPath == "" {
+			continue
+		}
+		// Files outside the browse directory (e.g. cached plans) have no /view/ URL
+		if rel := getRelativePath(absPath); !filepath.IsAbs(rel) && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			viewers[i].Path = filepath.ToSlash(rel)
+		}
+	}
+	if viewers == nil {
+		viewers = []presenceViewer{}
+	}
+	return viewers
+}
+
+// broadcastPresence sends the presence event to every client if it changed.
+// It is not buffered for replay: reconnecting browsers fetch /api/presence.
+func broadcastPresence() {
+	msgBytes, err := json.Marshal(presenceMessage{Type: "presence", Viewers: currentPresence()})
+	if err != nil {
+		log.Printf("Error marshaling presence message: %v", err)
+		return
+	}
+	message := string(msgBytes)
+
+	lastPresence.mu.Lock()
+	defer lastPresence.mu.Unlock()
+	if message == lastPresence.message {
+		return
+	}
+	lastPresence.message = message
+	notifyClientsUnbuffered(message)
+}
+
+// notifyClientsUnbuffered sends an event to every client without an ID or a
+// place in the replay buffer, for state that is stale by the time a browser
+// reconnects
+func notifyClientsUnbuffered(message string) {
+	clientsMutex.RLock()
+	defer clientsMutex.RUnlock()
+	formattedMsg := fmt.Sprintf("data: %s", message)
+	for _, client := range clients {
+		if client.queue(formattedMsg) {
+			dropStaleClient(client)
+		}
+	}
+}
+
+// handleAPIPresence lists who views what (GET), or sets the calling browser's
+// name or presenter mode (POST {"name", "presenting"}) and then lists them
+func handleAPIPresence(w http.ResponseWriter, r *http.Request) {
+	clientID := tabClientID(w, r)
+	if clientID == "" {
+		writeError(w, errCodeInternal, "Cannot identify client", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req apiPresenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if utf8.RuneCountInString(name) > maxPresenceNameLen {
+				writeError(w, errCodeBadRequest, fmt.Sprintf("Name longer than %d characters", maxPresenceNameLen), http.StatusBadRequest)
+				return
+			}
+			req.Name = &name
+		}
+		globalTabStore.setPresence(clientID, req)
+		broadcastPresence()
+	}
+
+	writeJSON(w, http.StatusOK, apiPresenceResponse{Self: presenceID(clientID), Viewers: currentPresence()})
+}
+
+// handleAPIPresenceScroll passes where a presenter with scroll sync on
+// scrolled (POST {"path", "heading", "offset"}) on to its followers
+func handleAPIPresenceScroll(w http.ResponseWriter, r *http.Request) {
+	clientID := tabClientID(w, r)
+	if clientID == "" || !globalTabStore.syncsScroll(clientID) {
+		writeError(w, errCodeConflict, "Not presenting with scroll sync", http.StatusConflict)
+		return
+	}
+
+	var scroll presenterScroll
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&scroll); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	scroll.Path = cleanEventPath(scroll.Path)
+	if scroll.Path == "" || math.IsNaN(scroll.Offset) {
+		writeError(w, errCodeBadRequest, "Invalid scroll position", http.StatusBadRequest)
+		return
+	}
+	scroll.Type, scroll.ID = "presenter_scroll", presenceID(clientID)
+	scroll.Offset = max(0, min(scroll.Offset, 1))
+
+	msgBytes, err := json.Marshal(scroll)
+	if err != nil {
+		log.Printf("Error marshaling presenter_scroll message: %v", err)
+		writeError(w, errCodeInternal, "Failed to send scroll position", http.StatusInternalServerError)
+		return
+	}
+	notifyClientsUnbuffered(string(msgBytes))
+	w.WriteHeader(http.StatusNoContent)
+}
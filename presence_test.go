@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBrowserLabel(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0", "Firefox on Linux"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", "Safari on iPhone"},
+		{"", "Browser"},
+	}
+	for _, tt := range tests {
+		if got := browserLabel(tt.userAgent); got != tt.want {
+			t.Errorf("browserLabel(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+// setupPresenceTest connects alice (presenting docs/a.md) and bob (showing a
+// file outside the browsed directory), with carol's tabs but no connection,
+// and returns an SSE client whose events drain returns
+func setupPresenceTest(t *testing.T) (drain func() []string) {
+	t.Helper()
+	dir := t.TempDir()
+	prevDir, prevStore := browseDir, globalTabStore
+	t.Cleanup(func() { browseDir, globalTabStore = prevDir, prevStore })
+	browseDir, globalTabStore = dir, newTabStore()
+
+	globalTabStore.connect("alice", "Firefox/128.0 (X11; Linux)")
+	globalTabStore.open("alice", filepath.Join(dir, "docs", "a.md"))
+	globalTabStore.connect("bob", "")
+	globalTabStore.open("bob", filepath.Join(t.TempDir(), "outside.md"))
+	globalTabStore.open("carol", filepath.Join(dir, "b.md"))
+	presenting := true
+	globalTabStore.setPresence("alice", apiPresenceRequest{Presenting: &presenting})
+
+	lastPresence.mu.Lock()
+	lastPresence.message = ""
+	lastPresence.mu.Unlock()
+
+	client, _ := registerClient(httptest.NewRequest("GET", "/events", nil))
+	t.Cleanup(func() { unregisterClient(client) })
+	return func() []string {
+		var got []string
+		for len(client.ch) > 0 {
+			got = append(got, <-client.ch)
+		}
+		return got
+	}
+}
+
+func TestCurrentPresence(t *testing.T) {
+	setupPresenceTest(t)
+
+	viewers := currentPresence()
+	byID := map[string]presenceViewer{}
+	for _, v := range viewers {
+		byID[v.ID] = v
+	}
+	alice, bob := byID[presenceID("alice")], byID[presenceID("bob")]
+	if len(viewers) != 2 || alice.Name != "Firefox on Linux" || alice.Path != "docs/a.md" || !alice.Presenting {
+		t.Fatalf("presence = %+v, want alice presenting docs/a.md and bob", viewers)
+	}
+	if bob.Name != "Browser" || bob.Path != "" || bob.Presenting {
+		t.Errorf("bob = %+v, want no path outside the browsed directory", bob)
+	}
+	if strings.Contains(alice.ID, "alice") {
+		t.Errorf("presence ID %q reveals the client cookie", alice.ID)
+	}
+
+	// Disconnected browsers drop out
+	globalTabStore.disconnect("alice")
+	if viewers := currentPresence(); len(viewers) != 1 || viewers[0].ID != presenceID("bob") {
+		t.Errorf("presence after alice left = %+v", viewers)
+	}
+}
+
+func TestBroadcastPresence(t *testing.T) {
+	drain := setupPresenceTest(t)
+
+	// Changes are broadcast once, unbuffered; repeats are dropped
+	broadcastPresence()
+	broadcastPresence()
+	got := drain()
+	if len(got) != 1 || !strings.HasPrefix(got[0], `data: {"type":"presence"`) || !strings.Contains(got[0], `"path":"docs/a.md"`) {
+		t.Fatalf("presence events = %q, want one snapshot", got)
+	}
+}
+
+func TestHandleAPIPresence(t *testing.T) {
+	drain := setupPresenceTest(t)
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/presence", strings.NewReader(body))
+		r.AddCookie(&http.Cookie{Name: tabClientCookie, Value: "bob"})
+		rec := httptest.NewRecorder()
+		handleAPIPresence(rec, r)
+		return rec
+	}
+
+	rec := post(`{"name": "  Bob  "}`)
+	var resp apiPresenceResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("POST /api/presence = %d %s", rec.Code, rec.Body.String())
+	}
+	if resp.Self != presenceID("bob") || !strings.Contains(rec.Body.String(), `"name":"Bob"`) {
+		t.Errorf("response = %s, want bob named Bob", rec.Body.String())
+	}
+	if got := drain(); len(got) != 1 || !strings.Contains(got[0], `"name":"Bob"`) {
+		t.Errorf("events after renaming = %q", got)
+	}
+
+	if rec := post(`{"name": "` + strings.Repeat("x", maxPresenceNameLen+1) + `"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("overlong name: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestHandleAPIPresenceScroll(t *testing.T) {
+	drain := setupPresenceTest(t)
+	post := func(clientID, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/presence/scroll", strings.NewReader(body))
+		r.AddCookie(&http.Cookie{Name: tabClientCookie, Value: clientID})
+		rec := httptest.NewRecorder()
+		handleAPIPresenceScroll(rec, r)
+		return rec.Code
+	}
+	position := `{"path": "/docs/a.md", "heading": "setup", "offset": 1.5}`
+
+	// Scroll sync is opt-in, and only for presenters
+	if code := post("alice", position); code != http.StatusConflict {
+		t.Errorf("presenter without scroll sync: status = %d, want 409", code)
+	}
+	on := true
+	globalTabStore.setPresence("bob", apiPresenceRequest{ScrollSync: &on})
+	if code := post("bob", position); code != http.StatusConflict {
+		t.Errorf("scroll sync without presenting: status = %d, want 409", code)
+	}
+	if got := drain(); len(got) != 0 {
+		t.Fatalf("events from refused scroll positions: %q", got)
+	}
+
+	globalTabStore.setPresence("alice", apiPresenceRequest{ScrollSync: &on})
+	if code := post("alice", position); code != http.StatusNoContent {
+		t.Fatalf("presenter with scroll sync: status = %d, want 204", code)
+	}
+	want := `data: {"type":"presenter_scroll","id":"` + presenceID("alice") + `","path":"docs/a.md","heading":"setup","offset":1}`
+	if got := drain(); len(got) != 1 || got[0] != want {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+
+	if code := post("alice", `{"path": "", "heading": "setup"}`); code != http.StatusBadRequest {
+		t.Errorf("position without a path: status = %d, want 400", code)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Request body caps of the endpoints that take more than a small JSON object
+const (
+	maxSaveBodySize     = 10 << 20 // URL-encoded file and content, as the editor sends them
+	maxNavigateBodySize = 64 << 10
+	maxCreateBodySize   = 10 << 20 // JSON path and initial content of a new file
+)
+
+// maxRateLimitClients bounds the per-IP buckets kept; past it, buckets that
+// have refilled (their client went quiet) are dropped
+const maxRateLimitClients = 1024
+
+// mutationLimiter limits the endpoints wrapped in withRateLimit; nil (before
+// setupRateLimit, or with --rate-limit=0) lets every request through
+var mutationLimiter *rateLimiter
+
+// setupRateLimit creates mutationLimiter from --rate-limit
+func setupRateLimit() {
+	if *rateLimit > 0 {
+		mutationLimiter = newRateLimiter(float64(*rateLimit), 2*float64(*rateLimit))
+	}
+}
+
+// tokenBucket is one client's allowance: tokens refill at the limiter's rate
+// up to its burst, and each request takes one
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket per client IP
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // Tokens per second
+	burst   float64
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// newRateLimiter allows rate requests per second per client, in bursts of
+// up to burst
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// allow takes a token from client's bucket, reporting false when it is empty
+func (l *rateLimiter) allow(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitClients {
+			l.pruneLocked(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// pruneLocked drops the buckets that are full again, which behave the same
+// as no bucket. Callers hold l.mu.
+func (l *rateLimiter) pruneLocked(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// clientIP returns the IP address a request came from (proxy headers are
+// not trusted; peekm is meant to be reached directly)
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withRateLimit answers 429 Too Many Requests to clients over --rate-limit.
+// Buckets refill at a token per second or faster, so retrying after a
+// second succeeds.
+func withRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mutationLimiter != nil && !mutationLimiter.allow(clientIP(r)) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, errCodeTooManyRequests, "Too many requests, slow down", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isBodyTooLarge reports whether err comes from reading past an
+// http.MaxBytesReader limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
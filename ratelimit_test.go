@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(2, 4)
+	l.now = func() time.Time { return now }
+
+	for i := range 4 {
+		if !l.allow("10.0.0.1") {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	if l.allow("10.0.0.1") {
+		t.Error("request past the burst allowed")
+	}
+	if !l.allow("10.0.0.2") {
+		t.Error("another client limited by the first one's requests")
+	}
+
+	now = now.Add(500 * time.Millisecond) // One token back at 2 per second
+	if !l.allow("10.0.0.1") || l.allow("10.0.0.1") {
+		t.Error("half a second later: want exactly one more request")
+	}
+	now = now.Add(time.Hour)
+	for i := range 4 {
+		if !l.allow("10.0.0.1") {
+			t.Fatalf("request %d after an idle hour refused (burst not refilled)", i+1)
+		}
+	}
+}
+
+func TestRateLimiterPrunesIdleClients(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(1, 2)
+	l.now = func() time.Time { return now }
+	for i := range maxRateLimitClients {
+		l.allow("client-" + strconv.Itoa(i))
+	}
+	now = now.Add(time.Minute)
+	l.allow("newcomer")
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets after pruning = %d, want only the newcomer's", len(l.buckets))
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	prev := mutationLimiter
+	t.Cleanup(func() { mutationLimiter = prev })
+	mutationLimiter = newRateLimiter(1, 1)
+	handler := withRateLimit(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/save", nil)
+		r.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		return rec
+	}
+	if rec := request("192.0.2.1:5000"); rec.Code != http.StatusNoContent {
+		t.Fatalf("first request = %d", rec.Code)
+	}
+	rec := request("192.0.2.1:5001") // Same IP, another connection
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("second request = %d, Retry-After %q; want 429 with Retry-After 1", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := request("192.0.2.2:5000"); rec.Code != http.StatusNoContent {
+		t.Errorf("request from another IP = %d", rec.Code)
+	}
+
+	mutationLimiter = nil
+	if rec := request("192.0.2.1:5000"); rec.Code != http.StatusNoContent {
+		t.Errorf("request with --rate-limit=0 = %d", rec.Code)
+	}
+}
+
+// TestRoutesRateLimited checks that the routes writing files are behind --rate-limit
+func TestRoutesRateLimited(t *testing.T) {
+	prev := mutationLimiter
+	t.Cleanup(func() { mutationLimiter = prev })
+	serveTestFiles(t, "ratelimit", nil) // The first of each request may write
+	handler := routes()
+
+	tests := []struct{ method, target string }{
+		{http.MethodPost, "/save"},
+		{http.MethodPost, "/insert-toc"},
+		{http.MethodPost, "/api/replace"},
+		{http.MethodPost, "/api/replace/undo"},
+		{http.MethodPut, "/api/frontmatter"},
+		{http.MethodPost, "/api/review"},
+		{http.MethodPost, "/today"},
+		{http.MethodPost, "/api/comments"},
+		{http.MethodPost, "/api/position"},
+		{http.MethodPost, "/api/bookmarks"},
+		{http.MethodPost, "/api/spellcheck"},
+	}
+	for _, tt := range tests {
+		mutationLimiter = newRateLimiter(1, 1)
+		var rec *httptest.ResponseRecorder
+		for range 2 {
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		}
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("%s %s: second request = %d, want 429", tt.method, tt.target, rec.Code)
+		}
+	}
+}
+
+func TestBodySizeCaps(t *testing.T) {
+	var upload bytes.Buffer
+	form := multipart.NewWriter(&upload)
+	part, _ := form.CreateFormFile("files", "big.md")
+	part.Write(bytes.Repeat([]byte("x"), maxImportSize+1))
+	form.Close()
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		contentType string
+		body        []byte
+	}{
+		{"save", handleSave, "application/x-www-form-urlencoded", []byte("file=a.md&content=" + strings.Repeat("x", maxSaveBodySize))},
+		{"navigate", handleNavigate, "application/json", []byte(`{"path": "` + strings.Repeat("x", maxNavigateBodySize) + `"}`)},
+		{"import", handleImport, form.FormDataContentType(), upload.Bytes()},
+		{"hook", handleClaudeHook, "application/json", bytes.Repeat([]byte(" "), maxHookBodySize+1)},
+		{"create", handleCreate, "application/json", []byte(`{"path": "a.md", "content": "` + strings.Repeat("x", maxCreateBodySize) + `"}`)},
+		{"share", handleAPIShare, "application/json", []byte(`{"path": "` + strings.Repeat("x", 4<<10) + `"}`)},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		rec := httptest.NewRecorder()
+		tt.handler(rec, r)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: oversized body = %d %s, want 413", tt.name, rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+	}
+}
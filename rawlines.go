@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// errLinesNotSatisfiable means a ?lines= range starts past the end of the file
+var errLinesNotSatisfiable = errors.New("line range not satisfiable")
+
+// lineRange is a /raw ?lines= range of 1-based lines, both included
+type lineRange struct {
+	first int
+	last  int // 0 for the end of the file
+}
+
+// parseLineRange reads ?lines=: "100-200", "100-" (to the end) or "100"
+func parseLineRange(value string) (lineRange, error) {
+	firstValue, lastValue, isRange := strings.Cut(value, "-")
+	first, err := strconv.Atoi(firstValue)
+	if err != nil || first < 1 {
+		return lineRange{}, errors.New("invalid line range")
+	}
+	lines := lineRange{first: first, last: first}
+	if isRange {
+		lines.last = 0
+		if lastValue != "" {
+			lines.last, err = strconv.Atoi(lastValue)
+			if err != nil || lines.last < first {
+				return lineRange{}, errors.New("invalid line range")
+			}
+		}
+	}
+	return lines, nil
+}
+
+// String returns the range as "first-last"
+func (lines lineRange) String() string {
+	return fmt.Sprintf("%d-%d", lines.first, lines.last)
+}
+
+// lineOffsets scans r for the byte range of lines: from the start of the
+// first line to the end of the last, its line break included. A range
+// running past the end of the file is cut short; the returned lineRange is
+// the lines found.
+func lineOffsets(r io.Reader, lines lineRange) (start, end int64, found lineRange, err error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	line, offset, lineStart := 1, int64(0), int64(0)
+	start = -1
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if line == lines.first && start < 0 {
+			start = lineStart
+		}
+		offset += int64(len(chunk))
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue // A long line
+		case err == nil: // A line ended
+			if line == lines.last {
+				return start, offset, lineRange{first: lines.first, last: line}, nil
+			}
+			line, lineStart = line+1, offset
+			continue
+		case err != io.EOF:
+			return 0, 0, lineRange{}, err
+		}
+		break
+	}
+
+	lastLine := line // The file's last line has no line break...
+	if offset == lineStart {
+		lastLine-- // ...or ends with one
+	}
+	if start < 0 || lines.first > lastLine {
+		return 0, 0, lineRange{}, errLinesNotSatisfiable
+	}
+	return start, offset, lineRange{first: lines.first, last: lastLine}, nil
+}
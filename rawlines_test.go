@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    lineRange
+		wantErr bool
+	}{
+		{"100-200", lineRange{100, 200}, false},
+		{"100-", lineRange{100, 0}, false},
+		{"7", lineRange{7, 7}, false},
+		{"0-3", lineRange{}, true},
+		{"5-4", lineRange{}, true},
+		{"-20", lineRange{}, true},
+		{"a-b", lineRange{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseLineRange(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseLineRange(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLineOffsets(t *testing.T) {
+	long := strings.Repeat("x", 100<<10) // Longer than the read buffer
+	tests := []struct {
+		name    string
+		content string
+		lines   lineRange
+		want    string
+		found   lineRange
+		wantErr error
+	}{
+		{"middle", "a\nb\nc\nd\n", lineRange{2, 3}, "b\nc\n", lineRange{2, 3}, nil},
+		{"to the end", "a\nb\nc\n", lineRange{2, 0}, "b\nc\n", lineRange{2, 3}, nil},
+		{"past the end", "a\nb", lineRange{2, 9}, "b", lineRange{2, 2}, nil},
+		{"first line", "a\r\nb\r\n", lineRange{1, 1}, "a\r\n", lineRange{1, 1}, nil},
+		{"long lines", long + "\n" + long + "\nz\n", lineRange{2, 3}, long + "\nz\n", lineRange{2, 3}, nil},
+		{"after the last line", "a\nb\n", lineRange{3, 0}, "", lineRange{}, errLinesNotSatisfiable},
+		{"empty file", "", lineRange{1, 1}, "", lineRange{}, errLinesNotSatisfiable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, found, err := lineOffsets(strings.NewReader(tt.content), tt.lines)
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := tt.content[start:end]; got != tt.want || found != tt.found {
+				t.Errorf("lines %v = %q (%v), want %q (%v)", tt.lines, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestServeRawPartial(t *testing.T) {
+	serveTestFiles(t, "raw", map[string]string{"big.md": "# One\nTwo\nThree\nFour\n"})
+
+	tests := []struct {
+		name      string
+		target    string
+		rangeHdr  string
+		wantCode  int
+		wantBody  string
+		wantLines string
+	}{
+		{"whole file", "/raw/big.md", "", http.StatusOK, "# One\nTwo\nThree\nFour\n", ""},
+		{"byte range", "/raw/big.md", "bytes=6-8", http.StatusPartialContent, "Two", ""},
+		{"lines", "/raw/big.md?lines=2-3", "", http.StatusOK, "Two\nThree\n", "2-3"},
+		{"lines to the end", "/raw/big.md?lines=3-", "", http.StatusOK, "Three\nFour\n", "3-4"},
+		{"byte range of lines", "/raw/big.md?lines=3-4", "bytes=0-4", http.StatusPartialContent, "Three", "3-4"},
+		{"lines past the end", "/raw/big.md?lines=9-", "", http.StatusRequestedRangeNotSatisfiable, "", ""},
+		{"invalid lines", "/raw/big.md?lines=x", "", http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.rangeHdr != "" {
+				req.Header.Set("Range", tt.rangeHdr)
+			}
+			rec := httptest.NewRecorder()
+			routes().ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get("X-Peekm-Lines"); got != tt.wantLines {
+				t.Errorf("X-Peekm-Lines = %q, want %q", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestServeRawConditional(t *testing.T) {
+	dir := serveTestFiles(t, "raw", map[string]string{"a.md": "# One\nTwo\n"})
+	path := filepath.Join(dir, "a.md")
+
+	get := func(target, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		routes().ServeHTTP(rec, req)
+		return rec
+	}
+	etag := get("/raw/a.md", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if code := get("/raw/a.md", etag).Code; code != http.StatusNotModified {
+		t.Errorf("unchanged file status = %d, want 304", code)
+	}
+
+	// Lines have their own ETag
+	if code := get("/raw/a.md?lines=2", etag).Code; code != http.StatusOK {
+		t.Errorf("lines with the file's ETag status = %d, want 200", code)
+	}
+
+	// An edit changes the ETag
+	os.WriteFile(path, []byte("# One\nTwo\nThree\n"), 0644)
+	if code := get("/raw/a.md", etag).Code; code != http.StatusOK {
+		t.Errorf("edited file status = %d, want 200", code)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRecentDirs bounds how many browsed directories are remembered
+const maxRecentDirs = 20
+
+// recentDir is a directory peekm browsed, as kept in recent.json
+type recentDir struct {
+	Path     string    `json:"path"`
+	Markdown int       `json:"markdown"` // Markdown files it had when last browsed
+	LastUsed time.Time `json:"last_used"`
+}
+
+// apiRecentDir is one /api/recent-dirs entry
+type apiRecentDir struct {
+	recentDir
+	Current bool `json:"current,omitempty"` // The directory browsed now
+}
+
+// apiRecentDirsResponse is the /api/recent-dirs response
+type apiRecentDirsResponse struct {
+	Dirs       []apiRecentDir `json:"dirs"`
+	NextCursor string         `json:"next_cursor,omitempty"` // With ?limit= or ?cursor=, absent on the last page
+}
+
+// recentDirsMutex serializes updates of recent.json within this process
+var recentDirsMutex sync.Mutex
+
+// recentDirsPath returns where recent directories are kept: recent.json in
+// peekm's config directory ("" if there is none)
+func recentDirsPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "peekm", "recent.json")
+}
+
+// loadRecentDirs reads the remembered directories, most recent first
+func loadRecentDirs() []recentDir {
+	path := recentDirsPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: Cannot read %s: %v", path, err)
+		}
+		return nil
+	}
+	var dirs []recentDir
+	if err := json.Unmarshal(data, &dirs); err != nil {
+		log.Printf("Warning: Invalid %s (ignored): %v", path, err)
+		return nil
+	}
+	return dirs
+}
+
+// rememberRecentDir moves dir to the top of the recent directories with its
+// current markdown count, keeping the newest maxRecentDirs
+func rememberRecentDir(dir string, markdown int) {
+	path := recentDirsPath()
+	if path == "" {
+		return
+	}
+	recentDirsMutex.Lock()
+	defer recentDirsMutex.Unlock()
+
+	dirs := slices.DeleteFunc(loadRecentDirs(), func(d recentDir) bool { return d.Path == dir })
+	dirs = slices.Insert(dirs, 0, recentDir{Path: dir, Markdown: markdown, LastUsed: time.Now().UTC()})
+	if len(dirs) > maxRecentDirs {
+		dirs = dirs[:maxRecentDirs]
+	}
+
+	data, err := json.MarshalIndent(dirs, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		err = atomicWriteFile(path, string(data)+"\n")
+	}
+	if err != nil {
+		log.Printf("Warning: Cannot save recent directories: %v", err)
+	}
+}
+
+// existingRecentDirs returns the remembered directories that still exist
+func existingRecentDirs() []recentDir {
+	var dirs []recentDir
+	for _, d := range loadRecentDirs() {
+		if info, err := os.Stat(d.Path); err == nil && info.IsDir() {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// serveAPIRecentDirs lists the recently browsed directories that still
+// exist, for one-click returns from the navigate dialog, paginated with
+// ?limit= and ?cursor=
+func serveAPIRecentDirs(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePageRequest(r)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid page: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	fileMutex.RLock()
+	currentBrowseDir := browseDir
+	fileMutex.RUnlock()
+
+	// Most recent first, then by path, so pages hold still while directories are browsed
+	dirs := existingRecentDirs()
+	slices.SortStableFunc(dirs, func(a, b recentDir) int {
+		if c := b.LastUsed.Compare(a.LastUsed); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	dirs, next := paginate(dirs, page, func(d recentDir, key string) bool {
+		lastUsed, path := parseTimeKey(key)
+		return d.LastUsed.After(lastUsed) || (d.LastUsed.Equal(lastUsed) && d.Path <= path)
+	}, func(d recentDir) string { return timeKey(d.LastUsed, d.Path) })
+
+	resp := apiRecentDirsResponse{Dirs: []apiRecentDir{}, NextCursor: next}
+	for _, d := range dirs {
+		resp.Dirs = append(resp.Dirs, apiRecentDir{recentDir: d, Current: d.Path == currentBrowseDir})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// runRecent prints the recently browsed directories that still exist
+func runRecent(args []string) {
+	recentFlags := flag.NewFlagSet("recent", flag.ExitOnError)
+	asJSON := recentFlags.Bool("json", false, "Print the directories as JSON")
+	recentFlags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: peekm recent [--json]")
+		fmt.Fprintln(os.Stderr, "\nLists recently browsed directories, most recent first: path, markdown files, last use.")
+		recentFlags.PrintDefaults()
+	}
+	if len(parseInterspersed(recentFlags, args)) > 0 {
+		recentFlags.Usage()
+		os.Exit(1)
+	}
+
+	dirs := existingRecentDirs()
+	if *asJSON {
+		if dirs == nil {
+			dirs = []recentDir{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dirs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	for _, d := range dirs {
+		fmt.Printf("%s\t%d\t%s\n", d.Path, d.Markdown, d.LastUsed.Local().Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestRememberRecentDir(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	root := t.TempDir()
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "b")
+	os.Mkdir(a, 0755)
+	os.Mkdir(b, 0755)
+
+	if dirs := loadRecentDirs(); dirs != nil {
+		t.Fatalf("recent directories before any navigation = %v", dirs)
+	}
+	rememberRecentDir(a, 2)
+	rememberRecentDir(b, 3)
+	rememberRecentDir(a, 5)
+
+	dirs := loadRecentDirs()
+	if len(dirs) != 2 || dirs[0].Path != a || dirs[0].Markdown != 5 || dirs[1].Path != b {
+		t.Fatalf("recent directories = %+v, want a (5 files) then b", dirs)
+	}
+	if dirs[0].LastUsed.Before(dirs[1].LastUsed) {
+		t.Error("the most recent directory has the older timestamp")
+	}
+
+	// Deleted directories are still remembered but no longer offered
+	os.Remove(b)
+	if existing := existingRecentDirs(); len(existing) != 1 || existing[0].Path != a {
+		t.Errorf("existing recent directories = %+v, want just a", existing)
+	}
+
+	for i := 0; i < maxRecentDirs+5; i++ {
+		rememberRecentDir(filepath.Join(root, "dir"+strconv.Itoa(i)), 1)
+	}
+	if dirs := loadRecentDirs(); len(dirs) != maxRecentDirs {
+		t.Errorf("%d recent directories kept, want %d", len(dirs), maxRecentDirs)
+	}
+
+	os.WriteFile(filepath.Join(configDir, "peekm", "recent.json"), []byte("not json"), 0644)
+	if dirs := loadRecentDirs(); dirs != nil {
+		t.Errorf("invalid recent.json gave %v", dirs)
+	}
+}
+
+func TestServeAPIRecentDirs(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root := t.TempDir()
+	docs, notes := filepath.Join(root, "docs"), filepath.Join(root, "notes")
+	os.Mkdir(docs, 0755)
+	os.Mkdir(notes, 0755)
+	rememberRecentDir(notes, 1)
+	rememberRecentDir(docs, 4)
+
+	prevDir := browseDir
+	browseDir = docs
+	defer func() { browseDir = prevDir }()
+
+	rec := httptest.NewRecorder()
+	serveAPIRecentDirs(rec, httptest.NewRequest("GET", "/api/recent-dirs", nil))
+	var resp apiRecentDirsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Dirs) != 2 || !resp.Dirs[0].Current || resp.Dirs[0].Markdown != 4 || resp.Dirs[1].Path != notes || resp.Dirs[1].Current {
+		t.Errorf("/api/recent-dirs = %+v, want docs (current) then notes", resp.Dirs)
+	}
+
+	rec = httptest.NewRecorder()
+	serveAPIRecentDirs(rec, httptest.NewRequest("GET", "/api/recent-dirs?limit=1", nil))
+	var first apiRecentDirsResponse
+	json.Unmarshal(rec.Body.Bytes(), &first)
+	rec = httptest.NewRecorder()
+	serveAPIRecentDirs(rec, httptest.NewRequest("GET", "/api/recent-dirs?limit=1&cursor="+first.NextCursor, nil))
+	var second apiRecentDirsResponse
+	json.Unmarshal(rec.Body.Bytes(), &second)
+	if len(first.Dirs) != 1 || first.Dirs[0].Path != docs || len(second.Dirs) != 1 || second.Dirs[0].Path != notes || second.NextCursor != "" {
+		t.Errorf("pages of one = %+v then %+v, want docs then notes", first, second)
+	}
+}
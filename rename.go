@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// renamePairWindow is how long a markdown file renamed away waits for the
+// creation that completes the rename before it counts as removed
+const renamePairWindow = 300 * time.Millisecond
+
+// fileRenamedMessage is used for SSE notifications about renamed files
+type fileRenamedMessage struct {
+	Type    string `json:"type"`     // "file_renamed"
+	Path    string `json:"path"`     // New path, relative to the browse directory
+	OldPath string `json:"old_path"` // Previous path, likewise
+	Session string `json:"session,omitempty"`
+}
+
+// pendingRename is a file renamed away, not yet paired with its new path
+type pendingRename struct {
+	path  string
+	timer *time.Timer
+}
+
+// renameTracker pairs the two halves of a rename the directory watcher
+// reports separately: the old path renamed away, then the new path created
+type renameTracker struct {
+	mu      sync.Mutex
+	pending []*pendingRename // Oldest first
+}
+
+// renames tracks the renames in the browsed directory
+var renames = &renameTracker{}
+
+// renamedAway holds path for renamePairWindow, then calls removed with it
+// unless a creation claimed it in the meantime
+func (rt *renameTracker) renamedAway(path string, removed func(path string)) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	p := &pendingRename{path: path}
+	p.timer = time.AfterFunc(renamePairWindow, func() {
+		if rt.take(p) {
+			removed(path)
+		}
+	})
+	rt.pending = append(rt.pending, p)
+}
+
+// take removes p from the pending renames, reporting whether it was there
+func (rt *renameTracker) take(p *pendingRename) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	i := slices.Index(rt.pending, p)
+	if i < 0 {
+		return false
+	}
+	rt.pending = slices.Delete(rt.pending, i, i+1)
+	return true
+}
+
+// claim returns the pending path a newly created file was renamed from, if
+// any. Renames keep the modification time and size, so a pending path the
+// search index knows with the same ones wins; then one with the same file
+// name (a move to another directory); then the oldest.
+func (rt *renameTracker) claim(newPath string) (string, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if len(rt.pending) == 0 {
+		return "", false
+	}
+
+	i := -1
+	if info, err := os.Stat(newPath); err == nil {
+		if index, _ := textIndex.current(); index != nil {
+			i = slices.IndexFunc(rt.pending, func(p *pendingRename) bool {
+				return index.Fresh(p.path, info.ModTime(), info.Size())
+			})
+		}
+	}
+	if i < 0 {
+		i = max(0, slices.IndexFunc(rt.pending, func(p *pendingRename) bool {
+			return filepath.Base(p.path) == filepath.Base(newPath)
+		}))
+	}
+	p := rt.pending[i]
+	p.timer.Stop()
+	rt.pending = slices.Delete(rt.pending, i, i+1)
+	return p.path, true
+}
+
+// handleMarkdownRenamed moves a file's whitelist entry, tabs, AI session
+// records, index entry, permalink and comments to its new path and notifies clients
+func handleMarkdownRenamed(oldPath, newPath string) {
+	if oldPath == newPath {
+		// Replaced in place, as editors do when saving through a backup
+		textIndex.update(newPath)
+		return
+	}
+	log.Printf("Renamed file: %s -> %s", oldPath, newPath)
+
+	fileMutex.Lock()
+	markdownFiles.remove(oldPath)
+	markdownFiles.add(newPath)
+	root := browseDir
+	fileMutex.Unlock()
+
+	if *stableLinks {
+		recordPermalinkRename(root, oldPath, newPath)
+	}
+	renameComments(oldPath, newPath)
+	renameReadingPosition(oldPath, newPath)
+	renameBookmarks(oldPath, newPath)
+
+	sessionID := ""
+	if globalSessionStore != nil {
+		sessionID = globalSessionStore.rename(oldPath, newPath)
+	}
+	if globalTabStore.rename(oldPath, newPath) {
+		refreshFileWatches()
+	}
+	textIndex.remove(oldPath)
+	textIndex.update(newPath)
+
+	msgBytes, err := json.Marshal(fileRenamedMessage{
+		Type:    "file_renamed",
+		Path:    getRelativePath(newPath),
+		OldPath: getRelativePath(oldPath),
+		Session: sessionID,
+	})
+	if err != nil {
+		log.Printf("Error marshaling file_renamed message: %v", err)
+		return
+	}
+	notifyClientsWithMessage(string(msgBytes))
+}
+
+// rename moves the session metadata, diff snapshot and hook event paths of
+// oldPath to newPath, returning the session that last modified the file
+func (ss *sessionStore) rename(oldPath, newPath string) string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	sessionID := ""
+	if metadata, found := ss.mappings[oldPath]; found {
+		ss.mappings[newPath] = metadata
+		delete(ss.mappings, oldPath)
+		sessionID = metadata.SessionID
+	}
+	if snap, found := ss.snapshots[oldPath]; found {
+		ss.snapshots[newPath] = snap
+		delete(ss.snapshots, oldPath)
+	}
+	ss.renameFileLocked(oldPath, newPath)
+	for _, events := range ss.events {
+		for i := range events {
+			if events[i].FilePath == oldPath {
+				events[i].FilePath = newPath
+			}
+		}
+	}
+	return sessionID
+}
+
+// rename replaces oldPath with newPath in every client's tabs, reporting
+// whether any client had it open
+func (ts *tabStore) rename(oldPath, newPath string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	renamed := false
+	for _, c := range ts.clients {
+		i := slices.Index(c.files, oldPath)
+		if i < 0 {
+			continue
+		}
+		renamed = true
+		if slices.Contains(c.files, newPath) {
+			c.files = slices.Delete(c.files, i, i+1)
+		} else {
+			c.files[i] = newPath
+		}
+		if c.active == oldPath {
+			c.active = newPath
+		}
+	}
+	return renamed
+}
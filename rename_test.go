@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestRenameTracker tests pairing renamed-away paths with created ones
+func TestRenameTracker(t *testing.T) {
+	rt := &renameTracker{}
+	removed := make(chan string, 3)
+	onRemoved := func(path string) { removed <- path }
+
+	rt.renamedAway("/docs/a.md", onRemoved)
+	rt.renamedAway("/docs/notes.md", onRemoved)
+	rt.renamedAway("/docs/b.md", onRemoved)
+
+	// A move to another directory keeps the file name
+	if old, ok := rt.claim("/docs/archive/notes.md"); !ok || old != "/docs/notes.md" {
+		t.Errorf("claim(archive/notes.md) = %q, %v; want /docs/notes.md", old, ok)
+	}
+	// Otherwise the oldest pending rename is the source
+	if old, ok := rt.claim("/docs/renamed.md"); !ok || old != "/docs/a.md" {
+		t.Errorf("claim(renamed.md) = %q, %v; want /docs/a.md", old, ok)
+	}
+
+	// Unclaimed renames count as removals once the window passes
+	select {
+	case path := <-removed:
+		if path != "/docs/b.md" {
+			t.Errorf("removed %q, want /docs/b.md", path)
+		}
+	case <-time.After(10 * renamePairWindow):
+		t.Fatal("unclaimed rename never removed")
+	}
+	if old, ok := rt.claim("/docs/late.md"); ok {
+		t.Errorf("claim after the window = %q, want none", old)
+	}
+	if len(removed) != 0 {
+		t.Error("claimed renames were removed too")
+	}
+}
+
+// TestHandleMarkdownRenamed tests that a rename keeps the file's identity
+func TestHandleMarkdownRenamed(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "draft.md"), filepath.Join(dir, "notes", "final.md")
+	prevDir, prevFiles, prevSessions, prevTabs := browseDir, markdownFiles, globalSessionStore, globalTabStore
+	prevClients, prevEvents, prevNoWatch := clients, globalEventBuffer, *noWatch
+	defer func() {
+		browseDir, markdownFiles, globalSessionStore, globalTabStore = prevDir, prevFiles, prevSessions, prevTabs
+		clients, globalEventBuffer, *noWatch = prevClients, prevEvents, prevNoWatch
+	}()
+	browseDir, markdownFiles, *noWatch = dir, newFileSet([]string{oldPath}), true
+	globalSessionStore, globalTabStore = newSessionStore(), newTabStore()
+	clients, globalEventBuffer = make(map[uint64]*sseClient), newEventBuffer(50)
+
+	globalSessionStore.register(oldPath, &SessionMetadata{SessionID: "s1"})
+	globalSessionStore.recordEvent("s1", sessionEvent{Type: hookPostToolUse, FilePath: oldPath})
+	globalTabStore.open("browser", oldPath)
+	scoped, _ := registerClient(httptest.NewRequest("GET", "/events?file=draft.md", nil))
+
+	handleMarkdownRenamed(oldPath, newPath)
+
+	if isWhitelistedFile(oldPath) || !isWhitelistedFile(newPath) {
+		t.Error("whitelist not moved to the new path")
+	}
+	if metadata, found := globalSessionStore.get(newPath); !found || metadata.SessionID != "s1" {
+		t.Error("session metadata not moved to the new path")
+	}
+	if touched := globalSessionStore.touchedFiles("s1", time.Time{}); !touched[newPath] || touched[oldPath] {
+		t.Errorf("session events touch %v, want the new path", touched)
+	}
+	if files, active := globalTabStore.tabs("browser", func(string) bool { return true }); !reflect.DeepEqual(files, []string{newPath}) || active != newPath {
+		t.Errorf("tabs = %q (active %q), want the new path", files, active)
+	}
+
+	// A client watching the old path hears about the rename
+	want := "id: 1\ndata: " + `{"type":"file_renamed","path":"` + filepath.Join("notes", "final.md") + `","old_path":"draft.md","session":"s1"}`
+	if len(scoped.ch) != 1 {
+		t.Fatalf("scoped client got %d events, want 1", len(scoped.ch))
+	}
+	if got := <-scoped.ch; got != want {
+		t.Errorf("event = %q, want %q", got, want)
+	}
+}
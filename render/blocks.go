@@ -0,0 +1,87 @@
+package render
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// voidElements never have an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// Blocks cuts a rendered document into its top-level elements, byte for byte:
+// joined, the blocks are the document again. Whitespace and comments between
+// elements stay with the block before them. It reports false when the
+// document can't be cut that way: text outside any element, unbalanced tags
+// (raw HTML in the markdown may leave some open) or no element at all.
+func Blocks(document string) ([]string, bool) {
+	var c blockCutter
+	z := html.NewTokenizer(strings.NewReader(document))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF || c.depth != 0 || len(c.blocks) == 0 {
+				return nil, false
+			}
+			c.blocks[len(c.blocks)-1] += c.cur.String()
+			return c.blocks, true
+		}
+		if !c.add(z, tt) {
+			return nil, false
+		}
+	}
+}
+
+// blockCutter collects the blocks of Blocks
+type blockCutter struct {
+	blocks []string
+	cur    strings.Builder // The block being read
+	depth  int             // Elements open
+}
+
+// add takes the tokenizer's current token, reporting false when the document
+// can't be cut into blocks
+func (c *blockCutter) add(z *html.Tokenizer, tt html.TokenType) bool {
+	raw := string(z.Raw())
+	blank := tt == html.TextToken && strings.TrimSpace(raw) == ""
+	if (blank || tt == html.CommentToken) && c.betweenBlocks() {
+		c.blocks[len(c.blocks)-1] += raw
+		return true
+	}
+	c.cur.WriteString(raw)
+
+	switch tt {
+	case html.TextToken:
+		return c.depth > 0 || blank
+	case html.StartTagToken:
+		if name, _ := z.TagName(); !voidElements[string(name)] {
+			c.depth++
+			return true
+		}
+	case html.EndTagToken:
+		if name, _ := z.TagName(); voidElements[string(name)] {
+			return true
+		}
+		c.depth--
+	case html.SelfClosingTagToken:
+	default:
+		return true
+	}
+	if c.depth < 0 {
+		return false
+	}
+	if c.depth == 0 {
+		c.blocks = append(c.blocks, c.cur.String())
+		c.cur.Reset()
+	}
+	return true
+}
+
+// betweenBlocks reports whether a block has ended and the next not begun
+func (c *blockCutter) betweenBlocks() bool {
+	return c.depth == 0 && c.cur.Len() == 0 && len(c.blocks) > 0
+}
@@ -0,0 +1,145 @@
+package render
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// CriticMarkup kinds, named after the character their delimiters repeat
+const (
+	CriticAddition     byte = '+' // {++added++}
+	CriticDeletion     byte = '-' // {--deleted--}
+	CriticSubstitution byte = '~' // {~~old~>new~~}
+	CriticHighlight    byte = '=' // {==highlighted==}
+	CriticComment      byte = '>' // {>>comment<<}
+)
+
+// Where a CriticMarker sits in its span
+const (
+	CriticOpen   = iota // Opening delimiter, e.g. {++
+	CriticSwitch        // ~> between the old and new text of a substitution
+	CriticClose         // Closing delimiter, e.g. ++}
+)
+
+// KindCriticMarker is the AST node kind for CriticMarkup delimiters
+var KindCriticMarker = ast.NewNodeKind("CriticMarker")
+
+// CriticMarker is a CriticMarkup delimiter. The text between an opening and
+// a closing marker stays ordinary inline markdown.
+type CriticMarker struct {
+	ast.BaseInline
+	Markup   byte // CriticAddition, CriticDeletion, ...
+	Position int  // CriticOpen, CriticSwitch or CriticClose
+}
+
+func (n *CriticMarker) Kind() ast.NodeKind {
+	return KindCriticMarker
+}
+
+func (n *CriticMarker) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Markup": string(n.Markup), "Position": [...]string{"open", "switch", "close"}[n.Position]}, nil)
+}
+
+// criticClosers maps each CriticMarkup kind to its closing delimiter
+var criticClosers = map[byte][]byte{
+	CriticAddition:     []byte("++}"),
+	CriticDeletion:     []byte("--}"),
+	CriticSubstitution: []byte("~~}"),
+	CriticHighlight:    []byte("==}"),
+	CriticComment:      []byte("<<}"),
+}
+
+// criticSpanKey holds the open CriticMarkup span while its line is parsed
+var criticSpanKey = parser.NewContextKey()
+
+// criticSpan is an opened span waiting for its closing delimiter
+type criticSpan struct {
+	block    ast.Node // Block being parsed; spans do not cross blocks
+	markup   byte
+	switched bool // Substitution past its ~>
+}
+
+// criticParser parses CriticMarkup delimiters. Spans open only when their
+// closing delimiter follows on the same line, so stray braces stay text.
+type criticParser struct{}
+
+func (p *criticParser) Trigger() []byte {
+	return []byte{'{', '+', '-', '~', '=', '<'}
+}
+
+func (p *criticParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	span, _ := pc.Get(criticSpanKey).(*criticSpan)
+	if span != nil && span.block != parent {
+		span = nil
+	}
+
+	if span == nil {
+		if len(line) < 3 || line[0] != '{' || line[1] != line[2] {
+			return nil
+		}
+		closer, ok := criticClosers[line[1]]
+		if !ok {
+			return nil
+		}
+		rest := line[3:]
+		end := bytes.Index(rest, closer)
+		if end < 0 || (line[1] == CriticSubstitution && !bytes.Contains(rest[:end], []byte("~>"))) {
+			return nil
+		}
+		pc.Set(criticSpanKey, &criticSpan{block: parent, markup: line[1]})
+		block.Advance(3)
+		return &CriticMarker{Markup: line[1], Position: CriticOpen}
+	}
+
+	if span.markup == CriticSubstitution && !span.switched && bytes.HasPrefix(line, []byte("~>")) {
+		span.switched = true
+		block.Advance(2)
+		return &CriticMarker{Markup: span.markup, Position: CriticSwitch}
+	}
+	if bytes.HasPrefix(line, criticClosers[span.markup]) {
+		pc.Set(criticSpanKey, nil)
+		block.Advance(3)
+		return &CriticMarker{Markup: span.markup, Position: CriticClose}
+	}
+	return nil
+}
+
+// criticTags are the HTML a marker becomes, by kind and position
+var criticTags = map[byte][3]string{
+	CriticAddition:     {`<ins class="critic">`, "", `</ins>`},
+	CriticDeletion:     {`<del class="critic">`, "", `</del>`},
+	CriticSubstitution: {`<del class="critic">`, `</del><ins class="critic">`, `</ins>`},
+	CriticHighlight:    {`<mark class="critic">`, "", `</mark>`},
+	CriticComment:      {`<span class="critic critic-comment" role="note">`, "", `</span>`},
+}
+
+// criticRenderer renders markers as <ins>, <del>, <mark> and comment tags
+type criticRenderer struct{}
+
+func (r *criticRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindCriticMarker, r.render)
+}
+
+func (r *criticRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		n := node.(*CriticMarker)
+		_, _ = w.WriteString(criticTags[n.Markup][n.Position])
+	}
+	return ast.WalkContinue, nil
+}
+
+// criticExtension adds CriticMarkup support to goldmark
+type criticExtension struct{}
+
+func (e *criticExtension) Extend(m goldmark.Markdown) {
+	// Ahead of strikethrough (~~) and raw HTML (<), which would take the delimiters
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(&criticParser{}, 150)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&criticRenderer{}, 500)))
+}
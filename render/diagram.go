@@ -0,0 +1,112 @@
+package render
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// DiagramRenderer converts the body of a fenced code block tagged lang (e.g.
+// "mermaid") to inline SVG. It returns false for languages it does not handle
+// or diagrams it cannot render, which are left as highlighted code.
+type DiagramRenderer func(lang string, source []byte) (svg []byte, ok bool)
+
+// KindDiagram is the AST node kind for fenced code blocks rendered as diagrams
+var KindDiagram = ast.NewNodeKind("Diagram")
+
+// DiagramNode is a fenced diagram block replaced by its rendered SVG
+type DiagramNode struct {
+	ast.BaseBlock
+	Lang string
+	SVG  []byte
+}
+
+func (n *DiagramNode) Kind() ast.NodeKind {
+	return KindDiagram
+}
+
+func (n *DiagramNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Lang": n.Lang}, nil)
+}
+
+// diagramTransformer swaps fenced code blocks the renderer accepts for diagram nodes
+type diagramTransformer struct {
+	render DiagramRenderer
+}
+
+// Transform implements parser.ASTTransformer
+func (t *diagramTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var blocks []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := n.(*ast.FencedCodeBlock); ok && entering && block.Info != nil {
+			blocks = append(blocks, block)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		lang := string(block.Language(source))
+		var body []byte
+		for i := 0; i < block.Lines().Len(); i++ {
+			line := block.Lines().At(i)
+			body = append(body, line.Value(source)...)
+		}
+		svg, ok := t.render(lang, body)
+		if !ok {
+			continue
+		}
+		diagram := &DiagramNode{Lang: lang, SVG: svg}
+		diagram.SetLines(block.Lines())
+		block.Parent().ReplaceChild(block.Parent(), block, diagram)
+	}
+}
+
+// diagramRenderer writes a diagram node's SVG inside a <div class="diagram">,
+// inline or, where raw HTML is escaped, as an <img> whose scripts can't run
+type diagramRenderer struct {
+	asImage bool
+}
+
+func (r *diagramRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindDiagram, r.render)
+}
+
+func (r *diagramRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*DiagramNode)
+
+	fmt.Fprintf(w, `<div class="diagram diagram-%s"`, util.EscapeHTML([]byte(n.Lang)))
+	if n.Attributes() != nil {
+		html.RenderAttributes(w, n, nil)
+	}
+	_, _ = w.WriteString(">\n")
+	if r.asImage {
+		fmt.Fprintf(w, `<img src="data:image/svg+xml;base64,%s" alt="%s diagram">`, base64.StdEncoding.EncodeToString(n.SVG), util.EscapeHTML([]byte(n.Lang)))
+	} else {
+		_, _ = w.Write(n.SVG)
+	}
+	_, _ = w.WriteString("\n</div>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// diagramExtension renders fenced diagram blocks through a DiagramRenderer
+type diagramExtension struct {
+	render  DiagramRenderer
+	asImage bool
+}
+
+func (e *diagramExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&diagramTransformer{render: e.render}, 500)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&diagramRenderer{asImage: e.asImage}, 500)))
+}
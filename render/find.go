@@ -0,0 +1,179 @@
+package render
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// findContext is how many bytes of text Match.Context shows on each side
+const findContext = 40
+
+// Match is a hit of Find, located both in the source and in the rendered page
+type Match struct {
+	Line       int    `json:"line"`       // 1-based source line
+	Column     int    `json:"column"`     // 1-based, in characters
+	Offset     int    `json:"offset"`     // Byte offset in the source
+	Length     int    `json:"length"`     // Source bytes covered, including markup inside the match
+	Block      string `json:"block"`      // Kind of the enclosing block, e.g. "Paragraph"
+	BlockLine  int    `json:"block_line"` // First line of that block, its SourceLineAttribute
+	Anchor     string `json:"anchor"`     // ID of the heading whose section holds the match, "" before the first
+	Occurrence int    `json:"occurrence"` // 0-based index among the matches in that section
+	Context    string `json:"context"`    // The block's text around the match
+}
+
+// Find parses source with md and returns the case-insensitive matches of query
+// in the text a reader sees: paragraphs, headings, table cells and code. Link
+// targets, raw HTML and images are skipped, and matches never span blocks.
+// Pass a renderer without typographic replacements so that the text is the
+// source as typed.
+func Find(md goldmark.Markdown, source []byte, query string) []Match {
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+	pattern := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+	doc := md.Parser().Parse(text.NewReader(source))
+	starts := lineStarts(source)
+
+	matches := []Match{}
+	anchor, occurrence := "", 0
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Type() != ast.TypeBlock || n.Kind() == ast.KindDocument {
+			return ast.WalkContinue, nil
+		}
+		if n.Kind() == ast.KindHTMLBlock {
+			return ast.WalkSkipChildren, nil
+		}
+		if h, ok := n.(*ast.Heading); ok {
+			anchor, occurrence = "", 0
+			if id, ok := h.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					anchor = string(b)
+				}
+			}
+		}
+
+		t, leaf := leafText(n, source)
+		if !leaf {
+			return ast.WalkContinue, nil
+		}
+		blockStartOffset, _ := blockStart(n)
+		for _, loc := range pattern.FindAllIndex(t.buf, -1) {
+			start, end := t.sourceOffset(loc[0]), t.sourceOffset(loc[1]-1)+1
+			line := sort.Search(len(starts), func(i int) bool { return starts[i] > start })
+			matches = append(matches, Match{
+				Line:       line,
+				Column:     utf8.RuneCount(source[starts[line-1]:start]) + 1,
+				Offset:     start,
+				Length:     end - start,
+				Block:      n.Kind().String(),
+				BlockLine:  sort.Search(len(starts), func(i int) bool { return starts[i] > blockStartOffset }),
+				Anchor:     anchor,
+				Occurrence: occurrence,
+				Context:    t.context(loc[0], loc[1]),
+			})
+			occurrence++
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return matches
+}
+
+// searchText is the visible text of a block with a map back to the source
+type searchText struct {
+	buf    []byte
+	pieces []textPiece // Runs of buf copied from the source, in order
+}
+
+// textPiece maps buf[buf:buf+n] to source[src:src+n]
+type textPiece struct {
+	buf, src, n int
+}
+
+// leafText returns the text of a block holding text itself (inlines or code
+// lines); false for containers such as lists and blockquotes
+func leafText(n ast.Node, source []byte) (*searchText, bool) {
+	t := &searchText{}
+	switch {
+	case n.Kind() == ast.KindFencedCodeBlock || n.Kind() == ast.KindCodeBlock:
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			t.add(source, lines.At(i).Start, lines.At(i).Stop)
+		}
+	case n.FirstChild() != nil && n.FirstChild().Type() == ast.TypeInline:
+		t.addInlines(n, source)
+	default:
+		return nil, false
+	}
+	return t, true
+}
+
+// add appends source[start:stop]
+func (t *searchText) add(source []byte, start, stop int) {
+	if stop <= start {
+		return
+	}
+	t.pieces = append(t.pieces, textPiece{buf: len(t.buf), src: start, n: stop - start})
+	t.buf = append(t.buf, source[start:stop]...)
+}
+
+// gap appends a separator no match can cross, for content that is not text
+func (t *searchText) gap() {
+	t.buf = append(t.buf, 0)
+}
+
+// addInlines appends the text below n: text nodes, with line breaks as spaces,
+// through emphasis, links and code spans
+func (t *searchText) addInlines(n ast.Node, source []byte) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			t.add(source, c.Segment.Start, c.Segment.Stop)
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				t.pieces = append(t.pieces, textPiece{buf: len(t.buf), src: c.Segment.Stop, n: 1})
+				t.buf = append(t.buf, ' ')
+			}
+		case *ast.RawHTML, *ast.Image:
+			t.gap()
+		default:
+			if c.FirstChild() == nil {
+				t.gap() // Autolinks, wiki links, tags: text not at a source position
+				continue
+			}
+			t.addInlines(c, source)
+		}
+	}
+}
+
+// sourceOffset maps an offset in buf to the source
+func (t *searchText) sourceOffset(pos int) int {
+	i := sort.Search(len(t.pieces), func(i int) bool { return t.pieces[i].buf+t.pieces[i].n > pos })
+	if i == len(t.pieces) {
+		return t.pieces[len(t.pieces)-1].src + t.pieces[len(t.pieces)-1].n
+	}
+	return t.pieces[i].src + max(0, pos-t.pieces[i].buf)
+}
+
+// context returns the text around buf[start:end] on one line
+func (t *searchText) context(start, end int) string {
+	from, to := max(0, start-findContext), min(len(t.buf), end+findContext)
+	for from > 0 && !utf8.RuneStart(t.buf[from]) {
+		from--
+	}
+	for to < len(t.buf) && !utf8.RuneStart(t.buf[to]) {
+		to++
+	}
+	snippet := bytes.Map(func(r rune) rune {
+		if r == 0 || r == '\n' || r == '\r' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, t.buf[from:to])
+	return strings.Join(strings.Fields(string(snippet)), " ")
+}
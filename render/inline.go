@@ -0,0 +1,133 @@
+package render
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// fragmentFont is the font stack of pasted fragments (GitHub's)
+const fragmentFont = `-apple-system, BlinkMacSystemFont, "Segoe UI", "Noto Sans", Helvetica, Arial, sans-serif`
+
+// monoFont is the font stack of code in pasted fragments
+const monoFont = `ui-monospace, SFMono-Regular, "SF Mono", Menlo, Consolas, "Liberation Mono", monospace`
+
+// inlineStyles are the GitHub light theme's rules for the elements markdown
+// produces, written into style attributes because mail clients and editors
+// drop stylesheets when HTML is pasted into them
+var inlineStyles = map[string]string{
+	"h1":         "font-size: 2em; font-weight: 600; margin: 24px 0 16px; padding-bottom: .3em; border-bottom: 1px solid #d1d9e0",
+	"h2":         "font-size: 1.5em; font-weight: 600; margin: 24px 0 16px; padding-bottom: .3em; border-bottom: 1px solid #d1d9e0",
+	"h3":         "font-size: 1.25em; font-weight: 600; margin: 24px 0 16px",
+	"h4":         "font-size: 1em; font-weight: 600; margin: 24px 0 16px",
+	"h5":         "font-size: .875em; font-weight: 600; margin: 24px 0 16px",
+	"h6":         "font-size: .85em; font-weight: 600; margin: 24px 0 16px; color: #59636e",
+	"p":          "margin: 0 0 16px",
+	"a":          "color: #0969da; text-decoration: underline",
+	"blockquote": "margin: 0 0 16px; padding: 0 1em; color: #59636e; border-left: .25em solid #d1d9e0",
+	"ul":         "margin: 0 0 16px; padding-left: 2em",
+	"ol":         "margin: 0 0 16px; padding-left: 2em",
+	"li":         "margin: .25em 0",
+	"table":      "border-collapse: collapse; margin: 0 0 16px",
+	"th":         "padding: 6px 13px; border: 1px solid #d1d9e0; font-weight: 600; background-color: #f6f8fa",
+	"td":         "padding: 6px 13px; border: 1px solid #d1d9e0",
+	"img":        "max-width: 100%",
+	"hr":         "height: .25em; padding: 0; margin: 24px 0; background-color: #d1d9e0; border: 0",
+	"pre":        "font-family: " + monoFont + "; font-size: 85%; line-height: 1.45; background-color: #f6f8fa; padding: 16px; border-radius: 6px; overflow: auto; margin: 0 0 16px",
+	"code":       "font-family: " + monoFont + "; font-size: 85%; background-color: #eff1f3; padding: .2em .4em; border-radius: 6px",
+}
+
+// codeBlockStyle replaces the inline code style inside <pre>
+const codeBlockStyle = "font-family: " + monoFont + "; background-color: transparent; padding: 0"
+
+// InlineStyles rewrites rendered markdown for pasting into email, wikis and
+// word processors: every element gets its styles in a style attribute (before
+// any it already has, such as inline syntax highlighting), task list
+// checkboxes become ☐ and ☑, and the whole is wrapped in a styled <div>
+func InlineStyles(fragment string) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<div style="font-family: ` + html.EscapeString(fragmentFont) + `; font-size: 16px; line-height: 1.5; color: #1f2328">`)
+
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	preDepth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return "", err
+			}
+			break
+		}
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.Data == "input" && attr(tok, "type") == "checkbox" {
+				buf.WriteString(checkboxText(tok))
+				continue
+			}
+			if tok.Data == "pre" && tt == html.StartTagToken {
+				preDepth++
+			}
+			style := inlineStyles[tok.Data]
+			if tok.Data == "code" && preDepth > 0 {
+				style = codeBlockStyle
+			}
+			if style != "" {
+				setStyle(&tok, style)
+			}
+			buf.WriteString(tok.String())
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "pre" && preDepth > 0 {
+				preDepth--
+			}
+			buf.Write(z.Raw())
+		default:
+			buf.Write(z.Raw())
+		}
+	}
+
+	buf.WriteString(`</div>`)
+	return buf.String(), nil
+}
+
+// attr returns the value of a token's attribute ("" if absent)
+func attr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr reports whether a token has an attribute
+func hasAttr(tok html.Token, key string) bool {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// checkboxText is the character standing in for a task list checkbox
+func checkboxText(tok html.Token) string {
+	if hasAttr(tok, "checked") {
+		return "☑"
+	}
+	return "☐"
+}
+
+// setStyle puts style before the token's own style attribute, which keeps
+// precedence
+func setStyle(tok *html.Token, style string) {
+	for i, a := range tok.Attr {
+		if a.Key == "style" {
+			tok.Attr[i].Val = style + "; " + a.Val
+			return
+		}
+	}
+	tok.Attr = append(tok.Attr, html.Attribute{Key: "style", Val: style})
+}
@@ -0,0 +1,332 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// EmbedResolver returns the HTML for an Obsidian ![[Target]] embed (a note,
+// a note section or an image). It returns false for targets it cannot embed.
+type EmbedResolver func(target string) (html []byte, ok bool)
+
+// calloutPattern matches the first line of a callout: [!type], an optional
+// fold marker (+ open, - closed) and an optional title
+var calloutPattern = regexp.MustCompile(`^\[!([A-Za-z][\w-]*)\]([+-]?)[ \t]*(.*)$`)
+
+// KindEmbed is the AST node kind for ![[Target]] embeds
+var KindEmbed = ast.NewNodeKind("Embed")
+
+// EmbedNode is an inline ![[Target]] embed
+type EmbedNode struct {
+	ast.BaseInline
+	Target string // Note or file name, optionally with #heading and |size
+}
+
+func (n *EmbedNode) Kind() ast.NodeKind {
+	return KindEmbed
+}
+
+func (n *EmbedNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.Target}, nil)
+}
+
+// KindEmbedBlock is the AST node kind for an embed alone in its paragraph
+var KindEmbedBlock = ast.NewNodeKind("EmbedBlock")
+
+// EmbedBlockNode is an embed that replaced its paragraph, so embedded notes
+// are not nested in a <p>
+type EmbedBlockNode struct {
+	ast.BaseBlock
+	Target string
+}
+
+func (n *EmbedBlockNode) Kind() ast.NodeKind {
+	return KindEmbedBlock
+}
+
+func (n *EmbedBlockNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.Target}, nil)
+}
+
+// KindCallout is the AST node kind for > [!type] callouts
+var KindCallout = ast.NewNodeKind("Callout")
+
+// CalloutNode is a blockquote starting with [!type], rendered as a callout box
+type CalloutNode struct {
+	ast.BaseBlock
+	CalloutType string // Lower-case callout type (note, tip, warning, ...)
+	Title       string // Plain-text title (defaults to the capitalized type)
+	Fold        string // "+" (foldable, open), "-" (foldable, closed) or ""
+}
+
+func (n *CalloutNode) Kind() ast.NodeKind {
+	return KindCallout
+}
+
+func (n *CalloutNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"CalloutType": n.CalloutType, "Title": n.Title, "Fold": n.Fold}, nil)
+}
+
+// KindTag is the AST node kind for #tags
+var KindTag = ast.NewNodeKind("Tag")
+
+// TagNode is an inline #tag (letters, digits, _, - and / for nesting; not all digits)
+type TagNode struct {
+	ast.BaseInline
+	Tag string // Without the leading #
+}
+
+func (n *TagNode) Kind() ast.NodeKind {
+	return KindTag
+}
+
+func (n *TagNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Tag": n.Tag}, nil)
+}
+
+// embedParser parses ![[...]] before the image parser sees the brackets
+type embedParser struct{}
+
+func (p *embedParser) Trigger() []byte {
+	return []byte{'!'}
+}
+
+func (p *embedParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if len(line) < 6 || line[1] != '[' || line[2] != '[' {
+		return nil
+	}
+	end := bytes.Index(line[3:], []byte("]]"))
+	if end <= 0 {
+		return nil
+	}
+	target := strings.TrimSpace(string(line[3 : 3+end]))
+	if target == "" || strings.ContainsAny(target, "[]\n") {
+		return nil
+	}
+	block.Advance(end + 5)
+	return &EmbedNode{Target: target}
+}
+
+// tagParser parses #tags that start a word
+type tagParser struct{}
+
+func (p *tagParser) Trigger() []byte {
+	return []byte{'#'}
+}
+
+func (p *tagParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if prev := block.PrecendingCharacter(); !unicode.IsSpace(prev) && prev != '(' {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	end, digitsOnly := 1, true
+	for end < len(line) {
+		r, size := utf8.DecodeRune(line[end:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '/' {
+			break
+		}
+		digitsOnly = digitsOnly && unicode.IsDigit(r)
+		end += size
+	}
+	if end == 1 || digitsOnly {
+		return nil // Bare # or an issue number such as #123
+	}
+	block.Advance(end)
+	return &TagNode{Tag: string(line[1:end])}
+}
+
+// obsidianTransformer lifts lone embeds out of their paragraphs and turns
+// [!type] blockquotes into callouts
+type obsidianTransformer struct {
+	callouts bool
+}
+
+// Transform implements parser.ASTTransformer
+func (t *obsidianTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var paragraphs, quotes []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			switch n.Kind() {
+			case ast.KindParagraph:
+				paragraphs = append(paragraphs, n)
+			case ast.KindBlockquote:
+				quotes = append(quotes, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, p := range paragraphs {
+		if embed := loneEmbed(p, source); embed != nil {
+			block := &EmbedBlockNode{Target: embed.Target}
+			block.SetLines(p.Lines())
+			p.Parent().ReplaceChild(p.Parent(), p, block)
+		}
+	}
+	if t.callouts {
+		for _, q := range quotes {
+			toCallout(q, source)
+		}
+	}
+}
+
+// loneEmbed returns the embed that is a paragraph's only content
+func loneEmbed(p ast.Node, source []byte) *EmbedNode {
+	var embed *EmbedNode
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		switch n := c.(type) {
+		case *EmbedNode:
+			if embed != nil {
+				return nil
+			}
+			embed = n
+		case *ast.Text:
+			if len(bytes.TrimSpace(n.Segment.Value(source))) > 0 {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	return embed
+}
+
+// toCallout replaces a blockquote whose first line is [!type] with a callout
+func toCallout(quote ast.Node, source []byte) {
+	first, ok := quote.FirstChild().(*ast.Paragraph)
+	if !ok || first.Lines().Len() == 0 {
+		return
+	}
+	firstLine := first.Lines().At(0)
+	m := calloutPattern.FindSubmatch(bytes.TrimRight(firstLine.Value(source), " \t\r\n"))
+	if m == nil {
+		return
+	}
+
+	callout := &CalloutNode{CalloutType: strings.ToLower(string(m[1])), Title: string(m[3]), Fold: string(m[2])}
+	if callout.Title == "" {
+		callout.Title = strings.ToUpper(callout.CalloutType[:1]) + callout.CalloutType[1:]
+	}
+	callout.SetLines(quote.Lines())
+
+	// Drop the [!type] line from the first paragraph, and the paragraph if that was all
+	for c := first.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		first.RemoveChild(first, c)
+		if t, ok := c.(*ast.Text); ok && (t.SoftLineBreak() || t.HardLineBreak()) {
+			break
+		}
+		c = next
+	}
+	if first.ChildCount() == 0 {
+		quote.RemoveChild(quote, first)
+	}
+
+	for c := quote.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		callout.AppendChild(callout, c)
+		c = next
+	}
+	quote.Parent().ReplaceChild(quote.Parent(), quote, callout)
+}
+
+// obsidianRenderer renders embeds, callouts and tags
+type obsidianRenderer struct {
+	resolve EmbedResolver
+}
+
+func (r *obsidianRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindEmbed, r.renderEmbed)
+	reg.Register(KindEmbedBlock, r.renderEmbed)
+	reg.Register(KindCallout, r.renderCallout)
+	reg.Register(KindTag, r.renderTag)
+}
+
+func (r *obsidianRenderer) renderEmbed(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var target string
+	switch n := node.(type) {
+	case *EmbedNode:
+		target = n.Target
+	case *EmbedBlockNode:
+		target = n.Target
+	}
+
+	if r.resolve != nil {
+		if html, ok := r.resolve(target); ok {
+			_, _ = w.Write(html)
+			return ast.WalkSkipChildren, nil
+		}
+	}
+	escaped := util.EscapeHTML([]byte(target))
+	fmt.Fprintf(w, `<span class="embed-missing" title="Cannot embed %s">%s</span>`, escaped, escaped)
+	if node.Type() == ast.TypeBlock {
+		_ = w.WriteByte('\n')
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *obsidianRenderer) renderCallout(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*CalloutNode)
+	tag, titleTag := "div", "div"
+	if n.Fold != "" {
+		tag, titleTag = "details", "summary"
+	}
+	if !entering {
+		fmt.Fprintf(w, "</div>\n</%s>\n", tag)
+		return ast.WalkContinue, nil
+	}
+
+	fmt.Fprintf(w, `<%s class="callout" data-callout="%s"`, tag, util.EscapeHTML([]byte(n.CalloutType)))
+	if n.Fold == "+" {
+		_, _ = w.WriteString(" open")
+	}
+	fmt.Fprintf(w, ">\n<%s class=\"callout-title\">%s</%s>\n<div class=\"callout-content\">\n", titleTag, util.EscapeHTML([]byte(n.Title)), titleTag)
+	return ast.WalkContinue, nil
+}
+
+func (r *obsidianRenderer) renderTag(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	tag := util.EscapeHTML([]byte(node.(*TagNode).Tag))
+	fmt.Fprintf(w, `<span class="tag" data-tag="%s">#%s</span>`, tag, tag)
+	return ast.WalkSkipChildren, nil
+}
+
+// obsidianExtension adds Obsidian's embeds, callouts and tags to goldmark
+type obsidianExtension struct {
+	embeds   EmbedResolver
+	callouts bool
+	tags     bool
+}
+
+func (e *obsidianExtension) Extend(m goldmark.Markdown) {
+	var inlineParsers []util.PrioritizedValue
+	if e.embeds != nil {
+		inlineParsers = append(inlineParsers, util.Prioritized(&embedParser{}, 198))
+	}
+	if e.tags {
+		inlineParsers = append(inlineParsers, util.Prioritized(&tagParser{}, 500))
+	}
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(inlineParsers...),
+		parser.WithASTTransformers(util.Prioritized(&obsidianTransformer{callouts: e.callouts}, 400)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&obsidianRenderer{resolve: e.embeds}, 500)))
+}
@@ -0,0 +1,57 @@
+package render
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// permalinkIcon is GitHub's octicon-link icon
+const permalinkIcon = `<svg class="octicon octicon-link" viewBox="0 0 16 16" width="16" height="16" aria-hidden="true"><path fill-rule="evenodd" d="M7.775 3.275a.75.75 0 001.06 1.06l1.25-1.25a2 2 0 112.83 2.83l-2.5 2.5a2 2 0 01-2.83 0 .75.75 0 00-1.06 1.06 3.5 3.5 0 004.95 0l2.5-2.5a3.5 3.5 0 00-4.95-4.95l-1.25 1.25zm-4.69 9.64a2 2 0 010-2.83l2.5-2.5a2 2 0 012.83 0 .75.75 0 001.06-1.06 3.5 3.5 0 00-4.95 0l-2.5 2.5a3.5 3.5 0 004.95 4.95l1.25-1.25a.75.75 0 00-1.06-1.06l-1.25 1.25a2 2 0 01-2.83 0z"></path></svg>`
+
+// permalinkRenderer renders headings like GitHub: wrapped in a
+// <div class="markdown-heading"> with an <a class="anchor"> permalink after
+// headings that have an id
+type permalinkRenderer struct{}
+
+func (r *permalinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHeading, r.renderHeading)
+}
+
+func (r *permalinkRenderer) renderHeading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.Heading)
+	level := "0123456"[n.Level]
+	if entering {
+		_, _ = w.WriteString(`<div class="markdown-heading"><h`)
+		_ = w.WriteByte(level)
+		if n.Attributes() != nil {
+			html.RenderAttributes(w, node, html.HeadingAttributeFilter)
+		}
+		_ = w.WriteByte('>')
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString("</h")
+	_ = w.WriteByte(level)
+	_ = w.WriteByte('>')
+	if id, ok := n.AttributeString("id"); ok {
+		if b, ok := id.([]byte); ok && len(b) > 0 {
+			_, _ = w.WriteString(`<a class="anchor" aria-label="Permalink: `)
+			_, _ = w.Write(util.EscapeHTML([]byte(plainText(n, source))))
+			_, _ = w.WriteString(`" href="#`)
+			_, _ = w.Write(util.EscapeHTML(b))
+			_, _ = w.WriteString(`">` + permalinkIcon + `</a>`)
+		}
+	}
+	_, _ = w.WriteString("</div>\n")
+	return ast.WalkContinue, nil
+}
+
+// permalinkExtension adds heading permalinks to goldmark
+type permalinkExtension struct{}
+
+func (e *permalinkExtension) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&permalinkRenderer{}, 500)))
+}
@@ -0,0 +1,269 @@
+// Package render provides peekm's goldmark configuration: GitHub Flavored
+// Markdown, typographic punctuation, class-based syntax highlighting, auto
+// heading IDs with permalinks, optional [[Page]] wiki links, optional server-rendered diagrams
+// and optional source line attributes. The zero Options are peekm's default
+// rendering; the remaining fields switch individual goldmark features.
+package render
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Options configures New
+type Options struct {
+	// WikiLinks enables [[Page]] links when non-nil
+	WikiLinks WikiLinkResolver
+	// PageURL builds the href for a resolved wiki page (defaults to /view/<path>)
+	PageURL func(relPath string) string
+	// Diagrams renders fenced diagram blocks (mermaid, plantuml, ...) to inline
+	// SVG when non-nil. With EscapeHTML the SVG is an <img> data URI instead.
+	Diagrams DiagramRenderer
+	// Embeds enables Obsidian ![[Target]] embeds when non-nil
+	Embeds EmbedResolver
+	// Callouts renders blockquotes starting with [!type] as callout boxes
+	Callouts bool
+	// Tags renders #tags as tag labels
+	Tags bool
+	// CriticMarkup renders {++additions++}, {--deletions--},
+	// {~~substitutions~>with this~~}, {==highlights==} and {>>comments<<}
+	// as <ins>, <del>, <mark> and comment elements with class "critic"
+	CriticMarkup bool
+	// SourceLines adds SourceLineAttribute to block elements (for editor sync)
+	SourceLines bool
+
+	// NoTypographer keeps straight quotes, "--" and "..." as typed
+	NoTypographer bool
+	// NoHeadingIDs leaves headings without generated id attributes
+	NoHeadingIDs bool
+	// NoPermalinks leaves headings without the # permalink shown on hover
+	NoPermalinks bool
+	// HardWraps renders every newline inside a paragraph as <br>
+	HardWraps bool
+	// EscapeHTML escapes raw HTML in the markdown instead of passing it through
+	EscapeHTML bool
+	// LinkifySchemes limits bare URL autolinking to these schemes (e.g. "https",
+	// "mailto"); nil keeps goldmark's default (http, https and ftp) and an empty
+	// slice turns it off. "www." links follow the same on/off switch.
+	LinkifySchemes []string
+	// EastAsianLineBreaks turns on goldmark's CJK options: soft line breaks
+	// next to East Asian wide characters are dropped instead of rendered as
+	// spaces, and a backslash-escaped space ("**強調**\ です") closes emphasis
+	// without leaving a space in the output
+	EastAsianLineBreaks bool
+	// InlineHighlighting writes syntax highlighting colors into style
+	// attributes instead of classes, for HTML used without peekm's stylesheet
+	InlineHighlighting bool
+}
+
+// New creates a configured goldmark renderer
+func New(opts Options) goldmark.Markdown {
+	var parserOptions []parser.Option
+	if !opts.NoHeadingIDs {
+		parserOptions = append(parserOptions, parser.WithAutoHeadingID())
+	}
+
+	var rendererOptions []renderer.Option
+	if !opts.EscapeHTML {
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
+	if opts.HardWraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+
+	return goldmark.New(
+		goldmark.WithExtensions(extensions(opts)...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+}
+
+// extensions returns the goldmark extensions enabled by opts
+func extensions(opts Options) []goldmark.Extender {
+	// GFM without its linkify, which is configured separately below
+	extensions := []goldmark.Extender{
+		extension.Table,
+		extension.Strikethrough,
+		extension.TaskList,
+		highlighting.NewHighlighting(
+			highlighting.WithFormatOptions(
+				chromahtml.WithClasses(!opts.InlineHighlighting),
+			),
+		),
+	}
+	if opts.LinkifySchemes == nil {
+		extensions = append(extensions, extension.Linkify)
+	} else if len(opts.LinkifySchemes) > 0 {
+		protocols := make([]string, len(opts.LinkifySchemes))
+		for i, scheme := range opts.LinkifySchemes {
+			protocols[i] = strings.TrimSuffix(scheme, ":") + ":"
+		}
+		extensions = append(extensions, extension.NewLinkify(extension.WithLinkifyAllowedProtocols(protocols)))
+	}
+	if !opts.NoTypographer {
+		extensions = append(extensions, extension.Typographer)
+	}
+	if opts.EastAsianLineBreaks {
+		extensions = append(extensions, extension.NewCJK(
+			extension.WithEastAsianLineBreaks(extension.EastAsianLineBreaksCSS3Draft),
+			extension.WithEscapedSpace(),
+		))
+	}
+
+	if !opts.NoPermalinks {
+		extensions = append(extensions, &permalinkExtension{})
+	}
+
+	if opts.WikiLinks != nil {
+		pageURL := opts.PageURL
+		if pageURL == nil {
+			pageURL = defaultPageURL
+		}
+		extensions = append(extensions, &wikiLinkExtension{resolve: opts.WikiLinks, pageURL: pageURL})
+	}
+
+	if opts.Diagrams != nil {
+		extensions = append(extensions, &diagramExtension{render: opts.Diagrams, asImage: opts.EscapeHTML})
+	}
+
+	if opts.Embeds != nil || opts.Callouts || opts.Tags {
+		extensions = append(extensions, &obsidianExtension{embeds: opts.Embeds, callouts: opts.Callouts, tags: opts.Tags})
+	}
+
+	if opts.CriticMarkup {
+		extensions = append(extensions, &criticExtension{})
+	}
+
+	if opts.SourceLines {
+		extensions = append(extensions, &sourceLineExtension{})
+	}
+	return extensions
+}
+
+// ToHTML converts markdown to an HTML fragment
+func ToHTML(md goldmark.Markdown, source []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert(source, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Heading is a document heading with its generated anchor ID
+type Heading struct {
+	Level int
+	Text  string
+	ID    string
+	Line  int // 1-based source line it starts on
+}
+
+// Headings parses source with md and returns its headings in document order
+func Headings(md goldmark.Markdown, source []byte) []Heading {
+	doc := md.Parser().Parse(text.NewReader(source))
+	starts := lineStarts(source)
+
+	var headings []Heading
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		h := Heading{Level: heading.Level, Text: plainText(heading, source)}
+		if offset, ok := blockStart(heading); ok {
+			h.Line = sort.Search(len(starts), func(i int) bool { return starts[i] > offset })
+		}
+		if id, found := heading.AttributeString("id"); found {
+			if b, ok := id.([]byte); ok {
+				h.ID = string(b)
+			}
+		}
+		headings = append(headings, h)
+		return ast.WalkSkipChildren, nil
+	})
+	return headings
+}
+
+// htmlSrcPattern finds the src attribute of media elements in raw HTML
+var htmlSrcPattern = regexp.MustCompile(`(?i)<(?:img|source|video|audio)\b[^>]*?\bsrc\s*=\s*["']([^"']+)["']`)
+
+// Destinations parses source with md and returns the destinations of its
+// links and images, and the src of <img>, <source>, <video> and <audio> tags
+// in raw HTML, in document order without duplicates
+func Destinations(md goldmark.Markdown, source []byte) []string {
+	doc := md.Parser().Parse(text.NewReader(source))
+
+	var dests []string
+	seen := make(map[string]bool)
+	add := func(dest string) {
+		if dest != "" && !seen[dest] {
+			seen[dest] = true
+			dests = append(dests, dest)
+		}
+	}
+	addHTML := func(raw []byte) {
+		for _, m := range htmlSrcPattern.FindAllSubmatch(raw, -1) {
+			add(string(m[1]))
+		}
+	}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			add(string(n.Destination))
+		case *ast.Image:
+			add(string(n.Destination))
+		case *ast.RawHTML:
+			var raw bytes.Buffer
+			for i := 0; i < n.Segments.Len(); i++ {
+				segment := n.Segments.At(i)
+				raw.Write(segment.Value(source))
+			}
+			addHTML(raw.Bytes())
+		case *ast.HTMLBlock:
+			lines := n.Lines()
+			var raw bytes.Buffer
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				raw.Write(segment.Value(source))
+			}
+			addHTML(raw.Bytes())
+		}
+		return ast.WalkContinue, nil
+	})
+	return dests
+}
+
+// plainText concatenates the text segments below n
+func plainText(n ast.Node, source []byte) string {
+	var buf bytes.Buffer
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := c.(type) {
+		case *ast.Text:
+			buf.Write(t.Segment.Value(source))
+			if t.SoftLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(t.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
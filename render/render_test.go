@@ -0,0 +1,391 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestHeadings tests heading extraction with goldmark's auto heading IDs
+func TestHeadings(t *testing.T) {
+	source := []byte("# Install peekm\n\nText\n\n## Use `go install`\n\n## Install peekm\n")
+
+	got := Headings(New(Options{}), source)
+	want := []Heading{
+		{Level: 1, Text: "Install peekm", ID: "install-peekm", Line: 1},
+		{Level: 2, Text: "Use go install", ID: "use-go-install", Line: 5},
+		{Level: 2, Text: "Install peekm", ID: "install-peekm-1", Line: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Headings() = %+v, want %+v", got, want)
+	}
+}
+
+// TestDestinations tests link, image and raw HTML media destinations
+func TestDestinations(t *testing.T) {
+	source := []byte("![Logo](img/logo.png) and [spec](docs/spec.pdf#p2)\n\n" +
+		"[again][ref] ![logo](img/logo.png)\n\n" +
+		"Inline <img src=\"img/inline.svg\" alt=\"x\">\n\n" +
+		"<video controls>\n  <source src='media/demo.mp4'>\n</video>\n\n" +
+		"`![code](not/this.png)`\n\n[ref]: https://example.com\n")
+
+	got := Destinations(New(Options{}), source)
+	want := []string{"img/logo.png", "docs/spec.pdf#p2", "https://example.com", "img/inline.svg", "media/demo.mp4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Destinations() = %q, want %q", got, want)
+	}
+}
+
+// TestInlineStyles tests the pasteable fragment: inline styles, code blocks and task lists
+func TestInlineStyles(t *testing.T) {
+	md := New(Options{NoPermalinks: true, InlineHighlighting: true})
+	rendered, err := ToHTML(md, []byte("# Title\n\nSee `code`.\n\n```go\nx := 1\n```\n\n- [x] done\n- [ ] todo\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := InlineStyles(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`<div style="font-family: -apple-system,`,
+		`<h1 id="title" style="font-size: 2em;`,
+		`<code style="font-family: ui-monospace,`,
+		` style="font-family: ui-monospace, SFMono-Regular, &#34;SF Mono&#34;, Menlo, Consolas, &#34;Liberation Mono&#34;, monospace; font-size: 85%; line-height: 1.45;`, // The pre's, after any chroma attributes
+		`background-color: transparent; padding: 0">`,
+		"<li style=\"margin: .25em 0\">☑ done</li>",
+		"☐ todo",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("InlineStyles() = %s\nmissing %s", got, want)
+		}
+	}
+	if strings.Contains(got, "class=\"chroma\"") || strings.Contains(got, "<input") {
+		t.Errorf("InlineStyles() kept classes or checkboxes: %s", got)
+	}
+}
+
+// TestSourceLines tests data-source-line attributes on block elements
+func TestSourceLines(t *testing.T) {
+	source := []byte("# Title\n\nFirst paragraph\ncontinues\n\n- one\n- two\n\n> quoted\n")
+
+	got, err := ToHTML(New(Options{SourceLines: true}), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<h1 id="title" data-source-line="1">`,
+		`<p data-source-line="3">First paragraph`,
+		`<ul data-source-line="6">`,
+		`<li data-source-line="7">two</li>`,
+		`<blockquote data-source-line="9">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+
+	plain, err := ToHTML(New(Options{}), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain, SourceLineAttribute) {
+		t.Errorf("source lines rendered without the option:\n%s", plain)
+	}
+}
+
+// TestDiagrams tests that accepted diagram blocks become SVG and others stay code
+func TestDiagrams(t *testing.T) {
+	source := []byte("Intro\n\n```mermaid\ngraph TD\n  A-->B\n```\n\n```mermaid\nbroken\n```\n\n```go\nx := 1\n```\n")
+
+	var calls []string
+	diagrams := func(lang string, body []byte) ([]byte, bool) {
+		calls = append(calls, lang+":"+string(body))
+		if lang != "mermaid" || string(body) == "broken\n" {
+			return nil, false
+		}
+		return []byte("<svg>ok</svg>"), true
+	}
+
+	got, err := ToHTML(New(Options{Diagrams: diagrams, SourceLines: true}), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"mermaid:graph TD\n  A-->B\n", "mermaid:broken\n", "go:x := 1\n"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("renderer calls = %q, want %q", calls, want)
+	}
+	for _, want := range []string{
+		`<div class="diagram diagram-mermaid" data-source-line="4">` + "\n<svg>ok</svg>\n</div>",
+		`<pre><code class="language-mermaid">broken`,
+		`class="chroma"><code><span class="line">`, // chroma may put tabindex before class
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+
+	// Without raw HTML, the SVG can't run scripts in the page either
+	got, err = ToHTML(New(Options{Diagrams: diagrams, EscapeHTML: true}), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<img src="data:image/svg+xml;base64,PHN2Zz5vazwvc3ZnPg==" alt="mermaid diagram">`; !strings.Contains(got, want) || strings.Contains(got, "<svg>") {
+		t.Errorf("escaped HTML diagram = %s, want %s", got, want)
+	}
+}
+
+// TestFeatureOptions tests the options that switch goldmark features
+func TestFeatureOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		source   string
+		contains string
+	}{
+		{"typographer", Options{}, `"quoted"`, "&ldquo;quoted&rdquo;"},
+		{"no typographer", Options{NoTypographer: true}, `"quoted"`, "&quot;quoted&quot;"},
+		{"heading ids", Options{}, "# Title", `<h1 id="title">`},
+		{"no heading ids", Options{NoHeadingIDs: true}, "# Title", "<h1>Title</h1>"},
+		{"soft wraps", Options{}, "one\ntwo", "<p>one\ntwo</p>"},
+		{"hard wraps", Options{HardWraps: true}, "one\ntwo", "<p>one<br>\ntwo</p>"},
+		{"raw html", Options{}, "<kbd>K</kbd>", "<kbd>K</kbd>"},
+		{"escaped html", Options{EscapeHTML: true}, "<kbd>K</kbd>", "<!-- raw HTML omitted -->"},
+		{"linkify", Options{}, "see https://example.com", `<a href="https://example.com">`},
+		{"linkify schemes", Options{LinkifySchemes: []string{"ftp"}}, "see https://example.com", "<p>see https://example.com</p>"},
+		{"linkify allowed scheme", Options{LinkifySchemes: []string{"https"}}, "see https://example.com", `<a href="https://example.com">`},
+		{"no linkify", Options{LinkifySchemes: []string{}}, "see www.example.com", "<p>see www.example.com</p>"},
+		{"east asian spaces", Options{}, "日本\n語", "<p>日本\n語</p>"},
+		{"east asian line breaks", Options{EastAsianLineBreaks: true}, "日本\n語", "<p>日本語</p>"},
+		{"east asian line break before latin", Options{EastAsianLineBreaks: true}, "これは\nMarkdown", "<p>これはMarkdown</p>"},
+		{"east asian escaped space", Options{EastAsianLineBreaks: true}, "**強調**\\ です", "<p><strong>強調</strong>です</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToHTML(New(tt.opts), []byte(tt.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.contains) {
+				t.Errorf("got %q, want it to contain %q", got, tt.contains)
+			}
+		})
+	}
+}
+
+// TestObsidian tests embeds, callouts and tags
+func TestObsidian(t *testing.T) {
+	embeds := func(target string) ([]byte, bool) {
+		if target != "Note" {
+			return nil, false
+		}
+		return []byte("<div>embedded</div>\n"), true
+	}
+	opts := Options{Embeds: embeds, Callouts: true, Tags: true}
+	tests := []struct {
+		name     string
+		opts     Options
+		source   string
+		contains string
+	}{
+		{"block embed", opts, "![[Note]]", "<div>embedded</div>\n"},
+		{"inline embed", opts, "see ![[Note]] here", "<p>see <div>embedded</div>\n here</p>"},
+		{"missing embed", opts, "![[Gone]]", `<span class="embed-missing" title="Cannot embed Gone">Gone</span>`},
+		{"image still works", opts, "![alt](a.png)", `<img src="a.png" alt="alt">`},
+		{"embeds off", Options{}, "![[Note]]", "<p>![[Note]]</p>"},
+		{"callout", opts, "> [!warning] Careful\n> Body text", "<div class=\"callout\" data-callout=\"warning\">\n<div class=\"callout-title\">Careful</div>\n<div class=\"callout-content\">\n<p>Body text</p>\n</div>\n</div>"},
+		{"callout body keeps inlines", opts, "> [!tip] See *this*\n> body #tag", "<p>body <span class=\"tag\" data-tag=\"tag\">#tag</span></p>"},
+		{"callout default title", opts, "> [!NOTE]\n> Body", `<div class="callout-title">Note</div>`},
+		{"foldable callout", opts, "> [!tip]+ More\n> Hidden", "<details class=\"callout\" data-callout=\"tip\" open>\n<summary class=\"callout-title\">More</summary>"},
+		{"collapsed callout", opts, "> [!tip]- More\n> Hidden", "<details class=\"callout\" data-callout=\"tip\">\n"},
+		{"plain blockquote", opts, "> quoted", "<blockquote>\n<p>quoted</p>\n</blockquote>"},
+		{"callouts off", Options{}, "> [!note]\n> Body", "<blockquote>"},
+		{"tag", opts, "tagged #project/alpha today", `tagged <span class="tag" data-tag="project/alpha">#project/alpha</span> today`},
+		{"tag at line start", opts, "#todo", `<span class="tag" data-tag="todo">#todo</span>`},
+		{"number is not a tag", opts, "issue #123", "<p>issue #123</p>"},
+		{"mid-word hash", opts, "a#b", "<p>a#b</p>"},
+		{"heading is not a tag", opts, "# Title", `<h1 id="title">Title</h1>`},
+		{"tags off", Options{}, "x #todo", "<p>x #todo</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToHTML(New(tt.opts), []byte(tt.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.contains) {
+				t.Errorf("got %q, want it to contain %q", got, tt.contains)
+			}
+		})
+	}
+}
+
+// TestCriticMarkup tests CriticMarkup spans and text that only looks like them
+func TestCriticMarkup(t *testing.T) {
+	opts := Options{CriticMarkup: true, NoTypographer: true}
+	tests := []struct {
+		name   string
+		opts   Options
+		source string
+		want   string
+	}{
+		{"addition", opts, "Ship {++on Monday++}.", `<p>Ship <ins class="critic">on Monday</ins>.</p>`},
+		{"deletion", opts, "Ship {--on Friday--}.", `<p>Ship <del class="critic">on Friday</del>.</p>`},
+		{"substitution", opts, "Ship {~~Friday~>Monday~~}.", `<p>Ship <del class="critic">Friday</del><ins class="critic">Monday</ins>.</p>`},
+		{"highlight and comment", opts, "{==Ship it==}{>>Who signs off?<<}", `<p><mark class="critic">Ship it</mark><span class="critic critic-comment" role="note">Who signs off?</span></p>`},
+		{"markdown inside", opts, "{++*really* [soon](s.md)++}", `<p><ins class="critic"><em>really</em> <a href="s.md">soon</a></ins></p>`},
+		{"two spans", opts, "{++a++} and {--b--}", `<p><ins class="critic">a</ins> and <del class="critic">b</del></p>`},
+		{"unclosed", opts, "{++ never closed", "<p>{++ never closed</p>"},
+		{"closer on another line", opts, "{++ a\nb ++}", "<p>{++ a\nb ++}</p>"},
+		{"substitution without ~> is strikethrough", opts, "{~~a~~}", "<p>{<del>a</del>}</p>"},
+		{"stray closer", opts, "a ++} b --}", "<p>a ++} b --}</p>"},
+		{"code span", opts, "`{++x++}`", "<p><code>{++x++}</code></p>"},
+		{"off", Options{NoTypographer: true}, "{++x++}", "<p>{++x++}</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToHTML(New(tt.opts), []byte(tt.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got = strings.TrimSpace(got); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPermalinks tests the GitHub-style heading permalink markup
+func TestPermalinks(t *testing.T) {
+	got, err := ToHTML(New(Options{}), []byte("## Setup & *Run*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStart := `<div class="markdown-heading"><h2 id="setup--run">Setup &amp; <em>Run</em></h2><a class="anchor" aria-label="Permalink: Setup &amp; Run" href="#setup--run"><svg class="octicon octicon-link"`
+	if !strings.HasPrefix(got, wantStart) || !strings.HasSuffix(got, "</svg></a></div>\n") {
+		t.Errorf("got %q, want it to start with %q", got, wantStart)
+	}
+
+	for _, opts := range []Options{{NoPermalinks: true}, {NoHeadingIDs: true}} {
+		got, err := ToHTML(New(opts), []byte("## Setup"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(got, `class="anchor"`) {
+			t.Errorf("%+v: got %q, want no permalink", opts, got)
+		}
+	}
+}
+
+// findSource is the document searched by the Find tests
+const findSource = "Intro mentions cache.\n\n# Cache Tuning\n\nThe **cache\nlayer** keeps [a cache](https://cache.example) — café cache.\n\n```go\ncache := 1\n```\n\n<div>cache</div>\n\n- item\n  ![cache](c.png)\n"
+
+// TestFind tests match positions, sections and what text is searched
+func TestFind(t *testing.T) {
+	source := []byte(findSource)
+	md := New(Options{NoTypographer: true})
+
+	got := Find(md, source, "CACHE")
+	want := []struct {
+		line, column, length int
+		block, anchor        string
+		occurrence           int
+	}{
+		{1, 16, 5, "Paragraph", "", 0},
+		{3, 3, 5, "Heading", "cache-tuning", 0},
+		{5, 7, 5, "Paragraph", "cache-tuning", 1},
+		{6, 18, 5, "Paragraph", "cache-tuning", 2},
+		{6, 55, 5, "Paragraph", "cache-tuning", 3},
+		{9, 1, 5, "FencedCodeBlock", "cache-tuning", 4},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Find() returned %d matches, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		m := got[i]
+		covered := string(source[m.Offset : m.Offset+m.Length])
+		if m.Line != w.line || m.Column != w.column || m.Length != w.length || m.Block != w.block || m.Anchor != w.anchor || m.Occurrence != w.occurrence || !strings.EqualFold(covered, "cache") {
+			t.Errorf("match %d = %+v covering %q, want %+v", i, m, covered, w)
+		}
+	}
+}
+
+// TestFindAcrossMarkup tests matches spanning inline markup and line breaks
+func TestFindAcrossMarkup(t *testing.T) {
+	source := []byte(findSource)
+	md := New(Options{NoTypographer: true})
+
+	// The match reports the source it covers, markup included
+	spanning := Find(md, source, "cache layer")
+	if len(spanning) != 1 || spanning[0].Line != 5 || string(source[spanning[0].Offset:spanning[0].Offset+spanning[0].Length]) != "cache\nlayer" {
+		t.Errorf("Find(cache layer) = %+v", spanning)
+	}
+	if spanning[0].BlockLine != 5 || spanning[0].Context != "The cache layer keeps a cache — café cache." {
+		t.Errorf("block line %d, context %q", spanning[0].BlockLine, spanning[0].Context)
+	}
+
+	if got := Find(md, source, "  "); got != nil {
+		t.Errorf("Find(blank) = %+v, want nil", got)
+	}
+}
+
+// TestBlocks tests cutting a render into its top-level elements
+func TestBlocks(t *testing.T) {
+	tests := []struct {
+		document string
+		want     []string // nil: can't be cut
+	}{
+		{"<h1 id=\"a\">A</h1>\n<p>One <em>two</em></p>\n", []string{"<h1 id=\"a\">A</h1>\n", "<p>One <em>two</em></p>\n"}},
+		{"<p>a<br>b</p>\n<hr>\n<img src=\"x.png\"/><ul>\n<li>c</li>\n</ul>\n", []string{"<p>a<br>b</p>\n", "<hr>\n", "<img src=\"x.png\"/>", "<ul>\n<li>c</li>\n</ul>\n"}},
+		{"<p>a</p>\n<!-- note -->\n<pre><code>&lt;/p&gt;</code></pre>\n", []string{"<p>a</p>\n<!-- note -->\n", "<pre><code>&lt;/p&gt;</code></pre>\n"}},
+		{"<script>if (a < b) { x = '</p>'; }</script><p>c</p>", []string{"<script>if (a < b) { x = '</p>'; }</script>", "<p>c</p>"}},
+		{"<p>a</p>\nloose text\n", nil},
+		{"<div>\n<p>unclosed\n", nil},
+		{"<p>a</p></div>", nil},
+		{"\n", nil},
+	}
+	for _, tt := range tests {
+		got, ok := Blocks(tt.document)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Blocks(%q) = %q, %v; want %q", tt.document, got, ok, tt.want)
+		}
+		if ok && strings.Join(got, "") != tt.document {
+			t.Errorf("Blocks(%q) joined = %q, want the document back", tt.document, strings.Join(got, ""))
+		}
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	source := []byte("# Guide\n" + // 0
+		"\n" +
+		"Intro with a note[^1] and a [link][docs].\n" + // 2
+		"\n" +
+		"## Setup 🚀\n" + // 4
+		"\n" +
+		"```go\n" + // 6
+		"[not]: a definition\n" +
+		"```\n" + // 8
+		"\n" +
+		"# Reference\n" + // 10
+		"\n" +
+		"[docs]: <https://example.com/docs> \"Docs\"\n" + // 12
+		"[^1]: A footnote\n" + // 13
+		"    continued.\n" +
+		"\n" +
+		"~~~\n" + // 16
+		"no language\n" +
+		"~~~\n")
+	got := Symbols(New(Options{}), source)
+	want := []Symbol{
+		{Kind: SymbolHeading, Name: "Guide", Detail: "guide", Level: 1, Range: Range{Position{0, 0}, Position{10, 0}}, SelectionRange: Range{Position{0, 0}, Position{0, 7}}},
+		{Kind: SymbolHeading, Name: "Setup 🚀", Detail: "setup-", Level: 2, Range: Range{Position{4, 0}, Position{10, 0}}, SelectionRange: Range{Position{4, 0}, Position{4, 11}}},
+		{Kind: SymbolCode, Name: "go", Range: Range{Position{6, 0}, Position{8, 3}}, SelectionRange: Range{Position{6, 0}, Position{6, 5}}},
+		{Kind: SymbolHeading, Name: "Reference", Detail: "reference", Level: 1, Range: Range{Position{10, 0}, Position{19, 0}}, SelectionRange: Range{Position{10, 0}, Position{10, 11}}},
+		{Kind: SymbolLinkDefinition, Name: "docs", Detail: "https://example.com/docs", Range: Range{Position{12, 0}, Position{12, 41}}, SelectionRange: Range{Position{12, 0}, Position{12, 41}}},
+		{Kind: SymbolFootnote, Name: "1", Detail: "A footnote", Range: Range{Position{13, 0}, Position{14, 14}}, SelectionRange: Range{Position{13, 0}, Position{13, 16}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Symbols() =\n%+v\nwant\n%+v", got, want)
+	}
+}
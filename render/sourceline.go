@@ -0,0 +1,72 @@
+package render
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// SourceLineAttribute is added to block elements when Options.SourceLines is
+// set; its value is the 1-based source line the block starts on
+const SourceLineAttribute = "data-source-line"
+
+// sourceLineExtension adds the source line transformer to the parser
+type sourceLineExtension struct{}
+
+// Extend implements goldmark.Extender
+func (e *sourceLineExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&sourceLineTransformer{}, 999)))
+}
+
+// sourceLineTransformer sets SourceLineAttribute on every block node whose
+// start position is known. goldmark's HTML renderer writes it for headings,
+// paragraphs, lists, list items, blockquotes, thematic breaks and tables.
+type sourceLineTransformer struct{}
+
+// Transform implements parser.ASTTransformer
+func (t *sourceLineTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	starts := lineStarts(reader.Source())
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Type() != ast.TypeBlock || n.Kind() == ast.KindDocument {
+			return ast.WalkContinue, nil
+		}
+		if offset, ok := blockStart(n); ok {
+			line := sort.Search(len(starts), func(i int) bool { return starts[i] > offset })
+			n.SetAttributeString(SourceLineAttribute, strconv.Itoa(line))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// lineStarts returns the byte offset of the start of every line in source
+func lineStarts(source []byte) []int {
+	starts := []int{0}
+	for i, b := range source {
+		if b == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// blockStart returns the source offset of a block: its first line, or for
+// containers (lists, blockquotes) the first line of its first descendant
+func blockStart(n ast.Node) (int, bool) {
+	if lines := n.Lines(); lines != nil && lines.Len() > 0 {
+		return lines.At(0).Start, true
+	}
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if c.Type() != ast.TypeBlock {
+			continue
+		}
+		if offset, ok := blockStart(c); ok {
+			return offset, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,234 @@
+package render
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Symbol kinds
+const (
+	SymbolHeading        = "heading"
+	SymbolLinkDefinition = "link_definition"
+	SymbolFootnote       = "footnote"
+	SymbolCode           = "code"
+)
+
+// Position is a place in the source as language servers count it: a 0-based
+// line and a 0-based character offset in UTF-16 code units
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is the source from Start up to, not including, End
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Symbol is an entry of a document's outline, like a language server's
+// document symbol
+type Symbol struct {
+	Kind           string `json:"kind"`             // One of the Symbol kinds
+	Name           string `json:"name"`             // Heading text, link or footnote label, or code language
+	Detail         string `json:"detail,omitempty"` // Heading anchor ID, link destination or footnote text
+	Level          int    `json:"level,omitempty"`  // Heading level
+	Range          Range  `json:"range"`            // The whole symbol: a heading's section, a definition, a code block with its fences
+	SelectionRange Range  `json:"selection_range"`  // What to reveal when the symbol is picked: a heading's line, else the first line
+}
+
+// definitionPattern matches a link reference or footnote definition line
+var definitionPattern = regexp.MustCompile(`^ {0,3}\[((?:[^\[\]\\]|\\.)+)\]:[ \t]*(.*)$`)
+
+// Symbols parses source with md and returns its headings, link reference
+// definitions, footnote definitions ([^label]: text) and fenced code blocks
+// with a language, in document order
+func Symbols(md goldmark.Markdown, source []byte) []Symbol {
+	pc := parser.NewContext()
+	doc := md.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+	s := &symbolScanner{source: source, starts: lineStarts(source), symbols: []Symbol{}}
+	s.code = make([]bool, len(s.starts))
+	s.paragraph = make([]bool, len(s.starts))
+
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Type() != ast.TypeBlock {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			s.heading(n)
+		case *ast.FencedCodeBlock:
+			s.markLines(n, s.code)
+			s.fence(n)
+		case *ast.CodeBlock, *ast.HTMLBlock:
+			s.markLines(n, s.code)
+		case *ast.Paragraph:
+			s.markLines(n, s.paragraph)
+		}
+		return ast.WalkContinue, nil
+	})
+	s.definitions(pc)
+	s.closeSections()
+
+	sort.SliceStable(s.symbols, func(i, j int) bool {
+		a, b := s.symbols[i].Range.Start, s.symbols[j].Range.Start
+		return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+	})
+	return s.symbols
+}
+
+// symbolScanner collects the symbols of one source
+type symbolScanner struct {
+	source    []byte
+	starts    []int // Offset of each line
+	code      []bool
+	paragraph []bool
+	symbols   []Symbol
+	sections  []int // Indexes of heading symbols, for closeSections
+}
+
+// line returns the 0-based line holding offset
+func (s *symbolScanner) line(offset int) int {
+	return sort.Search(len(s.starts), func(i int) bool { return s.starts[i] > offset }) - 1
+}
+
+// position returns the Position of offset
+func (s *symbolScanner) position(offset int) Position {
+	line := s.line(offset)
+	character := 0
+	for _, r := range string(s.source[s.starts[line]:offset]) {
+		character += utf16.RuneLen(r)
+	}
+	return Position{Line: line, Character: character}
+}
+
+// lineEnd returns the offset of the end of line, before its line break
+func (s *symbolScanner) lineEnd(line int) int {
+	if line+1 < len(s.starts) {
+		end := s.starts[line+1] - 1
+		if end > s.starts[line] && s.source[end-1] == '\r' {
+			end--
+		}
+		return end
+	}
+	return len(s.source)
+}
+
+// lines returns the range of whole lines first to last
+func (s *symbolScanner) lines(first, last int) Range {
+	return Range{Start: Position{Line: first}, End: s.position(s.lineEnd(last))}
+}
+
+// markLines flags the source lines of a leaf block
+func (s *symbolScanner) markLines(n ast.Node, flags []bool) {
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		for line := s.line(segment.Start); line <= s.line(max(segment.Start, segment.Stop-1)); line++ {
+			flags[line] = true
+		}
+	}
+}
+
+// heading adds a heading; its section is completed by closeSections
+func (s *symbolScanner) heading(n *ast.Heading) {
+	lines := n.Lines()
+	if lines.Len() == 0 {
+		return // "#" alone has no text to list
+	}
+	first, last := s.line(lines.At(0).Start), s.line(max(lines.At(0).Start, lines.At(lines.Len()-1).Stop-1))
+	symbol := Symbol{Kind: SymbolHeading, Name: plainText(n, s.source), Level: n.Level, SelectionRange: s.lines(first, last)}
+	if id, found := n.AttributeString("id"); found {
+		if b, ok := id.([]byte); ok {
+			symbol.Detail = string(b)
+		}
+	}
+	s.sections = append(s.sections, len(s.symbols))
+	s.symbols = append(s.symbols, symbol)
+}
+
+// closeSections extends each heading's range to the next heading of the same
+// or a higher level, or the end of the document
+func (s *symbolScanner) closeSections() {
+	for i, index := range s.sections {
+		heading := &s.symbols[index]
+		end := s.position(len(s.source))
+		for _, next := range s.sections[i+1:] {
+			if s.symbols[next].Level <= heading.Level {
+				end = Position{Line: s.symbols[next].SelectionRange.Start.Line}
+				break
+			}
+		}
+		heading.Range = Range{Start: heading.SelectionRange.Start, End: end}
+	}
+}
+
+// fence adds a fenced code block with a language, from its opening to its
+// closing fence (or its last line when it runs to the end of the document)
+func (s *symbolScanner) fence(n *ast.FencedCodeBlock) {
+	language := string(n.Language(s.source))
+	if language == "" {
+		return
+	}
+	open := s.line(n.Info.Segment.Start)
+	last := open
+	if lines := n.Lines(); lines.Len() > 0 {
+		last = s.line(max(lines.At(0).Start, lines.At(lines.Len()-1).Stop-1))
+	}
+	if last+1 < len(s.starts) && isFence(s.source[s.starts[last+1]:s.lineEnd(last+1)]) {
+		last++
+	}
+	s.symbols = append(s.symbols, Symbol{Kind: SymbolCode, Name: language, Range: s.lines(open, last), SelectionRange: s.lines(open, open)})
+}
+
+// isFence reports whether a line is a closing code fence
+func isFence(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	return bytes.HasPrefix(line, []byte("```")) || bytes.HasPrefix(line, []byte("~~~"))
+}
+
+// definitions adds the link reference and footnote definitions outside code
+// and HTML blocks. Link definitions are those the parser took as such, which
+// never continue a paragraph; footnotes (not rendered by peekm) may, and take
+// their indented continuation lines along.
+func (s *symbolScanner) definitions(pc parser.Context) {
+	for line := range s.starts {
+		if s.code[line] {
+			continue
+		}
+		m := definitionPattern.FindSubmatch(s.source[s.starts[line]:s.lineEnd(line)])
+		if m == nil {
+			continue
+		}
+		label, rest := string(m[1]), strings.TrimSpace(string(m[2]))
+		if footnote, ok := strings.CutPrefix(label, "^"); ok {
+			last := line
+			for last+1 < len(s.starts) && !s.code[last+1] && isContinuation(s.source[s.starts[last+1]:s.lineEnd(last+1)]) {
+				last++
+			}
+			s.symbols = append(s.symbols, Symbol{Kind: SymbolFootnote, Name: footnote, Detail: rest, Range: s.lines(line, last), SelectionRange: s.lines(line, line)})
+			continue
+		}
+		if _, ok := pc.Reference(util.ToLinkReference([]byte(label))); !ok || s.paragraph[line] {
+			continue
+		}
+		destination, _, _ := strings.Cut(rest, " ")
+		destination = strings.TrimSuffix(strings.TrimPrefix(destination, "<"), ">")
+		s.symbols = append(s.symbols, Symbol{Kind: SymbolLinkDefinition, Name: label, Detail: destination, Range: s.lines(line, line), SelectionRange: s.lines(line, line)})
+	}
+}
+
+// isContinuation reports whether a line continues a footnote: indented and
+// not blank
+func isContinuation(line []byte) bool {
+	return len(bytes.TrimSpace(line)) > 0 && (bytes.HasPrefix(line, []byte("    ")) || bytes.HasPrefix(line, []byte("\t")))
+}
@@ -0,0 +1,139 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// WikiLinkResolver maps a page name to a markdown file path (slash-separated).
+// For missing pages it returns the path where the page would be created and false.
+type WikiLinkResolver func(target string) (relPath string, exists bool)
+
+// KindWikiLink is the AST node kind for [[Page]] and [[Page|Label]] links
+var KindWikiLink = ast.NewNodeKind("WikiLink")
+
+// WikiLinkNode is an inline [[Target|Label]] link
+type WikiLinkNode struct {
+	ast.BaseInline
+	Target string // Page name, optionally with a #fragment
+	Label  string // Display text (defaults to Target)
+}
+
+func (n *WikiLinkNode) Kind() ast.NodeKind {
+	return KindWikiLink
+}
+
+func (n *WikiLinkNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.Target, "Label": n.Label}, nil)
+}
+
+// wikiLinkParser parses [[...]] before the standard link parser sees the brackets
+type wikiLinkParser struct{}
+
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if len(line) < 5 || line[1] != '[' {
+		return nil
+	}
+
+	end := bytes.Index(line[2:], []byte("]]"))
+	if end <= 0 {
+		return nil
+	}
+	inner := line[2 : 2+end]
+	if bytes.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+
+	target, label := string(inner), string(inner)
+	if i := strings.IndexByte(target, '|'); i >= 0 {
+		target, label = target[:i], target[i+1:]
+	}
+	target = strings.TrimSpace(target)
+	label = strings.TrimSpace(label)
+	if target == "" {
+		return nil
+	}
+	if label == "" {
+		label = target
+	}
+
+	block.Advance(end + 4)
+	return &WikiLinkNode{Target: target, Label: label}
+}
+
+// wikiLinkRenderer renders resolved links normally and missing ones as "red links"
+type wikiLinkRenderer struct {
+	resolve WikiLinkResolver
+	pageURL func(relPath string) string
+}
+
+func (r *wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindWikiLink, r.render)
+}
+
+func (r *wikiLinkRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*WikiLinkNode)
+
+	target, fragment, _ := strings.Cut(n.Target, "#")
+	relPath, exists := r.resolve(target)
+	label := util.EscapeHTML([]byte(n.Label))
+
+	if exists {
+		href := r.pageURL(relPath)
+		if fragment != "" {
+			href += "#" + HeadingSlug(fragment)
+		}
+		fmt.Fprintf(w, `<a href="%s" class="wikilink">%s</a>`, util.EscapeHTML([]byte(href)), label)
+	} else {
+		fmt.Fprintf(w, `<a href="#" class="wikilink wikilink-missing" data-wiki-target="%s" title="Create %s">%s</a>`,
+			util.EscapeHTML([]byte(relPath)), util.EscapeHTML([]byte(relPath)), label)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// wikiLinkExtension adds [[Page]] link support to goldmark
+type wikiLinkExtension struct {
+	resolve WikiLinkResolver
+	pageURL func(relPath string) string
+}
+
+func (e *wikiLinkExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(&wikiLinkParser{}, 199)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&wikiLinkRenderer{resolve: e.resolve, pageURL: e.pageURL}, 500)))
+}
+
+// defaultPageURL links wiki pages to peekm's /view/ route
+func defaultPageURL(relPath string) string {
+	return (&url.URL{Path: "/view/" + relPath}).String()
+}
+
+// HeadingSlug approximates goldmark's auto heading IDs for wiki link fragments
+func HeadingSlug(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case r == ' ' || r == '-':
+			b.WriteRune('-')
+		case r == '_' || ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') || r > 127:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
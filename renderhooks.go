@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/razvandimescu/peekm/include"
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// renderHookTimeout bounds one run of a --pre-render or --post-render command
+const renderHookTimeout = 10 * time.Second
+
+// renderFile renders a markdown file with the shared renderer settings, from
+// the source returned by expandSource, piping the HTML through --post-render
+// when set
+func renderFile(absPath string, source []byte) (string, error) {
+	rendered, err := renderMarkdown(expandSource(absPath, source))
+	if err != nil {
+		return "", err
+	}
+	return string(runRenderHook("post-render", *postRender, absPath, []byte(rendered))), nil
+}
+
+// expandSource returns the markdown a file renders from: its include
+// directives expanded, then piped through --pre-render when set
+func expandSource(absPath string, source []byte) []byte {
+	source = include.Expand(absPath, source, readIncludedFile)
+	return runRenderHook("pre-render", *preRender, absPath, source)
+}
+
+// readIncludedFile reads a file named by an include directive. Like any other
+// page, it must be a served markdown file.
+func readIncludedFile(path string) ([]byte, error) {
+	resolved, err := safepath.Resolve(path)
+	if err != nil || !isWhitelistedFile(resolved) {
+		return nil, errors.New("not a markdown file in this directory")
+	}
+	return os.ReadFile(resolved)
+}
+
+// runRenderHook pipes input through a hook command and returns its output. An
+// unset or failing hook leaves the input unchanged, so a broken script never
+// blanks the page; failures are logged.
+func runRenderHook(stage, command, absPath string, input []byte) []byte {
+	fields := splitCommandLine(command)
+	if len(fields) == 0 {
+		return input
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), renderHookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+	cmd.Dir = resolveFilePath(".")
+	cmd.Env = append(os.Environ(),
+		"PEEKM_HOOK_STAGE="+stage,
+		"PEEKM_FILE="+absPath,
+		"PEEKM_RELATIVE_PATH="+filepath.ToSlash(getRelativePath(absPath)),
+	)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		log.Printf("Warning: --%s command failed for %s: %v", stage, getRelativePath(absPath), err)
+		return input
+	}
+	return stdout.Bytes()
+}
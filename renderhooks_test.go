@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRenderFileHooks tests --pre-render and --post-render commands and their failure fallback
+func TestRenderFileHooks(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	prevPre, prevPost, prevPermalinks := *preRender, *postRender, *permalinks
+	defer func() { *preRender, *postRender, *permalinks = prevPre, prevPost, prevPermalinks }()
+	*permalinks = false
+
+	*preRender = `sh -c "sed 's/{{version}}/1.2.3/'"`
+	*postRender = `sh -c 'echo "<!-- $PEEKM_HOOK_STAGE $(basename $PEEKM_FILE) -->"; cat'`
+	got, err := renderFile("/docs/release.md", []byte("# Release {{version}}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<!-- post-render release.md -->\n<h1 id=\"release-123\">Release 1.2.3</h1>"; strings.TrimSpace(got) != want {
+		t.Errorf("renderFile() = %q, want %q", got, want)
+	}
+
+	// A failing hook leaves its input as it was
+	*preRender = `sh -c "echo broken >&2; exit 1"`
+	*postRender = ""
+	got, err = renderFile("/docs/release.md", []byte("# Release\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<h1 id="release">Release</h1>`; strings.TrimSpace(got) != want {
+		t.Errorf("renderFile() with a failing hook = %q, want %q", got, want)
+	}
+}
+
+// TestRenderFileIncludes tests that include directives only pull in served markdown files
+func TestRenderFileIncludes(t *testing.T) {
+	files := map[string]string{
+		"spec.md":        "# Spec\n\n<!-- include: parts/scope.md -->\n\n<!-- include: notes.txt -->\n",
+		"parts/scope.md": "Scope is *small*.\n",
+		"notes.txt":      "secret\n",
+	}
+	dir := serveTestFiles(t, "include", files)
+	markdownFiles = newFileSet([]string{filepath.Join(dir, "spec.md"), filepath.Join(dir, "parts", "scope.md")})
+
+	got, err := renderFile(filepath.Join(dir, "spec.md"), []byte(files["spec.md"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "<p>Scope is <em>small</em>.</p>") {
+		t.Errorf("included file not rendered:\n%s", got)
+	}
+	if strings.Contains(got, "secret") || !strings.Contains(got, "Cannot include <code>notes.txt</code>") {
+		t.Errorf("non-markdown include should be refused:\n%s", got)
+	}
+}
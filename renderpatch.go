@@ -0,0 +1,133 @@
+package main
+
+import (
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/razvandimescu/peekm/render"
+)
+
+// maxRenderPatchBytes caps the HTML a live update pushes; a bigger change
+// has the client fetch the page instead
+const maxRenderPatchBytes = 64 << 10
+
+// maxCachedRenders bounds the renders kept to diff live updates against
+const maxCachedRenders = 32
+
+// cachedRender is the last render of a file sent to a browser, cut into
+// render.Blocks
+type cachedRender struct {
+	hash   string
+	blocks []string
+}
+
+// renderCache holds the last render of each file viewed, by absolute path
+var renderCache = struct {
+	mu      sync.Mutex
+	renders map[string]cachedRender
+}{renders: make(map[string]cachedRender)}
+
+// renderPatch turns the page rendered as Base into the one rendered as Hash:
+// of its Blocks top-level elements, Remove starting at From are replaced by
+// HTML
+type renderPatch struct {
+	Base   string `json:"base"`
+	Hash   string `json:"hash"`
+	Blocks int    `json:"blocks"`
+	From   int    `json:"from"`
+	Remove int    `json:"remove"`
+	HTML   string `json:"html"`
+}
+
+// renderHash identifies a render (the page's data-render attribute)
+func renderHash(rendered string) string {
+	h := fnv.New64a()
+	h.Write([]byte(rendered))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// rememberRender caches the render of absPath sent to a browser. The hash
+// of the result is "" when the render can't be patched (it isn't a run of
+// balanced top-level elements).
+func rememberRender(absPath, rendered string) cachedRender {
+	blocks, ok := render.Blocks(rendered)
+	if !ok {
+		forgetRender(absPath)
+		return cachedRender{}
+	}
+	cached := cachedRender{hash: renderHash(rendered), blocks: blocks}
+
+	renderCache.mu.Lock()
+	defer renderCache.mu.Unlock()
+	if _, found := renderCache.renders[absPath]; !found && len(renderCache.renders) >= maxCachedRenders {
+		for path := range renderCache.renders { // Any one will do
+			delete(renderCache.renders, path)
+			break
+		}
+	}
+	renderCache.renders[absPath] = cached
+	return cached
+}
+
+// forgetRender drops the cached render of absPath
+func forgetRender(absPath string) {
+	renderCache.mu.Lock()
+	defer renderCache.mu.Unlock()
+	delete(renderCache.renders, absPath)
+}
+
+// renderPatchFor re-renders a modified file and diffs it against the render
+// cached for it. It returns nil when the client should fetch the page:
+// nothing cached (no one viewed it whole), the file now renders in parts or
+// can't be cut into blocks, or the change is over maxRenderPatchBytes.
+func renderPatchFor(absPath string) *renderPatch {
+	renderCache.mu.Lock()
+	prev, found := renderCache.renders[absPath]
+	renderCache.mu.Unlock()
+	if !found {
+		return nil
+	}
+
+	content, err := os.ReadFile(absPath)
+	if err != nil || (renderLimit() > 0 && len(content) > renderLimit()) {
+		forgetRender(absPath)
+		return nil
+	}
+	rendered, err := renderFile(absPath, content)
+	if err != nil {
+		return nil
+	}
+	next := rememberRender(absPath, rendered)
+	if next.hash == "" {
+		return nil
+	}
+
+	patch := diffBlocks(prev.blocks, next.blocks)
+	if len(patch.HTML) > maxRenderPatchBytes {
+		return nil
+	}
+	patch.Base, patch.Hash = prev.hash, next.hash
+	return patch
+}
+
+// diffBlocks replaces the blocks between the common start and end of old and
+// updated
+func diffBlocks(old, updated []string) *renderPatch {
+	prefix := 0
+	for prefix < len(old) && prefix < len(updated) && old[prefix] == updated[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(updated)-prefix && old[len(old)-1-suffix] == updated[len(updated)-1-suffix] {
+		suffix++
+	}
+	return &renderPatch{
+		Blocks: len(old),
+		From:   prefix,
+		Remove: len(old) - prefix - suffix,
+		HTML:   strings.Join(updated[prefix:len(updated)-suffix], ""),
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffBlocks(t *testing.T) {
+	tests := []struct {
+		old, updated string // Blocks, one letter each
+		from, remove int
+		html         string
+	}{
+		{"abcd", "abXd", 2, 1, "X"},
+		{"abcd", "abd", 2, 1, ""},
+		{"abcd", "abXYcd", 2, 0, "XY"},
+		{"abcd", "abcdE", 4, 0, "E"},
+		{"abcd", "Xbcd", 0, 1, "X"},
+		{"aa", "aaa", 2, 0, "a"},
+		{"abcd", "abcd", 4, 0, ""},
+	}
+	for _, tt := range tests {
+		patch := diffBlocks(strings.Split(tt.old, ""), strings.Split(tt.updated, ""))
+		if patch.Blocks != len(tt.old) || patch.From != tt.from || patch.Remove != tt.remove || patch.HTML != tt.html {
+			t.Errorf("diffBlocks(%s, %s) = %+v, want from %d, remove %d, html %q", tt.old, tt.updated, patch, tt.from, tt.remove, tt.html)
+		}
+	}
+}
+
+func TestRenderPatchFor(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.md")
+	os.WriteFile(path, []byte("# Title\n\nFirst.\n\nSecond.\n"), 0644)
+	if patch := renderPatchFor(path); patch != nil {
+		t.Fatalf("patch for a file never viewed = %+v, want nil", patch)
+	}
+
+	content, _ := os.ReadFile(path)
+	rendered, err := renderFile(path, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewed := rememberRender(path, rendered)
+	t.Cleanup(func() { forgetRender(path) })
+
+	os.WriteFile(path, []byte("# Title\n\nFirst, edited.\n\nSecond.\n"), 0644)
+	patch := renderPatchFor(path)
+	if patch == nil {
+		t.Fatal("no patch for a one-paragraph edit")
+	}
+	if patch.Base != viewed.hash || patch.Hash == viewed.hash || patch.Blocks != 3 || patch.From != 1 || patch.Remove != 1 || patch.HTML != "<p>First, edited.</p>\n" {
+		t.Errorf("patch = %+v", patch)
+	}
+
+	// The next patch starts from the edited render
+	os.WriteFile(path, []byte("# Title\n\nFirst, edited.\n\nSecond.\n\n<div>unclosed\n"), 0644)
+	if next := renderPatchFor(path); next != nil {
+		t.Errorf("patch for a render with unbalanced HTML = %+v, want nil", next)
+	}
+	if next := renderPatchFor(path); next != nil {
+		t.Errorf("patch after the render was forgotten = %+v, want nil", next)
+	}
+}
+
+func TestNotifyFileModifiedMessage(t *testing.T) {
+	dir := t.TempDir()
+	prevDir, prevClients, prevEvents := browseDir, clients, globalEventBuffer
+	t.Cleanup(func() { browseDir, clients, globalEventBuffer = prevDir, prevClients, prevEvents })
+	browseDir, clients, globalEventBuffer = dir, make(map[uint64]*sseClient), newEventBuffer(50)
+	client, _ := registerClient(httptest.NewRequest("GET", "/events", nil))
+
+	path := filepath.Join(dir, "notes", "a.md")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("Before.\n"), 0644)
+	rememberRender(path, "<p>Before.</p>\n")
+	t.Cleanup(func() { forgetRender(path) })
+	os.WriteFile(path, []byte("After.\n"), 0644)
+	notifyFileModified(path)
+
+	event := <-client.ch
+	var msg fileModifiedMessage
+	if err := json.Unmarshal([]byte(event[strings.Index(event, "data: ")+len("data: "):]), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Path != path || msg.View != "notes/a.md" || msg.Patch == nil || msg.Patch.HTML != "<p>After.</p>\n" {
+		t.Errorf("message = %+v (patch %+v)", msg, msg.Patch)
+	}
+}
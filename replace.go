@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/razvandimescu/peekm/search"
+)
+
+// Limits of /api/replace: request body size, and how many replacements can
+// still be undone (older ones are forgotten)
+const (
+	maxReplaceBodySize = 1 << 20
+	maxReplaceUndo     = 10
+)
+
+// replaceRequest is the /api/replace body. Without Apply nothing is written
+// and the response previews the changes.
+type replaceRequest struct {
+	Query       string `json:"query"`
+	Replacement string `json:"replacement"`
+	Regex       bool   `json:"regex"` // Query is an RE2 regex; $1 and ${name} in Replacement expand
+	Word        bool   `json:"word"`  // Whole words only
+	Case        bool   `json:"case"`  // Case-sensitive
+	Dir         string `json:"dir"`   // Limit to a directory, relative to the browse directory
+	Apply       bool   `json:"apply"`
+	Expect      int    `json:"expect"` // With Apply: the preview's replacement count, to refuse if files changed since
+}
+
+// replaceFile is one file in an /api/replace response
+type replaceFile struct {
+	Path         string              `json:"path"` // Relative to the browse directory
+	Replacements int                 `json:"replacements"`
+	Changes      []search.LineChange `json:"changes"`
+	Error        string              `json:"error,omitempty"` // Write failure; the file is unchanged
+}
+
+// replaceResponse is returned by /api/replace
+type replaceResponse struct {
+	Applied      bool          `json:"applied"`
+	UndoID       string        `json:"undo_id,omitempty"` // Pass to /api/replace/undo to restore the files
+	Replacements int           `json:"replacements"`
+	Files        []replaceFile `json:"files"`
+}
+
+// replaceUndoResponse is returned by /api/replace/undo
+type replaceUndoResponse struct {
+	Restored  []string `json:"restored"`  // Relative paths
+	Conflicts []string `json:"conflicts"` // Edited since the replacement, left alone
+}
+
+// replaceSnapshot holds what an applied replacement changed, for undo
+type replaceSnapshot struct {
+	id    string
+	files []snapshotFile
+}
+
+// snapshotFile is a file's content before and after a replacement
+type snapshotFile struct {
+	path          string
+	before, after []byte
+}
+
+// replaceHistory keeps the latest applied replacements, oldest first
+type replaceHistory struct {
+	mu        sync.Mutex
+	snapshots []*replaceSnapshot
+}
+
+// globalReplaceHistory holds the replacements /api/replace/undo can revert
+var globalReplaceHistory = &replaceHistory{}
+
+// add records a snapshot, forgetting the oldest beyond maxReplaceUndo
+func (h *replaceHistory) add(s *replaceSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshots = append(h.snapshots, s)
+	if len(h.snapshots) > maxReplaceUndo {
+		h.snapshots = h.snapshots[len(h.snapshots)-maxReplaceUndo:]
+	}
+}
+
+// take removes and returns the snapshot with the given id
+func (h *replaceHistory) take(id string) (*replaceSnapshot, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, s := range h.snapshots {
+		if s.id == id {
+			h.snapshots = slices.Delete(h.snapshots, i, i+1)
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// newReplaceID returns a random snapshot id
+func newReplaceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// handleAPIReplace replaces text across the whitelisted markdown files: a
+// preview by default, written (each file atomically) with "apply": true
+func handleAPIReplace(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxReplaceBodySize)
+	var req replaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeError(w, errCodeBadRequest, "Missing search query", http.StatusBadRequest)
+		return
+	}
+	dir, err := resolveSearchDir(req.Dir)
+	if err != nil {
+		writeError(w, errCodeBadRequest, fmt.Sprintf("Invalid directory: %v", err), http.StatusBadRequest)
+		return
+	}
+	pattern, err := search.Compile(req.Query, search.PatternOptions{Regex: req.Regex, Word: req.Word, CaseSensitive: req.Case})
+	if err != nil {
+		writeError(w, errCodeBadRequest, fmt.Sprintf("Invalid regex: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	resp, rewritten := previewReplace(pattern, req.Replacement, dir)
+	if req.Apply && req.Expect > 0 && req.Expect != resp.Replacements {
+		writeError(w, errCodeConflict, fmt.Sprintf("Files changed since the preview: %d replacements, expected %d", resp.Replacements, req.Expect), http.StatusConflict)
+		return
+	}
+	if req.Apply && resp.Replacements > 0 {
+		applyReplace(&resp, rewritten)
+		log.Printf("Replaced %d occurrence(s) of %q in %d file(s)", resp.Replacements, req.Query, len(resp.Files))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// previewReplace computes the replacement in every file under dir, returning
+// the preview and each changed file's before and after content
+func previewReplace(pattern *search.Pattern, replacement, dir string) (replaceResponse, []snapshotFile) {
+	files := whitelistedFiles()
+
+	resp := replaceResponse{Files: []replaceFile{}}
+	var rewritten []snapshotFile
+	for _, path := range files {
+		if !inSearchDir(path, dir) || checkWritable(path) != nil {
+			continue
+		}
+		before, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		after, changes := pattern.Replace(before, replacement)
+		if len(changes) == 0 {
+			continue
+		}
+		count := 0
+		for _, c := range changes {
+			count += c.Replacements
+		}
+		resp.Replacements += count
+		resp.Files = append(resp.Files, replaceFile{Path: filepath.ToSlash(getRelativePath(path)), Replacements: count, Changes: changes})
+		rewritten = append(rewritten, snapshotFile{path: path, before: before, after: after})
+	}
+	return resp, rewritten
+}
+
+// applyReplace writes the rewritten files and records them for undo. Files
+// that fail to write keep their content and report the error.
+func applyReplace(resp *replaceResponse, rewritten []snapshotFile) {
+	snapshot := &replaceSnapshot{id: newReplaceID()}
+	for i, file := range rewritten {
+		if err := atomicWriteFile(file.path, string(file.after)); err != nil {
+			resp.Files[i].Error = err.Error()
+			resp.Replacements -= resp.Files[i].Replacements
+			continue
+		}
+		snapshot.files = append(snapshot.files, file)
+		textIndex.update(file.path)
+	}
+	resp.Applied = true
+	if len(snapshot.files) > 0 {
+		globalReplaceHistory.add(snapshot)
+		resp.UndoID = snapshot.id
+	}
+}
+
+// replaceUndoRequest is the /api/replace/undo request body
+type replaceUndoRequest struct {
+	ID string `json:"id"` // undo_id of the replacement
+}
+
+// handleAPIReplaceUndo restores the files of an applied replacement
+// ({"id": undo_id}). Files edited since then are reported, not overwritten.
+func handleAPIReplaceUndo(w http.ResponseWriter, r *http.Request) {
+	var req replaceUndoRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReplaceBodySize)).Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	snapshot, found := globalReplaceHistory.take(req.ID)
+	if !found {
+		writeError(w, errCodeNotFound, "Nothing to undo with this id", http.StatusNotFound)
+		return
+	}
+
+	resp := replaceUndoResponse{Restored: []string{}, Conflicts: []string{}}
+	for _, file := range snapshot.files {
+		relPath := filepath.ToSlash(getRelativePath(file.path))
+		current, err := os.ReadFile(file.path)
+		if err != nil || !bytes.Equal(current, file.after) {
+			resp.Conflicts = append(resp.Conflicts, relPath)
+			continue
+		}
+		if err := atomicWriteFile(file.path, string(file.before)); err != nil {
+			resp.Conflicts = append(resp.Conflicts, relPath)
+			continue
+		}
+		textIndex.update(file.path)
+		resp.Restored = append(resp.Restored, relPath)
+	}
+	log.Printf("Undid replacement %s: %d file(s) restored, %d conflict(s)", snapshot.id, len(resp.Restored), len(resp.Conflicts))
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// postReplace sends body to handler and decodes the JSON response into v
+func postReplace(t *testing.T, handler http.HandlerFunc, body string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/api/replace", strings.NewReader(body)))
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("invalid JSON response: %v", err)
+		}
+	}
+	return rec.Code
+}
+
+// replaceTestFiles is the text of the files setupReplaceFiles writes
+var replaceTestFiles = map[string]string{
+	"a.md":       "# Quick Sync\n\nUse quick sync.\n",
+	"guide/b.md": "Quick Sync is fast.\nQuick Syncing too.\n",
+}
+
+// setupReplaceFiles browses a temp directory holding replaceTestFiles until
+// the test ends
+func setupReplaceFiles(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "guide"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for rel, content := range replaceTestFiles {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	prevDir, prevFiles, prevHistory := browseDir, markdownFiles, globalReplaceHistory
+	t.Cleanup(func() { browseDir, markdownFiles, globalReplaceHistory = prevDir, prevFiles, prevHistory })
+	browseDir, markdownFiles, globalReplaceHistory = dir, newFileSet(files), &replaceHistory{}
+	return dir
+}
+
+// readTestFile returns the content of a file below dir
+func readTestFile(dir, rel string) string {
+	content, _ := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel)))
+	return string(content)
+}
+
+const replaceTestBody = `{"query": "Quick Sync", "replacement": "Live Sync", "word": true, "case": true`
+
+func TestHandleAPIReplacePreview(t *testing.T) {
+	dir := setupReplaceFiles(t)
+
+	var preview replaceResponse
+	if code := postReplace(t, handleAPIReplace, replaceTestBody+"}", &preview); code != http.StatusOK {
+		t.Fatalf("preview status = %d", code)
+	}
+	if preview.Applied || preview.Replacements != 2 || len(preview.Files) != 2 || preview.Files[0].Path != "a.md" {
+		t.Errorf("preview = %+v, want 2 replacements in a.md and guide/b.md", preview)
+	}
+	if got := readTestFile(dir, "a.md"); got != replaceTestFiles["a.md"] {
+		t.Errorf("preview wrote a.md: %q", got)
+	}
+
+	// A stale expected count is refused
+	if code := postReplace(t, handleAPIReplace, replaceTestBody+`, "apply": true, "expect": 3}`, &replaceResponse{}); code != http.StatusConflict {
+		t.Errorf("stale expect: status = %d, want 409", code)
+	}
+}
+
+func TestHandleAPIReplaceApplyAndUndo(t *testing.T) {
+	dir := setupReplaceFiles(t)
+
+	var applied replaceResponse
+	if code := postReplace(t, handleAPIReplace, replaceTestBody+`, "apply": true, "expect": 1, "dir": "guide"}`, &applied); code != http.StatusOK {
+		t.Fatalf("apply status = %d", code)
+	}
+	if got := readTestFile(dir, "guide/b.md"); got != "Live Sync is fast.\nQuick Syncing too.\n" || !applied.Applied || applied.UndoID == "" {
+		t.Errorf("apply in guide/ = %+v, b.md = %q", applied, got)
+	}
+	if got := readTestFile(dir, "a.md"); got != replaceTestFiles["a.md"] {
+		t.Errorf("apply outside dir wrote a.md: %q", got)
+	}
+
+	var undo replaceUndoResponse
+	if code := postReplace(t, handleAPIReplaceUndo, `{"id": "`+applied.UndoID+`"}`, &undo); code != http.StatusOK {
+		t.Fatalf("undo status = %d", code)
+	}
+	if got := readTestFile(dir, "guide/b.md"); got != replaceTestFiles["guide/b.md"] || !reflect.DeepEqual(undo.Restored, []string{"guide/b.md"}) {
+		t.Errorf("undo = %+v, b.md = %q", undo, got)
+	}
+	if code := postReplace(t, handleAPIReplaceUndo, `{"id": "`+applied.UndoID+`"}`, &undo); code != http.StatusNotFound {
+		t.Errorf("second undo: status = %d, want 404", code)
+	}
+}
+
+func TestHandleAPIReplaceUndoConflict(t *testing.T) {
+	dir := setupReplaceFiles(t)
+	path := filepath.Join(dir, "a.md")
+
+	var applied replaceResponse
+	if code := postReplace(t, handleAPIReplace, `{"query": "use", "replacement": "try", "apply": true}`, &applied); code != http.StatusOK {
+		t.Fatalf("apply status = %d", code)
+	}
+	if err := os.WriteFile(path, []byte("edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var undo replaceUndoResponse
+	if code := postReplace(t, handleAPIReplaceUndo, `{"id": "`+applied.UndoID+`"}`, &undo); code != http.StatusOK {
+		t.Fatalf("undo status = %d", code)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "edited\n" || !reflect.DeepEqual(undo.Conflicts, []string{"a.md"}) {
+		t.Errorf("undo over an edit = %+v, file = %q", undo, content)
+	}
+
+	for _, body := range []string{`{"query": ""}`, `{"query": "(", "regex": true}`, `{"query": "x", "dir": "../up"}`, `not json`} {
+		if code := postReplace(t, handleAPIReplace, body, &replaceResponse{}); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, code)
+		}
+	}
+}
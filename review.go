@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/razvandimescu/peekm/diff"
+	"github.com/razvandimescu/peekm/render"
+)
+
+// reviewRoute serves the review page of a file
+const reviewRoute = "/review/"
+
+// reviewTmpl renders /review/{path} (an AI session's changes to a file as
+// hunks to accept or revert)
+var reviewTmpl *template.Template
+
+// reviewHunk is one run of changed lines, shown with the unchanged lines
+// around it
+type reviewHunk struct {
+	Index    int
+	OldStart int // 1-based line it starts at before the session (where lines were inserted, for pure insertions)
+	NewStart int // 1-based line it starts at now (where lines were deleted, for pure deletions)
+	Added    int
+	Removed  int
+	Rows     []compareDiffRow
+	Section  string       // ID of the heading whose section it is in
+	Comments []apiComment // Comments on that section, shown with its first hunk
+}
+
+// reviewTemplateData is used for rendering the review page
+type reviewTemplateData struct {
+	baseTemplateData
+	Path     string // Relative to the browse directory
+	Title    string
+	Session  string // Session whose changes are reviewed
+	Agent    string // Agent that reported them, if known
+	Since    time.Time
+	Version  string // Identifies the content reviewed; actions on other content are refused
+	ReadOnly bool   // Hunks can be accepted but not reverted
+	Added    int
+	Removed  int
+	Hunks    []reviewHunk
+}
+
+// apiReviewRequest accepts or reverts one hunk of a review
+type apiReviewRequest struct {
+	Path    string `json:"path"`    // Relative to the browse directory
+	Hunk    int    `json:"hunk"`    // 0-based index on the review page
+	Action  string `json:"action"`  // "accept" keeps the change, "revert" undoes it in the file
+	Version string `json:"version"` // Version of the review page the hunk is from
+}
+
+// apiReviewResponse is returned by /api/review
+type apiReviewResponse struct {
+	Path      string `json:"path"`
+	Version   string `json:"version"`   // Version of the review after the action
+	Remaining int    `json:"remaining"` // Hunks left to review
+}
+
+// reviewVersion identifies a pair of snapshot and current content
+func reviewVersion(before, after string) string {
+	sum := sha256.Sum256([]byte(before + "\x00" + after))
+	return hex.EncodeToString(sum[:6])
+}
+
+// hunkIndexes numbers the runs of changed lines of a diff, returning the
+// hunk of each line (-1 for unchanged lines) and the number of hunks
+func hunkIndexes(lines []diff.Line) ([]int, int) {
+	indexes := make([]int, len(lines))
+	count := 0
+	for i, l := range lines {
+		indexes[i] = -1
+		if l.Op == diff.Equal {
+			continue
+		}
+		if i == 0 || lines[i-1].Op == diff.Equal {
+			count++
+		}
+		indexes[i] = count - 1
+	}
+	return indexes, count
+}
+
+// reviewHunks splits a diff into hunks, each with up to context unchanged
+// lines on either side
+func reviewHunks(lines []diff.Line, context int) []reviewHunk {
+	indexes, count := hunkIndexes(lines)
+	hunks := make([]reviewHunk, count)
+	first, last := make([]int, count), make([]int, count)
+	rows := make([]compareDiffRow, len(lines))
+	oldLine, newLine := 0, 0
+	for i, l := range lines {
+		if h := indexes[i]; h >= 0 {
+			if i == 0 || indexes[i-1] != h {
+				hunks[h] = reviewHunk{Index: h, OldStart: oldLine + 1, NewStart: newLine + 1}
+				first[h] = i
+			}
+			last[h] = i
+		}
+		rows[i] = compareDiffRow{Op: l.Op.String(), Text: l.Text}
+		if l.Op != diff.Insert {
+			oldLine++
+			rows[i].OldLine = oldLine
+		}
+		if l.Op != diff.Delete {
+			newLine++
+			rows[i].NewLine = newLine
+		}
+	}
+	for h := range hunks {
+		hunks[h].Added, hunks[h].Removed = diff.Stats(lines[first[h] : last[h]+1])
+		hunks[h].Rows = rows[max(0, first[h]-context):min(len(rows), last[h]+1+context)]
+	}
+	return hunks
+}
+
+// resolveHunk settles one hunk of the diff from before to after. Accepting
+// returns before with the hunk's change applied, the new baseline; reverting
+// returns after with the change undone, the new file content.
+func resolveHunk(before, after string, hunk int, accept bool) string {
+	lines := diff.Lines(before, after)
+	indexes, _ := hunkIndexes(lines)
+	var kept []string
+	for i, l := range lines {
+		inHunk := indexes[i] == hunk
+		if l.Op == diff.Equal || (l.Op == diff.Insert && inHunk == accept) || (l.Op == diff.Delete && inHunk != accept) {
+			kept = append(kept, l.Text)
+		}
+	}
+	reference := after
+	if accept {
+		reference = before
+	}
+	result := strings.Join(kept, "\n")
+	if len(kept) > 0 && (strings.HasSuffix(reference, "\n") || reference == "") {
+		result += "\n"
+	}
+	return result
+}
+
+// attachReviewComments places the comments on each section with the first
+// hunk in it
+func attachReviewComments(hunks []reviewHunk, headings []render.Heading, comments []apiComment) {
+	shown := map[string]bool{}
+	for i := range hunks {
+		section := sectionAt(headings, hunks[i].NewStart)
+		hunks[i].Section = section
+		if shown[section] {
+			continue
+		}
+		shown[section] = true
+		for _, c := range comments {
+			if c.Heading == section || (c.Heading == "" && c.Section == section) {
+				hunks[i].Comments = append(hunks[i].Comments, c)
+			}
+		}
+	}
+}
+
+// loadReviewSnapshot returns the pre-modification snapshot and current
+// content of a served file, writing the error response on failure
+func loadReviewSnapshot(w http.ResponseWriter, rawPath string) (string, *fileSnapshot, string, bool) {
+	if globalSessionStore == nil {
+		writeError(w, errCodeNotFound, "AI session tracking is disabled", http.StatusNotFound)
+		return "", nil, "", false
+	}
+	validated, ok := resolveWhitelistedPath(w, rawPath)
+	if !ok {
+		return "", nil, "", false
+	}
+	snap, found := globalSessionStore.getSnapshot(validated)
+	if !found {
+		writeError(w, errCodeNotFound, "No AI changes recorded for this file", http.StatusNotFound)
+		return "", nil, "", false
+	}
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return "", nil, "", false
+	}
+	return validated, snap, string(content), true
+}
+
+// serveReview renders /review/{path}: what the last AI session changed in a
+// file, hunk by hunk, next to the review comments on the sections involved
+func serveReview(w http.ResponseWriter, r *http.Request) {
+	validated, snap, content, ok := loadReviewSnapshot(w, r.PathValue("path"))
+	if !ok {
+		return
+	}
+
+	lines := diff.Lines(snap.Content, content)
+	data := reviewTemplateData{
+		baseTemplateData: newBaseTemplateData(r),
+		Path:             filepath.ToSlash(getRelativePath(validated)),
+		Title:            filepath.Base(validated),
+		Session:          snap.SessionID,
+		Since:            snap.Timestamp,
+		Version:          reviewVersion(snap.Content, content),
+		ReadOnly:         checkWritable(validated) != nil,
+		Hunks:            reviewHunks(lines, compareDiffContext),
+	}
+	data.Added, data.Removed = diff.Stats(lines)
+	if metadata, found := globalSessionStore.get(validated); found && metadata.SessionID == snap.SessionID {
+		data.Agent = metadata.Source
+	}
+
+	commentsMutex.Lock()
+	comments := loadComments(validated)
+	commentsMutex.Unlock()
+	headings := render.Headings(newMarkdownRenderer(), []byte(content))
+	attachReviewComments(data.Hunks, headings, commentSections(headings, comments))
+
+	var buf bytes.Buffer
+	if err := reviewTmpl.Execute(&buf, data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		writeError(w, errCodeInternal, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// handleAPIReview accepts (keeps, dropping it from the review) or reverts
+// (undoes in the file) one hunk of an AI session's changes
+func handleAPIReview(w http.ResponseWriter, r *http.Request) {
+	var req apiReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Action != "accept" && req.Action != "revert" {
+		writeError(w, errCodeBadRequest, `Invalid action (use "accept" or "revert")`, http.StatusBadRequest)
+		return
+	}
+	validated, snap, content, ok := loadReviewSnapshot(w, req.Path)
+	if !ok {
+		return
+	}
+	if req.Version != reviewVersion(snap.Content, content) {
+		writeError(w, errCodeConflict, "The file changed since the review was loaded", http.StatusConflict)
+		return
+	}
+	if _, count := hunkIndexes(diff.Lines(snap.Content, content)); req.Hunk < 0 || req.Hunk >= count {
+		writeError(w, errCodeBadRequest, "Unknown hunk", http.StatusBadRequest)
+		return
+	}
+
+	before, after := snap.Content, content
+	if req.Action == "accept" {
+		before = resolveHunk(before, after, req.Hunk, true)
+		if !globalSessionStore.rebaseSnapshot(validated, snap, before) {
+			writeError(w, errCodeConflict, "The file changed since the review was loaded", http.StatusConflict)
+			return
+		}
+	} else {
+		if err := checkWritable(validated); err != nil {
+			writeError(w, errCodeReadOnly, err.Error(), http.StatusForbidden)
+			return
+		}
+		after = resolveHunk(before, after, req.Hunk, false)
+		if err := atomicWriteFile(validated, after); err != nil {
+			writeError(w, errCodeInternal, fmt.Sprintf("Failed to save: %v", err), http.StatusInternalServerError)
+			return
+		}
+		textIndex.update(validated)
+	}
+	log.Printf("Review: %sed hunk %d of %s", req.Action, req.Hunk+1, validated)
+
+	_, remaining := hunkIndexes(diff.Lines(before, after))
+	writeJSON(w, http.StatusOK, apiReviewResponse{
+		Path:      filepath.ToSlash(getRelativePath(validated)),
+		Version:   reviewVersion(before, after),
+		Remaining: remaining,
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/razvandimescu/peekm/diff"
+)
+
+func TestReviewHunks(t *testing.T) {
+	before := "# Plan\n\nShip on Friday.\n\nOwner: Ana\n\nDone.\n"
+	after := "# Plan\n\nShip on Monday.\nWith a canary.\n\nOwner: Ana\n"
+	hunks := reviewHunks(diff.Lines(before, after), 1)
+	if len(hunks) != 2 {
+		t.Fatalf("hunks = %+v, want 2", hunks)
+	}
+	if h := hunks[0]; h.Index != 0 || h.OldStart != 3 || h.NewStart != 3 || h.Added != 2 || h.Removed != 1 {
+		t.Errorf("first hunk = %+v", h)
+	}
+	if rows := hunks[0].Rows; len(rows) != 5 || rows[0].NewLine != 2 || rows[4].Text != "" {
+		t.Errorf("first hunk rows = %+v, want the change and one line on each side", rows)
+	}
+	// A pure deletion starts at the line after the ones it removed
+	if h := hunks[1]; h.OldStart != 6 || h.NewStart != 7 || h.Added != 0 || h.Removed != 2 {
+		t.Errorf("second hunk = %+v", h)
+	}
+}
+
+func TestResolveHunk(t *testing.T) {
+	before := "a\nb\nc\nd\n"
+	after := "a\nB\nc\nd\ne\n"
+	tests := []struct {
+		hunk   int
+		accept bool
+		want   string
+	}{
+		{0, true, "a\nB\nc\nd\n"},
+		{1, true, "a\nb\nc\nd\ne\n"},
+		{0, false, "a\nb\nc\nd\ne\n"},
+		{1, false, "a\nB\nc\nd\n"},
+	}
+	for _, tt := range tests {
+		if got := resolveHunk(before, after, tt.hunk, tt.accept); got != tt.want {
+			t.Errorf("resolveHunk(hunk %d, accept %v) = %q, want %q", tt.hunk, tt.accept, got, tt.want)
+		}
+	}
+}
+
+// setupReviewTest serves notes.md with serveTestFiles, with a session
+// snapshot taken before an AI edit, and returns the file's path
+func setupReviewTest(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(serveTestFiles(t, "review", map[string]string{"notes.md": "# Plan\n\nShip on Friday.\n\n## Risks\n\nNone.\n"}), "notes.md")
+	prevStore := globalSessionStore
+	t.Cleanup(func() { globalSessionStore = prevStore })
+	globalSessionStore = newSessionStore()
+	globalSessionStore.snapshot(path, "s1")
+	globalSessionStore.register(path, &SessionMetadata{Source: "claude-code", SessionID: "s1"})
+	if err := os.WriteFile(path, []byte("# Plan\n\nShip on Monday.\n\n## Risks\n\nNone.\nRollback untested.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// reviewAction posts a hunk action to /api/review
+func reviewAction(hunk int, action, version string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(apiReviewRequest{Path: "notes.md", Hunk: hunk, Action: action, Version: version})
+	rec := httptest.NewRecorder()
+	handleAPIReview(rec, httptest.NewRequest(http.MethodPost, "/api/review", strings.NewReader(string(body))))
+	return rec
+}
+
+func TestServeReview(t *testing.T) {
+	setupReviewTest(t)
+	handleAPIComments(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/comments", strings.NewReader(`{"path": "notes.md", "heading": "risks", "text": "Who owns rollback?"}`)))
+
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/review/notes.md", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, want := range []string{"claude-code s1", "+2 −1", "- Ship on Friday.", "+ Rollback untested.", "#risks", "Who owns rollback?", `id="hunk-1"`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("review page missing %q", want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/review/other.md", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("review of a file not served: status = %d, want 403", rec.Code)
+	}
+	globalSessionStore = newSessionStore()
+	rec = httptest.NewRecorder()
+	routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/review/notes.md", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("review without a snapshot: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleAPIReview(t *testing.T) {
+	path := setupReviewTest(t)
+	snap, _ := globalSessionStore.getSnapshot(path)
+	content, _ := os.ReadFile(path)
+	version := reviewVersion(snap.Content, string(content))
+
+	if rec := reviewAction(0, "accept", "stale"); rec.Code != http.StatusConflict {
+		t.Errorf("stale version: status = %d, want 409", rec.Code)
+	}
+	if rec := reviewAction(2, "accept", version); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown hunk: status = %d, want 400", rec.Code)
+	}
+
+	// Accepting keeps the file and moves the baseline
+	rec := reviewAction(0, "accept", version)
+	var resp apiReviewResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || resp.Remaining != 1 {
+		t.Fatalf("accept = %d %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := os.ReadFile(path); string(got) != string(content) {
+		t.Errorf("accepting changed the file to %q", got)
+	}
+
+	// Reverting writes the file back
+	rec = reviewAction(0, "revert", resp.Version)
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || resp.Remaining != 0 {
+		t.Fatalf("revert = %d %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := os.ReadFile(path); string(got) != "# Plan\n\nShip on Monday.\n\n## Risks\n\nNone.\n" {
+		t.Errorf("file after revert = %q", got)
+	}
+}
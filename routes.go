@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Methods a route answers. HEAD runs the GET handler, which skips its side
+// effects (isHeadRequest); streams leave HEAD out, as it would hold the
+// connection open. Every route answers OPTIONS with its Allow header.
+var (
+	methodsGet              = []string{http.MethodGet, http.MethodHead}
+	methodsPost             = []string{http.MethodPost}
+	methodsGetPost          = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	methodsGetPut           = []string{http.MethodGet, http.MethodHead, http.MethodPut}
+	methodsGetPostDelete    = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodDelete}
+	methodsGetPostPutDelete = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
+	methodsStream           = []string{http.MethodGet}
+)
+
+// allowHeader lists methods for an Allow header, with OPTIONS last
+func allowHeader(methods []string) string {
+	return strings.Join(append(slices.Clip(methods), http.MethodOptions), ", ")
+}
+
+// headRequestKey marks the context of a HEAD request the GET handler answers
+type headRequestKey struct{}
+
+// isHeadRequest reports whether r is a HEAD request run as GET. Handlers
+// answer it like GET, without side effects such as opening a tab or ending
+// --once: tools probe the server with it.
+func isHeadRequest(r *http.Request) bool {
+	head, _ := r.Context().Value(headRequestKey{}).(bool)
+	return head
+}
+
+// withMethods answers requests with a method outside methods with 405 and an
+// Allow header, and OPTIONS with 204 and the same header. HEAD runs the GET
+// handler: the server sends its headers (Content-Length, Last-Modified, ...)
+// and drops the body.
+func withMethods(methods []string, next http.HandlerFunc) http.HandlerFunc {
+	allow := allowHeader(methods)
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodOptions:
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodHead && slices.Contains(methods, http.MethodHead):
+			get := r.Clone(context.WithValue(r.Context(), headRequestKey{}, true))
+			get.Method = http.MethodGet
+			next(w, get)
+		case slices.Contains(methods, r.Method):
+			next(w, r)
+		default:
+			w.Header().Set("Allow", allow)
+			writeError(w, errCodeNotAllowed, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// middleware wraps a handler, e.g. to check, log or compress its requests
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// router registers handlers on a ServeMux behind a chain of middleware.
+// Patterns are ServeMux patterns, so handlers read path parameters with
+// r.PathValue ("/view/{path...}").
+type router struct {
+	mux        *http.ServeMux
+	middleware []middleware // Outermost first
+}
+
+// newRouter returns a router on a new ServeMux, with no middleware
+func newRouter() *router {
+	return &router{mux: http.NewServeMux()}
+}
+
+// with returns a router on the same mux whose routes also pass through mw,
+// inside rt's middleware
+func (rt *router) with(mw ...middleware) *router {
+	return &router{mux: rt.mux, middleware: append(slices.Clip(rt.middleware), mw...)}
+}
+
+// handle registers next for pattern, answering the given methods
+func (rt *router) handle(pattern string, methods []string, next http.HandlerFunc) {
+	h := withMethods(methods, next)
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		h = rt.middleware[i](h)
+	}
+	rt.mux.HandleFunc(pattern, h)
+}
+
+// ServeHTTP dispatches a request to its route
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// statusWriter records the status of a response for withRequestLog
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps live-update streams flowing through the wrapper
+func (w *statusWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap gives http.ResponseController the connection's own writer
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withRequestLog logs each request's method, path, status and duration
+// with --log-requests. Queries are left out: they may carry the access token.
+func withRequestLog(next http.HandlerFunc) http.HandlerFunc {
+	if !*logRequests {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		log.Printf("%s %s %d %s", r.Method, r.URL.Path, sw.status, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// gzipWriter compresses a response for withCompression, unless the handler
+// already encoded it, it has no body or it is an error (which withErrors
+// rewrites)
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" && code >= http.StatusOK && code < http.StatusBadRequest && code != http.StatusNoContent && code != http.StatusNotModified {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b)) // Before compression hides the content
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// Flush sends what was compressed so far
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap gives http.ResponseController the connection's own writer
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close ends the compressed stream
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		_ = w.gz.Close()
+	}
+}
+
+// withCompression gzips responses for clients that accept it. Not for byte
+// ranges or streams: /raw and /events are served as they are.
+func withCompression(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+		next(gw, r)
+	}
+}
+
+// acceptsGzip reports whether the client's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// etagWriter holds back a successful response for withETag to tag, unless
+// the handler streams it (flushes)
+type etagWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	direct bool // Written through as it comes: an error, or a stream
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+	if w.direct || code != http.StatusOK {
+		w.direct = true
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.direct {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Flush sends what was held back and the rest as it comes, without an ETag
+func (w *etagWriter) Flush() {
+	if !w.direct {
+		w.direct = true
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+			_, _ = w.body.WriteTo(w.ResponseWriter)
+		}
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap gives http.ResponseController the connection's own writer
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withETag tags successful GET and HEAD responses with a weak ETag of their
+// body, or keeps the handler's own, and answers a matching If-None-Match with
+// 304. Streamed pages (large documents) go out untagged.
+func withETag(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next(w, r)
+			return
+		}
+		ew := &etagWriter{ResponseWriter: w}
+		next(ew, r)
+		if ew.direct || ew.status == 0 {
+			return
+		}
+		h := w.Header()
+		if h.Get("ETag") == "" {
+			sum := sha256.Sum256(ew.body.Bytes())
+			h.Set("ETag", fmt.Sprintf(`W/"%x"`, sum[:16]))
+		}
+		if etagMatches(r.Header.Get("If-None-Match"), h.Get("ETag")) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = ew.body.WriteTo(w)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 asks for GET
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithMethods(t *testing.T) {
+	var gotMethod string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		if isHeadRequest(r) {
+			gotMethod += " for HEAD"
+		}
+		w.Write([]byte("hello"))
+	}
+	tests := []struct {
+		name       string
+		methods    []string
+		method     string
+		wantCode   int
+		wantMethod string // Seen by the handler, "" when not called
+		wantAllow  string
+	}{
+		{"allowed", methodsGetPost, http.MethodPost, http.StatusOK, http.MethodPost, ""},
+		{"head runs get", methodsGet, http.MethodHead, http.StatusOK, "GET for HEAD", ""},
+		{"head without get", methodsPost, http.MethodHead, http.StatusMethodNotAllowed, "", "POST, OPTIONS"},
+		{"no head on streams", methodsStream, http.MethodHead, http.StatusMethodNotAllowed, "", "GET, OPTIONS"},
+		{"not allowed", methodsGetPut, http.MethodDelete, http.StatusMethodNotAllowed, "", "GET, HEAD, PUT, OPTIONS"},
+		{"options", methodsGetPostDelete, http.MethodOptions, http.StatusNoContent, "", "GET, HEAD, POST, DELETE, OPTIONS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotMethod = ""
+			w := httptest.NewRecorder()
+			withMethods(tt.methods, handler)(w, httptest.NewRequest(tt.method, "/x", nil))
+			if w.Code != tt.wantCode || gotMethod != tt.wantMethod {
+				t.Errorf("status = %d, handler saw %q; want %d, %q", w.Code, gotMethod, tt.wantCode, tt.wantMethod)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestWithMethodsHead(t *testing.T) {
+	server := httptest.NewServer(withMethods(methodsGet, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("# Hello\n"))
+	}))
+	defer server.Close()
+
+	resp, err := http.Head(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != 8 || len(body) != 0 {
+		t.Errorf("HEAD = %d, Content-Length %d, body %q", resp.StatusCode, resp.ContentLength, body)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var order []string
+	trace := func(name string) middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next(w, r)
+			}
+		}
+	}
+	base := newRouter().with(trace("outer"))
+	base.with(trace("inner")).handle("/files/{path...}", methodsGet, func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+		w.Write([]byte(r.PathValue("path")))
+	})
+	base.handle("/plain", methodsPost, func(w http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	base.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/files/docs/a%20b.md", nil))
+	if rec.Body.String() != "docs/a b.md" || strings.Join(order, ",") != "outer,inner,handler" {
+		t.Errorf("path = %q, order = %v", rec.Body.String(), order)
+	}
+
+	// Groups don't leak middleware into each other, and methods are checked
+	order = nil
+	rec = httptest.NewRecorder()
+	base.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plain", nil))
+	if rec.Code != http.StatusMethodNotAllowed || strings.Join(order, ",") != "outer" {
+		t.Errorf("status = %d, order = %v", rec.Code, order)
+	}
+}
+
+func TestRoutesMethods(t *testing.T) {
+	handler := routes()
+	tests := []struct {
+		method, target, wantAllow string
+	}{
+		{http.MethodGet, "/api/preview", "POST, OPTIONS"},
+		{http.MethodPatch, "/api/bookmarks", "GET, HEAD, POST, PUT, DELETE, OPTIONS"},
+		{http.MethodPatch, "/api/comments", "GET, HEAD, POST, PUT, DELETE, OPTIONS"},
+		{http.MethodDelete, "/api/follow", "GET, HEAD, POST, OPTIONS"},
+		{http.MethodDelete, "/api/position?path=docs/spec.md", "GET, HEAD, POST, OPTIONS"},
+		{http.MethodPut, "/api/tabs", "GET, HEAD, POST, DELETE, OPTIONS"},
+		{http.MethodDelete, "/api/tree-state", "GET, HEAD, PUT, OPTIONS"},
+		{http.MethodGet, "/save", "POST, OPTIONS"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != tt.wantAllow {
+			t.Errorf("%s %s = %d, Allow %q; want 405, %q", tt.method, tt.target, rec.Code, rec.Header().Get("Allow"), tt.wantAllow)
+		}
+	}
+}
+
+func TestRoutesAccessToken(t *testing.T) {
+	accessToken = "secret"
+	defer func() { accessToken = "" }()
+	handler := routes()
+
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{"/view/a.md", http.StatusUnauthorized},
+		{"/api/tree", http.StatusUnauthorized},
+		{"/s/a.md?expires=1&sig=00", http.StatusForbidden}, // Share links carry their own signature
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.RemoteAddr = "192.168.1.20:5000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.target, rec.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestWithCompression(t *testing.T) {
+	page := strings.Repeat("<p>Hello</p>\n", 100)
+	handler := withCompression(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(page))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(gz); string(body) != page {
+		t.Errorf("body = %q", body)
+	}
+
+	// Not for clients that don't accept it, or responses without a body
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != page {
+		t.Errorf("uncompressed response = %v", rec.Header())
+	}
+	req = httptest.NewRequest(http.MethodGet, "/empty", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 0 {
+		t.Errorf("204 response = %v, %q", rec.Header(), rec.Body.String())
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"deflate, GZIP;q=1": true,
+		"gzip;q=0":          false,
+		"br":                false,
+	}
+	for header, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", header)
+		if got := acceptsGzip(req); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestRoutesHead(t *testing.T) {
+	dir := serveTestFiles(t, "head", map[string]string{"a.md": "# A\n"})
+	useDirChangeGlobals(t, dir, []string{filepath.Join(dir, "a.md")})
+	prevOnce := *once
+	defer func() { *once = prevOnce }()
+	*once = true
+	handler := routes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/view/a.md", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Set-Cookie") != "" {
+		t.Errorf("HEAD /view/a.md = %d, Set-Cookie %q; want 200 without opening a tab", rec.Code, rec.Header().Get("Set-Cookie"))
+	}
+	select {
+	case <-firstPageServed:
+		t.Error("HEAD /view/a.md ended --once")
+	default:
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Error("HEAD /view/a.md has no ETag")
+	}
+	req := httptest.NewRequest(http.MethodHead, "/view/a.md", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("HEAD /view/a.md with its ETag = %d, want 304", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/events", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Errorf("HEAD /events = %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+// etagRequest sends a request to a withETag handler serving a page, a stream
+// and an error
+func etagRequest(method, target, ifNoneMatch string) *httptest.ResponseRecorder {
+	handler := withETag(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			w.Write([]byte("head"))
+			http.NewResponseController(w).Flush()
+			w.Write([]byte("tail"))
+		case "/missing":
+			http.Error(w, "Not found", http.StatusNotFound)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<p>Hello</p>"))
+		}
+	})
+	req := httptest.NewRequest(method, target, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestWithETag(t *testing.T) {
+	rec := etagRequest(http.MethodGet, "/page", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || rec.Body.String() != "<p>Hello</p>" {
+		t.Fatalf("GET = %d, ETag %q, body %q", rec.Code, etag, rec.Body.String())
+	}
+	for _, ifNoneMatch := range []string{etag, `"other", ` + strings.TrimPrefix(etag, "W/"), "*"} {
+		if rec := etagRequest(http.MethodGet, "/page", ifNoneMatch); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s = %d %q, want 304", ifNoneMatch, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := etagRequest(http.MethodGet, "/page", `W/"other"`); rec.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match = %d, want 200", rec.Code)
+	}
+
+	// Streams and errors go out as they are, untagged
+	for _, target := range []string{"/stream", "/missing"} {
+		if rec := etagRequest(http.MethodGet, target, "*"); rec.Header().Get("ETag") != "" || rec.Code == http.StatusNotModified {
+			t.Errorf("%s = %d, ETag %q", target, rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+	if rec := etagRequest(http.MethodGet, "/stream", ""); rec.Body.String() != "headtail" {
+		t.Errorf("stream body = %q", rec.Body.String())
+	}
+}
+
+func TestWithETagHead(t *testing.T) {
+	etag := etagRequest(http.MethodGet, "/page", "").Header().Get("ETag")
+	if rec := etagRequest(http.MethodHead, "/page", ""); rec.Code != http.StatusOK || rec.Header().Get("ETag") != etag {
+		t.Errorf("HEAD = %d, ETag %q; want 200 with the GET one %q", rec.Code, rec.Header().Get("ETag"), etag)
+	}
+	if rec := etagRequest(http.MethodHead, "/page", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("HEAD with a matching If-None-Match = %d, want 304", rec.Code)
+	}
+}
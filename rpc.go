@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// rpcProtocolVersion changes when an editor companion written against an
+// earlier version of /rpc would break
+const rpcProtocolVersion = 1
+
+// rpcMethods are the /rpc methods, the capabilities /api/version announces
+var rpcMethods = []string{"initialize", "openFile", "getRenderedHtml", "listFiles", "subscribeChanges"}
+
+// maxRPCBodySize caps /rpc request bodies
+const maxRPCBodySize = 64 << 10
+
+// subscribeChanges waits this long for events by default, and at most
+// maxSubscribeTimeout
+const (
+	defaultSubscribeTimeout = 25 * time.Second
+	maxSubscribeTimeout     = 60 * time.Second
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000 // The file can't be served or rendered
+)
+
+// rpcRequest is a JSON-RPC 2.0 request; one without an ID is a notification
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"` // "2.0"
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is the error of a failed JSON-RPC call
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiVersionResponse is returned by /api/version and the initialize method
+type apiVersionResponse struct {
+	Version      string   `json:"version"`
+	Commit       string   `json:"commit"`
+	Date         string   `json:"date"`
+	Protocol     int      `json:"protocol"`     // rpcProtocolVersion
+	Capabilities []string `json:"capabilities"` // /rpc methods
+}
+
+// rpcPathParams names a file for openFile and getRenderedHtml
+type rpcPathParams struct {
+	Path string `json:"path"` // Relative to the browsed directory
+}
+
+// rpcInitializeParams introduces an editor companion
+type rpcInitializeParams struct {
+	Client   string `json:"client"`   // e.g. "vscode-peekm 0.3.0"
+	Protocol int    `json:"protocol"` // rpcProtocolVersion the client was written against
+}
+
+// rpcOpenFileResult is returned by openFile
+type rpcOpenFileResult struct {
+	Path string `json:"path"`
+	URL  string `json:"url"` // /view/ URL, for opening a browser when none is connected
+}
+
+// rpcRenderedHTML is returned by getRenderedHtml
+type rpcRenderedHTML struct {
+	Path    string    `json:"path"`
+	HTML    string    `json:"html"` // Rendered HTML fragment
+	ModTime time.Time `json:"mtime"`
+}
+
+// rpcSubscribeParams selects the changes subscribeChanges waits for. Filters
+// are those of /events.
+type rpcSubscribeParams struct {
+	After     *string `json:"after"` // last_event_id of the previous call or of listFiles; absent for changes from now on
+	File      string  `json:"file"`
+	Dir       string  `json:"dir"`
+	Session   string  `json:"session"`
+	TimeoutMS int     `json:"timeout_ms"`
+}
+
+// rpcChanges is returned by subscribeChanges
+type rpcChanges struct {
+	Events      []rpcEvent `json:"events"`
+	LastEventID string     `json:"last_event_id"`    // after of the next call
+	Resync      bool       `json:"resync,omitempty"` // after is no longer buffered: call listFiles
+}
+
+// rpcEvent is a live-update event, as /events sends it
+type rpcEvent struct {
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data"`
+}
+
+// versionInfo describes this build and its /rpc capabilities
+func versionInfo() apiVersionResponse {
+	return apiVersionResponse{Version: version, Commit: commit, Date: date, Protocol: rpcProtocolVersion, Capabilities: rpcMethods}
+}
+
+// serveAPIVersion returns the build and the /rpc protocol it speaks
+func serveAPIVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, versionInfo())
+}
+
+// handleRPC serves the JSON-RPC 2.0 surface for editor companions (POST
+// /rpc). Errors are JSON-RPC errors; notifications are answered with 204.
+func handleRPC(w http.ResponseWriter, r *http.Request) {
+	var req rpcRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRPCBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusOK, rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: "Invalid JSON (batches are not supported)"}})
+		return
+	}
+
+	var result any
+	var rpcErr *rpcError
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		rpcErr = &rpcError{Code: rpcInvalidRequest, Message: "Not a JSON-RPC 2.0 request"}
+	} else {
+		result, rpcErr = callRPC(r, req.Method, req.Params)
+	}
+	if len(req.ID) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp := rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}
+	if rpcErr == nil && result == nil {
+		resp.Result = struct{}{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// callRPC runs a method with its JSON params
+func callRPC(r *http.Request, method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "initialize":
+		var p rpcInitializeParams
+		if err := decodeRPCParams(params, &p); err != nil {
+			return nil, err
+		}
+		log.Printf("Editor companion connected: %s (protocol %d)", p.Client, p.Protocol)
+		return versionInfo(), nil
+	case "openFile":
+		return rpcOpenFile(params)
+	case "getRenderedHtml":
+		return rpcGetRenderedHTML(params)
+	case "listFiles":
+		return resyncState(), nil
+	case "subscribeChanges":
+		return rpcSubscribeChanges(r, params)
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: "Unknown method " + method}
+}
+
+// decodeRPCParams reads params into v; missing params leave v as is
+func decodeRPCParams(params json.RawMessage, v any) *rpcError {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+// rpcFile resolves the served markdown file of path params
+func rpcFile(params json.RawMessage) (absPath, relPath string, rpcErr *rpcError) {
+	var p rpcPathParams
+	if err := decodeRPCParams(params, &p); err != nil {
+		return "", "", err
+	}
+	validated, e := whitelistedPath(p.Path)
+	switch {
+	case e == nil:
+		return validated, filepath.ToSlash(getRelativePath(validated)), nil
+	case e.Status == http.StatusBadRequest:
+		return "", "", &rpcError{Code: rpcInvalidParams, Message: e.Message}
+	}
+	return "", "", &rpcError{Code: rpcServerError, Message: "File not found or access denied"}
+}
+
+// rpcOpenFile shows a file in the connected browsers, as follow mode does.
+// The request is not replayed: it is stale by the time a browser reconnects.
+func rpcOpenFile(params json.RawMessage) (any, *rpcError) {
+	_, relPath, rpcErr := rpcFile(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	msgBytes, err := json.Marshal(followMessage{Type: "navigate", Path: relPath})
+	if err != nil {
+		log.Printf("Error marshaling navigate message: %v", err)
+		return nil, &rpcError{Code: rpcServerError, Message: "Failed to open file"}
+	}
+	notifyClientsUnbuffered(string(msgBytes))
+	return rpcOpenFileResult{Path: relPath, URL: viewURL(relPath)}, nil
+}
+
+// rpcGetRenderedHTML renders a file as the page shows it
+func rpcGetRenderedHTML(params json.RawMessage) (any, *rpcError) {
+	absPath, relPath, rpcErr := rpcFile(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, &rpcError{Code: rpcServerError, Message: "Failed to read file"}
+	}
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, &rpcError{Code: rpcServerError, Message: "Failed to read file"}
+	}
+	rendered, err := renderFile(absPath, content)
+	if err != nil {
+		return nil, &rpcError{Code: rpcServerError, Message: "Failed to render markdown"}
+	}
+	return rpcRenderedHTML{Path: relPath, HTML: rendered, ModTime: info.ModTime()}, nil
+}
+
+// rpcSubscribeChanges long-polls the live-update events: it returns the
+// events after params.after that pass the filters as soon as there are
+// any, or none once the timeout is up
+func rpcSubscribeChanges(r *http.Request, params json.RawMessage) (any, *rpcError) {
+	var p rpcSubscribeParams
+	if err := decodeRPCParams(params, &p); err != nil {
+		return nil, err
+	}
+	timeout := defaultSubscribeTimeout
+	if p.TimeoutMS > 0 {
+		timeout = min(time.Duration(p.TimeoutMS)*time.Millisecond, maxSubscribeTimeout)
+	}
+	filter := eventFilter{File: cleanEventPath(p.File), Dir: cleanEventPath(p.Dir), Session: p.Session}
+	after := globalEventBuffer.lastID()
+	if p.After != nil {
+		after = *p.After
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		added := globalEventBuffer.next() // Before reading, so no event slips through
+		changes := changesAfter(after, filter)
+		if len(changes.Events) > 0 || changes.Resync {
+			return changes, nil
+		}
+		after = changes.LastEventID
+		select {
+		case <-added:
+		case <-deadline.C:
+			return changes, nil
+		case <-r.Context().Done():
+			return changes, nil
+		}
+	}
+}
+
+// changesAfter collects the buffered events after the event with ID after
+// that pass filter
+func changesAfter(after string, filter eventFilter) rpcChanges {
+	changes := rpcChanges{Events: []rpcEvent{}, LastEventID: after}
+	events, found := globalEventBuffer.getAfter(after)
+	if !found {
+		changes.Resync, changes.LastEventID = true, globalEventBuffer.lastID()
+		return changes
+	}
+	for _, evt := range events {
+		changes.LastEventID = evt.id
+		if !filter.matches(eventScopeOf(evt.data)) {
+			continue
+		}
+		data := json.RawMessage(evt.data)
+		if !json.Valid(data) {
+			data, _ = json.Marshal(evt.data) // e.g. "reload"
+		}
+		changes.Events = append(changes.Events, rpcEvent{ID: evt.id, Data: data})
+	}
+	return changes
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// callRPCHandler posts body to /rpc and returns the decoded response
+func callRPCHandler(t *testing.T, body string) (int, rpcResponse, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleRPC(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)))
+	var resp rpcResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, resp, w.Body.String()
+}
+
+// setupRPCTest serves docs/a.md from a directory under $HOME (safepath
+// allows no other), next to an unserved secret.md, and returns a connected
+// browser
+func setupRPCTest(t *testing.T) *sseClient {
+	t.Helper()
+	dir := serveTestFiles(t, "rpc", map[string]string{"docs/a.md": "# Hello\n"})
+	os.WriteFile(filepath.Join(dir, "secret.md"), []byte("# Not served\n"), 0644)
+	return useDirChangeGlobals(t, dir, []string{filepath.Join(dir, "docs", "a.md")})
+}
+
+func TestHandleRPC(t *testing.T) {
+	setupRPCTest(t)
+	tests := []struct {
+		name      string
+		body      string
+		wantError int    // JSON-RPC error code, 0 for a result
+		wantBody  string // In the response
+	}{
+		{"initialize", `{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"client": "test", "protocol": 1}}`, 0, `"capabilities":["initialize","openFile"`},
+		{"rendered html", `{"jsonrpc": "2.0", "id": "r", "method": "getRenderedHtml", "params": {"path": "docs/a.md"}}`, 0, `"path":"docs/a.md","html":`},
+		{"list files", `{"jsonrpc": "2.0", "id": 2, "method": "listFiles"}`, 0, `"files":["docs/a.md"]`},
+		{"file not served", `{"jsonrpc": "2.0", "id": 3, "method": "getRenderedHtml", "params": {"path": "secret.md"}}`, rpcServerError, ""},
+		{"missing path", `{"jsonrpc": "2.0", "id": 4, "method": "openFile", "params": {}}`, rpcInvalidParams, ""},
+		{"invalid params", `{"jsonrpc": "2.0", "id": 5, "method": "openFile", "params": {"path": 1}}`, rpcInvalidParams, ""},
+		{"unknown method", `{"jsonrpc": "2.0", "id": 6, "method": "format"}`, rpcMethodNotFound, ""},
+		{"not JSON-RPC 2.0", `{"id": 7, "method": "listFiles"}`, rpcInvalidRequest, ""},
+		{"invalid JSON", `{"jsonrpc": "2.0",`, rpcParseError, `"id":null`},
+		{"batch", `[{"jsonrpc": "2.0", "id": 8, "method": "listFiles"}]`, rpcParseError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp, body := callRPCHandler(t, tt.body)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			switch {
+			case tt.wantError == 0 && resp.Error != nil:
+				t.Errorf("error = %+v", resp.Error)
+			case tt.wantError != 0 && (resp.Error == nil || resp.Error.Code != tt.wantError):
+				t.Errorf("error = %+v, want code %d", resp.Error, tt.wantError)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("response = %s, want %s in it", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRPCOpenFile(t *testing.T) {
+	client := setupRPCTest(t)
+
+	// The browsers navigate without a replayable event
+	_, resp, body := callRPCHandler(t, `{"jsonrpc": "2.0", "id": 9, "method": "openFile", "params": {"path": "/docs/a.md"}}`)
+	if resp.Error != nil || !strings.Contains(body, `"url":"/view/docs/a.md"`) {
+		t.Errorf("openFile = %s", body)
+	}
+	select {
+	case msg := <-client.ch:
+		if msg != `data: {"type":"navigate","path":"docs/a.md"}` {
+			t.Errorf("event = %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no navigate event")
+	}
+	if globalEventBuffer.lastID() != "" {
+		t.Error("openFile event was buffered for replay")
+	}
+
+	// Notifications get no response
+	if code, _, _ := callRPCHandler(t, `{"jsonrpc": "2.0", "method": "openFile", "params": {"path": "docs/a.md"}}`); code != http.StatusNoContent {
+		t.Errorf("notification status = %d, want 204", code)
+	}
+}
+
+func TestServeAPIVersion(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveAPIVersion(w, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	var resp apiVersionResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Version != version || resp.Protocol != rpcProtocolVersion || !slices.Equal(resp.Capabilities, rpcMethods) {
+		t.Errorf("/api/version = %+v", resp)
+	}
+
+	// Every announced method is implemented
+	for _, method := range rpcMethods {
+		if method == "subscribeChanges" {
+			continue // Waits for events
+		}
+		if _, err := callRPC(httptest.NewRequest(http.MethodPost, "/rpc", nil), method, nil); err != nil && err.Code == rpcMethodNotFound {
+			t.Errorf("%s is announced but not implemented", method)
+		}
+	}
+}
+
+func TestRPCSubscribeChanges(t *testing.T) {
+	useDirChangeGlobals(t, t.TempDir(), nil)
+	subscribe := func(ctx context.Context, params string) rpcChanges {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/rpc", nil).WithContext(ctx)
+		result, err := callRPC(req, "subscribeChanges", json.RawMessage(params))
+		if err != nil {
+			t.Fatalf("subscribeChanges(%s) error = %+v", params, err)
+		}
+		return result.(rpcChanges)
+	}
+
+	// Nothing happens: the timeout returns no events
+	if changes := subscribe(context.Background(), `{"timeout_ms": 10}`); len(changes.Events) != 0 || changes.LastEventID != "" || changes.Resync {
+		t.Errorf("idle changes = %+v", changes)
+	}
+
+	// Buffered events after the cursor that pass the filter come at once
+	notifyClientsWithMessage(`{"type":"file_modified","path":"docs/a.md"}`)
+	notifyClientsWithMessage(`{"type":"file_modified","path":"b.md"}`)
+	notifyClientsWithMessage("reload")
+	changes := subscribe(context.Background(), `{"after": "", "dir": "docs"}`)
+	if len(changes.Events) != 2 || changes.Events[0].ID != "1" || string(changes.Events[1].Data) != `"reload"` || changes.LastEventID != "3" {
+		t.Errorf("buffered changes = %+v", changes)
+	}
+
+	// Otherwise the call waits for the next matching event
+	ctx, cancel := context.WithCancel(context.Background())
+	notified := make(chan struct{})
+	go func() {
+		defer close(notified)
+		time.Sleep(20 * time.Millisecond)
+		notifyClientsWithMessage(`{"type":"file_modified","path":"b.md"}`)
+		notifyClientsWithMessage(`{"type":"file_modified","path":"docs/c.md"}`)
+	}()
+	changes = subscribe(ctx, `{"after": "3", "file": "docs/c.md", "timeout_ms": 5000}`)
+	cancel()
+	<-notified // Done with the globals before the cleanup restores them
+	if len(changes.Events) != 1 || changes.Events[0].ID != "5" {
+		t.Errorf("awaited changes = %+v", changes)
+	}
+
+	// A cursor no longer buffered asks for a resync
+	if changes := subscribe(context.Background(), `{"after": "99"}`); !changes.Resync || changes.LastEventID != "5" {
+		t.Errorf("changes after an unknown event = %+v", changes)
+	}
+}
@@ -0,0 +1,109 @@
+// Package safepath resolves user-supplied paths and enforces peekm's security
+// boundary: every path that is served or watched must live under $HOME.
+package safepath
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Errors returned by Resolve. A path that does not exist matches
+// os.ErrNotExist.
+var (
+	ErrOutsideHome = errors.New("access denied: path must be within home directory")
+	ErrNoHomeDir   = errors.New("cannot determine home directory")
+)
+
+// Resolve validates and resolves a path with security checks.
+// It expands ~, cleans and absolutizes the path, resolves symlinks, and rejects
+// anything outside the home directory. Returns the validated absolute path.
+func Resolve(targetPath string) (string, error) {
+	// Expand ~ to home directory
+	if strings.HasPrefix(targetPath, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrNoHomeDir, err)
+		}
+		targetPath = filepath.Join(homeDir, targetPath[2:])
+	} else if targetPath == "~" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrNoHomeDir, err)
+		}
+		targetPath = homeDir
+	}
+
+	// Clean the path to prevent traversal
+	targetPath = filepath.Clean(targetPath)
+
+	// Make absolute if relative
+	if !filepath.IsAbs(targetPath) {
+		absPath, err := filepath.Abs(targetPath)
+		if err != nil {
+			return "", fmt.Errorf("invalid path: %w", err)
+		}
+		targetPath = absPath
+	}
+
+	// Resolve symlinks
+	resolvedPath, err := filepath.EvalSymlinks(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("path does not exist: %w", err)
+	}
+	targetPath = resolvedPath
+
+	// Security: Restrict to $HOME directory
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNoHomeDir, err)
+	}
+	if !strings.HasPrefix(targetPath, homeDir) {
+		return "", ErrOutsideHome
+	}
+
+	return targetPath, nil
+}
+
+// CheckSymlink checks if a symlink is safe to follow.
+// Returns the resolved FileInfo and whether to skip (for directories).
+// Non-symlinks are returned unchanged.
+func CheckSymlink(path string, info os.FileInfo, homeDir string) (os.FileInfo, bool, error) {
+	if info.Mode()&os.ModeSymlink == 0 {
+		return info, false, nil // Not a symlink, OK to proceed
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		log.Printf("Warning: Skipping unresolvable symlink: %s", path)
+		return nil, false, err
+	}
+
+	// Check if resolved path is within $HOME
+	if homeDir != "" && !strings.HasPrefix(resolved, homeDir) {
+		log.Printf("Security: Skipping symlink outside home directory: %s -> %s", path, resolved)
+		return nil, false, fmt.Errorf("symlink outside home")
+	}
+
+	// Update info to reflect the resolved target
+	resolvedInfo, err := os.Stat(resolved)
+	if err != nil {
+		log.Printf("Warning: Cannot stat symlink target: %s", resolved)
+		return nil, false, err
+	}
+
+	return resolvedInfo, false, nil
+}
+
+// WithinHome reports whether path (after resolving symlinks) is inside $HOME
+func WithinHome(path string) bool {
+	homeDir, _ := os.UserHomeDir()
+	if homeDir == "" {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	return err == nil && strings.HasPrefix(resolved, homeDir)
+}
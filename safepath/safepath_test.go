@@ -0,0 +1,152 @@
+package safepath
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestResolve tests the path validation and security checks
+func TestResolve(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("cannot get home directory: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		input       string
+		wantErr     bool
+		errContains string
+		setup       func() (string, func()) // Returns test path and cleanup function
+	}{
+		{
+			name: "valid path with tilde",
+			setup: func() (string, func()) {
+				testPath := filepath.Join(homeDir, "peekm_test_tilde")
+				os.Mkdir(testPath, 0755)
+				cleanup := func() { os.Remove(testPath) }
+				return "~/peekm_test_tilde", cleanup
+			},
+			wantErr: false,
+		},
+		{
+			name:    "tilde only expands to home",
+			input:   "~",
+			wantErr: false,
+		},
+		{
+			name:        "path outside home directory - /etc",
+			input:       "/etc/passwd",
+			wantErr:     true,
+			errContains: "access denied",
+		},
+		{
+			name:        "path outside home directory - /tmp",
+			input:       "/tmp",
+			wantErr:     true,
+			errContains: "access denied",
+		},
+		{
+			name:        "path traversal attack",
+			input:       filepath.Join(homeDir, "docs/../../../etc/passwd"),
+			wantErr:     true,
+			errContains: "access denied",
+		},
+		{
+			name: "symlink pointing outside home",
+			setup: func() (string, func()) {
+				linkPath := filepath.Join(homeDir, "test_evil_symlink")
+				os.Symlink("/etc/passwd", linkPath)
+				cleanup := func() {
+					os.Remove(linkPath)
+				}
+				return linkPath, cleanup
+			},
+			wantErr:     true,
+			errContains: "access denied",
+		},
+		{
+			name: "symlink pointing inside home (valid)",
+			setup: func() (string, func()) {
+				targetPath := filepath.Join(homeDir, "test_target")
+				os.WriteFile(targetPath, []byte("test"), 0644)
+				linkPath := filepath.Join(homeDir, "test_good_symlink")
+				os.Symlink(targetPath, linkPath)
+				cleanup := func() {
+					os.Remove(linkPath)
+					os.Remove(targetPath)
+				}
+				return linkPath, cleanup
+			},
+			wantErr: false,
+		},
+		{
+			name:        "non-existent path",
+			input:       filepath.Join(homeDir, "nonexistent_dir_12345_test"),
+			wantErr:     true,
+			errContains: "does not exist",
+		},
+		{
+			name: "valid absolute path in home",
+			setup: func() (string, func()) {
+				testPath := filepath.Join(homeDir, "test_valid_path")
+				os.Mkdir(testPath, 0755)
+				cleanup := func() {
+					os.Remove(testPath)
+				}
+				return testPath, cleanup
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testInput := tt.input
+			var cleanup func()
+
+			if tt.setup != nil {
+				var setupPath string
+				setupPath, cleanup = tt.setup()
+				if cleanup != nil {
+					defer cleanup()
+				}
+				testInput = setupPath
+			}
+
+			result, err := Resolve(testInput)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got nil")
+				} else if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("error %q does not contain %q", err.Error(), tt.errContains)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if result != "" && !strings.HasPrefix(result, homeDir) {
+					t.Errorf("result %q not in home directory %q", result, homeDir)
+				}
+			}
+		})
+	}
+}
+
+// TestResolveErrors tests that Resolve's errors match its sentinels
+func TestResolveErrors(t *testing.T) {
+	if _, err := Resolve("/"); !errors.Is(err, ErrOutsideHome) {
+		t.Errorf("Resolve(/) error = %v, want ErrOutsideHome", err)
+	}
+	if _, err := Resolve(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Resolve(missing) error = %v, want os.ErrNotExist", err)
+	}
+	t.Setenv("HOME", "")
+	if _, err := Resolve("~/notes"); !errors.Is(err, ErrNoHomeDir) {
+		t.Errorf("Resolve(~/notes) without $HOME error = %v, want ErrNoHomeDir", err)
+	}
+}
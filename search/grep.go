@@ -0,0 +1,147 @@
+package search
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxSnippet is the longest LineMatch.Snippet, in bytes; longer lines are cut
+// around the match
+const maxSnippet = 160
+
+// PatternOptions select how Compile reads a query
+type PatternOptions struct {
+	Regex         bool // The query is a regular expression (RE2 syntax), not literal text
+	Word          bool // Matches must be whole words
+	CaseSensitive bool
+}
+
+// Pattern matches a query line by line, like grep
+type Pattern struct {
+	re    *regexp.Regexp
+	word  bool
+	regex bool
+}
+
+// LineMatch is one occurrence of a Pattern
+type LineMatch struct {
+	Line    int    `json:"line"`    // 1-based
+	Column  int    `json:"column"`  // 1-based, in characters
+	Length  int    `json:"length"`  // In characters
+	Snippet string `json:"snippet"` // The line, trimmed (and cut around the match when long)
+}
+
+// LineChange is a line rewritten by Replace
+type LineChange struct {
+	Line         int    `json:"line"` // 1-based
+	Before       string `json:"before"`
+	After        string `json:"after"`
+	Replacements int    `json:"replacements"`
+}
+
+// Compile builds the Pattern for query
+func Compile(query string, opts PatternOptions) (*Pattern, error) {
+	expr := query
+	if !opts.Regex {
+		expr = regexp.QuoteMeta(query)
+	}
+	if !opts.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{re: re, word: opts.Word, regex: opts.Regex}, nil
+}
+
+// Find returns the matches in content, at most limit (0 for all). Empty
+// matches are skipped, and a match never spans lines.
+func (p *Pattern) Find(content []byte, limit int) []LineMatch {
+	var matches []LineMatch
+	for lineNum, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		for _, loc := range p.re.FindAllIndex(line, -1) {
+			if loc[0] == loc[1] || (p.word && !isWholeWord(line, loc[0], loc[1])) {
+				continue
+			}
+			matches = append(matches, LineMatch{
+				Line:    lineNum + 1,
+				Column:  utf8.RuneCount(line[:loc[0]]) + 1,
+				Length:  utf8.RuneCount(line[loc[0]:loc[1]]),
+				Snippet: snippet(line, loc[0], loc[1]),
+			})
+			if limit > 0 && len(matches) == limit {
+				return matches
+			}
+		}
+	}
+	return matches
+}
+
+// Replace replaces every match in content with replacement, returning the new
+// content and the changed lines. For regex patterns, $1 or ${name} in
+// replacement stand for submatches; otherwise it is literal text.
+func (p *Pattern) Replace(content []byte, replacement string) ([]byte, []LineChange) {
+	var out []byte
+	var changes []LineChange
+	for lineNum, line := range bytes.SplitAfter(content, []byte("\n")) {
+		text := bytes.TrimRight(line, "\r\n")
+		eol := line[len(text):]
+		var rewritten []byte
+		count, last := 0, 0
+		for _, loc := range p.re.FindAllSubmatchIndex(text, -1) {
+			if loc[0] == loc[1] || (p.word && !isWholeWord(text, loc[0], loc[1])) {
+				continue
+			}
+			rewritten = append(rewritten, text[last:loc[0]]...)
+			if p.regex {
+				rewritten = p.re.Expand(rewritten, []byte(replacement), text, loc)
+			} else {
+				rewritten = append(rewritten, replacement...)
+			}
+			count, last = count+1, loc[1]
+		}
+		if count == 0 {
+			out = append(out, line...)
+			continue
+		}
+		rewritten = append(rewritten, text[last:]...)
+		changes = append(changes, LineChange{Line: lineNum + 1, Before: string(text), After: string(rewritten), Replacements: count})
+		out = append(append(out, rewritten...), eol...)
+	}
+	return out, changes
+}
+
+// isWholeWord reports whether line[start:end] is not part of a longer word.
+// Unlike RE2's \b, letters outside ASCII count as word characters.
+func isWholeWord(line []byte, start, end int) bool {
+	before, _ := utf8.DecodeLastRune(line[:start])
+	after, _ := utf8.DecodeRune(line[end:])
+	return !isWordRune(before) && !isWordRune(after)
+}
+
+// isWordRune reports whether r is a letter, digit or underscore
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// snippet returns line trimmed, or the part of it around line[start:end] if
+// that is longer than maxSnippet
+func snippet(line []byte, start, end int) string {
+	if len(line) > maxSnippet {
+		from := max(0, min(start-(maxSnippet-(end-start))/2, len(line)-maxSnippet))
+		to := min(len(line), max(from+maxSnippet, end))
+		for from > 0 && !utf8.RuneStart(line[from]) {
+			from--
+		}
+		for to < len(line) && !utf8.RuneStart(line[to]) {
+			to++
+		}
+		line = line[from:to]
+	}
+	return strings.TrimSpace(string(line))
+}
@@ -0,0 +1,120 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatternFind(t *testing.T) {
+	content := "# Cache\n\nThe cache caches pages; Cache-Control too.\r\nCafé and caféine.\n"
+	tests := []struct {
+		name  string
+		query string
+		opts  PatternOptions
+		limit int
+		want  []LineMatch
+	}{
+		{"literal, any case", "cache", PatternOptions{}, 0, []LineMatch{
+			{Line: 1, Column: 3, Length: 5, Snippet: "# Cache"},
+			{Line: 3, Column: 5, Length: 5, Snippet: "The cache caches pages; Cache-Control too."},
+			{Line: 3, Column: 11, Length: 5, Snippet: "The cache caches pages; Cache-Control too."},
+			{Line: 3, Column: 25, Length: 5, Snippet: "The cache caches pages; Cache-Control too."},
+		}},
+		{"case-sensitive", "Cache", PatternOptions{CaseSensitive: true}, 0, []LineMatch{
+			{Line: 1, Column: 3, Length: 5, Snippet: "# Cache"},
+			{Line: 3, Column: 25, Length: 5, Snippet: "The cache caches pages; Cache-Control too."},
+		}},
+		{"whole words", "cache", PatternOptions{Word: true, CaseSensitive: true}, 0, []LineMatch{
+			{Line: 3, Column: 5, Length: 5, Snippet: "The cache caches pages; Cache-Control too."},
+		}},
+		{"whole words outside ASCII", "café", PatternOptions{Word: true}, 0, []LineMatch{
+			{Line: 4, Column: 1, Length: 4, Snippet: "Café and caféine."},
+		}},
+		{"regex", `cach\w+`, PatternOptions{Regex: true}, 0, []LineMatch{
+			{Line: 1, Column: 3, Length: 5, Snippet: "# Cache"},
+			{Line: 3, Column: 5, Length: 5, Snippet: "The cache caches pages; Cache-Control too."},
+			{Line: 3, Column: 11, Length: 6, Snippet: "The cache caches pages; Cache-Control too."},
+			{Line: 3, Column: 25, Length: 5, Snippet: "The cache caches pages; Cache-Control too."},
+		}},
+		{"regex special characters as literal text", "pages;", PatternOptions{}, 0, []LineMatch{
+			{Line: 3, Column: 18, Length: 6, Snippet: "The cache caches pages; Cache-Control too."},
+		}},
+		{"empty matches skipped", `x*`, PatternOptions{Regex: true}, 0, nil},
+		{"limit", "cache", PatternOptions{}, 2, []LineMatch{
+			{Line: 1, Column: 3, Length: 5, Snippet: "# Cache"},
+			{Line: 3, Column: 5, Length: 5, Snippet: "The cache caches pages; Cache-Control too."},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.query, tt.opts)
+			if err != nil {
+				t.Fatalf("Compile(%q) error: %v", tt.query, err)
+			}
+			if got := p.Find([]byte(content), tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatternErrorsAndSnippets(t *testing.T) {
+	if _, err := Compile("(unclosed", PatternOptions{Regex: true}); err == nil {
+		t.Error("Compile() accepted an invalid regex")
+	}
+
+	line := strings.Repeat("a ", 200) + "needle" + strings.Repeat(" b", 200)
+	p, _ := Compile("needle", PatternOptions{})
+	matches := p.Find([]byte(line), 0)
+	if len(matches) != 1 || matches[0].Column != 401 {
+		t.Fatalf("Find() = %+v, want one match at column 401", matches)
+	}
+	if s := matches[0].Snippet; len(s) > maxSnippet || !strings.Contains(s, "needle") {
+		t.Errorf("snippet of a long line = %q, want at most %d bytes around the match", s, maxSnippet)
+	}
+}
+
+func TestPatternReplace(t *testing.T) {
+	content := "Old widget, old-widget.\r\nNo match here.\nWidgets: old widget\n"
+	tests := []struct {
+		name        string
+		query       string
+		replacement string
+		opts        PatternOptions
+		want        string
+		changes     []LineChange
+	}{
+		{"literal", "old widget", "new gadget", PatternOptions{}, "new gadget, old-widget.\r\nNo match here.\nWidgets: new gadget\n", []LineChange{
+			{Line: 1, Before: "Old widget, old-widget.", After: "new gadget, old-widget.", Replacements: 1},
+			{Line: 3, Before: "Widgets: old widget", After: "Widgets: new gadget", Replacements: 1},
+		}},
+		{"whole words, case-sensitive", "widget", "gizmo", PatternOptions{Word: true, CaseSensitive: true}, "Old gizmo, old-gizmo.\r\nNo match here.\nWidgets: old gizmo\n", []LineChange{
+			{Line: 1, Before: "Old widget, old-widget.", After: "Old gizmo, old-gizmo.", Replacements: 2},
+			{Line: 3, Before: "Widgets: old widget", After: "Widgets: old gizmo", Replacements: 1},
+		}},
+		{"regex submatches", `(\w+)-widget`, "${1}_gadget", PatternOptions{Regex: true}, "Old widget, old_gadget.\r\nNo match here.\nWidgets: old widget\n", []LineChange{
+			{Line: 1, Before: "Old widget, old-widget.", After: "Old widget, old_gadget.", Replacements: 1},
+		}},
+		{"literal $ in replacement", "widget", "$1", PatternOptions{Word: true}, "Old $1, old-$1.\r\nNo match here.\nWidgets: old $1\n", []LineChange{
+			{Line: 1, Before: "Old widget, old-widget.", After: "Old $1, old-$1.", Replacements: 2},
+			{Line: 3, Before: "Widgets: old widget", After: "Widgets: old $1", Replacements: 1},
+		}},
+		{"no match", "gizmo", "x", PatternOptions{}, content, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.query, tt.opts)
+			if err != nil {
+				t.Fatalf("Compile(%q) error: %v", tt.query, err)
+			}
+			got, changes := p.Replace([]byte(content), tt.replacement)
+			if string(got) != tt.want {
+				t.Errorf("Replace() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("changes = %+v, want %+v", changes, tt.changes)
+			}
+		})
+	}
+}
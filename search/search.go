@@ -0,0 +1,271 @@
+// Package search is a full-text inverted index over markdown files. Files are
+// added, replaced and removed one at a time, so the index follows edits
+// instead of being rebuilt, and it is saved and loaded with encoding/gob.
+package search
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// formatVersion changes whenever the saved format or the tokenizer changes
+const formatVersion = 1
+
+// maxTermLength drops longer "words" (hashes, base64) from the index
+const maxTermLength = 64
+
+// ErrVersion is returned by Load for an index saved by another format version
+var ErrVersion = errors.New("search index format changed")
+
+// Result is a file matching every term of a query
+type Result struct {
+	Path  string
+	Score float64
+}
+
+// document is an indexed file. ModTime and Size tell whether the file changed
+// since it was indexed.
+type document struct {
+	ModTime int64 // Unix nanoseconds
+	Size    int64
+	Length  int            // Number of terms
+	Terms   map[string]int // Term frequencies
+}
+
+// snapshot is the saved form of an Index; postings are rebuilt on load
+type snapshot struct {
+	Version int
+	Docs    map[string]*document
+}
+
+// Index maps terms to the files containing them; it is safe for concurrent use
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*document
+	postings map[string]map[string]int // Term -> path -> frequency
+	dirty    bool
+}
+
+// New returns an empty index
+func New() *Index {
+	return &Index{docs: make(map[string]*document), postings: make(map[string]map[string]int)}
+}
+
+// Load reads an index written by Save
+func Load(r io.Reader) (*Index, error) {
+	var snap snapshot
+	if err := gob.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, err
+	}
+	if snap.Version != formatVersion {
+		return nil, ErrVersion
+	}
+	idx := New()
+	for path, doc := range snap.Docs {
+		idx.docs[path] = doc
+		idx.addPostings(path, doc)
+	}
+	return idx, nil
+}
+
+// Save writes the index and marks it clean
+func (idx *Index) Save(w io.Writer) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := gob.NewEncoder(w).Encode(snapshot{Version: formatVersion, Docs: idx.docs}); err != nil {
+		return err
+	}
+	idx.dirty = false
+	return nil
+}
+
+// Dirty reports whether the index changed since it was loaded or saved
+func (idx *Index) Dirty() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.dirty
+}
+
+// Len returns the number of indexed files
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// Paths returns the indexed files, sorted
+func (idx *Index) Paths() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	paths := make([]string, 0, len(idx.docs))
+	for path := range idx.docs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Fresh reports whether path is indexed with this modification time and size
+func (idx *Index) Fresh(path string, modTime time.Time, size int64) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	doc, found := idx.docs[path]
+	return found && doc.ModTime == modTime.UnixNano() && doc.Size == size
+}
+
+// Update indexes content as the file at path, replacing what was indexed for it
+func (idx *Index) Update(path string, modTime time.Time, size int64, content []byte) {
+	doc := &document{ModTime: modTime.UnixNano(), Size: size, Terms: make(map[string]int)}
+	for _, term := range Terms(string(content)) {
+		doc.Terms[term]++
+		doc.Length++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(path)
+	idx.docs[path] = doc
+	idx.addPostings(path, doc)
+	idx.dirty = true
+}
+
+// Remove drops path from the index
+func (idx *Index) Remove(path string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, found := idx.docs[path]; found {
+		idx.removeLocked(path)
+		idx.dirty = true
+	}
+}
+
+// removeLocked drops path's postings and document; idx.mu must be held
+func (idx *Index) removeLocked(path string) {
+	doc, found := idx.docs[path]
+	if !found {
+		return
+	}
+	for term := range doc.Terms {
+		delete(idx.postings[term], path)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, path)
+}
+
+// addPostings records doc's terms for path; idx.mu must be held (or idx unshared)
+func (idx *Index) addPostings(path string, doc *document) {
+	for term, freq := range doc.Terms {
+		files := idx.postings[term]
+		if files == nil {
+			files = make(map[string]int)
+			idx.postings[term] = files
+		}
+		files[path] = freq
+	}
+}
+
+// Search returns up to limit files containing every term of query, best first.
+// The last term also matches as a prefix, so results follow typing. Scores are
+// TF-IDF, with a bonus for terms in the file name.
+func (idx *Index) Search(query string, limit int) []Result {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var scores map[string]float64
+	for i, term := range terms {
+		termScores := idx.termScores(term, i == len(terms)-1)
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for path, score := range scores {
+			if extra, found := termScores[path]; found {
+				scores[path] = score + extra
+			} else {
+				delete(scores, path)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for path, score := range scores {
+		results = append(results, Result{Path: path, Score: math.Round(score*1000) / 1000})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// termScores scores the files containing term (or, with prefix, a term
+// starting with it, keeping each file's best); idx.mu must be held
+func (idx *Index) termScores(term string, prefix bool) map[string]float64 {
+	scores := make(map[string]float64)
+	total := float64(len(idx.docs))
+	score := func(t string, files map[string]int) {
+		idf := math.Log(1 + total/float64(len(files)))
+		for path, freq := range files {
+			s := (1 + math.Log(float64(freq))) * idf
+			if inFileName(path, t) {
+				s += 2 * idf
+			}
+			scores[path] = max(scores[path], s)
+		}
+	}
+
+	if prefix {
+		for t, files := range idx.postings {
+			if strings.HasPrefix(t, term) {
+				score(t, files)
+			}
+		}
+	} else if files, found := idx.postings[term]; found {
+		score(term, files)
+	}
+	return scores
+}
+
+// inFileName reports whether term is one of the terms of path's file name
+func inFileName(path, term string) bool {
+	for _, t := range Terms(filepath.Base(path)) {
+		if t == term {
+			return true
+		}
+	}
+	return false
+}
+
+// Terms splits text into lower-case words of letters and digits. Single
+// characters and words longer than maxTermLength are left out.
+func Terms(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if n := utf8.RuneCountInString(word); n > 1 && n <= maxTermLength {
+			terms = append(terms, strings.ToLower(word))
+		}
+	}
+	return terms
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTerms(t *testing.T) {
+	got := Terms("# Café setup: run `go build ./...` (v2) — a x")
+	want := []string{"café", "setup", "run", "go", "build", "v2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms() = %q, want %q", got, want)
+	}
+}
+
+func newTestIndex() *Index {
+	idx := New()
+	mtime := time.Unix(1700000000, 0)
+	idx.Update("/docs/cache.md", mtime, 10, []byte("# Cache\n\nThe cache stores rendered pages. Cache misses render again."))
+	idx.Update("/docs/deploy.md", mtime, 20, []byte("# Deploy\n\nDeploy behind a reverse proxy with a warm cache."))
+	idx.Update("/docs/guide.md", mtime, 30, []byte("# Guide\n\nRender markdown and browse the tree."))
+	return idx
+}
+
+func paths(results []Result) []string {
+	var out []string
+	for _, r := range results {
+		out = append(out, r.Path)
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	idx := newTestIndex()
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{"ranks file name and frequency first", "cache", 0, []string{"/docs/cache.md", "/docs/deploy.md"}},
+		{"every term must match", "cache proxy", 0, []string{"/docs/deploy.md"}},
+		{"last term matches as a prefix", "rende", 0, []string{"/docs/cache.md", "/docs/guide.md"}},
+		{"earlier terms match whole words", "rende pages", 0, nil},
+		{"case-insensitive", "DEPLOY", 0, []string{"/docs/deploy.md"}},
+		{"limit", "cache", 1, []string{"/docs/cache.md"}},
+		{"no terms", "a !", 0, nil},
+		{"no match", "kubernetes", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paths(idx.Search(tt.query, tt.limit)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateAndRemove(t *testing.T) {
+	idx := newTestIndex()
+	mtime := time.Unix(1700000100, 0)
+
+	idx.Update("/docs/guide.md", mtime, 40, []byte("# Guide\n\nNow about caching."))
+	if got := paths(idx.Search("markdown", 0)); got != nil {
+		t.Errorf("old content still found: %q", got)
+	}
+	if got := paths(idx.Search("caching", 0)); !reflect.DeepEqual(got, []string{"/docs/guide.md"}) {
+		t.Errorf("new content = %q", got)
+	}
+	if !idx.Fresh("/docs/guide.md", mtime, 40) || idx.Fresh("/docs/guide.md", mtime, 41) {
+		t.Error("Fresh() does not follow the indexed modification time and size")
+	}
+
+	idx.Remove("/docs/deploy.md")
+	if got := paths(idx.Search("proxy", 0)); got != nil {
+		t.Errorf("removed file still found: %q", got)
+	}
+	if _, found := idx.postings["proxy"]; found {
+		t.Error("postings of a removed file's only terms were kept")
+	}
+	if want := []string{"/docs/cache.md", "/docs/guide.md"}; !reflect.DeepEqual(idx.Paths(), want) {
+		t.Errorf("Paths() = %q, want %q", idx.Paths(), want)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	idx := newTestIndex()
+	if !idx.Dirty() {
+		t.Error("updated index is not dirty")
+	}
+	var buf bytes.Buffer
+	if err := idx.Save(&buf); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if idx.Dirty() {
+		t.Error("saved index is still dirty")
+	}
+
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if loaded.Len() != 3 || loaded.Dirty() {
+		t.Errorf("loaded %d files (dirty %v), want 3 clean", loaded.Len(), loaded.Dirty())
+	}
+	if got, want := loaded.Search("cache", 0), idx.Search("cache", 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded Search() = %v, want %v", got, want)
+	}
+	if !loaded.Fresh("/docs/cache.md", time.Unix(1700000000, 0), 10) {
+		t.Error("loaded index lost modification times")
+	}
+}
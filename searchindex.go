@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/razvandimescu/peekm/search"
+)
+
+// Search index tuning: changes are saved searchSaveDelay after the first
+// unsaved one, and larger files are not indexed
+const (
+	searchSaveDelay    = 5 * time.Second
+	maxIndexedFileSize = 4 << 20
+)
+
+// fullTextIndex is the search index of the browsed directory. It is saved
+// under the user cache directory, one file per directory, and on startup only
+// files whose modification time or size changed are read again.
+type fullTextIndex struct {
+	mu        sync.Mutex
+	index     *search.Index
+	file      string      // Where index is saved, "" for nowhere
+	building  bool        // Reconciling with the files on disk
+	saveTimer *time.Timer // Pending save, nil if none
+}
+
+// textIndex is the index used by the server
+var textIndex = &fullTextIndex{}
+
+// startSearchIndex opens the index of root in the background unless --no-index is set
+func startSearchIndex(root string, files []string) {
+	if *noIndex {
+		return
+	}
+	go textIndex.open(root, files)
+}
+
+// searchIndexFile returns where the index of root is saved
+func searchIndexFile(root string) string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(cacheDir, "peekm", "search", hex.EncodeToString(sum[:8])+".gob")
+}
+
+// open switches to the index of root, loading the saved one, and brings it up
+// to date with files. Searches during the update see the files done so far.
+func (t *fullTextIndex) open(root string, files []string) {
+	t.flush()
+	file := searchIndexFile(root)
+	index := loadSearchIndex(file)
+
+	t.mu.Lock()
+	t.index, t.file, t.building = index, file, true
+	t.mu.Unlock()
+
+	start := time.Now()
+	reindexed := reconcileSearchIndex(index, files)
+	log.Printf("Search index: %d file(s), %d reindexed in %v", index.Len(), reindexed, time.Since(start).Round(time.Millisecond))
+
+	t.mu.Lock()
+	if t.index == index {
+		t.building = false
+	}
+	t.mu.Unlock()
+	t.scheduleSave()
+}
+
+// loadSearchIndex reads a saved index, or returns an empty one
+func loadSearchIndex(file string) *search.Index {
+	if file == "" {
+		return search.New()
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return search.New()
+	}
+	defer f.Close()
+	index, err := search.Load(f)
+	if err != nil {
+		if !errors.Is(err, search.ErrVersion) {
+			log.Printf("Warning: Cannot read search index %s: %v", file, err)
+		}
+		return search.New()
+	}
+	return index
+}
+
+// reconcileSearchIndex drops files no longer present and (re)indexes those
+// that are new or changed, returning how many were read
+func reconcileSearchIndex(index *search.Index, files []string) int {
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		present[file] = true
+	}
+	for _, path := range index.Paths() {
+		if !present[path] {
+			index.Remove(path)
+		}
+	}
+
+	reindexed := 0
+	for _, file := range files {
+		if indexFile(index, file) {
+			reindexed++
+		}
+	}
+	return reindexed
+}
+
+// indexFile (re)indexes file unless it is unchanged, reporting whether it was
+// read. Files that vanished or grew too large are removed.
+func indexFile(index *search.Index, file string) bool {
+	info, err := os.Stat(file)
+	if err != nil || info.Size() > maxIndexedFileSize {
+		index.Remove(file)
+		return false
+	}
+	if index.Fresh(file, info.ModTime(), info.Size()) {
+		return false
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		index.Remove(file)
+		return false
+	}
+	index.Update(file, info.ModTime(), info.Size(), content)
+	return true
+}
+
+// current returns the index if one is open
+func (t *fullTextIndex) current() (*search.Index, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.index, t.building
+}
+
+// update reindexes a whitelisted markdown file after it was created or written
+func (t *fullTextIndex) update(path string) {
+	index, _ := t.current()
+	if index == nil || !isMarkdownPath(path) || !isWhitelistedFile(path) {
+		return
+	}
+	if indexFile(index, path) {
+		t.scheduleSave()
+	}
+}
+
+// remove drops a deleted or renamed file from the index
+func (t *fullTextIndex) remove(path string) {
+	if index, _ := t.current(); index != nil {
+		index.Remove(path)
+		t.scheduleSave()
+	}
+}
+
+// scheduleSave saves the index after searchSaveDelay unless a save is pending
+func (t *fullTextIndex) scheduleSave() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.saveTimer == nil && t.index != nil && t.index.Dirty() {
+		t.saveTimer = time.AfterFunc(searchSaveDelay, t.flush)
+	}
+}
+
+// flush saves unsaved changes now
+func (t *fullTextIndex) flush() {
+	t.mu.Lock()
+	if t.saveTimer != nil {
+		t.saveTimer.Stop()
+		t.saveTimer = nil
+	}
+	index, file := t.index, t.file
+	t.mu.Unlock()
+
+	if index == nil || file == "" || !index.Dirty() {
+		return
+	}
+	var buf bytes.Buffer
+	if err := index.Save(&buf); err != nil {
+		log.Printf("Warning: Cannot encode search index: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		log.Printf("Warning: Cannot save search index: %v", err)
+		return
+	}
+	if err := atomicWriteFile(file, buf.String()); err != nil {
+		log.Printf("Warning: Cannot save search index: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/razvandimescu/peekm/search"
+)
+
+func TestReconcileSearchIndex(t *testing.T) {
+	dir := t.TempDir()
+	a, b, gone := filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md"), filepath.Join(dir, "gone.md")
+	for path, content := range map[string]string{a: "alpha notes", b: "beta notes"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := search.New()
+	index.Update(gone, time.Now(), 1, []byte("stale notes"))
+	if got := reconcileSearchIndex(index, []string{a, b}); got != 2 {
+		t.Errorf("first reconcile read %d files, want 2", got)
+	}
+	if got := index.Paths(); !reflect.DeepEqual(got, []string{a, b}) {
+		t.Errorf("indexed %q, want %q", got, []string{a, b})
+	}
+
+	// Only changed files are read again
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(b, []byte("beta gamma"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(b, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := reconcileSearchIndex(index, []string{a, b}); got != 1 {
+		t.Errorf("second reconcile read %d files, want 1", got)
+	}
+	if got := index.Search("gamma", 0); len(got) != 1 || got[0].Path != b {
+		t.Errorf("Search(gamma) = %v, want %s", got, b)
+	}
+}
+
+func TestSearchIndexFlush(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "cache", "index.gob")
+	index := search.New()
+	index.Update("/docs/a.md", time.Now(), 5, []byte("persisted words"))
+
+	ti := &fullTextIndex{index: index, file: file}
+	ti.scheduleSave()
+	if ti.saveTimer == nil {
+		t.Fatal("no save scheduled for a dirty index")
+	}
+	ti.flush()
+	if ti.saveTimer != nil || index.Dirty() {
+		t.Error("flush left a pending save or a dirty index")
+	}
+
+	loaded := loadSearchIndex(file)
+	if got := loaded.Search("persisted", 0); len(got) != 1 || got[0].Path != "/docs/a.md" {
+		t.Errorf("loaded index Search() = %v", got)
+	}
+	if loadSearchIndex(filepath.Join(dir, "missing.gob")).Len() != 0 {
+		t.Error("missing index file did not give an empty index")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// maxSnapshotSize caps the pre-modification content kept per file (1 MB)
+const maxSnapshotSize = 1 << 20
+
+// fileSnapshot is a file's content before a session first modified it
+type fileSnapshot struct {
+	SessionID string
+	Content   string
+	Timestamp time.Time
+}
+
+// snapshot records filePath's current content as the baseline for sessionID's
+// changes. The first snapshot per session is kept, so the diff covers every
+// edit the session made; a different session replaces it.
+func (ss *sessionStore) snapshot(filePath, sessionID string) {
+	ss.mu.RLock()
+	existing, found := ss.snapshots[filePath]
+	ss.mu.RUnlock()
+	if found && existing.SessionID == sessionID {
+		return
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		return // New files have nothing to compare against
+	}
+	if info.Size() > maxSnapshotSize {
+		log.Printf("Warning: %s is too large to snapshot for AI diffs (%d bytes)", filePath, info.Size())
+		return
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		log.Printf("Warning: Cannot snapshot %s: %v", filePath, err)
+		return
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.snapshots[filePath] = &fileSnapshot{
+		SessionID: sessionID,
+		Content:   string(content),
+		Timestamp: time.Now(),
+	}
+	ss.touchFileLocked(filePath)
+}
+
+// getSnapshot returns the pre-modification snapshot for a file path
+func (ss *sessionStore) getSnapshot(filePath string) (*fileSnapshot, bool) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	snap, found := ss.snapshots[filePath]
+	return snap, found
+}
+
+// rebaseSnapshot replaces the content of a file's snapshot, as long as it is
+// still snap, so changes accepted in review stop showing in its diff
+func (ss *sessionStore) rebaseSnapshot(filePath string, snap *fileSnapshot, content string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.snapshots[filePath] != snap {
+		return false
+	}
+	ss.snapshots[filePath] = &fileSnapshot{
+		SessionID: snap.SessionID,
+		Content:   content,
+		Timestamp: snap.Timestamp,
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionStoreSnapshot(t *testing.T) {
+	ss := newSessionStore()
+	path := filepath.Join(t.TempDir(), "notes.md")
+
+	ss.snapshot(path, "s1")
+	if _, found := ss.getSnapshot(path); found {
+		t.Fatal("missing file should not be snapshotted")
+	}
+
+	if err := os.WriteFile(path, []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ss.snapshot(path, "s1")
+
+	// Later edits in the same session keep the original baseline
+	if err := os.WriteFile(path, []byte("v2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ss.snapshot(path, "s1")
+	if snap, _ := ss.getSnapshot(path); snap == nil || snap.Content != "v1\n" {
+		t.Errorf("same-session snapshot = %+v, want baseline v1", snap)
+	}
+
+	// A different session starts a new baseline
+	ss.snapshot(path, "s2")
+	if snap, _ := ss.getSnapshot(path); snap == nil || snap.Content != "v2\n" || snap.SessionID != "s2" {
+		t.Errorf("new-session snapshot = %+v, want v2 from s2", snap)
+	}
+}
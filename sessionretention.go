@@ -0,0 +1,185 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxTrackedSessions caps the sessions whose hook events are kept; a new
+// session past it replaces the one that has been quiet the longest
+const maxTrackedSessions = 500
+
+// sessionPruneInterval is how often --session-retention is applied
+const sessionPruneInterval = time.Minute
+
+// trackedFile is a file the session store holds metadata or a snapshot for
+type trackedFile struct {
+	path    string
+	touched time.Time // Last registered or snapshotted
+}
+
+// sessionPruneCounts counts what the session store has forgotten
+type sessionPruneCounts struct {
+	EvictedFiles    int `json:"evicted_files"` // Over --session-max-files
+	ExpiredFiles    int `json:"expired_files"` // Older than --session-retention
+	EvictedSessions int `json:"evicted_sessions"`
+	ExpiredSessions int `json:"expired_sessions"`
+}
+
+// sessionStoreStats is returned by /api/session-stats
+type sessionStoreStats struct {
+	Files          int     `json:"files"` // With a badge or a diff snapshot
+	Mappings       int     `json:"mappings"`
+	Snapshots      int     `json:"snapshots"`
+	SnapshotBytes  int     `json:"snapshot_bytes"`
+	Sessions       int     `json:"sessions"`
+	ActiveSessions int     `json:"active_sessions"`
+	Events         int     `json:"events"`
+	MaxFiles       int     `json:"max_files"`         // 0: no limit
+	RetentionSecs  float64 `json:"retention_seconds"` // 0: kept while peekm runs
+	sessionPruneCounts
+}
+
+// touchFileLocked marks filePath as just modified, forgetting the least
+// recently modified files past --session-max-files. Callers hold ss.mu.
+func (ss *sessionStore) touchFileLocked(filePath string) {
+	now := time.Now()
+	if e, found := ss.fileElems[filePath]; found {
+		e.Value.(*trackedFile).touched = now
+		ss.files.MoveToFront(e)
+	} else {
+		ss.fileElems[filePath] = ss.files.PushFront(&trackedFile{path: filePath, touched: now})
+	}
+	for limit := *sessionMaxFiles; limit > 0 && ss.files.Len() > limit; {
+		ss.forgetFileLocked(ss.files.Back().Value.(*trackedFile).path)
+		ss.pruned.EvictedFiles++
+	}
+}
+
+// forgetFileLocked drops the metadata and snapshot of filePath. Callers
+// hold ss.mu.
+func (ss *sessionStore) forgetFileLocked(filePath string) {
+	delete(ss.mappings, filePath)
+	delete(ss.snapshots, filePath)
+	if e, found := ss.fileElems[filePath]; found {
+		ss.files.Remove(e)
+		delete(ss.fileElems, filePath)
+	}
+}
+
+// renameFileLocked moves oldPath's place in the recency order to newPath.
+// Callers hold ss.mu and have moved its metadata and snapshot.
+func (ss *sessionStore) renameFileLocked(oldPath, newPath string) {
+	e, found := ss.fileElems[oldPath]
+	if !found {
+		return
+	}
+	if replaced, found := ss.fileElems[newPath]; found {
+		ss.files.Remove(replaced)
+	}
+	e.Value.(*trackedFile).path = newPath
+	ss.fileElems[newPath] = e
+	delete(ss.fileElems, oldPath)
+}
+
+// lastEventTime returns when a session last reported an event
+func (ss *sessionStore) lastEventTime(sessionID string) time.Time {
+	events := ss.events[sessionID]
+	if len(events) == 0 {
+		return time.Time{}
+	}
+	return events[len(events)-1].Timestamp
+}
+
+// evictOldestSessionLocked drops the events of the session quiet for the
+// longest. Callers hold ss.mu.
+func (ss *sessionStore) evictOldestSessionLocked() {
+	oldest, oldestTime := "", time.Time{}
+	for id := range ss.events {
+		if t := ss.lastEventTime(id); oldest == "" || t.Before(oldestTime) {
+			oldest, oldestTime = id, t
+		}
+	}
+	delete(ss.events, oldest)
+	delete(ss.active, oldest)
+	ss.pruned.EvictedSessions++
+}
+
+// prune forgets the files and sessions not updated within --session-retention
+// of now, including sessions that never sent Stop
+func (ss *sessionStore) prune(now time.Time) {
+	retention := *sessionRetention
+	if retention <= 0 {
+		return
+	}
+	cutoff := now.Add(-retention)
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	files, sessions := 0, 0
+	for e := ss.files.Back(); e != nil && e.Value.(*trackedFile).touched.Before(cutoff); e = ss.files.Back() {
+		ss.forgetFileLocked(e.Value.(*trackedFile).path)
+		files++
+	}
+	for id := range ss.events {
+		if ss.lastEventTime(id).Before(cutoff) {
+			delete(ss.events, id)
+			delete(ss.active, id)
+			sessions++
+		}
+	}
+	ss.pruned.ExpiredFiles += files
+	ss.pruned.ExpiredSessions += sessions
+	if files+sessions > 0 {
+		log.Printf("Forgot AI session data not updated for %v: %d file(s), %d session(s)", retention, files, sessions)
+	}
+}
+
+// stats sizes up the store
+func (ss *sessionStore) stats() sessionStoreStats {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	stats := sessionStoreStats{
+		Files:              ss.files.Len(),
+		Mappings:           len(ss.mappings),
+		Snapshots:          len(ss.snapshots),
+		Sessions:           len(ss.events),
+		ActiveSessions:     len(ss.active),
+		MaxFiles:           max(0, *sessionMaxFiles),
+		RetentionSecs:      max(0, sessionRetention.Seconds()),
+		sessionPruneCounts: ss.pruned,
+	}
+	for _, snap := range ss.snapshots {
+		stats.SnapshotBytes += len(snap.Content)
+	}
+	for _, events := range ss.events {
+		stats.Events += len(events)
+	}
+	return stats
+}
+
+// startSessionPruning applies --session-retention to globalSessionStore
+// every sessionPruneInterval
+func startSessionPruning() {
+	if *sessionRetention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(sessionPruneInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			globalSessionStore.prune(now)
+		}
+	}()
+}
+
+// serveAPISessionStats reports the session store's size and what its limits
+// have forgotten
+func serveAPISessionStats(w http.ResponseWriter, r *http.Request) {
+	if globalSessionStore == nil {
+		writeError(w, errCodeNotFound, "AI session tracking is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, globalSessionStore.stats())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreMaxFiles(t *testing.T) {
+	prev := *sessionMaxFiles
+	t.Cleanup(func() { *sessionMaxFiles = prev })
+	*sessionMaxFiles = 3
+
+	dir := t.TempDir()
+	snapshotted := filepath.Join(dir, "snapshotted.md")
+	os.WriteFile(snapshotted, []byte("before\n"), 0644)
+
+	ss := newSessionStore()
+	ss.snapshot(snapshotted, "s1")
+	ss.register(snapshotted, &SessionMetadata{SessionID: "s1"})
+	ss.register("/docs/a.md", &SessionMetadata{SessionID: "s1"})
+	ss.register("/docs/b.md", &SessionMetadata{SessionID: "s1"})
+	ss.register(snapshotted, &SessionMetadata{SessionID: "s1"}) // Modified again: most recent
+	ss.register("/docs/c.md", &SessionMetadata{SessionID: "s1"})
+
+	if _, found := ss.get("/docs/a.md"); found {
+		t.Error("least recently modified file kept past --session-max-files")
+	}
+	for _, path := range []string{snapshotted, "/docs/b.md", "/docs/c.md"} {
+		if _, found := ss.get(path); !found {
+			t.Errorf("%s forgotten, want it kept", path)
+		}
+	}
+	if _, found := ss.getSnapshot(snapshotted); !found {
+		t.Error("snapshot of a kept file forgotten")
+	}
+
+	ss.rename("/docs/b.md", "/docs/b2.md")
+	ss.register("/docs/d.md", &SessionMetadata{SessionID: "s1"})
+	if _, found := ss.get("/docs/b2.md"); found {
+		t.Error("renamed file lost its place in the recency order")
+	}
+	if _, found := ss.getSnapshot(snapshotted); !found {
+		t.Error("snapshot evicted before older files")
+	}
+	if stats := ss.stats(); stats.Files != 3 || stats.EvictedFiles != 2 || stats.SnapshotBytes != len("before\n") {
+		t.Errorf("stats = %+v, want 3 files, 2 evicted", stats)
+	}
+}
+
+func TestSessionStorePrune(t *testing.T) {
+	prev := *sessionRetention
+	t.Cleanup(func() { *sessionRetention = prev })
+
+	ss := newSessionStore()
+	ss.register("/docs/a.md", &SessionMetadata{SessionID: "s1"})
+	ss.recordEvent("s1", sessionEvent{Type: hookPreToolUse, Timestamp: time.Now()})
+
+	*sessionRetention = 0
+	ss.prune(time.Now().Add(365 * 24 * time.Hour))
+	if _, found := ss.get("/docs/a.md"); !found {
+		t.Error("--session-retention=0 forgot a file")
+	}
+
+	*sessionRetention = time.Hour
+	ss.prune(time.Now().Add(30 * time.Minute))
+	if _, found := ss.get("/docs/a.md"); !found || len(ss.sessionEvents("s1")) == 0 {
+		t.Error("data within --session-retention forgotten")
+	}
+
+	later := time.Now().Add(2 * time.Hour)
+	ss.register("/docs/b.md", &SessionMetadata{SessionID: "s2"})
+	ss.recordEvent("s2", sessionEvent{Type: hookPreToolUse, Timestamp: later})
+	ss.prune(later)
+	if _, found := ss.get("/docs/a.md"); found {
+		t.Error("file older than --session-retention kept")
+	}
+	if len(ss.sessionEvents("s1")) != 0 || ss.isActive("s1") {
+		t.Error("session older than --session-retention kept (it never sent Stop)")
+	}
+	if len(ss.sessionEvents("s2")) == 0 {
+		t.Error("recent session forgotten")
+	}
+	if stats := ss.stats(); stats.ExpiredFiles != 2 || stats.ExpiredSessions != 1 {
+		t.Errorf("stats = %+v, want 2 expired files (b.md was registered before later) and 1 session", stats)
+	}
+}
+
+func TestSessionStoreMaxSessions(t *testing.T) {
+	ss := newSessionStore()
+	start := time.Now()
+	for i := range maxTrackedSessions + 1 {
+		ss.recordEvent("s"+strconv.Itoa(i), sessionEvent{Type: hookPreToolUse, Timestamp: start.Add(time.Duration(i) * time.Second)})
+	}
+	if stats := ss.stats(); stats.Sessions != maxTrackedSessions || stats.EvictedSessions != 1 {
+		t.Errorf("stats = %+v, want %d sessions and 1 evicted", stats, maxTrackedSessions)
+	}
+	if len(ss.sessionEvents("s0")) != 0 {
+		t.Error("the longest quiet session kept")
+	}
+}
+
+func TestServeAPISessionStats(t *testing.T) {
+	prev := globalSessionStore
+	t.Cleanup(func() { globalSessionStore = prev })
+
+	globalSessionStore = nil
+	rec := httptest.NewRecorder()
+	serveAPISessionStats(rec, httptest.NewRequest(http.MethodGet, "/api/session-stats", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("with tracking disabled: status = %d, want 404", rec.Code)
+	}
+
+	globalSessionStore = newSessionStore()
+	globalSessionStore.register("/docs/a.md", &SessionMetadata{SessionID: "s1"})
+	globalSessionStore.recordEvent("s1", sessionEvent{Type: hookPreToolUse, Timestamp: time.Now()})
+	rec = httptest.NewRecorder()
+	serveAPISessionStats(rec, httptest.NewRequest(http.MethodGet, "/api/session-stats", nil))
+	var stats map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats["files"] != 1.0 || stats["sessions"] != 1.0 || stats["events"] != 1.0 || stats["evicted_files"] != 0.0 {
+		t.Errorf("stats = %v", stats)
+	}
+}
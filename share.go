@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// Share link lifetimes
+const (
+	defaultShareTTL = 24 * time.Hour
+	maxShareTTL     = 7 * 24 * time.Hour
+)
+
+// shareRoute serves shared documents; it is the one route open to LAN
+// clients without the access token, since every link carries its signature
+const shareRoute = "/s/"
+
+// shareKey signs share links. It is random per run, so restarting peekm
+// revokes every link it handed out.
+var shareKey = sync.OnceValues(func() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+})
+
+// apiShareRequest is the /api/share request body
+type apiShareRequest struct {
+	Path string `json:"path"` // Relative to the browsed directory
+	TTL  string `json:"ttl"`  // How long the link works, e.g. "1h" (default 24h, at most 7 days)
+}
+
+// apiShareResponse is returned by /api/share
+type apiShareResponse struct {
+	URL     string    `json:"url"`     // Read-only link to the rendered document
+	Expires time.Time `json:"expires"` // When the link stops working
+}
+
+// shareMAC signs a path relative to root (slash-separated) and an expiry
+// time. The root is signed too, so links stop working once peekm browses
+// another directory instead of showing whatever has the same relative path.
+func shareMAC(key []byte, root, relPath string, expires int64) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", root, relPath, expires)
+	return mac.Sum(nil)
+}
+
+// shareLink returns the path and query of a share link for relPath
+func shareLink(key []byte, root, relPath string, expires time.Time) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("sig", hex.EncodeToString(shareMAC(key, root, relPath, expires.Unix())))
+	u := url.URL{Path: shareRoute + relPath, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// verifyShareLink checks that the query of a share link for relPath has a
+// matching signature and has not expired
+func verifyShareLink(key []byte, root, relPath string, query url.Values, now time.Time) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if relPath == "" || err != nil {
+		return errors.New("invalid share link")
+	}
+	sig, err := hex.DecodeString(query.Get("sig"))
+	if err != nil || !hmac.Equal(sig, shareMAC(key, root, relPath, expires)) {
+		return errors.New("invalid share link")
+	}
+	if now.Unix() > expires {
+		return errors.New("share link expired")
+	}
+	return nil
+}
+
+// parseShareTTL reads a requested link lifetime ("" for the default)
+func parseShareTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultShareTTL, nil
+	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil || ttl <= 0 {
+		return 0, errors.New("invalid ttl (use a duration such as 30m or 24h)")
+	}
+	if ttl > maxShareTTL {
+		return 0, fmt.Errorf("ttl over the maximum of %s", maxShareTTL)
+	}
+	return ttl, nil
+}
+
+// shareBaseURL is where shared links point: the LAN URL when peekm is
+// reachable from other devices, else the address the request came to
+func shareBaseURL(r *http.Request) string {
+	if lanURL != "" {
+		return lanURL
+	}
+	return "http://" + r.Host
+}
+
+// handleAPIShare mints a time-limited link to one rendered document that
+// needs no access token ({"path", "ttl"})
+func handleAPIShare(w http.ResponseWriter, r *http.Request) {
+	var req apiShareRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req)
+	if isBodyTooLarge(err) {
+		writeError(w, errCodeTooLarge, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	ttl, err := parseShareTTL(req.TTL)
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid share request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	validated, ok := resolveWhitelistedPath(w, strings.TrimSpace(req.Path))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	key, err := shareKey()
+	if err != nil {
+		writeError(w, errCodeInternal, "Cannot sign share link", http.StatusInternalServerError)
+		return
+	}
+	fileMutex.RLock()
+	root := browseDir
+	fileMutex.RUnlock()
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	writeJSON(w, http.StatusOK, apiShareResponse{
+		URL:     shareBaseURL(r) + shareLink(key, root, filepath.ToSlash(relPath), expires),
+		Expires: expires.UTC(),
+	})
+}
+
+// serveShared renders the document a valid share link names as a standalone
+// read-only page: no tree, editing or navigation to other files
+func serveShared(w http.ResponseWriter, r *http.Request) {
+	key, err := shareKey()
+	if err != nil {
+		writeError(w, errCodeInternal, "Cannot verify share link", http.StatusInternalServerError)
+		return
+	}
+	fileMutex.RLock()
+	root := browseDir
+	fileMutex.RUnlock()
+
+	relPath := r.PathValue("path")
+	if err := verifyShareLink(key, root, relPath, r.URL.Query(), time.Now()); err != nil {
+		writeError(w, errCodeForbidden, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	validated, err := safepath.Resolve(resolveFilePath(filepath.FromSlash(relPath)))
+	if err != nil || !isWhitelistedFile(validated) {
+		writeError(w, errCodeNotFound, "Shared file no longer exists", http.StatusNotFound)
+		return
+	}
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	rendered, err := renderFile(validated, content)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to render markdown", http.StatusInternalServerError)
+		return
+	}
+	page, err := executeExportPage("", downloadTmpl, newExportPage(validated, relPath, content, rendered))
+	if err != nil {
+		writeError(w, errCodeInternal, "Cannot apply export template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The signature is in the URL: keep it out of caches, indexes and referrers
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if _, err := w.Write(page); err != nil {
+		log.Printf("Failed to write shared page: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleAPIShare(t *testing.T) {
+	serveTestFiles(t, "share", map[string]string{"notes/plan.md": "# Launch plan\n"})
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"path": "notes/plan.md", "ttl": "720h"}`, http.StatusBadRequest},
+		{`{"path": "notes/plan.md", "ttl": "soon"}`, http.StatusBadRequest},
+		{`{}`, http.StatusBadRequest},
+		{`{"path": "missing.md"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handleAPIShare(rec, httptest.NewRequest(http.MethodPost, "/api/share", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("share %s: status = %d, want %d", tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestServeShared(t *testing.T) {
+	dir := serveTestFiles(t, "share", map[string]string{"notes/plan.md": "# Launch plan\n", "secret.md": "# Secret\n"})
+	view := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	handleAPIShare(rec, httptest.NewRequest(http.MethodPost, "/api/share", strings.NewReader(`{"path": "notes/plan.md", "ttl": "1h"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("share status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiShareResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if until := time.Until(resp.Expires); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("expires in %s, want an hour", until)
+	}
+	link, err := url.Parse(resp.URL)
+	if err != nil || link.Path != "/s/notes/plan.md" {
+		t.Fatalf("share URL = %q", resp.URL)
+	}
+
+	rec = view(link.RequestURI())
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Launch plan") {
+		t.Fatalf("shared page: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", rec.Header().Get("Cache-Control"))
+	}
+
+	// The signature covers the path, the expiry and the browsed directory
+	query := link.Query()
+	tampered := []string{
+		"/s/secret.md?" + query.Encode(),
+		"/s/notes/plan.md?sig=" + query.Get("sig") + "&expires=" + strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10),
+		"/s/notes/plan.md?expires=" + query.Get("expires"),
+	}
+	for _, target := range tampered {
+		if rec := view(target); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", target, rec.Code)
+		}
+	}
+	browseDir = filepath.Dir(dir)
+	if rec := view(link.RequestURI()); rec.Code != http.StatusForbidden {
+		t.Errorf("after browsing another directory: status = %d, want 403", rec.Code)
+	}
+	browseDir = dir
+
+	key, _ := shareKey()
+	if err := verifyShareLink(key, dir, strings.TrimPrefix(link.Path, shareRoute), link.Query(), resp.Expires.Add(time.Second)); err == nil {
+		t.Error("link accepted after it expired")
+	}
+}
@@ -0,0 +1,99 @@
+// Package spell finds commonly misspelled English words in markdown using
+// github.com/golangci/misspell. Code blocks, inline code and front matter are
+// skipped, and words from a custom dictionary are never reported.
+package spell
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golangci/misspell"
+	"github.com/razvandimescu/peekm/mdtext"
+)
+
+// Misspelling is a misspelled word and its suggested correction
+type Misspelling struct {
+	Line       int    `json:"line"`   // 1-based
+	Column     int    `json:"column"` // 1-based, in characters
+	Length     int    `json:"length"` // In characters
+	Word       string `json:"word"`
+	Suggestion string `json:"suggestion"`
+}
+
+// Checker reports misspellings; it is safe for concurrent use
+type Checker struct {
+	replacer *misspell.Replacer
+}
+
+// New creates a Checker that accepts the given words (case-insensitive)
+func New(accepted []string) *Checker {
+	replacer := misspell.New()
+	if len(accepted) > 0 {
+		ignore := make([]string, len(accepted))
+		for i, word := range accepted {
+			ignore[i] = strings.ToLower(word)
+		}
+		replacer.RemoveRule(ignore)
+		replacer.Compile()
+	}
+	return &Checker{replacer: replacer}
+}
+
+// Check returns the misspellings in markdown source, ordered by position
+func (c *Checker) Check(source []byte) []Misspelling {
+	lines := strings.Split(strings.ReplaceAll(string(source), "\r\n", "\n"), "\n")
+	_, diffs := c.replacer.Replace(strings.Join(proseLines(lines), "\n"))
+
+	misspellings := []Misspelling{}
+	for _, d := range diffs {
+		original := lines[d.Line-1]
+		misspellings = append(misspellings, Misspelling{
+			Line:       d.Line,
+			Column:     utf8.RuneCountInString(original[:d.Column]) + 1,
+			Length:     utf8.RuneCountInString(d.Original),
+			Word:       d.Original,
+			Suggestion: d.Corrected,
+		})
+	}
+	return misspellings
+}
+
+// ReadDictionary reads a custom dictionary: one word per line, with blank
+// lines and # comments ignored
+func ReadDictionary(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word != "" && !strings.HasPrefix(word, "#") {
+			words = append(words, word)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// proseLines blanks out front matter, fenced code blocks and inline code so
+// only prose is checked, keeping line numbers and byte offsets unchanged
+func proseLines(lines []string) []string {
+	prose := make([]string, len(lines))
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		switch {
+		case i == 0 && strings.TrimSpace(line) == "---":
+			fence = "---"
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" ||
+				fence == "---" && strings.TrimSpace(line) == "..." {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+		default:
+			prose[i] = mdtext.MaskCodeSpans(line)
+		}
+	}
+	return prose
+}
@@ -0,0 +1,48 @@
+package spell
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	source := strings.Join([]string{
+		"---",
+		"title: teh front matter",
+		"---",
+		"# Recieve notes",
+		"",
+		"Café: we recieve `teh` code and Teh text.",
+		"",
+		"```",
+		"teh code block",
+		"```",
+		"See https://example.com/recieve too.",
+	}, "\n")
+
+	got := New(nil).Check([]byte(source))
+	want := []Misspelling{
+		{Line: 4, Column: 3, Length: 7, Word: "Recieve", Suggestion: "Receive"},
+		{Line: 6, Column: 10, Length: 7, Word: "recieve", Suggestion: "receive"},
+		{Line: 6, Column: 33, Length: 3, Word: "Teh", Suggestion: "The"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckDictionary(t *testing.T) {
+	words, err := ReadDictionary(strings.NewReader("# project words\n\nRecieve\n  teh  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(words, []string{"Recieve", "teh"}) {
+		t.Fatalf("ReadDictionary() = %v", words)
+	}
+
+	got := New(words).Check([]byte("We recieve teh mail and adress it."))
+	if len(got) != 1 || got[0].Word != "adress" || got[0].Suggestion != "address" {
+		t.Errorf("Check() = %+v, want only adress", got)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/razvandimescu/peekm/safepath"
+	"github.com/razvandimescu/peekm/spell"
+)
+
+// spellDictionaryFile is the per-project list of accepted words, relative to browseDir
+var spellDictionaryFile = filepath.Join(".peekm", "dictionary.txt")
+
+// spellCache holds the checker for the current dictionary, rebuilt when the file changes
+var spellCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	checker *spell.Checker
+}
+
+// apiSpellcheckResponse is returned by /api/spellcheck
+type apiSpellcheckResponse struct {
+	Path         string              `json:"path"`         // Relative to the browse directory
+	Misspellings []spell.Misspelling `json:"misspellings"` // Ordered by line and column
+}
+
+// spellChecker returns a checker that accepts the words in the project dictionary
+func spellChecker() (*spell.Checker, error) {
+	dictPath := resolveFilePath(spellDictionaryFile)
+	var modTime time.Time
+	if info, err := os.Stat(dictPath); err == nil {
+		modTime = info.ModTime()
+	}
+
+	spellCache.Lock()
+	defer spellCache.Unlock()
+	if spellCache.checker != nil && spellCache.path == dictPath && spellCache.modTime.Equal(modTime) {
+		return spellCache.checker, nil
+	}
+
+	words, err := readSpellDictionary(dictPath)
+	if err != nil {
+		return nil, err
+	}
+	spellCache.path, spellCache.modTime, spellCache.checker = dictPath, modTime, spell.New(words)
+	return spellCache.checker, nil
+}
+
+// readSpellDictionary reads the project dictionary (empty if it does not exist)
+func readSpellDictionary(dictPath string) ([]string, error) {
+	f, err := os.Open(dictPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return spell.ReadDictionary(f)
+}
+
+// addToSpellDictionary appends a word to the project dictionary unless it is already there
+func addToSpellDictionary(word string) error {
+	dictPath := resolveFilePath(spellDictionaryFile)
+	if _, err := safepath.Resolve(resolveFilePath(".")); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dictPath), 0755); err != nil {
+		return err
+	}
+	// Re-validate the (now existing) parent so a symlinked .peekm can't escape $HOME
+	if _, err := safepath.Resolve(filepath.Dir(dictPath)); err != nil {
+		return err
+	}
+
+	words, err := readSpellDictionary(dictPath)
+	if err != nil {
+		return err
+	}
+	for _, w := range words {
+		if strings.EqualFold(w, word) {
+			return nil
+		}
+	}
+
+	f, err := os.OpenFile(dictPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, word); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// apiDictionaryWord is a word POST /api/spellcheck adds to the project
+// dictionary
+type apiDictionaryWord struct {
+	Word string `json:"word"`
+}
+
+// handleAPISpellcheck returns the misspellings in a file (GET ?path=) or adds
+// a word to the project dictionary (POST {"word": ...})
+func handleAPISpellcheck(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		serveSpellcheck(w, r)
+	case http.MethodPost:
+		var req apiDictionaryWord
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		word := strings.TrimSpace(req.Word)
+		if word == "" || strings.ContainsAny(word, " \t\r\n#") {
+			writeError(w, errCodeBadRequest, "Word must be a single word", http.StatusBadRequest)
+			return
+		}
+		if err := addToSpellDictionary(word); err != nil {
+			writeError(w, errCodeInternal, fmt.Sprintf("Cannot update dictionary: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Added %q to %s", word, spellDictionaryFile)
+		writeJSON(w, http.StatusOK, apiDictionaryWord{Word: word})
+	}
+}
+
+// serveSpellcheck returns the misspellings in a whitelisted markdown file
+func serveSpellcheck(w http.ResponseWriter, r *http.Request) {
+	validated, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	checker, err := spellChecker()
+	if err != nil {
+		writeError(w, errCodeInternal, fmt.Sprintf("Cannot read dictionary: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiSpellcheckResponse{
+		Path:         filepath.ToSlash(relPath),
+		Misspellings: checker.Check(content),
+	})
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// TestSpellDictionary tests that added words are stored once and picked up by the checker
+func TestSpellDictionary(t *testing.T) {
+	serveTestFiles(t, "spell", nil)
+
+	source := []byte("We recieve mail.\n")
+	checker, err := spellChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := checker.Check(source); len(got) != 1 {
+		t.Fatalf("Check() = %+v, want one misspelling", got)
+	}
+
+	for _, word := range []string{"recieve", "Recieve"} {
+		if err := addToSpellDictionary(word); err != nil {
+			t.Fatalf("addToSpellDictionary(%q) error: %v", word, err)
+		}
+	}
+	content, err := os.ReadFile(resolveFilePath(spellDictionaryFile))
+	if err != nil || string(content) != "recieve\n" {
+		t.Errorf("dictionary = %q, %v; want the word once", content, err)
+	}
+
+	checker, err = spellChecker()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := checker.Check(source); len(got) != 0 {
+		t.Errorf("Check() after adding word = %+v, want none", got)
+	}
+}
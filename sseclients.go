@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stale SSE client detection: a write (event or keepalive) blocked longer
+// than sseWriteTimeout fails, and a client whose queue is still full after
+// maxMissedEvents notifications in a row is disconnected
+const (
+	sseWriteTimeout = 10 * time.Second
+	maxMissedEvents = 5
+)
+
+// minKeepalive is the shortest --keepalive interval used
+const minKeepalive = time.Second
+
+// keepaliveInterval returns how often idle /events connections get a
+// keepalive comment: --keepalive, but no less than minKeepalive
+func keepaliveInterval() time.Duration {
+	return max(*keepalive, minKeepalive)
+}
+
+// sseClient is one open /events connection
+type sseClient struct {
+	id          uint64
+	ch          chan string // Formatted events waiting to be written
+	remoteAddr  string
+	userAgent   string
+	tabClient   string      // peekm_client cookie, "" if the browser had none yet
+	filter      eventFilter // Events the client subscribed to
+	connectedAt time.Time
+	lastWrite   atomic.Int64  // Unix nanoseconds of the last successful write
+	missed      atomic.Int32  // Notifications dropped in a row because ch was full
+	kick        chan struct{} // Closed when the client is dropped as stale
+	kickOnce    sync.Once
+}
+
+// apiClientsResponse is returned by /api/clients
+type apiClientsResponse struct {
+	Count   int             `json:"count"`   // Same as the connection_status count
+	Clients []apiClientInfo `json:"clients"` // Oldest connection first
+}
+
+// apiClientInfo describes one connected SSE client
+type apiClientInfo struct {
+	ID          uint64    `json:"id"`
+	RemoteAddr  string    `json:"remote_addr"`
+	UserAgent   string    `json:"user_agent"`
+	TabClient   string    `json:"tab_client,omitempty"` // Browser whose tabs /api/tabs lists
+	Filter      string    `json:"filter,omitempty"`     // Subscription filter, as /events query parameters
+	ConnectedAt time.Time `json:"connected_at"`
+	LastWrite   time.Time `json:"last_write"` // Last event or keepalive written successfully
+	Pending     int       `json:"pending"`    // Events queued, not yet written
+	Missed      int       `json:"missed"`     // Events dropped in a row because the queue was full
+}
+
+// lastClientID numbers SSE connections
+var lastClientID atomic.Uint64
+
+// registerClient adds the connection of r to the clients notified of events
+// and returns it with the new client count
+func registerClient(r *http.Request) (*sseClient, int) {
+	c := &sseClient{
+		id:          lastClientID.Add(1),
+		ch:          make(chan string, 10), // Buffer 10 events to handle bursts
+		remoteAddr:  r.RemoteAddr,
+		userAgent:   r.UserAgent(),
+		filter:      parseEventFilter(r),
+		connectedAt: time.Now(),
+		kick:        make(chan struct{}),
+	}
+	if cookie, err := r.Cookie(tabClientCookie); err == nil {
+		c.tabClient = cookie.Value
+	}
+	c.lastWrite.Store(c.connectedAt.UnixNano())
+
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	clients[c.id] = c
+	return c, len(clients)
+}
+
+// unregisterClient removes a client when its connection ends and returns the
+// new client count
+func unregisterClient(c *sseClient) int {
+	clientsMutex.Lock()
+	delete(clients, c.id)
+	count := len(clients)
+	clientsMutex.Unlock()
+	close(c.ch) // No notifier can send anymore: they hold clientsMutex while sending
+	return count
+}
+
+// queue hands a formatted event to the client without blocking, reporting
+// whether the client has now missed maxMissedEvents in a row. The caller
+// holds clientsMutex for reading.
+func (c *sseClient) queue(message string) (stale bool) {
+	select {
+	case c.ch <- message:
+		c.missed.Store(0)
+		return false
+	default:
+		return c.missed.Add(1) >= maxMissedEvents
+	}
+}
+
+// dropStaleClient disconnects a client that stopped reading its events; its
+// handler returns and reports the new client count
+func dropStaleClient(c *sseClient) {
+	c.kickOnce.Do(func() {
+		log.Printf("SSE client %d (%s) missed %d events in a row, disconnecting", c.id, c.remoteAddr, maxMissedEvents)
+		close(c.kick)
+	})
+}
+
+// send writes message to the connection and flushes it, failing if the
+// client does not take it within sseWriteTimeout
+func (c *sseClient) send(w http.ResponseWriter, message string) error {
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout)) // Unsupported by some ResponseWriters
+	if _, err := io.WriteString(w, message); err != nil {
+		return err
+	}
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+	c.lastWrite.Store(time.Now().UnixNano())
+	return nil
+}
+
+// serveAPIClients lists the open /events connections, to check the
+// connection_status count against
+func serveAPIClients(w http.ResponseWriter, r *http.Request) {
+	clientsMutex.RLock()
+	resp := apiClientsResponse{Count: len(clients), Clients: make([]apiClientInfo, 0, len(clients))}
+	for _, c := range clients {
+		resp.Clients = append(resp.Clients, apiClientInfo{
+			ID:          c.id,
+			RemoteAddr:  c.remoteAddr,
+			UserAgent:   c.userAgent,
+			TabClient:   c.tabClient,
+			Filter:      c.filter.String(),
+			ConnectedAt: c.connectedAt,
+			LastWrite:   time.Unix(0, c.lastWrite.Load()),
+			Pending:     len(c.ch),
+			Missed:      int(c.missed.Load()),
+		})
+	}
+	clientsMutex.RUnlock()
+
+	sort.Slice(resp.Clients, func(i, j int) bool { return resp.Clients[i].ID < resp.Clients[j].ID })
+	writeJSON(w, http.StatusOK, resp)
+}
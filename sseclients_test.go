@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestStaleClientDropped tests that a client whose queue stays full is disconnected
+func TestStaleClientDropped(t *testing.T) {
+	prevClients, prevEvents := clients, globalEventBuffer
+	defer func() { clients, globalEventBuffer = prevClients, prevEvents }()
+	clients, globalEventBuffer = make(map[uint64]*sseClient), newEventBuffer(50)
+
+	stuck, _ := registerClient(httptest.NewRequest("GET", "/events", nil))
+	reading, count := registerClient(httptest.NewRequest("GET", "/events", nil))
+	if count != 2 {
+		t.Fatalf("client count = %d, want 2", count)
+	}
+
+	for i := 0; i < cap(stuck.ch)+maxMissedEvents-1; i++ {
+		notifyClientsWithMessage("reload")
+		<-reading.ch
+	}
+	select {
+	case <-stuck.kick:
+		t.Fatal("client dropped before missing maxMissedEvents in a row")
+	default:
+	}
+	if got := stuck.missed.Load(); got != maxMissedEvents-1 {
+		t.Errorf("missed = %d, want %d", got, maxMissedEvents-1)
+	}
+
+	notifyClientsWithMessage("reload")
+	select {
+	case <-stuck.kick:
+	default:
+		t.Fatal("client not dropped after missing maxMissedEvents in a row")
+	}
+	if reading.missed.Load() != 0 {
+		t.Error("client that keeps up counted missed events")
+	}
+
+	// The handler of the dropped client unregisters it on return
+	if count := unregisterClient(stuck); count != 1 {
+		t.Errorf("client count after drop = %d, want 1", count)
+	}
+}
+
+// TestServeAPIClients tests listing the connected SSE clients
+func TestServeAPIClients(t *testing.T) {
+	prevClients := clients
+	defer func() { clients = prevClients }()
+	clients = make(map[uint64]*sseClient)
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.RemoteAddr = "192.168.1.20:51234"
+	req.Header.Set("User-Agent", "test-browser")
+	req.AddCookie(&http.Cookie{Name: tabClientCookie, Value: "tab-1"})
+	first, _ := registerClient(req)
+	registerClient(httptest.NewRequest("GET", "/events", nil))
+	first.ch <- "id: 1\ndata: reload"
+
+	rec := httptest.NewRecorder()
+	serveAPIClients(rec, httptest.NewRequest("GET", "/api/clients", nil))
+	var resp apiClientsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.Count != 2 || len(resp.Clients) != 2 {
+		t.Fatalf("response = %+v, want 2 clients", resp)
+	}
+	got := resp.Clients[0]
+	if got.ID != first.id || got.RemoteAddr != "192.168.1.20:51234" || got.UserAgent != "test-browser" ||
+		got.TabClient != "tab-1" || got.Pending != 1 || got.ConnectedAt.IsZero() || got.LastWrite.IsZero() {
+		t.Errorf("first client = %+v", got)
+	}
+	if resp.Clients[1].ID <= got.ID {
+		t.Error("clients not ordered by connection")
+	}
+}
+
+func TestKeepaliveInterval(t *testing.T) {
+	prev := *keepalive
+	t.Cleanup(func() { *keepalive = prev })
+	tests := []struct {
+		flag, want time.Duration
+	}{
+		{10 * time.Second, 10 * time.Second},
+		{2 * time.Minute, 2 * time.Minute},
+		{0, minKeepalive},
+		{-time.Second, minKeepalive},
+	}
+	for _, tt := range tests {
+		*keepalive = tt.flag
+		if got := keepaliveInterval(); got != tt.want {
+			t.Errorf("--keepalive=%v: interval = %v, want %v", tt.flag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// scanProgressInterval is how often the startup scan whitelists the files it
+// has found so far and reports progress
+const scanProgressInterval = 500 * time.Millisecond
+
+// scanProgressMessage is used for SSE notifications about the startup scan
+type scanProgressMessage struct {
+	Type  string `json:"type"`  // "scan_progress"
+	Files int    `json:"files"` // Markdown files found so far
+	Done  bool   `json:"done"`
+}
+
+// startupScanRunning is set while the startup scan walks the browsed directory
+var startupScanRunning atomic.Bool
+
+// errNoMarkdownFiles ends peekm when the startup scan finds nothing to serve
+var errNoMarkdownFiles = errors.New("no markdown files found")
+
+// startStartupScan collects the markdown files of root in the background, so
+// the server answers (and prints its URL) right away on huge trees. Files are
+// whitelisted in batches as the walk finds them and browsers refresh their
+// tree on each scan_progress event. A directory scanned before starts from
+// its cached file list instead, which the walk then brings up to date. Once
+// the walk is done, the directory is watched and indexed; finding no markdown
+// at all is sent on the returned channel, for main to shut down. A file named
+// on the command line is served from the start.
+func startStartupScan(root, targetFile string) <-chan error {
+	if targetFile != "" {
+		addToWhitelist(filepath.Join(root, targetFile))
+	}
+	cached := loadFileListCache(root)
+	if len(cached) > 0 {
+		addScanBatch(root, slices.Collect(maps.Keys(cached)))
+		log.Printf("Loaded %d cached markdown file(s) of %s, rescanning in the background", len(cached), root)
+	}
+	startupScanRunning.Store(true)
+	failed := make(chan error, 1)
+	go func() {
+		if err := runStartupScan(root, targetFile, cached); err != nil {
+			failed <- err
+		}
+	}()
+	return failed
+}
+
+// runStartupScan walks root for startStartupScan
+func runStartupScan(root, targetFile string, cached map[string]time.Time) error {
+	started := time.Now()
+	batcher := &scanBatcher{root: root, lastFlush: started}
+	files, settings, gitignore := collectMarkdownFilesEach(root, batcher.add)
+	whitelisted := addScanBatch(root, files)
+	startupScanRunning.Store(false)
+	if !whitelisted {
+		return nil // Navigated elsewhere meanwhile
+	}
+
+	scanned := fileModTimes(files)
+	if cached != nil {
+		added, modified, gone := diffCachedFiles(cached, scanned)
+		gone = slices.DeleteFunc(gone, func(path string) bool { return path == filepath.Join(root, targetFile) })
+		if !removeScanStale(root, gone) {
+			return nil
+		}
+		log.Printf("Since %s was last scanned: %d new, %d modified, %d gone", root, added, modified, len(gone))
+	}
+	saveFileListCache(root, scanned)
+	cacheDirSettings(settings, gitignore)
+	return finishStartupScan(root, targetFile, len(files), time.Since(started))
+}
+
+// finishStartupScan reports the scan's result and starts what needs the
+// whole file list, or returns errNoMarkdownFiles
+func finishStartupScan(root, targetFile string, found int, took time.Duration) error {
+	if found == 0 {
+		fmt.Printf("No markdown files found in: %s\n", root)
+		fmt.Println("\nUsage: peekm [options] <markdown-file|directory>")
+		fmt.Println("\nOptions:")
+		flag.PrintDefaults()
+		return errNoMarkdownFiles
+	}
+	log.Printf("Scanned %s: %d markdown file(s) in %v", root, found, took.Round(time.Millisecond))
+	if targetFile != "" {
+		fmt.Printf("Opening %s - found %d markdown file(s)\n", targetFile, found)
+	} else {
+		fmt.Printf("Browsing %s - found %d markdown file(s)\n", root, found)
+	}
+
+	if err := watchBrowseDir(root); err != nil {
+		log.Printf("Warning: Cannot watch directory for changes: %v", err)
+	}
+	startSearchIndex(root, whitelistedFiles())
+	rememberRecentDir(root, found)
+	sendScanProgress(found, true)
+	return nil
+}
+
+// scanBatcher whitelists the files of a scan every scanProgressInterval
+type scanBatcher struct {
+	root      string
+	batch     []string // Found since the last flush
+	total     int
+	lastFlush time.Time
+}
+
+// add is called by the walk with each file it finds
+func (b *scanBatcher) add(path string) {
+	b.batch = append(b.batch, path)
+	b.total++
+	if time.Since(b.lastFlush) < scanProgressInterval || !addScanBatch(b.root, b.batch) {
+		return
+	}
+	b.batch, b.lastFlush = b.batch[:0], time.Now()
+	log.Printf("Scanning %s: %d markdown file(s) so far", b.root, b.total)
+	sendScanProgress(b.total, false)
+}
+
+// addScanBatch whitelists files found by the scan of root, reporting false
+// when the browsed directory is no longer root
+func addScanBatch(root string, files []string) bool {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+	if browseDir != root {
+		return false
+	}
+	markdownFiles.addAll(files)
+	return true
+}
+
+// removeScanStale drops cached files the scan of root no longer found,
+// reporting false when the browsed directory is no longer root
+func removeScanStale(root string, files []string) bool {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+	if browseDir != root {
+		return false
+	}
+	for _, file := range files {
+		markdownFiles.remove(file)
+	}
+	return true
+}
+
+// sendScanProgress tells browsers how many files the scan has found. Progress
+// is not replayed (it is stale by the time a browser reconnects); the final
+// event is, so a browser that missed it still loads the full tree.
+func sendScanProgress(files int, done bool) {
+	msgBytes, err := json.Marshal(scanProgressMessage{Type: "scan_progress", Files: files, Done: done})
+	if err != nil {
+		log.Printf("Error marshaling scan_progress message: %v", err)
+		return
+	}
+	if done {
+		notifyClientsWithMessage(string(msgBytes))
+	} else {
+		notifyClientsUnbuffered(string(msgBytes))
+	}
+}
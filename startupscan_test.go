@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartupScan(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.md", filepath.Join("docs", "b.md"), "notes.txt"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("# Test\n"), 0644)
+		if strings.HasSuffix(name, ".md") {
+			files = append(files, path)
+		}
+	}
+	client := useDirChangeGlobals(t, dir, nil)
+	prevNoIndex := *noIndex
+	t.Cleanup(func() { *noIndex = prevNoIndex; cacheDirSettings(nil, nil) })
+	*noIndex = true
+
+	startStartupScan(dir, "")
+	waitForScan(t, client, 2)
+	if startupScanRunning.Load() {
+		t.Error("scan still reported running after its final event")
+	}
+	if got := markdownFiles.list(); !reflect.DeepEqual(got, files) {
+		t.Errorf("whitelist = %q, want %q", got, files)
+	}
+	if dirs := loadRecentDirs(); len(dirs) != 1 || dirs[0].Path != dir {
+		t.Errorf("recent directories = %+v, want the scanned one", dirs)
+	}
+
+	// Started again from the cached file list, which the scan brings up to date
+	gone, added := filepath.Join(dir, "gone.md"), filepath.Join(dir, "docs", "c.md")
+	saveFileListCache(dir, map[string]time.Time{files[0]: time.Now(), files[1]: time.Now(), gone: time.Now()})
+	os.WriteFile(added, []byte("# New\n"), 0644)
+	markdownFiles = newFileSet(nil)
+	startStartupScan(dir, "")
+	waitForScan(t, client, 3)
+	if want := []string{files[0], files[1], added}; !reflect.DeepEqual(markdownFiles.list(), want) {
+		t.Errorf("whitelist after a cached start = %q, want %q", markdownFiles.list(), want)
+	}
+	if cached := loadFileListCache(dir); len(cached) != 3 || !cached[added].Equal(fileModTimes([]string{added})[added]) {
+		t.Errorf("cached file list after the scan = %v", cached)
+	}
+}
+
+func TestStartupScanNoFiles(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	useDirChangeGlobals(t, dir, nil)
+
+	select {
+	case err := <-startStartupScan(dir, ""):
+		if !errors.Is(err, errNoMarkdownFiles) {
+			t.Errorf("scan of an empty directory = %v, want errNoMarkdownFiles", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error from the scan of an empty directory")
+	}
+}
+
+// waitForScan waits for the final scan_progress event of a scan that found files
+func waitForScan(t *testing.T, client *sseClient, files int) {
+	t.Helper()
+	select {
+	case msg := <-client.ch:
+		if want := fmt.Sprintf(`{"type":"scan_progress","files":%d,"done":true}`, files); !strings.Contains(msg, want) {
+			t.Errorf("event = %q, want %s", msg, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no scan_progress event after the scan")
+	}
+}
+
+func TestScanBatcher(t *testing.T) {
+	dir := t.TempDir()
+	client := useDirChangeGlobals(t, dir, nil)
+	a, b := filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")
+
+	batcher := &scanBatcher{root: dir, lastFlush: time.Now()}
+	batcher.add(a)
+	if markdownFiles.len() != 0 || len(client.ch) != 0 {
+		t.Error("batch flushed before scanProgressInterval")
+	}
+
+	batcher.lastFlush = time.Now().Add(-scanProgressInterval)
+	batcher.add(b)
+	if got := markdownFiles.list(); !reflect.DeepEqual(got, []string{a, b}) {
+		t.Errorf("whitelist after a flush = %q, want %q", got, []string{a, b})
+	}
+	if msg := <-client.ch; msg != `data: {"type":"scan_progress","files":2,"done":false}` {
+		t.Errorf("progress event = %q", msg)
+	}
+
+	browseDir = t.TempDir() // Navigated elsewhere
+	if addScanBatch(dir, []string{filepath.Join(dir, "c.md")}) || markdownFiles.len() != 2 {
+		t.Error("scan of a directory no longer browsed changed the whitelist")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// streamRenderBytes is the markdown size from which a page's document is
+// rendered straight into the response instead of into a buffer first
+const streamRenderBytes = 256 << 10
+
+// Placeholders streamTemplate executes the page template with: the document
+// is written where streamedContent lands, and the hash of its render
+// replaces streamedRenderHash after it
+const (
+	streamedContent    = template.HTML("<!--peekm:streamed-document-->")
+	streamedRenderHash = "peekm-streamed-render-hash"
+)
+
+// streamsRender reports whether a page of content should stream its
+// document: a large whole render with no --post-render command, which needs
+// the complete HTML
+func streamsRender(r *http.Request, content []byte) bool {
+	if len(content) < streamRenderBytes || *postRender != "" || isEmbedRequest(r) {
+		return false
+	}
+	return r.URL.Query().Get("from") == "" && (renderLimit() == 0 || len(content) <= renderLimit())
+}
+
+// streamTemplate is renderTemplate for a document too large to wait for: the
+// page up to the document is sent first, so the browser loads the styles
+// and scripts while stream renders the document into w. stream returns the
+// render's hash, which follows the document in a template element. A page
+// that doesn't show the document (the no-JavaScript editor) is sent whole.
+func streamTemplate(w http.ResponseWriter, r *http.Request, data browserTemplateData, stream func(w io.Writer) string) bool {
+	data.Content, data.RenderHash, data.LateRenderHash = streamedContent, "", streamedRenderHash
+	var buf bytes.Buffer
+	if err := browserTemplate(w, r).Execute(&buf, data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		writeError(w, errCodeInternal, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	head, tail, found := strings.Cut(buf.String(), string(streamedContent))
+	if !found {
+		buf.WriteTo(w)
+		pageServed(r)
+		return true
+	}
+
+	io.WriteString(w, head)
+	http.NewResponseController(w).Flush()
+	hash := stream(w)
+	io.WriteString(w, strings.Replace(tail, streamedRenderHash, hash, 1))
+	pageServed(r)
+	return true
+}
+
+// streamRender renders a markdown file into w as the renderer produces it and
+// caches the render for live updates, returning its hash ("" when it can't
+// be patched). A failed render is logged; the page is already under way.
+func streamRender(w io.Writer, absPath string, source []byte) string {
+	var rendered strings.Builder
+	if err := newMarkdownRenderer().Convert(expandSource(absPath, source), io.MultiWriter(w, &rendered)); err != nil {
+		log.Printf("Error rendering markdown: %v", err)
+		return ""
+	}
+	return rememberRender(absPath, rendered.String()).hash
+}
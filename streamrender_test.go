@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStreamTemplate(t *testing.T) {
+	data := browserTemplateData{baseTemplateData: newBaseTemplateData(httptest.NewRequest("GET", "/", nil)), Title: "big.md", RenderHash: "stale"}
+	rec := httptest.NewRecorder()
+	streamTemplate(rec, httptest.NewRequest("GET", "/view/big.md", nil), data, func(w io.Writer) string {
+		if !rec.Flushed || !strings.HasSuffix(rec.Body.String(), `<div id="document-body" class="document-body">`) {
+			t.Error("page head not flushed before the document")
+		}
+		io.WriteString(w, "<p>Streamed</p>")
+		return "abc"
+	})
+	if body := rec.Body.String(); !strings.Contains(body, `<p>Streamed</p></div><template id="document-render" data-render="abc"></template>`) || strings.Contains(body, "peekm-streamed") {
+		t.Errorf("streamed page lacks the document or its hash")
+	}
+
+	// No document on the page: sent whole
+	data.EditMode = true
+	rec = httptest.NewRecorder()
+	streamTemplate(rec, httptest.NewRequest("GET", "/view/big.md?edit=1", nil), data, func(w io.Writer) string {
+		t.Error("document streamed into the editor page")
+		return ""
+	})
+	if !strings.Contains(rec.Body.String(), "noscript-editor") {
+		t.Error("editor page not sent")
+	}
+}
+
+func TestServeFileStreamed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.md")
+	content := []byte("# Big\n\n" + strings.Repeat("A paragraph of *text*.\n\n", streamRenderBytes/20))
+	os.WriteFile(path, content, 0644)
+	prevDir, prevFiles, prevLimit := browseDir, markdownFiles, *maxRenderKB
+	t.Cleanup(func() { browseDir, markdownFiles, *maxRenderKB = prevDir, prevFiles, prevLimit; forgetRender(path) })
+	browseDir, markdownFiles, *maxRenderKB = dir, newFileSet([]string{path}), 0
+
+	rec := httptest.NewRecorder()
+	routes().ServeHTTP(rec, httptest.NewRequest("GET", "/view/big.md", nil))
+	rendered, err := renderFile(path, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `class="document-body">`+rendered+`</div><template id="document-render" data-render="`+renderHash(rendered)+`">`) {
+		t.Errorf("streamed /view/big.md (status %d) does not hold the whole render followed by its hash", rec.Code)
+	}
+	if patch := renderPatchFor(path); patch == nil || patch.Base != renderHash(rendered) {
+		t.Error("streamed render not cached for live updates")
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// tabClientCookie identifies a browser so its open tabs survive reloads
+const tabClientCookie = "peekm_client"
+
+// Limits that keep the tab store (and the watched file set) small
+const (
+	maxTabsPerClient = 20
+	maxTabClients    = 50
+)
+
+// clientTabs is the set of files one browser has open, in tab order
+type clientTabs struct {
+	files       []string // Absolute paths
+	active      string
+	lastSeen    time.Time
+	connections int // Open SSE connections; only connected clients' tabs are watched
+
+	// Presence (see presence.go)
+	userAgent  string // Of the latest SSE connection
+	name       string // Chosen display name ("" for one from userAgent)
+	presenting bool   // Followers are taken wherever this client navigates
+	scrollSync bool   // While presenting, followers' viewports track its scrolling
+}
+
+// tabStore tracks open files per client. The file watcher follows the union of
+// every connected client's tabs, so two browser windows on different files both
+// live-reload, and a closed window stops holding watches.
+type tabStore struct {
+	mu      sync.Mutex
+	clients map[string]*clientTabs
+}
+
+var (
+	// globalTabStore holds the open tabs of every client
+	globalTabStore = newTabStore()
+
+	// Files the file watcher currently follows (sorted)
+	watchedFiles      []string
+	watchedFilesMutex sync.Mutex
+)
+
+// newTabStore creates an empty tab store
+func newTabStore() *tabStore {
+	return &tabStore{clients: make(map[string]*clientTabs)}
+}
+
+// apiTab is one open file in /api/tabs responses
+type apiTab struct {
+	Path  string `json:"path"` // Relative to the browsed directory
+	Title string `json:"title"`
+}
+
+// apiTabRequest opens a file as the active tab (POST /api/tabs)
+type apiTabRequest struct {
+	Path string `json:"path"` // Relative to the browsed directory
+}
+
+// apiTabsResponse is the /api/tabs payload
+type apiTabsResponse struct {
+	Tabs   []apiTab `json:"tabs"`
+	Active string   `json:"active,omitempty"`
+}
+
+// open adds absPath to a client's tabs (if new) and makes it the active tab
+func (ts *tabStore) open(clientID, absPath string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	c := ts.clientLocked(clientID)
+	if !slices.Contains(c.files, absPath) {
+		c.files = append(c.files, absPath)
+		// Drop the oldest tabs beyond the limit (never the new active one)
+		if len(c.files) > maxTabsPerClient {
+			c.files = c.files[len(c.files)-maxTabsPerClient:]
+		}
+	}
+	c.active = absPath
+}
+
+// close removes absPath from a client's tabs. Closing the active tab activates
+// its right-hand neighbour (or the new last tab).
+func (ts *tabStore) close(clientID, absPath string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	c := ts.clientLocked(clientID)
+	i := slices.Index(c.files, absPath)
+	if i < 0 {
+		return
+	}
+	c.files = slices.Delete(c.files, i, i+1)
+	if c.active != absPath {
+		return
+	}
+	c.active = ""
+	if len(c.files) > 0 {
+		c.active = c.files[min(i, len(c.files)-1)]
+	}
+}
+
+// removeEverywhere closes absPath in every client (e.g. after the file is deleted)
+func (ts *tabStore) removeEverywhere(absPath string) {
+	ts.mu.Lock()
+	clientIDs := make([]string, 0, len(ts.clients))
+	for id := range ts.clients {
+		clientIDs = append(clientIDs, id)
+	}
+	ts.mu.Unlock()
+
+	for _, id := range clientIDs {
+		ts.close(id, absPath)
+	}
+}
+
+// tabs returns a client's open files that keep reports as still viewable,
+// pruning the rest, and the active one
+func (ts *tabStore) tabs(clientID string, keep func(absPath string) bool) ([]string, string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	c, found := ts.clients[clientID]
+	if !found {
+		return nil, ""
+	}
+	c.files = slices.DeleteFunc(c.files, func(f string) bool { return !keep(f) })
+	if !slices.Contains(c.files, c.active) {
+		c.active = ""
+	}
+	return slices.Clone(c.files), c.active
+}
+
+// connect records an SSE connection from a client with the given user agent
+func (ts *tabStore) connect(clientID, userAgent string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	c := ts.clientLocked(clientID)
+	c.connections++
+	c.userAgent = userAgent
+}
+
+// disconnect records the end of an SSE connection from a client
+func (ts *tabStore) disconnect(clientID string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if c, found := ts.clients[clientID]; found && c.connections > 0 {
+		c.connections--
+		c.lastSeen = time.Now()
+	}
+}
+
+// openFiles returns the sorted union of every connected client's tabs
+func (ts *tabStore) openFiles() []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, c := range ts.clients {
+		if c.connections == 0 {
+			continue
+		}
+		for _, f := range c.files {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	slices.Sort(files)
+	return files
+}
+
+// clientLocked returns a client's tabs, creating them (and evicting the least
+// recently seen client beyond maxTabClients); ts.mu must be held
+func (ts *tabStore) clientLocked(clientID string) *clientTabs {
+	c, found := ts.clients[clientID]
+	if !found {
+		if len(ts.clients) >= maxTabClients {
+			ts.evictOldestLocked()
+		}
+		c = &clientTabs{}
+		ts.clients[clientID] = c
+	}
+	c.lastSeen = time.Now()
+	return c
+}
+
+// evictOldestLocked forgets the least recently seen client, preferring ones
+// without an open connection; ts.mu must be held
+func (ts *tabStore) evictOldestLocked() {
+	var oldestID string
+	var oldest time.Time
+	var oldestConnected bool
+	for id, c := range ts.clients {
+		connected := c.connections > 0
+		if oldestID == "" || (oldestConnected && !connected) || (oldestConnected == connected && c.lastSeen.Before(oldest)) {
+			oldestID, oldest, oldestConnected = id, c.lastSeen, connected
+		}
+	}
+	delete(ts.clients, oldestID)
+}
+
+// tabClientID returns the client ID from the cookie, issuing a new one if missing
+func tabClientID(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(tabClientCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	id, err := newAccessToken()
+	if err != nil {
+		log.Printf("Warning: Cannot generate client ID: %v", err)
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     tabClientCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+// openTab records absFilePath as the client's active tab and updates the
+// watched files and presence. HEAD requests open nothing.
+func openTab(w http.ResponseWriter, r *http.Request, absFilePath string) {
+	if isHeadRequest(r) {
+		return
+	}
+	if id := tabClientID(w, r); id != "" {
+		globalTabStore.open(id, absFilePath)
+	}
+	refreshFileWatches()
+	broadcastPresence()
+}
+
+// trackTabClient counts an SSE connection towards its client's watched tabs
+// and presence, and returns the function that releases it
+func trackTabClient(w http.ResponseWriter, r *http.Request) func() {
+	clientID := tabClientID(w, r)
+	if clientID == "" {
+		return func() {}
+	}
+	globalTabStore.connect(clientID, r.UserAgent())
+	refreshFileWatches()
+	broadcastPresence()
+	return func() {
+		globalTabStore.disconnect(clientID)
+		refreshFileWatches()
+		broadcastPresence()
+	}
+}
+
+// refreshFileWatches points the file watcher at every open tab when the set changed
+func refreshFileWatches() {
+	if *noWatch {
+		return
+	}
+	files := slices.DeleteFunc(globalTabStore.openFiles(), func(f string) bool { return !isWhitelistedFile(f) })
+
+	watchedFilesMutex.Lock()
+	defer watchedFilesMutex.Unlock()
+	if slices.Equal(files, watchedFiles) {
+		return
+	}
+	watchedFiles = files
+	if err := fileWatcher.WatchFiles(files, notifyFileModified); err != nil {
+		log.Printf("Error watching file: %v", err)
+	}
+}
+
+// handleAPITabs lists (GET), opens (POST {"path"}) or closes (DELETE ?path=)
+// the calling client's tabs and responds with the resulting tab list
+func handleAPITabs(w http.ResponseWriter, r *http.Request) {
+	clientID := tabClientID(w, r)
+	if clientID == "" {
+		writeError(w, errCodeInternal, "Cannot identify client", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req apiTabRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		absPath, ok := resolveWhitelistedPath(w, req.Path)
+		if !ok {
+			return
+		}
+		globalTabStore.open(clientID, absPath)
+		refreshFileWatches()
+		broadcastPresence()
+	case http.MethodDelete:
+		absPath, ok := resolveWhitelistedPath(w, r.URL.Query().Get("path"))
+		if !ok {
+			return
+		}
+		globalTabStore.close(clientID, absPath)
+		refreshFileWatches()
+		broadcastPresence()
+	}
+
+	files, active := globalTabStore.tabs(clientID, isWhitelistedFile)
+	resp := apiTabsResponse{Tabs: make([]apiTab, 0, len(files))}
+	for _, f := range files {
+		resp.Tabs = append(resp.Tabs, apiTab{Path: filepath.ToSlash(getRelativePath(f)), Title: filepath.Base(f)})
+	}
+	if active != "" {
+		resp.Active = filepath.ToSlash(getRelativePath(active))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestTabStore tests per-client tab order, activation and closing
+func TestTabStore(t *testing.T) {
+	ts := newTabStore()
+	ts.open("a", "/docs/one.md")
+	ts.open("a", "/docs/two.md")
+	ts.open("a", "/docs/three.md")
+	ts.open("a", "/docs/two.md") // Re-opening activates without reordering
+	ts.open("b", "/docs/four.md")
+
+	all := func(string) bool { return true }
+	files, active := ts.tabs("a", all)
+	if want := []string{"/docs/one.md", "/docs/two.md", "/docs/three.md"}; !reflect.DeepEqual(files, want) || active != "/docs/two.md" {
+		t.Errorf("tabs(a) = %v, %q", files, active)
+	}
+
+	// Closing the active tab activates its right-hand neighbour
+	ts.close("a", "/docs/two.md")
+	if files, active = ts.tabs("a", all); active != "/docs/three.md" || len(files) != 2 {
+		t.Errorf("after closing active: %v, %q", files, active)
+	}
+
+	// The watcher follows the tabs of connected clients only
+	if got := ts.openFiles(); len(got) != 0 {
+		t.Errorf("openFiles() without connections = %v, want none", got)
+	}
+	ts.connect("a", "")
+	ts.connect("b", "")
+	if got, want := ts.openFiles(), []string{"/docs/four.md", "/docs/one.md", "/docs/three.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("openFiles() = %v, want %v", got, want)
+	}
+	ts.disconnect("b")
+	if got, want := ts.openFiles(), []string{"/docs/one.md", "/docs/three.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("openFiles() after disconnect = %v, want %v", got, want)
+	}
+
+	ts.removeEverywhere("/docs/four.md")
+	if files, active = ts.tabs("b", all); len(files) != 0 || active != "" {
+		t.Errorf("after removeEverywhere: %v, %q", files, active)
+	}
+
+	// Files that are no longer viewable are pruned
+	files, _ = ts.tabs("a", func(f string) bool { return f != "/docs/one.md" })
+	if want := []string{"/docs/three.md"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("pruned tabs = %v, want %v", files, want)
+	}
+}
+
+// TestTabStoreLimits tests that old tabs and old clients are dropped
+func TestTabStoreLimits(t *testing.T) {
+	ts := newTabStore()
+	for i := 0; i <= maxTabsPerClient; i++ {
+		ts.open("a", filepath.Join("/docs", strings.Repeat("x", i+1)+".md"))
+	}
+	files, active := ts.tabs("a", func(string) bool { return true })
+	if len(files) != maxTabsPerClient || files[len(files)-1] != active {
+		t.Errorf("got %d tabs (active %q), want %d ending with the active one", len(files), active, maxTabsPerClient)
+	}
+
+	// Connected clients outlive older disconnected ones
+	ts.connect("a", "")
+	for i := 0; i < maxTabClients; i++ {
+		ts.open(strings.Repeat("c", i+1), "/docs/x.md")
+	}
+	if _, found := ts.clients["a"]; !found || len(ts.clients) != maxTabClients {
+		t.Errorf("connected client evicted or store has %d clients", len(ts.clients))
+	}
+	if _, found := ts.clients["c"]; found {
+		t.Error("oldest disconnected client kept")
+	}
+}
+
+// TestHandleAPITabs tests opening, listing and closing tabs over HTTP
+func TestHandleAPITabs(t *testing.T) {
+	serveTestFiles(t, "tabs", map[string]string{"one.md": "# one.md\n", "two.md": "# two.md\n"})
+	prevNoWatch, prevStore := *noWatch, globalTabStore
+	*noWatch, globalTabStore = true, newTabStore()
+	defer func() { *noWatch, globalTabStore = prevNoWatch, prevStore }()
+
+	cookie := &http.Cookie{Name: tabClientCookie, Value: "client-1"}
+	call := func(method, target, body string) (int, apiTabsResponse) {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		handleAPITabs(rec, r)
+		var resp apiTabsResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s %s: invalid JSON: %v", method, target, err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	if code, resp := call(http.MethodGet, "/api/tabs", ""); code != http.StatusOK || len(resp.Tabs) != 0 {
+		t.Fatalf("initial GET = %d %+v", code, resp)
+	}
+
+	// Viewing a file opens a tab for the viewing client
+	view := httptest.NewRequest(http.MethodGet, "/view/one.md", nil)
+	view.AddCookie(cookie)
+	routes().ServeHTTP(httptest.NewRecorder(), view)
+
+	code, resp := call(http.MethodPost, "/api/tabs", `{"path": "two.md"}`)
+	want := apiTabsResponse{Tabs: []apiTab{{Path: "one.md", Title: "one.md"}, {Path: "two.md", Title: "two.md"}}, Active: "two.md"}
+	if code != http.StatusOK || !reflect.DeepEqual(resp, want) {
+		t.Errorf("POST = %d %+v, want %+v", code, resp, want)
+	}
+
+	code, resp = call(http.MethodDelete, "/api/tabs?path=two.md", "")
+	want = apiTabsResponse{Tabs: []apiTab{{Path: "one.md", Title: "one.md"}}, Active: "one.md"}
+	if code != http.StatusOK || !reflect.DeepEqual(resp, want) {
+		t.Errorf("DELETE = %d %+v, want %+v", code, resp, want)
+	}
+
+	if code, _ := call(http.MethodPost, "/api/tabs", `{"path": "missing.md"}`); code != http.StatusForbidden {
+		t.Errorf("POST missing file = %d, want 403", code)
+	}
+}
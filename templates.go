@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// templateVarPattern matches {{name}} placeholders in page templates
+var templateVarPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// pageTemplate is a markdown template available to /create
+type pageTemplate struct {
+	Name   string `json:"name"`   // File name without .md
+	Source string `json:"source"` // "project" (.peekm/templates) or "user" (config dir)
+	path   string
+}
+
+// templateDirs returns the template directories, project templates first so
+// they override user templates with the same name
+func templateDirs() []pageTemplate {
+	dirs := []pageTemplate{{Source: "project", path: filepath.Join(resolveFilePath("."), ".peekm", "templates")}}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, pageTemplate{Source: "user", path: filepath.Join(configDir, "peekm", "templates")})
+	}
+	return dirs
+}
+
+// listTemplates returns the available templates, sorted by name
+func listTemplates() []pageTemplate {
+	seen := make(map[string]bool)
+	templates := []pageTemplate{}
+	for _, dir := range templateDirs() {
+		entries, err := os.ReadDir(dir.path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), ".md")
+			if entry.IsDir() || name == entry.Name() || seen[name] {
+				continue
+			}
+			seen[name] = true
+			templates = append(templates, pageTemplate{Name: name, Source: dir.Source, path: filepath.Join(dir.path, entry.Name())})
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// findTemplate looks up a template by name (e.g. "daily" for daily.md)
+func findTemplate(name string) (pageTemplate, error) {
+	name = strings.TrimSuffix(name, ".md")
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return pageTemplate{}, fmt.Errorf("invalid template name %q", name)
+	}
+	for _, tmpl := range listTemplates() {
+		if tmpl.Name == name {
+			return tmpl, nil
+		}
+	}
+	return pageTemplate{}, fmt.Errorf("template %q not found: %w", name, os.ErrNotExist)
+}
+
+// instantiateTemplate reads a template and expands its variables for a new page at relPath
+func instantiateTemplate(name, relPath string, vars map[string]string) (string, error) {
+	tmpl, err := findTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(tmpl.path)
+	if err != nil {
+		return "", err
+	}
+	return expandTemplate(string(content), templateVars(relPath, time.Now(), vars)), nil
+}
+
+// templateVars returns the built-in variables for a page, overridden by extra
+func templateVars(relPath string, now time.Time, extra map[string]string) map[string]string {
+	vars := map[string]string{
+		"title":    strings.TrimSuffix(filepath.Base(relPath), filepath.Ext(relPath)),
+		"date":     now.Format("2006-01-02"),
+		"time":     now.Format("15:04"),
+		"datetime": now.Format(time.RFC3339),
+		"year":     now.Format("2006"),
+		"author":   templateAuthor(),
+	}
+	for k, v := range extra {
+		vars[k] = v
+	}
+	return vars
+}
+
+// templateAuthor returns $PEEKM_AUTHOR, falling back to the current user's name
+func templateAuthor() string {
+	if author := os.Getenv("PEEKM_AUTHOR"); author != "" {
+		return author
+	}
+	if u, err := user.Current(); err == nil {
+		if u.Name != "" {
+			return u.Name
+		}
+		return u.Username
+	}
+	return ""
+}
+
+// expandTemplate replaces {{name}} placeholders; unknown names are left unchanged
+func expandTemplate(content string, vars map[string]string) string {
+	return templateVarPattern.ReplaceAllStringFunc(content, func(match string) string {
+		name := templateVarPattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// serveAPITemplates lists the templates available to /create
+func serveAPITemplates(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, listTemplates())
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestExpandTemplate tests variable substitution in page templates
+func TestExpandTemplate(t *testing.T) {
+	now := time.Date(2024, 5, 12, 9, 30, 0, 0, time.UTC)
+	t.Setenv("PEEKM_AUTHOR", "Ada")
+	vars := templateVars("adr/0007-use-sqlite.md", now, map[string]string{"status": "Proposed"})
+
+	got := expandTemplate("# {{title}}\n\n{{ date }} {{time}} by {{author}}\nStatus: {{status}}\n{{unknown}}", vars)
+	want := "# 0007-use-sqlite\n\n2024-05-12 09:30 by Ada\nStatus: Proposed\n{{unknown}}"
+	if got != want {
+		t.Errorf("expandTemplate() = %q, want %q", got, want)
+	}
+}
+
+// TestFindTemplate tests template lookup in the project and user template directories
+func TestFindTemplate(t *testing.T) {
+	dir := t.TempDir()
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	userDir, err := os.UserConfigDir()
+	if err != nil {
+		t.Skipf("no user config dir: %v", err)
+	}
+
+	prevDir := browseDir
+	browseDir = dir
+	defer func() { browseDir = prevDir }()
+
+	writeTemplate := func(base, name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(base, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(base, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	projectTemplates := filepath.Join(dir, ".peekm", "templates")
+	userTemplates := filepath.Join(userDir, "peekm", "templates")
+	writeTemplate(projectTemplates, "adr.md", "project adr")
+	writeTemplate(userTemplates, "adr.md", "user adr")
+	writeTemplate(userTemplates, "daily.md", "# {{date}}")
+	writeTemplate(userTemplates, "notes.txt", "not a template")
+
+	templates := listTemplates()
+	if len(templates) != 2 || templates[0].Name != "adr" || templates[0].Source != "project" || templates[1].Name != "daily" {
+		t.Errorf("listTemplates() = %+v, want project adr and user daily", templates)
+	}
+
+	content, err := instantiateTemplate("adr", "decision.md", nil)
+	if err != nil || content != "project adr" {
+		t.Errorf("instantiateTemplate(adr) = %q, %v; want project template", content, err)
+	}
+
+	if _, err := findTemplate("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("findTemplate(missing) error = %v, want not exist", err)
+	}
+	for _, name := range []string{"", "../adr", ".hidden"} {
+		if _, err := findTemplate(name); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("findTemplate(%q) error = %v, want invalid name", name, err)
+		}
+	}
+}
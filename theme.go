@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Theme files that add to the built-in theme instead of replacing a file
+const (
+	customCSSFile = "custom.css" // Appended to the theme CSS on every page
+	customJSFile  = "custom.js"  // Appended to the theme manager script on every page
+)
+
+// themeOverrideDirs returns the existing theme override directories, highest
+// priority first: .peekm/theme in the browsed directory, then the user's
+func themeOverrideDirs() []string {
+	candidates := []string{filepath.Join(resolveFilePath("."), ".peekm", "theme")}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(configDir, "peekm", "theme"))
+	}
+
+	var dirs []string
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// readThemeFile reads a theme file from the first override directory that has
+// it, falling back to the embedded theme
+func readThemeFile(dirs []string, name string) ([]byte, error) {
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return themeFS.ReadFile("theme/" + name)
+}
+
+// readCustomFiles concatenates a custom theme file from every override
+// directory, lowest priority first so project rules win over user rules
+func readCustomFiles(dirs []string, name string) (string, error) {
+	var combined string
+	for _, dir := range slices.Backward(dirs) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		combined += "\n/* " + filepath.Join(dir, name) + " */\n" + string(data)
+	}
+	return combined, nil
+}
+
+// loadTheme loads the CSS, scripts, page templates and UI translations, layering the files in
+// dirs (see themeOverrideDirs) over the embedded theme
+func loadTheme(dirs []string) error {
+	assets := []struct {
+		name string
+		dst  *string
+	}{
+		{"github-markdown.css", &githubCSS},
+		{"theme-overrides.css", &themeOverrides},
+		{"theme-manager.js", &themeManagerJS},
+		{"editor.js", &editorJS},
+		{"navigation.js", &navigationJS},
+	}
+	loaded := make([]string, len(assets))
+	for i, asset := range assets {
+		data, err := readThemeFile(dirs, asset.name)
+		if err != nil {
+			return fmt.Errorf("load %s: %w", asset.name, err)
+		}
+		loaded[i] = string(data)
+	}
+
+	customCSS, err := readCustomFiles(dirs, customCSSFile)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", customCSSFile, err)
+	}
+	customJS, err := readCustomFiles(dirs, customJSFile)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", customJSFile, err)
+	}
+
+	languages, err := loadLanguages(dirs)
+	if err != nil {
+		return err
+	}
+	if err := loadThemeTemplates(dirs); err != nil {
+		return err
+	}
+	uiLanguages = languages
+	for i, asset := range assets {
+		*asset.dst = loaded[i]
+	}
+	themeOverrides += customCSS
+	themeManagerJS += customJS
+	return nil
+}
+
+// loadThemeTemplates parses the page templates, replacing the current ones only
+// when all of them parse
+func loadThemeTemplates(dirs []string) error {
+	funcMap := template.FuncMap{
+		"formatISO": func(t time.Time) string {
+			return t.Format(time.RFC3339)
+		},
+	}
+	parse := func(tmpl *template.Template, names ...string) (*template.Template, error) {
+		for _, name := range names {
+			data, err := readThemeFile(dirs, name)
+			if err != nil {
+				return nil, fmt.Errorf("load %s: %w", name, err)
+			}
+			if tmpl, err = tmpl.Parse(string(data)); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", name, err)
+			}
+		}
+		return tmpl, nil
+	}
+
+	browser, err := parse(template.New("file-browser").Funcs(funcMap), "file-browser.html", "session-info-panel.html")
+	if err != nil {
+		return err
+	}
+	// The mobile layout redefines blocks of the file browser template
+	mobile, err := parse(template.Must(browser.Clone()), "mobile.html")
+	if err != nil {
+		return err
+	}
+	partial, err := parse(template.New("file-browser-partial").Funcs(funcMap), "file-browser-partial.html", "session-info-panel.html")
+	if err != nil {
+		return err
+	}
+	embedPage, err := parse(template.New("embed"), "embed.html")
+	if err != nil {
+		return err
+	}
+	comparePage, err := parse(template.New("compare"), "compare.html")
+	if err != nil {
+		return err
+	}
+	reviewPage, err := parse(template.New("review").Funcs(funcMap), "review.html")
+	if err != nil {
+		return err
+	}
+	errorPage, err := parse(template.New("error"), "error.html")
+	if err != nil {
+		return err
+	}
+
+	fileBrowserTmpl, fileBrowserMobileTmpl, fileBrowserPartialTmpl = browser, mobile, partial
+	embedTmpl, compareTmpl, reviewTmpl, errorTmpl = embedPage, comparePage, reviewPage, errorPage
+	return nil
+}
+
+// applyThemeOverrides reloads the theme with the user and project override
+// directories, keeping the built-in theme if an override is broken
+func applyThemeOverrides() {
+	dirs := themeOverrideDirs()
+	if len(dirs) == 0 {
+		return
+	}
+	if err := loadTheme(dirs); err != nil {
+		log.Printf("Warning: Ignoring theme overrides: %v", err)
+		if err := loadTheme(nil); err != nil {
+			log.Fatalf("Failed to load theme: %v", err)
+		}
+		return
+	}
+	for _, dir := range dirs {
+		fmt.Printf("Theme overrides from %s\n", dir)
+	}
+}
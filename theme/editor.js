@@ -1,7 +1,13 @@
 // Edit mode functionality
 let originalMarkdown = '';
 let autoSaveTimeout = null;
+let spellingRanges = []; // Misspellings in the last saved content
 const AUTO_SAVE_DEBOUNCE_MS = 300;
+let previewTimeout = null;
+let previewRequest = 0; // Increments per request so stale responses are dropped
+const PREVIEW_DEBOUNCE_MS = 150;
+const PREVIEW_STORAGE_KEY = 'peekm-editor-preview';
+let syncingScroll = null; // Pane whose scroll is being mirrored (prevents feedback loops)
 
 function getCurrentFilePath() {
     // For browser mode (SPA), get from window.location.pathname
@@ -32,22 +38,44 @@ async function toggleEditMode() {
             originalMarkdown = await response.text();
             editor.value = originalMarkdown;
         } catch (err) {
-            alert('Failed to load file for editing: ' + err.message);
+            alert(t('Failed to load file for editing: %s', err.message));
             return;
         }
     }
 
     editorContainer.classList.add('active');
     editor.focus();
+    refreshLint();
+    refreshSpelling();
+    setPreviewVisible(localStorage.getItem(PREVIEW_STORAGE_KEY) === 'on');
 
     // Setup debounced auto-save (only once per editor session)
     if (!editor.dataset.autoSaveEnabled) {
         editor.addEventListener('input', handleEditorInput);
+        editor.addEventListener('scroll', () => {
+            document.getElementById('editor-highlights').scrollTop = editor.scrollTop;
+            mirrorScroll(editor, syncPreviewToEditor);
+        });
+        const preview = document.getElementById('editor-preview');
+        if (preview) {
+            preview.addEventListener('scroll', () => mirrorScroll(preview, syncEditorToPreview));
+            preview.addEventListener('click', handlePreviewClick);
+        }
         editor.dataset.autoSaveEnabled = 'true';
     }
 }
 
 function handleEditorInput() {
+    // Ranges are stale until the next save is checked
+    spellingRanges = [];
+    renderSpellingHighlights();
+
+    // Re-render the live preview shortly after typing pauses
+    if (previewTimeout) {
+        clearTimeout(previewTimeout);
+    }
+    previewTimeout = setTimeout(refreshPreview, PREVIEW_DEBOUNCE_MS);
+
     // Clear existing timeout
     if (autoSaveTimeout) {
         clearTimeout(autoSaveTimeout);
@@ -79,18 +107,283 @@ async function autoSaveMarkdown() {
         });
 
         if (!response.ok) {
-            const errorText = await response.text();
-            console.error('[Editor] Auto-save failed:', errorText);
+            console.error('[Editor] Auto-save failed:', (await responseError(response)).message);
             return;
         }
 
         originalMarkdown = content;
         console.log('[Editor] Auto-saved');
+        refreshLint();
+        refreshSpelling();
     } catch (err) {
         console.error('[Editor] Auto-save error:', err.message);
     }
 }
 
+// togglePreview shows or hides the live preview beside the editor
+function togglePreview() {
+    const preview = document.getElementById('editor-preview');
+    if (preview) setPreviewVisible(preview.hidden);
+}
+
+// setPreviewVisible shows or hides the preview pane and remembers the choice
+function setPreviewVisible(visible) {
+    const preview = document.getElementById('editor-preview');
+    const button = document.getElementById('preview-toggle');
+    if (!preview) return;
+
+    preview.hidden = !visible;
+    if (button) button.setAttribute('aria-pressed', visible);
+    try {
+        localStorage.setItem(PREVIEW_STORAGE_KEY, visible ? 'on' : 'off');
+    } catch (err) {
+        console.error('[Editor] Failed to save preview preference:', err);
+    }
+    if (visible) refreshPreview();
+}
+
+// refreshPreview renders the unsaved editor content into the preview pane
+async function refreshPreview() {
+    const editor = document.getElementById('markdown-editor');
+    const preview = document.getElementById('editor-preview');
+    if (!editor || !preview || preview.hidden) return;
+
+    const request = ++previewRequest;
+    try {
+        const response = await fetch('/api/preview', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ markdown: editor.value })
+        });
+        if (!response.ok) throw await responseError(response);
+        const data = await response.json();
+
+        // A newer request is on its way; keep the preview in step with typing order
+        if (request !== previewRequest) return;
+        preview.innerHTML = data.html;
+        syncPreviewToEditor();
+    } catch (err) {
+        console.error('[Editor] Preview failed:', err.message);
+    }
+}
+
+// mirrorScroll runs sync for a scroll of source unless source is itself being
+// scrolled to mirror the other pane
+function mirrorScroll(source, sync) {
+    if (syncingScroll && syncingScroll !== source) return;
+    syncingScroll = source;
+    sync();
+    requestAnimationFrame(() => { syncingScroll = null; });
+}
+
+// editorLineHeight returns the textarea's line height in pixels
+function editorLineHeight(editor) {
+    return parseFloat(getComputedStyle(editor).lineHeight) || 22;
+}
+
+// previewBlocks returns the preview's blocks with a data-source-line attribute
+// as {line, top} in document order (top relative to the preview's content)
+function previewBlocks(preview) {
+    const origin = preview.getBoundingClientRect().top - preview.scrollTop;
+    return Array.from(preview.querySelectorAll('[data-source-line]')).map(el => ({
+        line: parseInt(el.dataset.sourceLine, 10),
+        top: el.getBoundingClientRect().top - origin
+    }));
+}
+
+// syncPreviewToEditor scrolls the preview to the block at the editor's top line,
+// interpolating between the blocks around it
+function syncPreviewToEditor() {
+    const editor = document.getElementById('markdown-editor');
+    const preview = document.getElementById('editor-preview');
+    if (!editor || !preview || preview.hidden) return;
+
+    const line = editor.scrollTop / editorLineHeight(editor) + 1;
+    let before = { line: 1, top: 0 };
+    let after = null;
+    for (const block of previewBlocks(preview)) {
+        if (block.line > line) {
+            after = block;
+            break;
+        }
+        before = block;
+    }
+
+    let top = before.top;
+    if (after && after.line > before.line) {
+        top += (after.top - before.top) * (line - before.line) / (after.line - before.line);
+    }
+    preview.scrollTop = top;
+}
+
+// syncEditorToPreview scrolls the editor to the source line of the preview's top block
+function syncEditorToPreview() {
+    const editor = document.getElementById('markdown-editor');
+    const preview = document.getElementById('editor-preview');
+    if (!editor || !preview) return;
+
+    let before = { line: 1, top: 0 };
+    let after = null;
+    for (const block of previewBlocks(preview)) {
+        if (block.top > preview.scrollTop) {
+            after = block;
+            break;
+        }
+        before = block;
+    }
+
+    let line = before.line;
+    if (after && after.top > before.top) {
+        line += (after.line - before.line) * (preview.scrollTop - before.top) / (after.top - before.top);
+    }
+    editor.scrollTop = (line - 1) * editorLineHeight(editor);
+}
+
+// handlePreviewClick selects the source line of the clicked preview block
+function handlePreviewClick(event) {
+    const block = event.target.closest('[data-source-line]');
+    if (!block) return;
+
+    // Links would leave the editor; jump to their source instead
+    event.preventDefault();
+    selectEditorLine(parseInt(block.dataset.sourceLine, 10));
+}
+
+// refreshLint shows the saved file's lint problems below the editor
+async function refreshLint() {
+    const panel = document.getElementById('lint-panel');
+    if (!panel) return;
+
+    try {
+        const path = getCurrentFilePath().replace(/^\//, '');
+        const response = await fetch(`/api/lint?path=${encodeURIComponent(path)}`);
+        if (!response.ok) throw await responseError(response);
+        const result = await response.json();
+
+        panel.replaceChildren(...result.diagnostics.map(d => {
+            const item = document.createElement('li');
+            const location = document.createElement('span');
+            location.className = 'lint-location';
+            location.textContent = `${d.line}:${d.column}`;
+            const rule = document.createElement('span');
+            rule.className = 'lint-rule';
+            rule.textContent = d.rule;
+            item.append(location, d.message, rule);
+            item.addEventListener('click', () => selectEditorLine(d.line));
+            return item;
+        }));
+        panel.hidden = result.diagnostics.length === 0;
+    } catch (err) {
+        console.error('[Editor] Lint failed:', err.message);
+        panel.hidden = true;
+    }
+}
+
+// refreshSpelling underlines the saved file's misspellings and lists them below the editor
+async function refreshSpelling() {
+    const panel = document.getElementById('spelling-panel');
+    if (!panel) return;
+
+    try {
+        const path = getCurrentFilePath().replace(/^\//, '');
+        const response = await fetch(`/api/spellcheck?path=${encodeURIComponent(path)}`);
+        if (!response.ok) throw await responseError(response);
+        const result = await response.json();
+        spellingRanges = result.misspellings;
+
+        panel.replaceChildren(...spellingRanges.map(m => {
+            const item = document.createElement('li');
+            const location = document.createElement('span');
+            location.className = 'lint-location';
+            location.textContent = `${m.line}:${m.column}`;
+            const add = document.createElement('button');
+            add.className = 'spelling-add';
+            add.textContent = t('Add to dictionary');
+            add.addEventListener('click', (e) => {
+                e.stopPropagation();
+                addToDictionary(m.word);
+            });
+            item.append(location, `${m.word} → ${m.suggestion}`, add);
+            item.addEventListener('click', () => selectEditorLine(m.line, m.column, m.length));
+            return item;
+        }));
+        panel.hidden = spellingRanges.length === 0;
+    } catch (err) {
+        console.error('[Editor] Spellcheck failed:', err.message);
+        spellingRanges = [];
+        panel.hidden = true;
+    }
+    renderSpellingHighlights();
+}
+
+// renderSpellingHighlights mirrors the editor text with misspelled words wrapped in <mark>
+function renderSpellingHighlights() {
+    const editor = document.getElementById('markdown-editor');
+    const highlights = document.getElementById('editor-highlights');
+    if (!editor || !highlights) return;
+
+    const byLine = new Map();
+    for (const m of spellingRanges) {
+        if (!byLine.has(m.line)) byLine.set(m.line, []);
+        byLine.get(m.line).push(m);
+    }
+
+    const nodes = [];
+    editor.value.split('\n').forEach((line, i) => {
+        if (i > 0) nodes.push('\n');
+        const chars = Array.from(line); // Columns count code points, like the server
+        let pos = 0;
+        for (const m of byLine.get(i + 1) || []) {
+            const start = m.column - 1;
+            nodes.push(chars.slice(pos, start).join(''));
+            const mark = document.createElement('mark');
+            mark.textContent = chars.slice(start, start + m.length).join('');
+            nodes.push(mark);
+            pos = start + m.length;
+        }
+        nodes.push(chars.slice(pos).join(''));
+    });
+    // A trailing newline needs content after it to keep the heights equal
+    nodes.push(' ');
+    highlights.replaceChildren(...nodes);
+    highlights.scrollTop = editor.scrollTop;
+}
+
+// addToDictionary accepts a word for this project and rechecks the file
+async function addToDictionary(word) {
+    try {
+        const response = await fetch('/api/spellcheck', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ word })
+        });
+        if (!response.ok) throw await responseError(response);
+        refreshSpelling();
+    } catch (err) {
+        alert(t('Failed to add to dictionary: %s', err.message));
+    }
+}
+
+// selectEditorLine selects a 1-based line (or a range of it) in the editor and scrolls it into view
+function selectEditorLine(line, column, length) {
+    const editor = document.getElementById('markdown-editor');
+    const lines = editor.value.split('\n');
+    const text = lines[line - 1] || '';
+    let start = lines.slice(0, line - 1).reduce((sum, l) => sum + l.length + 1, 0);
+    let end = start + text.length;
+    if (column) {
+        const before = Array.from(text).slice(0, column - 1).join('');
+        const word = Array.from(text).slice(column - 1, column - 1 + length).join('');
+        start += before.length;
+        end = start + word.length;
+    }
+
+    editor.focus();
+    editor.setSelectionRange(start, end);
+    const lineHeight = parseFloat(getComputedStyle(editor).lineHeight) || 22;
+    editor.scrollTop = Math.max(0, (line - 3) * lineHeight);
+}
+
 function cancelEdit() {
     const editor = document.getElementById('markdown-editor');
     const editorContainer = document.getElementById('editor-container');
@@ -122,8 +415,7 @@ async function saveMarkdown() {
         });
 
         if (!response.ok) {
-            const errorText = await response.text();
-            throw new Error(errorText || 'Save failed');
+            throw await responseError(response, 'Save failed');
         }
 
         originalMarkdown = content;
@@ -135,7 +427,24 @@ async function saveMarkdown() {
         // SSE will automatically trigger preview update - no reload needed
         console.log('[Editor] File saved, waiting for SSE update...');
     } catch (err) {
-        alert('Failed to save: ' + err.message);
+        alert(t('Failed to save: %s', err.message));
+    }
+}
+
+// insertTableOfContents adds or refreshes the current file's <!-- toc --> block
+async function insertTableOfContents() {
+    try {
+        const response = await fetch('/insert-toc', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ path: getCurrentFilePath().replace(/^\//, '') })
+        });
+        if (!response.ok) throw await responseError(response);
+
+        // Reload the source next time the editor opens; SSE refreshes the preview
+        originalMarkdown = '';
+    } catch (err) {
+        alert(t('Failed to insert table of contents: %s', err.message));
     }
 }
 
@@ -6,6 +6,7 @@ let eventSource = null;
 let reconnectAttempts = 0;
 const maxReconnectDelay = 30000; // 30 seconds max
 let refreshTreeTimer = null; // For debouncing tree refreshes
+let lastEventId = ''; // Latest SSE event ID, sent on reconnect so missed events are replayed
 
 // Connect to SSE and maintain persistent connection
 function connectSSE() {
@@ -14,11 +15,13 @@ function connectSSE() {
         return;
     }
 
-    eventSource = new EventSource('/events');
+    // Reconnecting with a new EventSource loses the Last-Event-ID header, so pass it in the URL
+    eventSource = new EventSource(lastEventId ? '/events?last_event_id=' + encodeURIComponent(lastEventId) : '/events');
 
     eventSource.onopen = function() {
         console.log('[SSE] Connected');
         reconnectAttempts = 0;
+        loadPresence(); // Presence events are not replayed
 
         // Show connected state immediately
         const dot = document.getElementById('connection-dot');
@@ -29,6 +32,9 @@ function connectSSE() {
 
     eventSource.onmessage = function(event) {
         console.log('[SSE] Received message:', event.data);
+        if (event.lastEventId) {
+            lastEventId = event.lastEventId;
+        }
 
         // Try to parse as JSON for typed messages
         try {
@@ -37,7 +43,7 @@ function connectSSE() {
 
             if (data.type === 'file_added') {
                 console.log('[SSE] Handling file_added for:', data.path);
-                showToast(`New file: ${data.path}`, data.path, data.session);
+                showToast(t('New file: %s', data.path), data.path, data.session);
                 // Optimistic update: insert immediately (fast, may be buggy)
                 insertFileIntoTree(data.path);
                 // Self-healing: debounced refresh from server (batches rapid updates)
@@ -48,6 +54,9 @@ function connectSSE() {
                 removeFileFromTree(data.path);
                 // Self-healing: debounced refresh from server
                 scheduleTreeRefresh();
+            } else if (data.type === 'file_renamed') {
+                console.log('[SSE] Handling file_renamed:', data.old_path, '->', data.path);
+                handleFileRenamed(data.old_path, data.path);
             } else if (data.type === 'file_modified') {
                 console.log('[SSE] Handling file_modified for:', data.path);
 
@@ -56,29 +65,57 @@ function connectSSE() {
                 const viewType = content ? content.dataset.view : null;
 
                 if (viewType === 'file') {
-                    // Extract current file path from URL (/view/{filepath})
-                    const currentPath = decodeURIComponent(window.location.pathname.replace('/view/', ''));
-
-                    if (currentPath === data.path) {
-                        // Auto-refresh the current page
-                        console.log('[SSE] Auto-refreshing current page');
-                        navigate(window.location.pathname, false);
+                    if (data.view === currentViewPath()) {
+                        // Patch in the changed blocks, or refresh the whole page
+                        if (!applyRenderPatch(data.patch)) {
+                            console.log('[SSE] Auto-refreshing current page');
+                            navigate(window.location.pathname, false);
+                        }
 
                         // Show notification if modified by Claude Code session
                         if (data.session) {
-                            showToast(`Updated by Claude: ${data.path}`, data.path, data.session);
+                            showToast(t('Updated by Claude: %s', data.path), data.path, data.session);
                         }
                     } else {
                         // Different file modified, show notification
-                        showToast(`File updated: ${data.path}`, data.path, data.session);
+                        showToast(t('File updated: %s', data.path), data.path, data.session);
                     }
                 } else {
                     // In browser view, just show notification
-                    showToast(`File updated: ${data.path}`, data.path, data.session);
+                    showToast(t('File updated: %s', data.path), data.path, data.session);
                 }
+            } else if (data.type === 'scan_progress') {
+                console.log('[SSE] Handling scan_progress:', data.files, data.done ? '(done)' : '');
+                handleScanProgress(data);
+            } else if (data.type === 'resync') {
+                console.log('[SSE] Missed events could not be replayed, resyncing');
+                resyncFromServer();
             } else if (data.type === 'connection_status') {
                 console.log('[SSE] Handling connection_status:', data.count);
                 updateConnectionStatus(data.count);
+            } else if (data.type === 'session_started' || data.type === 'session_tool_use') {
+                console.log('[SSE] Handling', data.type, 'for session:', data.session);
+                updateSessionActivity(data);
+            } else if (data.type === 'session_finished') {
+                console.log('[SSE] Handling session_finished for session:', data.session);
+                updateSessionActivity(data);
+                showToast(t('%s finished', agentName(data.source)), null, data.session);
+            } else if (data.type === 'subagent_finished') {
+                console.log('[SSE] Handling subagent_finished for session:', data.session);
+            } else if (data.type === 'navigate') {
+                console.log('[SSE] Handling navigate (follow mode) to:', data.path);
+                followNavigate(data.path);
+            } else if (data.type === 'follow_status') {
+                console.log('[SSE] Handling follow_status:', data.enabled);
+                updateFollowButton(data.enabled);
+            } else if (data.type === 'presence') {
+                updatePresence(data.viewers);
+            } else if (data.type === 'presenter_scroll') {
+                followPresenterScroll(data);
+            } else if (data.type === 'comments_changed') {
+                if (data.path === currentViewPath()) loadComments();
+            } else if (data.type === 'bookmarks_changed') {
+                scheduleTreeRefresh();
             }
         } catch (e) {
             console.log('[SSE] Not JSON, checking for plain string messages');
@@ -151,6 +188,7 @@ async function navigate(url, addToHistory = true) {
         }
 
         // Replace content
+        flushReadingPosition();
         const oldContent = document.getElementById('content');
         if (oldContent) {
             oldContent.replaceWith(newContent);
@@ -176,13 +214,17 @@ async function navigate(url, addToHistory = true) {
 
         // Restore tree state after DOM update (for browser mode)
         restoreTreeState();
+        updateTreeMeta();
 
         // Auto-expand parent directories for file navigation
         if (url.startsWith('/view/')) {
-            const filePath = url.replace('/view/', '');
+            const filePath = url.replace('/view/', '').split('#')[0];
             expandParentDirectories(filePath);
         }
 
+        // Deep links: scroll to the #anchor once the new content is in place
+        scrollToAnchor(new URL(url, window.location.href).hash);
+
         console.log('[Navigate] Navigated to:', url);
     } catch (error) {
         console.error('[Navigate] Error:', error);
@@ -200,12 +242,10 @@ function reinitializeScripts() {
 
     try {
         // Update download button visibility
-        const downloadBtn = document.getElementById('download-btn');
-        if (downloadBtn) {
-            if (viewType === 'file') {
-                downloadBtn.style.display = 'inline-block';
-            } else {
-                downloadBtn.style.display = 'none';
+        for (const id of ['download-btn', 'download-bundle-btn', 'copy-fragment-btn', 'share-btn']) {
+            const downloadBtn = document.getElementById(id);
+            if (downloadBtn) {
+                downloadBtn.style.display = viewType === 'file' ? 'inline-block' : 'none';
             }
         }
 
@@ -227,6 +267,20 @@ function reinitializeScripts() {
             initializeSidebar();
         }
 
+        // The progress bar starts over with the new content (and hides outside files)
+        updateReadingProgress();
+
+        // Refresh the open-file tabs (the server has just recorded this view),
+        // resume reading where it stopped (or catch up with a followed
+        // presenter's scrolling) and show comments
+        if (viewType === 'file') {
+            refreshTabs();
+            restoreReadingPosition();
+            applyPendingPresenterScroll();
+            loadComments();
+            initializeCriticView();
+        }
+
         // Initialize session info timestamps (if present)
         if (typeof initializeSessionInfo === 'function') {
             initializeSessionInfo();
@@ -239,6 +293,40 @@ function reinitializeScripts() {
     }
 }
 
+// Apply a file_modified patch: replace the changed top-level blocks of the
+// document in place, keeping the scroll position and everything around it.
+// Returns false when the page isn't the render the patch was made from (the
+// caller then refetches the whole page).
+function applyRenderPatch(patch) {
+    const body = document.getElementById('document-body');
+    // A streamed document's render hash follows it in #document-render
+    const late = document.getElementById('document-render');
+    const rendered = body && (body.dataset.render || (late && late.dataset.render));
+    if (!patch || !body || rendered !== patch.base) return false;
+
+    // Margin notes sit between the blocks but aren't part of the render
+    const blocks = Array.from(body.children).filter(el => !el.classList.contains('margin-note'));
+    if (blocks.length !== patch.blocks) return false;
+
+    // Remove the old blocks with the whitespace after them, then insert the new ones
+    const next = blocks[patch.from + patch.remove] || null;
+    for (let node = patch.remove > 0 ? blocks[patch.from] : next; node && node !== next;) {
+        const following = node.nextSibling;
+        node.remove();
+        node = following;
+    }
+    const template = document.createElement('template');
+    template.innerHTML = patch.html;
+    body.insertBefore(template.content, next);
+    body.dataset.render = patch.hash;
+    console.log(`[SSE] Patched ${patch.remove} block(s) from block ${patch.from}`);
+
+    loadComments();
+    initializeCriticView();
+    updateReadingProgress();
+    return true;
+}
+
 // Setup collapsible directory functionality
 function setupCollapse() {
     // Initialize collapsed directories on page load
@@ -276,6 +364,13 @@ function interceptLinks(e) {
         return; // Don't prevent default - let browser handle it
     }
 
+    // Wiki mode: offer to create missing [[Page]] targets
+    if (link.classList.contains('wikilink-missing')) {
+        e.preventDefault();
+        createWikiPage(link.dataset.wikiTarget);
+        return;
+    }
+
     // Only intercept internal links
     const url = link.getAttribute('href');
     if (!url || url.startsWith('http') || url.startsWith('//')) {
@@ -289,6 +384,89 @@ function interceptLinks(e) {
     }
 }
 
+// Scroll to the heading named by a URL fragment. Fragments that match no
+// element (heading text, renamed or mistyped anchors) are resolved with
+// /api/resolve-anchor; if nothing matches, a hint is shown above the content.
+async function scrollToAnchor(hash) {
+    const content = document.getElementById('content');
+    if (!hash || hash === '#' || !content || content.dataset.view !== 'file') return;
+
+    let anchor;
+    try {
+        anchor = decodeURIComponent(hash.slice(1));
+    } catch (e) {
+        anchor = hash.slice(1);
+    }
+
+    let target = document.getElementById(anchor);
+    if (!target) {
+        const filePath = decodeURIComponent(window.location.pathname.replace(/^\/view\//, ''));
+        try {
+            const response = await fetch(`/api/resolve-anchor?path=${encodeURIComponent(filePath)}&q=${encodeURIComponent(anchor)}`);
+            const data = response.ok ? await response.json() : null;
+            if (data && data.id) {
+                target = document.getElementById(data.id);
+                if (target) {
+                    history.replaceState(history.state, '', '#' + encodeURIComponent(data.id));
+                }
+            }
+        } catch (err) {
+            console.log('[Anchor] Cannot resolve anchor:', err);
+        }
+    }
+
+    if (!target) {
+        showAnchorHint(content, anchor);
+        return;
+    }
+    // The server-side ?anchor= check may have flagged a fragment we resolved
+    content.querySelectorAll('.anchor-hint').forEach(hint => hint.remove());
+    target.scrollIntoView({ block: 'start' });
+    target.classList.add('heading-target');
+    setTimeout(() => target.classList.remove('heading-target'), 2000);
+}
+
+// Show a "Heading not found" hint like the server's ?anchor= check
+function showAnchorHint(content, anchor) {
+    if (content.querySelector('.anchor-hint')) return;
+    const subtitle = content.querySelector('.subtitle');
+    if (!subtitle) return;
+    const hint = document.createElement('div');
+    hint.className = 'markdown-alert markdown-alert-warning anchor-hint';
+    hint.innerHTML = `<p class="markdown-alert-title">${escapeHtml(t('Heading not found'))}</p>
+        <p>${escapeHtml(t('No heading matches'))} <code>#${escapeHtml(anchor)}</code>.</p>`;
+    subtitle.after(hint);
+}
+
+// Resolve fragments that match no element (links typed by hand or generated by tools)
+window.addEventListener('hashchange', function() {
+    scrollToAnchor(window.location.hash);
+});
+
+// Large files: "Load more" appends the next rendered part instead of opening it
+document.addEventListener('click', async function(e) {
+    const link = e.target.closest('.load-more a[data-path]');
+    if (!link || e.metaKey || e.ctrlKey || e.shiftKey) return;
+    e.preventDefault();
+
+    const container = link.parentElement;
+    link.textContent = t('Loading…');
+    try {
+        const params = new URLSearchParams({ path: link.dataset.path, from: link.dataset.from });
+        const response = await fetch('/api/file-chunk?' + params);
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        const data = await response.json();
+        // The chunk ends with its own "Load more" link unless it is the last
+        container.insertAdjacentHTML('beforebegin', data.html);
+        container.remove();
+    } catch (error) {
+        console.error('[LoadMore] Error:', error);
+        window.location.href = link.href;
+    }
+});
+
 // Handle browser back/forward buttons
 window.addEventListener('popstate', function(e) {
     if (e.state && e.state.url) {
@@ -314,13 +492,27 @@ document.addEventListener('DOMContentLoaded', function() {
 
     // Restore tree state on initial page load
     restoreTreeState();
+    updateTreeMeta();
 
-    // Add initial history state
-    history.replaceState({ url: window.location.pathname }, '', window.location.pathname);
+    // Add initial history state (keeping the #anchor for deep links)
+    const initialHash = window.location.hash;
+    history.replaceState({ url: window.location.pathname + initialHash }, '', window.location.pathname + initialHash);
+    scrollToAnchor(initialHash);
 
     // Initialize notification badge
     updateNotificationBadge();
 
+    // Drag-and-drop import of markdown files and images
+    setupDropImport();
+
+    // Sync the follow toggle with the server (--follow or a previous toggle)
+    fetch('/api/follow')
+        .then(response => response.ok ? response.json() : null)
+        .then(data => {
+            if (data) updateFollowButton(data.enabled);
+        })
+        .catch(err => console.log('[Follow] Status unavailable:', err));
+
     console.log('[SPA] Initialization complete');
 });
 
@@ -373,6 +565,54 @@ const TOAST_CONFIG = {
     TRANSITION_TIME: 300      // CSS transition duration
 };
 
+// Working sessions (session ID → last activity text), updated by session_* SSE messages
+const activeSessions = new Map();
+
+// Display name for a hook source (/hook/{source})
+function agentName(source) {
+    const names = { 'claude-code': 'Claude', 'cursor': 'Cursor', 'aider': 'Aider' };
+    return names[source] || source || 'Claude';
+}
+let sessionActivityTimer = null;
+
+function updateSessionActivity(data) {
+    const indicator = document.getElementById('session-activity');
+    const text = document.getElementById('session-activity-text');
+    if (!indicator || !text) return;
+
+    clearTimeout(sessionActivityTimer);
+
+    if (data.type === 'session_finished') {
+        activeSessions.delete(data.session);
+    } else if (data.type === 'session_tool_use' && data.path) {
+        // Re-insert so the most recently active session is last
+        activeSessions.delete(data.session);
+        activeSessions.set(data.session, t('%s editing %s', agentName(data.source), data.path));
+    } else if (!activeSessions.has(data.session)) {
+        activeSessions.set(data.session, t('%s working', agentName(data.source)));
+    }
+
+    if (activeSessions.size > 0) {
+        // Show the most recent activity; mention other sessions by count
+        const latest = Array.from(activeSessions.values()).pop();
+        const others = activeSessions.size - 1;
+        text.textContent = others > 0 ? `${latest} (+${others})` : latest;
+        indicator.classList.remove('finished');
+        indicator.title = t('%d active AI session(s)', activeSessions.size);
+        indicator.hidden = false;
+        return;
+    }
+
+    // Briefly show the finished state, then hide
+    text.textContent = t('%s finished', agentName(data.source));
+    indicator.classList.add('finished');
+    indicator.title = '';
+    indicator.hidden = false;
+    sessionActivityTimer = setTimeout(() => {
+        indicator.hidden = true;
+    }, 5000);
+}
+
 function showToast(message, filePath, session) {
     // Save to notification history immediately
     saveNotification(message, filePath, session);
@@ -425,7 +665,7 @@ function formatBatchMessage(files) {
     if (count === 1) {
         // Single file - show full message with session if available
         const file = files[0];
-        const primary = file.session ? `${file.message} (Session: ${file.session})` : file.message;
+        const primary = file.session ? t('%s (Session: %s)', file.message, file.session) : file.message;
         return {
             primary: primary,
             secondary: null,
@@ -449,7 +689,7 @@ function formatBatchMessage(files) {
     if (count === 2) {
         // Two files - show both names
         return {
-            primary: `${count} files updated`,
+            primary: t('%d files updated', count),
             secondary: names.join(', '),
             icon,
             href,
@@ -460,8 +700,8 @@ function formatBatchMessage(files) {
     // 3+ files - show preview of first 2
     const preview = names.slice(0, 2).join(', ');
     return {
-        primary: `${count} files updated`,
-        secondary: `${preview}, and ${count - 2} more`,
+        primary: t('%d files updated', count),
+        secondary: t('%s, and %d more', preview, count - 2),
         icon,
         href,
         clickAction
@@ -594,6 +834,68 @@ function updateFileCount(delta) {
     }
 }
 
+// Follow a renamed file: move it in the tree, carry its notifications and
+// session metadata over, and keep showing it if it is open
+function handleFileRenamed(oldPath, newPath) {
+    removeFileFromTree(oldPath);
+    insertFileIntoTree(newPath);
+    scheduleTreeRefresh();
+    renameNotificationPath(oldPath, newPath);
+    renameSessionMetadataPath(oldPath, newPath);
+    refreshTabs();
+
+    const content = document.getElementById('content');
+    if (content && content.dataset.view === 'file') {
+        const currentPath = decodeURIComponent(window.location.pathname.replace('/view/', ''));
+        if (currentPath === oldPath) {
+            const newUrl = '/view/' + newPath.split('/').map(encodeURIComponent).join('/');
+            history.replaceState({ url: newUrl }, '', newUrl + window.location.hash);
+            navigate(newUrl, false);
+        }
+    }
+    showToast(t('Renamed: %s → %s', oldPath, newPath), newPath, null);
+}
+
+// Set the file count in the subtitle
+function setFileCount(count) {
+    const subtitle = document.querySelector('.subtitle');
+    if (subtitle) {
+        subtitle.textContent = subtitle.textContent.replace(/\d+ markdown file/, `${count} markdown file`);
+    }
+}
+
+// Rebuild state from the server's file list after missing live-update events
+// (the replay buffer had already dropped them, or the server restarted)
+async function resyncFromServer() {
+    try {
+        const response = await fetch('/api/resync', { headers: { 'Cache-Control': 'no-cache' } });
+        if (!response.ok) {
+            console.error('[resync] Server returned', response.status);
+            return;
+        }
+        const state = await response.json();
+        if (state.last_event_id) {
+            lastEventId = state.last_event_id;
+        }
+        setFileCount(state.files.length);
+        await refreshTree();
+
+        // The open file may have changed or been removed in the meantime
+        const content = document.getElementById('content');
+        if (content && content.dataset.view === 'file') {
+            const currentPath = decodeURIComponent(window.location.pathname.replace('/view/', ''));
+            if (state.files.includes(currentPath)) {
+                navigate(window.location.pathname, false);
+            } else {
+                showToast(t('File removed: %s', currentPath), null, null);
+            }
+        }
+        console.log('[resync] Resynced', state.files.length, 'files');
+    } catch (error) {
+        console.error('[resync] Error:', error);
+    }
+}
+
 // Dynamically insert a new file into the tree
 // Note: Event delegation from body.addEventListener('click', interceptLinks)
 // automatically handles SPA navigation for dynamically inserted links
@@ -631,8 +933,9 @@ function insertFileIntoTree(filePath) {
             div.style.paddingLeft = (depth * 16) + 'px';
         }
         div.innerHTML = `
-            <span class="tree-file">
+            <span class="tree-file" data-mtime="${new Date().toISOString()}">
                 <a href="/view/${encodeURIComponent(filePath)}">${escapeHtml(fileName)}</a>
+                <span class="tree-meta"></span>
             </span>
         `;
 
@@ -656,8 +959,9 @@ function insertFileIntoTree(filePath) {
                     // Parent should be at depth-1 and match the path
                     if (dirDepth === depth - 1) {
                         // Build expected parent path by checking siblings
+                        // The shown name may be a nav title, so prefer the path
                         const dirNameText = dirName.textContent.trim();
-                        if (pathParts[depth - 2] === dirNameText) {
+                        if (dir.dataset.path === parentPath || pathParts[depth - 2] === dirNameText) {
                             parentNode = dirItem.parentNode;
                             console.log('[insertFileIntoTree] Found parent directory:', dirNameText);
                             break;
@@ -707,6 +1011,7 @@ function insertFileIntoTree(filePath) {
 
         // Update file count in subtitle
         updateFileCount(1);
+        updateTreeMeta();
 
         console.log('[insertFileIntoTree] Successfully added file');
     } catch (error) {
@@ -809,6 +1114,24 @@ function expandParentDirectories(filePath) {
 }
 
 // Refresh tree from server (self-healing mechanism)
+// Active sidebar filter ("" or "?session=<id>"), set by filterTreeBySession
+let treeFilterQuery = '';
+
+// Show only the files modified by one AI session (empty ID clears the filter)
+function filterTreeBySession(sessionId) {
+    treeFilterQuery = sessionId ? '?session=' + encodeURIComponent(sessionId) : '';
+
+    const banner = document.getElementById('tree-filter-banner');
+    const label = document.getElementById('tree-filter-label');
+    if (banner && label) {
+        label.textContent = sessionId ? t('Session %s', sessionId.slice(0, 8)) : '';
+        label.title = sessionId || '';
+        banner.hidden = !sessionId;
+    }
+
+    refreshTree();
+}
+
 async function refreshTree() {
     try {
         const fileTree = document.querySelector('.sidebar-tree');
@@ -824,7 +1147,7 @@ async function refreshTree() {
         console.log('[refreshTree] Refreshing tree, scroll pos:', scrollPos);
 
         // 2. Fetch fresh tree HTML from server
-        const response = await fetch('/tree-html', {
+        const response = await fetch('/tree-html' + treeFilterQuery, {
             headers: {
                 'Cache-Control': 'no-cache'
             }
@@ -842,6 +1165,7 @@ async function refreshTree() {
 
         // 4. Restore expanded state from localStorage
         restoreTreeState();
+        updateTreeMeta();
 
         // 5. Restore scroll position
         if (sidebarContent) {
@@ -856,6 +1180,19 @@ async function refreshTree() {
 }
 
 // Schedule tree refresh with debouncing (batches rapid updates)
+// The startup scan found more files: grow the tree, and once it is done,
+// reload a page still waiting for the scan to pick the default file
+function handleScanProgress(data) {
+    scheduleTreeRefresh();
+    const status = document.getElementById('scan-status');
+    if (!status) return;
+    if (data.done) {
+        navigate(window.location.pathname + window.location.search, false);
+    } else {
+        status.querySelector('.scan-count').textContent = `(${data.files})`;
+    }
+}
+
 function scheduleTreeRefresh() {
     // Clear any pending refresh
     if (refreshTreeTimer) {
@@ -871,20 +1208,22 @@ function scheduleTreeRefresh() {
     console.log('[scheduleTreeRefresh] Tree refresh scheduled');
 }
 
-// Download HTML functionality
-function downloadHTML() {
-    // Extract current file path from URL
+// Download a file (the open one unless relPath names another) as
+// self-contained HTML, or with format 'md-bundle' as a zip of its markdown and
+// the images and attachments it references
+function downloadFile(format = 'html', relPath = '') {
+    // Name the file explicitly: the server exports exactly what is asked for
     const match = window.location.pathname.match(/\/view\/(.+)/);
-    const filePath = match ? '/' + decodeURIComponent(match[1]) : '';
+    const filePath = relPath || (match ? '/' + decodeURIComponent(match[1]) : '');
     if (!filePath) {
-        alert('No file currently open');
+        alert(t('No file currently open'));
         return;
     }
 
     fetch('/download', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ path: filePath })
+        body: JSON.stringify({ path: filePath, format })
     })
     .then(response => {
         if (!response.ok) {
@@ -892,7 +1231,7 @@ function downloadHTML() {
         }
         // Get filename from Content-Disposition header
         const contentDisposition = response.headers.get('Content-Disposition');
-        let filename = 'download.html';
+        let filename = format === 'md-bundle' ? 'download.zip' : 'download.html';
         if (contentDisposition) {
             const match = contentDisposition.match(/filename="?(.+)"?/);
             if (match) {
@@ -913,7 +1252,813 @@ function downloadHTML() {
     })
     .catch(error => {
         console.error('Download error:', error);
-        alert('Failed to download HTML file');
+        alert(format === 'md-bundle' ? t('Failed to download markdown bundle') : t('Failed to download HTML file'));
+    });
+}
+
+// Copy the open file for pasting into email, wikis or documents: as rich text
+// (styled HTML, with the markdown as plain text) or, with shift held, as HTML
+// source. The clipboard item takes promises so the copy keeps the click's
+// user activation while /api/export-fragment responds.
+function copyFragment(event) {
+    const match = window.location.pathname.match(/\/view\/(.+)/);
+    if (!match || !navigator.clipboard || typeof ClipboardItem === 'undefined') {
+        alert(t('Copying is not available here'));
+        return;
+    }
+    const asSource = event && event.shiftKey;
+    const button = event && event.currentTarget;
+
+    const fragment = fetch('/api/export-fragment?path=' + encodeURIComponent(decodeURIComponent(match[1])))
+        .then(response => {
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+            return response.json();
+        });
+    const blob = (type, field) => fragment.then(data => new Blob([data[field]], { type }));
+    const item = asSource
+        ? new ClipboardItem({ 'text/plain': blob('text/plain', 'html') })
+        : new ClipboardItem({ 'text/html': blob('text/html', 'html'), 'text/plain': blob('text/plain', 'markdown') });
+
+    navigator.clipboard.write([item])
+        .then(() => {
+            if (!button) return;
+            const label = button.textContent;
+            button.textContent = '✓';
+            setTimeout(() => { button.textContent = label; }, 1500);
+        })
+        .catch(error => {
+            console.error('[Copy] Failed:', error);
+            alert(t('Failed to copy the document'));
+        });
+}
+
+// Share the current file: mint a read-only link that expires (24 hours by
+// default) and needs no access token, then copy it
+function shareFile() {
+    const match = window.location.pathname.match(/\/view\/(.+)/);
+    if (!match) return;
+
+    fetch('/api/share', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ path: decodeURIComponent(match[1]) })
+    })
+        .then(response => {
+            if (!response.ok) {
+                return responseError(response).then(error => { throw error; });
+            }
+            return response.json();
+        })
+        .then(data => {
+            const expires = new Date(data.expires).toLocaleString();
+            const copied = navigator.clipboard ? navigator.clipboard.writeText(data.url) : Promise.reject();
+            copied
+                .then(() => alert(t('Read-only link, valid until %s (copied):', expires) + '\n' + data.url))
+                .catch(() => prompt(t('Read-only link, valid until %s:', expires), data.url));
+        })
+        .catch(error => {
+            console.error('[Share] Failed:', error);
+            alert(t('Failed to create a share link: %s', error.message));
+        });
+}
+
+// Follow mode: open the file an AI session just wrote (unless already showing it)
+function followNavigate(filePath) {
+    const url = '/view/' + filePath.split('/').map(encodeURIComponent).join('/');
+    if (decodeURIComponent(window.location.pathname) === decodeURIComponent(url)) {
+        return; // Already showing it; file_modified handles the refresh
+    }
+    // Don't discard unsaved edits
+    const editorContainer = document.getElementById('editor-container');
+    if (editorContainer && editorContainer.classList.contains('active')) {
+        console.log('[Follow] Skipping navigation while editing');
+        return;
+    }
+    navigate(url);
+}
+
+function updateFollowButton(enabled) {
+    const button = document.getElementById('follow-toggle');
+    if (!button) return;
+    button.setAttribute('aria-pressed', enabled ? 'true' : 'false');
+    button.title = enabled
+        ? 'Following AI edits (click to stop)'
+        : 'Follow AI edits: open files as AI sessions write them';
+}
+
+function toggleFollowMode() {
+    const button = document.getElementById('follow-toggle');
+    const enabled = !(button && button.getAttribute('aria-pressed') === 'true');
+
+    fetch('/api/follow', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ enabled: enabled })
+    })
+    .then(response => {
+        if (!response.ok) throw new Error('Toggle failed');
+        return response.json();
+    })
+    .then(data => updateFollowButton(data.enabled))
+    .catch(error => console.error('[Follow] Failed to toggle:', error));
+}
+
+// ===== Presence and presenter mode =====
+
+// Presenter this tab follows (per tab, so other windows can look around)
+const PRESENCE_FOLLOW_KEY = 'peekm:following';
+let presenceSelf = ''; // ID of this browser
+let presenceViewers = [];
+
+function loadPresence() {
+    fetch('/api/presence')
+        .then(response => {
+            if (!response.ok) throw new Error(`HTTP ${response.status}`);
+            return response.json();
+        })
+        .then(data => {
+            presenceSelf = data.self;
+            updatePresence(data.viewers);
+        })
+        .catch(error => console.error('[Presence] Failed to load:', error));
+}
+
+// Show who views what, and take this tab where the followed presenter went
+function updatePresence(viewers) {
+    presenceViewers = viewers || [];
+    const me = presenceViewers.find(v => v.id === presenceSelf);
+    const presentButton = document.getElementById('present-toggle');
+    if (presentButton) {
+        presentButton.setAttribute('aria-pressed', me && me.presenting ? 'true' : 'false');
+        presentButton.textContent = me && me.presenting ? t('Stop presenting') : t('Present');
+    }
+    const scrollSyncBox = document.getElementById('scroll-sync-toggle');
+    if (scrollSyncBox && me && me.presenting) {
+        scrollSyncBox.checked = me.scroll_sync;
+    }
+    presenterSyncsScroll = Boolean(me && me.scroll_sync);
+    const presenceButton = document.getElementById('presence-btn');
+    if (presenceButton) {
+        presenceButton.classList.toggle('presenting', presenceViewers.some(v => v.presenting && v.id !== presenceSelf));
+    }
+
+    const following = sessionStorage.getItem(PRESENCE_FOLLOW_KEY);
+    if (following) {
+        const presenter = presenceViewers.find(v => v.id === following);
+        if (!presenter || !presenter.presenting) {
+            sessionStorage.removeItem(PRESENCE_FOLLOW_KEY);
+            showToast(presenter ? t('%s stopped presenting', presenter.name) : t('The presenter left'), null);
+        } else if (presenter.path) {
+            followNavigate(presenter.path);
+        }
+    }
+    renderPresenceList();
+}
+
+function renderPresenceList() {
+    const listEl = document.getElementById('presence-list');
+    if (!listEl) return;
+    listEl.innerHTML = '';
+    if (presenceViewers.length === 0) {
+        listEl.innerHTML = `<div class="notification-empty">${escapeHtml(t('Nobody connected'))}</div>`;
+        return;
+    }
+
+    const following = sessionStorage.getItem(PRESENCE_FOLLOW_KEY);
+    presenceViewers.forEach(viewer => {
+        const item = document.createElement('div');
+        item.className = 'notification-item presence-item';
+
+        const name = document.createElement('div');
+        name.className = 'notification-item-message';
+        name.textContent = viewer.name + (viewer.id === presenceSelf ? ' ' + t('(you)') : '') +
+            (viewer.presenting ? ' · ' + (viewer.scroll_sync ? t('presenting with scroll sync') : t('presenting')) : '');
+        item.appendChild(name);
+
+        const meta = document.createElement('div');
+        meta.className = 'notification-item-meta';
+        if (viewer.path) {
+            const link = document.createElement('a');
+            link.href = '/view/' + viewer.path.split('/').map(encodeURIComponent).join('/');
+            link.className = 'notification-item-time';
+            link.textContent = viewer.path;
+            meta.appendChild(link);
+        }
+        if (viewer.presenting && viewer.id !== presenceSelf) {
+            const followButton = document.createElement('button');
+            followButton.className = 'presence-follow';
+            followButton.textContent = following === viewer.id ? t('Unfollow') : t('Follow');
+            followButton.addEventListener('click', () => followPresenter(viewer.id));
+            meta.appendChild(followButton);
+        }
+        item.appendChild(meta);
+        listEl.appendChild(item);
+    });
+}
+
+function followPresenter(id) {
+    if (sessionStorage.getItem(PRESENCE_FOLLOW_KEY) === id) {
+        sessionStorage.removeItem(PRESENCE_FOLLOW_KEY);
+    } else {
+        sessionStorage.setItem(PRESENCE_FOLLOW_KEY, id);
+    }
+    updatePresence(presenceViewers);
+}
+
+function postPresence(update) {
+    fetch('/api/presence', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(update)
+    })
+        .then(response => {
+            if (!response.ok) {
+                return responseError(response).then(error => { throw error; });
+            }
+            return response.json();
+        })
+        .then(data => {
+            presenceSelf = data.self;
+            updatePresence(data.viewers);
+        })
+        .catch(error => alert(t('Failed to update presence: %s', error.message)));
+}
+
+// Presenter mode: everyone following this browser goes where it navigates
+function togglePresenting() {
+    const me = presenceViewers.find(v => v.id === presenceSelf);
+    postPresence({ presenting: !(me && me.presenting) });
+}
+
+// Opt-in scroll sync: followers' viewports track the presenter's scrolling
+function toggleScrollSync(enabled) {
+    postPresence({ scroll_sync: enabled });
+}
+
+// ===== Presenter scroll sync =====
+
+let presenterSyncsScroll = false; // This browser presents with scroll sync on
+let presenterScrollTimer = null;
+let lastSentScroll = '';
+let lastPresenterScroll = null; // Latest position of the followed presenter
+
+// The element documents scroll in: the content pane, which is replaced on
+// every navigation (or the page, where the pane does not scroll)
+function contentScroller() {
+    const content = document.getElementById('content');
+    if (content && getComputedStyle(content).overflowY !== 'visible') return content;
+    return document.scrollingElement;
+}
+
+// Headings that scroll positions are measured from
+function scrollSyncHeadings() {
+    return Array.from(document.querySelectorAll('#content h1[id], #content h2[id], #content h3[id], #content h4[id], #content h5[id], #content h6[id]'));
+}
+
+// Where el is in the scroller's content, in pixels from its top
+function scrollOffsetOf(scroller, el) {
+    const base = scroller === document.scrollingElement ? 0 : scroller.getBoundingClientRect().top;
+    return el.getBoundingClientRect().top - base + scroller.scrollTop;
+}
+
+// The section around the heading at index i: from it (or the top) to the
+// next heading (or the end of the page)
+function scrollSyncSection(scroller, headings, i) {
+    const start = i >= 0 ? scrollOffsetOf(scroller, headings[i]) : 0;
+    const end = i + 1 < headings.length
+        ? scrollOffsetOf(scroller, headings[i + 1])
+        : scroller.scrollHeight - scroller.clientHeight;
+    return { start, end };
+}
+
+// Where the viewport is: the last heading above its top and how far into
+// that heading's section, so other window sizes land on the same text
+function readScrollPosition() {
+    const scroller = contentScroller();
+    const headings = scrollSyncHeadings();
+    const y = scroller.scrollTop;
+    let i = -1;
+    headings.forEach((h, j) => {
+        if (scrollOffsetOf(scroller, h) <= y + 1) i = j;
+    });
+    const { start, end } = scrollSyncSection(scroller, headings, i);
+    const offset = end > start ? (y - start) / (end - start) : 0;
+    return { heading: i >= 0 ? headings[i].id : '', offset: Math.max(0, Math.min(1, offset)) };
+}
+
+function applyScrollPosition(heading, offset) {
+    const scroller = contentScroller();
+    const headings = scrollSyncHeadings();
+    const i = heading ? headings.findIndex(h => h.id === heading) : -1;
+    if (heading && i < 0) return; // Heading not rendered here (yet)
+    const { start, end } = scrollSyncSection(scroller, headings, i);
+    scroller.scrollTo(0, start + Math.max(0, end - start) * offset);
+}
+
+function currentViewPath() {
+    const match = window.location.pathname.match(/\/view\/(.+)/);
+    return match ? decodeURIComponent(match[1]) : '';
+}
+
+// Presenter side: send the position after scrolling settles a little
+function schedulePresenterScroll() {
+    if (!presenterSyncsScroll || presenterScrollTimer) return;
+    presenterScrollTimer = setTimeout(() => {
+        presenterScrollTimer = null;
+        const path = currentViewPath();
+        if (!path || !presenterSyncsScroll) return;
+        const position = Object.assign({ path: path }, readScrollPosition());
+        const body = JSON.stringify(position);
+        if (body === lastSentScroll) return;
+        lastSentScroll = body;
+        fetch('/api/presence/scroll', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: body
+        }).catch(error => console.error('[Presence] Failed to send scroll position:', error));
+    }, 150);
+}
+
+// Follower side: track the followed presenter's viewport on the same file
+function followPresenterScroll(data) {
+    if (data.id !== sessionStorage.getItem(PRESENCE_FOLLOW_KEY)) return;
+    lastPresenterScroll = data;
+    if (data.path === currentViewPath()) {
+        applyScrollPosition(data.heading, data.offset);
+    }
+}
+
+// After navigating: catch up with a presenter who scrolled while the file loaded
+function applyPendingPresenterScroll() {
+    const data = lastPresenterScroll;
+    if (data && data.id === sessionStorage.getItem(PRESENCE_FOLLOW_KEY) && data.path === currentViewPath()) {
+        applyScrollPosition(data.heading, data.offset);
+    }
+}
+
+// Scroll events do not bubble; capture them from the content pane, which
+// is replaced on every navigation
+document.addEventListener('scroll', event => {
+    if (event.target === document || event.target === contentScroller()) schedulePresenterScroll();
+}, { capture: true, passive: true });
+
+function renamePresence() {
+    const me = presenceViewers.find(v => v.id === presenceSelf);
+    const name = prompt(t('Name shown to other viewers (empty for your browser\'s):'), me ? me.name : '');
+    if (name !== null) {
+        postPresence({ name: name });
+    }
+}
+
+function togglePresenceDropdown() {
+    const dropdown = document.getElementById('presence-dropdown');
+    if (!dropdown) return;
+    if (dropdown.style.display !== 'none') {
+        closePresenceDropdown();
+        return;
+    }
+    renderPresenceList();
+    dropdown.style.display = 'flex';
+    setTimeout(() => {
+        document.addEventListener('click', closePresenceDropdown);
+    }, 0);
+}
+
+function closePresenceDropdown(event) {
+    const dropdown = document.getElementById('presence-dropdown');
+    if (!dropdown || (event && dropdown.contains(event.target))) return;
+    dropdown.style.display = 'none';
+    document.removeEventListener('click', closePresenceDropdown);
+}
+
+// ===== Review comments =====
+
+// Comments are notes kept beside the file, never in it. They anchor to the
+// section heading clicked on (or line 1 above the first heading).
+let commentPicking = false;
+
+function startComment() {
+    const content = document.getElementById('content');
+    if (!content || content.dataset.view !== 'file' || commentPicking) return;
+    commentPicking = true;
+    content.classList.add('comment-picking');
+    setTimeout(() => {
+        content.addEventListener('click', pickCommentAnchor, { capture: true, once: true });
+    }, 0);
+}
+
+function pickCommentAnchor(event) {
+    event.preventDefault();
+    event.stopPropagation();
+    commentPicking = false;
+    document.getElementById('content').classList.remove('comment-picking');
+
+    // The last heading at or before what was clicked
+    let heading = '';
+    for (const h of scrollSyncHeadings()) {
+        if (h === event.target || h.contains(event.target) ||
+            (h.compareDocumentPosition(event.target) & Node.DOCUMENT_POSITION_FOLLOWING)) {
+            heading = h.id;
+        }
+    }
+    const text = prompt(heading ? t('Comment on #%s:', heading) : t('Comment on the top of the document:'));
+    if (!text || !text.trim()) return;
+
+    const me = presenceViewers.find(v => v.id === presenceSelf);
+    sendComment('POST', {
+        path: currentViewPath(),
+        heading: heading,
+        line: heading ? 0 : 1,
+        text: text,
+        author: me ? me.name : ''
+    });
+}
+
+function editComment(comment) {
+    const text = prompt(t('Edit comment:'), comment.text);
+    if (text === null || !text.trim()) return;
+    sendComment('PUT', { path: currentViewPath(), id: comment.id, text: text });
+}
+
+function deleteComment(comment) {
+    if (!confirm(t('Delete this comment?'))) return;
+    const query = new URLSearchParams({ path: currentViewPath(), id: comment.id });
+    fetch('/api/comments?' + query, { method: 'DELETE' })
+        .then(response => {
+            if (!response.ok) throw new Error(`HTTP ${response.status}`);
+            loadComments();
+        })
+        .catch(error => alert(t('Failed to delete the comment: %s', error.message)));
+}
+
+function sendComment(method, body) {
+    fetch('/api/comments', {
+        method: method,
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(body)
+    })
+        .then(response => {
+            if (!response.ok) {
+                return responseError(response).then(error => { throw error; });
+            }
+            loadComments();
+        })
+        .catch(error => {
+            console.error('[Comments] Failed:', error);
+            alert(t('Failed to save the comment: %s', error.message));
+        });
+}
+
+// Fetch the current file's comments and show them as margin notes
+function loadComments() {
+    const path = currentViewPath();
+    if (!path) return;
+    fetch('/api/comments?' + new URLSearchParams({ path: path }))
+        .then(response => {
+            if (!response.ok) throw new Error(`HTTP ${response.status}`);
+            return response.json();
+        })
+        .then(data => {
+            if (data.path === currentViewPath()) renderComments(data.comments);
+        })
+        .catch(error => console.error('[Comments] Failed to load:', error));
+}
+
+function renderComments(comments) {
+    const content = document.getElementById('content');
+    if (!content) return;
+    content.querySelectorAll('.margin-note').forEach(note => note.remove());
+
+    const subtitle = content.querySelector('.subtitle');
+    for (const comment of comments) {
+        const id = comment.heading || comment.section;
+        const anchor = (id && content.querySelector(`[id="${CSS.escape(id)}"]`)) || subtitle;
+        if (!anchor) continue;
+
+        const note = document.createElement('aside');
+        note.className = 'margin-note';
+        const meta = document.createElement('div');
+        meta.className = 'margin-note-meta';
+        const author = document.createElement('strong');
+        author.textContent = comment.author || t('Anonymous');
+        const when = document.createElement('span');
+        when.textContent = new Date(comment.updated || comment.created).toLocaleString();
+        const edit = document.createElement('button');
+        edit.textContent = t('Edit');
+        edit.onclick = () => editComment(comment);
+        const remove = document.createElement('button');
+        remove.textContent = t('Delete');
+        remove.onclick = () => deleteComment(comment);
+        meta.append(author, when, edit, remove);
+        note.append(meta, document.createTextNode(comment.text));
+        anchor.after(note);
+    }
+}
+
+// ===== CriticMarkup =====
+
+// Whether documents show CriticMarkup changes accepted (kept across files)
+const CRITIC_VIEW_KEY = 'peekm:critic-accepted';
+
+// Offer the accepted view on documents with CriticMarkup, in the last view picked
+function initializeCriticView() {
+    const content = document.getElementById('content');
+    const button = document.getElementById('critic-toggle');
+    if (!content || !button) return;
+    button.hidden = !content.querySelector('.critic');
+    setCriticView(localStorage.getItem(CRITIC_VIEW_KEY) === 'true');
+}
+
+function setCriticView(accepted) {
+    const content = document.getElementById('content');
+    const button = document.getElementById('critic-toggle');
+    if (content) content.classList.toggle('critic-accepted', accepted);
+    if (button) {
+        button.setAttribute('aria-pressed', accepted ? 'true' : 'false');
+        button.title = accepted
+            ? 'Showing the text with every change accepted (click for the markup)'
+            : 'Show the text with every CriticMarkup change accepted';
+    }
+}
+
+function toggleCriticView() {
+    const accepted = localStorage.getItem(CRITIC_VIEW_KEY) !== 'true';
+    localStorage.setItem(CRITIC_VIEW_KEY, accepted ? 'true' : 'false');
+    setCriticView(accepted);
+}
+
+// ===== Reading position =====
+
+// Where each document shown by this page was last read, so live reloads
+// (which replace the content pane) keep the reader's place
+const readingPositions = {};
+let readingPositionTimer = null;
+let readingPositionPath = '';
+let lastSentReadingPosition = '';
+
+// How far into the document the viewport is, 0 to 1
+function readingProgress() {
+    const scroller = contentScroller();
+    const end = scroller.scrollHeight - scroller.clientHeight;
+    return end > 0 ? Math.max(0, Math.min(1, scroller.scrollTop / end)) : 0;
+}
+
+function updateReadingProgress() {
+    const bar = document.getElementById('reading-progress');
+    if (!bar) return;
+    bar.style.width = currentViewPath() ? (readingProgress() * 100) + '%' : '0';
+}
+
+// Save the position once scrolling has stopped for a second
+function scheduleReadingPosition() {
+    updateReadingProgress();
+    readingPositionPath = currentViewPath();
+    if (!readingPositionPath) return;
+    clearTimeout(readingPositionTimer);
+    readingPositionTimer = setTimeout(saveReadingPosition, 1000);
+}
+
+function saveReadingPosition() {
+    clearTimeout(readingPositionTimer);
+    readingPositionTimer = null;
+    const path = readingPositionPath;
+    if (!path || path !== currentViewPath()) return; // Moved on meanwhile
+    const position = Object.assign({ path: path, progress: readingProgress() }, readScrollPosition());
+    readingPositions[path] = position;
+    const body = JSON.stringify(position);
+    if (body === lastSentReadingPosition) return;
+    lastSentReadingPosition = body;
+    fetch('/api/position', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: body
+    }).catch(error => console.error('[Position] Failed to save reading position:', error));
+}
+
+// Before the content pane is replaced: save a position still waiting for
+// scrolling to settle
+function flushReadingPosition() {
+    if (readingPositionTimer) saveReadingPosition();
+}
+
+// Resume where the document was last read: after a live reload from this
+// page's memory, otherwise from the server unless a #anchor says where to
+// go. Following a presenter takes precedence over both.
+function restoreReadingPosition() {
+    const path = currentViewPath();
+    if (!path || sessionStorage.getItem(PRESENCE_FOLLOW_KEY)) return;
+    const known = readingPositions[path];
+    if (known) {
+        applyScrollPosition(known.heading, known.offset);
+        return;
+    }
+    if (window.location.hash) return;
+    fetch('/api/position?path=' + encodeURIComponent(path))
+        .then(response => response.ok ? response.json() : null)
+        .then(position => {
+            // Not if the reader started scrolling or opened another file meanwhile
+            if (!position || path !== currentViewPath() || contentScroller().scrollTop > 0) return;
+            readingPositions[path] = position;
+            applyScrollPosition(position.heading, position.offset);
+        })
+        .catch(error => console.error('[Position] Failed to load reading position:', error));
+}
+
+document.addEventListener('scroll', event => {
+    if (event.target === document || event.target === contentScroller()) scheduleReadingPosition();
+}, { capture: true, passive: true });
+
+// ===== Bookmarks =====
+
+// Bookmark the section at the top of the view (the file itself above the
+// first heading), labelled with its heading unless renamed here
+function bookmarkSection() {
+    const path = currentViewPath();
+    if (!path) return;
+    const anchor = readScrollPosition().heading;
+    const heading = anchor ? document.getElementById(anchor) : null;
+    const suggested = heading ? heading.textContent.trim() : path.split('/').pop();
+    const label = prompt(t('Bookmark label:'), suggested);
+    if (label === null) return;
+    sendBookmark('POST', { path: path, anchor: anchor, label: label });
+}
+
+// Rename or delete the bookmark whose sidebar button was clicked
+function renameBookmark(button) {
+    const item = button.closest('.tree-bookmark');
+    const label = prompt(t('Bookmark label:'), item.querySelector('a').textContent);
+    if (label === null || !label.trim()) return;
+    sendBookmark('PUT', { id: item.dataset.id, label: label });
+}
+
+function deleteBookmark(button) {
+    const item = button.closest('.tree-bookmark');
+    sendBookmark('DELETE', null, '?' + new URLSearchParams({ id: item.dataset.id }));
+}
+
+// Change a bookmark, then refresh the tree it is listed in
+function sendBookmark(method, body, query = '') {
+    fetch('/api/bookmarks' + query, {
+        method: method,
+        headers: { 'Content-Type': 'application/json' },
+        body: body ? JSON.stringify(body) : undefined
+    })
+        .then(response => {
+            if (!response.ok) {
+                return responseError(response).then(error => { throw error; });
+            }
+            scheduleTreeRefresh();
+        })
+        .catch(error => {
+            console.error('[Bookmarks] Failed:', error);
+            alert(t('Failed to save the bookmark: %s', error.message));
+        });
+}
+
+// ===== Drag-and-drop import =====
+
+function setupDropImport() {
+    let dragDepth = 0;
+    const hasFiles = e => e.dataTransfer && Array.from(e.dataTransfer.types).includes('Files');
+
+    document.addEventListener('dragenter', function(e) {
+        if (!hasFiles(e)) return;
+        dragDepth++;
+        document.body.classList.add('drop-active');
+    });
+    document.addEventListener('dragleave', function(e) {
+        if (!hasFiles(e)) return;
+        dragDepth = Math.max(0, dragDepth - 1);
+        if (dragDepth === 0) document.body.classList.remove('drop-active');
+    });
+    document.addEventListener('dragover', function(e) {
+        if (hasFiles(e)) e.preventDefault();
+    });
+    document.addEventListener('drop', function(e) {
+        if (!hasFiles(e)) return;
+        e.preventDefault();
+        dragDepth = 0;
+        document.body.classList.remove('drop-active');
+        importFiles(e.dataTransfer.files);
+    });
+}
+
+// Upload files to /import, next to the file being viewed (or the browse root)
+function importFiles(files) {
+    if (!files || files.length === 0) return;
+
+    const match = window.location.pathname.match(/\/view\/(.+)/);
+    const currentFile = match ? decodeURIComponent(match[1]) : '';
+    const dir = currentFile.includes('/') ? currentFile.slice(0, currentFile.lastIndexOf('/')) : '';
+
+    const form = new FormData();
+    form.append('dir', dir);
+    Array.from(files).forEach(file => form.append('files', file));
+
+    fetch('/import', { method: 'POST', body: form })
+        .then(response => response.json().catch(() => {
+            throw new Error(`Import failed (${response.status})`);
+        }))
+        .then(result => {
+            (result.skipped || []).forEach(s => showToast(t('Not imported: %s (%s)', s.name, s.error), null));
+            if (result.imported && result.imported.length > 0) {
+                scheduleTreeRefresh();
+                const firstDoc = result.imported.find(p => p.toLowerCase().endsWith('.md'));
+                if (firstDoc) {
+                    navigate('/view/' + firstDoc.split('/').map(encodeURIComponent).join('/'));
+                }
+            }
+        })
+        .catch(error => alert(t('Failed to import files: %s', error.message)));
+}
+
+// Create a folder (relative to the current file's directory) via /mkdir
+function createFolder() {
+    const match = window.location.pathname.match(/\/view\/(.+)/);
+    const currentFile = match ? decodeURIComponent(match[1]) : '';
+    const baseDir = currentFile.includes('/') ? currentFile.slice(0, currentFile.lastIndexOf('/') + 1) : '';
+
+    const name = prompt(t('New folder:'), baseDir);
+    if (!name || name === baseDir) return;
+
+    fetch('/mkdir', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ path: name })
+    })
+    .then(response => {
+        if (!response.ok) {
+            return responseError(response, 'Create failed').then(error => { throw error; });
+        }
+        return response.json();
+    })
+    .then(data => insertSubtree(data.parent, data.html))
+    .catch(error => {
+        alert(t('Failed to create folder: %s', error.message));
+    });
+}
+
+// Replace a directory's children in the sidebar with server-rendered HTML and expand it
+function insertSubtree(parentPath, html) {
+    const fileTree = document.querySelector('.sidebar-tree');
+    if (!fileTree) {
+        refreshTree();
+        return;
+    }
+    if (parentPath === '.') {
+        fileTree.innerHTML = html;
+        restoreTreeState();
+        updateTreeMeta();
+        return;
+    }
+
+    const dirElement = Array.from(fileTree.querySelectorAll('.tree-directory'))
+        .find(el => el.dataset.path.replace(/\\/g, '/') === parentPath);
+    if (!dirElement) {
+        refreshTree();
+        return;
+    }
+
+    const treeItem = dirElement.closest('.tree-item');
+    let children = treeItem.querySelector(':scope > .tree-children');
+    if (!children) {
+        children = document.createElement('div');
+        children.className = 'tree-children';
+        treeItem.appendChild(children);
+    }
+    children.innerHTML = html;
+    children.style.display = 'block';
+    const icon = dirElement.querySelector('.expand-icon');
+    if (icon) icon.textContent = '▼';
+    dirElement.dataset.collapsed = 'false';
+    saveTreeState();
+}
+
+// Create a missing wiki page via /create and open it
+function createWikiPage(target) {
+    if (!target || !confirm(t('"%s" doesn\'t exist yet.\n\nCreate it now?', target))) {
+        return;
+    }
+
+    fetch('/create', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ path: target })
+    })
+    .then(response => {
+        if (!response.ok) {
+            return responseError(response, 'Create failed').then(error => { throw error; });
+        }
+        return response.json();
+    })
+    .then(data => {
+        scheduleTreeRefresh();
+        navigate('/view/' + data.path.split('/').map(encodeURIComponent).join('/'));
+    })
+    .catch(error => {
+        alert(t('Failed to create page: %s', error.message));
     });
 }
 
@@ -971,11 +2116,42 @@ function saveTreeState() {
 
         localStorage.setItem(storageKey, JSON.stringify(state));
         console.log('[TreeState] Saved state for', storageKey, ':', state);
+        if (!treeFilterQuery) {
+            // A filtered tree shows only some directories
+            scheduleTreeStateSync(expandedDirs);
+        }
     } catch (error) {
         console.error('[TreeState] Failed to save:', error);
     }
 }
 
+// Expanded directories last sent to the server, and the pending send
+let syncedTreeState = null;
+let treeStateSyncTimer = null;
+
+// Send the expanded directories to the server (batched), which renders the
+// tree with them on the next page load or refresh
+function scheduleTreeStateSync(expandedDirs) {
+    clearTimeout(treeStateSyncTimer);
+    treeStateSyncTimer = setTimeout(async () => {
+        const body = JSON.stringify({ expanded: expandedDirs });
+        if (body === syncedTreeState) return;
+        try {
+            const response = await fetch('/api/tree-state', {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body
+            });
+            if (!response.ok) {
+                throw new Error(`HTTP ${response.status}`);
+            }
+            syncedTreeState = body;
+        } catch (error) {
+            console.error('[TreeState] Failed to sync:', error);
+        }
+    }, 500);
+}
+
 // Restore tree expansion state and scroll position from localStorage
 function restoreTreeState() {
     try {
@@ -1083,6 +2259,19 @@ function getNotificationHistory() {
     }
 }
 
+// Point the notifications about a renamed file at its new path
+function renameNotificationPath(oldPath, newPath) {
+    try {
+        const notifications = getNotificationHistory();
+        notifications.forEach(n => {
+            if (n.filePath === oldPath) n.filePath = newPath;
+        });
+        sessionStorage.setItem(NOTIFICATION_STORAGE_KEY, JSON.stringify(notifications));
+    } catch (error) {
+        console.error('[Notification] Failed to rename:', error);
+    }
+}
+
 // Close notification dropdown
 function closeNotificationDropdown() {
     const dropdown = document.getElementById('notification-dropdown');
@@ -1147,6 +2336,20 @@ function saveSessionMetadata(filePath, sessionData) {
     }
 }
 
+// Move the stored session metadata of a renamed file to its new path
+function renameSessionMetadataPath(oldPath, newPath) {
+    try {
+        const storageKey = getSessionStorageKey();
+        const sessions = getSessionsFromStorage(storageKey).filter(s => s.filePath !== newPath);
+        const entry = sessions.find(s => s.filePath === oldPath);
+        if (!entry) return;
+        entry.filePath = newPath;
+        localStorage.setItem(storageKey, JSON.stringify(sessions));
+    } catch (error) {
+        console.error('[Session] Failed to rename metadata:', error);
+    }
+}
+
 // Get session metadata for a file path
 function getSessionMetadata(filePath) {
     try {
@@ -1245,7 +2448,7 @@ function renderNotificationList() {
     const notifications = getNotificationHistory();
 
     if (notifications.length === 0) {
-        listEl.innerHTML = '<div class="notification-empty">No recent notifications</div>';
+        listEl.innerHTML = `<div class="notification-empty">${escapeHtml(t('No recent notifications'))}</div>`;
         return;
     }
 
@@ -1329,21 +2532,21 @@ function getTimeAgo(timestamp) {
     const seconds = Math.floor((Date.now() - timestamp) / 1000);
 
     if (seconds < 60) {
-        return 'just now';
+        return t('just now');
     }
 
     const minutes = Math.floor(seconds / 60);
     if (minutes < 60) {
-        return `${minutes} min ago`;
+        return t('%d min ago', minutes);
     }
 
     const hours = Math.floor(minutes / 60);
     if (hours < 24) {
-        return `${hours} hour${hours > 1 ? 's' : ''} ago`;
+        return hours > 1 ? t('%d hours ago', hours) : t('1 hour ago');
     }
 
     const days = Math.floor(hours / 24);
-    return `${days} day${days > 1 ? 's' : ''} ago`;
+    return days > 1 ? t('%d days ago', days) : t('1 day ago');
 }
 
 // Close dropdown when clicking outside
@@ -1359,10 +2562,83 @@ document.addEventListener('click', function(e) {
     }
 });
 
+// ===== Tabs: files open in this browser, tracked by the server per client =====
+
+// Fetch and render the open tabs
+async function refreshTabs() {
+    const bar = document.getElementById('tab-bar');
+    if (!bar) return;
+
+    try {
+        const response = await fetch('/api/tabs');
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        renderTabs(bar, await response.json());
+    } catch (error) {
+        console.error('[Tabs] Failed to load:', error);
+    }
+}
+
+// Render the tab strip from an /api/tabs response
+function renderTabs(bar, data) {
+    bar.innerHTML = '';
+    data.tabs.forEach(tab => {
+        const item = document.createElement('div');
+        item.className = tab.path === data.active ? 'tab active' : 'tab';
+
+        const link = document.createElement('a');
+        link.href = '/view/' + tab.path.split('/').map(encodeURIComponent).join('/');
+        link.textContent = tab.title;
+        link.title = tab.path;
+
+        const close = document.createElement('button');
+        close.className = 'tab-close';
+        close.textContent = '×';
+        close.title = t('Close tab');
+        close.setAttribute('aria-label', t('Close %s', tab.title));
+        close.addEventListener('click', function(e) {
+            e.preventDefault();
+            closeTab(tab.path);
+        });
+
+        item.append(link, close);
+        bar.appendChild(item);
+    });
+    bar.hidden = data.tabs.length === 0;
+}
+
+// Close a tab; closing the file on screen shows the next tab (or the browser)
+async function closeTab(path) {
+    try {
+        const response = await fetch('/api/tabs?path=' + encodeURIComponent(path), { method: 'DELETE' });
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        const data = await response.json();
+
+        const currentPath = decodeURIComponent(window.location.pathname.replace('/view/', ''));
+        if (currentPath === path) {
+            navigate(data.active ? '/view/' + data.active.split('/').map(encodeURIComponent).join('/') : '/');
+            return;
+        }
+        const bar = document.getElementById('tab-bar');
+        if (bar) renderTabs(bar, data);
+    } catch (error) {
+        console.error('[Tabs] Failed to close:', error);
+    }
+}
+
 // ===== Focus Mode: Toggleable Sidebar Functions =====
 
 const SIDEBAR_STORAGE_KEY = 'peekm_sidebar_state';
 
+// Mobile layout (served to phones): the sidebar is a drawer that starts closed
+// and closes again after each navigation, so its state is not saved
+function isMobileLayout() {
+    return document.body.classList.contains('mobile-layout');
+}
+
 // Toggle sidebar visibility
 function toggleSidebar() {
     const container = document.querySelector('.layout-container');
@@ -1377,15 +2653,17 @@ function toggleSidebar() {
     const toggleBtn = document.getElementById('sidebar-toggle');
     if (toggleBtn) {
         toggleBtn.title = newState === 'expanded'
-            ? 'Hide navigation (Cmd/Ctrl+B)'
-            : 'Show navigation (Cmd/Ctrl+B)';
+            ? t('Hide navigation (Cmd/Ctrl+B)')
+            : t('Show navigation (Cmd/Ctrl+B)');
         toggleBtn.setAttribute('aria-label',
             newState === 'expanded'
-                ? 'Hide navigation sidebar'
-                : 'Show navigation sidebar'
+                ? t('Hide navigation sidebar')
+                : t('Show navigation sidebar')
         );
     }
 
+    if (isMobileLayout()) return;
+
     // Save preference to localStorage
     try {
         localStorage.setItem(SIDEBAR_STORAGE_KEY, newState);
@@ -1412,19 +2690,23 @@ function initializeSidebar() {
         const container = document.querySelector('.layout-container');
         if (!container) return;
 
-        try {
-            const savedState = localStorage.getItem(SIDEBAR_STORAGE_KEY);
-            if (savedState === 'collapsed') {
-                // User explicitly hid it before, respect that
-                container.dataset.sidebar = 'collapsed';
-            } else {
-                // Default: show sidebar (visible by default)
+        if (isMobileLayout()) {
+            container.dataset.sidebar = 'collapsed';
+        } else {
+            try {
+                const savedState = localStorage.getItem(SIDEBAR_STORAGE_KEY);
+                if (savedState === 'collapsed') {
+                    // User explicitly hid it before, respect that
+                    container.dataset.sidebar = 'collapsed';
+                } else {
+                    // Default: show sidebar (visible by default)
+                    container.dataset.sidebar = 'expanded';
+                }
+            } catch (error) {
+                console.error('[Sidebar] Failed to load state:', error);
+                // Fallback: show sidebar
                 container.dataset.sidebar = 'expanded';
             }
-        } catch (error) {
-            console.error('[Sidebar] Failed to load state:', error);
-            // Fallback: show sidebar
-            container.dataset.sidebar = 'expanded';
         }
 
         // Update breadcrumb (only for file view)
@@ -1436,6 +2718,14 @@ function initializeSidebar() {
     }
 }
 
+// Mobile layout: tapping the backdrop beside the open drawer closes it
+document.addEventListener('click', function(e) {
+    const container = document.querySelector('.layout-container');
+    if (isMobileLayout() && e.target === container && container.dataset.sidebar === 'expanded') {
+        toggleSidebar();
+    }
+});
+
 // Update hamburger button visibility
 function updateSidebarToggleButton() {
     const toggleBtn = document.getElementById('sidebar-toggle');
@@ -1457,47 +2747,113 @@ function updateSidebarToggleButton() {
 // Tree is now rendered directly in sidebar by server template
 // and persists during SPA navigation
 
-// Generate and update breadcrumb trail
+// Generate and update breadcrumb trail from the path components the server
+// embeds in #breadcrumb-data
 function updateBreadcrumb() {
     const breadcrumb = document.getElementById('breadcrumb');
     const content = document.getElementById('content');
 
     if (!breadcrumb || !content) return;
 
-    const browsePath = content.dataset.path || '';
-    const viewType = content.dataset.view;
+    const dataEl = content.querySelector('#breadcrumb-data');
+    if (content.dataset.view !== 'file' || !dataEl) {
+        breadcrumb.innerHTML = '';
+        return;
+    }
 
-    if (viewType !== 'file' || !browsePath) {
+    let trail;
+    try {
+        trail = JSON.parse(dataEl.textContent);
+    } catch (error) {
+        console.error('[Sidebar] Invalid breadcrumb data:', error);
         breadcrumb.innerHTML = '';
         return;
     }
 
-    // Parse path and generate breadcrumb
-    const homeDir = browsePath.split('/').slice(0, 3).join('/'); // /Users/username
-    let relativePath = browsePath.replace(homeDir, '~');
+    // Directories above the browsed one browse them; the browsed one shows its default file
+    breadcrumb.replaceChildren();
+    const dirs = trail.dir || [];
+    const crumbs = dirs.concat(trail.file || []);
+    crumbs.forEach((crumb, i) => {
+        if (i > 0) breadcrumb.append(' / ');
+        let el;
+        if (i === dirs.length - 1) {
+            el = document.createElement('a');
+            el.href = '/';
+        } else if (i < dirs.length - 1 && crumb.navigate) {
+            el = document.createElement('a');
+            el.href = '#';
+            el.title = crumb.path;
+            el.addEventListener('click', e => {
+                e.preventDefault();
+                if (typeof navigateToDirectory === 'function') {
+                    navigateToDirectory(crumb.path);
+                }
+            });
+        } else {
+            el = document.createElement('span');
+        }
+        el.textContent = crumb.name;
+        breadcrumb.append(el);
+    });
 
-    // Split into segments
-    const segments = relativePath.split('/').filter(s => s.length > 0);
+    console.log('[Sidebar] Breadcrumb updated');
+}
 
-    let breadcrumbHTML = '<a href="/">~</a>';
-    let currentPath = homeDir;
+// File details column: age, word count and size from the tree's data attributes
+const TREE_META_KEY = 'peekm-tree-meta';
+const TREE_FRESH_MS = 10 * 60 * 1000; // Files modified this recently are highlighted
 
-    for (let i = 1; i < segments.length - 1; i++) {
-        const segment = segments[i];
-        currentPath += '/' + segment;
-        breadcrumbHTML += ` / <span>${escapeHtml(segment)}</span>`;
-    }
+// Show or hide the details column (remembered across sessions)
+function toggleTreeMeta() {
+    localStorage.setItem(TREE_META_KEY, localStorage.getItem(TREE_META_KEY) === '1' ? '0' : '1');
+    updateTreeMeta();
+}
 
-    // Add current file (not clickable)
-    if (segments.length > 0) {
-        const fileName = segments[segments.length - 1];
-        breadcrumbHTML += ` / <span>${escapeHtml(fileName)}</span>`;
+// Compact age for the details column: 45s, 12m, 3h, 5d, 2mo, 1y
+function formatTreeAge(ms) {
+    const sec = Math.max(0, Math.floor(ms / 1000));
+    const units = [[365 * 86400, 'y'], [30 * 86400, 'mo'], [86400, 'd'], [3600, 'h'], [60, 'm']];
+    for (const [size, unit] of units) {
+        if (sec >= size) return Math.floor(sec / size) + unit;
     }
+    return sec + 's';
+}
 
-    breadcrumb.innerHTML = breadcrumbHTML;
+// Compact size for the details column: 812 B, 4.2 KB, 1.3 MB
+function formatTreeSize(bytes) {
+    if (bytes < 1024) return bytes + ' B';
+    if (bytes < 1024 * 1024) return (bytes / 1024).toFixed(1) + ' KB';
+    return (bytes / (1024 * 1024)).toFixed(1) + ' MB';
+}
 
-    console.log('[Sidebar] Breadcrumb updated');
+// Fill the details column and mark recently modified files (called whenever
+// the tree is replaced, and every minute to keep the ages current)
+function updateTreeMeta() {
+    const sidebar = document.querySelector('.sidebar-content');
+    if (!sidebar) return;
+
+    const show = localStorage.getItem(TREE_META_KEY) === '1';
+    sidebar.classList.toggle('show-tree-meta', show);
+    const button = document.getElementById('tree-meta-button');
+    if (button) button.setAttribute('aria-pressed', show ? 'true' : 'false');
+
+    const now = Date.now();
+    sidebar.querySelectorAll('.tree-file').forEach(file => {
+        const mtime = file.dataset.mtime ? Date.parse(file.dataset.mtime) : NaN;
+        file.toggleAttribute('data-fresh', !isNaN(mtime) && now - mtime < TREE_FRESH_MS);
+
+        const meta = file.querySelector('.tree-meta');
+        if (!meta) return;
+        const parts = [];
+        if (!isNaN(mtime)) parts.push(formatTreeAge(now - mtime));
+        if (file.dataset.words) parts.push(file.dataset.words + ' w');
+        if (file.dataset.size) parts.push(formatTreeSize(Number(file.dataset.size)));
+        meta.textContent = parts.join(' · ');
+        meta.title = isNaN(mtime) ? '' : 'Modified ' + new Date(mtime).toLocaleString();
+    });
 }
+setInterval(updateTreeMeta, 60 * 1000);
 
 // Highlight current file in sidebar tree
 function highlightCurrentFile() {
@@ -1620,7 +2976,6 @@ function fuzzyMatchScore(str, query) {
 // Search files and show dropdown
 function searchFiles(query) {
     const dropdown = document.getElementById('search-dropdown');
-    const resultsContainer = document.getElementById('search-results');
     const clearBtn = document.getElementById('search-clear');
 
     // Show/hide clear button
@@ -1628,6 +2983,7 @@ function searchFiles(query) {
         clearBtn.style.display = query.length > 0 ? 'flex' : 'none';
     }
 
+    cancelContentSearch();
     if (!query || query.trim() === '') {
         // No search - hide dropdown
         if (dropdown) dropdown.style.display = 'none';
@@ -1648,34 +3004,78 @@ function searchFiles(query) {
         .filter(file => file.score > 0)
         .sort((a, b) => b.score - a.score); // Sort by score descending
 
-    searchResults = scoredFiles;
+    showSearchResults(scoredFiles, []);
+    console.log(`[Search] Found ${scoredFiles.length} matches for "${query}"`);
 
-    // Show dropdown with results
-    if (dropdown && resultsContainer) {
-        if (searchResults.length === 0) {
-            resultsContainer.innerHTML = '<div class="search-no-results">No files found</div>';
-            dropdown.style.display = 'block';
-        } else {
-            resultsContainer.innerHTML = searchResults.map((file, index) =>
-                `<div class="search-result-item" data-index="${index}">
-                    <div class="search-result-name">${escapeHtml(file.name)}</div>
-                    <div class="search-result-path">${escapeHtml(file.path)}</div>
-                </div>`
-            ).join('');
-            dropdown.style.display = 'block';
-            selectedIndex = -1;
-
-            // Add click handlers to results
-            const items = resultsContainer.querySelectorAll('.search-result-item');
-            items.forEach((item, index) => {
-                item.addEventListener('click', () => {
-                    navigateToFile(searchResults[index].url);
-                });
-            });
-        }
+    // File contents come from the server's full-text index
+    if (searchQuery.length >= 2) {
+        const seq = contentSearchSeq;
+        contentSearchTimer = setTimeout(() => searchContents(searchQuery, scoredFiles, seq), 200);
     }
+}
+
+// Timer and sequence number of the pending content search; a response for an
+// older sequence number is dropped
+let contentSearchTimer = null;
+let contentSearchSeq = 0;
+
+// cancelContentSearch drops a pending or in-flight content search
+function cancelContentSearch() {
+    clearTimeout(contentSearchTimer);
+    contentSearchSeq++;
+}
 
-    console.log(`[Search] Found ${searchResults.length} matches for "${query}"`);
+// searchContents adds full-text matches below the file name matches
+async function searchContents(query, files, seq) {
+    try {
+        const response = await fetch('/api/search?q=' + encodeURIComponent(query));
+        if (!response.ok) return; // Index disabled (--no-index)
+        const data = await response.json();
+        if (seq !== contentSearchSeq) return;
+        const hits = data.results.map(result => ({
+            name: result.path.split('/').pop(),
+            path: result.path,
+            url: result.url,
+            snippet: result.snippet || ''
+        }));
+        showSearchResults(files, hits);
+    } catch (error) {
+        console.error('[Search] Content search failed:', error);
+    }
+}
+
+// showSearchResults fills the dropdown with file name matches, then content matches
+function showSearchResults(files, hits) {
+    const dropdown = document.getElementById('search-dropdown');
+    const resultsContainer = document.getElementById('search-results');
+    searchResults = files.concat(hits);
+    selectedIndex = -1;
+    if (!dropdown || !resultsContainer) return;
+
+    if (searchResults.length === 0) {
+        resultsContainer.innerHTML = `<div class="search-no-results">${escapeHtml(t('No files found'))}</div>`;
+        dropdown.style.display = 'block';
+        return;
+    }
+
+    const item = (file, index) =>
+        `<div class="search-result-item" data-index="${index}">
+            <div class="search-result-name">${escapeHtml(file.name)}</div>
+            ${file.snippet ? `<div class="search-result-snippet">${escapeHtml(file.snippet)}</div>` : ''}
+            <div class="search-result-path">${escapeHtml(file.path)}</div>
+        </div>`;
+    resultsContainer.innerHTML = files.map(item).join('') +
+        (hits.length > 0 ? '<div class="search-section">In file contents</div>' : '') +
+        hits.map((hit, i) => item(hit, files.length + i)).join('');
+    dropdown.style.display = 'block';
+
+    // Add click handlers to results
+    const items = resultsContainer.querySelectorAll('.search-result-item');
+    items.forEach((element, index) => {
+        element.addEventListener('click', () => {
+            navigateToFile(searchResults[index].url);
+        });
+    });
 }
 
 // Navigate to selected file
@@ -1684,6 +3084,7 @@ function navigateToFile(url) {
     const dropdown = document.getElementById('search-dropdown');
 
     // Hide dropdown
+    cancelContentSearch();
     if (dropdown) dropdown.style.display = 'none';
 
     // Clear search
@@ -1769,6 +3170,7 @@ function clearSearch() {
         dropdown.style.display = 'none';
     }
 
+    cancelContentSearch();
     searchResults = [];
     selectedIndex = -1;
 
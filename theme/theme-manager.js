@@ -1,3 +1,13 @@
+// t translates a UI string with the page's catalog (window.uiMessages, set by
+// the template), then fills each %s or %d with the next of args, like the
+// server's T
+function t(msg, ...args) {
+    const translated = (window.uiMessages && window.uiMessages[msg]) || msg;
+    if (args.length === 0) return translated;
+    let next = 0;
+    return translated.replace(/%[sd%]/g, verb => verb === '%%' ? '%' : String(args[next++]));
+}
+
 // Theme management
 function setTheme(mode) {
     const html = document.documentElement;
@@ -21,7 +31,7 @@ function setTheme(mode) {
 
 function updateThemeButton(mode) {
     const icons = { light: '☀️', dark: '🌙', auto: '💻' };
-    const labels = { light: 'Light', dark: 'Dark', auto: 'Auto' };
+    const labels = { light: t('Light'), dark: t('Dark'), auto: t('Auto') };
 
     // Update toggle button display
     const currentIcon = document.getElementById('theme-current-icon');
@@ -122,6 +132,26 @@ function initKeyboardNavigation() {
     });
 }
 
+// Error of a failed fetch: the message of a JSON error response
+// ({"error": {"status", "code", "message"}}) or its text, with the stable
+// error code (e.g. "readonly") as error.code
+async function responseError(response, fallback) {
+    const text = (await response.text()).trim();
+    let message = text, code = '';
+    try {
+        const data = JSON.parse(text);
+        if (data && data.error) {
+            message = data.error.message;
+            code = data.error.code;
+        }
+    } catch (e) {
+        // Plain text
+    }
+    const error = new Error(message || fallback || `HTTP ${response.status}`);
+    error.code = code;
+    return error;
+}
+
 // Initialize theme on page load
 const savedTheme = localStorage.getItem('theme') || 'auto';
 setTheme(savedTheme);
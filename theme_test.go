@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadThemeOverrides tests replaced files, layered custom.css and template overrides
+func TestLoadThemeOverrides(t *testing.T) {
+	project, user := t.TempDir(), t.TempDir()
+	write := func(dir, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(user, "github-markdown.css", "body { font-family: user; }")
+	write(project, "github-markdown.css", "body { font-family: project; }")
+	write(user, customCSSFile, ".user-rule {}")
+	write(project, customCSSFile, ".project-rule {}")
+	write(project, customJSFile, "console.log('project');")
+	write(project, "embed.html", `<p class="custom-embed">{{.Title}}</p>`)
+	defer func() {
+		if err := loadTheme(nil); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if err := loadTheme([]string{project, user}); err != nil {
+		t.Fatalf("loadTheme() error: %v", err)
+	}
+	if githubCSS != "body { font-family: project; }" {
+		t.Errorf("githubCSS = %q, want the project file", githubCSS)
+	}
+	userAt, projectAt := strings.Index(themeOverrides, ".user-rule"), strings.Index(themeOverrides, ".project-rule")
+	if userAt < 0 || projectAt < userAt {
+		t.Errorf("custom CSS not appended user first, then project:\n%s", themeOverrides[max(0, len(themeOverrides)-300):])
+	}
+	if !strings.HasSuffix(themeManagerJS, "console.log('project');") {
+		t.Error("custom.js not appended to the theme manager script")
+	}
+	var buf bytes.Buffer
+	if err := embedTmpl.Execute(&buf, embedTemplateData{Title: "Doc"}); err != nil || buf.String() != `<p class="custom-embed">Doc</p>` {
+		t.Errorf("embed template = %q, %v; want the override", buf.String(), err)
+	}
+
+	// A broken template is rejected without replacing the loaded ones
+	write(project, "compare.html", "{{.Unclosed")
+	before := compareTmpl
+	if err := loadTheme([]string{project}); err == nil || !strings.Contains(err.Error(), "compare.html") {
+		t.Errorf("loadTheme() error = %v, want a compare.html parse error", err)
+	}
+	if compareTmpl != before {
+		t.Error("compare template replaced despite the parse error")
+	}
+}
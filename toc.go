@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/razvandimescu/peekm/render"
+)
+
+// defaultTOCDepth is the deepest heading level listed when no depth is given
+const defaultTOCDepth = 3
+
+// tocEndMarker closes the generated table of contents
+const tocEndMarker = "<!-- /toc -->"
+
+var (
+	// tocStartPattern matches the opening marker line, optionally with a depth (<!-- toc depth=2 -->)
+	tocStartPattern = regexp.MustCompile(`(?m)^<!--\s*toc(?:\s+depth=([1-6]))?\s*-->[ \t]*$`)
+	// tocEndPattern matches the closing marker line
+	tocEndPattern = regexp.MustCompile(`(?m)^<!--\s*/toc\s*-->[ \t]*$`)
+	// tocTitlePattern matches an ATX h1 line
+	tocTitlePattern = regexp.MustCompile(`^ {0,3}#(?:[ \t]|$)`)
+
+	tocLinkTextEscaper = strings.NewReplacer(`[`, `\[`, `]`, `\]`)
+)
+
+// tocStartMarker returns the opening marker, recording non-default depths so
+// updates on save keep them
+func tocStartMarker(depth int) string {
+	if depth == defaultTOCDepth {
+		return "<!-- toc -->"
+	}
+	return fmt.Sprintf("<!-- toc depth=%d -->", depth)
+}
+
+// buildTOC renders headings up to depth as a nested markdown list. A single
+// h1 is treated as the document title and left out.
+func buildTOC(headings []render.Heading, depth int) string {
+	h1Count := 0
+	for _, h := range headings {
+		if h.Level == 1 {
+			h1Count++
+		}
+	}
+
+	var listed []render.Heading
+	minLevel := depth
+	for _, h := range headings {
+		if h.Level > depth || (h.Level == 1 && h1Count == 1) {
+			continue
+		}
+		listed = append(listed, h)
+		minLevel = min(minLevel, h.Level)
+	}
+
+	var b strings.Builder
+	for _, h := range listed {
+		fmt.Fprintf(&b, "%s- [%s](#%s)\n", strings.Repeat("  ", h.Level-minLevel), tocLinkTextEscaper.Replace(h.Text), h.ID)
+	}
+	return b.String()
+}
+
+// updateTOC regenerates the list between the TOC markers, adding the end
+// marker if it is missing. A depth of 0 keeps the marker's depth. Returns
+// false when the document has no TOC marker.
+func updateTOC(source string, depth int) (string, bool) {
+	start := tocStartPattern.FindStringSubmatchIndex(source)
+	if start == nil {
+		return source, false
+	}
+	if depth == 0 {
+		depth = defaultTOCDepth
+		if start[2] >= 0 {
+			depth, _ = strconv.Atoi(source[start[2]:start[3]])
+		}
+	}
+
+	after := source[start[1]:]
+	if end := tocEndPattern.FindStringIndex(after); end != nil {
+		after = after[end[1]:]
+	}
+
+	block := tocStartMarker(depth) + "\n" + tocEndMarker
+	body := source[frontMatterLength(source):] // Front matter would parse as a setext heading
+	if toc := buildTOC(render.Headings(newMarkdownRenderer(), []byte(body)), depth); toc != "" {
+		block = tocStartMarker(depth) + "\n\n" + toc + "\n" + tocEndMarker
+	}
+	return source[:start[0]] + block + after, true
+}
+
+// insertTOC updates an existing table of contents or adds one after the
+// front matter and title heading
+func insertTOC(source string, depth int) string {
+	if updated, found := updateTOC(source, depth); found {
+		return updated
+	}
+	if depth == 0 {
+		depth = defaultTOCDepth
+	}
+
+	pos := tocInsertPosition(source)
+	head, rest := source[:pos], strings.TrimLeft(source[pos:], "\n")
+	if head != "" {
+		head = strings.TrimRight(head, "\n") + "\n\n"
+	}
+	if rest != "" {
+		rest = "\n\n" + rest
+	}
+	updated, _ := updateTOC(head+tocStartMarker(depth)+"\n"+tocEndMarker+rest, depth)
+	return updated
+}
+
+// frontMatterLength returns the length of leading YAML front matter (0 if none)
+func frontMatterLength(source string) int {
+	if !strings.HasPrefix(source, "---\n") {
+		return 0
+	}
+	if end := strings.Index(source[3:], "\n---\n"); end >= 0 {
+		return 3 + end + len("\n---\n")
+	}
+	return 0
+}
+
+// tocInsertPosition returns the offset after the front matter and a leading h1
+func tocInsertPosition(source string) int {
+	pos := frontMatterLength(source)
+	rest := source[pos:]
+	trimmed := strings.TrimLeft(rest, "\n")
+	line, _, _ := strings.Cut(trimmed, "\n")
+	if !tocTitlePattern.MatchString(line) {
+		return pos
+	}
+	pos += len(rest) - len(trimmed) + len(line)
+	if pos < len(source) {
+		pos++ // Past the title's newline
+	}
+	return pos
+}
+
+// handleInsertTOC adds or refreshes the table of contents in a file (POST {"path": ..., "depth": 3})
+func handleInsertTOC(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path  string `json:"path"`
+		Depth int    `json:"depth"` // Deepest heading level; 0 keeps the existing depth (default 3)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Depth < 0 || req.Depth > 6 {
+		writeError(w, errCodeBadRequest, "Depth must be between 1 and 6", http.StatusBadRequest)
+		return
+	}
+
+	validated, ok := resolveWhitelistedPath(w, req.Path)
+	if !ok {
+		return
+	}
+	relPath := getRelativePath(validated)
+	if err := checkWritable(validated); err != nil {
+		writeError(w, errCodeReadOnly, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	content, err := os.ReadFile(validated)
+	if err != nil {
+		writeError(w, errCodeInternal, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	updated := insertTOC(string(content), req.Depth)
+	if updated != string(content) {
+		if err := atomicWriteFile(validated, updated); err != nil {
+			writeError(w, errCodeInternal, fmt.Sprintf("Failed to save: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Updated table of contents: %s", validated)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"path": filepath.ToSlash(relPath)})
+}
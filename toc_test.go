@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+// TestInsertTOC tests adding, refreshing and re-depthing a table of contents
+func TestInsertTOC(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		depth  int
+		want   string
+	}{
+		{
+			name:   "inserted after title",
+			source: "# Guide\n\nIntro.\n\n## Install\n\n### macOS\n\n#### Details\n\n## Usage [beta]\n",
+			want:   "# Guide\n\n<!-- toc -->\n\n- [Install](#install)\n  - [macOS](#macos)\n- [Usage \\[beta\\]](#usage-beta)\n\n<!-- /toc -->\n\nIntro.\n\n## Install\n\n### macOS\n\n#### Details\n\n## Usage [beta]\n",
+		},
+		{
+			name:   "inserted after front matter without title",
+			source: "---\ntitle: x\n---\n## One\n## Two\n",
+			depth:  2,
+			want:   "---\ntitle: x\n---\n\n<!-- toc depth=2 -->\n\n- [One](#one)\n- [Two](#two)\n\n<!-- /toc -->\n\n## One\n## Two\n",
+		},
+		{
+			name:   "existing markers refreshed with their depth",
+			source: "# A\n\n<!-- toc depth=2 -->\n- [Old](#old)\n<!-- /toc -->\n\n## New\n\n### Deep\n",
+			want:   "# A\n\n<!-- toc depth=2 -->\n\n- [New](#new)\n\n<!-- /toc -->\n\n## New\n\n### Deep\n",
+		},
+		{
+			name:   "missing end marker added",
+			source: "<!-- toc -->\n\n# One\n# Two\n",
+			want:   "<!-- toc -->\n\n- [One](#one)\n- [Two](#two)\n\n<!-- /toc -->\n\n# One\n# Two\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := insertTOC(tt.source, tt.depth)
+			if got != tt.want {
+				t.Errorf("insertTOC() =\n%q\nwant\n%q", got, tt.want)
+			}
+			if again, _ := updateTOC(got, 0); again != got {
+				t.Errorf("updateTOC() is not idempotent:\n%q", again)
+			}
+		})
+	}
+
+	if _, found := updateTOC("# No markers\n", 0); found {
+		t.Error("updateTOC() found markers in a document without them")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// moveToTrash moves a file to the OS trash (recycle bin), or deletes it
+// permanently with --delete=permanent. When the trash cannot take the file it is
+// left alone and the error says so: deleting it instead could not be undone.
+func moveToTrash(filePath string) error {
+	if *deleteMode == deletePermanent {
+		if err := os.Remove(filePath); err != nil {
+			return err
+		}
+		log.Printf("Permanently deleted (--delete=permanent): %s", filePath)
+		return nil
+	}
+	if err := trashFile(filePath); err != nil {
+		return fmt.Errorf("cannot move to trash (start peekm with --delete=permanent to delete permanently): %w", err)
+	}
+	log.Printf("Moved to trash: %s", filePath)
+	return nil
+}
+
+// trashName returns the nth candidate name for base in a trash directory:
+// base itself, then "name 2.md", "name 3.md" and so on
+func trashName(base string, n int) string {
+	if n <= 1 {
+		return base
+	}
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + " " + strconv.Itoa(n) + ext
+}
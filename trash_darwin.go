@@ -0,0 +1,48 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// maxTrashNames bounds the search for a free name in the trash
+const maxTrashNames = 1000
+
+// trashFile moves filePath to the Trash without going through Finder (which
+// may not be running): ~/.Trash for files on the home volume, otherwise the
+// volume's .Trashes/<uid>
+func trashFile(filePath string) error {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	trashDir := filepath.Join(home, ".Trash")
+	if !sameDevice(filePath, home) {
+		top, err := mountTop(filePath)
+		if err != nil {
+			return err
+		}
+		trashDir = filepath.Join(top, ".Trashes", strconv.Itoa(os.Getuid()))
+	}
+	if err := os.MkdirAll(trashDir, 0o700); err != nil {
+		return err
+	}
+
+	base := filepath.Base(filePath)
+	for n := 1; n <= maxTrashNames; n++ {
+		target := filepath.Join(trashDir, trashName(base, n))
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		return os.Rename(filePath, target)
+	}
+	return fmt.Errorf("no free name for %s in %s", base, trashDir)
+}
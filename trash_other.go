@@ -0,0 +1,13 @@
+//go:build !unix && !(windows && (amd64 || arm64))
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+// trashFile reports that this system has no supported trash
+func trashFile(filePath string) error {
+	return errors.New("no trash support on " + runtime.GOOS + "/" + runtime.GOARCH)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrashName(t *testing.T) {
+	tests := []struct {
+		base string
+		n    int
+		want string
+	}{
+		{"notes.md", 1, "notes.md"},
+		{"notes.md", 2, "notes 2.md"},
+		{"notes.md", 12, "notes 12.md"},
+		{"archive.tar.gz", 3, "archive.tar 3.gz"},
+		{"README", 2, "README 2"},
+	}
+	for _, tt := range tests {
+		if got := trashName(tt.base, tt.n); got != tt.want {
+			t.Errorf("trashName(%q, %d) = %q, want %q", tt.base, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMoveToTrashPermanent(t *testing.T) {
+	oldMode := *deleteMode
+	defer func() { *deleteMode = oldMode }()
+	*deleteMode = deletePermanent
+
+	file := filepath.Join(t.TempDir(), "gone.md")
+	if err := os.WriteFile(file, []byte("# Gone"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveToTrash(file); err != nil {
+		t.Fatalf("moveToTrash: %v", err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("file still exists after permanent delete: %v", err)
+	}
+	if err := moveToTrash(file); err == nil {
+		t.Error("deleting a missing file succeeded")
+	}
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// deviceOf returns the ID of the device holding path
+func deviceOf(path string) (uint64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("no device information for %s", path)
+	}
+	return uint64(st.Dev), nil // Dev is int32 on some systems
+}
+
+// mountTop returns the top directory of the mount holding path: its highest
+// ancestor on the same device
+func mountTop(path string) (string, error) {
+	dev, err := deviceOf(path)
+	if err != nil {
+		return "", err
+	}
+	top := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(top)
+		if parent == top {
+			return top, nil
+		}
+		if parentDev, err := deviceOf(parent); err != nil || parentDev != dev {
+			return top, nil
+		}
+		top = parent
+	}
+}
+
+// sameDevice reports whether two paths are on the same device, so a rename
+// can move one into the other
+func sameDevice(a, b string) bool {
+	devA, errA := deviceOf(a)
+	devB, errB := deviceOf(b)
+	return errA == nil && errB == nil && devA == devB
+}
@@ -0,0 +1,63 @@
+//go:build windows && (amd64 || arm64)
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// SHFileOperationW operation and flags
+const (
+	foDelete          = 0x0003
+	fofSilent         = 0x0004 // No progress dialog
+	fofNoConfirmation = 0x0010
+	fofAllowUndo      = 0x0040 // Recycle instead of deleting
+	fofNoErrorUI      = 0x0400
+)
+
+var procSHFileOperationW = syscall.NewLazyDLL("shell32.dll").NewProc("SHFileOperationW")
+
+// shFileOpStruct is SHFILEOPSTRUCTW as laid out on 64-bit Windows (32-bit
+// Windows packs it, which Go structs cannot express)
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// trashFile moves filePath to the Recycle Bin through the shell API, without
+// spawning PowerShell
+func trashFile(filePath string) error {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	// pFrom is a list of paths ending with an empty one: the path plus two NULs
+	from, err := syscall.UTF16FromString(filePath)
+	if err != nil {
+		return err
+	}
+	from = append(from, 0)
+
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofNoErrorUI | fofSilent,
+	}
+	ret, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op)))
+	if ret != 0 {
+		return fmt.Errorf("SHFileOperation failed with code %#x", ret)
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return fmt.Errorf("recycling %s was aborted", filePath)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+//go:build unix && !darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// maxTrashNames bounds the search for a free name in the trash
+const maxTrashNames = 1000
+
+// trashFile moves filePath to the trash as the freedesktop.org Trash
+// specification describes, so file managers can list and restore it: the
+// home trash for files on the home trash's device, otherwise the trash at
+// the top of the file's mount
+func trashFile(filePath string) error {
+	filePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	trashDir, infoPath, err := xdgTrashFor(filePath)
+	if err != nil {
+		return err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(trashDir, sub), 0o700); err != nil {
+			return err
+		}
+	}
+
+	name, infoFile, err := reserveTrashName(trashDir, filepath.Base(filePath), infoPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(filePath, filepath.Join(trashDir, "files", name)); err != nil {
+		os.Remove(infoFile)
+		return err
+	}
+	return nil
+}
+
+// xdgTrashFor returns the trash directory for filePath and the path to
+// record in its .trashinfo file (absolute in the home trash, relative to the
+// mount top elsewhere)
+func xdgTrashFor(filePath string) (string, string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	if err := os.MkdirAll(dataHome, 0o700); err != nil {
+		return "", "", err
+	}
+	if sameDevice(filePath, dataHome) {
+		return filepath.Join(dataHome, "Trash"), filePath, nil
+	}
+
+	top, err := mountTop(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	relPath, err := filepath.Rel(top, filePath)
+	if err != nil {
+		return "", "", err
+	}
+	uid := strconv.Itoa(os.Getuid())
+
+	// $topdir/.Trash/$uid if an administrator set up a shared .Trash (a
+	// sticky directory, not a symlink), else $topdir/.Trash-$uid
+	if info, err := os.Lstat(filepath.Join(top, ".Trash")); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		return filepath.Join(top, ".Trash", uid), relPath, nil
+	}
+	return filepath.Join(top, ".Trash-"+uid), relPath, nil
+}
+
+// reserveTrashName writes the .trashinfo file for a free name in trashDir
+// (creating it exclusively claims the name) and returns the name and the
+// info file
+func reserveTrashName(trashDir, base, infoPath string) (string, string, error) {
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: infoPath}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+
+	for n := 1; n <= maxTrashNames; n++ {
+		name := trashName(base, n)
+		if _, err := os.Lstat(filepath.Join(trashDir, "files", name)); err == nil {
+			continue
+		}
+		infoFile := filepath.Join(trashDir, "info", name+".trashinfo")
+		f, err := os.OpenFile(infoFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		_, writeErr := f.WriteString(info)
+		if err := errors.Join(writeErr, f.Close()); err != nil {
+			os.Remove(infoFile)
+			return "", "", err
+		}
+		return name, infoFile, nil
+	}
+	return "", "", fmt.Errorf("no free name for %s in %s", base, trashDir)
+}
@@ -0,0 +1,76 @@
+//go:build unix && !darwin
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrashFileXDG(t *testing.T) {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	trashDir := filepath.Join(dataHome, "Trash")
+
+	dir := t.TempDir()
+	if !sameDevice(dir, dataHome) {
+		t.Skip("temporary directories are on different devices")
+	}
+	trash := func(name, content string) {
+		t.Helper()
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := trashFile(file); err != nil {
+			t.Fatalf("trashFile(%s): %v", name, err)
+		}
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Fatalf("%s still exists after trashing: %v", name, err)
+		}
+	}
+
+	trash("my notes.md", "first")
+	trash("my notes.md", "second")
+
+	for name, want := range map[string]string{"my notes.md": "first", "my notes 2.md": "second"} {
+		data, err := os.ReadFile(filepath.Join(trashDir, "files", name))
+		if err != nil {
+			t.Errorf("trashed file %s: %v", name, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("trashed %s = %q, want %q", name, data, want)
+		}
+	}
+
+	info, err := os.ReadFile(filepath.Join(trashDir, "info", "my notes 2.md.trashinfo"))
+	if err != nil {
+		t.Fatalf("trashinfo: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(info)), "\n")
+	if len(lines) != 3 || lines[0] != "[Trash Info]" {
+		t.Fatalf("trashinfo = %q", info)
+	}
+	wantPath := "Path=" + strings.ReplaceAll(filepath.Join(dir, "my notes.md"), " ", "%20")
+	if lines[1] != wantPath {
+		t.Errorf("trashinfo path = %q, want %q", lines[1], wantPath)
+	}
+	date, ok := strings.CutPrefix(lines[2], "DeletionDate=")
+	if !ok {
+		t.Fatalf("trashinfo date line = %q", lines[2])
+	}
+	if _, err := time.ParseInLocation("2006-01-02T15:04:05", date, time.Local); err != nil {
+		t.Errorf("trashinfo date %q: %v", date, err)
+	}
+}
+
+func TestTrashFileMissing(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if err := trashFile(filepath.Join(t.TempDir(), "missing.md")); err == nil {
+		t.Error("trashing a missing file succeeded")
+	}
+}
@@ -0,0 +1,304 @@
+package tree
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// IgnoreFileName is the per-directory file listing extra directory exclusions
+const IgnoreFileName = ".peekmignore"
+
+var (
+	// HardcodedExclusions lists directories that are always skipped (common build artifacts and dependencies)
+	HardcodedExclusions = []string{
+		"node_modules", // Node.js dependencies
+		"vendor",       // Go dependencies
+		"dist",         // Build output
+		"venv",         // Python virtual environment
+		"env",          // Python virtual environment (alternative name)
+		"virtualenv",   // Python virtual environment (alternative name)
+	}
+
+	// Map version for O(1) lookup performance
+	hardcodedExclusionsMap = map[string]bool{
+		"node_modules": true,
+		"vendor":       true,
+		"dist":         true,
+		"venv":         true,
+		"env":          true,
+		"virtualenv":   true,
+	}
+)
+
+// Collect returns every markdown file under rootDir, sorted. Hidden directories
+// (except .claude), hardcoded exclusions and directories and files matching
+// customPatterns are skipped, and symlinks are only followed when they
+// resolve inside $HOME.
+func Collect(rootDir string, customPatterns []string) []string {
+	files, _ := CollectWithSettings(rootDir, customPatterns, nil)
+	return files
+}
+
+// CollectWithSettings is Collect that also applies the .peekm.toml files found
+// on the way (exclusions and extensions) and returns their settings. With a
+// non-nil gitignore, paths git ignores are skipped too, and the .gitignore
+// files found on the way are added to it.
+func CollectWithSettings(rootDir string, customPatterns []string, gitignore *Gitignore) ([]string, DirSettings) {
+	return CollectEach(rootDir, customPatterns, gitignore, nil)
+}
+
+// CollectEach is CollectWithSettings that also calls found with each file as
+// the walk comes across it (in walk order, before the final sort), so callers
+// can show progress on large trees
+func CollectEach(rootDir string, customPatterns []string, gitignore *Gitignore, found func(path string)) ([]string, DirSettings) {
+	homeDir, _ := os.UserHomeDir()
+
+	c := &collector{
+		homeDir:        homeDir,
+		customPatterns: customPatterns,
+		visited:        make(map[string]bool),
+		settings:       make(DirSettings),
+		gitignore:      gitignore,
+		found:          found,
+	}
+	c.walk(rootDir)
+
+	sort.Strings(c.files)
+	return c.files, c.settings
+}
+
+// IsExcludedDir returns true if the directory name should be skipped
+func IsExcludedDir(name string, customPatterns []string) bool {
+	if strings.HasPrefix(name, ".") && name != ".claude" {
+		return true
+	}
+	if isHardcodedExclusion(name) {
+		return true
+	}
+	if len(customPatterns) > 0 && MatchesIgnorePattern(name, customPatterns) {
+		return true
+	}
+	return false
+}
+
+// IsExcludedFile returns true if a file name matches a custom pattern (such
+// as CHANGELOG*.md or *.generated.md)
+func IsExcludedFile(name string, customPatterns []string) bool {
+	return len(customPatterns) > 0 && MatchesIgnorePattern(name, customPatterns)
+}
+
+// MatchesIgnorePattern checks if directory name matches any pattern
+func MatchesIgnorePattern(dirName string, patterns []string) bool {
+	for _, pattern := range patterns {
+		// Simple wildcard matching using filepath.Match
+		matched, err := filepath.Match(pattern, dirName)
+		if err != nil {
+			log.Printf("Warning: Invalid pattern '%s': %v", pattern, err)
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// isHardcodedExclusion checks if directory name is in hardcoded exclusions
+// Uses map for O(1) lookup performance
+func isHardcodedExclusion(dirName string) bool {
+	return hardcodedExclusionsMap[dirName]
+}
+
+// ParseIgnoreFile reads and parses the .peekmignore file in rootDir.
+// Returns nil when the file is missing, unreadable, or outside $HOME.
+func ParseIgnoreFile(rootDir string) []string {
+	return ParseIgnoreFileAt(filepath.Join(rootDir, IgnoreFileName))
+}
+
+// ParseIgnoreFileAt reads and parses an ignore file in .peekmignore syntax
+// (such as the user's global one). Returns nil when the file is missing,
+// unreadable, or outside $HOME.
+func ParseIgnoreFileAt(ignoreFilePath string) []string {
+	name := ignoreFileLabel(ignoreFilePath)
+
+	// CRITICAL: Validate path through existing security chain
+	validatedPath, err := safepath.Resolve(ignoreFilePath)
+	if err != nil {
+		return nil // Outside $HOME or path validation failed
+	}
+
+	file, err := os.Open(validatedPath)
+	if err != nil {
+		return nil // File doesn't exist or can't be read - silent fallback
+	}
+	defer file.Close()
+
+	const maxWarnings = 3
+	const maxPatternLength = 256
+
+	var customPatterns []string
+	var invalidCount int
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Reject patterns that are too long (prevent pathological cases)
+		if len(line) > maxPatternLength {
+			invalidCount++
+			if invalidCount <= maxWarnings {
+				log.Printf("Warning: %s pattern too long (max %d chars, ignored): %s", name, maxPatternLength, line[:50]+"...")
+			}
+			continue
+		}
+
+		// Reject patterns with path separators (ambiguous intent)
+		if strings.Contains(line, "/") || strings.Contains(line, "\\") {
+			invalidCount++
+			if invalidCount <= maxWarnings {
+				log.Printf("Warning: %s pattern contains path separator (ignored): %s", name, line)
+			}
+			continue
+		}
+
+		// Validate pattern syntax with arbitrary test filename
+		if _, err := filepath.Match(line, "test"); err != nil {
+			invalidCount++
+			if invalidCount <= maxWarnings {
+				log.Printf("Warning: Invalid %s pattern '%s': %v", name, line, err)
+			}
+			continue
+		}
+
+		customPatterns = append(customPatterns, line)
+	}
+
+	// Summarize suppressed warnings
+	if invalidCount > maxWarnings {
+		log.Printf("Warning: Suppressed %d additional invalid %s patterns", invalidCount-maxWarnings, name)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Printf("Warning: Error reading %s: %v", name, err)
+		return nil
+	}
+
+	return customPatterns
+}
+
+// ignoreFileLabel names an ignore file in warnings: .peekmignore, or other
+// ignore files in full
+func ignoreFileLabel(path string) string {
+	if filepath.Base(path) == IgnoreFileName {
+		return IgnoreFileName
+	}
+	return path
+}
+
+// remapPath translates a resolved filesystem path back to its symlink-based equivalent
+func remapPath(resolved, walkDir, path string) string {
+	if walkDir == resolved {
+		return path
+	}
+	relPath, err := filepath.Rel(resolved, path)
+	if err != nil {
+		return path
+	}
+	return filepath.Join(walkDir, relPath)
+}
+
+// collector holds the state of one Collect walk
+type collector struct {
+	homeDir        string
+	customPatterns []string
+	visited        map[string]bool
+	settings       DirSettings
+	gitignore      *Gitignore // nil unless .gitignore files are respected
+	files          []string
+	found          func(path string) // Optional, called with each file added to files
+}
+
+func (c *collector) walk(walkDir string) {
+	// Resolve symlinks to get the real path for walking and cycle detection
+	resolved, err := filepath.EvalSymlinks(walkDir)
+	if err != nil {
+		return
+	}
+	if c.visited[resolved] {
+		return
+	}
+	c.visited[resolved] = true
+
+	// Walk the resolved path (filepath.Walk won't descend into symlink roots)
+	// Remap resolved paths back to the original symlink prefix for tree display
+	filepath.Walk(resolved, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		// Security: Skip symlinks that point outside $HOME
+		resolvedInfo, shouldSkip, resolveErr := safepath.CheckSymlink(path, info, c.homeDir)
+		if shouldSkip {
+			return filepath.SkipDir
+		}
+		if resolveErr != nil {
+			return nil
+		}
+
+		isSymlink := info.Mode()&os.ModeSymlink != 0
+		if resolvedInfo != nil {
+			info = resolvedInfo
+		}
+
+		remapped := remapPath(resolved, walkDir, path)
+		if info.IsDir() {
+			return c.enterDir(remapped, info.Name(), path == resolved, isSymlink)
+		}
+		if c.includesFile(remapped, info.Name()) {
+			c.files = append(c.files, remapped)
+			if c.found != nil {
+				c.found(remapped)
+			}
+		}
+
+		return nil
+	})
+}
+
+// includesFile reports whether the file at path is a markdown file no ignore
+// pattern excludes
+func (c *collector) includesFile(path, name string) bool {
+	settings := c.settings.For(filepath.Dir(path))
+	return settings.IsMarkdown(name) && !IsExcludedFile(name, c.customPatterns) && !settings.Excludes(name) &&
+		!c.gitignore.matches(path, false) // Its directories were checked on the way in
+}
+
+// enterDir decides whether the walk descends into dir, loading its settings
+// when it does (isRoot: dir is where the current walk started)
+func (c *collector) enterDir(dir, name string, isRoot, isSymlink bool) error {
+	if isRoot {
+		c.settings.load(dir)
+		c.gitignore.load(dir)
+		return nil
+	}
+	if IsExcludedDir(name, c.customPatterns) || c.settings.For(filepath.Dir(dir)).Excludes(name) || c.gitignore.matches(dir, true) {
+		return filepath.SkipDir
+	}
+	if isSymlink {
+		c.walk(dir) // Loads dir's settings as its root
+		return nil
+	}
+	c.settings.load(dir)
+	c.gitignore.load(dir)
+	return nil
+}
@@ -1,143 +1,15 @@
-package main
+package tree
 
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 )
 
-// TestValidateAndResolvePath tests the path validation and security checks
-func TestValidateAndResolvePath(t *testing.T) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		t.Fatalf("cannot get home directory: %v", err)
-	}
-
-	tests := []struct {
-		name        string
-		input       string
-		wantErr     bool
-		errContains string
-		setup       func() (string, func()) // Returns test path and cleanup function
-	}{
-		{
-			name: "valid path with tilde",
-			setup: func() (string, func()) {
-				testPath := filepath.Join(homeDir, "peekm_test_tilde")
-				os.Mkdir(testPath, 0755)
-				cleanup := func() { os.Remove(testPath) }
-				return "~/peekm_test_tilde", cleanup
-			},
-			wantErr: false,
-		},
-		{
-			name:    "tilde only expands to home",
-			input:   "~",
-			wantErr: false,
-		},
-		{
-			name:        "path outside home directory - /etc",
-			input:       "/etc/passwd",
-			wantErr:     true,
-			errContains: "access denied",
-		},
-		{
-			name:        "path outside home directory - /tmp",
-			input:       "/tmp",
-			wantErr:     true,
-			errContains: "access denied",
-		},
-		{
-			name:        "path traversal attack",
-			input:       filepath.Join(homeDir, "docs/../../../etc/passwd"),
-			wantErr:     true,
-			errContains: "access denied",
-		},
-		{
-			name: "symlink pointing outside home",
-			setup: func() (string, func()) {
-				linkPath := filepath.Join(homeDir, "test_evil_symlink")
-				os.Symlink("/etc/passwd", linkPath)
-				cleanup := func() {
-					os.Remove(linkPath)
-				}
-				return linkPath, cleanup
-			},
-			wantErr:     true,
-			errContains: "access denied",
-		},
-		{
-			name: "symlink pointing inside home (valid)",
-			setup: func() (string, func()) {
-				targetPath := filepath.Join(homeDir, "test_target")
-				os.WriteFile(targetPath, []byte("test"), 0644)
-				linkPath := filepath.Join(homeDir, "test_good_symlink")
-				os.Symlink(targetPath, linkPath)
-				cleanup := func() {
-					os.Remove(linkPath)
-					os.Remove(targetPath)
-				}
-				return linkPath, cleanup
-			},
-			wantErr: false,
-		},
-		{
-			name:        "non-existent path",
-			input:       filepath.Join(homeDir, "nonexistent_dir_12345_test"),
-			wantErr:     true,
-			errContains: "does not exist",
-		},
-		{
-			name: "valid absolute path in home",
-			setup: func() (string, func()) {
-				testPath := filepath.Join(homeDir, "test_valid_path")
-				os.Mkdir(testPath, 0755)
-				cleanup := func() {
-					os.Remove(testPath)
-				}
-				return testPath, cleanup
-			},
-			wantErr: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			testInput := tt.input
-			var cleanup func()
-
-			if tt.setup != nil {
-				var setupPath string
-				setupPath, cleanup = tt.setup()
-				if cleanup != nil {
-					defer cleanup()
-				}
-				testInput = setupPath
-			}
-
-			result, err := validateAndResolvePath(testInput)
-
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("expected error, got nil")
-				} else if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
-					t.Errorf("error %q does not contain %q", err.Error(), tt.errContains)
-				}
-			} else {
-				if err != nil {
-					t.Errorf("unexpected error: %v", err)
-				}
-				if result != "" && !strings.HasPrefix(result, homeDir) {
-					t.Errorf("result %q not in home directory %q", result, homeDir)
-				}
-			}
-		})
-	}
-}
-
-// TestCollectMarkdownFiles_SymlinkSecurity tests symlink security in file collection
-func TestCollectMarkdownFiles_SymlinkSecurity(t *testing.T) {
+// TestCollect_SymlinkSecurity tests symlink security in file collection
+func TestCollect_SymlinkSecurity(t *testing.T) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		t.Fatalf("cannot get home directory: %v", err)
@@ -164,7 +36,7 @@ func TestCollectMarkdownFiles_SymlinkSecurity(t *testing.T) {
 	goodSymlink := filepath.Join(testDir, "good.md")
 	os.Symlink(goodTarget, goodSymlink)
 
-	files := collectMarkdownFiles(testDir)
+	files := Collect(testDir, nil)
 
 	// Should include valid.md and good.md, but NOT evil.md
 	if len(files) != 2 {
@@ -193,8 +65,8 @@ func TestCollectMarkdownFiles_SymlinkSecurity(t *testing.T) {
 	}
 }
 
-// TestCollectMarkdownFiles_HardcodedExclusions tests that hardcoded exclusions are skipped
-func TestCollectMarkdownFiles_HardcodedExclusions(t *testing.T) {
+// TestCollect_HardcodedExclusions tests that hardcoded exclusions are skipped
+func TestCollect_HardcodedExclusions(t *testing.T) {
 	testDir := t.TempDir()
 
 	// Create files in various locations
@@ -225,7 +97,7 @@ func TestCollectMarkdownFiles_HardcodedExclusions(t *testing.T) {
 	os.Mkdir(filepath.Join(testDir, "docs"), 0755)
 	os.WriteFile(filepath.Join(testDir, "docs", "doc.md"), []byte("# Doc"), 0644)
 
-	files := collectMarkdownFiles(testDir)
+	files := Collect(testDir, nil)
 
 	if len(files) != 3 {
 		t.Errorf("expected 3 files (root.md, feature.md, doc.md), got %d: %v", len(files), files)
@@ -263,8 +135,8 @@ func TestCollectMarkdownFiles_HardcodedExclusions(t *testing.T) {
 	}
 }
 
-// TestCollectMarkdownFiles_SortedOutput tests that files are returned sorted
-func TestCollectMarkdownFiles_SortedOutput(t *testing.T) {
+// TestCollect_SortedOutput tests that files are returned sorted
+func TestCollect_SortedOutput(t *testing.T) {
 	testDir := t.TempDir()
 
 	// Create files in random order
@@ -273,7 +145,7 @@ func TestCollectMarkdownFiles_SortedOutput(t *testing.T) {
 		os.WriteFile(filepath.Join(testDir, f), []byte("# Test"), 0644)
 	}
 
-	result := collectMarkdownFiles(testDir)
+	result := Collect(testDir, nil)
 
 	if len(result) != 3 {
 		t.Fatalf("expected 3 files, got %d", len(result))
@@ -288,8 +160,8 @@ func TestCollectMarkdownFiles_SortedOutput(t *testing.T) {
 	}
 }
 
-// TestCollectMarkdownFiles_NestedStructure tests deep directory hierarchies
-func TestCollectMarkdownFiles_NestedStructure(t *testing.T) {
+// TestCollect_NestedStructure tests deep directory hierarchies
+func TestCollect_NestedStructure(t *testing.T) {
 	testDir := t.TempDir()
 
 	// Create nested structure
@@ -299,7 +171,7 @@ func TestCollectMarkdownFiles_NestedStructure(t *testing.T) {
 	os.WriteFile(filepath.Join(testDir, "a", "b", "level2.md"), []byte("# Level2"), 0644)
 	os.WriteFile(filepath.Join(testDir, "a", "b", "c", "level3.md"), []byte("# Level3"), 0644)
 
-	files := collectMarkdownFiles(testDir)
+	files := Collect(testDir, nil)
 
 	if len(files) != 4 {
 		t.Errorf("expected 4 files, got %d: %v", len(files), files)
@@ -328,19 +200,19 @@ func TestCollectMarkdownFiles_NestedStructure(t *testing.T) {
 	}
 }
 
-// TestCollectMarkdownFiles_EmptyDirectory tests empty directory handling
-func TestCollectMarkdownFiles_EmptyDirectory(t *testing.T) {
+// TestCollect_EmptyDirectory tests empty directory handling
+func TestCollect_EmptyDirectory(t *testing.T) {
 	testDir := t.TempDir()
 
-	files := collectMarkdownFiles(testDir)
+	files := Collect(testDir, nil)
 
 	if len(files) != 0 {
 		t.Errorf("expected 0 files in empty directory, got %d", len(files))
 	}
 }
 
-// TestCollectMarkdownFiles_OnlyNonMarkdown tests non-.md files are ignored
-func TestCollectMarkdownFiles_OnlyNonMarkdown(t *testing.T) {
+// TestCollect_OnlyNonMarkdown tests non-.md files are ignored
+func TestCollect_OnlyNonMarkdown(t *testing.T) {
 	testDir := t.TempDir()
 
 	// Create non-markdown files
@@ -348,15 +220,15 @@ func TestCollectMarkdownFiles_OnlyNonMarkdown(t *testing.T) {
 	os.WriteFile(filepath.Join(testDir, "test.html"), []byte("html"), 0644)
 	os.WriteFile(filepath.Join(testDir, "test.go"), []byte("go"), 0644)
 
-	files := collectMarkdownFiles(testDir)
+	files := Collect(testDir, nil)
 
 	if len(files) != 0 {
 		t.Errorf("expected 0 markdown files, got %d: %v", len(files), files)
 	}
 }
 
-// TestCollectMarkdownFiles_CaseInsensitive tests .MD, .md, .Md extensions
-func TestCollectMarkdownFiles_CaseInsensitive(t *testing.T) {
+// TestCollect_CaseInsensitive tests .MD, .md, .Md extensions
+func TestCollect_CaseInsensitive(t *testing.T) {
 	testDir := t.TempDir()
 
 	// Create files with different case extensions
@@ -364,15 +236,15 @@ func TestCollectMarkdownFiles_CaseInsensitive(t *testing.T) {
 	os.WriteFile(filepath.Join(testDir, "upper.MD"), []byte("# Upper"), 0644)
 	os.WriteFile(filepath.Join(testDir, "mixed.Md"), []byte("# Mixed"), 0644)
 
-	files := collectMarkdownFiles(testDir)
+	files := Collect(testDir, nil)
 
 	if len(files) != 3 {
 		t.Errorf("expected 3 files (case insensitive), got %d: %v", len(files), files)
 	}
 }
 
-// TestCollectMarkdownFiles_SymlinkDirectory tests that symlinked directories are followed
-func TestCollectMarkdownFiles_SymlinkDirectory(t *testing.T) {
+// TestCollect_SymlinkDirectory tests that symlinked directories are followed
+func TestCollect_SymlinkDirectory(t *testing.T) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		t.Fatalf("cannot get home directory: %v", err)
@@ -395,7 +267,7 @@ func TestCollectMarkdownFiles_SymlinkDirectory(t *testing.T) {
 	// Symlink directory inside root pointing to target
 	os.Symlink(targetDir, filepath.Join(rootDir, "docs"))
 
-	files := collectMarkdownFiles(rootDir)
+	files := Collect(rootDir, nil)
 
 	if len(files) != 2 {
 		t.Errorf("expected 2 files (root.md + linked.md via symlink dir), got %d: %v", len(files), files)
@@ -409,8 +281,8 @@ func TestCollectMarkdownFiles_SymlinkDirectory(t *testing.T) {
 	}
 }
 
-// TestCollectMarkdownFiles_SymlinkCycle tests that circular symlinks don't cause infinite loops
-func TestCollectMarkdownFiles_SymlinkCycle(t *testing.T) {
+// TestCollect_SymlinkCycle tests that circular symlinks don't cause infinite loops
+func TestCollect_SymlinkCycle(t *testing.T) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		t.Fatalf("cannot get home directory: %v", err)
@@ -425,10 +297,55 @@ func TestCollectMarkdownFiles_SymlinkCycle(t *testing.T) {
 	// Create circular symlink: rootDir/loop -> rootDir
 	os.Symlink(rootDir, filepath.Join(rootDir, "loop"))
 
-	files := collectMarkdownFiles(rootDir)
+	files := Collect(rootDir, nil)
 
 	// Should find file.md exactly once, not infinite copies
 	if len(files) != 1 {
 		t.Errorf("expected 1 file (cycle should be detected), got %d: %v", len(files), files)
 	}
 }
+
+// TestCollect_FilePatterns tests that custom patterns also exclude files
+func TestCollect_FilePatterns(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, f := range []string{"README.md", "CHANGELOG.md", "CHANGELOG-2023.md", "api.generated.md", "docs/guide.md", "docs/schema.generated.md", "generated/kept.md"} {
+		path := filepath.Join(testDir, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("# Test"), 0644)
+	}
+
+	result := Collect(testDir, []string{"CHANGELOG*.md", "*.generated.md"})
+
+	var got []string
+	for _, f := range result {
+		rel, _ := filepath.Rel(testDir, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"README.md", "docs/guide.md", "generated/kept.md"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+// TestCollectEach tests that found sees each collected file once
+func TestCollectEach(t *testing.T) {
+	testDir := t.TempDir()
+
+	for _, f := range []string{"b.md", "a.md", "docs/c.md", "node_modules/x.md", "notes.txt"} {
+		path := filepath.Join(testDir, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("# Test"), 0644)
+	}
+
+	var found []string
+	result, _ := CollectEach(testDir, nil, nil, func(path string) { found = append(found, path) })
+
+	sort.Strings(found)
+	if strings.Join(found, ",") != strings.Join(result, ",") {
+		t.Errorf("found %v, want the collected files %v", found, result)
+	}
+	if len(result) != 3 {
+		t.Errorf("expected 3 files, got %v", result)
+	}
+}
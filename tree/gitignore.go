@@ -0,0 +1,222 @@
+package tree
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// GitignoreFileName is git's per-directory ignore file
+const GitignoreFileName = ".gitignore"
+
+// gitignoreRule is one pattern of a .gitignore file
+type gitignoreRule struct {
+	re      *regexp.Regexp // Matches paths relative to the .gitignore's directory
+	negate  bool           // !pattern re-includes what earlier patterns excluded
+	dirOnly bool           // pattern/ only matches directories
+}
+
+// Gitignore holds the .gitignore files that apply under a root directory:
+// those from the top of its git repository down to it, and those found
+// below it while collecting
+type Gitignore struct {
+	files map[string][]gitignoreRule // Rules by the directory of their .gitignore
+}
+
+// NewGitignore loads the .gitignore files from the top of the git repository
+// holding rootDir (if any) down to rootDir itself. Files below rootDir are
+// loaded as Collect reaches their directories.
+func NewGitignore(rootDir string) *Gitignore {
+	g := &Gitignore{files: make(map[string][]gitignoreRule)}
+
+	dirs := []string{rootDir}
+	for dir := rootDir; !isGitTop(dir); {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			dirs = dirs[:1] // Not in a repository: only rootDir's own rules
+			break
+		}
+		dir = parent
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		g.load(dir)
+	}
+	return g
+}
+
+// isGitTop reports whether dir is the top of a git work tree
+func isGitTop(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git")) // A directory, or a file in worktrees and submodules
+	return err == nil
+}
+
+// load reads the .gitignore in dir, if there is one
+func (g *Gitignore) load(dir string) {
+	if g == nil {
+		return
+	}
+	path := filepath.Join(dir, GitignoreFileName)
+	if _, err := os.Lstat(path); err != nil {
+		return
+	}
+	validatedPath, err := safepath.Resolve(path)
+	if err != nil {
+		return // Outside $HOME or path validation failed
+	}
+	file, err := os.Open(validatedPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var rules []gitignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseGitignoreLine(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) > 0 {
+		g.files[dir] = rules
+	}
+}
+
+// Ignored reports whether git ignores path (a directory when isDir), either
+// itself or through one of its parent directories
+func (g *Gitignore) Ignored(path string, isDir bool) bool {
+	if g == nil || len(g.files) == 0 {
+		return false
+	}
+	// Check from the outermost directory in, as git stops at an ignored one
+	var ancestors []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		ancestors = append(ancestors, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for i := len(ancestors) - 2; i >= 0; i-- {
+		if g.matches(ancestors[i], true) {
+			return true
+		}
+	}
+	return g.matches(path, isDir)
+}
+
+// matches applies the rules of every .gitignore above path to it, leaving
+// out its parent directories; the last matching rule decides, and deeper
+// files come last
+func (g *Gitignore) matches(path string, isDir bool) bool {
+	if g == nil {
+		return false
+	}
+	ignored := false
+	dir := filepath.Dir(path)
+	var chain []string
+	for ; ; dir = filepath.Dir(dir) {
+		if _, ok := g.files[dir]; ok {
+			chain = append(chain, dir)
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(chain[i], path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range g.files[chain[i]] {
+			if (!rule.dirOnly || isDir) && rule.re.MatchString(rel) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// parseGitignoreLine turns one .gitignore line into a rule; ok is false for
+// blank lines and comments
+func parseGitignoreLine(line string) (gitignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false
+	}
+
+	var rule gitignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// A slash at the start or in the middle anchors the pattern to the
+	// .gitignore's directory; otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return gitignoreRule{}, false
+	}
+
+	expr := gitignoreRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return gitignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// gitignoreRegexp translates a gitignore glob to a regular expression
+func gitignoreRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?") // Any number of directories, including none
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			b.WriteString("/.*") // Everything inside
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**") && i+2 == len(pattern):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
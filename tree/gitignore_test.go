@@ -0,0 +1,140 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseGitignoreLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"*.log", "debug.md", false, false},
+		{"/build", "build", true, true},
+		{"/build", "docs/build", true, false},
+		{"docs/build", "docs/build", true, true},
+		{"docs/build", "src/docs/build", true, false},
+		{"drafts/", "drafts", true, true},
+		{"drafts/", "drafts", false, false},
+		{"drafts/", "notes/drafts", true, true},
+		{"**/tmp", "a/b/tmp", true, true},
+		{"**/tmp", "tmp", true, true},
+		{"docs/**/old.md", "docs/old.md", false, true},
+		{"docs/**/old.md", "docs/a/b/old.md", false, true},
+		{"vendor/**", "vendor/x/README.md", false, true},
+		{"vendor/**", "vendor", true, false},
+		{"draft?.md", "draft1.md", false, true},
+		{"draft?.md", "draft10.md", false, false},
+		{"[ab].md", "a.md", false, true},
+		{"[!ab].md", "a.md", false, false},
+		{"[!ab].md", "c.md", false, true},
+		{`\#notes.md`, "#notes.md", false, true},
+		{`\!important.md`, "!important.md", false, true},
+		{"trailing.md   ", "trailing.md", false, true},
+	}
+
+	for _, tt := range tests {
+		rule, ok := parseGitignoreLine(tt.line)
+		if !ok {
+			t.Errorf("parseGitignoreLine(%q) rejected the line", tt.line)
+			continue
+		}
+		got := (!rule.dirOnly || tt.isDir) && rule.re.MatchString(tt.path)
+		if got != tt.want {
+			t.Errorf("%q matching %q (dir %v) = %v, want %v", tt.line, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "/", "!"} {
+		if _, ok := parseGitignoreLine(line); ok {
+			t.Errorf("parseGitignoreLine(%q) should be skipped", line)
+		}
+	}
+}
+
+func TestCollectWithGitignore(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	repo, err := os.MkdirTemp(homeDir, ".peekm-gitignore-test-*")
+	if err != nil {
+		t.Skip("cannot create temp dir under $HOME")
+	}
+	defer os.RemoveAll(repo)
+
+	files := map[string]string{
+		".gitignore":                "# Build output\n/site/\n*.draft.md\ndocs/notes/private/\n",
+		"docs/.gitignore":           "generated/\n!keep.draft.md\nscratch.md\n",
+		"docs/README.md":            "",
+		"docs/intro.draft.md":       "",
+		"docs/keep.draft.md":        "",
+		"docs/scratch.md":           "",
+		"docs/generated/api.md":     "",
+		"docs/guide/scratch.md":     "",
+		"docs/guide/page.md":        "",
+		"docs/guide/.gitignore":     "!scratch.md\n",
+		"docs/notes/private/x.md":   "",
+		"docs/notes/public/y.md":    "",
+		"docs/site/index.md":        "",
+		"site/index.md":             "",
+		"docs/sub/.gitignore":       "*\n!*.md\n",
+		"docs/sub/kept.md":          "",
+		"docs/sub/dropped.markdown": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Browsing a subdirectory still applies the repository's top .gitignore
+	root := filepath.Join(repo, "docs")
+	gitignore := NewGitignore(root)
+	got, _ := CollectWithSettings(root, nil, gitignore)
+	var rel []string
+	for _, f := range got {
+		r, _ := filepath.Rel(root, f)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	want := []string{"README.md", "guide/page.md", "guide/scratch.md", "keep.draft.md", "notes/public/y.md", "site/index.md", "sub/kept.md"}
+	if !reflect.DeepEqual(rel, want) {
+		t.Errorf("files = %v, want %v", rel, want)
+	}
+
+	checks := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{filepath.Join(root, "generated", "new.md"), false, true},
+		{filepath.Join(root, "generated"), true, true},
+		{filepath.Join(root, "notes", "private", "deep", "z.md"), false, true},
+		{filepath.Join(root, "guide", "other.md"), false, false},
+		{filepath.Join(root, "late.draft.md"), false, true},
+	}
+	for _, c := range checks {
+		if got := gitignore.Ignored(c.path, c.isDir); got != c.want {
+			t.Errorf("Ignored(%s) = %v, want %v", c.path, got, c.want)
+		}
+	}
+
+	var none *Gitignore
+	if none.Ignored(filepath.Join(root, "scratch.md"), false) {
+		t.Error("a nil Gitignore should ignore nothing")
+	}
+}
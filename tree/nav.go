@@ -0,0 +1,408 @@
+package tree
+
+import (
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Navigation files read by LoadNav, in order of preference
+var (
+	mkdocsConfigFiles      = []string{"mkdocs.yml", "mkdocs.yaml"}
+	docusaurusSidebarFiles = []string{"sidebars.json", "sidebars.js", "sidebars.ts"}
+)
+
+// sidebarObjectStart finds the sidebar object in a Docusaurus sidebars.js/ts
+// (module.exports = {, export default {, const sidebars: SidebarsConfig = {)
+var sidebarObjectStart = regexp.MustCompile(`(?:=|export\s+default)\s*\{`)
+
+// Nav is a documentation site's declared navigation (the nav of mkdocs.yml or
+// a Docusaurus sidebar). Apply uses it to order and label a tree.
+type Nav struct {
+	Source string // File the navigation was read from, relative to the root
+
+	order  map[string]int    // Tree path (file or directory) to its position in the nav
+	titles map[string]string // Tree path to its label
+
+	pages    []string     // Slash-separated pages in nav order, while parsing
+	sections []navSection // Sections in nav order (outer before inner), while parsing
+}
+
+// navSection is a titled group of pages (an mkdocs section or Docusaurus category)
+type navSection struct {
+	title string
+	pages []string
+}
+
+// LoadNav reads the navigation declared by mkdocs.yml or a Docusaurus sidebar
+// file in rootDir. Returns nil when there is none or it cannot be parsed, so
+// the tree keeps its alphabetical order.
+func LoadNav(rootDir string) *Nav {
+	for _, name := range mkdocsConfigFiles {
+		if data, err := os.ReadFile(filepath.Join(rootDir, name)); err == nil {
+			return parseMkDocsNav(name, data)
+		}
+	}
+	for _, name := range docusaurusSidebarFiles {
+		if data, err := os.ReadFile(filepath.Join(rootDir, name)); err == nil {
+			return parseDocusaurusSidebars(name, data)
+		}
+	}
+	return nil
+}
+
+// newNav creates an empty navigation read from source
+func newNav(source string) *Nav {
+	return &Nav{Source: source, order: make(map[string]int), titles: make(map[string]string)}
+}
+
+// add records a nav entry for a slash-separated path relative to the root.
+// The first mention of a path decides its position and label.
+func (nav *Nav) add(slashPath, title string) {
+	key := filepath.FromSlash(path.Clean(slashPath))
+	if _, found := nav.order[key]; !found {
+		nav.order[key] = len(nav.order)
+	}
+	if _, found := nav.titles[key]; !found && title != "" {
+		nav.titles[key] = title
+	}
+}
+
+// parseMkDocsNav reads the nav of an mkdocs.yml. Entries are "page.md",
+// {Title: page.md} or {Section: [entries]}, relative to docs_dir.
+func parseMkDocsNav(source string, data []byte) *Nav {
+	var config struct {
+		DocsDir string    `yaml:"docs_dir"`
+		Nav     yaml.Node `yaml:"nav"`
+	}
+	// mkdocs.yml often holds !!python tags; only the nav needs to decode
+	if err := yaml.Unmarshal(data, &config); err != nil || config.Nav.Kind != yaml.SequenceNode {
+		return nil
+	}
+	docsDir := config.DocsDir
+	if docsDir == "" {
+		docsDir = "docs"
+	}
+
+	nav := newNav(source)
+	nav.addMkDocsEntries(docsDir, &config.Nav)
+	return nav.finish()
+}
+
+// addMkDocsEntries adds a sequence of mkdocs nav entries and returns the
+// paths of the pages below it
+func (nav *Nav) addMkDocsEntries(docsDir string, entries *yaml.Node) []string {
+	var pages []string
+	for _, entry := range entries.Content {
+		switch {
+		case entry.Kind == yaml.ScalarNode:
+			pages = append(pages, nav.addPage(docsDir, entry.Value, ""))
+		case entry.Kind == yaml.MappingNode && len(entry.Content) == 2:
+			title, value := entry.Content[0].Value, entry.Content[1]
+			if value.Kind == yaml.ScalarNode {
+				pages = append(pages, nav.addPage(docsDir, value.Value, title))
+			} else if value.Kind == yaml.SequenceNode {
+				pages = append(pages, nav.addSection(title, func() []string {
+					return nav.addMkDocsEntries(docsDir, value)
+				})...)
+			}
+		}
+	}
+	return nonEmpty(pages)
+}
+
+// addPage adds a page below docsDir, skipping external links. Returns its
+// slash-separated path ("" for links).
+func (nav *Nav) addPage(docsDir, page, title string) string {
+	if page == "" || strings.Contains(page, "://") {
+		return ""
+	}
+	p := path.Join(docsDir, page)
+	nav.add(p, title)
+	nav.pages = append(nav.pages, p)
+	return p
+}
+
+// addSection records a titled section around the pages added by addPages
+func (nav *Nav) addSection(title string, addPages func() []string) []string {
+	i := len(nav.sections)
+	nav.sections = append(nav.sections, navSection{title: title})
+	pages := addPages()
+	nav.sections[i].pages = pages
+	return pages
+}
+
+// finish titles the directories that sections map onto and returns the nav,
+// or nil when it lists nothing
+func (nav *Nav) finish() *Nav {
+	if len(nav.order) == 0 {
+		return nil
+	}
+	for _, section := range nav.sections {
+		dir := commonDir(section.pages)
+		if dir == "" || dir == "." || section.title == "" {
+			continue
+		}
+		if _, titled := nav.titles[filepath.FromSlash(dir)]; titled {
+			continue // An enclosing section already claimed it
+		}
+		// Only when the directory holds nothing listed outside the section
+		if slices.ContainsFunc(nav.pages, func(p string) bool {
+			return strings.HasPrefix(p, dir+"/") && !slices.Contains(section.pages, p)
+		}) {
+			continue
+		}
+		nav.add(dir, section.title)
+	}
+	nav.pages, nav.sections = nil, nil
+	return nav
+}
+
+// commonDir returns the deepest directory holding every path ("" for none)
+func commonDir(paths []string) string {
+	dir := ""
+	for i, p := range paths {
+		if i == 0 {
+			dir = path.Dir(p)
+			continue
+		}
+		for dir != "." && !strings.HasPrefix(p, dir+"/") {
+			dir = path.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// parseDocusaurusSidebars reads sidebars.json, or the object literal exported
+// by sidebars.js/ts. Sidebars are taken in declaration order; doc IDs are
+// paths below docs/ without the extension.
+func parseDocusaurusSidebars(source string, data []byte) *Nav {
+	text := string(data)
+	if !strings.HasSuffix(source, ".json") {
+		text = stripJSComments(text)
+		loc := sidebarObjectStart.FindStringIndex(text)
+		if loc == nil {
+			return nil
+		}
+		text = text[loc[1]-1:]
+		text = text[:matchingBrace(text)]
+	}
+
+	// A JS object literal with quoted strings is valid YAML flow syntax
+	var sidebars yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &sidebars); err != nil || len(sidebars.Content) == 0 {
+		return nil
+	}
+	root := sidebars.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	nav := newNav(source)
+	for i := 1; i < len(root.Content); i += 2 {
+		nav.addDocusaurusItems(root.Content[i])
+	}
+	return nav.finish()
+}
+
+// addDocusaurusItems adds sidebar items: "doc-id", {type: doc|category|autogenerated, ...}
+// or the {"Label": [items]} category shorthand. Returns the doc paths below it.
+func (nav *Nav) addDocusaurusItems(items *yaml.Node) []string {
+	if items.Kind == yaml.MappingNode && mappingValue(items, "type") == nil {
+		// Shorthand: {"Category": [items], ...}
+		var pages []string
+		for i := 1; i < len(items.Content); i += 2 {
+			pages = append(pages, nav.addSection(items.Content[i-1].Value, func() []string {
+				return nav.addDocusaurusItems(items.Content[i])
+			})...)
+		}
+		return pages
+	}
+	if items.Kind != yaml.SequenceNode {
+		items = &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{items}}
+	}
+
+	var pages []string
+	for _, item := range items.Content {
+		pages = append(pages, nav.addDocusaurusItem(item)...)
+	}
+	return nonEmpty(pages)
+}
+
+// addDocusaurusItem adds one sidebar item and returns the doc paths below it
+func (nav *Nav) addDocusaurusItem(item *yaml.Node) []string {
+	if item.Kind == yaml.ScalarNode {
+		return []string{nav.addPage("docs", item.Value+".md", "")}
+	}
+	if item.Kind != yaml.MappingNode {
+		return nil
+	}
+	label := scalarValue(mappingValue(item, "label"))
+	switch scalarValue(mappingValue(item, "type")) {
+	case "doc":
+		return []string{nav.addPage("docs", scalarValue(mappingValue(item, "id"))+".md", label)}
+	case "category":
+		return nav.addSection(label, func() []string {
+			var pages []string
+			if link := mappingValue(item, "link"); link != nil && scalarValue(mappingValue(link, "type")) == "doc" {
+				pages = append(pages, nav.addPage("docs", scalarValue(mappingValue(link, "id"))+".md", label))
+			}
+			if items := mappingValue(item, "items"); items != nil {
+				pages = append(pages, nav.addDocusaurusItems(items)...)
+			}
+			return pages
+		})
+	case "autogenerated":
+		// Stands for everything in the directory, so a category around it can
+		// title the directory
+		dir := path.Join("docs", scalarValue(mappingValue(item, "dirName")))
+		nav.add(dir, "")
+		return []string{path.Join(dir, "*")}
+	}
+	return nil
+}
+
+// Apply orders every directory of root by the navigation (entries in nav
+// order first, the rest after them in their existing order) and sets the
+// titles of listed files and directories. A nil nav leaves root unchanged.
+func (nav *Nav) Apply(root *Node) {
+	if nav == nil || root == nil {
+		return
+	}
+	nav.apply(root)
+}
+
+// apply orders node's children and returns node's position in the nav: its
+// own, or for directories the first position of anything below it
+func (nav *Nav) apply(node *Node) int {
+	if title, found := nav.titles[node.Path]; found {
+		node.Title = title
+	}
+	rank, listed := nav.order[node.Path]
+	if !listed {
+		rank = math.MaxInt
+	}
+	if !node.IsDir {
+		return rank
+	}
+
+	ranks := make(map[*Node]int, len(node.Children))
+	for _, child := range node.Children {
+		ranks[child] = nav.apply(child)
+		rank = min(rank, ranks[child])
+	}
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		return ranks[node.Children[i]] < ranks[node.Children[j]]
+	})
+	return rank
+}
+
+// mappingValue returns the value for key in a YAML mapping (nil if absent)
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// scalarValue returns a scalar node's value ("" for nil or non-scalars)
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// nonEmpty drops empty paths
+func nonEmpty(paths []string) []string {
+	kept := paths[:0]
+	for _, p := range paths {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// stripJSComments blanks // and /* */ comments outside string literals
+func stripJSComments(src string) string {
+	out := []byte(src)
+	for i := 0; i < len(out); i++ {
+		if isJSQuote(out[i]) {
+			i = jsStringEnd(src, i)
+			continue
+		}
+		if out[i] != '/' || i+1 >= len(out) || (out[i+1] != '/' && out[i+1] != '*') {
+			continue
+		}
+		end := "\n"
+		if out[i+1] == '*' {
+			end = "*/"
+		}
+		stop := len(out)
+		if j := strings.Index(src[i+2:], end); j >= 0 {
+			stop = i + 2 + j
+			if end == "*/" {
+				stop += len(end)
+			}
+		}
+		for ; i < stop; i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+		i--
+	}
+	return string(out)
+}
+
+// matchingBrace returns the length of the braced object text starts with,
+// skipping braces inside string literals (len(text) if unbalanced)
+func matchingBrace(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case isJSQuote(c):
+			i = jsStringEnd(text, i)
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(text)
+}
+
+// isJSQuote reports whether c opens a JS string literal
+func isJSQuote(c byte) bool {
+	return c == '"' || c == '\'' || c == '`'
+}
+
+// jsStringEnd returns the index of the quote closing the string literal that
+// opens at start (len(text) if unterminated)
+func jsStringEnd(text string, start int) int {
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case text[start]:
+			return i
+		}
+	}
+	return len(text)
+}
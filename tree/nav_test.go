@@ -0,0 +1,146 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// navTestTree builds a tree of empty markdown files below a temp directory
+func navTestTree(t *testing.T, config, configBody string, files ...string) (string, *Node) {
+	t.Helper()
+	root := t.TempDir()
+	var paths []string
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	if err := os.WriteFile(filepath.Join(root, config), []byte(configBody), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root, Build(root, paths)
+}
+
+// navOutline lists a tree as "label" lines indented by depth
+func navOutline(node *Node, depth int, b *strings.Builder) string {
+	for _, child := range node.Children {
+		b.WriteString(strings.Repeat("  ", depth) + child.label() + "\n")
+		if child.IsDir {
+			navOutline(child, depth+1, b)
+		}
+	}
+	return b.String()
+}
+
+// TestNavMkDocs tests ordering and labels from an mkdocs.yml nav
+func TestNavMkDocs(t *testing.T) {
+	config := `site_name: Example
+markdown_extensions:
+  - pymdownx.emoji:
+      emoji_generator: !!python/name:material.extensions.emoji.to_svg
+nav:
+  - Home: index.md
+  - User Guide:
+      - guide/writing.md
+      - Styling: guide/styling.md
+      - Advanced:
+          - guide/advanced/plugins.md
+  - About:
+      - License: about/license.md
+      - release-notes.md
+  - GitHub: https://github.com/example/example
+`
+	root, tree := navTestTree(t, "mkdocs.yml", config,
+		"README.md", "docs/about/license.md", "docs/guide/advanced/plugins.md",
+		"docs/guide/styling.md", "docs/guide/writing.md", "docs/index.md", "docs/release-notes.md", "docs/unlisted.md")
+
+	nav := LoadNav(root)
+	if nav == nil || nav.Source != "mkdocs.yml" {
+		t.Fatalf("LoadNav() = %+v, want mkdocs.yml", nav)
+	}
+	nav.Apply(tree)
+
+	want := `docs
+  Home
+  User Guide
+    writing.md
+    Styling
+    Advanced
+      plugins.md
+  about
+    License
+  release-notes.md
+  unlisted.md
+README.md
+`
+	if got := navOutline(tree, 0, &strings.Builder{}); got != want {
+		t.Errorf("outline:\n%s\nwant:\n%s", got, want)
+	}
+	if !strings.Contains(RenderHTML(tree), `<a href="/view/docs%2Findex.md" title="index.md">Home</a>`) {
+		t.Error("titled file link not rendered with its file name as tooltip")
+	}
+}
+
+// TestNavDocusaurus tests ordering and labels from a Docusaurus sidebars.js
+func TestNavDocusaurus(t *testing.T) {
+	config := `// @ts-check
+/** @type {import('@docusaurus/plugin-content-docs').SidebarsConfig} */
+const sidebars = {
+  tutorialSidebar: [
+    'intro', // Start here
+    {
+      type: 'category',
+      label: 'Tutorial - Basics',
+      link: {type: 'doc', id: 'tutorial-basics/index'},
+      items: ['tutorial-basics/create-a-page', {type: 'doc', id: 'tutorial-basics/deploy', label: 'Deploy it'}],
+    },
+    {type: 'link', label: 'Blog', href: 'https://example.com/blog'},
+  ],
+  apiSidebar: {
+    'API Reference': ['api/endpoints', 'api/auth'],
+  },
+};
+
+module.exports = sidebars;
+`
+	root, tree := navTestTree(t, "sidebars.js", config,
+		"docs/api/auth.md", "docs/api/endpoints.md", "docs/intro.md",
+		"docs/tutorial-basics/create-a-page.md", "docs/tutorial-basics/deploy.md", "docs/tutorial-basics/index.md")
+
+	LoadNav(root).Apply(tree)
+	want := `docs
+  intro.md
+  Tutorial - Basics
+    Tutorial - Basics
+    create-a-page.md
+    Deploy it
+  API Reference
+    endpoints.md
+    auth.md
+`
+	if got := navOutline(tree, 0, &strings.Builder{}); got != want {
+		t.Errorf("outline:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestNavAbsent tests that a missing or broken nav keeps the alphabetical tree
+func TestNavAbsent(t *testing.T) {
+	root, tree := navTestTree(t, "mkdocs.yml", "nav: [unclosed", "b.md", "a.md")
+	if nav := LoadNav(root); nav != nil {
+		t.Fatalf("LoadNav() = %+v for a broken mkdocs.yml, want nil", nav)
+	}
+	LoadNav(root).Apply(tree)
+	if got := navOutline(tree, 0, &strings.Builder{}); got != "a.md\nb.md\n" {
+		t.Errorf("outline = %q, want alphabetical", got)
+	}
+	if nav := LoadNav(t.TempDir()); nav != nil {
+		t.Errorf("LoadNav() = %+v without a config, want nil", nav)
+	}
+}
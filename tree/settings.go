@@ -0,0 +1,299 @@
+package tree
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// SettingsFileName is the per-directory settings file. Its settings apply to
+// the directory's subtree, over those of .peekm.toml files further up.
+const SettingsFileName = ".peekm.toml"
+
+// maxSettingsSize bounds how much of a .peekm.toml is read
+const maxSettingsSize = 64 * 1024
+
+// DefaultExtensions are the markdown file extensions without a .peekm.toml
+var DefaultExtensions = []string{".md"}
+
+// Settings are the effective settings of a directory
+type Settings struct {
+	File       string   // The .peekm.toml they come from ("" when none applies)
+	Exclude    []string // Directory and file name patterns skipped, on top of .peekmignore (accumulated from every level)
+	Default    string   // File shown when the directory itself is browsed (absolute; not inherited)
+	Extensions []string // Lowercase file extensions treated as markdown
+	ReadOnly   bool     // Files may not be edited, created or deleted
+}
+
+// IsMarkdown reports whether name has one of the markdown extensions
+func (s Settings) IsMarkdown(name string) bool {
+	extensions := s.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	lower := strings.ToLower(name)
+	for _, ext := range extensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Excludes reports whether a subdirectory or file called name is skipped
+func (s Settings) Excludes(name string) bool {
+	return len(s.Exclude) > 0 && MatchesIgnorePattern(name, s.Exclude)
+}
+
+// DirSettings maps the directories holding a .peekm.toml to their effective
+// settings
+type DirSettings map[string]Settings
+
+// For returns the settings that apply to path (a file or directory): those of
+// the nearest directory at or above it with a .peekm.toml
+func (d DirSettings) For(path string) Settings {
+	if len(d) == 0 {
+		return Settings{Extensions: DefaultExtensions}
+	}
+	for dir := path; ; {
+		if s, ok := d[dir]; ok {
+			return s
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return Settings{Extensions: DefaultExtensions}
+		}
+		dir = parent
+	}
+}
+
+// load records the settings of dir: inherited from its parent, overridden by
+// dir's own .peekm.toml. It returns them.
+func (d DirSettings) load(dir string) Settings {
+	inherited := d.For(filepath.Dir(dir))
+	file := ParseSettingsFile(dir)
+	if file == nil {
+		return inherited
+	}
+
+	s := Settings{
+		File:       filepath.Join(dir, SettingsFileName),
+		Exclude:    append(append([]string(nil), inherited.Exclude...), file.Exclude...),
+		Extensions: inherited.Extensions,
+		ReadOnly:   inherited.ReadOnly,
+	}
+	if file.Default != "" {
+		s.Default = filepath.Join(dir, filepath.FromSlash(file.Default))
+	}
+	if file.Extensions != nil {
+		s.Extensions = file.Extensions
+	}
+	if file.ReadOnly != nil {
+		s.ReadOnly = *file.ReadOnly
+	}
+	d[dir] = s
+	return s
+}
+
+// SettingsFile is the content of one .peekm.toml
+type SettingsFile struct {
+	Exclude    []string // exclude = ["drafts", "*.bak"]
+	Default    string   // default = "OVERVIEW.md"
+	Extensions []string // extensions = [".md", ".markdown"] (nil when not set)
+	ReadOnly   *bool    // readonly = true (nil when not set)
+}
+
+// ParseSettingsFile reads the .peekm.toml in dir. Returns nil when the file is
+// missing, unreadable, invalid, or outside $HOME.
+func ParseSettingsFile(dir string) *SettingsFile {
+	path := filepath.Join(dir, SettingsFileName)
+	if _, err := os.Lstat(path); err != nil {
+		return nil // Most directories have none
+	}
+	validatedPath, err := safepath.Resolve(path)
+	if err != nil {
+		return nil // Missing, outside $HOME or path validation failed
+	}
+	info, err := os.Stat(validatedPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	if info.Size() > maxSettingsSize {
+		log.Printf("Warning: %s is larger than %d KB (ignored)", validatedPath, maxSettingsSize/1024)
+		return nil
+	}
+	data, err := os.ReadFile(validatedPath)
+	if err != nil {
+		return nil
+	}
+	file, err := ParseSettings(string(data))
+	if err != nil {
+		log.Printf("Warning: Invalid %s (ignored): %v", validatedPath, err)
+		return nil
+	}
+	return file
+}
+
+// ParseSettings parses .peekm.toml content: the subset of TOML its keys need
+// (strings, booleans and arrays of strings, which may span lines)
+func ParseSettings(content string) (*SettingsFile, error) {
+	file := &SettingsFile{}
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		// Arrays may continue over the following lines until their ]
+		for strings.HasPrefix(value, "[") && !strings.HasSuffix(value, "]") && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+		if err := file.set(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	return file, nil
+}
+
+// set assigns one key of a .peekm.toml
+func (f *SettingsFile) set(key, value string) error {
+	var err error
+	switch key {
+	case "exclude":
+		if f.Exclude, err = parseStringArray(value); err != nil {
+			return err
+		}
+		return checkExcludePatterns(f.Exclude)
+	case "default":
+		if f.Default, err = parseString(value); err != nil {
+			return err
+		}
+		if !filepath.IsLocal(filepath.FromSlash(f.Default)) {
+			return fmt.Errorf("default %q must be a path inside the directory", f.Default)
+		}
+	case "extensions":
+		if f.Extensions, err = parseStringArray(value); err != nil {
+			return err
+		}
+		return normalizeExtensions(f.Extensions)
+	case "readonly":
+		if value != "true" && value != "false" {
+			return fmt.Errorf("readonly must be true or false, not %s", value)
+		}
+		readOnly := value == "true"
+		f.ReadOnly = &readOnly
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
+
+// checkExcludePatterns validates exclude patterns as .peekmignore does:
+// directory names or wildcards, without path separators
+func checkExcludePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, "test"); err != nil || strings.ContainsAny(pattern, `/\`) {
+			return fmt.Errorf("invalid exclude pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// normalizeExtensions lowercases extensions in place, checking each starts
+// with a dot
+func normalizeExtensions(extensions []string) error {
+	for i, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			return fmt.Errorf("extension %q must start with a dot", ext)
+		}
+		extensions[i] = strings.ToLower(ext)
+	}
+	return nil
+}
+
+// parseString parses a TOML basic ("...") or literal ('...') string
+func parseString(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1], nil
+	}
+	if len(value) >= 2 && value[0] == '"' {
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("expected a quoted string, not %s", value)
+}
+
+// parseStringArray parses a TOML array of strings, allowing a trailing comma
+func parseStringArray(value string) ([]string, error) {
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return nil, fmt.Errorf("expected an array, not %s", value)
+	}
+	values := []string{}
+	for _, item := range splitArray(value[1 : len(value)-1]) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		s, err := parseString(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, s)
+	}
+	return values, nil
+}
+
+// splitArray splits array items at the commas outside quotes
+func splitArray(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == '"' && c == '\\':
+			i++ // Skip the escaped character
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// stripComment removes a # comment from a line, leaving # inside strings
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
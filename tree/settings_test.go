@@ -0,0 +1,126 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSettings(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name    string
+		content string
+		want    *SettingsFile
+		wantErr string
+	}{
+		{"empty", "# nothing here\n", &SettingsFile{}, ""},
+		{
+			"all keys",
+			"exclude = [\"drafts\", 'archive-*']\ndefault = \"guides/OVERVIEW.md\" # shown first\nextensions = [\".md\", \".MDX\"]\nreadonly = true\n",
+			&SettingsFile{Exclude: []string{"drafts", "archive-*"}, Default: "guides/OVERVIEW.md", Extensions: []string{".md", ".mdx"}, ReadOnly: &yes},
+			"",
+		},
+		{
+			"multi-line array",
+			"exclude = [\n  \"drafts\",  # WIP\n  \"tmp#1\",\n]\nreadonly = false\n",
+			&SettingsFile{Exclude: []string{"drafts", "tmp#1"}, ReadOnly: &no},
+			"",
+		},
+		{"empty array", "extensions = []\n", &SettingsFile{Extensions: []string{}}, ""},
+		{"unknown key", "theme = \"dark\"\n", nil, `line 1: unknown key "theme"`},
+		{"not key value", "\n[section]\n", nil, "line 2: expected key = value"},
+		{"bad bool", "readonly = yes\n", nil, "readonly must be true or false"},
+		{"unquoted string", "default = README.md\n", nil, "expected a quoted string"},
+		{"default outside", "default = \"../other/README.md\"\n", nil, "must be a path inside the directory"},
+		{"pattern with separator", "exclude = [\"docs/drafts\"]\n", nil, "invalid exclude pattern"},
+		{"extension without dot", "extensions = [\"md\"]\n", nil, "must start with a dot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSettings(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSettings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCollectWithSettings tests that .peekm.toml files apply to their subtree
+func TestCollectWithSettings(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	root, err := os.MkdirTemp(homeDir, ".peekm-settings-test-*")
+	if err != nil {
+		t.Skip("cannot create temp dir under $HOME")
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"README.md":                      "",
+		"notes.markdown":                 "",
+		"teams/a/.peekm.toml":            "exclude = [\"drafts\"]\nextensions = [\".md\", \".markdown\"]\ndefault = \"OVERVIEW.md\"\nreadonly = true\n",
+		"teams/a/OVERVIEW.md":            "",
+		"teams/a/notes.markdown":         "",
+		"teams/a/drafts/wip.md":          "",
+		"teams/a/open/.peekm.toml":       "readonly = false\n",
+		"teams/a/open/page.md":           "",
+		"teams/a/open/drafts/skipped.md": "",
+		"teams/b/drafts/kept.md":         "",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, settings := CollectWithSettings(root, nil, nil)
+	var rel []string
+	for _, f := range got {
+		r, _ := filepath.Rel(root, f)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	want := []string{"README.md", "teams/a/OVERVIEW.md", "teams/a/notes.markdown", "teams/a/open/page.md", "teams/b/drafts/kept.md"}
+	if !reflect.DeepEqual(rel, want) {
+		t.Errorf("files = %v, want %v", rel, want)
+	}
+
+	teamA := filepath.Join(root, "teams", "a")
+	checks := []struct {
+		path        string
+		readOnly    bool
+		defaultFile string
+	}{
+		{filepath.Join(root, "README.md"), false, ""},
+		{filepath.Join(teamA, "OVERVIEW.md"), true, filepath.Join(teamA, "OVERVIEW.md")},
+		{filepath.Join(teamA, "new", "page.md"), true, filepath.Join(teamA, "OVERVIEW.md")},
+		{filepath.Join(teamA, "open", "page.md"), false, ""},
+	}
+	for _, c := range checks {
+		s := settings.For(c.path)
+		if s.ReadOnly != c.readOnly || s.Default != c.defaultFile {
+			t.Errorf("For(%s) = readonly %v, default %q; want %v, %q", c.path, s.ReadOnly, s.Default, c.readOnly, c.defaultFile)
+		}
+	}
+	if !settings.For(filepath.Join(teamA, "open")).IsMarkdown("x.markdown") {
+		t.Error("extensions are not inherited by subdirectories")
+	}
+}
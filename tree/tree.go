@@ -0,0 +1,375 @@
+// Package tree builds the markdown file tree shown in peekm's sidebar and
+// returned by its JSON API.
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/razvandimescu/peekm/i18n"
+)
+
+// Node is a directory or markdown file in the tree. Paths are relative to the
+// root directory passed to Build.
+type Node struct {
+	Name     string
+	Title    string // Label from the site navigation (see Nav), shown instead of Name
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	IsDir    bool
+	Children []*Node
+
+	// File details set by the caller, shown when the sidebar's details column is on
+	Words   int    // Word count (0 when not counted)
+	Session string // AI session that last modified the file ("" for none)
+	Agent   string // Agent of that session (e.g. "claude-code")
+
+	keep bool // Directory kept by Clean even when empty (see BuildWithDirs)
+}
+
+// NodeJSON is the JSON form of a Node in the JSON API (/api/tree)
+type NodeJSON struct {
+	Name     string     `json:"name"`
+	Title    string     `json:"title,omitempty"`
+	Path     string     `json:"path"` // Slash-separated
+	IsDir    bool       `json:"is_dir"`
+	Size     int64      `json:"size,omitempty"`
+	ModTime  *time.Time `json:"mtime,omitempty"`
+	Words    int        `json:"words,omitempty"`
+	Session  string     `json:"session,omitempty"`
+	Agent    string     `json:"agent,omitempty"`
+	Children []*Node    `json:"children,omitempty"`
+}
+
+// MarshalJSON exposes the tree to the JSON API as NodeJSON
+func (n *Node) MarshalJSON() ([]byte, error) {
+	out := NodeJSON{
+		Name:     n.Name,
+		Title:    n.Title,
+		Path:     filepath.ToSlash(n.Path),
+		IsDir:    n.IsDir,
+		Size:     n.Size,
+		Words:    n.Words,
+		Session:  n.Session,
+		Agent:    n.Agent,
+		Children: n.Children,
+	}
+	if !n.ModTime.IsZero() {
+		out.ModTime = &n.ModTime
+	}
+	return json.Marshal(out)
+}
+
+// Build builds the cleaned, sorted tree of files relative to rootDir.
+// Files that no longer exist are skipped. Returns nil when files is empty.
+func Build(rootDir string, files []string) *Node {
+	return BuildWithDirs(rootDir, files, nil)
+}
+
+// BuildWithDirs is Build plus directories that are shown even without markdown
+// files (e.g. folders just created from the UI). Directories outside rootDir or
+// no longer on disk are skipped. Returns nil when files and dirs are both empty.
+func BuildWithDirs(rootDir string, files, dirs []string) *Node {
+	if len(files) == 0 && len(dirs) == 0 {
+		return nil
+	}
+
+	// Make root directory absolute for proper relative path calculation
+	absDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		absDir = rootDir
+	}
+
+	root := &Node{Name: ".", IsDir: true}
+	dirNodes := make(map[string]*Node)
+	dirNodes["."] = root
+
+	// Build directory structure
+	for _, path := range files {
+		addFile(root, dirNodes, absDir, path)
+	}
+
+	// Add directories kept even when empty
+	for _, dir := range dirs {
+		relPath, err := filepath.Rel(absDir, dir)
+		if err != nil || !filepath.IsLocal(relPath) {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		ensureDir(root, dirNodes, relPath).keep = true
+	}
+
+	// Clean and sort tree
+	Clean(root)
+	Sort(root)
+	return root
+}
+
+// addFile adds a file node (and its parent directories) below root
+func addFile(root *Node, dirNodes map[string]*Node, absDir, path string) {
+	// Make file path absolute first
+	absPath := path
+	if !filepath.IsAbs(path) {
+		absPath, _ = filepath.Abs(path)
+	}
+
+	// Make path relative to root directory
+	relPath, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		relPath = filepath.Base(path)
+	}
+
+	parent := root
+	if dir := filepath.Dir(relPath); dir != "." {
+		parent = ensureDir(root, dirNodes, dir)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		// Skip files that no longer exist (e.g., after navigation to different directory)
+		return
+	}
+	parent.Children = append(parent.Children, &Node{
+		Name:    filepath.Base(relPath),
+		Path:    relPath, // Use relative path for the link (security & clean URLs)
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	})
+}
+
+// ensureDir returns the directory node for relPath, creating it and any missing parents
+func ensureDir(root *Node, dirNodes map[string]*Node, relPath string) *Node {
+	if node, ok := dirNodes[relPath]; ok {
+		return node
+	}
+	parent := root
+	if dir := filepath.Dir(relPath); dir != "." {
+		parent = ensureDir(root, dirNodes, dir)
+	}
+	node := &Node{Name: filepath.Base(relPath), Path: relPath, IsDir: true}
+	dirNodes[relPath] = node
+	parent.Children = append(parent.Children, node)
+	return node
+}
+
+// Clean removes directories without files. Returns false if node should be dropped.
+func Clean(node *Node) bool {
+	if !node.IsDir {
+		return true // Keep files
+	}
+
+	// Recursively clean children
+	kept := make([]*Node, 0)
+	for _, child := range node.Children {
+		if Clean(child) {
+			kept = append(kept, child)
+		}
+	}
+	node.Children = kept
+
+	// Keep directory if it has children, is root, or was explicitly requested
+	return len(node.Children) > 0 || node.Name == "." || node.keep
+}
+
+// Sort orders children: directories first, then files, alphabetically within each group
+func Sort(node *Node) {
+	if !node.IsDir {
+		return
+	}
+
+	sort.Slice(node.Children, func(i, j int) bool {
+		if node.Children[i].IsDir != node.Children[j].IsDir {
+			return node.Children[i].IsDir
+		}
+		return node.Children[i].Name < node.Children[j].Name
+	})
+
+	// Recursively sort children
+	for _, child := range node.Children {
+		Sort(child)
+	}
+}
+
+// RenderHTML renders the sidebar markup for a tree built by Build, with its
+// UI strings in English. File links point at /view/<path>. Returns "" for a
+// nil tree.
+func RenderHTML(root *Node) string {
+	return RenderHTMLExpanded(root, nil, nil)
+}
+
+// RenderHTMLExpanded is RenderHTML with the directories whose paths are in
+// expanded open and every other one collapsed, and the UI strings translated
+// by messages. A nil expanded keeps the default: top-level directories open,
+// deeper ones collapsed.
+func RenderHTMLExpanded(root *Node, expanded map[string]bool, messages *i18n.Catalog) string {
+	if root == nil {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	renderHTML(root, true, 0, expanded, messages, &buf)
+	return buf.String()
+}
+
+// RenderSubtreeHTML renders the children of the directory at relPath ("." for
+// the root) as they appear in RenderHTMLExpanded. Returns "" if the directory is not in the tree.
+func RenderSubtreeHTML(root *Node, relPath string, messages *i18n.Catalog) string {
+	node, depth := find(root, filepath.Clean(relPath))
+	if node == nil || !node.IsDir {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	for _, child := range node.Children {
+		renderHTML(child, false, depth, nil, messages, &buf)
+	}
+	return buf.String()
+}
+
+// find returns the node at relPath and the depth its children render at
+func find(root *Node, relPath string) (*Node, int) {
+	if root == nil || relPath == "." {
+		return root, 0
+	}
+	node := root
+	parts := strings.Split(relPath, string(filepath.Separator))
+	for _, part := range parts {
+		var next *Node
+		for _, child := range node.Children {
+			if child.IsDir && child.Name == part {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil, 0
+		}
+		node = next
+	}
+	return node, len(parts)
+}
+
+// label is the name shown for a node: its nav title, or its file name
+func (n *Node) label() string {
+	if n.Title != "" {
+		return n.Title
+	}
+	return n.Name
+}
+
+// Walk calls fn for node and every node below it
+func Walk(node *Node, fn func(*Node)) {
+	if node == nil {
+		return
+	}
+	fn(node)
+	for _, child := range node.Children {
+		Walk(child, fn)
+	}
+}
+
+// fileDataAttrs exposes a file's details to the sidebar script, which shows
+// them in the details column
+func fileDataAttrs(n *Node) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ` data-size="%d"`, n.Size)
+	if !n.ModTime.IsZero() {
+		fmt.Fprintf(&b, ` data-mtime="%s"`, n.ModTime.UTC().Format(time.RFC3339))
+	}
+	if n.Words > 0 {
+		fmt.Fprintf(&b, ` data-words="%d"`, n.Words)
+	}
+	if n.Session != "" {
+		fmt.Fprintf(&b, ` data-session="%s" data-agent="%s"`, template.HTMLEscapeString(n.Session), template.HTMLEscapeString(n.Agent))
+	}
+	return b.String()
+}
+
+// sessionBadge marks a file an AI session modified
+func sessionBadge(n *Node, messages *i18n.Catalog) string {
+	if n.Session == "" {
+		return ""
+	}
+	agent := n.Agent
+	if agent == "" {
+		agent = messages.T("AI")
+	}
+	return fmt.Sprintf(`<span class="tree-session-badge" title="%s">%s</span>`,
+		template.HTMLEscapeString(messages.T("Modified by %s session %s", agent, n.Session)), template.HTMLEscapeString(messages.T("AI")))
+}
+
+// titleAttr keeps the file name visible as a tooltip when a nav title replaces it
+func titleAttr(n *Node) string {
+	if n.Title == "" {
+		return ""
+	}
+	return fmt.Sprintf(` title="%s"`, template.HTMLEscapeString(n.Name))
+}
+
+func renderHTML(node *Node, isRoot bool, depth int, expanded map[string]bool, messages *i18n.Catalog, buf *bytes.Buffer) {
+	if isRoot {
+		// Root node - just render children
+		for _, child := range node.Children {
+			renderHTML(child, false, depth, expanded, messages, buf)
+		}
+		return
+	}
+
+	// Start tree item container
+	buf.WriteString(`<div class="tree-item">`)
+
+	if node.IsDir {
+		// Collapse directories at depth >= 1 by default
+		collapsed := depth >= 1
+		if expanded != nil {
+			collapsed = !expanded[node.Path]
+		}
+
+		// Directory node with chevron and name
+		buf.WriteString(fmt.Sprintf(`<div class="tree-node"><span class="tree-directory" onclick="toggleDir(this)" data-path="%s">`,
+			template.HTMLEscapeString(node.Path)))
+
+		// Chevron icon
+		if collapsed {
+			buf.WriteString(`<span class="expand-icon">▶</span>`)
+		} else {
+			buf.WriteString(`<span class="expand-icon">▼</span>`)
+		}
+
+		buf.WriteString(fmt.Sprintf(`<span class="dir-name">%s</span></span></div>`, template.HTMLEscapeString(node.label())))
+
+		// Children container (collapsed by default at depth >= 1)
+		if len(node.Children) > 0 {
+			if collapsed {
+				buf.WriteString(`<div class="tree-children" style="display: none;">`)
+			} else {
+				buf.WriteString(`<div class="tree-children">`)
+			}
+
+			// Render children recursively
+			for _, child := range node.Children {
+				renderHTML(child, false, depth+1, expanded, messages, buf)
+			}
+
+			buf.WriteString(`</div>`) // Close tree-children
+		}
+	} else {
+		// File node (leaf)
+		buf.WriteString(fmt.Sprintf(`<div class="tree-node"><span class="tree-file"%s>`, fileDataAttrs(node)))
+		buf.WriteString(fmt.Sprintf(`<a href="/view/%s"%s>%s</a>`, template.URLQueryEscaper(node.Path), titleAttr(node), template.HTMLEscapeString(node.label())))
+		buf.WriteString(sessionBadge(node, messages))
+		buf.WriteString(`<span class="tree-meta"></span></span></div>`)
+	}
+
+	buf.WriteString(`</div>`) // Close tree-item
+}
@@ -0,0 +1,136 @@
+package tree
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/razvandimescu/peekm/i18n"
+)
+
+// TestNodeMarshalJSON tests the nested JSON shape used by /api/tree
+func TestNodeMarshalJSON(t *testing.T) {
+	root := &Node{Name: ".", IsDir: true, Children: []*Node{
+		{Name: "docs", Path: "docs", IsDir: true, Children: []*Node{
+			{Name: "a.md", Path: "docs/a.md", Size: 42},
+		}},
+	}}
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+
+	want := `{"name":".","path":"","is_dir":true,"children":[{"name":"docs","path":"docs","is_dir":true,"children":[{"name":"a.md","path":"docs/a.md","is_dir":false,"size":42}]}]}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
+
+// TestBuildWithDirs tests that requested empty directories survive Clean and render as subtrees
+func TestBuildWithDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"docs/new", "empty", "docs/unlisted"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(root, "docs", "a.md")
+	if err := os.WriteFile(file, []byte("# A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := []string{filepath.Join(root, "docs", "new"), filepath.Join(root, "empty"), filepath.Join(root, "missing"), filepath.Dir(root)}
+	tree := BuildWithDirs(root, []string{file}, dirs)
+
+	var names []string
+	for _, child := range tree.Children {
+		names = append(names, child.Name)
+	}
+	if strings.Join(names, ",") != "docs,empty" {
+		t.Errorf("root children = %v, want [docs empty]", names)
+	}
+
+	docs := RenderSubtreeHTML(tree, "docs", nil)
+	if !strings.Contains(docs, `data-path="docs/new"`) || strings.Contains(docs, "unlisted") || !strings.Contains(docs, "/view/docs%2Fa.md") {
+		t.Errorf("docs subtree = %s", docs)
+	}
+	if RenderSubtreeHTML(tree, "nope", nil) != "" {
+		t.Error("missing directory should render nothing")
+	}
+	if Build(root, nil) != nil {
+		t.Error("Build with no files should return nil")
+	}
+}
+
+// TestRenderHTMLFileDetails tests the data attributes and session badge of file nodes
+func TestRenderHTMLFileDetails(t *testing.T) {
+	modTime := time.Date(2026, 10, 16, 9, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	root := &Node{Name: ".", IsDir: true, Children: []*Node{
+		{Name: "a.md", Path: "a.md", Size: 1200, ModTime: modTime, Words: 180, Session: `s"1`, Agent: "claude-code"},
+		{Name: "b.md", Path: "b.md", Size: 10},
+	}}
+
+	html := RenderHTML(root)
+	for _, want := range []string{
+		`<span class="tree-file" data-size="1200" data-mtime="2026-10-16T07:30:00Z" data-words="180" data-session="s&#34;1" data-agent="claude-code">`,
+		`<span class="tree-session-badge" title="Modified by claude-code session s&#34;1">AI</span><span class="tree-meta"></span>`,
+		`<span class="tree-file" data-size="10"><a href="/view/b.md">b.md</a><span class="tree-meta"></span>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("RenderHTML() = %s\nmissing %s", html, want)
+		}
+	}
+
+	var files int
+	Walk(root, func(n *Node) {
+		if !n.IsDir {
+			files++
+		}
+	})
+	if files != 2 {
+		t.Errorf("Walk visited %d files, want 2", files)
+	}
+
+	german, err := i18n.Parse("de", []byte(`{"AI": "KI", "Modified by %s session %s": "Von %s geändert (Sitzung %s)"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<span class="tree-session-badge" title="Von claude-code geändert (Sitzung s&#34;1)">KI</span>`
+	if html := RenderHTMLExpanded(root, nil, german); !strings.Contains(html, want) {
+		t.Errorf("RenderHTMLExpanded() in German = %s\nmissing %s", html, want)
+	}
+}
+
+// TestRenderHTMLExpanded tests that a saved expansion state replaces the default one
+func TestRenderHTMLExpanded(t *testing.T) {
+	root := &Node{Name: ".", IsDir: true, Children: []*Node{
+		{Name: "docs", Path: "docs", IsDir: true, Children: []*Node{
+			{Name: "api", Path: "docs/api", IsDir: true, Children: []*Node{{Name: "a.md", Path: "docs/api/a.md"}}},
+			{Name: "b.md", Path: "docs/b.md"},
+		}},
+	}}
+	open := func(html, path string) bool {
+		i := strings.Index(html, `data-path="`+path+`"`)
+		return i >= 0 && strings.HasPrefix(html[i+len(path)+13:], `<span class="expand-icon">▼</span>`)
+	}
+
+	tests := []struct {
+		expanded          map[string]bool
+		wantDocs, wantAPI bool
+	}{
+		{nil, true, false}, // Default: top level open
+		{map[string]bool{}, false, false},
+		{map[string]bool{"docs": true, "docs/api": true}, true, true},
+		{map[string]bool{"docs/api": true, "gone": true}, false, true},
+	}
+	for _, tt := range tests {
+		html := RenderHTMLExpanded(root, tt.expanded, nil)
+		if open(html, "docs") != tt.wantDocs || open(html, "docs/api") != tt.wantAPI {
+			t.Errorf("RenderHTMLExpanded(%v): docs open %v, docs/api open %v; want %v, %v", tt.expanded, open(html, "docs"), open(html, "docs/api"), tt.wantDocs, tt.wantAPI)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// treeFilter limits the file tree to files modified by AI sessions
+// (?session=<id> and/or ?since=<duration|RFC 3339 time> on /tree-html and
+// /api/tree) and to files whose paths match a query (?filter=)
+type treeFilter struct {
+	Session string    // Only files modified by this session ("" = any session)
+	Since   time.Time // Only modifications at or after this time (zero = any time)
+	Query   string    // Only files whose paths match every word ("" = any file)
+}
+
+// active reports whether the filter restricts the tree
+func (f treeFilter) active() bool {
+	return f.bySession() || f.Query != ""
+}
+
+// bySession reports whether the filter keeps only files modified by AI sessions
+func (f treeFilter) bySession() bool {
+	return f.Session != "" || !f.Since.IsZero()
+}
+
+// parseTreeFilter reads the session, since and filter query parameters
+func parseTreeFilter(r *http.Request) (treeFilter, error) {
+	filter := treeFilter{
+		Session: r.URL.Query().Get("session"),
+		Query:   strings.TrimSpace(r.URL.Query().Get("filter")),
+	}
+
+	if since := r.URL.Query().Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil && d > 0 {
+			filter.Since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.Since = t
+		} else {
+			return treeFilter{}, fmt.Errorf("invalid since %q (use a duration like 30m or an RFC 3339 time)", since)
+		}
+	}
+	return filter, nil
+}
+
+// apply returns the files in files that match the filter, matching the query
+// against their paths relative to rootDir
+func (f treeFilter) apply(rootDir string, files []string) []string {
+	if !f.active() {
+		return files
+	}
+	var touched map[string]bool
+	if f.bySession() {
+		if globalSessionStore == nil {
+			return nil
+		}
+		touched = globalSessionStore.touchedFiles(f.Session, f.Since)
+	}
+	words := strings.Fields(strings.ToLower(f.Query))
+
+	var matched []string
+	for _, path := range files {
+		if touched != nil && !touched[path] {
+			continue
+		}
+		if len(words) > 0 && !matchesTreeQuery(treeFilterPath(rootDir, path), words) {
+			continue
+		}
+		matched = append(matched, path)
+	}
+	return matched
+}
+
+// treeFilterPath returns the lowercased slash-separated path the query is
+// matched against: relative to rootDir, or absolute for files outside it
+func treeFilterPath(rootDir, path string) string {
+	if rel, err := filepath.Rel(rootDir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		path = rel
+	}
+	return strings.ToLower(filepath.ToSlash(path))
+}
+
+// matchesTreeQuery reports whether every (lowercase) word occurs in path,
+// either as a substring or fuzzily, as its letters in order ("rdme" matches
+// "readme.md")
+func matchesTreeQuery(path string, words []string) bool {
+	for _, word := range words {
+		if !strings.Contains(path, word) && !isSubsequence(word, path) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubsequence reports whether the runes of sub appear in s in order
+func isSubsequence(sub, s string) bool {
+	rest := []rune(sub)
+	for _, r := range s {
+		if len(rest) == 0 {
+			break
+		}
+		if r == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
+
+// touchedFiles returns the paths modified (PostToolUse) by sessionID, or by any
+// session when sessionID is empty, at or after since
+func (ss *sessionStore) touchedFiles(sessionID string, since time.Time) map[string]bool {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	touched := make(map[string]bool)
+	for id, events := range ss.events {
+		if sessionID != "" && id != sessionID {
+			continue
+		}
+		for _, evt := range events {
+			if evt.Type == hookPostToolUse && evt.FilePath != "" && !evt.Timestamp.Before(since) {
+				touched[evt.FilePath] = true
+			}
+		}
+	}
+	return touched
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTreeFilter(t *testing.T) {
+	prev := globalSessionStore
+	globalSessionStore = newSessionStore()
+	defer func() { globalSessionStore = prev }()
+
+	now := time.Now()
+	globalSessionStore.recordEvent("s1", sessionEvent{Type: hookPostToolUse, FilePath: "/docs/a.md", Timestamp: now.Add(-2 * time.Hour)})
+	globalSessionStore.recordEvent("s1", sessionEvent{Type: hookPreToolUse, FilePath: "/docs/b.md", Timestamp: now})
+	globalSessionStore.recordEvent("s2", sessionEvent{Type: hookPostToolUse, FilePath: "/docs/c.md", Timestamp: now})
+
+	files := []string{"/docs/a.md", "/docs/b.md", "/docs/c.md", "/docs/d.md", "/docs/guides/Setup-Guide.md", "/plans/c-plan.md"}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", files},
+		{"?session=s1", []string{"/docs/a.md"}},
+		{"?since=1h", []string{"/docs/c.md"}},
+		{"?session=s1&since=1h", nil},
+		{"?since=" + now.Add(-3*time.Hour).Format(time.RFC3339), []string{"/docs/a.md", "/docs/c.md"}},
+		{"?filter=setup", []string{"/docs/guides/Setup-Guide.md"}},        // Case-insensitive
+		{"?filter=gd/sg", []string{"/docs/guides/Setup-Guide.md"}},        // Fuzzy
+		{"?filter=guides+setup", []string{"/docs/guides/Setup-Guide.md"}}, // Every word
+		{"?filter=docs", nil},                               // Relative to the browsed directory
+		{"?filter=plans/c", []string{"/plans/c-plan.md"}},   // Absolute outside it
+		{"?filter=c.md&session=s2", []string{"/docs/c.md"}}, // Combined with a session
+		{"?filter=%20%20", files},                           // Blank
+	}
+
+	for _, tt := range tests {
+		filter, err := parseTreeFilter(httptest.NewRequest("GET", "/api/tree"+tt.query, nil))
+		if err != nil {
+			t.Fatalf("parseTreeFilter(%q): %v", tt.query, err)
+		}
+		if got := filter.apply("/docs", files); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("apply(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if _, err := parseTreeFilter(httptest.NewRequest("GET", "/api/tree?since=yesterday", nil)); err == nil {
+		t.Error("expected an error for an invalid since value")
+	}
+
+	// Name filtering works without AI session tracking
+	globalSessionStore = nil
+	filter := treeFilter{Query: "b"}
+	if got := filter.apply("/docs", files); !reflect.DeepEqual(got, []string{"/docs/b.md"}) {
+		t.Errorf("apply without a session store = %v, want [/docs/b.md]", got)
+	}
+}
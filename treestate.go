@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Limits that keep the tree state store small
+const (
+	maxTreeStateClients  = 50
+	maxTreeStateDirs     = 20   // Browsed directories remembered per client
+	maxTreeStateExpanded = 5000 // Expanded directories remembered per browsed directory
+	maxTreeStateBodySize = 1 << 20
+)
+
+// clientTreeState is the expanded sidebar directories of one browser, per
+// browsed directory
+type clientTreeState struct {
+	expanded map[string][]string // Browsed directory -> expanded relative paths
+	lastSeen time.Time
+}
+
+// treeStateStore remembers which tree directories each browser expanded, so
+// the server renders the sidebar the way it was left and refreshes or SPA
+// navigations don't reset it
+type treeStateStore struct {
+	mu      sync.Mutex
+	clients map[string]*clientTreeState
+}
+
+// globalTreeStateStore holds the tree state of every client
+var globalTreeStateStore = newTreeStateStore()
+
+// newTreeStateStore creates an empty tree state store
+func newTreeStateStore() *treeStateStore {
+	return &treeStateStore{clients: make(map[string]*clientTreeState)}
+}
+
+// apiTreeState is the /api/tree-state payload
+type apiTreeState struct {
+	Expanded []string `json:"expanded"` // Expanded directories, relative to the browsed directory
+}
+
+// set records the directories a client expanded in the tree of browseDir
+func (ts *treeStateStore) set(clientID, browseDir string, expanded []string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	c, found := ts.clients[clientID]
+	if !found {
+		if len(ts.clients) >= maxTreeStateClients {
+			ts.evictOldestLocked()
+		}
+		c = &clientTreeState{expanded: make(map[string][]string)}
+		ts.clients[clientID] = c
+	}
+	c.lastSeen = time.Now()
+
+	if _, known := c.expanded[browseDir]; !known && len(c.expanded) >= maxTreeStateDirs {
+		// Forget another browsed directory; which one matters little
+		for dir := range c.expanded {
+			delete(c.expanded, dir)
+			break
+		}
+	}
+	c.expanded[browseDir] = slices.Clone(expanded)
+}
+
+// get returns the directories a client expanded in the tree of browseDir,
+// and whether it saved any state for it
+func (ts *treeStateStore) get(clientID, browseDir string) ([]string, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	c, found := ts.clients[clientID]
+	if !found {
+		return nil, false
+	}
+	expanded, found := c.expanded[browseDir]
+	if found {
+		c.lastSeen = time.Now()
+	}
+	return slices.Clone(expanded), found
+}
+
+// evictOldestLocked forgets the least recently seen client; ts.mu must be held
+func (ts *treeStateStore) evictOldestLocked() {
+	var oldestID string
+	var oldest time.Time
+	for id, c := range ts.clients {
+		if oldestID == "" || c.lastSeen.Before(oldest) {
+			oldestID, oldest = id, c.lastSeen
+		}
+	}
+	delete(ts.clients, oldestID)
+}
+
+// expandedTreeDirs returns the directories the requesting browser expanded in
+// the current tree, or nil if it saved none (the tree then renders its default)
+func expandedTreeDirs(r *http.Request) map[string]bool {
+	cookie, err := r.Cookie(tabClientCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	fileMutex.RLock()
+	currentBrowseDir := browseDir
+	fileMutex.RUnlock()
+
+	dirs, found := globalTreeStateStore.get(cookie.Value, currentBrowseDir)
+	if !found {
+		return nil
+	}
+	expanded := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		expanded[dir] = true
+	}
+	return expanded
+}
+
+// handleAPITreeState returns (GET) or replaces (PUT {"expanded"}) the
+// directories the calling browser expanded in the current tree
+func handleAPITreeState(w http.ResponseWriter, r *http.Request) {
+	clientID := tabClientID(w, r)
+	if clientID == "" {
+		writeError(w, errCodeInternal, "Cannot identify client", http.StatusInternalServerError)
+		return
+	}
+
+	fileMutex.RLock()
+	currentBrowseDir := browseDir
+	fileMutex.RUnlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req apiTreeState
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTreeStateBodySize)).Decode(&req); err != nil {
+			writeError(w, errCodeBadRequest, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if len(req.Expanded) > maxTreeStateExpanded {
+			writeError(w, errCodeTooLarge, "Too many expanded directories", http.StatusRequestEntityTooLarge)
+			return
+		}
+		globalTreeStateStore.set(clientID, currentBrowseDir, req.Expanded)
+	}
+
+	expanded, _ := globalTreeStateStore.get(clientID, currentBrowseDir)
+	if expanded == nil {
+		expanded = []string{}
+	}
+	writeJSON(w, http.StatusOK, apiTreeState{Expanded: expanded})
+}
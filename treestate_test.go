@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestTreeStateStoreLimits tests that state is kept per browsed directory and old clients are dropped
+func TestTreeStateStoreLimits(t *testing.T) {
+	ts := newTreeStateStore()
+	ts.set("a", "/one", []string{"docs"})
+	ts.set("a", "/two", nil)
+	if got, found := ts.get("a", "/one"); !found || !reflect.DeepEqual(got, []string{"docs"}) {
+		t.Errorf("get(/one) = %v, %v; want [docs], true", got, found)
+	}
+	if got, found := ts.get("a", "/two"); !found || len(got) != 0 {
+		t.Errorf("get(/two) = %v, %v; want nothing expanded, true", got, found)
+	}
+	if _, found := ts.get("a", "/three"); found {
+		t.Error("state found for a directory never saved")
+	}
+
+	for i := 0; i < maxTreeStateDirs+5; i++ {
+		ts.set("a", strings.Repeat("/d", i+1), nil)
+	}
+	if n := len(ts.clients["a"].expanded); n != maxTreeStateDirs {
+		t.Errorf("client keeps %d directories, want %d", n, maxTreeStateDirs)
+	}
+
+	for i := 0; i < maxTreeStateClients; i++ {
+		ts.set(strings.Repeat("c", i+1), "/one", nil)
+	}
+	if _, found := ts.clients["a"]; found || len(ts.clients) != maxTreeStateClients {
+		t.Errorf("oldest client kept or store has %d clients", len(ts.clients))
+	}
+}
+
+// TestTreeStateRendering tests that /tree-html renders the directories a browser saved as expanded
+func TestTreeStateRendering(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "docs", "api", "a.md")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("# A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prevDir, prevFiles, prevStore := browseDir, markdownFiles, globalTreeStateStore
+	browseDir, markdownFiles, globalTreeStateStore = dir, newFileSet([]string{file}), newTreeStateStore()
+	defer func() { browseDir, markdownFiles, globalTreeStateStore = prevDir, prevFiles, prevStore }()
+
+	cookie := &http.Cookie{Name: tabClientCookie, Value: "client-1"}
+	call := func(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		return rec
+	}
+	apiOpen := `data-path="docs/api"><span class="expand-icon">▼</span>`
+	docsOpen := `data-path="docs"><span class="expand-icon">▼</span>`
+
+	if html := call(serveTreeHTML, http.MethodGet, "/tree-html", "").Body.String(); !strings.Contains(html, docsOpen) || strings.Contains(html, apiOpen) {
+		t.Errorf("default tree = %s", html)
+	}
+
+	rec := call(handleAPITreeState, http.MethodPut, "/api/tree-state", `{"expanded": ["docs/api"]}`)
+	var resp apiTreeState
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || len(resp.Expanded) != 1 {
+		t.Fatalf("PUT = %d %s", rec.Code, rec.Body.String())
+	}
+	if html := call(serveTreeHTML, http.MethodGet, "/tree-html", "").Body.String(); strings.Contains(html, docsOpen) || !strings.Contains(html, apiOpen) {
+		t.Errorf("tree with saved state = %s", html)
+	}
+	// Filtered trees keep the default expansion
+	if html := call(serveTreeHTML, http.MethodGet, "/tree-html?filter=a", "").Body.String(); !strings.Contains(html, docsOpen) {
+		t.Errorf("filtered tree = %s", html)
+	}
+
+	if code := call(handleAPITreeState, http.MethodPut, "/api/tree-state", "{").Code; code != http.StatusBadRequest {
+		t.Errorf("PUT invalid JSON = %d, want 400", code)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/razvandimescu/peekm/i18n"
+)
+
+// langDir holds the translation files (<language>.json) in the theme and in
+// theme override directories
+const langDir = "lang"
+
+// uiLanguages are the UI translations loaded with the theme
+var uiLanguages = i18n.NewSet()
+
+// languageFiles lists the translation files of the embedded theme and the
+// override directories, by file name
+func languageFiles(dirs []string) ([]string, error) {
+	entries, err := fs.ReadDir(themeFS, path.Join("theme", langDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		more, err := os.ReadDir(filepath.Join(dir, langDir))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		entries = append(entries, more...)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") && !slices.Contains(names, e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// loadLanguages parses the translation files, each from the first override
+// directory that has it (see readThemeFile)
+func loadLanguages(dirs []string) (*i18n.Set, error) {
+	names, err := languageFiles(dirs)
+	if err != nil {
+		return nil, fmt.Errorf("list translations: %w", err)
+	}
+	var catalogs []*i18n.Catalog
+	for _, name := range names {
+		file := path.Join(langDir, name)
+		data, err := readThemeFile(dirs, file)
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", file, err)
+		}
+		catalog, err := i18n.Parse(strings.TrimSuffix(name, ".json"), data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		catalogs = append(catalogs, catalog)
+	}
+	return i18n.NewSet(catalogs...), nil
+}
+
+// checkUILang warns when --lang names a language without a translation
+func checkUILang() {
+	if *uiLang != "" && uiLanguages.Get(*uiLang) == nil {
+		log.Printf("Warning: No %q translation (available: %s); the UI stays in English", *uiLang, strings.Join(uiLanguages.Languages(), ", "))
+	}
+}
+
+// messagesFor returns the UI strings to answer r with: --lang's, or those
+// of the browser's preferred language (English if nothing matches)
+func messagesFor(r *http.Request) *i18n.Catalog {
+	if *uiLang != "" {
+		return uiLanguages.Get(*uiLang)
+	}
+	return uiLanguages.Negotiate(r.Header.Get("Accept-Language"))
+}
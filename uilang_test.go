@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestEnglishCatalogComplete checks that en.json, the file translators start
+// from, lists every UI string of the templates, their scripts and generated HTML
+func TestEnglishCatalogComplete(t *testing.T) {
+	data, err := themeFS.ReadFile("theme/lang/en.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var english map[string]string
+	if err := json.Unmarshal(data, &english); err != nil {
+		t.Fatalf("en.json: %v", err)
+	}
+
+	templateCall, goCall := regexp.MustCompile(`\.T "((?:[^"\\]|\\.)*)"`), regexp.MustCompile(`\.T\("((?:[^"\\]|\\.)*)"`)
+	scriptCall := regexp.MustCompile(`\bt\('((?:[^'\\]|\\.)*)'`)
+	unescape := strings.NewReplacer(`\'`, "'", `\n`, "\n").Replace // JavaScript string escapes
+	check := func(name string, source []byte, call *regexp.Regexp) {
+		for _, m := range call.FindAllSubmatch(source, -1) {
+			if msg := unescape(string(m[1])); english[msg] != msg {
+				t.Errorf("%s: %q missing from en.json", name, msg)
+			}
+		}
+	}
+	templates, _ := fs.Glob(themeFS, "theme/*.html")
+	for _, name := range templates {
+		source, _ := themeFS.ReadFile(name)
+		check(name, source, templateCall)
+		check(name, source, scriptCall)
+	}
+	scripts, _ := fs.Glob(themeFS, "theme/*.js")
+	for _, name := range scripts {
+		source, _ := themeFS.ReadFile(name)
+		check(name, source, scriptCall)
+	}
+	sources, _ := filepath.Glob("*.go")
+	treeSources, _ := filepath.Glob(filepath.Join("tree", "*.go"))
+	sources = append(sources, treeSources...)
+	for _, name := range sources {
+		if !strings.HasSuffix(name, "_test.go") {
+			source, _ := os.ReadFile(name)
+			check(name, source, goCall)
+		}
+	}
+}
+
+func TestMessagesFor(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, langDir), 0755)
+	if err := os.WriteFile(filepath.Join(dir, langDir, "de.json"), []byte(`{"Edit": "Bearbeiten", "Current: %s": "Aktuell: %s"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := loadTheme(nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := loadTheme([]string{dir}); err != nil {
+		t.Fatalf("loadTheme() error: %v", err)
+	}
+	prevLang := *uiLang
+	t.Cleanup(func() { *uiLang = prevLang })
+
+	tests := []struct {
+		flag, acceptLanguage, want string
+	}{
+		{"", "de-AT,de;q=0.9,en;q=0.8", "Bearbeiten"},
+		{"", "en-US,en;q=0.9,de;q=0.8", "Edit"},
+		{"", "fr", "Edit"},
+		{"de", "en-US", "Bearbeiten"},
+		{"en", "de", "Edit"},
+		{"fr", "de", "Edit"}, // No French translation: English
+	}
+	for _, tt := range tests {
+		*uiLang = tt.flag
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+		if got := messagesFor(r).T("Edit"); got != tt.want {
+			t.Errorf("--lang=%q, Accept-Language %q: Edit = %q, want %q", tt.flag, tt.acceptLanguage, got, tt.want)
+		}
+	}
+
+	// Templates translate through .T and declare the language
+	*uiLang = ""
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "de")
+	var buf bytes.Buffer
+	data := browserTemplateData{baseTemplateData: newBaseTemplateData(r), Title: "Doc", BrowsePath: "~/docs", ShowBackButton: true, Content: "<p>Hi</p>"}
+	if err := fileBrowserTmpl.Execute(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<html lang="de"`, "✏️ Bearbeiten", "Aktuell: ~/docs", "📂 Reveal", `window.uiMessages = {"Current: %s":"Aktuell: %s","Edit":"Bearbeiten"};`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("file browser page missing %q", want)
+		}
+	}
+}
+
+func TestLoadLanguagesInvalid(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, langDir), 0755)
+	os.WriteFile(filepath.Join(dir, langDir, "de.json"), []byte(`{"Edit": 1}`), 0644)
+	before := uiLanguages
+	if err := loadTheme([]string{dir}); err == nil || !strings.Contains(err.Error(), "lang/de.json") {
+		t.Errorf("loadTheme() error = %v, want a lang/de.json parse error", err)
+	}
+	if uiLanguages != before {
+		t.Error("translations replaced despite the parse error")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/razvandimescu/peekm/frontmatter"
+	"github.com/razvandimescu/peekm/render"
+	"github.com/razvandimescu/peekm/safepath"
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// Embed limits: notes embedding notes stop at maxEmbedDepth, and images are
+// inlined as data URIs only up to maxEmbedImageSize
+const (
+	maxEmbedDepth     = 4
+	maxEmbedImageSize = 10 << 20
+)
+
+// embedImageTypes are the file extensions embedded as images
+var embedImageTypes = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".bmp", ".avif"}
+
+// vaultEmbedResolver resolves ![[Target]] embeds for --vault. Notes must be
+// whitelisted markdown files; chain holds the notes already being embedded so
+// a note that embeds itself (directly or not) stops instead of recursing.
+func vaultEmbedResolver(chain []string) render.EmbedResolver {
+	return func(target string) ([]byte, bool) {
+		target, size, _ := strings.Cut(target, "|")
+		target = strings.TrimSpace(target)
+		if slices.Contains(embedImageTypes, strings.ToLower(filepath.Ext(target))) {
+			return embedImage(target, strings.TrimSpace(size))
+		}
+		return embedNote(target, chain)
+	}
+}
+
+// embedNote renders a note, or the section under one of its headings
+// (Note#Heading), wrapped in a link back to the note
+func embedNote(target string, chain []string) ([]byte, bool) {
+	page, heading, _ := strings.Cut(target, "#")
+	relPath, found := resolveWikiTarget(strings.TrimSpace(page))
+	if !found || len(chain) >= maxEmbedDepth || slices.Contains(chain, relPath) {
+		return nil, false
+	}
+	absPath := resolveFilePath(relPath)
+	if !isWhitelistedFile(absPath) {
+		return nil, false
+	}
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, false
+	}
+
+	_, body, _ := frontmatter.Split(string(content))
+	title := strings.TrimSuffix(filepath.Base(relPath), filepath.Ext(relPath))
+	href := viewURL(relPath)
+	if heading = strings.TrimSpace(heading); heading != "" {
+		if body, found = headingSection(body, heading); !found {
+			return nil, false
+		}
+		title += " › " + heading
+		href += "#" + render.HeadingSlug(heading)
+	}
+
+	opts := markdownOptions()
+	opts.Embeds = vaultEmbedResolver(append(slices.Clone(chain), relPath))
+	rendered, err := render.ToHTML(render.New(opts), []byte(body))
+	if err != nil {
+		return nil, false
+	}
+	return fmt.Appendf(nil, "<div class=\"markdown-embed\">\n<div class=\"markdown-embed-title\"><a href=\"%s\">%s</a></div>\n%s</div>\n",
+		html.EscapeString(href), html.EscapeString(title), rendered), true
+}
+
+// headingSection returns a heading and everything below it up to the next
+// heading of the same or a higher level. Headings match by text or anchor.
+func headingSection(body, heading string) (string, bool) {
+	lines := strings.SplitAfter(body, "\n")
+	want := render.HeadingSlug(heading)
+	start, level := -1, 0
+	inFence := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		depth := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		if depth == 0 || depth > 6 || (len(trimmed) > depth && trimmed[depth] != ' ') {
+			continue
+		}
+		if start >= 0 && depth <= level {
+			return strings.Join(lines[start:i], ""), true
+		}
+		if start < 0 && render.HeadingSlug(strings.Trim(trimmed[depth:], " #")) == want {
+			start, level = i, depth
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	return strings.Join(lines[start:], ""), true
+}
+
+// embedImage inlines an image from the vault as a data URI. size is Obsidian's
+// "300" (width) or "300x200" suffix.
+func embedImage(target, size string) ([]byte, bool) {
+	absPath, err := findVaultFile(target)
+	if err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil || len(data) > maxEmbedImageSize {
+		return nil, false
+	}
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(absPath)))
+	if mimeType == "" {
+		return nil, false
+	}
+
+	var attrs string
+	if width, height, _ := strings.Cut(size, "x"); isDigits(width) {
+		attrs = fmt.Sprintf(` width="%s"`, width)
+		if isDigits(height) {
+			attrs += fmt.Sprintf(` height="%s"`, height)
+		}
+	}
+	return fmt.Appendf(nil, `<img class="embed-image" src="data:%s;base64,%s" alt="%s"%s>`,
+		mimeType, base64.StdEncoding.EncodeToString(data), html.EscapeString(filepath.Base(target)), attrs), true
+}
+
+// findVaultFile locates an embedded file by its path from the vault root or,
+// like Obsidian, by its name anywhere in the vault outside excluded directories
+func findVaultFile(target string) (string, error) {
+	root := resolveFilePath(".")
+	target = filepath.FromSlash(strings.TrimPrefix(target, "/"))
+	candidate := filepath.Join(root, target)
+
+	if _, err := os.Stat(candidate); err != nil {
+		candidate = ""
+		name := strings.ToLower(filepath.Base(target))
+		patterns := getIgnorePatterns(root)
+		errFound := errors.New("found")
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && tree.IsExcludedDir(d.Name(), patterns) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.ToLower(d.Name()) == name {
+				candidate = path
+				return errFound
+			}
+			return nil
+		})
+		if candidate == "" {
+			return "", fs.ErrNotExist
+		}
+	}
+
+	// Same boundary as served files: inside $HOME and the browsed directory
+	resolved, err := safepath.Resolve(candidate)
+	if err != nil {
+		return "", err
+	}
+	if resolvedRoot, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolvedRoot
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("outside the vault")
+	}
+	return resolved, nil
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestVaultEmbeds tests note, section and image embeds and their limits
+func TestVaultEmbeds(t *testing.T) {
+	dir := filepath.Join(serveTestFiles(t, "vault", nil), "vault")
+
+	files := map[string]string{
+		"Home.md":                 "# Home\n\n![[Recipe]]\n\n![[Recipe#Steps]]\n\n![[photo.png|120x80]]\n",
+		"notes/Recipe.md":         "---\ntags: [food]\n---\n# Recipe\n\nIntro.\n\n## Steps\n\n```sh\n# not a heading\n```\n\nMix.\n\n## Notes\n\nLater.\n",
+		"notes/Loop.md":           "Loop start\n\n![[Loop]]\n",
+		"attachments/photo.png":   "\x89PNG fake",
+		"node_modules/hidden.png": "\x89PNG hidden",
+		"../outside.png":          "\x89PNG outside",
+	}
+	writeVaultFiles(t, dir, files)
+
+	oldWiki, oldVault := *wikiMode, *vaultMode
+	defer func() { *wikiMode, *vaultMode = oldWiki, oldVault }()
+	browseDir = dir
+	markdownFiles = newFileSet([]string{filepath.Join(dir, "Home.md"), filepath.Join(dir, "notes", "Recipe.md"), filepath.Join(dir, "notes", "Loop.md")})
+	*wikiMode, *vaultMode = true, true
+
+	render := func(source string) string {
+		t.Helper()
+		got, err := renderMarkdown([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	got := render(files["Home.md"])
+	for _, want := range []string{
+		`<div class="markdown-embed-title"><a href="/view/notes/Recipe.md">Recipe</a></div>`,
+		"<p>Intro.</p>",
+		`<a href="/view/notes/Recipe.md#steps">Recipe › Steps</a>`,
+		`<img class="embed-image" src="data:image/png;base64,`,
+		`width="120" height="80"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "food") {
+		t.Errorf("front matter of the embedded note was rendered:\n%s", got)
+	}
+	if section := got[strings.Index(got, "Recipe › Steps"):]; strings.Contains(section, "Later.") || !strings.Contains(section, "Mix.") {
+		t.Errorf("section embed should stop at the next heading:\n%s", section)
+	}
+
+	if got := render("![[Loop]]"); strings.Count(got, "Loop start") != 1 || !strings.Contains(got, "embed-missing") {
+		t.Errorf("self-embedding note should stop after one level:\n%s", got)
+	}
+	for _, target := range []string{"Missing", "Recipe#No Such Heading", "hidden.png", "../outside.png", "missing.png"} {
+		if got := render("![[" + target + "]]"); !strings.Contains(got, "embed-missing") {
+			t.Errorf("![[%s]] should not embed:\n%s", target, got)
+		}
+	}
+}
+
+// writeVaultFiles writes files (relative path to content) under dir
+func writeVaultFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestHeadingSection tests section extraction by heading text and anchor
+func TestHeadingSection(t *testing.T) {
+	body := "# Title\n\n## Setup\n\nStep one.\n\n### Detail\n\nMore.\n\n## Usage\n\nRun it.\n"
+	tests := []struct {
+		heading string
+		want    string
+		found   bool
+	}{
+		{"Setup", "## Setup\n\nStep one.\n\n### Detail\n\nMore.\n\n", true},
+		{"usage", "## Usage\n\nRun it.\n", true},
+		{"detail", "### Detail\n\nMore.\n\n", true},
+		{"Missing", "", false},
+	}
+	for _, tt := range tests {
+		got, found := headingSection(body, tt.heading)
+		if got != tt.want || found != tt.found {
+			t.Errorf("headingSection(%q) = %q, %v; want %q, %v", tt.heading, got, found, tt.want, tt.found)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+// Package watch wraps fsnotify for peekm's two watching modes: a set of files
+// (live reload of the documents open in browser tabs) and a whole directory
+// tree (files appearing, changing and disappearing in the sidebar).
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// DirHandlers receives directory tree events. New subdirectories are added to the
+// watcher automatically (when inside $HOME), and the watches of removed ones
+// dropped; callbacks may be nil. A directory moved away is reported by its own
+// path only, not file by file, and so may be a deleted one.
+type DirHandlers struct {
+	SkipDir func(path string) bool // Excludes subdirectories from the initial walk and new ones
+	Created func(path string)      // File or directory created
+	Removed func(path string)      // File or directory deleted
+	Renamed func(path string)      // File or directory renamed away
+	Written func(path string)      // File written
+}
+
+// Manager manages file watching with proper cleanup. WatchFiles keeps one
+// watcher and adds or removes paths as the set changes; WatchDirectory
+// replaces the previous watcher. The zero value is ready to use.
+type Manager struct {
+	mu      sync.Mutex
+	current *fsnotify.Watcher
+	cancel  context.CancelFunc
+	files   map[string]os.FileInfo // Paths watched by WatchFiles, with the file watched (nil while waiting for a replacement); nil when it isn't running
+	onWrite func(path string)      // WatchFiles callback
+}
+
+// WatchFile watches a single file and calls onWrite whenever it is written
+func (m *Manager) WatchFile(filePath string, onWrite func(path string)) error {
+	return m.WatchFiles([]string{filePath}, onWrite)
+}
+
+// WatchFiles watches a set of files and calls onWrite with the path of whichever
+// is written. Files already watched stay watched (no events are lost while the
+// set changes); files that cannot be watched are skipped and reported in the
+// returned error. An empty set stops the watcher.
+func (m *Manager) WatchFiles(filePaths []string, onWrite func(path string)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(filePaths) == 0 {
+		m.stopLocked()
+		return nil
+	}
+	if m.files == nil {
+		// Not watching files yet (or watching a directory): start a watcher
+		m.stopLocked()
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		m.current, m.cancel, m.files = watcher, cancel, make(map[string]os.FileInfo)
+		go m.watchFilesWithContext(ctx, watcher)
+	}
+	m.onWrite = onWrite
+
+	wanted := make(map[string]bool, len(filePaths))
+	for _, filePath := range filePaths {
+		wanted[filePath] = true
+	}
+	for filePath := range m.files {
+		if !wanted[filePath] {
+			m.current.Remove(filePath) // Fails harmlessly if the file is gone
+			delete(m.files, filePath)
+		}
+	}
+	var addErrs []error
+	for filePath := range wanted {
+		if _, watched := m.files[filePath]; watched {
+			continue
+		}
+		if err := m.addFileLocked(filePath); err != nil {
+			addErrs = append(addErrs, err)
+		}
+	}
+	if len(m.files) == 0 {
+		m.stopLocked()
+	}
+	return errors.Join(addErrs...)
+}
+
+// WatchDirectory watches rootDir and every non-excluded subdirectory
+func (m *Manager) WatchDirectory(rootDir string, handlers DirHandlers) error {
+	m.mu.Lock()
+
+	// Stop existing watcher (under lock)
+	m.stopLocked()
+
+	// Start new watcher
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.current = watcher
+
+	// Add root directory
+	if err := watcher.Add(rootDir); err != nil {
+		if closeErr := watcher.Close(); closeErr != nil {
+			log.Printf("Failed to close watcher after add error: %v", closeErr)
+		}
+		cancel()
+		m.current = nil
+		m.cancel = nil
+		m.mu.Unlock()
+		return err
+	}
+
+	// Unlock before slow directory walk
+	m.mu.Unlock()
+
+	// Collect directories to watch (without lock to avoid blocking on large trees)
+	dirsToWatch, err := collectDirectories(rootDir, handlers.SkipDir)
+	if err != nil {
+		m.mu.Lock()
+		// Clean up if we still own this watcher
+		if m.current == watcher {
+			if closeErr := watcher.Close(); closeErr != nil {
+				log.Printf("Failed to close watcher after directory walk error: %v", closeErr)
+			}
+			cancel()
+			m.current = nil
+			m.cancel = nil
+		}
+		m.mu.Unlock()
+		return fmt.Errorf("directory walk failed: %w", err)
+	}
+
+	// Re-acquire lock to finish setup
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check if watcher was replaced during walk
+	if m.current != watcher {
+		// Another call won the race, abandon this setup
+		if closeErr := watcher.Close(); closeErr != nil {
+			log.Printf("Failed to close abandoned watcher: %v", closeErr)
+		}
+		cancel()
+		return fmt.Errorf("watcher setup cancelled (replaced during walk)")
+	}
+
+	// Add directories (holding lock)
+	for _, dir := range dirsToWatch {
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("Warning: Cannot watch directory %s: %v", dir, err)
+		}
+	}
+
+	go watchDirectoryWithContext(ctx, watcher, handlers)
+	return nil
+}
+
+// AddDirectory adds a directory to the current directory watcher (e.g. one
+// created from the UI) without waiting for its create event
+func (m *Manager) AddDirectory(dirPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.current == nil {
+		return fmt.Errorf("no active watcher")
+	}
+	if !safepath.WithinHome(dirPath) {
+		return fmt.Errorf("directory outside home: %s", dirPath)
+	}
+	return m.current.Add(dirPath)
+}
+
+// Close stops the current watcher
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopLocked()
+}
+
+// stopLocked cancels and closes the current watcher; m.mu must be held
+func (m *Manager) stopLocked() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.current != nil {
+		m.current.Close()
+	}
+	m.current, m.cancel, m.files = nil, nil, nil
+}
+
+// collectDirectories walks the directory tree and returns paths to watch
+func collectDirectories(rootDir string, skipDir func(path string) bool) ([]string, error) {
+	var dirsToWatch []string
+	homeDir, _ := os.UserHomeDir()
+
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Security: Skip symlinks outside $HOME
+		resolvedInfo, _, resolveErr := safepath.CheckSymlink(path, info, homeDir)
+		if resolveErr != nil {
+			return nil
+		}
+		if resolvedInfo != nil {
+			info = resolvedInfo
+		}
+
+		if info.IsDir() && path != rootDir {
+			if skipDir != nil && skipDir(path) {
+				return filepath.SkipDir
+			}
+			dirsToWatch = append(dirsToWatch, path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return dirsToWatch, nil
+}
+
+// watchFilesWithContext delivers the writes to the files WatchFiles watches
+func (m *Manager) watchFilesWithContext(ctx context.Context, watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if onWrite := m.fileEvent(watcher, event); onWrite != nil {
+				onWrite(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watcher error: %v", err)
+		}
+	}
+}
+
+// Retrying the watch of a file removed or renamed away: editors that move the
+// original aside before writing the new file leave the path empty for a moment
+const (
+	rewatchAttempts = 20
+	rewatchInterval = 50 * time.Millisecond
+)
+
+// addFileLocked watches filePath and remembers which file it is, to tell a
+// replacement from an attribute change later. m.mu must be held.
+func (m *Manager) addFileLocked(filePath string) error {
+	if err := m.current.Add(filePath); err != nil {
+		return err
+	}
+	info, _ := os.Stat(filePath)
+	m.files[filePath] = info
+	return nil
+}
+
+// fileEvent returns the callback to report event to, or nil to ignore it.
+// Atomic saves (write a temporary file, rename it over the original) replace
+// the watched file, which loses the watch on its old inode: the new file is
+// watched instead and reported as written. Depending on the platform and
+// editor, that shows up as Chmod (the old file's link count dropped), Remove
+// or Rename.
+func (m *Manager) fileEvent(watcher *fsnotify.Watcher, event fsnotify.Event) func(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	watched, found := m.files[event.Name]
+	if m.current != watcher || !found {
+		return nil // Dropped from the set meanwhile
+	}
+	if event.Op&fsnotify.Write == fsnotify.Write {
+		return m.onWrite
+	}
+	if event.Op&(fsnotify.Chmod|fsnotify.Remove|fsnotify.Rename) == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(event.Name)
+	if err == nil && os.SameFile(info, watched) {
+		return nil // Still the watched file: just an attribute change
+	}
+	if err != nil || m.addFileLocked(event.Name) != nil {
+		if watched != nil { // Not already waiting for a replacement
+			m.files[event.Name] = nil
+			go m.rewatch(watcher, event.Name)
+		}
+		return nil
+	}
+	return m.onWrite
+}
+
+// rewatch waits for a replacement of a removed file to appear, then watches it
+// and reports it as written. A file still missing after rewatchAttempts is
+// dropped from the set; the next WatchFiles that wants it adds it back.
+func (m *Manager) rewatch(watcher *fsnotify.Watcher, filePath string) {
+	for range rewatchAttempts {
+		time.Sleep(rewatchInterval)
+		if onWrite, done := m.tryRewatch(watcher, filePath); done {
+			if onWrite != nil {
+				onWrite(filePath)
+			}
+			return
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current == watcher {
+		delete(m.files, filePath)
+	}
+}
+
+// tryRewatch watches filePath again if it exists. It reports done when the
+// watch is back or no longer wanted, with the callback to report the write to.
+func (m *Manager) tryRewatch(watcher *fsnotify.Watcher, filePath string) (func(path string), bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, found := m.files[filePath]; m.current != watcher || !found {
+		return nil, true
+	}
+	if m.addFileLocked(filePath) != nil {
+		return nil, false
+	}
+	return m.onWrite, true
+}
+
+// handleDirCreated adds a newly created directory to the watcher if it's
+// within $HOME, with the subdirectories it already has (one moved into the
+// tree arrives whole)
+func handleDirCreated(watcher *fsnotify.Watcher, dirPath string, skipDir func(path string) bool) {
+	if !safepath.WithinHome(dirPath) || (skipDir != nil && skipDir(dirPath)) {
+		return
+	}
+	if err := watcher.Add(dirPath); err != nil {
+		log.Printf("Warning: Cannot watch new directory %s: %v", dirPath, err)
+		return
+	}
+	log.Printf("Now watching new directory: %s", dirPath)
+
+	subdirs, err := collectDirectories(dirPath, skipDir)
+	if err != nil {
+		log.Printf("Warning: Cannot walk new directory %s: %v", dirPath, err)
+	}
+	for _, dir := range subdirs {
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("Warning: Cannot watch directory %s: %v", dir, err)
+		}
+	}
+}
+
+// dropWatchesUnder removes the watches of a directory deleted or renamed away
+// and of its subdirectories. The kernel drops a deleted directory's watch by
+// itself, but the watches of a moved directory keep following it under
+// their old paths, and would stop its new path from being watched.
+func dropWatchesUnder(watcher *fsnotify.Watcher, dirPath string) {
+	prefix := dirPath + string(filepath.Separator)
+	for _, watched := range watcher.WatchList() {
+		if watched == dirPath || strings.HasPrefix(watched, prefix) {
+			watcher.Remove(watched) // Fails harmlessly if already dropped
+		}
+	}
+}
+
+func watchDirectoryWithContext(ctx context.Context, watcher *fsnotify.Watcher, handlers DirHandlers) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			dispatchDirEvent(watcher, event, handlers)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Directory watcher error: %v", err)
+		}
+	}
+}
+
+// dispatchDirEvent routes a directory tree event to the matching handler
+func dispatchDirEvent(watcher *fsnotify.Watcher, event fsnotify.Event, handlers DirHandlers) {
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		dropWatchesUnder(watcher, event.Name)
+	}
+
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			handleDirCreated(watcher, event.Name, handlers.SkipDir)
+		}
+		if handlers.Created != nil {
+			handlers.Created(event.Name)
+		}
+	}
+
+	if event.Op&fsnotify.Remove == fsnotify.Remove && handlers.Removed != nil {
+		handlers.Removed(event.Name)
+	}
+
+	if event.Op&fsnotify.Rename == fsnotify.Rename && handlers.Renamed != nil {
+		handlers.Renamed(event.Name)
+	}
+
+	if event.Op&fsnotify.Write == fsnotify.Write && handlers.Written != nil {
+		handlers.Written(event.Name)
+	}
+}
@@ -0,0 +1,267 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writes collects the paths a watcher reports as written
+type writes chan string
+
+func (w writes) onWrite(path string) { w <- path }
+
+// expect waits for a write to path, failing on a write to any other file
+func (w writes) expect(t *testing.T, path string) {
+	t.Helper()
+	select {
+	case got := <-w:
+		if got != path {
+			t.Errorf("write reported for %s, want %s", got, path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("no write reported for %s", path)
+	}
+}
+
+// expectNone fails if a write is reported shortly
+func (w writes) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case got := <-w:
+		t.Errorf("write reported for unwatched %s", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func newFiles(t *testing.T, names ...string) []string {
+	dir := t.TempDir()
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[i], []byte("# "+name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// TestWatchFilesRapidSwitching tests that switching files keeps one watcher
+// and watches exactly the latest set
+func TestWatchFilesRapidSwitching(t *testing.T) {
+	files := newFiles(t, "a.md", "b.md", "c.md")
+	a, b, c := files[0], files[1], files[2]
+	var m Manager
+	defer m.Close()
+	got := make(writes, 10)
+
+	if err := m.WatchFiles([]string{a}, got.onWrite); err != nil {
+		t.Fatal(err)
+	}
+	watcher := m.current
+	for i := range 100 {
+		sets := [][]string{{a, b}, {b}, {c, a}, {a}}
+		if err := m.WatchFiles(sets[i%len(sets)], got.onWrite); err != nil {
+			t.Fatal(err)
+		}
+		if m.current != watcher {
+			t.Fatalf("switch %d replaced the watcher", i)
+		}
+	}
+	if _, watched := m.files[a]; len(m.files) != 1 || !watched {
+		t.Errorf("watched %v, want only %s", m.files, a)
+	}
+
+	os.WriteFile(b, []byte("unwatched\n"), 0644)
+	got.expectNone(t)
+	os.WriteFile(a, []byte("watched\n"), 0644)
+	got.expect(t, a)
+}
+
+// TestWatchFilesKeepsWatching tests that a file watched before and after a
+// switch reports writes made while the set changes
+func TestWatchFilesKeepsWatching(t *testing.T) {
+	files := newFiles(t, "a.md", "b.md")
+	a, b := files[0], files[1]
+	var m Manager
+	defer m.Close()
+	got := make(writes, 10)
+
+	if err := m.WatchFiles([]string{a}, got.onWrite); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(a, []byte("during the switch\n"), 0644)
+	if err := m.WatchFiles([]string{a, b}, got.onWrite); err != nil {
+		t.Fatal(err)
+	}
+	got.expect(t, a)
+}
+
+// TestWatchFilesAtomicSave tests that saves replacing the file are reported
+// and the new file stays watched
+func TestWatchFilesAtomicSave(t *testing.T) {
+	saves := []struct {
+		name string
+		save func(path string) error
+	}{
+		{"rename over", func(path string) error { // VS Code, most editors
+			os.WriteFile(path+".tmp", []byte("saved\n"), 0644)
+			return os.Rename(path+".tmp", path)
+		}},
+		{"move aside, then write", func(path string) error { // vim's backup
+			if err := os.Rename(path, path+"~"); err != nil {
+				return err
+			}
+			time.Sleep(3 * rewatchInterval)
+			return os.WriteFile(path, []byte("saved\n"), 0644)
+		}},
+		{"remove, then write", func(path string) error {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			time.Sleep(rewatchInterval / 2)
+			return os.WriteFile(path, []byte("saved\n"), 0644)
+		}},
+	}
+	for _, tt := range saves {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newFiles(t, "a.md")[0]
+			var m Manager
+			defer m.Close()
+			got := make(writes, 10)
+
+			if err := m.WatchFiles([]string{a}, got.onWrite); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.save(a); err != nil {
+				t.Fatal(err)
+			}
+			got.expect(t, a)
+
+			// Drain what the replacement reported, then the new file is watched
+			time.Sleep(5 * rewatchInterval)
+			for len(got) > 0 {
+				<-got
+			}
+			os.WriteFile(a, []byte("written again\n"), 0644)
+			got.expect(t, a)
+		})
+	}
+}
+
+// TestWatchFilesChmod tests that a permission change alone is not a write
+func TestWatchFilesChmod(t *testing.T) {
+	a := newFiles(t, "a.md")[0]
+	var m Manager
+	defer m.Close()
+	got := make(writes, 10)
+
+	if err := m.WatchFiles([]string{a}, got.onWrite); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(a, 0600)
+	got.expectNone(t)
+}
+
+// TestWatchFilesGone tests that a file deleted for good leaves the set, so a
+// later WatchFiles watches it again once it is back
+func TestWatchFilesGone(t *testing.T) {
+	a := newFiles(t, "a.md")[0]
+	var m Manager
+	defer m.Close()
+	got := make(writes, 10)
+
+	if err := m.WatchFiles([]string{a}, got.onWrite); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(a)
+	time.Sleep((rewatchAttempts + 4) * rewatchInterval)
+	m.mu.Lock()
+	_, watched := m.files[a]
+	m.mu.Unlock()
+	if watched {
+		t.Fatal("deleted file still in the watched set")
+	}
+
+	os.WriteFile(a, []byte("back\n"), 0644)
+	if err := m.WatchFiles([]string{a}, got.onWrite); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(a, []byte("written\n"), 0644)
+	got.expect(t, a)
+}
+
+// TestWatchFilesEmptyAndMissing tests stopping with an empty set and
+// skipping files that can't be watched
+func TestWatchFilesEmptyAndMissing(t *testing.T) {
+	files := newFiles(t, "a.md")
+	missing := filepath.Join(filepath.Dir(files[0]), "missing.md")
+	var m Manager
+	defer m.Close()
+	got := make(writes, 10)
+
+	if err := m.WatchFiles([]string{missing}, got.onWrite); err == nil {
+		t.Error("watching only a missing file: want an error")
+	}
+	if m.current != nil {
+		t.Error("watcher left running with nothing to watch")
+	}
+	if err := m.WatchFiles([]string{files[0], missing}, got.onWrite); err == nil {
+		t.Error("missing file not reported")
+	}
+	if _, watched := m.files[files[0]]; !watched {
+		t.Error("existing file not watched next to a missing one")
+	}
+	if err := m.WatchFiles(nil, got.onWrite); err != nil || m.current != nil {
+		t.Errorf("empty set: err %v, watcher running %v", err, m.current != nil)
+	}
+}
+
+// TestWatchDirectoryMove tests that a directory moved within the tree is
+// watched at its new path, subdirectories included, and not at the old one
+func TestWatchDirectoryMove(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HOME", root) // New directories are watched only inside $HOME
+	if err := os.MkdirAll(filepath.Join(root, "drafts", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan string, 20)
+	var m Manager
+	defer m.Close()
+	err := m.WatchDirectory(root, DirHandlers{
+		Created: func(path string) { events <- "created " + path },
+		Renamed: func(path string) { events <- "renamed " + path },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(filepath.Join(root, "drafts"), filepath.Join(root, "archive")); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent := func(want string) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case got := <-events:
+				if got == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no event %q", want)
+			}
+		}
+	}
+	expectEvent("created " + filepath.Join(root, "archive"))
+
+	os.WriteFile(filepath.Join(root, "archive", "sub", "new.md"), []byte("# New\n"), 0644)
+	expectEvent("created " + filepath.Join(root, "archive", "sub", "new.md"))
+	for _, watched := range m.current.WatchList() {
+		if strings.HasPrefix(watched, filepath.Join(root, "drafts")) {
+			t.Errorf("still watching %s after the move", watched)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// claudeCodeSource is the hook source name used by the installed Claude Code hook script
+const claudeCodeSource = "claude-code"
+
+// hookSignatureHeader carries "sha256=<hex HMAC-SHA256 of the request body>"
+const hookSignatureHeader = "X-Peekm-Signature"
+
+// maxHookBodySize caps hook request bodies (10 MB; plan files are forwarded in full)
+const maxHookBodySize = 10 << 20
+
+// handleClaudeHook receives events from Claude Code hook scripts posting to /hook/file-modified
+func handleClaudeHook(w http.ResponseWriter, r *http.Request) {
+	serveHook(w, r, claudeCodeSource)
+}
+
+// handleHook receives events from any agent at /hook/{source} (claude-code, cursor, aider, ...)
+func handleHook(w http.ResponseWriter, r *http.Request) {
+	source := r.PathValue("source")
+	if !isValidHookSource(source) {
+		writeError(w, errCodeNotFound, "Invalid hook source", http.StatusNotFound)
+		return
+	}
+	serveHook(w, r, source)
+}
+
+// serveHook verifies, decodes and dispatches a hook event attributed to source
+func serveHook(w http.ResponseWriter, r *http.Request, source string) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHookBodySize))
+	if isBodyTooLarge(err) {
+		writeError(w, errCodeTooLarge, "Hook body too large (at most 10 MB)", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if secret := hookSecretValue(); secret != "" && !verifyHookSignature(body, r.Header.Get(hookSignatureHeader), secret) {
+		log.Printf("Warning: Rejected %s hook with invalid or missing signature", source)
+		writeError(w, errCodeUnauthorized, "Invalid or missing hook signature", http.StatusUnauthorized)
+		return
+	}
+
+	var req hookRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Source = source
+
+	// Payloads without an event name come from older hook scripts and simple
+	// integrations that only report modified files
+	if req.HookEventName == "" {
+		req.HookEventName = hookPostToolUse
+	}
+	// Other agents may not have sessions; attribute their changes to the source itself
+	if req.SessionID == "" && source != claudeCodeSource {
+		req.SessionID = source
+	}
+
+	if err := dispatchHookEvent(req); err != nil {
+		writeError(w, errCodeBadRequest, "Invalid hook event: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// dispatchHookEvent validates a hook event and routes it to its handler
+func dispatchHookEvent(req hookRequest) error {
+	switch req.HookEventName {
+	case hookPreToolUse, hookPostToolUse:
+		if req.SessionID == "" || req.FilePath == "" {
+			return errors.New("missing required fields: session_id and file_path")
+		}
+		if req.HookEventName == hookPreToolUse {
+			handlePreToolUse(req)
+		} else {
+			handlePostToolUse(req)
+		}
+	case hookStop, hookSubagentStop:
+		if req.SessionID == "" {
+			return errors.New("missing required field: session_id")
+		}
+		handleSessionStop(req)
+	default:
+		return fmt.Errorf("unsupported hook_event_name %q", req.HookEventName)
+	}
+	return nil
+}
+
+// hookSecretValue returns the shared hook secret from --hook-secret or $PEEKM_HOOK_SECRET
+func hookSecretValue() string {
+	if *hookSecret != "" {
+		return *hookSecret
+	}
+	return os.Getenv("PEEKM_HOOK_SECRET")
+}
+
+// verifyHookSignature checks a "sha256=<hex>" HMAC-SHA256 signature of body
+func verifyHookSignature(body []byte, signature, secret string) bool {
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// isValidHookSource accepts short lowercase source names such as "cursor" or "my-script"
+func isValidHookSource(source string) bool {
+	if source == "" || len(source) > 32 {
+		return false
+	}
+	for _, c := range source {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
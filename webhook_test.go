@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sign(body, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandleHookSignature(t *testing.T) {
+	prevStore, prevSecret := globalSessionStore, *hookSecret
+	globalSessionStore = newSessionStore()
+	*hookSecret = "s3cret"
+	defer func() { globalSessionStore, *hookSecret = prevStore, prevSecret }()
+
+	body := `{"hook_event_name":"Stop"}`
+	tests := []struct {
+		name      string
+		source    string
+		signature string
+		want      int
+	}{
+		{"valid signature", "cursor", sign(body, "s3cret"), http.StatusOK},
+		{"missing signature", "cursor", "", http.StatusUnauthorized},
+		{"wrong secret", "cursor", sign(body, "other"), http.StatusUnauthorized},
+		{"malformed signature", "cursor", "sha256=zz", http.StatusUnauthorized},
+		{"invalid source", "Cursor.app", sign(body, "s3cret"), http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/hook/"+tt.source, strings.NewReader(body))
+			req.SetPathValue("source", tt.source)
+			if tt.signature != "" {
+				req.Header.Set(hookSignatureHeader, tt.signature)
+			}
+			rec := httptest.NewRecorder()
+			handleHook(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	// Sessionless sources are attributed to the source itself
+	events := globalSessionStore.sessionEvents("cursor")
+	if len(events) != 1 || events[0].Source != "cursor" || events[0].Type != hookStop {
+		t.Errorf("cursor events = %+v, want one Stop event from cursor", events)
+	}
+}
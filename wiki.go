@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// resolveWikiTarget maps a page name to a markdown file relative to browseDir.
+// Matches the relative path first, then the base name (case-insensitive). For
+// missing pages it returns the path where the page would be created.
+func resolveWikiTarget(target string) (string, bool) {
+	fileMutex.RLock()
+	currentBrowseDir := browseDir
+	currentMarkdownFiles := markdownFiles.list()
+	fileMutex.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(filepath.ToSlash(target), ".md"))
+	hasDir := strings.Contains(name, "/")
+
+	var baseMatch string
+	for _, f := range currentMarkdownFiles {
+		rel, err := filepath.Rel(currentBrowseDir, f)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		relName := strings.ToLower(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		if relName == name {
+			return rel, true
+		}
+		if !hasDir && baseMatch == "" && strings.ToLower(strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel))) == name {
+			baseMatch = rel
+		}
+	}
+	if baseMatch != "" {
+		return baseMatch, true
+	}
+
+	newPath := filepath.ToSlash(filepath.Clean(strings.TrimPrefix(target, "/")))
+	if !strings.HasSuffix(strings.ToLower(newPath), ".md") {
+		newPath += ".md"
+	}
+	return newPath, false
+}
+
+// newPageContent returns the starter content for a page created from a wiki link
+func newPageContent(relPath string) string {
+	title := strings.TrimSuffix(filepath.Base(relPath), filepath.Ext(relPath))
+	return fmt.Sprintf("# %s\n\n", title)
+}
+
+// handleCreate creates a new markdown file inside browseDir and whitelists it
+func handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path     string            `json:"path"`
+		Content  *string           `json:"content"`  // Optional; defaults to a title heading
+		Template string            `json:"template"` // Optional template name (see templates.go)
+		Vars     map[string]string `json:"vars"`     // Extra template variables
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCreateBodySize)).Decode(&req)
+	if isBodyTooLarge(err) {
+		writeError(w, errCodeTooLarge, "Content too large to create (at most 10 MB)", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeError(w, errCodeBadRequest, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	relPath := filepath.Clean(strings.TrimPrefix(strings.TrimSpace(req.Path), "/"))
+	if relPath == "." || !strings.HasSuffix(strings.ToLower(relPath), ".md") {
+		writeError(w, errCodeBadRequest, "Path must name a .md file", http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsLocal(relPath) {
+		writeError(w, errCodePathOutsideRoot, "Path must be inside the browse directory", http.StatusForbidden)
+		return
+	}
+
+	if req.Template != "" {
+		if req.Content != nil {
+			writeError(w, errCodeBadRequest, "Use either content or template, not both", http.StatusBadRequest)
+			return
+		}
+		body, err := instantiateTemplate(req.Template, relPath, req.Vars)
+		if err != nil {
+			statusCode, code := http.StatusBadRequest, errCodeBadRequest
+			if errors.Is(err, os.ErrNotExist) {
+				statusCode, code = http.StatusNotFound, errCodeNotFound
+			}
+			writeError(w, code, fmt.Sprintf("Cannot use template: %v", err), statusCode)
+			return
+		}
+		req.Content = &body
+	}
+
+	absPath, err := createMarkdownFile(relPath, req.Content)
+	if err != nil {
+		statusCode, code := createErrorStatus(err)
+		writeError(w, code, fmt.Sprintf("Cannot create file: %v", err), statusCode)
+		return
+	}
+
+	log.Printf("Created file: %s", absPath)
+	sendFileEvent("file_added", filepath.ToSlash(relPath), "")
+
+	writeJSON(w, http.StatusCreated, map[string]string{"path": filepath.ToSlash(relPath)})
+}
+
+// makeParentDirs checks that absPath may be created and makes its missing
+// parent directories. The deepest existing ancestor is validated before
+// anything is created, so a symlinked directory can't lead outside $HOME.
+func makeParentDirs(absPath string) error {
+	if _, err := safepath.Resolve(resolveFilePath(".")); err != nil {
+		return err
+	}
+	if err := checkWritable(absPath); err != nil {
+		return err
+	}
+	parentDir := filepath.Dir(absPath)
+	existing := parentDir
+	for {
+		if _, err := os.Lstat(existing); err == nil || filepath.Dir(existing) == existing {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	if _, err := safepath.Resolve(existing); err != nil {
+		return err
+	}
+	return os.MkdirAll(parentDir, 0755)
+}
+
+// createMarkdownFile writes a new file (never overwriting) and adds it to the whitelist
+func createMarkdownFile(relPath string, content *string) (string, error) {
+	absPath := resolveFilePath(relPath)
+	if err := makeParentDirs(absPath); err != nil {
+		return "", err
+	}
+
+	body := newPageContent(relPath)
+	if content != nil {
+		body = *content
+	}
+
+	f, err := os.OpenFile(absPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(body); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	addToWhitelist(absPath)
+	return absPath, nil
+}
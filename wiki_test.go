@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/razvandimescu/peekm/safepath"
+)
+
+// TestWikiLinks tests [[Page]] rendering for existing and missing targets
+func TestWikiLinks(t *testing.T) {
+	dir := t.TempDir()
+	oldDir, oldFiles, oldWiki := browseDir, markdownFiles, *wikiMode
+	defer func() { browseDir, markdownFiles, *wikiMode = oldDir, oldFiles, oldWiki }()
+
+	browseDir = dir
+	markdownFiles = newFileSet([]string{filepath.Join(dir, "notes", "Setup Guide.md")})
+	*wikiMode = true
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "existing page by base name",
+			input: "See [[setup guide]].",
+			want:  `<a href="/view/notes/Setup%20Guide.md" class="wikilink">setup guide</a>`,
+		},
+		{
+			name:  "existing page with label and heading",
+			input: "[[Setup Guide#Install Steps|install]]",
+			want:  `<a href="/view/notes/Setup%20Guide.md#install-steps" class="wikilink">install</a>`,
+		},
+		{
+			name:  "missing page becomes red link",
+			input: "[[Ideas]]",
+			want:  `<a href="#" class="wikilink wikilink-missing" data-wiki-target="Ideas.md" title="Create Ideas.md">Ideas</a>`,
+		},
+		{
+			name:  "regular links still work",
+			input: "[docs](https://example.com)",
+			want:  `<a href="https://example.com">docs</a>`,
+		},
+	}
+
+	md := newMarkdownRenderer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := md.Convert([]byte(tt.input), &buf); err != nil {
+				t.Fatalf("Convert() error: %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("got %s, want it to contain %s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestMakeParentDirs tests that parents are only made under a validated ancestor
+func TestMakeParentDirs(t *testing.T) {
+	dir := serveTestFiles(t, "wiki", nil)
+	homeDir, _ := os.UserHomeDir()
+	outside := t.TempDir()
+	if strings.HasPrefix(outside, homeDir+string(filepath.Separator)) {
+		t.Skip("temp dir is under $HOME")
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "out")); err != nil {
+		t.Skip("cannot create symlinks")
+	}
+	if err := makeParentDirs(filepath.Join(dir, "notes", "2024", "a.md")); err != nil {
+		t.Errorf("makeParentDirs() error = %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "notes", "2024")); err != nil || !info.IsDir() {
+		t.Error("parent directories were not created")
+	}
+
+	err := makeParentDirs(filepath.Join(dir, "out", "new", "a.md"))
+	if !errors.Is(err, safepath.ErrOutsideHome) {
+		t.Errorf("makeParentDirs() through a symlink out of $HOME = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Error("created a directory outside $HOME")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/razvandimescu/peekm/frontmatter"
+	"github.com/razvandimescu/peekm/tree"
+)
+
+// wordCount is a file's word count as of a modification time and size
+type wordCount struct {
+	modTime time.Time
+	size    int64
+	words   int
+}
+
+// wordCountCache remembers word counts so the tree only reads changed files
+var wordCountCache = struct {
+	mu     sync.Mutex
+	counts map[string]wordCount
+}{counts: make(map[string]wordCount)}
+
+// countWords returns the words in the file at path (front matter excluded),
+// counting again only when its modification time or size changed. Files the
+// search index skips for their size are not counted.
+func countWords(path string, modTime time.Time, size int64) int {
+	if size > maxIndexedFileSize {
+		return 0
+	}
+	wordCountCache.mu.Lock()
+	cached, ok := wordCountCache.counts[path]
+	wordCountCache.mu.Unlock()
+	if ok && cached.modTime.Equal(modTime) && cached.size == size {
+		return cached.words
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	_, body, found := frontmatter.Split(string(content))
+	if !found {
+		body = string(content)
+	}
+	words := wordsIn(body)
+
+	wordCountCache.mu.Lock()
+	wordCountCache.counts[path] = wordCount{modTime: modTime, size: size, words: words}
+	wordCountCache.mu.Unlock()
+	return words
+}
+
+// wordsIn counts the words of text: runs of non-space characters, except
+// that Chinese and Japanese, written without spaces, count a word per
+// character (the usual measure for those languages) and full-width
+// punctuation separates rather than counts
+func wordsIn(text string) int {
+	words, inWord := 0, false
+	for _, r := range text {
+		switch {
+		case isCJKWordChar(r):
+			words++
+			inWord = false
+		case unicode.IsSpace(r) || isCJKPunct(r):
+			inWord = false
+		case !inWord:
+			words++
+			inWord = true
+		}
+	}
+	return words
+}
+
+// isCJKWordChar reports whether r is a Han ideograph or kana (including the
+// prolonged sound mark ー, which Unicode files under no script)
+func isCJKWordChar(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+// isCJKPunct reports whether r is CJK or full-width punctuation, such as 、。「」
+// and ！？
+func isCJKPunct(r rune) bool {
+	return (r >= 0x3000 && r <= 0x303f) || (r >= 0xff01 && r <= 0xff65 && unicode.IsPunct(r)) || r == '・'
+}
+
+// annotateFileTree fills in the word counts and AI session badges of the
+// files in a tree built relative to rootDir
+func annotateFileTree(root *tree.Node, rootDir string) {
+	tree.Walk(root, func(n *tree.Node) {
+		if n.IsDir {
+			return
+		}
+		absPath := filepath.Join(rootDir, n.Path)
+		n.Words = countWords(absPath, n.ModTime, n.Size)
+		if globalSessionStore == nil {
+			return
+		}
+		if metadata, found := globalSessionStore.get(absPath); found {
+			n.Session, n.Agent = metadata.SessionID, metadata.Source
+		}
+	})
+}
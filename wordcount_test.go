@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/razvandimescu/peekm/tree"
+)
+
+func TestCountWords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.md")
+	write := func(content string) os.FileInfo {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	info := write("---\ntitle: Not counted here\n---\n# Heading\n\nFive words in this line.\n")
+	if got := countWords(path, info.ModTime(), info.Size()); got != 7 {
+		t.Errorf("countWords() = %d, want 7 (front matter excluded)", got)
+	}
+
+	// Unchanged files come from the cache; changed ones are counted again
+	if err := os.WriteFile(path, []byte("one two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := countWords(path, info.ModTime(), info.Size()); got != 7 {
+		t.Errorf("countWords() with the same mtime and size = %d, want the cached 7", got)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if got := countWords(path, later, 8); got != 2 {
+		t.Errorf("countWords() after a change = %d, want 2", got)
+	}
+
+	if got := countWords(path, later, maxIndexedFileSize+1); got != 0 {
+		t.Errorf("countWords() of a file over the size limit = %d, want 0", got)
+	}
+}
+
+func TestWordsIn(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"Five words in this line.", 5},
+		{"  spaced\tout\n\nwords ", 3},
+		{"日本語の文章です。", 8},               // A word per character, punctuation not counted
+		{"「コーヒー」を飲む", 7},               // Including the prolonged sound mark
+		{"peekm は Markdown ビューアです", 9}, // Latin words among Japanese
+		{"中文，简体！", 4},
+		{"한국어 문장", 2}, // Korean separates words with spaces
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := wordsIn(tt.text); got != tt.want {
+			t.Errorf("wordsIn(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAnnotateFileTree(t *testing.T) {
+	dir := t.TempDir()
+	touched, plain := filepath.Join(dir, "touched.md"), filepath.Join(dir, "plain.md")
+	os.WriteFile(touched, []byte("agent wrote this\n"), 0644)
+	os.WriteFile(plain, []byte("hand written\n"), 0644)
+
+	prevSessions := globalSessionStore
+	defer func() { globalSessionStore = prevSessions }()
+	globalSessionStore = newSessionStore()
+	globalSessionStore.register(touched, &SessionMetadata{Source: "claude-code", SessionID: "abc123"})
+
+	root := tree.Build(dir, []string{touched, plain})
+	annotateFileTree(root, dir)
+	got := map[string]*tree.Node{}
+	for _, n := range root.Children {
+		got[n.Name] = n
+	}
+	if n := got["touched.md"]; n.Words != 3 || n.Session != "abc123" || n.Agent != "claude-code" {
+		t.Errorf("touched.md = words %d, session %q, agent %q", n.Words, n.Session, n.Agent)
+	}
+	if n := got["plain.md"]; n.Words != 2 || n.Session != "" {
+		t.Errorf("plain.md = words %d, session %q", n.Words, n.Session)
+	}
+}